@@ -0,0 +1,461 @@
+// vim: sw=8
+
+// Nog FSO shadow backup daemon `nogfsobakd`.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"github.com/nogproject/nog/backend/internal/grpcjwt"
+	"github.com/nogproject/nog/backend/internal/nogfsobakd"
+	"github.com/nogproject/nog/backend/internal/nogfsobakd/shadowbak"
+	"github.com/nogproject/nog/backend/internal/nogfsoschd/observe"
+	"github.com/nogproject/nog/backend/internal/nogfsoschd/scan"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
+	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
+	"github.com/nogproject/nog/backend/pkg/x509io"
+	"github.com/nogproject/nog/backend/pkg/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// `xVersion` and `xBuild` are injected by the `Makefile`.
+var (
+	xVersion string
+	xBuild   string
+	version  = fmt.Sprintf("nogfsobakd-%s+%s", xVersion, xBuild)
+)
+
+// `qqBackticks()` translates double single quote to backtick.
+func qqBackticks(s string) string {
+	return strings.Replace(s, "''", "`", -1)
+}
+
+var usage = qqBackticks(`Usage:
+  nogfsobakd [options] [--state=<dir>]
+             --registry=<registry>...
+             --prefix=<path>... --host=<host>... [--ref=<ref>...]
+             [--shadow-backup-root=<dir>] [--insecure-plaintext]
+             [--no-watch] [--scan-start] [--scan-every=<interval>]
+
+Options:
+  --log=<logger>  [default: prod]
+        Specify logger: prod, dev, or mu.
+  --tls-cert=<pem>  [default: /nog/ssl/certs/nogfsobakd/combined.pem]
+        TLS client certificate and corresponding private key.  PEM files can be
+        concatenated ''cat cert.pem privkey.pem > combined.pem''.
+  --tls-ca=<pem>  [default: /nog/ssl/certs/nogfsobakd/ca.pem]
+        X.509 CA for TLS.  Multiple PEM files can be concatenated.
+  --sys-jwt=<path>  [default: /nog/jwt/tokens/nogfsobakd.jwt]
+        Path of the JWT for system GRPCs.
+  --sys-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--sys-jwt'' has been modified and reload
+        it.  Use ''0'' to disable.
+  --sys-jwt-refresh=<url>
+        Token endpoint to request a new system JWT when a third of the
+        lifetime of the current JWT remains.
+  --nogfsoregd=<addr>  [default: localhost:7550]
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --bind-health=<addr>
+        Enables the gRPC health service at ''<addr>''.  The server uses
+        ''--tls-cert'' and requires client certificates from ''--tls-ca''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
+  --shutdown-timeout=<duration>  [default: 1h]
+        Maximum time to wait before forced shutdown.
+  --state=<dir>
+        Directory to which to save state that should be maintained across
+        restarts, such as journal locations.
+  --no-watch
+        Disable watch registry broadcast for changes.
+  --registry=<registry>
+        Registries to watch.
+  --prefix=<path>
+        Limits processing to repos whose global paths are equal or below one of
+        the prefixes.
+  --host=<host>
+        Repos that pass the prefix filter must be on one of the hosts.  Shadow
+        repos and shadow backups must be on the same host.
+  --ref=<ref>
+        Shadow Git refs to watch; full ref, like ''refs/heads/master-stat''.
+        Default: all refs.
+  --shadow-backup-root=<dir>
+        Initialize the shadow backup URL of repos that have none to
+        ''nogfsobak://<host>/<dir>/<repoid>''.  Without this option, repos
+        without shadow backup URL are ignored.
+  --insecure-plaintext
+        Back up repos without shadow backup recipients as plaintext.  Without
+        this option, such repos are reported as backup errors.
+  --scan-start
+        Scan repos of registries matching prefixes during startup.
+  --scan-every=<interval>
+        Regularly scan repos of registries matching prefixes.
+
+''nogfsobakd'' watches the registries for shadow ref updates of repos below
+the specified prefixes, like ''nogfsoschd'', and backs up the shadow repos to
+their shadow backup location ''nogfsobak://<host>/<path>''.  It replaces
+external backup scripts like ''nogfsosdwbakd3''.
+
+A backup is a sequence of Git bundles ''<path>/bundles/<seq>-<ts>.bundle''.
+The first bundle contains the full history.  Later bundles contain only the
+objects that are new since the previous bundle.  Each bundle has a
+corresponding tar ''<seq>-<ts>.gitdir.tar'' with the refs and Git metadata,
+like the Git config and ''.git/fso/''.  The files are encrypted with ''gpg2''
+to the shadow backup recipients of the repo and have the suffix ''.gpg''.
+The GPG keys must be in the keyring of the daemon user.  Repos without
+recipients are reported as backup errors, unless ''--insecure-plaintext''
+enables plaintext backups.
+
+''nogfsobakd'' posts each completed backup or backup error to the registry as
+a repo event.  ''nogfsoctl get repo'' displays the latest bundle, its time, and
+the latest error.  ''nogfsoctl repo <repoid> restore-shadow'' rebuilds a lost
+shadow repo from the backup.
+
+''nogfsobakd'' must run on the file host as a user that can read the shadow
+repos and write the shadow backup directories.
+`)
+
+var (
+	clientAliveInterval      = 40 * time.Second
+	clientAliveWithoutStream = true
+)
+
+var healthCheckInterval = 10 * time.Second
+
+// `HealthBakd` is the service reported by the gRPC health service, in
+// addition to the overall status for the empty service name.
+const HealthBakd = "nogfso.Bakd"
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+	Fatalw(msg string, kv ...interface{})
+}
+
+var lg Logger = mulog.Logger{}
+
+func main() {
+	args := argparse()
+	initLogging(args["--log"].(string))
+
+	// The scanner uses toplevel rand function.  Init seed to avoid
+	// repeating the same scan order after restart.
+	rand.Seed(time.Now().UnixNano())
+
+	cert, err := x509io.LoadCombinedCert(args["--tls-cert"].(string))
+	if err != nil {
+		lg.Fatalw("Failed to load --tls-cert.", "err", err)
+	}
+	ca, err := x509io.LoadCABundle(args["--tls-ca"].(string))
+	if err != nil {
+		lg.Fatalw("Failed to load --tls-ca.", "err", err)
+	}
+
+	sysRPCCreds, err := grpcjwt.Load(args["--sys-jwt"].(string))
+	if err != nil {
+		lg.Fatalw("Failed to load --sys-jwt", "err", err)
+	}
+	if url, ok := args["--sys-jwt-refresh"].(string); ok {
+		sysRPCCreds.RefreshURL = url
+	}
+
+	tools, err := shadowbak.LookTools()
+	if err != nil {
+		lg.Fatalw("Failed to find tools.", "err", err)
+	}
+
+	lg.Infow("nogfsobakd started.")
+
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsobakd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      ca,
+		})),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                clientAliveInterval,
+			PermitWithoutStream: clientAliveWithoutStream,
+		}),
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw(
+				"Failed to close nogfsoregd conn.", "err", err,
+			)
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	signal.Notify(sigs, syscall.SIGINT)
+	var isShutdown int32
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxSlow, cancelSlow := context.WithCancel(context.Background())
+
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx, lg, &wg, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+
+	// The gRPC health service reports `HealthBakd` as serving if the
+	// connection to nogfsoregd is usable and the observer is alive.
+	healthd := grpchealth.New(lg)
+	healthd.AddCheck(HealthBakd, grpchealth.ConnCheck("nogfsoregd", conn))
+	if addr, ok := args["--bind-health"].(string); ok {
+		err := grpchealth.StartServer(
+			ctx, lg, &wg, addr, healthd,
+			grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    ca,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})),
+		)
+		if err != nil {
+			lg.Fatalw(
+				"Health listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = healthd.Run(ctx, healthCheckInterval)
+		}()
+	}
+
+	if d := args["--sys-jwt-reload"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sysRPCCreds.Maintain(ctx, lg, d)
+		}()
+	}
+
+	procCfg := &nogfsobakd.Config{
+		Conn:     conn,
+		RPCCreds: sysRPCCreds,
+		Tools:    tools,
+		Hosts:    args["--host"].([]string),
+	}
+	if a, ok := args["--shadow-backup-root"].(string); ok {
+		procCfg.ShadowBackupRoot = a
+	}
+	if args["--insecure-plaintext"].(bool) {
+		procCfg.InsecurePlaintext = true
+		lg.Warnw(
+			"Plaintext backups enabled for repos " +
+				"without shadow backup recipients.",
+		)
+	}
+	proc := nogfsobakd.NewProcessor(ctxSlow, lg, procCfg)
+
+	if args["--no-watch"].(bool) {
+		lg.Infow("Watch disabled.")
+	} else {
+		stateDir, ok := args["--state"].(string)
+		if !ok {
+			lg.Fatalw("--state required unless --no-watch.")
+		}
+		state := observe.NewFileStateStore(stateDir)
+		obs := observe.NewObserver(lg, &observe.Config{
+			Conn:       conn,
+			RPCCreds:   sysRPCCreds,
+			StateStore: state,
+			Processor:  proc,
+			Registries: args["--registry"].([]string),
+			Refs:       args["--ref"].([]string),
+			Prefixes:   args["--prefix"].([]string),
+			Hosts:      args["--host"].([]string),
+		})
+		lg.Infow("Enabled watch registry broadcast.")
+		obsLive := grpchealth.NewLiveness("observer")
+		healthd.AddCheck(HealthBakd, obsLive.Check)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := obsLive.Run(func() error {
+				return obs.Watch(ctx)
+			})
+			if err != context.Canceled {
+				lg.Fatalw("Observer failed.", "err", err)
+			}
+			if atomic.LoadInt32(&isShutdown) == 0 {
+				lg.Fatalw("Unexpected observer cancel.")
+			}
+		}()
+	}
+
+	scanner := scan.NewScanner(lg, &scan.Config{
+		Conn:       conn,
+		RPCCreds:   sysRPCCreds,
+		Processor:  proc,
+		Registries: args["--registry"].([]string),
+		Prefixes:   args["--prefix"].([]string),
+		Hosts:      args["--host"].([]string),
+	})
+	if scanEvery, ok := args["--scan-every"].(time.Duration); ok {
+		if args["--scan-start"].(bool) {
+			lg.Infow("Enabled initial scan and regular scans.")
+		} else {
+			lg.Infow("Enabled regular scans.")
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if args["--scan-start"].(bool) {
+				err := scanner.Scan(ctx)
+				if err != nil {
+					lg.Warnw(
+						"Initial scan failed.",
+						"err", err,
+					)
+				}
+			}
+			tick := time.NewTicker(scanEvery)
+			for {
+				select {
+				case <-ctx.Done():
+					tick.Stop()
+					return
+				case <-tick.C:
+					err := scanner.Scan(ctx)
+					if err != nil {
+						lg.Warnw(
+							"Regular scan failed.",
+							"err", err,
+						)
+					}
+				}
+			}
+		}()
+	} else if args["--scan-start"].(bool) {
+		lg.Infow("Enabled initial scan.")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := scanner.Scan(ctx)
+			if err != nil {
+				lg.Warnw("Initial scan failed.", "err", err)
+			}
+		}()
+	} else {
+		lg.Infow("Scans disabled.")
+	}
+
+	sig := <-sigs
+	atomic.StoreInt32(&isShutdown, 1)
+
+	done := make(chan struct{})
+	go func() {
+		cancel()
+		wg.Wait()
+		lg.Infow("Completed level 1 shutdown.")
+
+		close(done)
+	}()
+
+	d := args["--shutdown-timeout"].(time.Duration)
+	timeout := time.NewTimer(d)
+	lg.Infow("Started graceful shutdown.", "sig", sig, "timeout", d)
+
+	select {
+	case <-timeout.C:
+		cancelSlow()
+		lg.Warnw("Timeout; forced shutdown.")
+	case <-done:
+		cancelSlow()
+		lg.Infow("Completed graceful shutdown.")
+	}
+
+}
+
+func initLogging(arg string) {
+	var err error
+	switch arg {
+	case "prod":
+		lg, err = zap.NewProduction()
+	case "dev":
+		lg, err = zap.NewDevelopment()
+	case "mu":
+		lg = mulog.Logger{}
+	default:
+		err = fmt.Errorf("Invalid --log option.")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func argparse() map[string]interface{} {
+	const autoHelp = true
+	const noOptionFirst = false
+	args, err := docopt.Parse(
+		usage, nil, autoHelp, version, noOptionFirst,
+	)
+	if err != nil {
+		lg.Fatalw("docopt failed", "err", err)
+	}
+
+	for _, k := range []string{
+		"--shutdown-timeout",
+		"--sys-jwt-reload",
+		"--scan-every",
+	} {
+		if arg, ok := args[k].(string); ok {
+			d, err := time.ParseDuration(arg)
+			if err != nil {
+				lg.Fatalw(
+					fmt.Sprintf("Invalid %s", k),
+					"err", err,
+				)
+			}
+			args[k] = d
+		}
+	}
+
+	return args
+}
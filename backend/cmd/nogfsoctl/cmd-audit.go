@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/nogproject/nog/backend/internal/audit"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+)
+
+func cmdAuditExport(args map[string]interface{}) {
+	ctx := context.Background()
+
+	var from int64 = 1
+	if a, ok := args["--from"].(string); ok {
+		v, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || v < 1 {
+			lg.Fatalw("--from must be a positive integer.", "err", err)
+		}
+		from = v
+	}
+	verify := args["--verify"].(bool)
+
+	conn, err := dialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	c := pb.NewAuditClient(conn)
+	creds, err := getRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoReadAudit,
+		Name:   "main",
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	stream, err := c.ExportAudit(ctx, &pb.ExportAuditI{
+		FromSeq: from,
+	}, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	var verifier audit.Verifier
+	for {
+		rsp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			lg.Fatalw("Stream recv failed.", "err", err)
+		}
+		for _, j := range rsp.Records {
+			if verify {
+				var r audit.Record
+				if err := json.Unmarshal(j, &r); err != nil {
+					lg.Fatalw(
+						"Failed to parse audit record.",
+						"err", err,
+					)
+				}
+				if err := verifier.Verify(&r); err != nil {
+					lg.Fatalw(
+						"Audit chain verification failed.",
+						"err", err,
+					)
+				}
+			}
+			fmt.Printf("%s\n", j)
+		}
+	}
+}
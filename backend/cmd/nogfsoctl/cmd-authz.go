@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+)
+
+func cmdAuthzExplain(args map[string]interface{}) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	i := pb.ExplainAuthzI{
+		Action: args["<action>"].(string),
+	}
+	if path, ok := args["--path"].(string); ok {
+		i.Path = path
+	}
+	if name, ok := args["--name"].(string); ok {
+		i.Name = name
+	}
+
+	// Explaining for the caller uses a JWT for the explained action, so
+	// that the explanation includes the scopes of a real request.
+	scope := auth.SimpleScope{
+		Action: i.Action,
+		Path:   i.Path,
+		Name:   i.Name,
+	}
+	if as, ok := args["--as"].(string); ok {
+		parts := strings.SplitN(as, "@", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			lg.Fatalw("Invalid --as; expected <user>@<domain>.")
+		}
+		i.UnixUser = parts[0]
+		i.UnixDomain = parts[1]
+		scope = auth.SimpleScope{
+			Action: AAFsoReadMain,
+			Name:   "main",
+		}
+	}
+
+	conn, err := dialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	c := pb.NewAuthzClient(conn)
+	creds, err := getRPCCredsScope(ctx, args, scope)
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	o, err := c.ExplainAuthz(ctx, &i, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	decision := "deny"
+	if o.Allowed {
+		decision = "allow"
+	}
+	rev := o.PolicyRevision
+	if rev == "" {
+		rev = "none"
+	}
+	fmt.Printf("decision: %s\n", decision)
+	fmt.Printf("policy: %s\n", rev)
+	for _, r := range o.Reasons {
+		fmt.Printf("- %s\n", r)
+	}
+}
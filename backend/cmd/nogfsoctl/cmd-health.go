@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	slashpath "path"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/cmd/nogfsoctl/internal/connect"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// `healthServices` are the services that `nogfsoregd` reports in addition to
+// the overall status, which uses the empty service name.
+var healthServices = []string{
+	"",
+	"nogfso.Registry",
+	"nogfso.Repos",
+	"nogfso.Statds",
+	"nogfso.Broadcast",
+}
+
+func cmdHealth(args map[string]interface{}) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := connect.DialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	isHealthy := true
+	c := healthpb.NewHealthClient(conn)
+	for _, svc := range healthServices {
+		o, err := c.Check(ctx, &healthpb.HealthCheckRequest{
+			Service: svc,
+		})
+		st := "UNKNOWN"
+		if err != nil {
+			lg.Errorw("Health check failed.", "service", svc, "err", err)
+		} else {
+			st = o.Status.String()
+		}
+		if st != healthpb.HealthCheckResponse_SERVING.String() {
+			isHealthy = false
+		}
+		name := svc
+		if name == "" {
+			name = "nogfsoregd"
+		}
+		fmt.Printf("%s %s\n", st, name)
+	}
+
+	if globalPath, ok := args["--sessions"].(string); ok {
+		listStatdsSessions(ctx, conn, args, slashpath.Clean(globalPath))
+	}
+
+	if !isHealthy {
+		os.Exit(1)
+	}
+}
+
+func listStatdsSessions(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	args map[string]interface{},
+	globalPath string,
+) {
+	creds, err := getRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoReadRoot,
+		Path:   globalPath,
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+
+	c := pb.NewStatdsClient(conn)
+	o, err := c.ListSessions(
+		ctx, &pb.ListStatdsSessionsI{GlobalPath: globalPath}, creds,
+	)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	now := time.Now()
+	for _, se := range o.Sessions {
+		age := now.Sub(time.Unix(se.ActiveSince, 0))
+		fmt.Printf(
+			"session %d %s %s %s %s %s %s\n",
+			se.Slot,
+			se.Name,
+			fmtStatdsRole(se.Role),
+			fmtBool(se.Healthy, "healthy", "unhealthy"),
+			fmtBool(se.Selected, "selected", "unselected"),
+			age.Round(time.Second),
+			strings.Join(se.Prefixes, ","),
+		)
+	}
+}
+
+func fmtStatdsRole(r pb.StatdsRole) string {
+	switch r {
+	case pb.StatdsRole_SR_ACTIVE:
+		return "active"
+	case pb.StatdsRole_SR_STANDBY:
+		return "standby"
+	default:
+		return "unknown"
+	}
+}
+
+func fmtBool(b bool, t, f string) string {
+	if b {
+		return t
+	}
+	return f
+}
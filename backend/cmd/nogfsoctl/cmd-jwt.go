@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+)
+
+func cmdJWT(args map[string]interface{}) {
+	switch {
+	case args["revoke"].(bool):
+		cmdJWTRevoke(args)
+	case args["ls-revoked"].(bool):
+		cmdJWTLsRevoked(args)
+	default:
+		panic("invalid args")
+	}
+}
+
+func cmdJWTRevoke(args map[string]interface{}) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := dialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	c := pb.NewMainClient(conn)
+	i := pb.RevokeJWTI{}
+	if args["--no-vid"].(bool) {
+		i.MainVid = nil
+	} else {
+		vid := args["--vid"].(ulid.I)
+		i.MainVid = vid[:]
+	}
+	if jti, ok := args["--jti"].(string); ok {
+		i.Jti = jti
+	}
+	if sub, ok := args["--subject"].(string); ok {
+		i.Subject = sub
+	}
+	creds, err := getRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoRevokeToken,
+		Name:   "main",
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	o, err := c.RevokeJWT(ctx, &i, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	mustPrintlnVidBytes("mainVid", o.MainVid)
+}
+
+func cmdJWTLsRevoked(args map[string]interface{}) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := dialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	c := pb.NewMainClient(conn)
+	creds, err := getRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoReadMain,
+		Name:   "main",
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	o, err := c.GetJWTRevocations(ctx, &pb.GetJWTRevocationsI{}, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	mustPrintlnVidBytes("mainVid", o.Vid)
+	for _, r := range o.Revocations {
+		t := time.Unix(r.Revoked, 0).UTC().Format(time.RFC3339)
+		if r.Jti != "" {
+			fmt.Printf("%s jti %s\n", t, r.Jti)
+		} else {
+			fmt.Printf("%s subject %s\n", t, r.Subject)
+		}
+	}
+}
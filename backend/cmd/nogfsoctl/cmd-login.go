@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/oidc"
+)
+
+func cmdLogin(args map[string]interface{}) {
+	ctx := context.Background()
+	client := &http.Client{Timeout: 20 * time.Second}
+
+	p, err := oidc.Discover(ctx, client, args["--oidc-issuer"].(string))
+	if err != nil {
+		lg.Fatalw("OIDC discovery failed.", "err", err)
+	}
+
+	clientId := args["--oidc-client-id"].(string)
+	scopes := []string{"openid"}
+	for _, s := range args["--oidc-scope"].([]string) {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	da, err := oidc.StartDeviceAuthorization(ctx, client, p, clientId, scopes)
+	if err != nil {
+		lg.Fatalw("Failed to start device authorization.", "err", err)
+	}
+
+	if da.VerificationURIComplete != "" {
+		fmt.Fprintf(
+			os.Stderr, "To log in, visit %s\n",
+			da.VerificationURIComplete,
+		)
+	} else {
+		fmt.Fprintf(
+			os.Stderr, "To log in, visit %s and enter code %s\n",
+			da.VerificationURI, da.UserCode,
+		)
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for authorization...\n")
+
+	if da.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(
+			ctx, time.Duration(da.ExpiresIn)*time.Second,
+		)
+		defer cancel()
+	}
+	tok, err := oidc.PollDeviceToken(ctx, client, p, clientId, da)
+	if err != nil {
+		lg.Fatalw("Device authorization failed.", "err", err)
+	}
+
+	// Prefer the access token.  Some issuers return an opaque access
+	// token, which nogfso cannot verify.  Use the ID token instead.
+	jwt := tok.AccessToken
+	if !isJWT(jwt) {
+		jwt = tok.IDToken
+	}
+	if !isJWT(jwt) {
+		lg.Fatalw("The OIDC issuer did not return a JWT.")
+	}
+
+	path := args["<jwt-file>"].(string)
+	if err := writeFileAtomic(path, []byte(jwt+"\n"), 0600); err != nil {
+		lg.Fatalw("Failed to write JWT.", "err", err)
+	}
+	fmt.Fprintf(os.Stderr, "Saved JWT to %s\n", path)
+}
+
+func isJWT(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".jwt-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -60,8 +60,12 @@ func cmdRefreshContent(args map[string]interface{}) {
 	if err != nil {
 		lg.Fatalw("Failed to get auth token.", "err", err)
 	}
-	_, err = c.RefreshContent(ctx, &req, creds)
+	o, err := c.RefreshContent(ctx, &req, creds)
 	if err != nil {
 		lg.Fatalw("RPC failed.", "err", err)
 	}
+
+	if args["--follow"].(bool) {
+		followProgress(context.Background(), c, uuI, o.Job, creds)
+	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/nogfsobakd"
+	"github.com/nogproject/nog/backend/internal/nogfsobakd/shadowbak"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc"
+)
+
+// `cmdRepoRestoreShadow()` rebuilds a shadow repo from the `nogfsobakd`
+// bundles.  It runs locally on the file host and accesses the shadow and
+// the backup directory directly.
+func cmdRepoRestoreShadow(
+	args map[string]interface{}, conn *grpc.ClientConn,
+) {
+	ctx := context.Background()
+	ctxRPC, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	c := pb.NewReposClient(conn)
+	repoId := args["<repoid>"].(uuid.I)
+	creds, err := getRPCCredsRepoId(ctxRPC, args, AAFsoReadRepo, repoId)
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	repo, err := c.GetRepo(ctxRPC, &pb.GetRepoI{Repo: repoId[:]}, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	if repo.ShadowBackup == "" {
+		lg.Fatalw("Repo has no shadow backup.")
+	}
+	bak, err := nogfsobakd.ParseShadowBackupURL(repo.ShadowBackup)
+	if err != nil {
+		lg.Fatalw("Invalid shadow backup.", "err", err)
+	}
+	bakDir := strings.SplitN(bak, ":", 2)[1]
+
+	dest, ok := args["--dest"].(string)
+	if !ok {
+		parts := strings.SplitN(repo.Shadow, ":", 2)
+		if len(parts) != 2 {
+			lg.Fatalw(
+				"Repo has no shadow; use --dest.",
+				"shadow", repo.Shadow,
+			)
+		}
+		dest = parts[1]
+	}
+
+	tools, err := shadowbak.LookTools()
+	if err != nil {
+		lg.Fatalw("Failed to find tools.", "err", err)
+	}
+	res, err := tools.Restore(ctx, bakDir, dest)
+	if err != nil {
+		lg.Fatalw("Failed to restore shadow.", "err", err)
+	}
+
+	fmt.Printf("shadow: %s\n", dest)
+	fmt.Printf("bundles: %d\n", res.NumBundles)
+	fmt.Printf("latestBundle: %s\n", res.Latest)
+}
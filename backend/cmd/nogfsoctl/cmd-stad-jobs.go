@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	slashpath "path"
+	"time"
+
+	"github.com/nogproject/nog/backend/cmd/nogfsoctl/internal/connect"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+func cmdStadJobs(args map[string]interface{}) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := connect.DialX509(
+		args["--nogfsoregd"].(string),
+		args["--tls-cert"].(string),
+		args["--tls-ca"].(string),
+	)
+	if err != nil {
+		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			lg.Errorw("Failed to close conn.", "err", err)
+		}
+	}()
+
+	globalPath := slashpath.Clean(args["<global-path>"].(string))
+	creds, err := getRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoReadRoot,
+		Path:   globalPath,
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+
+	c := pb.NewStadJobsClient(conn)
+	o, err := c.ListJobs(ctx, &pb.ListJobsI{GlobalPath: globalPath}, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	now := time.Now()
+	for _, j := range o.Jobs {
+		repoId, err := uuid.FromBytes(j.Repo)
+		if err != nil {
+			lg.Fatalw("Invalid repo id.", "err", err)
+		}
+		var age time.Duration
+		if j.Started != 0 {
+			age = now.Sub(time.Unix(j.Started, 0))
+		} else {
+			age = now.Sub(time.Unix(j.Queued, 0))
+		}
+		fmt.Printf(
+			"%d %s %s %s %s %s %s %s\n",
+			j.Id,
+			fmtStadJobState(j.State),
+			fmtStadJobClass(j.Class),
+			age.Round(time.Second),
+			j.Operation,
+			j.Filesystem,
+			repoId,
+			j.GlobalPath,
+		)
+	}
+}
+
+func fmtStadJobState(s pb.StadJob_State) string {
+	switch s {
+	case pb.StadJob_S_WAITING:
+		return "waiting"
+	case pb.StadJob_S_RUNNING:
+		return "running"
+	default:
+		return "unknown"
+	}
+}
+
+func fmtStadJobClass(c pb.StadJob_Class) string {
+	switch c {
+	case pb.StadJob_C_INTERACTIVE:
+		return "interactive"
+	case pb.StadJob_C_WORKFLOW:
+		return "workflow"
+	case pb.StadJob_C_BACKGROUND:
+		return "background"
+	default:
+		return "unknown"
+	}
+}
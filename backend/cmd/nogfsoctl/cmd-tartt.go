@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	slashpath "path"
 	"sort"
@@ -39,6 +40,8 @@ func cmdTartt(args map[string]interface{}) {
 		cmdTarttLs(args, conn)
 	case args["config"].(bool):
 		cmdTarttConfig(args, conn)
+	case args["get"].(bool):
+		cmdTarttGet(args, conn)
 	}
 }
 
@@ -225,3 +228,56 @@ func cmdTarttConfig(args map[string]interface{}, conn *grpc.ClientConn) {
 	}
 	fmt.Printf("%s", o.ConfigYaml)
 }
+
+func cmdTarttGet(args map[string]interface{}, conn *grpc.ClientConn) {
+	repoId := args["<repoid>"].(uuid.I)
+	i := &pb.RestoreStreamI{
+		Repo:    repoId[:],
+		Tspath:  args["<tspath>"].(string),
+		Members: args["<members>"].([]string),
+	}
+
+	// Restores may take a long time.  Use a timeout only for the creds.
+	ctx := context.Background()
+	credsCtx, credsCancel := context.WithTimeout(ctx, 10*time.Second)
+	creds, err := getRPCCredsRepoId(credsCtx, args, AAFsoReadRepo, repoId)
+	credsCancel()
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+
+	var out io.Writer = os.Stdout
+	var outFp *os.File
+	if path, ok := args["--output"].(string); ok {
+		fp, err := os.Create(path)
+		if err != nil {
+			lg.Fatalw("Failed to create output file.", "err", err)
+		}
+		out = fp
+		outFp = fp
+	}
+
+	c := pb.NewTarttClient(conn)
+	stream, err := c.RestoreStream(ctx, i, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+	for {
+		o, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			lg.Fatalw("RPC failed.", "err", err)
+		}
+		if _, err := out.Write(o.Data); err != nil {
+			lg.Fatalw("Failed to write output.", "err", err)
+		}
+	}
+
+	if outFp != nil {
+		if err := outFp.Close(); err != nil {
+			lg.Fatalw("Failed to close output file.", "err", err)
+		}
+	}
+}
@@ -31,6 +31,7 @@ type Event struct {
 	GitlabNamespace      string `json:"gitlabNamespace,omitempty"`
 	*pb.FsoRepoNaming    `json:"repoNaming,omitempty"`
 	*RepoInitPolicy      `json:"repoInitPolicy,omitempty"`
+	*RepoAutoInitPolicy  `json:"repoAutoInitPolicy,omitempty"`
 	*SplitRootParams     `json:"splitRootParams,omitempty"`
 	WorkflowId           string `json:"workflowId,omitempty"`
 	EphemeralWorkflowsId string `json:"ephemeralWorkflowsId,omitempty"`
@@ -62,6 +63,14 @@ type RepoInitPolicy struct {
 	SubdirTrackingGloblist []SubdirTrackingGlob `json:"subdirTrackingGloblist,omitempty"`
 }
 
+type RepoAutoInitPolicy struct {
+	GlobalRoot        string `json:"globalRoot"`
+	Enabled           bool   `json:"enabled"`
+	AuthorName        string `json:"authorName,omitempty"`
+	AuthorEmail       string `json:"authorEmail,omitempty"`
+	QuarantineSeconds int64  `json:"quarantineSeconds,omitempty"`
+}
+
 type SplitRootParams struct {
 	GlobalRoot   string `json:"globalRoot"`
 	MaxDepth     int32  `json:"maxDepth,omitempty"`
@@ -214,6 +223,16 @@ func cmdEventsRegistry(args map[string]interface{}) {
 				)
 				outev.RepoInitPolicy = &policy
 
+			case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+				p := ev.FsoRepoAutoInitPolicy
+				outev.RepoAutoInitPolicy = &RepoAutoInitPolicy{
+					GlobalRoot:        p.GlobalRoot,
+					Enabled:           p.Enabled,
+					AuthorName:        p.AuthorName,
+					AuthorEmail:       p.AuthorEmail,
+					QuarantineSeconds: p.QuarantineSeconds,
+				}
+
 			case pb.RegistryEvent_EV_FSO_ROOT_ARCHIVE_RECIPIENTS_UPDATED:
 				outev.RootInfo = &RootInfo{
 					GlobalRoot: ev.FsoRootInfo.GlobalRoot,
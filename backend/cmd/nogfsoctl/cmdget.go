@@ -325,6 +325,9 @@ type Repo struct {
 	ArchiveRecipients      []string `json:"archiveRecipients,omitempty"`
 	ShadowBackup           string   `json:"shadowBackup,omitempty"`
 	ShadowBackupRecipients []string `json:"shadowBackupRecipients,omitempty"`
+	ShadowBackupBundle     string   `json:"shadowBackupBundle,omitempty"`
+	ShadowBackupTime       string   `json:"shadowBackupTime,omitempty"`
+	ShadowBackupError      string   `json:"shadowBackupError,omitempty"`
 	StorageTier            string   `json:"storageTier"`
 	Gitlab                 string   `json:"gitlab,omitempty"`
 	GitlabProjectId        int64    `json:"gitlabProjectId,omitempty"`
@@ -376,6 +379,13 @@ func cmdGetRepo(args map[string]interface{}, conn *grpc.ClientConn) {
 		Gitlab:                 rsp.Gitlab,
 		GitlabProjectId:        rsp.GitlabProjectId,
 		ErrorMessage:           rsp.ErrorMessage,
+		ShadowBackupBundle:     rsp.ShadowBackupBundle,
+		ShadowBackupError:      rsp.ShadowBackupError,
+	}
+	if rsp.ShadowBackupTime != 0 {
+		r.ShadowBackupTime = time.Unix(
+			rsp.ShadowBackupTime, 0,
+		).UTC().Format(time.RFC3339)
 	}
 	if err := jout.Encode(&r); err != nil {
 		lg.Fatalw("JSON marshal failed.", "err", err)
@@ -42,6 +42,8 @@ func cmdRepo(args map[string]interface{}) {
 		cmdRepoInitShadowBackup(args, conn)
 	case args["move-shadow-backup"].(bool):
 		cmdRepoMoveShadowBackup(args, conn)
+	case args["restore-shadow"].(bool):
+		cmdRepoRestoreShadow(args, conn)
 	case args["enable-archive-encryption"].(bool):
 		cmdRepoEnableArchiveEncryption(args, conn)
 	case args["disable-archive-encryption"].(bool):
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/nogproject/nog/backend/cmd/nogfsoctl/internal/connect"
+	"github.com/nogproject/nog/backend/cmd/nogfsoctl/internal/parse"
 	"github.com/nogproject/nog/backend/internal/configmap"
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
 	"github.com/nogproject/nog/backend/pkg/auth"
@@ -49,6 +50,8 @@ func cmdRoot(args map[string]interface{}) {
 		cmdEnableDiscoveryPaths(args, conn)
 	case args["set-init-policy"].(bool):
 		cmdRootSetInitPolicy(args, conn)
+	case args["set-auto-init"].(bool):
+		cmdRootSetAutoInit(args, conn)
 	case args["enable-archive-encryption"].(bool):
 		cmdRootEnableArchiveEncryption(args, conn)
 	case args["disable-archive-encryption"].(bool):
@@ -364,6 +367,56 @@ func cmdRootSetInitPolicy(
 	mustPrintlnVidBytes("registryVid", o.Vid)
 }
 
+func cmdRootSetAutoInit(
+	args map[string]interface{}, conn *grpc.ClientConn,
+) {
+	globalRoot := slashpath.Clean(args["<root>"].(string))
+
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	i := &pb.UpdateRepoAutoInitPolicyI{
+		Registry: args["<registry>"].(string),
+	}
+	if args["--no-vid"].(bool) {
+		i.Vid = nil
+	} else {
+		vid := args["--vid"].(ulid.I)
+		i.Vid = vid[:]
+	}
+	policy := &pb.FsoRepoAutoInitPolicy{
+		GlobalRoot: globalRoot,
+	}
+	if !args["--disable"].(bool) {
+		name, email, err := parse.User(args["--author"].(string))
+		if err != nil {
+			lg.Fatalw("Invalid author.", "err", err)
+		}
+		quarantine := args["--quarantine"].(time.Duration)
+		policy.Enabled = true
+		policy.AuthorName = name
+		policy.AuthorEmail = email
+		policy.QuarantineSeconds = int64(quarantine / time.Second)
+	}
+	i.Policy = policy
+
+	creds, err := connect.GetRPCCredsScope(ctx, args, auth.SimpleScope{
+		Action: AAFsoInitRoot,
+		Path:   globalRoot,
+	})
+	if err != nil {
+		lg.Fatalw("Failed to get auth token.", "err", err)
+	}
+	c := pb.NewRegistryClient(conn)
+	o, err := c.UpdateRepoAutoInitPolicy(ctx, i, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	mustPrintlnVidBytes("registryVid", o.Vid)
+}
+
 func cmdRootEnableArchiveEncryption(
 	args map[string]interface{}, conn *grpc.ClientConn,
 ) {
@@ -63,8 +63,12 @@ func cmdSha(args map[string]interface{}) {
 	if err != nil {
 		lg.Fatalw("Failed to get auth token.", "err", err)
 	}
-	_, err = c.Sha(ctx, &req, creds)
+	o, err := c.Sha(ctx, &req, creds)
 	if err != nil {
 		lg.Fatalw("RPC failed.", "err", err)
 	}
+
+	if args["--follow"].(bool) {
+		followProgress(context.Background(), c, uuI, o.Job, creds)
+	}
 }
@@ -66,8 +66,12 @@ func cmdStat(args map[string]interface{}) {
 	if err != nil {
 		lg.Fatalw("Failed to get auth token.", "err", err)
 	}
-	_, err = c.Stat(ctx, &req, creds)
+	o, err := c.Stat(ctx, &req, creds)
 	if err != nil {
 		lg.Fatalw("RPC failed.", "err", err)
 	}
+
+	if args["--follow"].(bool) {
+		followProgress(context.Background(), c, uuI, o.Job, creds)
+	}
 }
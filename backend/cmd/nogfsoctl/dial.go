@@ -17,7 +17,10 @@ const AAFsoFind = fsoauthz.AAFsoFind
 const AAFsoInitRegistry = fsoauthz.AAFsoInitRegistry
 const AAFsoInitRepo = fsoauthz.AAFsoInitRepo
 const AAFsoInitRoot = fsoauthz.AAFsoInitRoot
+const AAFsoReadAudit = fsoauthz.AAFsoReadAudit
+const AAFsoReadMain = fsoauthz.AAFsoReadMain
 const AAFsoReadRegistry = fsoauthz.AAFsoReadRegistry
+const AAFsoRevokeToken = fsoauthz.AAFsoRevokeToken
 const AAFsoReadRoot = fsoauthz.AAFsoReadRoot
 const AAFsoReadRepo = fsoauthz.AAFsoReadRepo
 const AAFsoRefreshRepo = fsoauthz.AAFsoRefreshRepo
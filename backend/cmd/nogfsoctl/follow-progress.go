@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc"
+)
+
+// `followProgress()` prints progress updates of a background `job` until it
+// completes.  It exits with a fatal error if the job fails.
+func followProgress(
+	ctx context.Context,
+	c pb.StatClient,
+	repoId uuid.I,
+	job []byte,
+	creds grpc.CallOption,
+) {
+	i := &pb.WatchProgressI{
+		Repo: repoId[:],
+		Job:  job,
+	}
+	stream, err := c.WatchProgress(ctx, i, creds)
+	if err != nil {
+		lg.Fatalw("RPC failed.", "err", err)
+	}
+
+	var last *pb.WatchProgressO
+	for {
+		o, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			lg.Fatalw("Failed to read RPC stream.", "err", err)
+		}
+		fmt.Printf(
+			"%s %s files=%d bytes=%d %s\n",
+			fmtProgressOperation(o.Operation),
+			fmtProgressState(o.State),
+			o.Files, o.Bytes, o.Path,
+		)
+		last = o
+	}
+
+	if last == nil {
+		lg.Fatalw("Missing progress.")
+	}
+	if last.State == pb.WatchProgressO_S_FAILED {
+		lg.Fatalw("Job failed.", "err", last.ErrorMessage)
+	}
+}
+
+func fmtProgressOperation(op pb.WatchProgressO_Operation) string {
+	str, ok := map[pb.WatchProgressO_Operation]string{
+		pb.WatchProgressO_OP_STAT:            "stat",
+		pb.WatchProgressO_OP_SHA:             "sha",
+		pb.WatchProgressO_OP_REFRESH_CONTENT: "refresh-content",
+	}[op]
+	if !ok {
+		return "unknown"
+	}
+	return str
+}
+
+func fmtProgressState(st pb.WatchProgressO_State) string {
+	str, ok := map[pb.WatchProgressO_State]string{
+		pb.WatchProgressO_S_QUEUED:    "queued",
+		pb.WatchProgressO_S_RUNNING:   "running",
+		pb.WatchProgressO_S_SUCCEEDED: "succeeded",
+		pb.WatchProgressO_S_FAILED:    "failed",
+	}[st]
+	if !ok {
+		return "unknown"
+	}
+	return str
+}
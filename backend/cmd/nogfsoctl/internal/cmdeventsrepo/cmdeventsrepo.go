@@ -29,6 +29,7 @@ type Event struct {
 	*ShadowRepoInfo       `json:"shadowRepoInfo,omitempty"`
 	*ArchiveRepoInfo      `json:"archiveRepoInfo,omitempty"`
 	*ShadowBackupRepoInfo `json:"shadowBackupRepoInfo,omitempty"`
+	*ShadowBackupBundle   `json:"shadowBackupBundle,omitempty"`
 	*GitRepoInfo          `json:"gitRepoInfo,omitempty"`
 	GitAuthor             *GitUser `json:"gitAuthor,omitempty"`
 	RegistryEventId       string   `json:"registryEventId,omitempty"`
@@ -92,6 +93,12 @@ type ShadowBackupRepoInfo struct {
 	ShadowBackupURL string `json:"shadowBackupUrl"`
 }
 
+type ShadowBackupBundle struct {
+	Name     string `json:"name"`
+	RefsHash string `json:"refsHash"`
+	Time     string `json:"time"`
+}
+
 type GitRepoInfo struct {
 	GitlabProjectId int64 `json:"gitlabProjectId"`
 }
@@ -259,6 +266,19 @@ func Cmd(lg Logger, args map[string]interface{}) {
 					ev.FsoGpgKeyFingerprints,
 				)
 
+			case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
+				outev.StatusCode = ev.StatusCode
+				outev.StatusMessage = ev.StatusMessage
+				if evi := ev.FsoShadowBackupBundle; evi != nil {
+					outev.ShadowBackupBundle = &ShadowBackupBundle{
+						Name:     evi.Name,
+						RefsHash: evi.RefsHash,
+						Time: time.Unix(evi.Time, 0).UTC().Format(
+							time.RFC3339,
+						),
+					}
+				}
+
 			case pb.RepoEvent_EV_FSO_GIT_REPO_CREATED:
 				evi := ev.FsoGitRepoInfo
 				outev.GitRepoInfo = &GitRepoInfo{
@@ -9,6 +9,7 @@ import (
 	"github.com/nogproject/nog/backend/cmd/nogfsoctl/internal/jwtauth"
 	"github.com/nogproject/nog/backend/internal/grpcjwt"
 	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcratelimit"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"google.golang.org/grpc"
@@ -43,6 +44,9 @@ func DialX509(addr, certFile, caFile string) (*grpc.ClientConn, error) {
 			Time:                clientAliveInterval,
 			PermitWithoutStream: clientAliveWithoutStream,
 		}),
+		// Back off if nogfsoregd rejects calls due to rate limits.
+		grpc.WithUnaryInterceptor(grpcratelimit.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(grpcratelimit.StreamClientInterceptor),
 	)
 }
 
@@ -57,6 +57,7 @@ var usage = qqBackticks(`Usage:
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> add-repo-naming-ignore <rule> <patterns>...
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> enable-discovery-paths <depth-paths>...
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> set-init-policy subdir-tracking-globlist <subdir-tracking-globs>...
+  nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> set-auto-init (--disable|--author=<user> [--quarantine=<duration>])
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> enable-archive-encryption <gpg-keys>...
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> disable-archive-encryption
   nogfsoctl [options] root <registry> (--vid=<vid>|--no-vid) <root> enable-shadow-backup-encryption <gpg-keys>...
@@ -73,6 +74,7 @@ var usage = qqBackticks(`Usage:
   nogfsoctl [options] repo <repoid> (--vid=<vid>|--no-vid) init-tartt <tartt-url>
   nogfsoctl [options] repo <repoid> (--vid=<vid>|--no-vid) init-shadow-backup <shadow-backup-url>
   nogfsoctl [options] repo <repoid> (--vid=<vid>|--no-vid) move-shadow-backup <shadow-backup-url>
+  nogfsoctl [options] repo <repoid> restore-shadow [--dest=<dir>]
   nogfsoctl [options] repo <registry> (--vid=<vid>|--no-vid) <repoid> [--repo-vid=<vid>] freeze [--wait=<duration>] --workflow=<uuid> --author=<user>
   nogfsoctl [options] repo <registry> (--vid=<vid>|--no-vid) <repoid> [--repo-vid=<vid>] begin-freeze --workflow=<uuid> --author=<user>
   nogfsoctl [options] repo <registry> <repoid> get-freeze [--wait=<duration>] <workflowid>
@@ -106,9 +108,9 @@ var usage = qqBackticks(`Usage:
   nogfsoctl [options] events unarchive-repo [--watch] [--after=<vid>] <registry> <repoid> <workflowid>
   nogfsoctl [options] events unix-domain [--watch] [--after=<vid>] <domain>
   nogfsoctl [options] stat-status [--stad] <repoid>
-  nogfsoctl [options] stat [--stad] [--wait=<duration>] [--mtime-range-only] --author=<user> <repoid>
-  nogfsoctl [options] sha [--stad] [--wait=<duration>] --author=<user> <repoid>
-  nogfsoctl [options] refresh content [--wait=<duration>] --author=<user> <repoid>
+  nogfsoctl [options] stat [--stad] [--wait=<duration>|--follow] [--mtime-range-only] --author=<user> <repoid>
+  nogfsoctl [options] sha [--stad] [--wait=<duration>|--follow] --author=<user> <repoid>
+  nogfsoctl [options] refresh content [--wait=<duration>|--follow] --author=<user> <repoid>
   nogfsoctl [options] reinit-subdir-tracking [--stad] [--wait=<duration>] --author=<user> <repoid> (enter-subdirs|bundle-subdirs|ignore-subdirs|ignore-most)
   nogfsoctl [options] gitnog [--regd|--g2nd] head <repoid>
   nogfsoctl [options] gitnog [--regd|--g2nd] summary <repoid>
@@ -121,6 +123,7 @@ var usage = qqBackticks(`Usage:
   nogfsoctl [options] tartt head <repoid>
   nogfsoctl [options] tartt config [--verbose] <repoid> [<git-commit>]
   nogfsoctl [options] tartt ls [--verbose] [--sha] <repoid> [<git-commit>]
+  nogfsoctl [options] tartt get [--output=<path>] <repoid> <tspath> [--] [<members>...]
   nogfsoctl [options] du begin --workflow=<uuid> root <registry> (--vid=<vid>|--no-vid) <root>
   nogfsoctl [options] du get [--verbose] [--wait=<duration>] --workflow=<uuid> root <registry> <root>
   nogfsoctl [options] ping-registry begin <registry> (--vid=<vid>|--no-vid) --workflow=<uuid>
@@ -137,6 +140,13 @@ var usage = qqBackticks(`Usage:
   nogfsoctl [options] split-root commit <registry> <root> <workflowid> (--vid=<vid>|--no-vid)
   nogfsoctl [options] split-root abort <registry> <root> <workflowid> (--vid=<vid>|--no-vid)
   nogfsoctl [options] test-udo [--as-user=<user>] <global-path>
+  nogfsoctl [options] stad jobs <global-path>
+  nogfsoctl [options] health [--sessions=<global-path>]
+  nogfsoctl [options] audit export [--from=<seq>] [--verify]
+  nogfsoctl [options] jwt revoke (--vid=<vid>|--no-vid) (--jti=<jti>|--subject=<subject>)
+  nogfsoctl [options] jwt ls-revoked
+  nogfsoctl [options] authz explain [--as=<user>@<domain>] <action> (--path=<path>|--name=<name>)
+  nogfsoctl [options] login --oidc-issuer=<url> --oidc-client-id=<id> [--oidc-scope=<scope>...] <jwt-file>
   nogfsoctl [options] init unix-domain (--vid=<vid>|--no-vid) <domain>
   nogfsoctl [options] get unix-domain <domain>
   nogfsoctl [options] unix-domain <domain> (--vid=<vid>|--no-vid) create-group <group> <gid>
@@ -171,6 +181,11 @@ Options:
   --author=<user>  Git author for commits.
         Example: ''A U Thor <author@example.org>''.
   --mtime-range-only  Run ''git-fso stat --mtime-range-only''.
+  --follow  Run in the background and print progress until completion.
+  --disable  Disable automatic repo init.
+  --quarantine=<duration>  [default: 24h]
+        Auto-init only directories that have not been modified for the
+        duration.
   --watch  Wait for more events and print them as they arrive.
   --after=<vid>  List events after event version ''<vid>''.
   --after-now  Return only events that arrive after now.  Implies --watch.
@@ -186,6 +201,11 @@ Options:
   --workflow=<uuid>  Workflow ID, used to group related events.
   --unchanged-global-path  Move to unchanged global path, which can be used to
         move the repo to a new host path if the root config has changed.
+  --dest=<dir>  Directory for ''restore-shadow''.  Default: the shadow path.
+  --output=<path>  File for ''tartt get''.  Default: stdout.
+  --oidc-issuer=<url>  OpenID Connect issuer for ''login''.
+  --oidc-client-id=<id>  OIDC client id for ''login''.
+  --oidc-scope=<scope>  Additional OIDC scopes to request.
   -v, --verbose  Print more details.
   --sha          Print file SHAs.
 
@@ -203,6 +223,11 @@ or slash.
 
 ''<configmap>'' is a JSON object that controls details of the repo naming rule.
 Its structure depends on the naming rule.
+Rule ''MarkerFiles'' expects ''{"markers": [<filename>...]}'' and reports
+directories that contain one of the marker files as repo candidates.  Rule
+''OwnerBoundary'' expects ''{"owner": "user"}'' or ''{"owner": "group"}'' and
+reports directories whose owner differs from the parent owner.  Both rules
+accept optional ''"maxDepth": <1..8>'' and ''"ignore": [<glob>...]''.
 
 ''<subdir-tracking-globs>'' is a list of ''<subdir-tracking>:<glob>'' that
 specifies how subdir tracking is configured during repo initialization.
@@ -216,6 +241,76 @@ the path, depth 1 enables the path and direct sub-directories, and so on.
 
 ''<gpg-keys>'' is a list of GPG key fingerprints, formatted as 40-digit hex
 numbers.
+
+''set-auto-init'' enables or disables automatic repo init for a root.  When
+enabled, ''nogfsostad'' regularly runs repo discovery on the root and
+initializes repos for the candidates, as if ''init repo --author=<user>'' had
+been used.  The usual init limits apply.
+
+''restore-shadow'' rebuilds a lost shadow repo from the Git bundles that
+''nogfsobakd'' has written to the shadow backup location.  It must run on the
+file host as a user that can read the backup and write the destination, which
+must not exist.  If the backup is encrypted, the GPG secret key must be
+available to ''gpg2''.  The restored files are owned by the current user; fix
+ownership as needed before restarting ''nogfsostad''.
+
+''tartt get'' retrieves the tartt archive ''<tspath>'' as a tar stream from the
+''nogfsostad'' that manages the repo, see ''nogfsostad --tartt-restore-spool''.
+''<tspath>'' is a path as listed by ''tartt ls'', starting with the store
+name, for example ''vm/20261019T094322Z/s0/20261019T094327Z''.  The
+restore uses the full and incremental archives that lead to ''<tspath>''.
+''<members>'' restricts the restore to tar members in GNU tar quoting style
+''escape'', with leading ''./'', as listed by ''tartt ls-tar''.  Use
+''nogfsoctl tartt get ... | tar -x'' to extract the files.
+
+''stad jobs'' lists the jobs that the ''nogfsostad'' that is responsible for
+''<global-path>'' is running or has queued, restricted to repos below
+''<global-path>''.  The columns are: job id, state, class, time since start or
+since queued, operation, filesystem, repo id, and repo global path.
+
+''health'' queries the gRPC health service of ''nogfsoregd'' and prints the
+status of each service.  ''--sessions'' additionally lists the active
+''nogfsostad'' sessions whose prefixes overlap with ''<global-path>''.  The
+session columns are: slot, session name, role, health, whether ''nogfsoregd''
+currently selects the session for at least one prefix, time since the session
+became active, and prefixes.  ''health'' exits with a non-zero status if any service is not
+serving.
+
+''audit export'' prints the records of the ''nogfsoregd'' audit log as JSON
+lines, starting at sequence number ''--from'', which defaults to 1.  Each
+record lists the caller, the authorization checks, the gRPC status, and the
+resulting event vids, either ''vid'' or per entity, like ''registryVid'',
+''repoVid'', and ''workflowVid'', and it is chained to the previous record by
+its SHA-256 hash ''prev''.  ''--verify'' checks the hashes and the chain and
+exits with a non-zero status if the log has been modified.  When starting at
+''--from'', the first record is trusted.
+
+''jwt revoke'' revokes a JWT by its id ''jti'' or all JWTs of a ''subject''
+that have been issued before the revocation.  Nogfsoregd rejects revoked JWTs
+immediately; nogfsostad rejects them after it fetched the revocations, see
+''nogfsostad --jwt-revocations-poll''.  JWTs that are issued for the subject
+within a few seconds after the revocation may be rejected, too, because nogapp
+backdates their ''iat''.  ''jwt ls-revoked'' lists the revocations with their
+time.
+
+''authz explain'' asks nogfsoregd whether ''<action>'' on ''--path'' or
+''--name'' is permitted and prints the decision, the revision of the
+authorization policy, and the rules that have been evaluated; see
+''nogfsoregd --authz-policy''.  By default, the decision is explained for the
+caller with a JWT for the action.  ''--as'' explains it for a Unix user of a
+Unix domain instead, without JWT scopes and subject bindings, which requires
+permission to read the registry main.
+
+''login'' obtains a JWT from an OpenID Connect issuer with the OAuth device
+authorization grant: it prints a URL and a code, waits until the user has
+authorized the login in a browser, and writes the JWT to ''<jwt-file>'' with
+mode 0600.  Use it with ''--jwt=<jwt-file> --jwt-auth=no''.  Nogfsoregd and
+nogfsostad accept the JWT if they are configured with the same issuer, see
+''nogfsoregd --oidc-issuer''.
+
+If nogfsoregd rejects a call because of its rate limits, see ''nogfsoregd
+--rate-limits'', nogfsoctl waits for the retry hint and retries up to five
+times.
 `)
 
 type Logger interface {
@@ -252,6 +347,8 @@ func main() {
 		cmdRemoveRoot(args)
 	case args["info"].(bool):
 		cmdInfo(args)
+	case args["tartt"].(bool) && args["get"].(bool):
+		cmdTartt(args)
 	case args["get"].(bool):
 		cmdGet(args)
 	case args["events"].(bool) && args["broadcast"].(bool):
@@ -302,6 +399,18 @@ func main() {
 		cmdTartt(args)
 	case args["test-udo"].(bool):
 		cmdTestUdo(args)
+	case args["stad"].(bool) && args["jobs"].(bool):
+		cmdStadJobs(args)
+	case args["health"].(bool):
+		cmdHealth(args)
+	case args["audit"].(bool) && args["export"].(bool):
+		cmdAuditExport(args)
+	case args["jwt"].(bool):
+		cmdJWT(args)
+	case args["authz"].(bool) && args["explain"].(bool):
+		cmdAuthzExplain(args)
+	case args["login"].(bool):
+		cmdLogin(args)
 	default:
 		panic("unhandled args")
 	}
@@ -463,6 +572,17 @@ func argparse() map[string]interface{} {
 		}
 	}
 
+	if arg, ok := args["--quarantine"].(string); ok {
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			lg.Fatalw("Invalid --quarantine", "err", err)
+		}
+		if d < 0 {
+			lg.Fatalw("Invalid --quarantine: negative duration.")
+		}
+		args["--quarantine"] = d
+	}
+
 	if w, ok := args["--wait"].(string); ok {
 		d, err := time.ParseDuration(w)
 		if err != nil {
@@ -19,7 +19,13 @@ import (
 	docopt "github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/internal/grpcjwt"
 	"github.com/nogproject/nog/backend/internal/nogfsodomd"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
@@ -51,7 +57,22 @@ Options:
         PEM files can be concatenated.
   --sys-jwt=<path>  [default: /nog/jwt/tokens/nogfsodomd.jwt]
         Path of the JWT for system GRPCs.
+  --sys-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--sys-jwt'' has been modified and reload
+        it.  Use ''0'' to disable.
+  --sys-jwt-refresh=<url>
+        Token endpoint to request a new system JWT when a third of the
+        lifetime of the current JWT remains.
   --nogfsoregd=<addr>  [default: localhost:7550]
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --bind-health=<addr>
+        Enables the gRPC health service at ''<addr>''.  The server uses
+        ''--tls-cert'' and requires client certificates from ''--tls-ca''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --shutdown-timeout=<duration>  [default: 20s]
         Maximum time to wait before forced shutdown.
   --group-prefix=<prefix>
@@ -71,6 +92,12 @@ var (
 	ConfigClientAliveWithoutStream = true
 )
 
+var healthCheckInterval = 10 * time.Second
+
+// `HealthDomd` is the service reported by the gRPC health service, in
+// addition to the overall status for the empty service name.
+const HealthDomd = "nogfso.Domd"
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -111,11 +138,20 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to load --sys-jwt", "err", err)
 	}
+	if url, ok := args["--sys-jwt-refresh"].(string); ok {
+		sysRPCCreds.RefreshURL = url
+	}
 
 	lg.Infow("nogfsodomd started.")
 
-	conn, err := grpc.Dial(
-		args["--nogfsoregd"].(string),
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsodomd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      ca,
@@ -124,7 +160,12 @@ func main() {
 			Time:                ConfigClientAliveInterval,
 			PermitWithoutStream: ConfigClientAliveWithoutStream,
 		}),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
 	if err != nil {
 		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
 	}
@@ -145,6 +186,50 @@ func main() {
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx, lg, &wg, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+
+	// The gRPC health service reports `HealthDomd` as serving if the
+	// connection to nogfsoregd is usable.
+	healthd := grpchealth.New(lg)
+	healthd.AddCheck(HealthDomd, grpchealth.ConnCheck("nogfsoregd", conn))
+	if addr, ok := args["--bind-health"].(string); ok {
+		err := grpchealth.StartServer(
+			ctx, lg, &wg, addr, healthd,
+			grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    ca,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})),
+		)
+		if err != nil {
+			lg.Fatalw(
+				"Health listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = healthd.Run(ctx, healthCheckInterval)
+		}()
+	}
+
+	if d := args["--sys-jwt-reload"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sysRPCCreds.Maintain(ctx, lg, d)
+		}()
+	}
+
 	syncer := nogfsodomd.New(lg, &nogfsodomd.Config{
 		Domain:        args["<domain>"].(string),
 		GroupPrefixes: args["--group-prefix"].([]string),
@@ -189,6 +274,7 @@ func argparse() map[string]interface{} {
 
 	for _, k := range []string{
 		"--shutdown-timeout",
+		"--sys-jwt-reload",
 		"--sync-domain-start",
 		"--sync-domain-every",
 	} {
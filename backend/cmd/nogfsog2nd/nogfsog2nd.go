@@ -25,7 +25,13 @@ import (
 	"github.com/nogproject/nog/backend/internal/nogfsog2nd/gitnogdstateless"
 	"github.com/nogproject/nog/backend/internal/nogfsog2nd/gitnogdwatchlist"
 	"github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
@@ -67,6 +73,12 @@ Options:
         prefixes.
   --gitlab=<spec>  [default: localhost:/etc/gitlab/root.token:http://localhost:80]
         GitLab config ''<name>:<token-path>:<base-url>''.
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --shutdown-timeout=<duration>  [default: 20s]
         Maximum time to wait before forced shutdown.
   --log=<logger>  [default: prod]
@@ -78,6 +90,12 @@ var (
 	clientAliveWithoutStream = true
 )
 
+var healthCheckInterval = 10 * time.Second
+
+// `HealthGitNog` is the service reported by the gRPC health service, in
+// addition to the overall status for the empty service name.
+const HealthGitNog = "nogfso.GitNog"
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -129,8 +147,14 @@ func main() {
 
 	lg.Infow("nogfsog2nd started.")
 
-	conn, err := grpc.Dial(
-		args["--nogfsoregd"].(string),
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsog2nd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      ca,
@@ -139,7 +163,12 @@ func main() {
 			Time:                clientAliveInterval,
 			PermitWithoutStream: clientAliveWithoutStream,
 		}),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
 	if err != nil {
 		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
 	}
@@ -163,11 +192,34 @@ func main() {
 	var wg2 sync.WaitGroup
 	ctx2, cancel2 := context.WithCancel(context.Background())
 
-	gsrv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientCAs:    ca,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-	})))
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx2, lg, &wg2, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+
+	srvOpts := []grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientCAs:    ca,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})),
+	}
+	srvOpts = append(srvOpts, grpcchain.ServerOptions(
+		grpctrace.Server,
+		grpcmetrics.Server,
+	)...)
+	gsrv := grpc.NewServer(srvOpts...)
+
+	// The gRPC health service reports `GitNog` as serving if the
+	// connection to nogfsoregd is usable and the registry watch is alive.
+	healthd := grpchealth.New(lg)
+	healthd.Register(gsrv)
+	healthd.AddCheck(HealthGitNog, grpchealth.ConnCheck("nogfsoregd", conn))
 
 	broadcaster := broadcast.NewBroadcaster(conn)
 
@@ -188,10 +240,14 @@ func main() {
 				Gitlabs:    gitlabHostnames,
 			},
 		)
+		watchLive := grpchealth.NewLiveness("registry watch")
+		healthd.AddCheck(HealthGitNog, watchLive.Check)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := view.Watch(ctx, conn)
+			err := watchLive.Run(func() error {
+				return view.Watch(ctx, conn)
+			})
 			if err != context.Canceled {
 				lg.Fatalw("Watch failed.", "err", err)
 			}
@@ -213,10 +269,14 @@ func main() {
 				Broadcaster: broadcaster,
 			},
 		)
+		watchLive := grpchealth.NewLiveness("registry watch")
+		healthd.AddCheck(HealthGitNog, watchLive.Check)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := gitnogd.Watch(ctx)
+			err := watchLive.Run(func() error {
+				return gitnogd.Watch(ctx)
+			})
 			if err != context.Canceled {
 				lg.Fatalw("Watch failed.", "err", err)
 			}
@@ -250,6 +310,12 @@ func main() {
 	}()
 	lg.Infow("Listening.", "family", addrType, "addr", addr)
 
+	wg2.Add(1)
+	go func() {
+		defer wg2.Done()
+		_ = healthd.Run(ctx2, healthCheckInterval)
+	}()
+
 	sig := <-sigs
 	atomic.StoreInt32(&isShutdown, 1)
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/leader"
+)
+
+// `runElected()` runs `fn` directly if leader election is disabled, that is
+// if `elector` is `nil`.  Otherwise it runs `fn` only while this instance is
+// the leader for `name`.
+func runElected(
+	ctx context.Context,
+	elector *leader.Elector,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	if elector == nil {
+		return fn(ctx)
+	}
+	return elector.Run(ctx, name, fn)
+}
+
+// `leaderP` is an adapter to run a `Processor` only if this instance gets the
+// lease for `name`.  Scans use it, so that only one instance runs each scan.
+type leaderP struct {
+	Processor
+	elector *leader.Elector
+	name    string
+}
+
+func (p *leaderP) Process(ctx context.Context) error {
+	ok, err := p.elector.TryDo(ctx, p.name, p.Processor.Process)
+	if !ok && err == nil {
+		lg.Infow(
+			"Skipped scan, since another instance is leader.",
+			"name", p.name,
+		)
+	}
+	return err
+}
+
+func electedProcs(
+	elector *leader.Elector, name string, procs []Processor,
+) []Processor {
+	if elector == nil {
+		return procs
+	}
+	elected := make([]Processor, 0, len(procs))
+	for _, p := range procs {
+		elected = append(elected, &leaderP{
+			Processor: p,
+			elector:   elector,
+			name:      name,
+		})
+	}
+	return elected
+}
+
+// `defaultInstance()` returns the hostname with a random suffix, so that
+// restarted instances can be distinguished in the logs.
+func defaultInstance() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", host, hex.EncodeToString(suffix[:])), nil
+}
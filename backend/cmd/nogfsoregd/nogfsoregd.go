@@ -28,6 +28,9 @@ import (
 	"github.com/nogproject/nog/backend/internal/grpcjwt"
 	"github.com/nogproject/nog/backend/internal/nogfsopb"
 	"github.com/nogproject/nog/backend/internal/nogfsoregd"
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/auditd"
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/authzd"
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/leader"
 	"github.com/nogproject/nog/backend/internal/nogfsoregd/livebroadcastd"
 	"github.com/nogproject/nog/backend/internal/nogfsoregd/registryd"
 	"github.com/nogproject/nog/backend/internal/nogfsoregd/replicate"
@@ -47,9 +50,16 @@ import (
 	"github.com/nogproject/nog/backend/internal/workflows/unfreezerepowf"
 	"github.com/nogproject/nog/backend/internal/workflows/wfgc"
 	"github.com/nogproject/nog/backend/internal/workflows/wfindexes"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcratelimit"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mgo"
 	"github.com/nogproject/nog/backend/pkg/mulog"
 	"github.com/nogproject/nog/backend/pkg/netx"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
@@ -78,6 +88,12 @@ Options:
   --bind-rgrpc=<addr>  [default: 0.0.0.0:7551]
   --advertise-rgrpc=<addr>  [default: localhost:7551]
 	The address nogfsostad uses to connect to ''--bind-rgrpc''.
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --tls-cert=<pem>  [default: /nog/ssl/certs/nogfsoregd/combined.pem]
         TLS certificate and corresponding private key.  PEM files can be
         concatenated ''cat cert.pem privkey.pem > combined.pem''.
@@ -88,6 +104,30 @@ Options:
 	X.509 CA for JWTs.  Multiple PEMs can be concatenated.
   --jwt-ou=<ou>  [default: nogfsoiam]
 	OU of JWT signing key X.509 Subject.
+  --jwt-revocations-poll=<interval>  [default: 5s]
+        Interval to reload the JWT revocations, which may have been added by
+        other instances.  See ''nogfsoctl jwt revoke''.
+  --oidc-issuer=<url>
+        Accept JWTs from an OpenID Connect issuer in addition to JWTs that are
+        signed with ''--jwt-ca''.  The signing keys are fetched from the
+        issuer's JWKS.  Requires ''--oidc-claims''.
+  --oidc-audience=<aud>  [default: nogfso]
+        Audience that OIDC JWTs must contain in claim ''aud''.
+  --oidc-claims=<path>
+        YAML file that maps OIDC claims to subject, Unix identity, and scopes.
+        See ''grpcjwt.ClaimMapping''.
+  --authz-policy=<path>
+        YAML file with an authorization policy that grants roles to users and
+        Unix groups on roots and path prefixes.  See ''Authorization policy''
+        below.
+  --authz-policy-reload=<interval>  [default: 1m]
+        Interval to check whether ''--authz-policy'' has been modified and
+        reload it.  Use ''0'' to disable.
+  --rate-limits=<path>
+        YAML file with per-identity and per-method rate limits and
+        concurrent-stream limits.  Calls that exceed a limit fail with
+        ''ResourceExhausted'' and a retry hint.  See Go
+        ''grpcratelimit.Config''.
   --mongodb=<url>  [default: localhost:27017/nogfsoreg]
   --mongodb-ca=<pem>
         Path of file with CA certificates to use when connecting to MongoDB.
@@ -105,6 +145,12 @@ Options:
         Enable workflow processing for a registry.
   --proc-registry-jwt=<path>  [default: /nog/jwt/tokens/nogfsoregd.jwt]
         Path of the JWT for in-process system GRPCs.
+  --proc-registry-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--proc-registry-jwt'' has been modified and
+        reload it.  Use ''0'' to disable.
+  --proc-registry-jwt-refresh=<url>
+        Token endpoint to request a new JWT when a third of the lifetime of
+        the current JWT remains.
   --events-gc-scan-start=<wait-duration>  [default: 20m]
         Run events garbage collection at startup after wait duration.
         Use ''0'' to disable.
@@ -129,6 +175,54 @@ Options:
         Use ''0'' to disable.
   --workflows-gc-scan-jitter=<duration>  [default: 10m]
         Max random wait duration before each workflows garbage collection.
+  --leader-election
+        Enables leader election for the background processors, so that
+        several instances can run with the same MongoDB.  See details below.
+  --leader-lease=<duration>  [default: 15s]
+        Duration after which another instance takes over the processors of an
+        instance that died.
+  --leader-instance=<id>
+        Identifies the instance during leader election.  The default is the
+        hostname with a random suffix.
+  --journal-poll=<interval>  [default: 2s]
+        Interval to poll for events that other instances committed if
+        ''--leader-election'' is enabled.
+
+Leader election:
+
+With ''--leader-election'', several instances can serve gRPCs with the same
+MongoDB, and exactly one instance runs each background processor: broadcast,
+registry init, repo init, replication, and workflow processing for each
+''--proc-registry''.  The instances must use the same ''--proc-registry''
+options.  The leases are stored in the MongoDB collection
+''nogfsoregd.leases''.  If the leader dies, another instance takes over after
+''--leader-lease''.  Garbage collection and trim scans run on the instance that
+gets the lease when the scan starts.  Instances poll the journals for events
+that other instances committed.
+
+Nogfsostad sessions are local to the instance that nogfsostad connected to.
+gRPCs that nogfsoregd forwards to nogfsostad, like ''Stat'', ''GitNog'', and
+''Tartt'', succeed only on an instance to which a nogfsostad for the path is
+connected; other instances return ''Unavailable''.  Nogfsoregd does not
+forward these gRPCs between instances.  Clients that use them must connect to
+the instance that nogfsostad uses.  Repo locks, in contrast, are shared by all
+instances in the MongoDB collection ''nogfsoregd.repolocks''.
+
+Authorization policy:
+
+Without ''--authz-policy'', gRPCs are authorized only by the scopes in the JWT.
+With ''--authz-policy'', nogfsoregd additionally evaluates the policy, which
+binds roles, like ''root-admin'', ''archiver'', and ''reader'', to JWT
+subjects, Unix users, and Unix groups.  Group membership is resolved with the
+registry Unix domains; see ''nogfsoctl unix-domain''.  The policy file format
+is described in Go ''fsoauthz.Policy''.  Use the same policy for nogfsostad.
+Use ''nogfsoctl authz explain'' to explain decisions.
+
+Audit log:
+
+Nogfsoregd records gRPCs that check mutating actions, including denied
+attempts, in the hash-chained audit log in the MongoDB collection
+''nogfsoregd.audit''.  Use ''nogfsoctl audit export'' to export and verify it.
 `)
 
 var ErrDialedTwice = errors.New("dialed more than once")
@@ -139,6 +233,8 @@ var (
 	serverAliveInterval             = 40 * time.Second
 )
 
+var healthCheckInterval = 10 * time.Second
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -156,6 +252,15 @@ const (
 	BroadcastAll = "all"
 )
 
+// Services reported by the gRPC health service, in addition to the overall
+// status for the empty service name.
+const (
+	HealthRegistry  = "nogfso.Registry"
+	HealthRepos     = "nogfso.Repos"
+	HealthStatds    = "nogfso.Statds"
+	HealthBroadcast = "nogfso.Broadcast"
+)
+
 type initRepoAllower struct {
 	regstatdsd fsoregistry.InitRepoAllower
 }
@@ -273,11 +378,48 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to load --jwt-ca.", "err", err)
 	}
-	authn := grpcjwt.NewRSAAuthn(jwtCa, args["--jwt-ou"].(string))
-	authz := fsoauthz.CreateScopeAuthz(lg)
+	jwtAuthn := grpcjwt.NewRSAAuthn(jwtCa, args["--jwt-ou"].(string))
+	jwtRevocations := grpcjwt.NewRevocationList()
+	jwtAuthn.SetRevocationList(jwtRevocations)
+	oidcIssuer, _ := args["--oidc-issuer"].(string)
+	oidcClaims, _ := args["--oidc-claims"].(string)
+	oidcCtx, cancelOIDC := context.WithTimeout(
+		context.Background(), time.Minute,
+	)
+	oidcAuthn, err := grpcjwt.NewOIDCIssuerAuthn(
+		oidcCtx, lg, &grpcjwt.OIDCOptions{
+			Issuer:     oidcIssuer,
+			Audience:   args["--oidc-audience"].(string),
+			ClaimsPath: oidcClaims,
+		},
+		jwtAuthn, jwtRevocations,
+	)
+	cancelOIDC()
+	if err != nil {
+		lg.Fatalw("Failed to enable OIDC authentication.", "err", err)
+	}
+
+	// The limiter authenticates calls itself to key limits on the subject.
+	var limiter *grpcratelimit.Limiter
+	if path, ok := args["--rate-limits"].(string); ok {
+		cfg, err := grpcratelimit.LoadConfig(path)
+		if err != nil {
+			lg.Fatalw("Failed to load --rate-limits.", "err", err)
+		}
+		limiter = grpcratelimit.New(oidcAuthn, cfg)
+		lg.Infow("Enabled rate limits.", "rules", len(cfg.Rules))
+	}
+	scopeAuthz := fsoauthz.CreateScopeAuthz(lg)
 
 	lg.Infow("nogfsoregd started.")
 
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsoregd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGTERM)
 	signal.Notify(sigs, syscall.SIGINT)
@@ -361,10 +503,56 @@ func main() {
 
 	names := shorteruuid.NewNogNames()
 
+	// Record mutating gRPCs in the audit log.  The auditor wraps authn and
+	// authz to capture the caller and the authorization checks.
+	auditStore := auditd.NewStore(mgs, "nogfsoregd.audit")
+	auditor := auditd.New(lg, &auditd.Config{
+		Store:     auditStore,
+		IsAudited: fsoauthz.IsAuditedAction,
+	})
+	authn := auditor.Authenticator(oidcAuthn)
+
+	// With leader election, other instances commit to the journals, too.
+	// Journals poll to notice their events.
+	var elector *leader.Elector
+	enablePolling := func(*events.Journal) {}
+	if args["--leader-election"].(bool) {
+		instance, ok := args["--leader-instance"].(string)
+		if !ok {
+			instance, err = defaultInstance()
+			if err != nil {
+				lg.Fatalw(
+					"Failed to determine instance id.",
+					"err", err,
+				)
+			}
+		}
+		elector = leader.New(lg, mgs, &leader.Config{
+			Collection:    "nogfsoregd.leases",
+			Instance:      instance,
+			LeaseDuration: args["--leader-lease"].(time.Duration),
+		})
+		poll := args["--journal-poll"].(time.Duration)
+		enablePolling = func(j *events.Journal) {
+			if err := j.EnablePolling(poll); err != nil {
+				lg.Fatalw(
+					"Failed to enable journal polling.",
+					"err", err,
+				)
+			}
+		}
+		lg.Infow(
+			"Enabled leader election.",
+			"instance", instance,
+			"journalPoll", poll,
+		)
+	}
+
 	mainJ, err := events.NewJournal(mgs, "evjournal.fsomain")
 	if err != nil {
 		lg.Fatalw("Failed to create main journal.", "err", err)
 	}
+	enablePolling(mainJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -381,6 +569,7 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to create workflows journal.", "err", err)
 	}
+	enablePolling(workflowsJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -404,6 +593,7 @@ func main() {
 			"err", err,
 		)
 	}
+	enablePolling(ephWorkflowsJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -437,6 +627,7 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to create fsoregistry journal.", "err", err)
 	}
+	enablePolling(registryJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -453,6 +644,7 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to create fsorepos journal.", "err", err)
 	}
+	enablePolling(reposJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -469,6 +661,7 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to create fsobroadcast journal.", "err", err)
 	}
+	enablePolling(broadcastJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -487,6 +680,7 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to create Unix domains journal.", "err", err)
 	}
+	enablePolling(domainsJ)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -524,6 +718,26 @@ func main() {
 	repos := fsorepos.New(reposJ)
 	domains := unixdomains.New(domainsJ)
 
+	// The gRPC health service reports per-service status from journal
+	// connectivity and processor liveness.
+	healthd := grpchealth.New(lg)
+	broadcastLive := grpchealth.NewLiveness("broadcast processor")
+	registryInitLive := grpchealth.NewLiveness("registry init processor")
+	repoInitLive := grpchealth.NewLiveness("repo init processor")
+	replLive := grpchealth.NewLiveness("event replication")
+	statdsLive := grpchealth.NewLiveness("statdsd")
+	healthd.AddCheck(HealthRegistry, pingJournal(mainJ))
+	healthd.AddCheck(HealthRegistry, pingJournal(registryJ))
+	healthd.AddCheck(HealthRegistry, pingJournal(ephWorkflowsJ))
+	healthd.AddCheck(HealthRegistry, registryInitLive.Check)
+	healthd.AddCheck(HealthRepos, pingJournal(reposJ))
+	healthd.AddCheck(HealthRepos, pingJournal(workflowsJ))
+	healthd.AddCheck(HealthRepos, repoInitLive.Check)
+	healthd.AddCheck(HealthRepos, replLive.Check)
+	healthd.AddCheck(HealthStatds, statdsLive.Check)
+	healthd.AddCheck(HealthBroadcast, pingJournal(broadcastJ))
+	healthd.AddCheck(HealthBroadcast, broadcastLive.Check)
+
 	var wg2 sync.WaitGroup
 	ctx2, cancel2 := context.WithCancel(context.Background())
 
@@ -540,7 +754,11 @@ func main() {
 	)
 	wg2.Add(1)
 	go func() {
-		err := broadcaster.Process(ctx2)
+		err := broadcastLive.Run(func() error {
+			return runElected(
+				ctx2, elector, "broadcast", broadcaster.Process,
+			)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("Process broadcast error.", "err", err)
 		}
@@ -557,11 +775,61 @@ func main() {
 		lg.Fatalw("Failed to init main.", "err", err)
 	}
 
+	err = loadJWTRevocations(main, mainId, jwtRevocations)
+	if err != nil {
+		lg.Fatalw("Failed to load JWT revocations.", "err", err)
+	}
 	wg2.Add(1)
 	go func() {
-		err := nogfsoregd.ProcessRegistryInit(
-			ctx2, lg, names, mainJ, main, mainId, registry,
+		defer wg2.Done()
+		_ = watchJWTRevocations(
+			ctx2, main, mainId, jwtRevocations,
+			args["--jwt-revocations-poll"].(time.Duration),
 		)
+	}()
+
+	// The explainer evaluates the policy, or an empty policy, which
+	// explains scope decisions, for `nogfsoctl authz explain`.
+	explainer := fsoauthz.CreatePolicyAuthz(
+		lg, &fsoauthz.Policy{Version: fsoauthz.PolicyVersion},
+		authzd.NewUnixDomainGroups(main, mainId, domains),
+	)
+	var baseAuthz auditd.Authorizer = scopeAuthz
+	if path, ok := args["--authz-policy"].(string); ok {
+		policy, err := fsoauthz.LoadPolicy(path)
+		if err != nil {
+			lg.Fatalw("Failed to load --authz-policy.", "err", err)
+		}
+		explainer.SetPolicy(policy)
+		baseAuthz = explainer
+		lg.Infow("Enabled authz policy.", "revision", policy.Revision)
+
+		if d := args["--authz-policy-reload"].(time.Duration); d > 0 {
+			wg2.Add(1)
+			go func() {
+				defer wg2.Done()
+				_ = fsoauthz.WatchPolicyFile(
+					ctx2, lg, explainer, path, d,
+				)
+			}()
+		}
+	}
+	authz := auditor.Authorizer(baseAuthz)
+
+	wg2.Add(1)
+	go func() {
+		err := registryInitLive.Run(func() error {
+			return runElected(
+				ctx2, elector, "registryinit",
+				func(ctx context.Context) error {
+					return nogfsoregd.ProcessRegistryInit(
+						ctx, lg, names,
+						mainJ, main, mainId,
+						registry,
+					)
+				},
+			)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("Process registry init error.", "err", err)
 		}
@@ -574,14 +842,21 @@ func main() {
 
 	wg2.Add(1)
 	go func() {
-		err := nogfsoregd.ProcessRepoInit(
-			ctx2,
-			lg,
-			names,
-			mainJ, main, mainId,
-			registryJ, registry,
-			repos,
-		)
+		err := repoInitLive.Run(func() error {
+			return runElected(
+				ctx2, elector, "repoinit",
+				func(ctx context.Context) error {
+					return nogfsoregd.ProcessRepoInit(
+						ctx,
+						lg,
+						names,
+						mainJ, main, mainId,
+						registryJ, registry,
+						repos,
+					)
+				},
+			)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("Repo init process failed.", "err", err)
 		}
@@ -602,7 +877,11 @@ func main() {
 	wg2.Add(1)
 	go func() {
 		defer wg2.Done()
-		err := replProc.Process(ctx2)
+		err := replLive.Run(func() error {
+			return runElected(
+				ctx2, elector, "replicate", replProc.Process,
+			)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("Event replication failed.", "err", err)
 		}
@@ -613,9 +892,11 @@ func main() {
 
 	// The default `grpc.keepalive` parameters allow connections to persist
 	// forever.
-	inprocGrpcD := grpc.NewServer()
+	inprocGrpcD := grpc.NewServer(
+		grpcchain.ServerOptions(auditor.Server())...,
+	)
 
-	gsrv := grpc.NewServer(
+	srvOpts := []grpc.ServerOption{
 		grpc.Creds(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			ClientCAs:    ca,
@@ -628,7 +909,24 @@ func main() {
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			Time: serverAliveInterval,
 		}),
-	)
+	}
+	interceptors := []grpcchain.Server{
+		grpctrace.Server,
+		grpcmetrics.Server,
+	}
+	if limiter != nil {
+		interceptors = append(interceptors, limiter.Server())
+	}
+	interceptors = append(interceptors, auditor.Server())
+	srvOpts = append(srvOpts, grpcchain.ServerOptions(interceptors...)...)
+	gsrv := grpc.NewServer(srvOpts...)
+	healthd.Register(gsrv)
+
+	auditD := auditd.NewServer(authn, authz, auditStore, FsoMainName)
+	nogfsopb.RegisterAuditServer(gsrv, auditD)
+
+	authzD := authzd.NewServer(authn, authz, explainer, FsoMainName)
+	nogfsopb.RegisterAuthzServer(gsrv, authzD)
 
 	mainD := nogfsoregd.NewMainServer(
 		ctx2, authn, authz, main, mainId, FsoMainName,
@@ -756,10 +1054,15 @@ func main() {
 		args["--advertise-rgrpc"].(string),
 		sessionTls, authn, authz,
 		repos,
+		// Repo locks are shared by all instances, with or without
+		// leader election.
+		leader.NewLeases(mgs, "nogfsoregd.repolocks"),
 	)
 	wg2.Add(1)
 	go func() {
-		err := statdsd.Serve(ctx2, rLis)
+		err := statdsLive.Run(func() error {
+			return statdsd.Serve(ctx2, rLis)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("statdsd Serve error.", "err", err)
 		}
@@ -778,6 +1081,7 @@ func main() {
 	nogfsopb.RegisterDiscoveryServer(gsrv, statdsd)
 	nogfsopb.RegisterTarttServer(gsrv, statdsd)
 	nogfsopb.RegisterTestUdoServer(gsrv, statdsd)
+	nogfsopb.RegisterStadJobsServer(gsrv, statdsd)
 
 	inprocSocks, err := netx.UnixSocketpair()
 	if err != nil {
@@ -857,6 +1161,21 @@ func main() {
 	}()
 	lg.Infow("GRPC listening.", "family", addrType, "addr", addr)
 
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx2, lg, &wg2, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+	wg2.Add(1)
+	go func() {
+		defer wg2.Done()
+		_ = healthd.Run(ctx2, healthCheckInterval)
+	}()
+
 	var wg3 sync.WaitGroup
 	ctx3, cancel3 := context.WithCancel(context.Background())
 
@@ -873,37 +1192,70 @@ func main() {
 		}
 		// A socket pair is secure without TLS.
 		sysRPCCreds.AllowInsecureTransport = true
+		if url, ok := args["--proc-registry-jwt-refresh"].(string); ok {
+			sysRPCCreds.RefreshURL = url
+		}
+		if d := args["--proc-registry-jwt-reload"].(time.Duration); d > 0 {
+			wg3.Add(1)
+			go func() {
+				defer wg3.Done()
+				_ = sysRPCCreds.Maintain(ctx3, lg, d)
+			}()
+		}
 
 		lg.Infow(
 			"Started registry workflow processing.",
 			"registries", regs,
 		)
-		workflowProc := workflowproc.New(lg, &workflowproc.Config{
-			Registries:  regs,
-			Conn:        inprocConn,
-			SysRPCCreds: sysRPCCreds,
-		})
-		wg3.Add(1)
-		go func() {
-			defer wg3.Done()
-			err := workflowProc.Run(ctx3)
-			if err != context.Canceled {
-				lg.Fatalw(
-					"Registry workflow processing error.",
-					"err", err,
-				)
-			}
-			if atomic.LoadInt32(&isShutdown) == 0 {
-				lg.Fatalw(
-					"Unexpected registry workflow processing shutdown.",
-				)
+		// With leader election, each registry is processed separately,
+		// so that the registries can have different leaders.
+		groups := [][]string{regs}
+		if elector != nil {
+			groups = nil
+			for _, r := range regs {
+				groups = append(groups, []string{r})
 			}
-		}()
+		}
+		for _, g := range groups {
+			name := "workflowproc/" + strings.Join(g, ",")
+			workflowLive := grpchealth.NewLiveness(
+				"registry workflow processor",
+			)
+			healthd.AddCheck(HealthRegistry, workflowLive.Check)
+			workflowProc := workflowproc.New(
+				lg, &workflowproc.Config{
+					Registries:  g,
+					Conn:        inprocConn,
+					SysRPCCreds: sysRPCCreds,
+				},
+			)
+			wg3.Add(1)
+			go func() {
+				defer wg3.Done()
+				err := workflowLive.Run(func() error {
+					return runElected(
+						ctx3, elector, name,
+						workflowProc.Run,
+					)
+				})
+				if err != context.Canceled {
+					lg.Fatalw(
+						"Registry workflow processing error.",
+						"err", err,
+					)
+				}
+				if atomic.LoadInt32(&isShutdown) == 0 {
+					lg.Fatalw(
+						"Unexpected registry workflow processing shutdown.",
+					)
+				}
+			}()
+		}
 	} else {
 		lg.Infow("Disabled registry workflow processing.")
 	}
 
-	startEventsGcScans(args, &wg3, ctx3, []*events.Journal{
+	startEventsGcScans(args, &wg3, ctx3, elector, []*events.Journal{
 		mainJ,
 		workflowsJ,
 		ephWorkflowsJ,
@@ -911,7 +1263,7 @@ func main() {
 		reposJ,
 		broadcastJ,
 	})
-	startHistoryTrimScans(args, &wg3, ctx3, []*events.Journal{
+	startHistoryTrimScans(args, &wg3, ctx3, elector, []*events.Journal{
 		mainJ,
 		workflowsJ,
 		ephWorkflowsJ,
@@ -931,7 +1283,7 @@ func main() {
 			pingRegistryWorkflows,
 			splitRootWorkflows,
 		)
-		startWorkflowsGcScans(args, &wg3, ctx3, gc)
+		startWorkflowsGcScans(args, &wg3, ctx3, elector, gc)
 	}
 
 	sig := <-sigs
@@ -995,6 +1347,11 @@ func argparse() map[string]interface{} {
 		"--workflows-gc-scan-start",
 		"--workflows-gc-scan-every",
 		"--workflows-gc-scan-jitter",
+		"--leader-lease",
+		"--journal-poll",
+		"--jwt-revocations-poll",
+		"--proc-registry-jwt-reload",
+		"--authz-policy-reload",
 	} {
 		if arg, ok := args[k].(string); ok {
 			d, err := time.ParseDuration(arg)
@@ -1025,6 +1382,24 @@ type eventsGCP struct {
 	*events.EventsGarbageCollector
 }
 
+// `pingJournal()` returns a check that pings the journal's database.  The
+// ping runs in a goroutine, so that the check returns when `ctx` is done even
+// if the ping is stuck.  The goroutine then completes in the background.
+func pingJournal(j *events.Journal) grpchealth.CheckFunc {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- j.Ping()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (p *eventsGCP) Process(ctx context.Context) error {
 	return p.Gc(ctx)
 }
@@ -1033,6 +1408,7 @@ func startEventsGcScans(
 	args map[string]interface{},
 	wg *sync.WaitGroup,
 	ctx context.Context,
+	elector *leader.Elector,
 	journals []*events.Journal,
 ) {
 	what := "events gc"
@@ -1045,6 +1421,7 @@ func startEventsGcScans(
 			events.NewEventsGarbageCollector(lg, j),
 		})
 	}
+	procs = electedProcs(elector, "events-gc", procs)
 	StartScans(
 		lg, wg, ctx, what, procs, start, every, jitter,
 	)
@@ -1063,6 +1440,7 @@ func startHistoryTrimScans(
 	args map[string]interface{},
 	wg *sync.WaitGroup,
 	ctx context.Context,
+	elector *leader.Elector,
 	journals []*events.Journal,
 ) {
 	what := "history trimming"
@@ -1073,6 +1451,7 @@ func startHistoryTrimScans(
 	for _, j := range journals {
 		procs = append(procs, &historyTP{events.NewTrimmer(lg, j)})
 	}
+	procs = electedProcs(elector, "history-trim", procs)
 	StartScans(
 		lg, wg, ctx, what, procs, start, every, jitter,
 	)
@@ -1091,6 +1470,7 @@ func startWorkflowsGcScans(
 	args map[string]interface{},
 	wg *sync.WaitGroup,
 	ctx context.Context,
+	elector *leader.Elector,
 	gc *wfgc.GarbageCollector,
 ) {
 	what := "workflows gc"
@@ -1098,6 +1478,7 @@ func startWorkflowsGcScans(
 	every := args["--workflows-gc-scan-every"]
 	jitter := args["--workflows-gc-scan-jitter"]
 	procs := []Processor{&wfgcGCP{gc}}
+	procs = electedProcs(elector, "workflows-gc", procs)
 	StartScans(
 		lg, wg, ctx, what, procs, start, every, jitter,
 	)
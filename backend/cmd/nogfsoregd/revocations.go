@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/fsomain"
+	"github.com/nogproject/nog/backend/internal/grpcjwt"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+// `loadJWTRevocations()` copies the JWT revocations from the main entity to
+// `list` if they changed.
+func loadJWTRevocations(
+	main *fsomain.Main, mainId uuid.I, list *grpcjwt.RevocationList,
+) error {
+	s, err := main.FindId(mainId)
+	if err != nil {
+		return err
+	}
+	vid := s.Vid()
+	if vid == list.Vid() {
+		return nil
+	}
+	var revs []grpcjwt.Revocation
+	for _, r := range s.JWTRevocations() {
+		revs = append(revs, grpcjwt.Revocation{
+			Jti:     r.Jti,
+			Subject: r.Subject,
+			Revoked: ulid.Time(r.Vid),
+		})
+	}
+	list.Set(vid, revs)
+	lg.Infow(
+		"Updated JWT revocations.",
+		"vid", vid.String(),
+		"n", len(revs),
+	)
+	return nil
+}
+
+// `watchJWTRevocations()` reloads the JWT revocations every `interval`, so
+// that revocations that another nogfsoregd instance committed take effect,
+// too.
+func watchJWTRevocations(
+	ctx context.Context,
+	main *fsomain.Main,
+	mainId uuid.I,
+	list *grpcjwt.RevocationList,
+	interval time.Duration,
+) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := loadJWTRevocations(main, mainId, list); err != nil {
+			lg.Warnw("Failed to load JWT revocations.", "err", err)
+		}
+	}
+}
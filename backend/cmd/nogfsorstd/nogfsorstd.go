@@ -19,7 +19,13 @@ import (
 	docopt "github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/internal/grpcjwt"
 	"github.com/nogproject/nog/backend/internal/nogfsorstd/workflowproc"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
@@ -51,7 +57,22 @@ Options:
         PEM files can be concatenated.
   --sys-jwt=<path>  [default: /nog/jwt/tokens/nogfsorstd.jwt]
         Path of the JWT for system GRPCs.
+  --sys-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--sys-jwt'' has been modified and reload
+        it.  Use ''0'' to disable.
+  --sys-jwt-refresh=<url>
+        Token endpoint to request a new system JWT when a third of the
+        lifetime of the current JWT remains.
   --nogfsoregd=<addr>  [default: localhost:7550]
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --bind-health=<addr>
+        Enables the gRPC health service at ''<addr>''.  The server uses
+        ''--tls-cert'' and requires client certificates from ''--tls-ca''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --shutdown-timeout=<duration>  [default: 20s]
         Maximum time to wait before forced shutdown.
   --prefix=<path>
@@ -79,6 +100,12 @@ var (
 	ConfigClientAliveWithoutStream = true
 )
 
+var healthCheckInterval = 10 * time.Second
+
+// `HealthRstd` is the service reported by the gRPC health service, in
+// addition to the overall status for the empty service name.
+const HealthRstd = "nogfso.Rstd"
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -119,11 +146,20 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to load --sys-jwt", "err", err)
 	}
+	if url, ok := args["--sys-jwt-refresh"].(string); ok {
+		sysRPCCreds.RefreshURL = url
+	}
 
 	lg.Infow("nogfsorstd started.")
 
-	conn, err := grpc.Dial(
-		args["--nogfsoregd"].(string),
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsorstd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      ca,
@@ -132,7 +168,12 @@ func main() {
 			Time:                ConfigClientAliveInterval,
 			PermitWithoutStream: ConfigClientAliveWithoutStream,
 		}),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
 	if err != nil {
 		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
 	}
@@ -153,6 +194,50 @@ func main() {
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx, lg, &wg, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+
+	// The gRPC health service reports `HealthRstd` as serving if the
+	// connection to nogfsoregd is usable and the workflow processor is alive.
+	healthd := grpchealth.New(lg)
+	healthd.AddCheck(HealthRstd, grpchealth.ConnCheck("nogfsoregd", conn))
+	if addr, ok := args["--bind-health"].(string); ok {
+		err := grpchealth.StartServer(
+			ctx, lg, &wg, addr, healthd,
+			grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    ca,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})),
+		)
+		if err != nil {
+			lg.Fatalw(
+				"Health listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = healthd.Run(ctx, healthCheckInterval)
+		}()
+	}
+
+	if d := args["--sys-jwt-reload"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sysRPCCreds.Maintain(ctx, lg, d)
+		}()
+	}
+
 	workflowProc := workflowproc.New(lg, &workflowproc.Config{
 		Registries:  args["<registry>"].([]string),
 		Prefixes:    args["--prefix"].([]string),
@@ -161,9 +246,13 @@ func main() {
 		SysRPCCreds: sysRPCCreds,
 		CapPath:     args["--cap-path"].(string),
 	})
+	workflowLive := grpchealth.NewLiveness("workflow processor")
+	healthd.AddCheck(HealthRstd, workflowLive.Check)
 	wg.Add(1)
 	go func() {
-		err := workflowProc.Run(ctx)
+		err := workflowLive.Run(func() error {
+			return workflowProc.Run(ctx)
+		})
 		if err != context.Canceled {
 			lg.Fatalw(
 				"Unexpected workflow processor error.",
@@ -212,6 +301,7 @@ func argparse() map[string]interface{} {
 
 	for _, k := range []string{
 		"--shutdown-timeout",
+		"--sys-jwt-reload",
 	} {
 		if arg, ok := args[k].(string); ok {
 			d, err := time.ParseDuration(arg)
@@ -22,7 +22,13 @@ import (
 	"github.com/nogproject/nog/backend/internal/nogfsoschd/execute"
 	"github.com/nogproject/nog/backend/internal/nogfsoschd/observe"
 	"github.com/nogproject/nog/backend/internal/nogfsoschd/scan"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
@@ -59,7 +65,22 @@ Options:
         X.509 CA for TLS.  Multiple PEM files can be concatenated.
   --sys-jwt=<path>  [default: /nog/jwt/tokens/nogfsoschd.jwt]
         Path of the JWT for system GRPCs.
+  --sys-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--sys-jwt'' has been modified and reload
+        it.  Use ''0'' to disable.
+  --sys-jwt-refresh=<url>
+        Token endpoint to request a new system JWT when a third of the
+        lifetime of the current JWT remains.
   --nogfsoregd=<addr>  [default: localhost:7550]
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --bind-health=<addr>
+        Enables the gRPC health service at ''<addr>''.  The server uses
+        ''--tls-cert'' and requires client certificates from ''--tls-ca''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --shutdown-timeout=<duration>  [default: 1h]
         Maximum time to wait before forced shutdown.
   --state=<dir>
@@ -121,6 +142,12 @@ var (
 	clientAliveWithoutStream = true
 )
 
+var healthCheckInterval = 10 * time.Second
+
+// `HealthSchd` is the service reported by the gRPC health service, in
+// addition to the overall status for the empty service name.
+const HealthSchd = "nogfso.Schd"
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -151,11 +178,20 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to load --sys-jwt", "err", err)
 	}
+	if url, ok := args["--sys-jwt-refresh"].(string); ok {
+		sysRPCCreds.RefreshURL = url
+	}
 
 	lg.Infow("nogfsoschd started.")
 
-	conn, err := grpc.Dial(
-		args["--nogfsoregd"].(string),
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsoschd")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      ca,
@@ -164,7 +200,12 @@ func main() {
 			Time:                clientAliveInterval,
 			PermitWithoutStream: clientAliveWithoutStream,
 		}),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
 	if err != nil {
 		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
 	}
@@ -186,6 +227,50 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	ctxSlow, cancelSlow := context.WithCancel(context.Background())
 
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx, lg, &wg, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+
+	// The gRPC health service reports `HealthSchd` as serving if the
+	// connection to nogfsoregd is usable and the observer is alive.
+	healthd := grpchealth.New(lg)
+	healthd.AddCheck(HealthSchd, grpchealth.ConnCheck("nogfsoregd", conn))
+	if addr, ok := args["--bind-health"].(string); ok {
+		err := grpchealth.StartServer(
+			ctx, lg, &wg, addr, healthd,
+			grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    ca,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})),
+		)
+		if err != nil {
+			lg.Fatalw(
+				"Health listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = healthd.Run(ctx, healthCheckInterval)
+		}()
+	}
+
+	if d := args["--sys-jwt-reload"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sysRPCCreds.Maintain(ctx, lg, d)
+		}()
+	}
+
 	procCfg := &execute.Config{
 		CmdArgs: args["<cmdargs>"].([]string),
 	}
@@ -213,10 +298,14 @@ func main() {
 			Hosts:      args["--host"].([]string),
 		})
 		lg.Infow("Enabled watch registry broadcast.")
+		obsLive := grpchealth.NewLiveness("observer")
+		healthd.AddCheck(HealthSchd, obsLive.Check)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := obs.Watch(ctx)
+			err := obsLive.Run(func() error {
+				return obs.Watch(ctx)
+			})
 			if err != context.Canceled {
 				lg.Fatalw("Observer failed.", "err", err)
 			}
@@ -339,6 +428,7 @@ func argparse() map[string]interface{} {
 
 	for _, k := range []string{
 		"--shutdown-timeout",
+		"--sys-jwt-reload",
 		"--scan-every",
 	} {
 		if arg, ok := args[k].(string); ok {
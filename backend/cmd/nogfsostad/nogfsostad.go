@@ -8,6 +8,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -27,7 +28,10 @@ import (
 	"github.com/nogproject/nog/backend/internal/nogfsostad"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/acls"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/fswatch"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/gits"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsd"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/observer6"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/daemons"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/dialsududod"
@@ -38,9 +42,17 @@ import (
 	"github.com/nogproject/nog/backend/internal/nogfsostad/tarttd"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/testudod"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/workflowproc"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
+	"github.com/nogproject/nog/backend/pkg/metrics"
 	"github.com/nogproject/nog/backend/pkg/mulog"
 	"github.com/nogproject/nog/backend/pkg/regexpx"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/unixauth"
+	"github.com/nogproject/nog/backend/pkg/uuid"
 	"github.com/nogproject/nog/backend/pkg/x509io"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
@@ -82,6 +94,31 @@ Options:
         Required OU of JWT signing key X.509 Subject.
   --sys-jwt=<path>  [default: /nog/jwt/tokens/nogfsostad.jwt]
         Path to JWT that is used for system gRPCs.
+  --sys-jwt-reload=<interval>  [default: 1m]
+        Interval to check whether ''--sys-jwt'' has been modified and reload
+        it.  Use ''0'' to disable.
+  --sys-jwt-refresh=<url>
+        Token endpoint to request a new system JWT when a third of the
+        lifetime of the current JWT remains.
+  --jwt-revocations-poll=<interval>  [default: 30s]
+        Interval to fetch the JWT revocations from ''nogfsoregd''.  Use ''0''
+        to disable.
+  --oidc-issuer=<url>
+        Accept JWTs from an OpenID Connect issuer in addition to JWTs that are
+        signed with ''--jwt-ca''.  The signing keys are fetched from the
+        issuer's JWKS.  Requires ''--oidc-claims''.
+  --oidc-audience=<aud>  [default: nogfso]
+        Audience that OIDC JWTs must contain in claim ''aud''.
+  --oidc-claims=<path>
+        YAML file that maps OIDC claims to subject, Unix identity, and scopes.
+        See ''grpcjwt.ClaimMapping''.
+  --authz-policy=<path>
+        YAML file with an authorization policy that grants roles on roots and
+        path prefixes in addition to the JWT scopes.  Unix groups are taken
+        from the JWT.  See ''nogfsoregd --authz-policy''.
+  --authz-policy-reload=<interval>  [default: 1m]
+        Interval to check whether ''--authz-policy'' has been modified and
+        reload it.  Use ''0'' to disable.
   --jwt-unix-domain=<domain>
         The domain that is expected in a JWT ''xcrd'' claim.  If unset,
         services that require a local Unix user will be disabled.
@@ -97,6 +134,17 @@ Options:
         The hostname used during TLS handshake when establishing a callback
         session from ''nogfsoregd''.  The name must be an X.509 Subject
         Alternative Name of ''--tls-cert''.
+  --session-role=<role>  [default: active]
+        The role of the session for its prefixes: ''active'' or ''standby''.
+        Several ''nogfsostad'' may register for the same prefixes.
+        ''nogfsoregd'' forwards requests to a healthy active session if
+        possible and fails over to a standby session otherwise.  All
+        ''nogfsostad'' that serve the same prefixes must use
+        ''--coordinate-repo-locks''.
+  --coordinate-repo-locks
+        Coordinate repo locks with other ''nogfsostad'' via ''nogfsoregd'', so
+        that they never process the same repo concurrently.  Repo operations
+        wait while there is no active session.
   --nogfsoregd=<addr>  [default: localhost:7550]
   --shutdown-timeout=<duration>  [default: 20s]
         Time to wait after receiving a shutdown signal to give clients a chance
@@ -126,6 +174,27 @@ Options:
         exist, it must be writable by ''nogfsostad'', and it must be on the
         same filesystem as the realdirs, so that ''rename()'' can be used to
         swap placeholders and realdirs.
+  --tartt-restore-spool=<path>
+        Spool directory for the ''RestoreStream'' gRPC, which is disabled
+        unless the option is set.  The directory must exist and be writable
+        by ''nogfsostad''.  Each stream restores the requested members to a
+        temporary directory below the spool directory and sends them as a tar
+        stream only after the restore has completed.  The spool filesystem
+        therefore needs space for the restored files of all concurrent
+        streams, which is the full archive if no members are requested.
+  --tartt-restore-max-streams=<n>  [default: 2]
+        Maximum number of concurrent ''RestoreStream'' restores.  Further
+        streams are rejected with ''ResourceExhausted''.
+  --tartt-restore-spool-min-free=<size>  [default: 10G]
+        Free space that must remain on the spool filesystem.  Streams are
+        rejected or stopped with ''ResourceExhausted'' if less space is
+        available.  Suffixes ''k'', ''m'', ''g'', ''t''.
+  --tartt-restore-limit=<bandwidth>  [default: 50M]
+        Bandwidth limit in bytes per second for all ''RestoreStream''
+        streams together.  Suffixes ''k'', ''m'', ''g'', ''t''.
+  --tartt-restore-identity-file=<path>
+        Passed to ''tartt restore --identity-file'' to decrypt archives that
+        use native OpenPGP encryption.
   --git-fso-program=<path>  [default: /go/src/github.com/nogproject/nog/backend/bin/git-fso]
   --gitlab=<addr>  [default: http://localhost:80]
         Use ''no'' to disable publishing shadow repos to GitLab.
@@ -160,6 +229,12 @@ Options:
   --bind-grpc=<addr>
         Enables a gRPC server on ''<addr>'', which may be useful for debugging.
         The recommended address is ''0.0.0.0:7552''.
+  --bind-metrics=<addr>
+        Enables a Prometheus metrics endpoint at ''http://<addr>/metrics''.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.
   --git-gc-scan-start=<wait-duration>  [default: 20m]
         Enables ''git gc'' on the shadow repos at startup after a wait
         duration.  Use ''0'' to disable.
@@ -178,8 +253,39 @@ Options:
   --stat-scan-every=<interval>  [default: 24h]
         Enables ''git-fso stat --mtime-range-only'' on all repos at regular
         intervals in the background.  Use ''0'' to disable.
+  --fs-watch=<method>  [default: none]
+        Enables live change detection on the repo host paths.  ''<method>''
+        is ''inotify'', ''fanotify'', or ''auto'', which tries fanotify and
+        falls back to inotify.  Changed repos are updated with ''git-fso
+        stat''.  Periodic stat scans continue to cover changes that the
+        watcher misses.  fanotify requires ''CAP_SYS_ADMIN'' and does not
+        report renames or deletes.  inotify is limited by
+        ''fs.inotify.max_user_watches''.  Use ''none'' to disable.
+  --fs-watch-debounce=<interval>  [default: 10s]
+        Delays the stat of a changed repo until the repo has been quiet for
+        the interval.
   --stdtools-projects-root=<path>
         Host path to Stdtools projects root.
+  --auto-init-scan-every=<interval>  [default: 1h]
+        Runs repo discovery at regular intervals on roots for which auto init
+        has been enabled with ''nogfsoctl root ... set-auto-init'' and
+        initializes repos for the candidates.  Use ''0'' to disable.  The
+        ''--sys-jwt'' must contain the scope ''fso/init-repo'' for the roots.
+  --auto-init-audit-log=<path>
+        Appends a JSON line to ''<path>'' for each repo that has been
+        initialized automatically and for each failed attempt.
+  --jobs-interactive=<n>  [default: 4]
+        Limits the number of concurrent user-requested jobs, like stat, sha,
+        and refresh content.
+  --jobs-workflow=<n>  [default: 2]
+        Limits the number of concurrent workflow jobs, like archive and
+        unarchive repo.
+  --jobs-background=<n>  [default: 1]
+        Limits the number of concurrent background jobs, like stat scans and
+        ''git gc''.
+  --jobs-per-filesystem=<n>  [default: 4]
+        Limits the number of concurrent jobs on a single filesystem across
+        all job classes.  Use ''0'' to disable.
 `)
 
 var (
@@ -190,6 +296,16 @@ var (
 	serverAliveInterval             = 40 * time.Second
 )
 
+var healthCheckInterval = 10 * time.Second
+
+// Services reported by the gRPC health service, in addition to the overall
+// status for the empty service name.
+const (
+	HealthStatdsCallback = "nogfso.StatdsCallback"
+	HealthStat           = "nogfso.Stat"
+	HealthDiscovery      = "nogfso.Discovery"
+)
+
 type Logger interface {
 	Infow(msg string, kv ...interface{})
 	Warnw(msg string, kv ...interface{})
@@ -230,7 +346,26 @@ func main() {
 	if err != nil {
 		lg.Fatalw("Failed to load --jwt-ca.", "err", err)
 	}
-	authn := grpcjwt.NewRSAAuthn(jwtCa, args["--jwt-ou"].(string))
+	jwtAuthn := grpcjwt.NewRSAAuthn(jwtCa, args["--jwt-ou"].(string))
+	jwtRevocations := grpcjwt.NewRevocationList()
+	jwtAuthn.SetRevocationList(jwtRevocations)
+	oidcIssuer, _ := args["--oidc-issuer"].(string)
+	oidcClaims, _ := args["--oidc-claims"].(string)
+	oidcCtx, cancelOIDC := context.WithTimeout(
+		context.Background(), time.Minute,
+	)
+	authn, err := grpcjwt.NewOIDCIssuerAuthn(
+		oidcCtx, lg, &grpcjwt.OIDCOptions{
+			Issuer:     oidcIssuer,
+			Audience:   args["--oidc-audience"].(string),
+			ClaimsPath: oidcClaims,
+		},
+		jwtAuthn, jwtRevocations,
+	)
+	cancelOIDC()
+	if err != nil {
+		lg.Fatalw("Failed to enable OIDC authentication.", "err", err)
+	}
 	var domain string
 	var authnUnix *unixauth.UserAuthn
 	if arg, ok := args["--jwt-unix-domain"].(string); ok {
@@ -240,16 +375,38 @@ func main() {
 			Domain:               arg,
 		}
 	}
-	authz := fsoauthz.CreateScopeAuthz(lg)
+	var authz interface {
+		auth.Authorizer
+		auth.AnyAuthorizer
+	} = fsoauthz.CreateScopeAuthz(lg)
+	var policyAuthz *fsoauthz.PolicyAuthz
+	if path, ok := args["--authz-policy"].(string); ok {
+		policy, err := fsoauthz.LoadPolicy(path)
+		if err != nil {
+			lg.Fatalw("Failed to load --authz-policy.", "err", err)
+		}
+		policyAuthz = fsoauthz.CreatePolicyAuthz(lg, policy, nil)
+		authz = policyAuthz
+		lg.Infow("Enabled authz policy.", "revision", policy.Revision)
+	}
 	sysRPCCreds, err := grpcjwt.Load(args["--sys-jwt"].(string))
 	if err != nil {
 		lg.Fatalw("Failed to load --sys-jwt", "err", err)
 	}
+	if url, ok := args["--sys-jwt-refresh"].(string); ok {
+		sysRPCCreds.RefreshURL = url
+	}
 
 	lg.Infow("nogfsostad started.")
 
-	conn, err := grpc.Dial(
-		args["--nogfsoregd"].(string),
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsostad")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      ca,
@@ -258,7 +415,12 @@ func main() {
 			Time:                clientAliveInterval,
 			PermitWithoutStream: clientAliveWithoutStream,
 		}),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.Dial(args["--nogfsoregd"].(string), dialOpts...)
 	if err != nil {
 		lg.Fatalw("Failed to dial nogfsoregd.", "err", err)
 	}
@@ -328,6 +490,37 @@ func main() {
 		wg.Done()
 	}()
 
+	if d := args["--sys-jwt-reload"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sysRPCCreds.Maintain(ctx, lg, d)
+		}()
+	}
+
+	if d := args["--jwt-revocations-poll"].(time.Duration); d > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = grpcjwt.PollRevocations(
+				ctx, lg, conn, sysRPCCreds, jwtRevocations, d,
+			)
+		}()
+	}
+
+	if policyAuthz != nil {
+		if d := args["--authz-policy-reload"].(time.Duration); d > 0 {
+			path := args["--authz-policy"].(string)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = fsoauthz.WatchPolicyFile(
+					ctx, lg, policyAuthz, path, d,
+				)
+			}()
+		}
+	}
+
 	var nogfsostadPrivileges nogfsostad.Privileges
 	var testudodPrivileges testudod.Privileges
 	var aclsPrivileges acls.UdoBashPrivileges
@@ -376,12 +569,37 @@ func main() {
 		// in the future.
 		Rename: true,
 	}
+	sched := jobsched.New(&jobsched.Config{
+		ClassLimits: map[jobsched.Class]int{
+			jobsched.ClassInteractive: args["--jobs-interactive"].(int),
+			jobsched.ClassWorkflow:    args["--jobs-workflow"].(int),
+			jobsched.ClassBackground:  args["--jobs-background"].(int),
+		},
+		FilesystemLimit: args["--jobs-per-filesystem"].(int),
+	})
 	broadcaster := nogfsostad.NewBroadcaster(lg, conn, sysRPCCreds)
+	fsWatcher := newFsWatcher(args)
+	var repoWatcher nogfsostad.RepoWatcher
+	if fsWatcher != nil {
+		repoWatcher = fsWatcher
+	}
+	var sessionRepoLocker *nogfsostad.SessionRepoLocker
+	var repoLocker nogfsostad.RepoLocker
+	if args["--coordinate-repo-locks"].(bool) {
+		sessionRepoLocker, err = nogfsostad.NewSessionRepoLocker(lg)
+		if err != nil {
+			lg.Fatalw("Failed to create repo locker.", "err", err)
+		}
+		repoLocker = sessionRepoLocker
+		lg.Infow("Enabled repo lock coordination via nogfsoregd.")
+	}
 	proc := nogfsostad.NewProcessor(
-		lg, initLimits, shadow, broadcaster,
-		nogfsostadPrivileges, useUdo,
+		lg, initLimits, sched, shadow, broadcaster,
+		nogfsostadPrivileges, useUdo, repoWatcher, repoLocker,
 	)
 
+	healthd := grpchealth.New(lg)
+
 	switch args["--observer"] {
 	case "v6":
 		lg.Infow("Started observer v6.")
@@ -401,9 +619,13 @@ func main() {
 			Initializer: initializer4,
 			Processor:   proc,
 		})
+		obs6Live := grpchealth.NewLiveness("observer")
+		healthd.AddCheck(HealthStat, obs6Live.Check)
 		wg.Add(1)
 		go func() {
-			err := obs6.Watch(ctx)
+			err := obs6Live.Run(func() error {
+				return obs6.Watch(ctx)
+			})
 			if err != context.Canceled {
 				lg.Fatalw(
 					"Observer quit with unexpected error.",
@@ -433,6 +655,55 @@ func main() {
 			"unarchiveRepoSpool", unarchiveRepoSpool,
 		)
 	}
+	stdtoolsProjectsRoot, ok := args["--stdtools-projects-root"].(string)
+	if ok {
+		lg.Infow(
+			"Enabled Stdtools project discovery.",
+			"projectsRoot", stdtoolsProjectsRoot,
+		)
+	} else {
+		lg.Infow("Disabled Stdtools project discovery.")
+	}
+	var autoInitAuditLog io.Writer
+	if path, ok := args["--auto-init-audit-log"].(string); ok {
+		fp, err := os.OpenFile(
+			path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640,
+		)
+		if err != nil {
+			lg.Fatalw(
+				"Failed to open --auto-init-audit-log.",
+				"err", err,
+			)
+		}
+		defer fp.Close()
+		autoInitAuditLog = fp
+	}
+	discoveryd := discoveryd.New(lg, conn, &discoveryd.Config{
+		Authenticator:        authn,
+		Authorizer:           authz,
+		SysRPCCreds:          sysRPCCreds,
+		Registries:           args["<registry>"].([]string),
+		Prefixes:             args["--prefix"].([]string),
+		Hosts:                args["--host"].([]string),
+		StdtoolsProjectsRoot: stdtoolsProjectsRoot,
+		AutoInitAuditLog:     autoInitAuditLog,
+	})
+	discoveryLive := grpchealth.NewLiveness("discovery")
+	healthd.AddCheck(HealthDiscovery, discoveryLive.Check)
+	wg.Add(1)
+	go func() {
+		err := discoveryLive.Run(func() error {
+			return discoveryd.Watch(ctx)
+		})
+		if err != context.Canceled {
+			lg.Fatalw("discoveryd.Watch() failed.", "err", err)
+		}
+		if atomic.LoadInt32(&isShutdown) == 0 {
+			lg.Fatalw("Unexpected discoveryd.Watch() cancel.")
+		}
+		wg.Done()
+	}()
+
 	aclPropagator := acls.NewUdoBash(aclsPrivileges)
 	workflowProc := workflowproc.New(lg, &workflowproc.Config{
 		Registries:         args["<registry>"].([]string),
@@ -444,10 +715,15 @@ func main() {
 		AclPropagator:      aclPropagator,
 		ArchiveRepoSpool:   archiveRepoSpool,
 		UnarchiveRepoSpool: unarchiveRepoSpool,
+		NamingBoundaries:   discoveryd,
 	})
+	workflowLive := grpchealth.NewLiveness("workflow processor")
+	healthd.AddCheck(HealthStat, workflowLive.Check)
 	wg.Add(1)
 	go func() {
-		err := workflowProc.Run(ctx)
+		err := workflowLive.Run(func() error {
+			return workflowProc.Run(ctx)
+		})
 		if err != context.Canceled {
 			lg.Fatalw(
 				"Unexpected workflow processor error.",
@@ -463,7 +739,7 @@ func main() {
 	stasrv := nogfsostad.NewStatServer(lg, authn, authz, proc, sysRPCCreds)
 
 	// DEPRECATED: See comment at `listener` below.
-	gsrv := grpc.NewServer(
+	srvOpts := []grpc.ServerOption{
 		grpc.Creds(credentials.NewTLS(&tls.Config{
 			Certificates: []tls.Certificate{cert},
 			ClientCAs:    ca,
@@ -476,11 +752,23 @@ func main() {
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			Time: serverAliveInterval,
 		}),
-	)
+	}
+	srvOpts = append(srvOpts, grpcchain.ServerOptions(
+		grpctrace.Server,
+		grpcmetrics.Server,
+	)...)
+	gsrv := grpc.NewServer(srvOpts...)
 	nogfsopb.RegisterStatServer(gsrv, stasrv)
+	jobsd := jobsd.New(authn, authz, sched)
+	nogfsopb.RegisterStadJobsServer(gsrv, jobsd)
+	healthd.Register(gsrv)
+	statdLive := grpchealth.NewLiveness("statd processor")
+	healthd.AddCheck(HealthStat, statdLive.Check)
 	wg.Add(1)
 	go func() {
-		err := stasrv.Process(ctx, conn)
+		err := statdLive.Run(func() error {
+			return stasrv.Process(ctx, conn)
+		})
 		if err != context.Canceled {
 			lg.Fatalw("Statd process failed.", "err", err)
 		}
@@ -492,7 +780,32 @@ func main() {
 
 	// Don't register with `gsrv` but only with session.
 	gitnogd := nogfsostad.NewGitNogServer(lg, authn, authz, proc)
-	tarttd := tarttd.New(lg, authn, authz, proc)
+	var tarttRestorer *tarttd.Restorer
+	if spool, ok := args["--tartt-restore-spool"].(string); ok {
+		identityFile, _ := args["--tartt-restore-identity-file"].(string)
+		minFree := args["--tartt-restore-spool-min-free"].(uint64)
+		r, err := tarttd.NewRestorer(lg, &tarttd.RestorerConfig{
+			Conn:         conn,
+			SysRPCCreds:  sysRPCCreds,
+			Hosts:        args["--host"].([]string),
+			Spool:        spool,
+			IdentityFile: identityFile,
+			Limit:        args["--tartt-restore-limit"].(uint64),
+			MaxRestores:  args["--tartt-restore-max-streams"].(int),
+			SpoolMinFree: minFree,
+		})
+		if err != nil {
+			lg.Fatalw("Failed to create tartt restorer.", "err", err)
+		}
+		tarttRestorer = r
+		lg.Infow(
+			"Enabled tartt restore stream.",
+			"tarttRestoreSpool", spool,
+		)
+	} else {
+		lg.Infow("Disabled tartt restore stream.")
+	}
+	tarttd := tarttd.New(lg, authn, authz, proc, tarttRestorer)
 
 	var testUdoD nogfsopb.TestUdoServer
 	if authnUnix == nil || testudodPrivileges == nil {
@@ -505,36 +818,6 @@ func main() {
 		)
 	}
 
-	stdtoolsProjectsRoot, ok := args["--stdtools-projects-root"].(string)
-	if ok {
-		lg.Infow(
-			"Enabled Stdtools project discovery.",
-			"projectsRoot", stdtoolsProjectsRoot,
-		)
-	} else {
-		lg.Infow("Disabled Stdtools project discovery.")
-	}
-	discoveryd := discoveryd.New(lg, conn, &discoveryd.Config{
-		Authenticator:        authn,
-		Authorizer:           authz,
-		SysRPCCreds:          sysRPCCreds,
-		Registries:           args["<registry>"].([]string),
-		Prefixes:             args["--prefix"].([]string),
-		Hosts:                args["--host"].([]string),
-		StdtoolsProjectsRoot: stdtoolsProjectsRoot,
-	})
-	wg.Add(1)
-	go func() {
-		err := discoveryd.Watch(ctx)
-		if err != context.Canceled {
-			lg.Fatalw("discoveryd.Watch() failed.", "err", err)
-		}
-		if atomic.LoadInt32(&isShutdown) == 0 {
-			lg.Fatalw("Unexpected discoveryd.Watch() cancel.")
-		}
-		wg.Done()
-	}()
-
 	// DEPRECATED: The gRPC listener is disabled by default.  All gRPCs use
 	// reverse gRPC via `nogfsoregd`.  The listener may be useful for
 	// debugging, so we keep it for now.  But we could remove it at any
@@ -572,12 +855,20 @@ func main() {
 		Authenticator: authn,
 		Authorizer:    authz,
 		SysRPCCreds:   sysRPCCreds,
+		ServerOptions: grpcchain.ServerOptions(
+			grpctrace.Server,
+			grpcmetrics.Server,
+		),
+		HealthServer: healthd.Server(),
+		Role:         args["--session-role"].(nogfsopb.StatdsRole),
+		RepoLocker:   sessionRepoLocker,
 	}
 	session := nogfsostad.NewSession(
 		lg,
-		stasrv, gitnogd, gitnogd, discoveryd, tarttd, testUdoD,
+		stasrv, gitnogd, gitnogd, discoveryd, tarttd, testUdoD, jobsd,
 		sessionCfg,
 	)
+	healthd.AddCheck(HealthStatdsCallback, session.CheckSession)
 	wg2.Add(1)
 	go func() {
 		err := session.Process(ctx2, conn)
@@ -602,8 +893,24 @@ func main() {
 		}()
 	}
 
+	if addr, ok := args["--bind-metrics"].(string); ok {
+		err := metrics.StartServer(ctx2, lg, &wg2, addr)
+		if err != nil {
+			lg.Fatalw(
+				"Metrics listen failed.",
+				"addr", addr, "err", err,
+			)
+		}
+	}
+	wg2.Add(1)
+	go func() {
+		defer wg2.Done()
+		_ = healthd.Run(ctx2, healthCheckInterval)
+	}()
 	startGitGcScans(args, &wg2, ctx2, proc)
 	startStatScans(args, &wg2, ctx2, proc)
+	startFsWatch(args, &wg2, ctx2, fsWatcher, proc)
+	startAutoInitScans(args, &wg2, ctx2, discoveryd)
 
 	sig := <-sigs
 	atomic.StoreInt32(&isShutdown, 1)
@@ -826,6 +1133,142 @@ func statScan(
 	}
 }
 
+// `newFsWatcher()` returns `nil` if live change detection is disabled or
+// unavailable, so that only the periodic stat scans run.
+func parseSessionRole(s string) (nogfsopb.StatdsRole, error) {
+	switch s {
+	case "active":
+		return nogfsopb.StatdsRole_SR_ACTIVE, nil
+	case "standby":
+		return nogfsopb.StatdsRole_SR_STANDBY, nil
+	default:
+		return nogfsopb.StatdsRole_SR_UNSPECIFIED, fmt.Errorf(
+			"invalid role `%s`", s,
+		)
+	}
+}
+
+func newFsWatcher(args map[string]interface{}) *fswatch.Watcher {
+	arg := args["--fs-watch"].(string)
+	if arg == "none" {
+		lg.Infow("Disabled fs watch.")
+		return nil
+	}
+	method, err := fswatch.ParseMethod(arg)
+	if err != nil {
+		lg.Fatalw("Invalid --fs-watch.", "err", err)
+	}
+	if _, ok := args["--stat-author"].(statd.User); !ok {
+		lg.Warnw("Fs watch disabled: missing --stat-author.")
+		return nil
+	}
+
+	w, err := fswatch.New(lg, &fswatch.Config{
+		Method:   method,
+		Debounce: args["--fs-watch-debounce"].(time.Duration),
+	})
+	if err != nil {
+		lg.Warnw(
+			"Fs watch unavailable; relying on periodic stat scans.",
+			"method", method.String(),
+			"err", err,
+		)
+		return nil
+	}
+	lg.Infow(
+		"Enabled fs watch.",
+		"method", w.Method().String(),
+		"debounce", args["--fs-watch-debounce"],
+	)
+	return w
+}
+
+func startFsWatch(
+	args map[string]interface{},
+	wg *sync.WaitGroup,
+	ctx context.Context,
+	w *fswatch.Watcher,
+	proc *nogfsostad.Processor,
+) {
+	if w == nil {
+		return
+	}
+	author := args["--stat-author"].(statd.User)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := w.Run(ctx, func(ctx context.Context, repoId uuid.I) {
+			err := proc.StatChangedRepo(ctx, repoId, author)
+			switch {
+			case err == context.Canceled:
+			case err != nil:
+				lg.Warnw(
+					"Stat of changed repo failed.",
+					"repoId", repoId.String(),
+					"err", err,
+				)
+			default:
+				lg.Infow(
+					"Completed stat of changed repo.",
+					"repoId", repoId.String(),
+				)
+			}
+		})
+		if err != context.Canceled {
+			lg.Errorw(
+				"Fs watch failed; "+
+					"relying on periodic stat scans.",
+				"err", err,
+			)
+		}
+	}()
+}
+
+func startAutoInitScans(
+	args map[string]interface{},
+	wg *sync.WaitGroup,
+	ctx context.Context,
+	disc *discoveryd.Server,
+) {
+	every := args["--auto-init-scan-every"].(time.Duration)
+	if every == 0 {
+		lg.Infow("Disabled auto init scans.")
+		return
+	}
+	lg.Infow("Enabled regular auto init scans.", "every", every)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		autoInitScan(ctx, disc, every)
+	}()
+}
+
+func autoInitScan(
+	ctx context.Context,
+	disc *discoveryd.Server,
+	scanEvery time.Duration,
+) {
+	tick := time.NewTicker(scanEvery)
+	for {
+		select {
+		case <-ctx.Done():
+			tick.Stop()
+			return
+		case <-tick.C:
+			lg.Infow("Started auto init scan.")
+			err := disc.AutoInitAll(ctx)
+			if err == context.Canceled {
+				continue
+			}
+			if err != nil {
+				lg.Warnw("Auto init scan failed.", "err", err)
+			} else {
+				lg.Infow("Completed auto init scan.")
+			}
+		}
+	}
+}
+
 func argparse() map[string]interface{} {
 	const autoHelp = true
 	const noOptionFirst = false
@@ -838,10 +1281,15 @@ func argparse() map[string]interface{} {
 
 	for _, k := range []string{
 		"--shutdown-timeout",
+		"--sys-jwt-reload",
+		"--jwt-revocations-poll",
+		"--authz-policy-reload",
 		"--git-gc-scan-start",
 		"--git-gc-scan-every",
 		"--stat-scan-start",
 		"--stat-scan-every",
+		"--fs-watch-debounce",
+		"--auto-init-scan-every",
 	} {
 		if arg, ok := args[k].(string); ok {
 			d, err := time.ParseDuration(arg)
@@ -858,6 +1306,8 @@ func argparse() map[string]interface{} {
 	for _, k := range []string{
 		"--init-limit-max-files",
 		"--init-limit-max-size",
+		"--tartt-restore-limit",
+		"--tartt-restore-spool-min-free",
 	} {
 		if v, err := parseUint64Si(args[k].(string)); err != nil {
 			msg := fmt.Sprintf("Invalid %s.", k)
@@ -886,6 +1336,23 @@ func argparse() map[string]interface{} {
 		}
 	}
 
+	for k, min := range map[string]int{
+		"--jobs-interactive":          1,
+		"--jobs-workflow":             1,
+		"--jobs-background":           1,
+		"--jobs-per-filesystem":       0,
+		"--tartt-restore-max-streams": 1,
+	} {
+		n, err := strconv.Atoi(args[k].(string))
+		if err == nil && n < min {
+			err = fmt.Errorf("must be at least %d", min)
+		}
+		if err != nil {
+			lg.Fatalw(fmt.Sprintf("Invalid %s.", k), "err", err)
+		}
+		args[k] = n
+	}
+
 	if args["--repo-init-limit"], err = parsePathInitLimits(
 		args["--repo-init-limit"].([]string),
 	); err != nil {
@@ -906,6 +1373,12 @@ func argparse() map[string]interface{} {
 		lg.Fatalw("Invalid --observer.")
 	}
 
+	if args["--session-role"], err = parseSessionRole(
+		args["--session-role"].(string),
+	); err != nil {
+		lg.Fatalw("Invalid --session-role.", "err", err)
+	}
+
 	return args
 }
 
@@ -17,6 +17,7 @@ import (
 	"github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/internal/nogfsostaudod"
 	pb "github.com/nogproject/nog/backend/internal/udopb"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"github.com/nogproject/nog/backend/pkg/mulog"
 	"github.com/nogproject/nog/backend/pkg/netx"
 	"github.com/nogproject/nog/backend/pkg/pwd"
@@ -91,7 +92,10 @@ func main() {
 
 	// The default `grpc.keepalive` parameters allow connections to persist
 	// forever.
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(grpctrace.UnaryServerInterceptor),
+		grpc.StreamInterceptor(grpctrace.StreamServerInterceptor),
+	)
 
 	daemonD := &daemonServer{}
 	pb.RegisterUdoDaemonServer(srv, daemonD)
@@ -18,9 +18,11 @@ import (
 	"github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/internal/nogfsostaudod"
 	pb "github.com/nogproject/nog/backend/internal/udopb"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"github.com/nogproject/nog/backend/pkg/grpc/ucred"
 	"github.com/nogproject/nog/backend/pkg/mulog"
 	"github.com/nogproject/nog/backend/pkg/pwd"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -51,6 +53,10 @@ Options:
         Directory for the Unix socket that ''nogfsostad'' will connect to.
   --stad-users=<usernames>
         ''nogfsostad'' users that are allowed to connect; comma-separated list.
+  --trace=<url>
+        Enables exporting trace spans: ''file:///<path>'' appends JSON lines to
+        a file; ''http://<host>:9411/api/v2/spans'' posts to a Zipkin-compatible
+        collector.  ''nogfsostad'' propagates its trace context to the calls.
 
 ''nogfsostaudod-path'' and ''nogfsostaudod-fd'' both execute commands as a
 specific user on behalf of ''nogfsostad''.  ''nogfsostaudod-path'' must be
@@ -103,6 +109,13 @@ func main() {
 
 	lg.Infow("nogfsostaudod started.")
 
+	traceSpec, _ := args["--trace"].(string)
+	closeTracing, err := trace.StartExporter(lg, traceSpec, "nogfsostaudod-path")
+	if err != nil {
+		lg.Fatalw("Failed to open --trace.", "err", err)
+	}
+	defer closeTracing()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGTERM)
 	signal.Notify(sigs, syscall.SIGINT)
@@ -126,7 +139,11 @@ func main() {
 	}
 	// The default `grpc.keepalive` parameters allow connections to persist
 	// forever.
-	srv := grpc.NewServer(grpc.Creds(creds))
+	srv := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(grpctrace.UnaryServerInterceptor),
+		grpc.StreamInterceptor(grpctrace.StreamServerInterceptor),
+	)
 
 	daemonD := &daemonServer{}
 	pb.RegisterUdoDaemonServer(srv, daemonD)
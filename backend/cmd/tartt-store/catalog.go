@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
+)
+
+// `catalogTee` builds a member catalog of the tar stream that is read through
+// `Reader()`.  The plaintext catalog is written to a temporary file in the
+// current directory, from where `save()` stores it next to the manifest,
+// encrypted if there is a secret.  A failure to build the catalog is logged
+// but does not fail the save, because the catalog is only an index.
+type catalogTee struct {
+	basename  string
+	chunkSize int64
+	offset    int64
+	tmp       string
+	pw        *io.PipeWriter
+	done      chan error
+}
+
+// `startCatalog()` starts building a catalog.  `chunkSize` is the plaintext
+// chunk size of the storage format, or 0 if the format does not use chunks.
+//
+// `offset` is the offset of stdin in the original tar stream when resuming a
+// save.  The catalog then continues the entries that the interrupted save has
+// written up to `offset`.  If they are incomplete, `startCatalog()` returns
+// `nil`, and the save continues without catalog.
+func startCatalog(basename string, chunkSize, offset int64) *catalogTee {
+	pr, pw := io.Pipe()
+	c := &catalogTee{
+		basename:  basename,
+		chunkSize: chunkSize,
+		offset:    offset,
+		tmp:       fmt.Sprintf("%s.catalog.tmp", basename),
+		pw:        pw,
+		done:      make(chan error, 1),
+	}
+	if offset > 0 {
+		err := truncateCatalog(c.tmp, chunkSize, offset)
+		if err != nil {
+			lg.Warnw(
+				"Failed to resume catalog; "+
+					"saving without catalog.",
+				"err", err,
+			)
+			_ = os.Remove(c.tmp)
+			return nil
+		}
+	}
+	go func() {
+		c.done <- c.build(pr)
+	}()
+	return c
+}
+
+// `build()` writes the entries unbuffered, so that the catalog of an
+// interrupted save can be continued.
+func (c *catalogTee) build(pr *io.PipeReader) error {
+	// Always consume the full stream, so that the tee does not block.
+	defer func() { _, _ = io.Copy(ioutil.Discard, pr) }()
+
+	var fp *os.File
+	var err error
+	if c.offset > 0 {
+		fp, err = os.OpenFile(c.tmp, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		fp, err = os.Create(c.tmp)
+		if err != nil {
+			return err
+		}
+		if err := tarcatalog.WriteHeader(fp, c.chunkSize); err != nil {
+			_ = fp.Close()
+			return err
+		}
+	}
+	if err := tarcatalog.BuildEntries(fp, pr, c.offset); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// `truncateCatalog()` truncates the catalog of an interrupted save after the
+// entries up to `offset`.  The entries must be contiguous from the start.
+func truncateCatalog(path string, chunkSize, offset int64) error {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var head bytes.Buffer
+	if err := tarcatalog.WriteHeader(&head, chunkSize); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(dat, head.Bytes()) {
+		return errors.New("catalog header mismatch")
+	}
+
+	n := head.Len()
+	end := int64(0)
+	// Ignore a partial last line, which may remain if the save has been
+	// interrupted while writing it.
+	lines := strings.SplitAfter(string(dat[n:]), "\n")
+	for _, line := range lines {
+		if end == offset || !strings.HasSuffix(line, "\n") {
+			break
+		}
+		e, err := tarcatalog.ParseEntry(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return err
+		}
+		if e.Offset != end {
+			return errors.New("non-contiguous catalog entries")
+		}
+		end = e.End
+		n += len(line)
+	}
+	if end != offset {
+		return fmt.Errorf(
+			"catalog entries end at %d, expected %d", end, offset,
+		)
+	}
+	return os.Truncate(path, int64(n))
+}
+
+// `Reader()` returns a reader that passes `r` through and copies it to the
+// catalog builder.
+func (c *catalogTee) Reader(r io.Reader) io.Reader {
+	return &teeCloseReader{r: r, w: c.pw}
+}
+
+type teeCloseReader struct {
+	r io.Reader
+	w *io.PipeWriter
+}
+
+func (t *teeCloseReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if _, err := t.w.Write(p[:n]); err != nil {
+			return n, err
+		}
+	}
+	if err == io.EOF {
+		_ = t.w.Close()
+	}
+	return n, err
+}
+
+// `save()` waits for the catalog and stores it as `<basename>.catalog.gpg` if
+// `secret` is set, or as `<basename>.catalog` otherwise.
+func (c *catalogTee) save(secret string, cipher Cipher, native bool) {
+	defer func() { _ = os.Remove(c.tmp) }()
+
+	if err := <-c.done; err != nil {
+		lg.Warnw(
+			"Failed to build catalog; saving without catalog.",
+			"err", err,
+		)
+		return
+	}
+
+	fp, err := os.Open(c.tmp)
+	mustSave(err)
+	defer func() { _ = fp.Close() }()
+
+	name := fmt.Sprintf("%s.catalog", c.basename)
+	if secret != "" {
+		saveGPGFrom(fp, "", name, secret, cipher, native)
+	} else {
+		saveDirectFrom(fp, "", name)
+	}
+	lg.Infow("Saved catalog.", "basename", name)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestTruncateCatalog(t *testing.T) {
+	defer chdirTemp(t)()
+	head := "# tartt-catalog v1 chunk-size=4096\n"
+	a := "0\t1024\t100\t1539000000\t644\t0\t./a\n"
+	b := "1024\t2048\t200\t1539000000\t644\t0\t./b\n"
+	partial := "2048\t30"
+	write := func(s string) {
+		err := ioutil.WriteFile("c.tmp", []byte(s), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(head + a + b + partial)
+	if err := truncateCatalog("c.tmp", 4096, 1024); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("c.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != head+a {
+		t.Errorf("wrong truncated catalog %q", got)
+	}
+
+	for _, c := range []struct {
+		content string
+		offset  int64
+	}{
+		{head + a + b + partial, 2560},
+		{head + a + partial, 2048},
+		{head + b, 2048},
+		{"# tartt-catalog v1 chunk-size=0\n" + a, 1024},
+	} {
+		write(c.content)
+		if err := truncateCatalog("c.tmp", 4096, c.offset); err == nil {
+			t.Errorf("expected error for %q at %d",
+				c.content, c.offset)
+		}
+	}
+}
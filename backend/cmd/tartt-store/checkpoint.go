@@ -0,0 +1,894 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/tarquote"
+)
+
+// Checkpoints allow `tartt-store save --resume` to continue an interrupted
+// split save.  After each chunk has been written and synced to disk, `save
+// --checkpoint` appends a line to `<basename>.checkpoint`:
+//
+//	<chunk> <end> <container-end> <sha256-state> <sha512-state> <member>
+//
+// `<end>` is the end of the chunk in the original stream.  `<container-end>`
+// is the end of the chunk in the container tar, which has been split into
+// pieces.  The SHA states are the binary-marshaled hash states of the current
+// piece, so that the piece manifest can be completed without reading the piece
+// again.  `<member>` is the tar member that contains `<end>`:
+//
+//	<offset> <size> <mtime> <type> <name>
+//
+// `<offset>` is the start of the member header in the original stream.
+// `<name>` is quoted in GNU tar quoting style "escape".  `<member>` is `-` if
+// `<end>` is in the header blocks of a member, because a new header may differ
+// from the saved one, for example in the atime that GNU tar stores in
+// incremental archives, so that the headers could not be spliced.
+//
+// `save --resume` reads a new tar stream, which must be created in the same
+// way as the interrupted stream.  With `--resume-offset=<offset>`, the new
+// stream starts with the member at `<offset>` of a checkpoint, so that tar
+// needs not read the data before the member again; see `tartt tar --resume`.
+// Without, the new stream starts at 0.  `save --resume` skips the chunks
+// whose checkpoint `<member>` is unchanged in the new stream, that is a member
+// with the same size, mtime, type, and name starts at the same offset, because
+// the kept chunks and the new chunks can then be spliced at the chunk end into
+// a single valid tar stream.  The checkpoint with the member at
+// `--resume-offset` must be unchanged, because the new stream lacks the data
+// before it.  Starting at the first changed chunk, `save --resume` truncates
+// the pieces to the last kept checkpoint and continues as usual.
+type CheckpointMode int
+
+const (
+	CheckpointNone CheckpointMode = iota
+	CheckpointSave
+	CheckpointResume
+)
+
+// `CheckpointOptions.ResumeOffset` is the offset in the interrupted stream at
+// which stdin starts when resuming.
+type CheckpointOptions struct {
+	Mode         CheckpointMode
+	ResumeOffset int64
+}
+
+const checkpointHeaderPrefix = "# tartt-checkpoint v1 "
+
+type checkpointLine struct {
+	chunk        int
+	end          int64
+	containerEnd int64
+	sha256State  []byte
+	sha512State  []byte
+	// `member` is `nil` if the save cannot be resumed at `end`.
+	member *checkpointMember
+}
+
+type checkpointMember struct {
+	offset int64
+	size   int64
+	mtime  int64
+	typ    byte
+	name   string
+}
+
+type Checkpoint struct {
+	path      string
+	header    string
+	datadir   string
+	basename  string
+	zext      string
+	chunkSize int64
+	resume    bool
+	// `offset` is the start of stdin in the interrupted stream.  `first`
+	// is the first checkpoint whose member starts at `offset`.
+	offset int64
+	first  int
+	// `lines` are the checkpoints of the interrupted save if resuming.
+	lines    []checkpointLine
+	fp       *os.File
+	nLines   int
+	disabled bool
+}
+
+// `openCheckpoint()` prepares checkpoints for the split save of `basename`
+// with the chunk extension `zext`.  When resuming, it loads the checkpoints of
+// the interrupted save.
+func openCheckpoint(
+	datadir, basename, zext string,
+	chunkSize int64,
+	opts CheckpointOptions,
+) *Checkpoint {
+	c := &Checkpoint{
+		path: fmt.Sprintf("%s.checkpoint", basename),
+		header: fmt.Sprintf(
+			"%schunk-size=%d piece-size=%d format=%s",
+			checkpointHeaderPrefix, chunkSize, maxPieceSize,
+			zext,
+		),
+		datadir:   datadir,
+		basename:  basename,
+		zext:      zext,
+		chunkSize: chunkSize,
+		resume:    opts.Mode == CheckpointResume,
+		offset:    opts.ResumeOffset,
+	}
+	if !c.resume {
+		return c
+	}
+
+	fp, err := os.Open(c.path)
+	if os.IsNotExist(err) && c.offset == 0 {
+		lg.Warnw(
+			"Missing checkpoint; resuming from the start.",
+			"checkpoint", c.path,
+		)
+		return c
+	}
+	mustCheckpoint(err)
+	defer func() { _ = fp.Close() }()
+	header, lines, err := readCheckpoint(fp)
+	mustCheckpoint(err)
+	if header != c.header {
+		mustCheckpoint(fmt.Errorf(
+			"checkpoint header mismatch: got `%s`, expected `%s`",
+			header, c.header,
+		))
+	}
+	c.lines = lines
+
+	if c.offset > 0 {
+		c.first = -1
+		for i, l := range lines {
+			if l.member != nil && l.member.offset == c.offset {
+				c.first = i
+				break
+			}
+		}
+		if c.first < 0 {
+			mustCheckpoint(fmt.Errorf(
+				"no checkpoint member at resume offset %d",
+				c.offset,
+			))
+		}
+	}
+	return c
+}
+
+func readCheckpoint(r io.Reader) (string, []checkpointLine, error) {
+	s := bufio.NewReader(r)
+	head, err := s.ReadString('\n')
+	head = strings.TrimSuffix(head, "\n")
+	if err != nil || !strings.HasPrefix(head, checkpointHeaderPrefix) {
+		return "", nil, errors.New("malformed checkpoint header")
+	}
+
+	var lines []checkpointLine
+	for {
+		line, err := s.ReadString('\n')
+		if err == io.EOF {
+			// Ignore a partial last line, which may remain if
+			// save has been interrupted while writing it.
+			return head, lines, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		l, err := parseCheckpointLine(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return "", nil, err
+		}
+		if l.chunk != len(lines) {
+			err := errors.New("non-contiguous checkpoint chunks")
+			return "", nil, err
+		}
+		lines = append(lines, *l)
+	}
+}
+
+func parseCheckpointLine(line string) (*checkpointLine, error) {
+	malformed := fmt.Errorf("malformed checkpoint line `%s`", line)
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return nil, malformed
+	}
+	chunk, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, malformed
+	}
+	end, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, malformed
+	}
+	containerEnd, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || containerEnd <= 0 {
+		return nil, malformed
+	}
+	sha256State, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return nil, malformed
+	}
+	sha512State, err := base64.StdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return nil, malformed
+	}
+	var member *checkpointMember
+	if fields[5] != "-" {
+		member, err = parseCheckpointMember(fields[5])
+		if err != nil {
+			return nil, malformed
+		}
+	}
+	return &checkpointLine{
+		chunk:        chunk,
+		end:          end,
+		containerEnd: containerEnd,
+		sha256State:  sha256State,
+		sha512State:  sha512State,
+		member:       member,
+	}, nil
+}
+
+func parseCheckpointMember(s string) (*checkpointMember, error) {
+	malformed := errors.New("malformed checkpoint member")
+	fields := strings.SplitN(s, " ", 5)
+	if len(fields) != 5 || len(fields[3]) != 1 {
+		return nil, malformed
+	}
+	var ints [3]int64
+	for i := range ints {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, malformed
+		}
+		ints[i] = v
+	}
+	name, err := tarquote.UnquoteEscape(fields[4])
+	if err != nil {
+		return nil, malformed
+	}
+	return &checkpointMember{
+		offset: ints[0],
+		size:   ints[1],
+		mtime:  ints[2],
+		typ:    fields[3][0],
+		name:   name,
+	}, nil
+}
+
+func (l *checkpointLine) String() string {
+	member := "-"
+	if l.member != nil {
+		member = l.member.String()
+	}
+	return fmt.Sprintf(
+		"%d %d %d %s %s %s\n",
+		l.chunk, l.end, l.containerEnd,
+		base64.StdEncoding.EncodeToString(l.sha256State),
+		base64.StdEncoding.EncodeToString(l.sha512State),
+		member,
+	)
+}
+
+func (m *checkpointMember) String() string {
+	return fmt.Sprintf(
+		"%d %d %d %c %s",
+		m.offset, m.size, m.mtime, m.typ,
+		tarquote.QuoteEscape(m.name),
+	)
+}
+
+func (m *checkpointMember) equal(o *checkpointMember) bool {
+	return m != nil && o != nil && *m == *o
+}
+
+// `restore()` rewrites the checkpoint file to contain only the first `k`
+// checkpoints and returns a piece writer that continues after chunk `k-1`.
+// When resuming, pieces after the checkpoint are truncated or removed, and
+// `manifest.shasums` is rewritten to contain only the kept complete pieces.
+func (c *Checkpoint) restore(k int) *pieceWriter {
+	var buf bytes.Buffer
+	buf.WriteString(c.header + "\n")
+	for _, l := range c.lines[:k] {
+		buf.WriteString(l.String())
+	}
+	tmp := c.path + ".tmp"
+	mustCheckpoint(ioutil.WriteFile(tmp, buf.Bytes(), 0666))
+	mustCheckpoint(os.Rename(tmp, c.path))
+	fp, err := os.OpenFile(c.path, os.O_APPEND|os.O_WRONLY, 0)
+	mustCheckpoint(err)
+	mustCheckpoint(fp.Sync())
+	c.fp = fp
+	c.nLines = k
+
+	w := &pieceWriter{
+		datadir:  c.datadir,
+		basename: c.basename,
+		zext:     c.zext,
+		sha256:   sha256.New(),
+		sha512:   sha512.New(),
+	}
+	if k > 0 {
+		l := c.lines[k-1]
+		w.idx = int((l.containerEnd - 1) / maxPieceSize)
+		w.size = l.containerEnd - int64(w.idx)*maxPieceSize
+		w.offset = l.containerEnd
+		mustCheckpoint(unmarshalHash(w.sha256, l.sha256State))
+		mustCheckpoint(unmarshalHash(w.sha512, l.sha512State))
+	}
+
+	if c.resume {
+		mustSave(w.removePiecesAfter(w.idx))
+		mustManifest(w.rewriteManifest())
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if k > 0 {
+		flags = os.O_WRONLY
+	}
+	w.fp, err = os.OpenFile(w.piecePath(w.idx), flags, 0666)
+	mustSave(err)
+	if k > 0 {
+		inf, err := w.fp.Stat()
+		mustSave(err)
+		if inf.Size() < w.size {
+			mustSave(fmt.Errorf(
+				"piece `%s` is shorter than its checkpoint",
+				w.piecePath(w.idx),
+			))
+		}
+		mustSave(w.fp.Truncate(w.size))
+		_, err = w.fp.Seek(w.size, io.SeekStart)
+		mustSave(err)
+	}
+
+	w.mf, err = os.OpenFile(
+		"manifest.shasums", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644,
+	)
+	mustManifest(err)
+
+	return w
+}
+
+// `append()` durably records that chunk `chunk` has been written.  The caller
+// must sync the piece before.  If the tar members have not been tracked,
+// checkpoints are disabled for the rest of the save, because the checkpoints
+// must be contiguous.
+func (c *Checkpoint) append(
+	chunk int, end int64,
+	member *checkpointMember, tracked bool,
+	w *pieceWriter,
+) {
+	if c.disabled {
+		return
+	}
+	if !tracked {
+		lg.Warnw(
+			"Disabled checkpoints due to unknown tar members.",
+			"chunk", chunk,
+		)
+		c.disabled = true
+		return
+	}
+	if chunk != c.nLines {
+		panic("non-contiguous checkpoint")
+	}
+
+	sha256State, err := marshalHash(w.sha256)
+	mustCheckpoint(err)
+	sha512State, err := marshalHash(w.sha512)
+	mustCheckpoint(err)
+	l := checkpointLine{
+		chunk:        chunk,
+		end:          end,
+		containerEnd: w.offset,
+		sha256State:  sha256State,
+		sha512State:  sha512State,
+		member:       member,
+	}
+	_, err = io.WriteString(c.fp, l.String())
+	mustCheckpoint(err)
+	mustCheckpoint(c.fp.Sync())
+	c.nLines++
+}
+
+// `close()` keeps the checkpoint file, so that the caller can resume the save
+// if a later step fails.  `tartt tar` removes it when the archive is complete.
+func (c *Checkpoint) close() {
+	mustCheckpoint(c.fp.Close())
+}
+
+// `resumePoints()` returns the distinct checkpoint members of the save of
+// `basename`, latest first.
+func resumePoints(basename string) ([]*checkpointMember, error) {
+	fp, err := os.Open(fmt.Sprintf("%s.checkpoint", basename))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fp.Close() }()
+	_, lines, err := readCheckpoint(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []*checkpointMember
+	for i := len(lines) - 1; i >= 0; i-- {
+		m := lines[i].member
+		if m == nil {
+			continue
+		}
+		if n := len(points); n > 0 && points[n-1].equal(m) {
+			continue
+		}
+		points = append(points, m)
+	}
+	return points, nil
+}
+
+func marshalHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+func unmarshalHash(h hash.Hash, state []byte) error {
+	return h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state)
+}
+
+// `pieceWriter` splits the container tar into pieces of size `maxPieceSize`,
+// like `splitSave()`, and tracks the piece hashes, so that their state can be
+// checkpointed.  A full piece is completed only when the next byte is written
+// or on `Close()`.
+type pieceWriter struct {
+	datadir  string
+	basename string
+	zext     string
+	mf       *os.File
+	fp       *os.File
+	idx      int
+	size     int64
+	offset   int64
+	sha256   hash.Hash
+	sha512   hash.Hash
+}
+
+func (w *pieceWriter) piecePath(idx int) string {
+	return filepath.Join(
+		w.datadir,
+		fmt.Sprintf("%s.%s.tar.%03d", w.basename, w.zext, idx),
+	)
+}
+
+func (w *pieceWriter) pieceName(idx int) string {
+	return fmt.Sprintf("%s.%s.tar.%03d", w.basename, w.zext, idx)
+}
+
+func (w *pieceWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if w.size == maxPieceSize {
+			if err := w.nextPiece(); err != nil {
+				return n, err
+			}
+		}
+		m := int64(len(p))
+		if rem := maxPieceSize - w.size; m > rem {
+			m = rem
+		}
+		if err := w.write(p[:m]); err != nil {
+			return n, err
+		}
+		n += int(m)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// `write()` computes the SHAs concurrently, like `splitSaveOne()`.
+func (w *pieceWriter) write(p []byte) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		_, _ = w.sha512.Write(p)
+		wg.Done()
+	}()
+	_, _ = w.sha256.Write(p)
+	_, err := w.fp.Write(p)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	w.size += int64(len(p))
+	w.offset += int64(len(p))
+	return nil
+}
+
+func (w *pieceWriter) Sync() error {
+	return w.fp.Sync()
+}
+
+func (w *pieceWriter) nextPiece() error {
+	if err := w.finishPiece(); err != nil {
+		return err
+	}
+	if w.idx >= 999 {
+		return errors.New("too many data pieces")
+	}
+	w.idx++
+	fp, err := os.Create(w.piecePath(w.idx))
+	if err != nil {
+		return err
+	}
+	w.fp = fp
+	w.size = 0
+	w.sha256.Reset()
+	w.sha512.Reset()
+	return nil
+}
+
+// `finishPiece()` closes the current piece and adds it to the manifest.  The
+// manifest is synced, so that a later checkpoint implies complete manifest
+// entries for the previous pieces.
+func (w *pieceWriter) finishPiece() error {
+	if err := w.fp.Sync(); err != nil {
+		return err
+	}
+	if err := w.fp.Close(); err != nil {
+		return err
+	}
+	name := w.pieceName(w.idx)
+	if _, err := fmt.Fprintf(
+		w.mf, "size:%d  %s\nsha256:%s  %s\nsha512:%s  %s\n",
+		w.size, name,
+		hex.EncodeToString(w.sha256.Sum(nil)), name,
+		hex.EncodeToString(w.sha512.Sum(nil)), name,
+	); err != nil {
+		return err
+	}
+	return w.mf.Sync()
+}
+
+func (w *pieceWriter) Close() error {
+	if err := w.finishPiece(); err != nil {
+		return err
+	}
+	return w.mf.Close()
+}
+
+func (w *pieceWriter) removePiecesAfter(idx int) error {
+	for i := idx + 1; i <= 999; i++ {
+		err := os.Remove(w.piecePath(i))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// `rewriteManifest()` keeps only the entries of the complete pieces before
+// the current piece.  Entries of other files are removed, too, because
+// resuming assumes that the split save was the first save in the current
+// directory, as with `tartt tar`.
+func (w *pieceWriter) rewriteManifest() error {
+	keep := make(map[string]struct{})
+	for i := 0; i < w.idx; i++ {
+		keep[w.pieceName(i)] = struct{}{}
+	}
+
+	dat, err := ioutil.ReadFile("manifest.shasums")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	nKept := 0
+	for _, line := range strings.SplitAfter(string(dat), "\n") {
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 || !strings.HasSuffix(line, "\n") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], "\n")
+		if _, ok := keep[name]; ok {
+			buf.WriteString(line)
+			nKept++
+		}
+	}
+	// Each piece has size, sha256, and sha512.
+	if nKept != 3*len(keep) {
+		return errors.New("manifest lacks entries for complete pieces")
+	}
+
+	tmp := "manifest.shasums.tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, "manifest.shasums")
+}
+
+type checkpointChunk struct {
+	index   int
+	end     int64
+	member  *checkpointMember
+	tracked bool
+	out     <-chan []byte
+}
+
+// `saveSplitCheckpoint()` is the variant of the split save pipeline with
+// checkpoints; see `saveSplitGzipSplit()` for the plain pipeline.  The
+// `chunks` are processed by goroutines that the caller has started.
+func saveSplitCheckpoint(
+	datadir, basename, zext string,
+	in io.Reader,
+	chunks chan<- chunkTask,
+	nConcurrent int,
+	opts CheckpointOptions,
+) {
+	c := openCheckpoint(datadir, basename, zext, maxChunkSize, opts)
+	c.save(in, chunks, nConcurrent)
+}
+
+// `save()` runs the pipeline.  `readChunksCheckpoint()` skips the unchanged
+// chunks when resuming and sends the index of the first chunk that needs to
+// be saved to `start`.  `tarChunksCheckpoint()` then writes the container
+// tar, starting after the last kept checkpoint.
+func (c *Checkpoint) save(
+	in io.Reader, chunks chan<- chunkTask, nConcurrent int,
+) {
+	tracker := startMemberTracker(c.chunkSize, c.offset, c.first)
+	results := make(chan checkpointChunk, nConcurrent)
+	start := make(chan int, 1)
+	go readChunksCheckpoint(
+		results, start, chunks, tracker.Reader(in), tracker.members,
+		c.lines, c.chunkSize, c.offset, c.first,
+	)
+
+	k := <-start
+	if c.resume {
+		lg.Infow(
+			"Resumed split save after unchanged chunks.",
+			"kept", k,
+			"checkpoints", len(c.lines),
+			"offset", c.offset,
+		)
+	}
+	w := c.restore(k)
+	tarChunksCheckpoint(w, c, results)
+	c.close()
+}
+
+// `readChunksCheckpoint()` reads the stream `r` that starts at `base` in the
+// original stream.  The chunks before `first` are kept.  Chunk `first` may
+// start before `base`.  It is then only read from `base` to its end and must
+// be unchanged.
+func readChunksCheckpoint(
+	results chan<- checkpointChunk,
+	start chan<- int,
+	chunks chan<- chunkTask,
+	r io.Reader,
+	members <-chan *checkpointMember,
+	prev []checkpointLine,
+	chunkSize int64,
+	base int64,
+	first int,
+) {
+	readChunk := func(n int64) []byte {
+		in, err := ioutil.ReadAll(io.LimitReader(r, n))
+		mustReceive(err)
+		return in
+	}
+
+	i := first
+	end := base
+	verifying := true
+	cur := readChunk(int64(i+1)*chunkSize - base)
+	for ; len(cur) > 0; i++ {
+		// Read ahead, so that the tracker passes the end of `cur`
+		// before waiting for its member.
+		next := readChunk(chunkSize)
+		end += int64(len(cur))
+		member, tracked := <-members
+
+		if verifying {
+			if i < len(prev) && prev[i].end == end &&
+				prev[i].member.equal(member) {
+				cur = next
+				continue
+			}
+			if i == first && base > 0 {
+				mustCheckpoint(errors.New(
+					"member at resume offset has changed",
+				))
+			}
+			verifying = false
+			start <- i
+		}
+
+		// Queue `in` for processing, awaiting the result on `out`.
+		out := make(chan []byte)
+		chunks <- chunkTask{cur, out}
+		results <- checkpointChunk{
+			index:   i,
+			end:     end,
+			member:  member,
+			tracked: tracked,
+			out:     out,
+		}
+		cur = next
+	}
+	if verifying {
+		if i == first && base > 0 {
+			mustCheckpoint(errors.New(
+				"stream ended before resume offset",
+			))
+		}
+		start <- i
+	}
+	// Tell `xChunks()` that it's done.
+	close(chunks)
+	close(results)
+}
+
+func tarChunksCheckpoint(
+	w *pieceWriter, c *Checkpoint, results <-chan checkpointChunk,
+) {
+	tw := tar.NewWriter(w)
+	for res := range results {
+		out := <-res.out
+		mustTar(tw.WriteHeader(&tar.Header{
+			Name:    fmt.Sprintf("%d", res.index),
+			Mode:    0400,
+			Size:    int64(len(out)),
+			ModTime: time.Now().UTC(),
+		}))
+		_, err := tw.Write(out)
+		mustTar(err)
+		// Write the padding, so that the checkpoint is at the end
+		// of the tar member.
+		mustTar(tw.Flush())
+		mustSave(w.Sync())
+		c.append(res.index, res.end, res.member, res.tracked, w)
+	}
+	mustTar(tw.Close())
+	mustSave(w.Close())
+}
+
+// `memberTracker` reads the tar stream that is read through `Reader()`, which
+// starts at `base` in the original stream, and sends to `members`, for each
+// chunk end starting with chunk `first`, the member that contains the chunk
+// end.  If the stream is not a valid tar, it closes `members` early, so that
+// receivers can detect that the members are unknown.
+type memberTracker struct {
+	chunkSize int64
+	base      int64
+	next      int64
+	pw        *io.PipeWriter
+	members   chan *checkpointMember
+}
+
+func startMemberTracker(chunkSize, base int64, first int) *memberTracker {
+	pr, pw := io.Pipe()
+	t := &memberTracker{
+		chunkSize: chunkSize,
+		base:      base,
+		next:      int64(first) + 1,
+		pw:        pw,
+		members:   make(chan *checkpointMember, 16),
+	}
+	go t.track(pr)
+	return t
+}
+
+func (t *memberTracker) Reader(r io.Reader) io.Reader {
+	return &teeCloseReader{r: r, w: t.pw}
+}
+
+func (t *memberTracker) track(pr *io.PipeReader) {
+	// Always consume the full stream, so that the tee does not block.  But
+	// close `members` first, so that receivers do not wait.
+	defer func() { _, _ = io.Copy(ioutil.Discard, pr) }()
+	defer close(t.members)
+	if err := t.trackTar(pr); err != nil {
+		lg.Warnw("Failed to track tar members.", "err", err)
+	}
+}
+
+func (t *memberTracker) trackTar(r io.Reader) error {
+	// `next` is the number of the next chunk end.  `emit()` sends `m` for
+	// the chunk ends up to `pos`.  It must only be called when `m` is the
+	// last member that starts before `pos`.
+	next := t.next
+	emit := func(pos int64, m *checkpointMember) {
+		for next*t.chunkSize <= pos {
+			t.members <- m
+			next++
+		}
+	}
+
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	buf := make([]byte, 64*1024)
+	var cur *checkpointMember
+	offset := t.base
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		emit(offset, cur)
+		// Chunk ends in the header blocks cannot be used to resume.
+		emit(t.base+cr.n-1, nil)
+		typ := hdr.Typeflag
+		if typ == 0 {
+			typ = tar.TypeReg
+		}
+		cur = &checkpointMember{
+			offset: offset,
+			size:   hdr.Size,
+			mtime:  hdr.ModTime.Unix(),
+			typ:    typ,
+			name:   hdr.Name,
+		}
+		emit(t.base+cr.n, cur)
+		// Read the data in pieces to emit while passing chunk ends
+		// in large members.
+		for {
+			_, err := tr.Read(buf)
+			emit(t.base+cr.n, cur)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		offset = t.base + roundUpBlock(cr.n)
+	}
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return err
+	}
+
+	// Emit the remaining chunk ends, including the final partial chunk.
+	for (next-1)*t.chunkSize < t.base+cr.n {
+		t.members <- cur
+		next++
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func roundUpBlock(n int64) int64 {
+	const blockSize = 512
+	return (n + blockSize - 1) / blockSize * blockSize
+}
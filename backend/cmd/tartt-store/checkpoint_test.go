@@ -0,0 +1,303 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testChunkSize = 4096
+
+// `newTestTar()` creates a GNU tar stream with members of different sizes, so
+// that chunk ends are in headers, in data, and at member boundaries.  Member 2
+// has a long name, whose header blocks contain the end of chunk 1.  Member
+// `changed` has a different mtime.
+func newTestTar(t *testing.T, changed int) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	sizes := []int{100, 5500, 0, 3000, 9000, 511, 512, 2048, 7000, 300}
+	for i, size := range sizes {
+		name := fmt.Sprintf("./dir/file %d", i)
+		if i == 2 {
+			name = "./dir/" + strings.Repeat("x", 300)
+		}
+		mtime := time.Unix(1539000000, 0)
+		if i == changed {
+			mtime = mtime.Add(time.Second)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(size),
+			ModTime:  mtime,
+			Format:   tar.FormatGNU,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// `chdirTemp()` changes to a temporary directory, because the manifest and
+// the checkpoint are written to the current directory.
+func chdirTemp(t *testing.T) func() {
+	tmp, err := ioutil.TempDir("", "tartt-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		_ = os.Chdir(wd)
+		_ = os.RemoveAll(tmp)
+	}
+}
+
+// `testSave()` runs a checkpointed save with uncompressed chunks.
+func testSave(t *testing.T, in []byte, opts CheckpointOptions) *Checkpoint {
+	chunks := make(chan chunkTask)
+	go func() {
+		for c := range chunks {
+			c.out <- c.in
+		}
+	}()
+	c := openCheckpoint("", "data.tar", "raw", testChunkSize, opts)
+	c.save(bytes.NewReader(in), chunks, 2)
+	return c
+}
+
+// `loadTestSave()` concatenates the chunks from the container tar.
+func loadTestSave(t *testing.T) []byte {
+	fp, err := os.Open("data.tar.raw.tar.000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fp.Close() }()
+	var out bytes.Buffer
+	tr := tar.NewReader(fp)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != strconv.Itoa(i) {
+			t.Fatalf("unexpected chunk %q, expected %d",
+				hdr.Name, i)
+		}
+		if _, err := io.Copy(&out, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func loadTestCheckpoint(t *testing.T) []checkpointLine {
+	fp, err := os.Open("data.tar.checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fp.Close() }()
+	_, lines, err := readCheckpoint(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// `interruptTestSave()` simulates an interrupted save by saving only a prefix
+// of the stream, which leaves checkpoints for the complete chunks and excess
+// data after the last checkpoint.
+func interruptTestSave(t *testing.T, stream []byte, n int) []checkpointLine {
+	testSave(t, stream[:n], CheckpointOptions{Mode: CheckpointSave})
+	lines := loadTestCheckpoint(t)
+	if len(lines) != n/testChunkSize {
+		t.Fatalf(
+			"expected %d checkpoints, got %d",
+			n/testChunkSize, len(lines),
+		)
+	}
+	return lines
+}
+
+func TestCheckpointLineRoundTrip(t *testing.T) {
+	for _, l := range []checkpointLine{
+		{
+			chunk: 3, end: 16384, containerEnd: 17000,
+			sha256State: []byte("a"), sha512State: []byte("b"),
+			member: &checkpointMember{
+				offset: 15360, size: 9000, mtime: 1539000000,
+				typ: '0', name: "./a b\nc",
+			},
+		},
+		{
+			chunk: 0, end: 4096, containerEnd: 5120,
+			sha256State: []byte("a"), sha512State: []byte("b"),
+		},
+	} {
+		s := l.String()
+		got, err := parseCheckpointLine(s[:len(s)-1])
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		if got.String() != s {
+			t.Errorf("round trip %q, got %q", s, got.String())
+		}
+	}
+	if _, err := parseCheckpointLine("0 1 2 a b 1 2"); err == nil {
+		t.Error("expected error for malformed member")
+	}
+}
+
+func TestCheckpointMembers(t *testing.T) {
+	defer chdirTemp(t)()
+	stream := newTestTar(t, -1)
+	testSave(t, stream, CheckpointOptions{Mode: CheckpointSave})
+
+	lines := loadTestCheckpoint(t)
+	nChunks := (len(stream) + testChunkSize - 1) / testChunkSize
+	if len(lines) != nChunks {
+		t.Fatalf("expected %d checkpoints, got %d", nChunks, len(lines))
+	}
+	if lines[1].member != nil {
+		t.Errorf("unexpected member for chunk 1: %v", lines[1].member)
+	}
+	nResume := 0
+	for _, l := range lines {
+		m := l.member
+		if m == nil {
+			continue
+		}
+		nResume++
+		// The member contains the chunk end after its header.
+		if !(m.offset+512 <= l.end) {
+			t.Errorf("chunk end %d in header of %v", l.end, m)
+		}
+		tr := tar.NewReader(bytes.NewReader(stream[m.offset:]))
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != m.name || hdr.Size != m.size {
+			t.Errorf("wrong member %v at offset %d", m, m.offset)
+		}
+	}
+	if nResume == 0 {
+		t.Error("no resume points")
+	}
+	if !bytes.Equal(loadTestSave(t), stream) {
+		t.Error("saved data differs")
+	}
+}
+
+func TestCheckpointResumeFromStart(t *testing.T) {
+	defer chdirTemp(t)()
+	stream := newTestTar(t, -1)
+	prev := interruptTestSave(t, stream, 5*testChunkSize+1000)
+
+	c := testSave(t, stream, CheckpointOptions{Mode: CheckpointResume})
+	if c.nLines <= len(prev) {
+		t.Errorf("expected new checkpoints, got %d", c.nLines)
+	}
+	if !bytes.Equal(loadTestSave(t), stream) {
+		t.Error("resumed data differs")
+	}
+	mf, err := ioutil.ReadFile("manifest.shasums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(mf, []byte("\n")); n != 3 {
+		t.Errorf("expected 3 manifest lines, got %d", n)
+	}
+}
+
+// A member that changed after the interrupted save must be saved again.
+func TestCheckpointResumeChanged(t *testing.T) {
+	defer chdirTemp(t)()
+	stream := newTestTar(t, -1)
+	prev := interruptTestSave(t, stream, 5*testChunkSize+1000)
+
+	changed := newTestTar(t, 4)
+	testSave(t, changed, CheckpointOptions{Mode: CheckpointResume})
+	if !bytes.Equal(loadTestSave(t), changed) {
+		t.Error("resumed data differs")
+	}
+	lines := loadTestCheckpoint(t)
+	nChanged := 0
+	for i, l := range prev {
+		if l.member == nil || l.member.name != "./dir/file 4" {
+			continue
+		}
+		nChanged++
+		if lines[i].member.equal(l.member) {
+			t.Errorf("chunk %d was not saved again", i)
+		}
+	}
+	if nChanged == 0 {
+		t.Error("changed member is not in a checkpoint")
+	}
+}
+
+func TestCheckpointResumeOffset(t *testing.T) {
+	stream := newTestTar(t, -1)
+	n := 6*testChunkSize + 100
+	var points []*checkpointMember
+	func() {
+		defer chdirTemp(t)()
+		interruptTestSave(t, stream, n)
+		ps, err := resumePoints("data.tar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		points = ps
+	}()
+	if len(points) < 2 {
+		t.Fatalf("expected 2 or more resume points, got %d",
+			len(points))
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].offset >= points[i-1].offset {
+			t.Fatal("resume points are not latest first")
+		}
+	}
+
+	for _, p := range points {
+		func() {
+			defer chdirTemp(t)()
+			prev := interruptTestSave(t, stream, n)
+			c := testSave(t, stream[p.offset:], CheckpointOptions{
+				Mode:         CheckpointResume,
+				ResumeOffset: p.offset,
+			})
+			if c.first >= len(prev) || c.first < 0 {
+				t.Fatalf("invalid first checkpoint %d", c.first)
+			}
+			if !bytes.Equal(loadTestSave(t), stream) {
+				t.Errorf("resumed data from %d differs",
+					p.offset)
+			}
+		}()
+	}
+}
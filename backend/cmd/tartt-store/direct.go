@@ -11,7 +11,12 @@ func isDirect(mf *Manifest, basename string) bool {
 	return mf.HasFile(basename)
 }
 
-func saveDirect(datadir, basename string) {
+func saveDirect(datadir, basename string, in io.Reader) {
+	saveDirectFrom(in, datadir, basename)
+}
+
+// `saveDirectFrom()` stores `r` as `<basename>`.
+func saveDirectFrom(r io.Reader, datadir, basename string) {
 	path := basename
 	fullPath := filepath.Join(datadir, path)
 
@@ -26,7 +31,7 @@ func saveDirect(datadir, basename string) {
 	sha512Done := make(chan string)
 	go sha512sum(sha512Done, sha512R) // Closes sha512R when done.
 
-	n, err := io.Copy(io.MultiWriter(fp, sha256W, sha512W), os.Stdin)
+	n, err := io.Copy(io.MultiWriter(fp, sha256W, sha512W), r)
 	mustSave(err)
 	mustSave(fp.Sync())
 	mustSave(fp.Close())
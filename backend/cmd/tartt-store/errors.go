@@ -7,10 +7,14 @@ func mustMsg(err error, msg string) {
 	lg.Fatalw(msg, "err", err)
 }
 
+func mustCheckpoint(err error)   { mustMsg(err, "Failed to checkpoint.") }
+func mustDecrypt(err error)      { mustMsg(err, "Failed to decrypt.") }
+func mustEncrypt(err error)      { mustMsg(err, "Failed to encrypt.") }
 func mustGpg(err error)          { mustMsg(err, "Failed to run gpg2.") }
 func mustGunzip(err error)       { mustMsg(err, "Failed to gunzip.") }
 func mustGzip(err error)         { mustMsg(err, "Failed to gzip.") }
 func mustLoad(err error)         { mustMsg(err, "Failed to load data.") }
+func mustLoadIdentity(err error) { mustMsg(err, "Failed to load identity.") }
 func mustLoadManifest(err error) { mustMsg(err, "Failed to load manifest.") }
 func mustLoadSecret(err error)   { mustMsg(err, "Failed to load secret.") }
 func mustManifest(err error)     { mustMsg(err, "Failed to write manifest.") }
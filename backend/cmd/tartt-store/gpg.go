@@ -12,13 +12,77 @@ func isGPG(mf *Manifest, basename string) bool {
 	return mf.HasFile(fmt.Sprintf("%s.gpg", basename))
 }
 
-func saveGPG(datadir, basename, secret string, cipher Cipher) {
+func saveGPG(
+	datadir, basename, secret string, cipher Cipher, native bool,
+	in io.Reader,
+) {
+	saveGPGFrom(in, datadir, basename, secret, cipher, native)
+}
+
+// `saveGPGFrom()` stores `r` encrypted as `<basename>.gpg`.
+func saveGPGFrom(
+	r io.Reader, datadir, basename, secret string, cipher Cipher,
+	native bool,
+) {
 	path := fmt.Sprintf("%s.gpg", basename)
 	fullPath := filepath.Join(datadir, path)
 
 	fp, err := os.Create(fullPath)
 	mustSave(err)
 
+	var cipherR io.Reader
+	var wait func()
+	if native {
+		cipherR = nativeEncryptPipe(r, secret, cipher)
+		wait = func() {}
+	} else {
+		cipherR, wait = startGPGSymmetric(r, secret, cipher)
+	}
+
+	sha256R, sha256W := io.Pipe()
+	sha256Done := make(chan string)
+	go sha256sum(sha256Done, sha256R) // Closes sha256R when done.
+
+	sha512R, sha512W := io.Pipe()
+	sha512Done := make(chan string)
+	go sha512sum(sha512Done, sha512R) // Closes sha512R when done.
+
+	n, err := io.Copy(io.MultiWriter(fp, sha256W, sha512W), cipherR)
+	if native {
+		mustEncrypt(err)
+	} else {
+		mustGpg(err)
+	}
+	wait()
+	mustSave(fp.Sync())
+	mustSave(fp.Close())
+
+	mustManifest(sha256W.Close())
+	sha256hex := <-sha256Done
+
+	mustManifest(sha512W.Close())
+	sha512hex := <-sha512Done
+
+	mf, err := os.OpenFile(
+		"manifest.shasums", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644,
+	)
+	mustManifest(err)
+	_, err = fmt.Fprintf(mf, "size:%d  %s\n", n, path)
+	mustManifest(err)
+	_, err = fmt.Fprintf(mf, "sha256:%s  %s\n", sha256hex, path)
+	mustManifest(err)
+	_, err = fmt.Fprintf(mf, "sha512:%s  %s\n", sha512hex, path)
+	mustManifest(err)
+	mustManifest(mf.Sync())
+	mustManifest(mf.Close())
+}
+
+// `startGPGSymmetric()` starts gpg2 to encrypt `r`.  It returns the
+// ciphertext reader and a function that waits for gpg2 after the reader has
+// been consumed.
+func startGPGSymmetric(
+	r io.Reader, secret string, cipher Cipher,
+) (io.Reader, func()) {
 	args := []string{
 		"--batch",
 		// Do not:
@@ -39,8 +103,8 @@ func saveGPG(datadir, basename, secret string, cipher Cipher) {
 		"--cipher-algo", string(cipher),
 		"--compress-algo", "ZLIB",
 	}
-	gpgCmd := exec.Command(gpg2Tool.Path, args...)
-	gpgCmd.Stdin = os.Stdin
+	gpgCmd := exec.Command(gpg2Tool().Path, args...)
+	gpgCmd.Stdin = r
 	gpgStdout, err := gpgCmd.StdoutPipe()
 	mustGpg(err)
 	gpgCmd.Stderr = os.Stderr
@@ -63,48 +127,23 @@ func saveGPG(datadir, basename, secret string, cipher Cipher) {
 	}()
 
 	mustGpg(gpgCmd.Start())
-
-	sha256R, sha256W := io.Pipe()
-	sha256Done := make(chan string)
-	go sha256sum(sha256Done, sha256R) // Closes sha256R when done.
-
-	sha512R, sha512W := io.Pipe()
-	sha512Done := make(chan string)
-	go sha512sum(sha512Done, sha512R) // Closes sha512R when done.
-
-	n, err := io.Copy(io.MultiWriter(fp, sha256W, sha512W), gpgStdout)
-	mustGpg(err)
-	mustGpg(gpgCmd.Wait())
-	mustGpg(<-passDone)
-	mustSave(fp.Sync())
-	mustSave(fp.Close())
-
-	mustManifest(sha256W.Close())
-	sha256hex := <-sha256Done
-
-	mustManifest(sha512W.Close())
-	sha512hex := <-sha512Done
-
-	mf, err := os.OpenFile(
-		"manifest.shasums", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644,
-	)
-	mustManifest(err)
-	_, err = fmt.Fprintf(mf, "size:%d  %s\n", n, path)
-	mustManifest(err)
-	_, err = fmt.Fprintf(mf, "sha256:%s  %s\n", sha256hex, path)
-	mustManifest(err)
-	_, err = fmt.Fprintf(mf, "sha512:%s  %s\n", sha512hex, path)
-	mustManifest(err)
-	mustManifest(mf.Sync())
-	mustManifest(mf.Close())
+	return gpgStdout, func() {
+		mustGpg(gpgCmd.Wait())
+		mustGpg(<-passDone)
+	}
 }
 
-func loadGPG(datadir, basename, secret string) {
+func loadGPG(datadir, basename, secret string, co CryptoOptions) {
 	if secret == "" {
-		secret = loadSecret()
+		secret = loadSecret(co)
 	}
 
 	fullPath := filepath.Join(datadir, fmt.Sprintf("%s.gpg", basename))
+	if co.Native {
+		loadNativeGPG(fullPath, secret)
+		return
+	}
+
 	args := []string{
 		"--batch",
 		// See `zstdGPGOneChunk()` for details.
@@ -113,7 +152,7 @@ func loadGPG(datadir, basename, secret string) {
 		"--output", "-",
 		fullPath,
 	}
-	gpgCmd := exec.Command(gpg2Tool.Path, args...)
+	gpgCmd := exec.Command(gpg2Tool().Path, args...)
 	gpgCmd.Stdin = nil
 	gpgCmd.Stdout = os.Stdout
 	gpgCmd.Stderr = os.Stderr
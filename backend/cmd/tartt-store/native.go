@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/DataDog/zstd"
+	"github.com/nogproject/nog/backend/pkg/openpgpx"
+	"golang.org/x/crypto/openpgp"
+)
+
+// `CryptoOptions` selects between gpg2 and native OpenPGP.  The storage
+// formats are the same, so that archives that have been saved with one can be
+// loaded with the other.  `Identities` are the private keys that decrypt
+// `secret.asc` natively.
+type CryptoOptions struct {
+	Native     bool
+	Identities openpgp.EntityList
+}
+
+func mustReadIdentityFile(path string) openpgp.EntityList {
+	ids, err := openpgpx.ReadIdentityFile(path)
+	mustLoadIdentity(err)
+	return ids
+}
+
+// `zstdNativeChunk()` is like `zstdGPGChunk()` but encrypts in-process.
+func zstdNativeChunk(chunk chunkTask, secret string, cipher Cipher) {
+	var buf bytes.Buffer
+	ew, err := openpgpx.SymmetricEncrypt(&buf, secret, string(cipher), false)
+	mustEncrypt(err)
+	zw := zstd.NewWriter(ew)
+	_, err = zw.Write(chunk.in)
+	mustZstd(err)
+	mustZstd(zw.Close())
+	mustEncrypt(ew.Close())
+	chunk.out <- buf.Bytes()
+}
+
+// `nativeEncryptPipe()` returns a reader with the ciphertext of `r`, like
+// `gpg --symmetric --compress-algo ZLIB`.  Encryption errors are returned
+// from the reader.
+func nativeEncryptPipe(r io.Reader, secret string, cipher Cipher) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		ew, err := openpgpx.SymmetricEncrypt(
+			pw, secret, string(cipher), true,
+		)
+		if err == nil {
+			_, err = io.Copy(ew, r)
+			if err2 := ew.Close(); err == nil {
+				err = err2
+			}
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+func loadNativeGPG(fullPath, secret string) {
+	fp, err := os.Open(fullPath)
+	mustLoad(err)
+	defer fp.Close()
+	dr, err := openpgpx.SymmetricDecrypt(fp, secret)
+	mustDecrypt(err)
+	_, err = io.Copy(os.Stdout, dr)
+	mustDecrypt(err)
+}
+
+// Capture `secret` in closure.
+func nativeUnzstdFunc(secret string) func(w io.Writer, r io.Reader) {
+	return func(w io.Writer, r io.Reader) {
+		dr, err := openpgpx.SymmetricDecrypt(r, secret)
+		mustDecrypt(err)
+		zr := zstd.NewReader(dr)
+		_, err = io.Copy(w, zr)
+		mustUnzstd(err)
+		mustUnzstd(zr.Close())
+	}
+}
+
+func loadNativeEncryptedSecret(path string, ids openpgp.EntityList) string {
+	if len(ids) == 0 {
+		err := errors.New("native decryption requires --identity-file")
+		mustLoadSecret(err)
+	}
+	secret, err := openpgpx.DecryptSecretFile(path, ids)
+	mustLoadSecret(err)
+	return secret
+}
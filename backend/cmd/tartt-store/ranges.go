@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
+)
+
+// `loadRanges()` writes the byte ranges `rgs` of the original data to stdout.
+// It reads only the chunks that overlap the ranges; the container tar headers
+// of the other chunks are read, but their data is skipped by seeking.  Only
+// the split formats support ranges, because they store the data in chunks of
+// known size `maxChunkSize`.
+func loadRanges(
+	mf *Manifest, datadir, basename, secret string, co CryptoOptions,
+	rgs []tarcatalog.Range,
+) {
+	var ext string
+	var unx func(w io.Writer, zR io.Reader)
+	var unxName string
+	switch {
+	case isSplitZstdGPGSplit(mf, basename):
+		ext = "zst.gpg"
+		unx, unxName = zstdGPGUnxFunc(secret, co)
+	case isSplitZstdSplit(mf, basename):
+		ext = "zst"
+		unx, unxName = unzstd, "unzstd"
+	case isSplitGzipSplit(mf, basename):
+		ext = "gz"
+		unx, unxName = gunzip, "gunzip"
+	default:
+		lg.Fatalw("--ranges requires a split storage format.")
+	}
+
+	files, err := mf.Glob(
+		fmt.Sprintf("%s.%s.tar.[0-9][0-9][0-9]", basename, ext),
+	)
+	mustLoad(err)
+	if len(files) < 1 {
+		err := fmt.Errorf("missing %s.%s.tar.*", basename, ext)
+		mustLoad(err)
+	}
+	pieces, err := openPieces(datadir, files)
+	mustLoad(err)
+	defer pieces.Close()
+
+	nConcurrent := nConcurrentFromNumCPU()
+	lg.Infow(
+		fmt.Sprintf(
+			"Determined number of parallel %s tasks.", unxName,
+		),
+		"n", nConcurrent,
+	)
+
+	chunks := make(chan chunkTask)
+	results := make(chan rangeChunk, nConcurrent)
+	// The producer gets a copy, because `catRanges()` modifies `rgs`.
+	go untarRangeChunkTasks(
+		results, chunks, pieces,
+		append([]tarcatalog.Range(nil), rgs...),
+	)
+	for i := 0; i < nConcurrent; i++ {
+		go unxChunks(chunks, unx)
+	}
+	catRanges(os.Stdout, results, rgs)
+	mustSend(os.Stdout.Close())
+}
+
+// `rangeChunk` is the pending result of a chunk that starts at offset `start`
+// in the original data.
+type rangeChunk struct {
+	start int64
+	out   <-chan []byte
+}
+
+// `untarRangeChunkTasks()` is like `untarChunkTasks()`, but it only queues
+// chunks that overlap `rgs`, and it stops after the last range.
+func untarRangeChunkTasks(
+	results chan<- rangeChunk,
+	chunks chan<- chunkTask,
+	r io.Reader,
+	rgs []tarcatalog.Range,
+) {
+	defer close(chunks)
+	defer close(results)
+
+	tr := tar.NewReader(r)
+	for i := 0; len(rgs) > 0; i++ {
+		hdr, err := tr.Next()
+		switch {
+		case err == io.EOF:
+			return // End of archive.
+		case err != nil:
+			mustUntar(err)
+		}
+		if hdr.Name != strconv.Itoa(i) {
+			err := fmt.Errorf("unexpected chunk `%s`", hdr.Name)
+			mustUntar(err)
+		}
+
+		start := int64(i) * maxChunkSize
+		end := start + maxChunkSize
+		for len(rgs) > 0 && rgs[0].End <= start {
+			rgs = rgs[1:]
+		}
+		if len(rgs) == 0 || rgs[0].Start >= end {
+			continue
+		}
+
+		var in bytes.Buffer
+		_, err = io.Copy(&in, tr)
+		mustUntar(err)
+		out := make(chan []byte)
+		chunks <- chunkTask{in.Bytes(), out}
+		results <- rangeChunk{start, out}
+	}
+}
+
+// `catRanges()` writes the parts of the chunk results that are in `rgs`.  It
+// fails if the data ends before the last range.
+func catRanges(
+	w io.Writer,
+	results <-chan rangeChunk,
+	rgs []tarcatalog.Range,
+) {
+	for {
+		res, ok := <-results
+		if !ok {
+			break
+		}
+		out := <-res.out
+		start := res.start
+		end := start + int64(len(out))
+		for len(rgs) > 0 && rgs[0].Start < end {
+			rg := &rgs[0]
+			a := rg.Start - start
+			if a < 0 {
+				a = 0
+			}
+			b := rg.End - start
+			if b > int64(len(out)) {
+				b = int64(len(out))
+			}
+			if a < b {
+				_, err := w.Write(out[a:b])
+				mustSend(err)
+			}
+			if rg.End > end {
+				rg.Start = end
+				break
+			}
+			rgs = rgs[1:]
+		}
+	}
+	if len(rgs) > 0 {
+		mustLoad(errors.New("range beyond end of data"))
+	}
+}
+
+// `pieces` is an `io.ReadSeeker` that concatenates the data pieces, so that
+// the tar reader can skip chunks by seeking.
+type pieces struct {
+	files []*os.File
+	sizes []int64
+	pos   int64
+	size  int64
+}
+
+func openPieces(datadir string, names []string) (*pieces, error) {
+	p := &pieces{}
+	for _, name := range names {
+		fp, err := os.Open(filepath.Join(datadir, name))
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.files = append(p.files, fp)
+		fi, err := fp.Stat()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.sizes = append(p.sizes, fi.Size())
+		p.size += fi.Size()
+	}
+	return p, nil
+}
+
+func (p *pieces) Close() {
+	for _, fp := range p.files {
+		_ = fp.Close()
+	}
+}
+
+func (p *pieces) Read(b []byte) (int, error) {
+	off := p.pos
+	for i, fp := range p.files {
+		if off >= p.sizes[i] {
+			off -= p.sizes[i]
+			continue
+		}
+		if rest := p.sizes[i] - off; int64(len(b)) > rest {
+			b = b[:rest]
+		}
+		n, err := fp.ReadAt(b, off)
+		p.pos += int64(n)
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (p *pieces) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.pos
+	case io.SeekEnd:
+		offset += p.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	p.pos = offset
+	return offset, nil
+}
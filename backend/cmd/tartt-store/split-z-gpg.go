@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/DataDog/zstd"
 	"github.com/nogproject/nog/backend/pkg/execx"
@@ -19,33 +20,49 @@ func isSplitZstdGPGSplit(mf *Manifest, basename string) bool {
 }
 
 // `saveSplitZstdGPGSplit()` is like `saveSplitGzipSplit()`, but with zstd
-// followed by gpg AES256 encryption.
-func saveSplitZstdGPGSplit(datadir, basename, secret string, cipher Cipher) {
-	nConcurrent := nConcurrentFromNumCPU()
+// followed by gpg AES256 encryption.  With `native`, it encrypts in-process
+// instead of running gpg2.
+func saveSplitZstdGPGSplit(
+	datadir, basename, secret string, cipher Cipher, native bool,
+	in io.Reader, nConcurrent int, ckpt CheckpointOptions,
+) {
 	lg.Infow(
 		"Determined number of parallel zstd|gpg tasks.",
 		"n", nConcurrent,
 	)
 
 	chunks := make(chan chunkTask)
-	results := make(chan (<-chan []byte), nConcurrent)
-	tarR, tarW := io.Pipe()
-
-	go readChunks(results, chunks, os.Stdin)
 	for i := 0; i < nConcurrent; i++ {
-		go zstdGPGChunks(chunks, secret, cipher)
+		go zstdGPGChunks(chunks, secret, cipher, native)
+	}
+	if ckpt.Mode != CheckpointNone {
+		saveSplitCheckpoint(
+			datadir, basename, "zst.gpg", in, chunks, nConcurrent,
+			ckpt,
+		)
+		return
 	}
+
+	results := make(chan (<-chan []byte), nConcurrent)
+	tarR, tarW := io.Pipe()
+	go readChunks(results, chunks, in)
 	go tarChunks(tarW, results)
 	splitSave(datadir, basename, tarR, "zst.gpg")
 }
 
-func zstdGPGChunks(chunks <-chan chunkTask, secret string, cipher Cipher) {
+func zstdGPGChunks(
+	chunks <-chan chunkTask, secret string, cipher Cipher, native bool,
+) {
 	for {
 		chunk, ok := <-chunks
 		if !ok {
 			return
 		}
-		zstdGPGChunk(chunk, secret, cipher)
+		if native {
+			zstdNativeChunk(chunk, secret, cipher)
+		} else {
+			zstdGPGChunk(chunk, secret, cipher)
+		}
 	}
 }
 
@@ -70,7 +87,7 @@ func zstdGPGChunk(chunk chunkTask, secret string, cipher Cipher) {
 		"--cipher-algo", string(cipher),
 		"--compress-algo", "Uncompressed",
 	}
-	gpgCmd := exec.Command(gpg2Tool.Path, args...)
+	gpgCmd := exec.Command(gpg2Tool().Path, args...)
 	gpgCmd.Stderr = os.Stderr
 
 	// Write secret to gpg2 via fd 3.
@@ -116,12 +133,26 @@ func zstdGPGChunk(chunk chunkTask, secret string, cipher Cipher) {
 	chunk.out <- gpgBuf.Bytes()
 }
 
-func loadSplitZstdGPGSplit(mf *Manifest, datadir, basename, secret string) {
+func loadSplitZstdGPGSplit(
+	mf *Manifest, datadir, basename, secret string, co CryptoOptions,
+) {
+	unz, unzName := zstdGPGUnxFunc(secret, co)
+	loadSplitXSplit(mf, datadir, basename, "zst.gpg", unz, unzName)
+}
+
+// `zstdGPGUnxFunc()` returns the function that decrypts and uncompresses a
+// chunk together with its name for logging.  It loads the secret if it is
+// empty.
+func zstdGPGUnxFunc(
+	secret string, co CryptoOptions,
+) (func(w io.Writer, zR io.Reader), string) {
 	if secret == "" {
-		secret = loadSecret()
+		secret = loadSecret(co)
 	}
-	unz := gpgUnzstdFunc(secret)
-	loadSplitXSplit(mf, datadir, basename, "zst.gpg", unz, "gpg|unzstd")
+	if co.Native {
+		return nativeUnzstdFunc(secret), "decrypt|unzstd"
+	}
+	return gpgUnzstdFunc(secret), "gpg|unzstd"
 }
 
 // Capture `secret` in closure.
@@ -133,7 +164,7 @@ func gpgUnzstdFunc(secret string) func(w io.Writer, gpgR io.Reader) {
 			"--passphrase-fd", "3",
 			"--decrypt",
 		}
-		gpgCmd := exec.Command(gpg2Tool.Path, args...)
+		gpgCmd := exec.Command(gpg2Tool().Path, args...)
 		gpgCmd.Stderr = os.Stderr
 
 		// Write secret to gpg2 via fd 3.
@@ -169,8 +200,11 @@ func gpgUnzstdFunc(secret string) func(w io.Writer, gpgR io.Reader) {
 	}
 }
 
-func loadSecret() string {
+func loadSecret(co CryptoOptions) string {
 	if exists("secret.asc") {
+		if co.Native {
+			return loadNativeEncryptedSecret("secret.asc", co.Identities)
+		}
 		return loadEncryptedSecret("secret.asc")
 	} else if exists("secret") {
 		return loadPlaintextSecret("secret")
@@ -185,7 +219,7 @@ func loadEncryptedSecret(path string) string {
 		"--batch",
 		"--decrypt", path,
 	}
-	gpgCmd := exec.Command(gpg2Tool.Path, gpgArgs...)
+	gpgCmd := exec.Command(gpg2Tool().Path, gpgArgs...)
 	gpgCmd.Stderr = os.Stderr
 	var secret bytes.Buffer
 	gpgCmd.Stdout = &secret
@@ -204,8 +238,18 @@ func exists(path string) bool {
 	return err == nil
 }
 
-var gpg2Tool = execx.MustLookTool(execx.ToolSpec{
-	Program:   "gpg2",
-	CheckArgs: []string{"--version"},
-	CheckText: "gpg (GnuPG) 2.",
-})
+var gpg2ToolOnce sync.Once
+var gpg2ToolFound *execx.Tool
+
+// `gpg2Tool()` looks up gpg2 on first use, so that native mode works without
+// gpg2.
+func gpg2Tool() *execx.Tool {
+	gpg2ToolOnce.Do(func() {
+		gpg2ToolFound = execx.MustLookTool(execx.ToolSpec{
+			Program:   "gpg2",
+			CheckArgs: []string{"--version"},
+			CheckText: "gpg (GnuPG) 2.",
+		})
+	})
+	return gpg2ToolFound
+}
@@ -66,39 +66,56 @@ type chunkTask struct {
 // channels are sent to `results`.
 //
 // `gzipChunks()` reads from `chunks` and sends compressed chunks to the `out`
-// completion channels.  `nConcurrent` goroutines compress in parallel.
+// completion channels.  `nConcurrent` goroutines compress in parallel.  The
+// default is `nConcurrentFromNumCPU()`.
 //
 // `tarChunks()` writes compressed chunks to the tar stream in the original
 // order.  `splitSave()` splits the tar stream into pieces and writes them to
 // disk.
-func saveSplitGzipSplit(datadir, basename string) {
-	nConcurrent := nConcurrentFromNumCPU()
+func saveSplitGzipSplit(
+	datadir, basename string, in io.Reader,
+	nConcurrent int, ckpt CheckpointOptions,
+) {
 	lg.Infow("Determined number of parallel gzip tasks.", "n", nConcurrent)
 
 	chunks := make(chan chunkTask)
-	results := make(chan (<-chan []byte), nConcurrent)
-	tarR, tarW := io.Pipe()
-
-	go readChunks(results, chunks, os.Stdin)
 	for i := 0; i < nConcurrent; i++ {
 		go gzipChunks(chunks)
 	}
+	if ckpt.Mode != CheckpointNone {
+		saveSplitCheckpoint(
+			datadir, basename, "gz", in, chunks, nConcurrent, ckpt,
+		)
+		return
+	}
+
+	results := make(chan (<-chan []byte), nConcurrent)
+	tarR, tarW := io.Pipe()
+	go readChunks(results, chunks, in)
 	go tarChunks(tarW, results)
 	splitSave(datadir, basename, tarR, "gz")
 }
 
-func saveSplitZstdSplit(datadir, basename string) {
-	nConcurrent := nConcurrentFromNumCPU()
+func saveSplitZstdSplit(
+	datadir, basename string, in io.Reader,
+	nConcurrent int, ckpt CheckpointOptions,
+) {
 	lg.Infow("Determined number of parallel zstd tasks.", "n", nConcurrent)
 
 	chunks := make(chan chunkTask)
-	results := make(chan (<-chan []byte), nConcurrent)
-	tarR, tarW := io.Pipe()
-
-	go readChunks(results, chunks, os.Stdin)
 	for i := 0; i < nConcurrent; i++ {
 		go zstdChunks(chunks)
 	}
+	if ckpt.Mode != CheckpointNone {
+		saveSplitCheckpoint(
+			datadir, basename, "zst", in, chunks, nConcurrent, ckpt,
+		)
+		return
+	}
+
+	results := make(chan (<-chan []byte), nConcurrent)
+	tarR, tarW := io.Pipe()
+	go readChunks(results, chunks, in)
 	go tarChunks(tarW, results)
 	splitSave(datadir, basename, tarR, "zst")
 }
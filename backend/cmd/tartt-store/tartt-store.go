@@ -5,6 +5,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
 )
 
 // `xVersion` and `xBuild` are injected by the `Makefile`.
@@ -28,12 +30,14 @@ func qqBackticks(s string) string {
 
 var usage = qqBackticks(strings.TrimSpace(`
 Usage:
-  tartt-store save [--datadir=<dir>] --split-zstd-gpg-split [--cipher-algo=<cipher>] --secret-fd=<n> [<basename>]
-  tartt-store save [--datadir=<dir>] --gpg [--cipher-algo=<cipher>] --secret-fd=<n> [<basename>]
-  tartt-store save [--datadir=<dir>] --direct [<basename>]
-  tartt-store save [--datadir=<dir>] --split-gzip-split [<basename>]
-  tartt-store save [--datadir=<dir>] --split-zstd-split [<basename>]
-  tartt-store load [--datadir=<dir>] [--secret-stdin] [<basename>]
+  tartt-store save [--datadir=<dir>] [--catalog] [--checkpoint|--resume [--resume-offset=<offset>]] [--jobs=<n>] --split-zstd-gpg-split [--native] [--cipher-algo=<cipher>] --secret-fd=<n> [<basename>]
+  tartt-store save [--datadir=<dir>] [--catalog] --gpg [--native] [--cipher-algo=<cipher>] --secret-fd=<n> [<basename>]
+  tartt-store save [--datadir=<dir>] [--catalog] --direct [<basename>]
+  tartt-store save [--datadir=<dir>] [--catalog] [--checkpoint|--resume [--resume-offset=<offset>]] [--jobs=<n>] --split-gzip-split [<basename>]
+  tartt-store save [--datadir=<dir>] [--catalog] [--checkpoint|--resume [--resume-offset=<offset>]] [--jobs=<n>] --split-zstd-split [<basename>]
+  tartt-store resume-points [<basename>]
+  tartt-store load [--datadir=<dir>] [--native] [--secret-stdin] [--ranges=<ranges>] [<basename>]
+  tartt-store load [--datadir=<dir>] --identity-file=<path> [--ranges=<ranges>] [<basename>]
 
 Options:
   --direct            Store stdin as a single uncompressed file.
@@ -43,13 +47,41 @@ Options:
                       into pieces that are stored.
   --split-zstd-split  Like --split-gzip-split but with zstd.
   --split-zstd-gpg-split  Like --split-gzip-split but with zstd and gpg.
+  --jobs=<n>          Number of chunks that are compressed and encrypted in
+                      parallel.  The default depends on the number of CPUs.
+                      The maximum is 12.  The chunk order and the storage
+                      format do not depend on ''--jobs''.
   --cipher-algo=<cipher>  [default: AES]
                       Passed to ''gpg --cipher-algo'' when using encryption.
                       Supported ciphers: AES, AES192, AES256.
+  --native            Encrypt and decrypt in-process with the Go OpenPGP
+                      implementation instead of running ''gpg2''.
+  --identity-file=<path>  Decrypt ''secret.asc'' natively with the
+                      unprotected OpenPGP private keys in ''<path>''.
+                      Implies ''--native''.
   --secret-stdin      Read the plaintext secret from stdin.
   --secret-fd=<n>     Read the plaintext secret from file descriptor ''<n>''.
   --datadir=<dir>     Save data to a different directory.  The manifest is
                       always stored in the current directory.
+  --catalog           Also save a member catalog of the tar stream on stdin
+                      as ''<basename>.catalog'', encrypted as
+                      ''<basename>.catalog.gpg'' if there is a secret.  The
+                      catalog is always stored in the current directory.
+  --checkpoint        Record after each chunk in ''<basename>.checkpoint''
+                      how far the data has been saved, so that an interrupted
+                      save can be continued with ''--resume''.  The
+                      checkpoint is stored in the current directory.  Only
+                      the split formats support checkpoints.  Stdin must be
+                      a tar stream.
+  --resume            Continue an interrupted save with ''--checkpoint''.
+                      Stdin must be a new tar stream that has been created
+                      like the interrupted one.  See below.
+  --resume-offset=<offset>  Stdin starts with the member at ''<offset>'' of
+                      the interrupted stream, as listed by
+                      ''resume-points''.  See below.
+  --ranges=<ranges>   Write only the byte ranges ''<start>-<end>,...'' of the
+                      original data.  The ranges must be sorted and must not
+                      overlap.  Only the split formats support ranges.
 
 The default ''<basename>'' is ''data.tar''.  All examples below are for the
 default basename.
@@ -60,6 +92,43 @@ format.  The default is ''--split-zstd-split''.
 ''tartt-store load'' auto-detects the storage format and writes the original
 data to stdout.
 
+''tartt-store save --catalog'' lists for each tar member its byte range in the
+tar stream, see package ''tarcatalog''.  ''tartt-store load --ranges'' uses
+the ranges to decrypt and uncompress only the chunks that contain the members.
+The catalog itself is loaded like any other data:
+
+    tartt-store load data.tar.catalog
+
+''tartt-store save --resume'' compares the new tar stream with the checkpoints
+and keeps the saved chunks while the member that contains the chunk end is
+unchanged, that is a member with the same size, mtime, type, and name starts
+at the same offset.  It then truncates the data pieces and continues saving
+with the new tar stream, so that the result is a single valid tar stream, as
+if the save had not been interrupted.  With ''--catalog'', the catalog
+continues the entries of the interrupted save.  Resuming removes
+all entries from ''manifest.shasums'' except for the kept data pieces, so the
+interrupted save must have been the first save into the current directory, as
+with ''tartt tar''.  The checkpoint is kept after the save, so that it can be
+resumed again if a later step fails.  It should be removed when it is no
+longer needed.
+
+''tartt-store resume-points'' lists the checkpointed members from which a new
+tar stream may start, latest first, one per line:
+
+    <offset> <size> <mtime> <type> <name>
+
+''<name>'' is quoted in GNU tar quoting style "escape".  If the new stream
+starts with the member at ''<offset>'', use ''tartt-store save --resume
+--resume-offset=<offset>''.  The chunks before the member are then kept
+without reading their data again, and the member must be unchanged.  ''tartt
+tar --resume'' uses it to restart tar at the member.
+
+''--native'' does not change the storage format.  Data that has been saved
+with ''--native'' can be decrypted with ''gpg2'' as in the examples below, and
+''tartt-store load --native'' decrypts data that has been saved with ''gpg2''.
+The native implementation supports RSA and ElGamal private keys but not ECDH
+keys.
+
 Assuming the original data is a tar stream, as created by ''tartt'', its
 content can be listed in a ''full/'' or ''patch/'' directory for all storage
 formats as follows:
@@ -129,6 +198,8 @@ func main() {
 	switch {
 	case args["save"].(bool):
 		cmdSave(args)
+	case args["resume-points"].(bool):
+		cmdResumePoints(args)
 	case args["load"].(bool):
 		cmdLoad(args)
 	default:
@@ -158,6 +229,32 @@ func argparse() map[string]interface{} {
 		args["--secret-fd"] = uintptr(v)
 	}
 
+	if arg, ok := args["--jobs"].(string); ok {
+		v, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			lg.Fatalw("Invalid --jobs.", "err", err)
+		}
+		if v < 1 || v > maxNConcurrent {
+			lg.Fatalw(
+				"Invalid --jobs.",
+				"err", "out of range",
+				"max", maxNConcurrent,
+			)
+		}
+		args["--jobs"] = int(v)
+	}
+
+	if arg, ok := args["--resume-offset"].(string); ok {
+		v, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || v < 0 || v%512 != 0 {
+			lg.Fatalw(
+				"Invalid --resume-offset.",
+				"err", "not a tar block offset",
+			)
+		}
+		args["--resume-offset"] = v
+	}
+
 	arg := args["--cipher-algo"].(string)
 	switch arg {
 	case "AES", "AES192", "AES256":
@@ -177,24 +274,73 @@ func cmdSave(args map[string]interface{}) {
 		datadir = a
 	}
 
+	native := args["--native"].(bool)
+	cipher := args["--cipher-algo"].(Cipher)
+
+	var secret string
+	if fd, ok := args["--secret-fd"].(uintptr); ok {
+		secret = mustReadSecret(fd)
+	}
+
+	var ckpt CheckpointOptions
+	switch {
+	case args["--checkpoint"].(bool):
+		ckpt.Mode = CheckpointSave
+	case args["--resume"].(bool):
+		ckpt.Mode = CheckpointResume
+		if v, ok := args["--resume-offset"].(int64); ok {
+			ckpt.ResumeOffset = v
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	var catalog *catalogTee
+	if args["--catalog"].(bool) {
+		chunkSize := int64(maxChunkSize)
+		if args["--gpg"].(bool) || args["--direct"].(bool) {
+			chunkSize = 0
+		}
+		catalog = startCatalog(basename, chunkSize, ckpt.ResumeOffset)
+		if catalog != nil {
+			in = catalog.Reader(in)
+		}
+	}
+
+	nConcurrent := nConcurrentFromNumCPU()
+	if n, ok := args["--jobs"].(int); ok {
+		nConcurrent = n
+	}
+
 	switch {
 	case args["--split-zstd-gpg-split"].(bool):
-		secret := mustReadSecret(args["--secret-fd"].(uintptr))
-		cipher := args["--cipher-algo"].(Cipher)
-		saveSplitZstdGPGSplit(datadir, basename, secret, cipher)
+		saveSplitZstdGPGSplit(
+			datadir, basename, secret, cipher, native, in,
+			nConcurrent, ckpt,
+		)
 	case args["--gpg"].(bool):
-		secret := mustReadSecret(args["--secret-fd"].(uintptr))
-		cipher := args["--cipher-algo"].(Cipher)
-		saveGPG(datadir, basename, secret, cipher)
+		saveGPG(datadir, basename, secret, cipher, native, in)
 	case args["--split-zstd-split"].(bool):
-		saveSplitZstdSplit(datadir, basename)
+		saveSplitZstdSplit(datadir, basename, in, nConcurrent, ckpt)
 	case args["--split-gzip-split"].(bool):
-		saveSplitGzipSplit(datadir, basename)
+		saveSplitGzipSplit(datadir, basename, in, nConcurrent, ckpt)
 	case args["--direct"].(bool):
-		saveDirect(datadir, basename)
+		saveDirect(datadir, basename, in)
 	default:
 		panic("args logic error")
 	}
+
+	if catalog != nil {
+		catalog.save(secret, cipher, native)
+	}
+}
+
+func cmdResumePoints(args map[string]interface{}) {
+	basename := args["<basename>"].(string)
+	points, err := resumePoints(basename)
+	mustCheckpoint(err)
+	for _, m := range points {
+		fmt.Println(m.String())
+	}
 }
 
 func cmdLoad(args map[string]interface{}) {
@@ -205,6 +351,14 @@ func cmdLoad(args map[string]interface{}) {
 		datadir = a
 	}
 
+	co := CryptoOptions{
+		Native: args["--native"].(bool),
+	}
+	if path, ok := args["--identity-file"].(string); ok {
+		co.Native = true
+		co.Identities = mustReadIdentityFile(path)
+	}
+
 	var secret string
 	if args["--secret-stdin"].(bool) {
 		in, err := ioutil.ReadAll(os.Stdin)
@@ -214,11 +368,20 @@ func cmdLoad(args map[string]interface{}) {
 
 	manifest := mustLoadManifestFile()
 
+	if arg, ok := args["--ranges"].(string); ok {
+		rgs, err := tarcatalog.ParseRanges(arg)
+		if err != nil {
+			lg.Fatalw("Invalid --ranges.", "err", err)
+		}
+		loadRanges(manifest, datadir, basename, secret, co, rgs)
+		return
+	}
+
 	switch {
 	case isSplitZstdGPGSplit(manifest, basename):
-		loadSplitZstdGPGSplit(manifest, datadir, basename, secret)
+		loadSplitZstdGPGSplit(manifest, datadir, basename, secret, co)
 	case isGPG(manifest, basename):
-		loadGPG(datadir, basename, secret)
+		loadGPG(datadir, basename, secret, co)
 	case isSplitZstdSplit(manifest, basename):
 		loadSplitZstdSplit(manifest, datadir, basename)
 	case isSplitGzipSplit(manifest, basename):
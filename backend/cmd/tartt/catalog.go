@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nogproject/nog/backend/cmd/tartt/drivers"
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
+)
+
+// `loadCatalog()` loads the member catalog that `tartt tar` saves next to the
+// archive data.  It returns `nil` without error for archives that have been
+// created without catalog, so that callers can fall back to reading the tar
+// stream.
+func loadCatalog(
+	archive string,
+	secret string,
+	ids *Identities,
+	unh drivers.UntarHandler,
+	arRel string,
+) (*tarcatalog.Catalog, error) {
+	manifest, err := parseManifest(
+		filepath.Join(archive, "manifest.shasums"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, hasGPG := manifest["data.tar.catalog.gpg"]
+	_, hasPlain := manifest["data.tar.catalog"]
+	if !hasGPG && !hasPlain {
+		return nil, nil
+	}
+
+	loadArgs := []string{"load"}
+	if hasGPG {
+		loadArgs = append(loadArgs, ids.LoadArgs(secret)...)
+	}
+	loadArgs = append(loadArgs,
+		"data.tar.catalog",
+	)
+	loadCmd := exec.Command(
+		unh.LoadProgram(tarttStoreTool.Path),
+		unh.LoadArgs(arRel, loadArgs)...,
+	)
+	loadCmd.Dir = archive
+	if secret == "" || !hasGPG {
+		loadCmd.Stdin = nil
+	} else {
+		loadCmd.Stdin = strings.NewReader(secret)
+	}
+	var out bytes.Buffer
+	loadCmd.Stdout = &out
+	loadCmd.Stderr = os.Stderr
+	if err := loadCmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to load catalog: %v", err)
+	}
+
+	c, err := tarcatalog.Read(&out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %v", err)
+	}
+	return c, nil
+}
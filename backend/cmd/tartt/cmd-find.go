@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	slashpath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/ratelimit"
+	"github.com/nogproject/nog/backend/pkg/tarquote"
+)
+
+// `FindArchive` is an archive in which `tartt find` searches for members.
+type FindArchive struct {
+	Archive
+	Time   time.Time
+	Tspath string
+}
+
+func cmdFind(args map[string]interface{}) {
+	quoteStyle := QsEscaped
+	if args["--unquote"].(bool) {
+		quoteStyle = QsLiteral
+	}
+
+	glob := trimMemberPath(args["<member-glob>"].(string))
+	if _, err := slashpath.Match(glob, ""); err != nil {
+		lg.Fatalw("Invalid <member-glob>.", "err", err)
+	}
+
+	var limit *ratelimit.Bucket
+	if v, ok := args["--limit"].(uint64); ok {
+		// Rate from arg, fixed 1 MiB capacity.
+		limit = ratelimit.NewBucketWithRate(float64(v), 1024*1024)
+	}
+
+	ids := identitiesFromArgsMust(args)
+
+	repo, err := OpenRepo(".")
+	if err != nil {
+		lg.Fatalw("Failed to open repo.", "err", err)
+	}
+	defer repo.Close()
+
+	storeName, ok := args["--store"].(string)
+	if !ok {
+		storeName = repo.DefaultStoreName()
+	}
+	store, err := repo.OpenStore(storeName)
+	if err != nil {
+		lg.Fatalw("Failed to open store.", "err", err)
+	}
+	defer store.Close()
+
+	if args["--no-lock"].(bool) {
+		// Don't lock the store, which MUST be safe with concurrent
+		// operations that only append to the store, like tar.  It
+		// MAY be unsafe with concurrent operations that may delete
+		// content, like gc.  If in doubt, document the behavior for
+		// individual operations.
+	} else {
+		ctx := context.Background()
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := store.TryLock(ctx); err != nil {
+			cancel()
+			lg.Fatalw(
+				"Failed to lock store.",
+				"store", store.Dir(),
+				"err", err,
+			)
+		}
+		cancel()
+		defer store.Unlock()
+	}
+
+	tree, err := store.LsTree()
+	if err != nil {
+		lg.Fatalw("Failed to list tree.", "err", err)
+	}
+
+	archives, err := store.gatherFindArchives(tree)
+	if err != nil {
+		lg.Fatalw("Failed to gather archives.", "err", err)
+	}
+
+	var secrets map[string]string
+	if args["--no-preload-secrets"].(bool) {
+		lg.Infow("Skipped preloading secrets.")
+	} else {
+		plain := make([]Archive, 0, len(archives))
+		for _, ar := range archives {
+			plain = append(plain, ar.Archive)
+		}
+		secrets = loadSecretsMust(store, plain, ids)
+	}
+	if file, ok := args["--notify-preload-secrets-done"].(string); ok {
+		notifyFileMust(file, "preload-secrets-done")
+	}
+
+	unh := store.UntarHandler()
+	for _, ar := range archives {
+		var errMatch error
+		err := scanTarMembers(
+			store.AbsPath(ar.Path),
+			limit,
+			secrets[ar.Path], ids,
+			unh, ar.Path,
+			func(path string) {
+				lit, err := tarquote.UnquoteEscape(path)
+				if err != nil {
+					if errMatch == nil {
+						errMatch = err
+					}
+					return
+				}
+				name := trimMemberPath(lit)
+				if ok, _ := slashpath.Match(glob, name); !ok {
+					return
+				}
+				if quoteStyle == QsLiteral {
+					path = lit
+				}
+				fmt.Printf(
+					"%s %s: %s\n",
+					ar.Time.Format(time.RFC3339),
+					storePath(store, ar.Tspath),
+					path,
+				)
+			},
+		)
+		if err == nil && errMatch != nil {
+			err = fmt.Errorf("invalid tar member: %v", errMatch)
+		}
+		if err != nil {
+			lg.Fatalw(
+				"Listing tar failed.",
+				"archive", ar.Path,
+				"err", err,
+			)
+		}
+	}
+}
+
+// `gatherFindArchives()` returns all archives ordered by time.
+func (s *Store) gatherFindArchives(t *Tree) ([]FindArchive, error) {
+	var ars []FindArchive
+	err := s.WalkTree(t, func(inf TreeInfo) error {
+		tt, ok := inf.Node.(*TimeTree)
+		if !ok {
+			return nil
+		}
+		ars = append(ars, FindArchive{
+			Archive: Archive{
+				Path: slashpath.Join(
+					inf.Path, tt.TarType.Path(),
+				),
+				TarType: tt.TarType,
+			},
+			Time:   tt.Time,
+			Tspath: inf.Path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ars, func(i, j int) bool {
+		return ars[i].Time.Before(ars[j].Time)
+	})
+	return ars, nil
+}
+
+// `trimMemberPath()` removes the leading `./` and trailing `/` that tar uses
+// in member names, so that globs can be written as relative paths.
+func trimMemberPath(p string) string {
+	p = strings.TrimPrefix(p, "./")
+	p = strings.TrimPrefix(p, "/")
+	return strings.TrimSuffix(p, "/")
+}
@@ -2,20 +2,24 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	slashpath "path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 type GcOptions struct {
 	DryRun   bool
+	Explain  bool
 	LockWait time.Duration
 }
 
 func cmdGc(args map[string]interface{}) {
 	opts := GcOptions{
 		DryRun:   args["--dry-run"].(bool),
+		Explain:  args["--explain"].(bool),
 		LockWait: args["--lock-wait"].(time.Duration),
 	}
 
@@ -140,6 +144,18 @@ func gcGood(store *Store, opts GcOptions) {
 	if err != nil {
 		lg.Fatalw("Failed to list tree.", "err", err)
 	}
+	holds, err := store.LoadHolds()
+	if err != nil {
+		lg.Fatalw("Failed to load holds.", "err", err)
+	}
+	for _, h := range holds {
+		if tree.Find(h.Path) == nil {
+			lg.Warnw(
+				"Hold refers to missing archive.",
+				"path", storePath(store, h.Path),
+			)
+		}
+	}
 
 	now := time.Now().UTC()
 	latest := tree.MaxTime()
@@ -148,36 +164,76 @@ func gcGood(store *Store, opts GcOptions) {
 		"store", store.Name,
 		"latest", latest.Format(time.RFC3339),
 	)
+	plan := store.planRetention(tree, holds, now)
+
+	explain := func(decision string, inf TreeInfo, reasons []string) {
+		if !opts.Explain {
+			return
+		}
+		fmt.Printf(
+			"%-6s %s\t%s\n",
+			decision, storePath(store, inf.Path),
+			strings.Join(reasons, "; "),
+		)
+	}
 
 	gch := store.GcHandler()
 	gcIfExpired := func(inf TreeInfo) error {
 		t := inf.Node
 		tmax := t.MaxTime()
-		if t.Level().lifetime.AddTime(tmax).Before(now) {
-			if opts.DryRun {
-				lg.Warnw(
-					"Would remove level.",
-					"maxTime", tmax.Format(time.RFC3339),
-					"path", storePath(store, inf.Path),
-				)
-			} else {
-				if err := gch.RemoveAll(inf.Path); err != nil {
-					return err
-				}
+		lifetime := t.Level().lifetime
+		expires := lifetime.AddTime(tmax)
 
-				abspath := store.AbsPath(inf.Path)
-				if err := os.RemoveAll(abspath); err != nil {
-					return err
-				}
+		var reasons []string
+		if tmax == latest {
+			reasons = append(reasons, "contains latest")
+		}
+		if !expires.Before(now) {
+			reasons = append(reasons, fmt.Sprintf(
+				"lifetime %s until %s",
+				lifetime, expires.Format(time.RFC3339),
+			))
+		}
+		retained := plan.keepReasons(inf.Path, tmax)
+		reasons = append(reasons, retained...)
+		if len(reasons) > 0 {
+			explain("keep", inf, reasons)
+			if tmax != latest && expires.Before(now) {
 				lg.Infow(
-					"Removed level.",
-					"maxTime", tmax.Format(time.RFC3339),
+					"Kept expired archive by retention.",
 					"path", storePath(store, inf.Path),
+					"reason", strings.Join(retained, "; "),
 				)
 			}
-			return SkipTree
+			return nil
 		}
-		return nil
+
+		explain("remove", inf, []string{fmt.Sprintf(
+			"lifetime %s expired at %s",
+			lifetime, expires.Format(time.RFC3339),
+		)})
+		if opts.DryRun {
+			lg.Warnw(
+				"Would remove level.",
+				"maxTime", tmax.Format(time.RFC3339),
+				"path", storePath(store, inf.Path),
+			)
+		} else {
+			if err := gch.RemoveAll(inf.Path); err != nil {
+				return err
+			}
+
+			abspath := store.AbsPath(inf.Path)
+			if err := os.RemoveAll(abspath); err != nil {
+				return err
+			}
+			lg.Infow(
+				"Removed level.",
+				"maxTime", tmax.Format(time.RFC3339),
+				"path", storePath(store, inf.Path),
+			)
+		}
+		return SkipTree
 	}
 
 	gcLevel := func(inf TreeInfo) error {
@@ -186,14 +242,8 @@ func gcGood(store *Store, opts GcOptions) {
 				"Kept level that contains latest.",
 				"path", storePath(store, inf.Path),
 			)
-			return nil
 		}
-
-		if err := gcIfExpired(inf); err != nil {
-			return err
-		}
-
-		return nil
+		return gcIfExpired(inf)
 	}
 
 	cleanFrozenArchive := func(inf TreeInfo) error {
@@ -235,9 +285,14 @@ func gcGood(store *Store, opts GcOptions) {
 					"Kept full archive that contains latest.",
 					"path", storePath(store, inf.Path),
 				)
-			} else if err := gcIfExpired(inf); err != nil {
+			}
+			if err := gcIfExpired(inf); err != nil {
 				return err
 			}
+		} else {
+			// Archives below the root level are removed together
+			// with their level.
+			explain("keep", inf, []string{"level kept"})
 		}
 
 		if inf.LifeCycle == LcFrozen {
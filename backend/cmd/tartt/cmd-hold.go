@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// `holdsFile` is stored in the store directory, so that it is protected by
+// the same lock as the archives.
+const holdsFile = "holds.yml"
+
+// `Hold` is a legal hold on an archive.  `Path` is relative to the store, like
+// `TreeInfo.Path`.  `tartt gc` keeps the archive and its ancestors.
+type Hold struct {
+	Path   string `yaml:"path"`
+	Reason string `yaml:"reason"`
+	Time   string `yaml:"time"`
+}
+
+type holdsConfig struct {
+	Holds []Hold `yaml:"holds"`
+}
+
+type HoldOptions struct {
+	Reason   string
+	LockWait time.Duration
+}
+
+func (s *Store) LoadHolds() ([]Hold, error) {
+	dat, err := ioutil.ReadFile(filepath.Join(s.storeDir, holdsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg holdsConfig
+	if err := yaml.Unmarshal(dat, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg.Holds, nil
+}
+
+// `saveHolds()` replaces the holds file atomically.  It must be called while
+// holding the store lock.
+func (s *Store) saveHolds(holds []Hold) error {
+	path := filepath.Join(s.storeDir, holdsFile)
+	if len(holds) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	dat, err := yaml.Marshal(&holdsConfig{Holds: holds})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, dat, 0666); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func cmdHold(args map[string]interface{}) {
+	repo, err := OpenRepo(".")
+	if err != nil {
+		lg.Fatalw("Failed to open repo.", "err", err)
+	}
+	defer repo.Close()
+
+	if args["ls"].(bool) {
+		holdLs(os.Stdout, repo)
+		return
+	}
+
+	opts := HoldOptions{
+		LockWait: args["--lock-wait"].(time.Duration),
+	}
+	if reason, ok := args["--reason"].(string); ok {
+		opts.Reason = reason
+	}
+
+	// Group by store, preserving the order of the first occurrence.
+	var storeNames []string
+	paths := make(map[string][]string)
+	for _, tspath := range args["<tspaths>"].([]string) {
+		storeName, p, err := SplitStoreTspath(tspath)
+		if err != nil {
+			lg.Fatalw(
+				"Invalid tspath.",
+				"tspath", tspath,
+				"err", err,
+			)
+		}
+		if _, ok := paths[storeName]; !ok {
+			storeNames = append(storeNames, storeName)
+		}
+		paths[storeName] = append(paths[storeName], slashpath.Clean(p))
+	}
+
+	for _, n := range storeNames {
+		switch {
+		case args["add"].(bool):
+			holdAddStore(repo, n, paths[n], opts)
+		case args["rm"].(bool):
+			holdRmStore(repo, n, paths[n], opts)
+		}
+	}
+}
+
+func openLockedStore(repo *Repo, name string, lockWait time.Duration) *Store {
+	store, err := repo.OpenStore(name)
+	if err != nil {
+		lg.Fatalw("Failed to open store.", "store", name, "err", err)
+	}
+
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, lockWait)
+	defer cancel()
+	if err := store.TryLock(ctx); err != nil {
+		lg.Fatalw(
+			"Failed to lock store.",
+			"store", store.Dir(),
+			"err", err,
+		)
+	}
+	return store
+}
+
+func holdAddStore(
+	repo *Repo, storeName string, paths []string, opts HoldOptions,
+) {
+	store := openLockedStore(repo, storeName, opts.LockWait)
+	defer store.Close()
+	defer store.Unlock()
+
+	tree, err := store.LsTree()
+	if err != nil {
+		lg.Fatalw("Failed to list tree.", "err", err)
+	}
+	holds, err := store.LoadHolds()
+	if err != nil {
+		lg.Fatalw("Failed to load holds.", "err", err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	nAdded := 0
+	for _, p := range paths {
+		if _, ok := tree.Find(p).(*TimeTree); !ok {
+			lg.Fatalw(
+				"Unknown archive.",
+				"tspath", storePath(store, p),
+			)
+		}
+		if findHold(holds, p) >= 0 {
+			lg.Infow(
+				"Kept existing hold.",
+				"tspath", storePath(store, p),
+			)
+			continue
+		}
+		holds = append(holds, Hold{
+			Path:   p,
+			Reason: opts.Reason,
+			Time:   now,
+		})
+		nAdded++
+		lg.Infow("Added hold.", "tspath", storePath(store, p))
+	}
+
+	if nAdded == 0 {
+		return
+	}
+	if err := store.saveHolds(holds); err != nil {
+		lg.Fatalw("Failed to save holds.", "err", err)
+	}
+}
+
+func holdRmStore(
+	repo *Repo, storeName string, paths []string, opts HoldOptions,
+) {
+	store := openLockedStore(repo, storeName, opts.LockWait)
+	defer store.Close()
+	defer store.Unlock()
+
+	holds, err := store.LoadHolds()
+	if err != nil {
+		lg.Fatalw("Failed to load holds.", "err", err)
+	}
+
+	for _, p := range paths {
+		i := findHold(holds, p)
+		if i < 0 {
+			lg.Fatalw(
+				"Unknown hold.",
+				"tspath", storePath(store, p),
+			)
+		}
+		holds = append(holds[:i], holds[i+1:]...)
+		lg.Infow("Removed hold.", "tspath", storePath(store, p))
+	}
+
+	if err := store.saveHolds(holds); err != nil {
+		lg.Fatalw("Failed to save holds.", "err", err)
+	}
+}
+
+func findHold(holds []Hold, path string) int {
+	for i, h := range holds {
+		if h.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// `holdLs()` does not lock the stores, because `saveHolds()` replaces the
+// holds file atomically.
+func holdLs(w io.Writer, repo *Repo) {
+	for _, n := range repo.StoreNames() {
+		store, err := repo.OpenStore(n)
+		if err != nil {
+			lg.Fatalw(
+				"Failed to open store.",
+				"store", n, "err", err,
+			)
+		}
+		holds, err := store.LoadHolds()
+		_ = store.Close()
+		if err != nil {
+			lg.Fatalw(
+				"Failed to load holds.",
+				"store", n, "err", err,
+			)
+		}
+		for _, h := range holds {
+			fmt.Fprintf(
+				w, "%s %s\t%s\n",
+				h.Time, storePath(store, h.Path), h.Reason,
+			)
+		}
+	}
+}
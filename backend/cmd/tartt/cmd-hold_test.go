@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `newHoldTestRepo()` creates a repo with store `s` that contains the full
+// archives `tss`.
+func newHoldTestRepo(t *testing.T, tss ...string) (*Repo, string) {
+	dir, err := ioutil.TempDir("", "tartt-hold-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := fmt.Sprintf(`originDir: "%s"
+storesDir: "./stores"
+stores:
+  - name: "s"
+    driver: local
+    levels:
+      - { interval: "1 day", lifetime: "8 days" }
+      - { interval: "0", lifetime: "120 minutes" }
+`, dir)
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "tarttconfig.yml"), []byte(cfg), 0666,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range tss {
+		full := filepath.Join(dir, "stores", "s", ts, "full")
+		if err := os.MkdirAll(full, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := OpenRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, dir
+}
+
+func loadTestHolds(t *testing.T, repo *Repo) []Hold {
+	store, err := repo.OpenStore("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	holds, err := store.LoadHolds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return holds
+}
+
+func TestHoldAddRmLs(t *testing.T) {
+	ts1 := "20190101T000000Z"
+	ts2 := "20190102T000000Z"
+	repo, dir := newHoldTestRepo(t, ts1, ts2)
+	defer os.RemoveAll(dir)
+	defer repo.Close()
+
+	opts := HoldOptions{Reason: "case 1", LockWait: time.Second}
+	holdAddStore(repo, "s", []string{ts1, ts2}, opts)
+	holds := loadTestHolds(t, repo)
+	if len(holds) != 2 ||
+		holds[0].Path != ts1 || holds[1].Path != ts2 ||
+		holds[0].Reason != "case 1" || holds[0].Time == "" {
+		t.Fatalf("unexpected holds after add: %+v", holds)
+	}
+
+	// Adding an existing hold keeps the original reason.
+	holdAddStore(repo, "s", []string{ts1}, HoldOptions{
+		Reason: "case 2", LockWait: time.Second,
+	})
+	holds = loadTestHolds(t, repo)
+	if len(holds) != 2 || holds[0].Reason != "case 1" {
+		t.Errorf("expected existing hold to be kept, got %+v", holds)
+	}
+
+	var out bytes.Buffer
+	holdLs(&out, repo)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 ||
+		!strings.HasSuffix(lines[0], " s/"+ts1+"\tcase 1") ||
+		!strings.HasSuffix(lines[1], " s/"+ts2+"\tcase 1") {
+		t.Errorf("unexpected hold ls output %q", out.String())
+	}
+
+	holdRmStore(repo, "s", []string{ts1}, opts)
+	holds = loadTestHolds(t, repo)
+	if len(holds) != 1 || holds[0].Path != ts2 {
+		t.Errorf("unexpected holds after rm: %+v", holds)
+	}
+
+	// Removing the last hold removes the holds file.
+	holdRmStore(repo, "s", []string{ts2}, opts)
+	path := filepath.Join(dir, "stores", "s", holdsFile)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected holds file to be removed, got %v", err)
+	}
+	out.Reset()
+	holdLs(&out, repo)
+	if out.Len() != 0 {
+		t.Errorf("expected empty hold ls output, got %q", out.String())
+	}
+}
@@ -45,6 +45,8 @@ func cmdLsTar(args map[string]interface{}) {
 		limit = ratelimit.NewBucketWithRate(float64(v), 1024*1024)
 	}
 
+	ids := identitiesFromArgsMust(args)
+
 	repo, err := OpenRepo(".")
 	if err != nil {
 		lg.Fatalw("Failed to open repo.", "err", err)
@@ -97,7 +99,7 @@ func cmdLsTar(args map[string]interface{}) {
 	if args["--no-preload-secrets"].(bool) {
 		lg.Infow("Skipped preloading secrets.")
 	} else {
-		secrets = loadSecretsMust(store, archives)
+		secrets = loadSecretsMust(store, archives, ids)
 	}
 	if file, ok := args["--notify-preload-secrets-done"].(string); ok {
 		notifyFileMust(file, "preload-secrets-done")
@@ -108,7 +110,7 @@ func cmdLsTar(args map[string]interface{}) {
 		err := lsTar(
 			store.AbsPath(ar.Path),
 			limit,
-			secrets[ar.Path],
+			secrets[ar.Path], ids,
 			unh, ar.Path,
 			quoteStyle, eol,
 		)
@@ -122,11 +124,73 @@ func lsTar(
 	archive string,
 	limit *ratelimit.Bucket,
 	secret string,
+	ids *Identities,
 	unh drivers.UntarHandler,
 	arRel string,
 	quoteStyle QuoteStyle,
 	eol rune,
 ) error {
+	var errPrint error
+	err := scanTarMembers(
+		archive, limit, secret, ids, unh, arRel,
+		func(path string) {
+			path, err := quoteMember(path, quoteStyle)
+			if err != nil && errPrint == nil {
+				errPrint = err
+			}
+			fmt.Printf("%s: %s%c", arRel, path, eol)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if errPrint != nil {
+		return fmt.Errorf("failed to print tar member: %v", errPrint)
+	}
+	return nil
+}
+
+// `quoteMember()` converts a tar member name from quoting style "escape" to
+// `quoteStyle`.  On error, it returns a placeholder for printing.
+func quoteMember(path string, quoteStyle QuoteStyle) (string, error) {
+	switch quoteStyle {
+	case QsEscaped:
+		// `path` is already escaped.
+		return path, nil
+	case QsLiteral:
+		lit, err := tarquote.UnquoteEscape(path)
+		if err != nil {
+			return "<INVALID TAR-QUOTED PATH> " + lit, err
+		}
+		return lit, nil
+	default:
+		panic("invalid quoteStyle")
+	}
+}
+
+// `scanTarMembers()` calls `fn` for each tar member name, quoted in style
+// "escape".  It uses the member catalog if the archive has one.  Otherwise,
+// it uses `out.log` in the archive metadata.
+func scanTarMembers(
+	archive string,
+	limit *ratelimit.Bucket,
+	secret string,
+	ids *Identities,
+	unh drivers.UntarHandler,
+	arRel string,
+	fn func(path string),
+) error {
+	catalog, err := loadCatalog(archive, secret, ids, unh, arRel)
+	if err != nil {
+		return err
+	}
+	if catalog != nil {
+		for _, e := range catalog.Entries {
+			fn(tarquote.QuoteEscape(e.Name))
+		}
+		return nil
+	}
+
 	// Use `os.Pipe()` to copy data directly between sub-processes and not
 	// through `tartt`, unless needed for rate limiting.
 	//
@@ -141,9 +205,7 @@ func lsTar(
 	// only `tartt-store`.  In the future, the command may depend on the
 	// store driver.
 	loadArgs := []string{"load"}
-	if secret != "" {
-		loadArgs = append(loadArgs, "--secret-stdin")
-	}
+	loadArgs = append(loadArgs, ids.LoadArgs(secret)...)
 	loadArgs = append(loadArgs,
 		"metadata.tar",
 	)
@@ -186,31 +248,11 @@ func lsTar(
 		return err
 	}
 
-	var errPrint error
 	tarLines := bufio.NewScanner(tarStdout)
 	for tarLines.Scan() {
-		path := tarLines.Text()
-		switch quoteStyle {
-		case QsEscaped:
-			// `path` is already escaped.
-		case QsLiteral:
-			lit, err := tarquote.UnquoteEscape(path)
-			if err != nil {
-				path = "<INVALID TAR-QUOTED PATH> " + lit
-				if errPrint == nil {
-					errPrint = err
-				}
-			} else {
-				path = lit
-			}
-		default:
-			panic("invalid quoteStyle")
-		}
-		fmt.Printf("%s: %s%c", arRel, path, eol)
-	}
-	if err := tarLines.Err(); errPrint == nil {
-		errPrint = err
+		fn(tarLines.Text())
 	}
+	errScan := tarLines.Err()
 
 	errLoad := loadCmd.Wait()
 	if err := loadTarPipe.CloseW(); errLoad == nil {
@@ -225,8 +267,8 @@ func lsTar(
 	if errTar != nil {
 		return fmt.Errorf("untar `out.log` failed: %v", errTar)
 	}
-	if errPrint != nil {
-		return fmt.Errorf("failed to print tar member: %v", errPrint)
+	if errScan != nil {
+		return fmt.Errorf("failed to scan `out.log`: %v", errScan)
 	}
 
 	return nil
@@ -3,16 +3,20 @@ package main
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 type LsOptions struct {
-	Lock bool
+	Lock    bool
+	Compare bool
 }
 
 func cmdLs(args map[string]interface{}) {
 	opts := LsOptions{
-		Lock: !args["--no-lock"].(bool),
+		Lock:    !args["--no-lock"].(bool),
+		Compare: args["--compare"].(bool),
 	}
 
 	repo, err := OpenRepo(".")
@@ -21,6 +25,11 @@ func cmdLs(args map[string]interface{}) {
 	}
 	defer repo.Close()
 
+	if opts.Compare {
+		lsCompare(repo, opts)
+		return
+	}
+
 	for _, n := range repo.StoreNames() {
 		lsStore(repo, n, opts)
 	}
@@ -33,6 +42,37 @@ func lsStore(repo *Repo, storeName string, opts LsOptions) {
 	}
 	defer store.Close()
 
+	tree := lsStoreTree(store, opts)
+
+	if err := store.WalkTree(tree, func(inf TreeInfo) error {
+		fmt.Printf("%s", inf.LifeCycle.Letter())
+		switch x := inf.Node.(type) {
+		case *LevelTree:
+			fmt.Printf(" %d", len(x.Times))
+			fmt.Printf(" %5s", x.Level().Name())
+		case *TimeTree:
+			fmt.Printf(" %d", len(x.SubLevels))
+			fmt.Printf(" %5s", x.TarType.Path())
+		}
+		fmt.Printf(
+			"  %s %s",
+			inf.Node.MinTime().Format(time.RFC3339),
+			inf.Node.MaxTime().Format(time.RFC3339),
+		)
+		if inf.Path == "" {
+			fmt.Printf("\t%s\n", storeName)
+		} else {
+			fmt.Printf("\t%s/%s\n", storeName, inf.Path)
+		}
+		return nil
+	}); err != nil {
+		lg.Fatalw("ls failed.", "err", err)
+	}
+}
+
+// `lsStoreTree()` lists the store tree, holding the store lock only while
+// listing if `opts.Lock`.
+func lsStoreTree(store *Store, opts LsOptions) *Tree {
 	// Listing without lock MUST be safe with concurrent operations that
 	// only append to the store, like archive.  It MAY be unsafe with
 	// concurrent operations that may delete content, like gc.  If in
@@ -56,29 +96,73 @@ func lsStore(repo *Repo, storeName string, opts LsOptions) {
 	if err != nil {
 		lg.Fatalw("Failed to list tree.", "err", err)
 	}
+	return tree
+}
 
-	if err := store.WalkTree(tree, func(inf TreeInfo) error {
-		fmt.Printf("%s", inf.LifeCycle.Letter())
-		switch x := inf.Node.(type) {
-		case *LevelTree:
-			fmt.Printf(" %d", len(x.Times))
-			fmt.Printf(" %5s", x.Level().Name())
-		case *TimeTree:
-			fmt.Printf(" %d", len(x.SubLevels))
-			fmt.Printf(" %5s", x.TarType.Path())
+// `lsCompare()` prints the union of the archives in all stores, one per line,
+// with a column per store in config order that indicates whether the archive
+// is present `+` or missing `-` in the store.
+func lsCompare(repo *Repo, opts LsOptions) {
+	type archiveInfo struct {
+		tarType TarType
+		time    time.Time
+		stores  map[string]bool
+	}
+	archives := make(map[string]*archiveInfo)
+
+	names := repo.StoreNames()
+	for _, n := range names {
+		store, err := repo.OpenStore(n)
+		if err != nil {
+			lg.Fatalw("Failed to open store.", "err", err)
+		}
+		tree := lsStoreTree(store, opts)
+		err = store.WalkTree(tree, func(inf TreeInfo) error {
+			t, ok := inf.Node.(*TimeTree)
+			if !ok {
+				return nil
+			}
+			ar, ok := archives[inf.Path]
+			if !ok {
+				ar = &archiveInfo{
+					tarType: t.TarType,
+					time:    t.Time,
+					stores:  make(map[string]bool),
+				}
+				archives[inf.Path] = ar
+			}
+			ar.stores[n] = true
+			return nil
+		})
+		store.Close()
+		if err != nil {
+			lg.Fatalw("ls failed.", "err", err)
+		}
+	}
+
+	// Tspaths sort by time, with parents before their patches.
+	paths := make([]string, 0, len(archives))
+	for p := range archives {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		ar := archives[p]
+		marks := make([]string, 0, len(names))
+		for _, n := range names {
+			if ar.stores[n] {
+				marks = append(marks, "+"+n)
+			} else {
+				marks = append(marks, "-"+n)
+			}
 		}
 		fmt.Printf(
-			"  %s %s",
-			inf.Node.MinTime().Format(time.RFC3339),
-			inf.Node.MaxTime().Format(time.RFC3339),
+			"%s %5s  %s\t%s\n",
+			strings.Join(marks, " "),
+			ar.tarType.Path(),
+			ar.time.Format(time.RFC3339),
+			p,
 		)
-		if inf.Path == "" {
-			fmt.Printf("\t%s\n", storeName)
-		} else {
-			fmt.Printf("\t%s/%s\n", storeName, inf.Path)
-		}
-		return nil
-	}); err != nil {
-		lg.Fatalw("ls failed.", "err", err)
 	}
 }
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/openpgpx"
+)
+
+type RekeyOptions struct {
+	Recipients       []string
+	NativeRecipients bool
+	DryRun           bool
+	LockWait         time.Duration
+}
+
+// `SecretEncrypter` writes an ASCII-armored secret.
+type SecretEncrypter func(w io.Writer, secret string) error
+
+// `RekeyArchive` is an archive whose secret may need re-encryption.  `Path`
+// is the tspath, starting with the store name.  `Dir` is the absolute path
+// of the archive directory that contains `secret.asc`.
+type RekeyArchive struct {
+	Path string
+	Dir  string
+}
+
+func cmdRekey(args map[string]interface{}) {
+	opts := RekeyOptions{
+		Recipients:       args["--recipient"].([]string),
+		NativeRecipients: args["--native-recipients"].(bool),
+		DryRun:           args["--dry-run"].(bool),
+		LockWait:         args["--lock-wait"].(time.Duration),
+	}
+	ids := identitiesFromArgsMust(args)
+
+	repo, err := OpenRepo(".")
+	if err != nil {
+		lg.Fatalw("Failed to open repo.", "err", err)
+	}
+	defer repo.Close()
+
+	var keys GpgRecipientKeys
+	var encrypt SecretEncrypter
+	if opts.NativeRecipients {
+		to, err := repo.NativeRecipients()
+		if err != nil {
+			lg.Fatalw("Failed to load native recipients.", "err", err)
+		}
+		keys = nativeRecipientKeys(to)
+		encrypt = nativeSecretEncrypter(to)
+	} else {
+		keys, err = gpgRecipientKeys(opts.Recipients)
+		if err != nil {
+			lg.Fatalw("Failed to resolve recipients.", "err", err)
+		}
+		encrypt = gpgSecretEncrypter(opts.Recipients)
+	}
+
+	// Lock all stores before gathering archives, so that the list remains
+	// valid until the rekey has completed.
+	trees := make(map[string]*Tree)
+	stores := make(map[string]*Store)
+	for _, n := range repo.StoreNames() {
+		store, err := repo.OpenStore(n)
+		if err != nil {
+			lg.Fatalw("Failed to open store.", "err", err)
+		}
+		defer store.Close()
+
+		ctx := context.Background()
+		ctx, cancel := context.WithTimeout(ctx, opts.LockWait)
+		if err := store.TryLock(ctx); err != nil {
+			cancel()
+			lg.Fatalw(
+				"Failed to lock store.",
+				"store", store.Dir(),
+				"err", err,
+			)
+		}
+		cancel()
+		defer store.Unlock()
+
+		tree, err := store.LsTreeSelect(TarTypesAll)
+		if err != nil {
+			lg.Fatalw(
+				"Failed to list tree.",
+				"store", n,
+				"err", err,
+			)
+		}
+		stores[n] = store
+		trees[n] = tree
+	}
+
+	var archives []RekeyArchive
+	if tsps := args["<tspaths>"].([]string); len(tsps) > 0 {
+		for _, tsp := range tsps {
+			storeName, p, err := SplitStoreTspath(tsp)
+			if err != nil {
+				lg.Fatalw("Invalid path.", "tspath", tsp)
+			}
+			store, ok := stores[storeName]
+			if !ok {
+				lg.Fatalw("Unknown store.", "tspath", tsp)
+			}
+			tt, ok := trees[storeName].Find(p).(*TimeTree)
+			if !ok {
+				lg.Fatalw("Not a archive.", "tspath", tsp)
+			}
+			archives = append(archives, RekeyArchive{
+				Path: storePath(store, p),
+				Dir: filepath.Join(
+					store.AbsPath(p), tt.TarType.Path(),
+				),
+			})
+		}
+	} else {
+		for _, n := range repo.StoreNames() {
+			ars, err := gatherRekeyArchives(stores[n], trees[n])
+			if err != nil {
+				lg.Fatalw(
+					"Failed to gather archives.",
+					"store", n,
+					"err", err,
+				)
+			}
+			archives = append(archives, ars...)
+		}
+	}
+
+	var nRekeyed, nUpToDate, nPlaintext int
+	for i, ar := range archives {
+		progress := fmt.Sprintf("%d/%d", i+1, len(archives))
+		secret := filepath.Join(ar.Dir, "secret.asc")
+		if !exists(secret) {
+			lg.Infow(
+				"Skipped archive without encrypted secret.",
+				"progress", progress,
+				"tspath", ar.Path,
+			)
+			nPlaintext++
+			continue
+		}
+
+		keyIds, err := secretKeyIds(secret)
+		if err != nil {
+			lg.Fatalw(
+				"Failed to list secret recipients.",
+				"tspath", ar.Path,
+				"err", err,
+			)
+		}
+		if keys.Match(keyIds) {
+			lg.Infow(
+				"Secret is up to date.",
+				"progress", progress,
+				"tspath", ar.Path,
+			)
+			nUpToDate++
+			continue
+		}
+
+		if opts.DryRun {
+			lg.Infow(
+				"Would rekey secret.",
+				"progress", progress,
+				"tspath", ar.Path,
+				"keyIds", strings.Join(keyIds, ","),
+			)
+			nRekeyed++
+			continue
+		}
+
+		if err := rekeySecret(secret, ids, encrypt, keys); err != nil {
+			lg.Fatalw(
+				"Failed to rekey secret.",
+				"tspath", ar.Path,
+				"err", err,
+			)
+		}
+		lg.Infow(
+			"Rekeyed secret.",
+			"progress", progress,
+			"tspath", ar.Path,
+		)
+		nRekeyed++
+	}
+
+	msg := "Completed rekey."
+	if opts.DryRun {
+		msg = "Completed rekey dry run."
+	}
+	lg.Infow(
+		msg,
+		"archives", len(archives),
+		"rekeyed", nRekeyed,
+		"upToDate", nUpToDate,
+		"plaintext", nPlaintext,
+	)
+}
+
+func gatherRekeyArchives(store *Store, tree *Tree) ([]RekeyArchive, error) {
+	var ars []RekeyArchive
+	err := store.WalkTree(tree, func(inf TreeInfo) error {
+		switch t := inf.Node.(type) {
+		case *LevelTree:
+			return nil
+		case *TimeTree:
+			ars = append(ars, RekeyArchive{
+				Path: storePath(store, inf.Path),
+				Dir: filepath.Join(
+					store.AbsPath(inf.Path), t.TarType.Path(),
+				),
+			})
+			return nil
+		default:
+			panic("invalid tree node")
+		}
+	})
+	return ars, err
+}
+
+// `rekeySecret()` decrypts the secret, encrypts it to the new recipients in a
+// temporary file, verifies the recipients of the temporary file, and then
+// atomically replaces the secret.
+func rekeySecret(
+	path string,
+	ids *Identities,
+	encrypt SecretEncrypter,
+	keys GpgRecipientKeys,
+) error {
+	secret, err := ids.DecryptSecret(path)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %v", err)
+	}
+	if secret == "" {
+		return errors.New("empty secret")
+	}
+
+	tmp := fmt.Sprintf("%s.rekey", path)
+	fp, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+		_ = os.Remove(tmp)
+	}()
+	if err := encrypt(fp, secret); err != nil {
+		return fmt.Errorf("failed to encrypt: %v", err)
+	}
+	if err := fp.Sync(); err != nil {
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+
+	keyIds, err := secretKeyIds(tmp)
+	if err != nil {
+		return err
+	}
+	if !keys.Match(keyIds) {
+		return fmt.Errorf(
+			"verification failed: unexpected recipient key ids %s",
+			strings.Join(keyIds, ","),
+		)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// `syncDir()` fsyncs a directory, so that a preceding rename is durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// `GpgRecipientKeys` contains for each recipient the long key ids of its
+// valid encryption keys.
+type GpgRecipientKeys [][]string
+
+// `Match()` tells whether a secret that is encrypted to `keyIds` is encrypted
+// to exactly the recipients: to at least one key of each recipient and to no
+// other key.
+func (rs GpgRecipientKeys) Match(keyIds []string) bool {
+	have := make(map[string]bool)
+	for _, id := range keyIds {
+		have[id] = true
+	}
+	known := make(map[string]bool)
+	for _, ids := range rs {
+		found := false
+		for _, id := range ids {
+			known[id] = true
+			if have[id] {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, id := range keyIds {
+		if !known[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func gpgSecretEncrypter(gpgIds []string) SecretEncrypter {
+	return func(w io.Writer, secret string) error {
+		return encryptSecret(w, secret, gpgIds)
+	}
+}
+
+func gpgRecipientKeys(gpgIds []string) (GpgRecipientKeys, error) {
+	rs := make(GpgRecipientKeys, 0, len(gpgIds))
+	for _, r := range gpgIds {
+		ids, err := gpgEncryptionKeyIds(r)
+		if err != nil {
+			return nil, fmt.Errorf("recipient `%s`: %v", r, err)
+		}
+		rs = append(rs, ids)
+	}
+	return rs, nil
+}
+
+// `gpgEncryptionKeyIds()` lists the valid encryption keys of a recipient.
+//
+// `parseGpgEncryptionKeyIds()` parses `gpg --with-colons` records `pub` and
+// `sub`.  Field 2 is the validity, field 5 the long key id, and field 12 the
+// key capabilities; lowercase `e` indicates that the key itself can encrypt.
+func gpgEncryptionKeyIds(gpgId string) ([]string, error) {
+	gpgArgs := []string{
+		"--batch",
+		"--with-colons",
+		"--list-keys", "--", gpgId,
+	}
+	gpgCmd := exec.Command(gpg2Tool().Path, gpgArgs...)
+	gpgCmd.Stderr = os.Stderr
+	out, err := gpgCmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseGpgEncryptionKeyIds(string(out))
+}
+
+func parseGpgEncryptionKeyIds(out string) ([]string, error) {
+	var ids []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 12 {
+			continue
+		}
+		switch fields[0] {
+		case "pub", "sub":
+		default:
+			continue
+		}
+		switch fields[1] {
+		case "i", "d", "r", "e":
+			continue // invalid, disabled, revoked, or expired.
+		}
+		if !strings.Contains(fields[11], "e") {
+			continue
+		}
+		ids = append(ids, strings.ToUpper(fields[4]))
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no valid encryption key")
+	}
+	return ids, nil
+}
+
+// `secretKeyIds()` lists the key ids to which a secret is encrypted without
+// decrypting it.
+func secretKeyIds(path string) ([]string, error) {
+	keyIds, err := openpgpx.EncryptedKeyIdsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(keyIds))
+	for _, id := range keyIds {
+		ids = append(ids, openpgpx.FormatKeyId(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	cfg := &packet.Config{RSABits: 1024}
+	e, err := openpgp.NewEntity(name, "", name+"@example.org", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// `SerializePrivate()` signs the identities and subkeys.
+	if err := e.SerializePrivate(ioutil.Discard, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestGpgRecipientKeysMatch(t *testing.T) {
+	rs := GpgRecipientKeys{{"A1", "A2"}, {"B1"}}
+	for _, c := range []struct {
+		keyIds []string
+		match  bool
+	}{
+		{[]string{"A1", "B1"}, true},
+		{[]string{"A2", "B1"}, true},
+		{[]string{"A1", "A2", "B1"}, true},
+		{[]string{"A1"}, false},
+		{[]string{"B1"}, false},
+		{[]string{"A1", "B1", "C1"}, false},
+		{nil, false},
+	} {
+		if got := rs.Match(c.keyIds); got != c.match {
+			t.Errorf(
+				"%v: expected %v, got %v", c.keyIds, c.match, got,
+			)
+		}
+	}
+}
+
+func TestParseGpgEncryptionKeyIds(t *testing.T) {
+	out := `tru::1:1600000000:0:3:1:5
+pub:u:2048:1:aaaa000000000001:1600000000:::u:::scESC::::::23::0:
+fpr:::::::::0000000000000000000000000000AAAA000000000001:
+uid:u::::1600000000::0000::Alice <alice@example.org>::::::::::0:
+sub:u:2048:1:bbbb000000000002:1600000000::::::e::::::23:
+sub:r:2048:1:cccc000000000003:1600000000::::::e::::::23:
+sub:e:2048:1:dddd000000000004:1600000000::::::e::::::23:
+sub:u:2048:1:eeee000000000005:1600000000::::::s::::::23:
+`
+	ids, err := parseGpgEncryptionKeyIds(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"BBBB000000000002"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	if _, err := parseGpgEncryptionKeyIds("tru::1\n"); err == nil {
+		t.Error("expected error without encryption key")
+	}
+}
+
+func TestRekeySecret(t *testing.T) {
+	alice := newTestEntity(t, "alice")
+	bob := newTestEntity(t, "bob")
+	eve := newTestEntity(t, "eve")
+
+	dir, err := ioutil.TempDir("", "tartt-rekey-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret.asc")
+
+	secret, err := newNativeArmoredSecret(path, openpgp.EntityList{alice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceIds := &Identities{Keys: openpgp.EntityList{alice}}
+	bobIds := &Identities{Keys: openpgp.EntityList{bob}}
+
+	// Verification fails if the encrypter does not match the recipient
+	// keys.  The secret must be unchanged.
+	err = rekeySecret(
+		path, aliceIds,
+		nativeSecretEncrypter(openpgp.EntityList{eve}),
+		nativeRecipientKeys(openpgp.EntityList{bob}),
+	)
+	if err == nil {
+		t.Fatal("expected verification error")
+	}
+	got, err := aliceIds.DecryptSecret(path)
+	if err != nil || got != secret {
+		t.Fatalf("expected unchanged secret, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(path + ".rekey"); !os.IsNotExist(err) {
+		t.Errorf("expected temporary file to be removed, got %v", err)
+	}
+
+	to := openpgp.EntityList{bob}
+	err = rekeySecret(
+		path, aliceIds,
+		nativeSecretEncrypter(to), nativeRecipientKeys(to),
+	)
+	if err != nil {
+		t.Fatalf("rekeySecret() failed: %v", err)
+	}
+	got, err = bobIds.DecryptSecret(path)
+	if err != nil || got != secret {
+		t.Errorf("expected new recipient to decrypt: %q, %v", got, err)
+	}
+	if _, err := aliceIds.DecryptSecret(path); err == nil {
+		t.Error("expected old recipient to fail")
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReplicateOptions struct {
+	From     string
+	To       string
+	DryRun   bool
+	LockWait time.Duration
+}
+
+// `ManifestEntry` is the expected size and SHA-256 of a file that is listed
+// in `manifest.shasums`.
+type ManifestEntry struct {
+	Size   int64
+	Sha256 string
+}
+
+func cmdReplicate(args map[string]interface{}) {
+	opts := ReplicateOptions{
+		From:     args["--from"].(string),
+		To:       args["--to"].(string),
+		DryRun:   args["--dry-run"].(bool),
+		LockWait: args["--lock-wait"].(time.Duration),
+	}
+	if opts.From == opts.To {
+		lg.Fatalw("--from and --to must be different stores.")
+	}
+
+	repo, err := OpenRepo(".")
+	if err != nil {
+		lg.Fatalw("Failed to open repo.", "err", err)
+	}
+	defer repo.Close()
+
+	// Lock both stores, so that gc cannot delete archives while they are
+	// being copied.
+	var stores [2]*Store
+	var trees [2]*Tree
+	for i, n := range []string{opts.From, opts.To} {
+		store, err := repo.OpenStore(n)
+		if err != nil {
+			lg.Fatalw(
+				"Failed to open store.",
+				"store", n,
+				"err", err,
+			)
+		}
+		defer store.Close()
+
+		ctx := context.Background()
+		ctx, cancel := context.WithTimeout(ctx, opts.LockWait)
+		if err := store.TryLock(ctx); err != nil {
+			cancel()
+			lg.Fatalw(
+				"Failed to lock store.",
+				"store", store.Dir(),
+				"err", err,
+			)
+		}
+		cancel()
+		defer store.Unlock()
+
+		tree, err := store.LsTree()
+		if err != nil {
+			lg.Fatalw(
+				"Failed to list tree.",
+				"store", n,
+				"err", err,
+			)
+		}
+		stores[i] = store
+		trees[i] = tree
+	}
+	src, dst := stores[0], stores[1]
+	srcTree, dstTree := trees[0], trees[1]
+
+	if !src.HasSameLevels(dst) {
+		lg.Fatalw(
+			"Stores have different levels.",
+			"from", src.Name,
+			"to", dst.Name,
+		)
+	}
+
+	// The walk visits a full archive before its patches, so that the
+	// parent of a patch has always been replicated before the patch.
+	var archives []Archive
+	var nPresent int
+	if err := src.WalkTree(srcTree, func(inf TreeInfo) error {
+		t, ok := inf.Node.(*TimeTree)
+		if !ok {
+			return nil
+		}
+		if _, ok := dstTree.Find(inf.Path).(*TimeTree); ok {
+			nPresent++
+			return nil
+		}
+		archives = append(archives, Archive{
+			Path:    inf.Path,
+			TarType: t.TarType,
+		})
+		return nil
+	}); err != nil {
+		lg.Fatalw("Failed to walk tree.", "err", err)
+	}
+
+	for i, ar := range archives {
+		progress := fmt.Sprintf("%d/%d", i+1, len(archives))
+		from := storePath(src, ar.Path)
+		to := storePath(dst, ar.Path)
+		if opts.DryRun {
+			lg.Infow(
+				"Would replicate archive.",
+				"progress", progress,
+				"from", from,
+				"to", to,
+			)
+			continue
+		}
+
+		if err := replicateArchive(src, dst, ar); err != nil {
+			lg.Fatalw(
+				"Failed to replicate archive.",
+				"from", from,
+				"to", to,
+				"err", err,
+			)
+		}
+		lg.Infow(
+			"Replicated archive.",
+			"progress", progress,
+			"from", from,
+			"to", to,
+		)
+	}
+
+	msg := "Completed replicate."
+	if opts.DryRun {
+		msg = "Completed replicate dry run."
+	}
+	lg.Infow(
+		msg,
+		"from", src.Name,
+		"to", dst.Name,
+		"replicated", len(archives),
+		"present", nPresent,
+	)
+}
+
+// `replicateArchive()` copies an archive from `src` to `dst` using the same
+// transaction as `tartt tar`.  Files that are listed in the manifest are
+// verified while copying.  The data files are read from and written to the
+// driver data directories; all other files are copied between the local
+// archive directories.
+func replicateArchive(src, dst *Store, ar Archive) error {
+	arRel := slashpath.Join(ar.Path, ar.TarType.Path())
+	srcDir := src.AbsPath(arRel)
+	srcData := src.ReplicateHandler().DataDir(arRel, srcDir)
+
+	manifest, err := parseManifest(
+		filepath.Join(srcDir, "manifest.shasums"),
+	)
+	if err != nil {
+		return err
+	}
+
+	dstDir := dst.AbsPath(arRel)
+	tmp, err := mkdirArchiveInProgress(dstDir)
+	if err != nil {
+		return err
+	}
+
+	// On failure, remove the partial copy, including the new `<ts>`
+	// directory, so that a later replicate can retry.
+	ok := false
+	defer func() {
+		if !ok {
+			_ = os.RemoveAll(tmp)
+			_ = os.Remove(filepath.Dir(tmp))
+		}
+	}()
+
+	har, err := dst.ArchiveHandler().BeginArchive(arRel, tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !ok {
+			_ = har.Abort()
+		}
+	}()
+
+	isData := func(name string) bool {
+		_, listed := manifest[name]
+		return listed && !isLocalManifestFile(name)
+	}
+
+	locals, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range locals {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || isData(name) {
+			continue
+		}
+		if err := cpVerify(
+			filepath.Join(srcDir, name),
+			filepath.Join(tmp, name),
+			manifest,
+		); err != nil {
+			return err
+		}
+	}
+
+	dstData := har.DataDir()
+	for name := range manifest {
+		if !isData(name) {
+			continue
+		}
+		if err := cpVerify(
+			filepath.Join(srcData, name),
+			filepath.Join(dstData, name),
+			manifest,
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := har.Commit(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dstDir); err != nil {
+		return err
+	}
+	ok = true
+	return nil
+}
+
+// `isLocalManifestFile()` tells whether a file that is listed in the manifest
+// is stored in the local archive directory instead of the driver data
+// directory.
+func isLocalManifestFile(name string) bool {
+	return name == "README.md" ||
+		strings.HasSuffix(name, ".catalog") ||
+		strings.HasSuffix(name, ".catalog.gpg")
+}
+
+// `parseManifest()` reads the `size:` and `sha256:` lines of a
+// `manifest.shasums`.
+func parseManifest(path string) (map[string]ManifestEntry, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fp.Close() }()
+
+	entries := make(map[string]ManifestEntry)
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		line := s.Text()
+		malformed := fmt.Errorf("malformed manifest line `%s`", line)
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 {
+			return nil, malformed
+		}
+		kv := strings.SplitN(fields[0], ":", 2)
+		if len(kv) != 2 {
+			return nil, malformed
+		}
+		name := fields[1]
+		e := entries[name]
+		switch kv[0] {
+		case "size":
+			n, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				err := fmt.Errorf("invalid size for `%s`", name)
+				return nil, err
+			}
+			e.Size = n
+		case "sha256":
+			e.Sha256 = kv[1]
+		default:
+			continue // Ignore other hashes.
+		}
+		entries[name] = e
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for name, e := range entries {
+		if e.Sha256 == "" {
+			return nil, fmt.Errorf("missing sha256 for `%s`", name)
+		}
+	}
+	return entries, nil
+}
+
+// `cpVerify()` copies `src` to `dst`.  If the file is listed in `manifest`,
+// it verifies the size and SHA-256 of the content that was read from `src`
+// and of the content that is read back from `dst` after the copy.
+func cpVerify(src, dst string, manifest map[string]ManifestEntry) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	e, ok := manifest[filepath.Base(src)]
+	if !ok {
+		return nil
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := checkManifestEntry(src, e, n, sum); err != nil {
+		return err
+	}
+
+	n, sum, err = fileSizeSha256(dst)
+	if err != nil {
+		return err
+	}
+	return checkManifestEntry(dst, e, n, sum)
+}
+
+func checkManifestEntry(
+	path string, e ManifestEntry, size int64, sum string,
+) error {
+	if size != e.Size {
+		return fmt.Errorf(
+			"size mismatch for `%s`: expected %d, got %d",
+			path, e.Size, size,
+		)
+	}
+	if sum != e.Sha256 {
+		return fmt.Errorf("sha256 mismatch for `%s`", path)
+	}
+	return nil
+}
+
+// `fileSizeSha256()` reads `path` and returns its size and hex SHA-256.
+func fileSizeSha256(path string) (int64, string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = fp.Close() }()
+	h := sha256.New()
+	n, err := io.Copy(h, fp)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
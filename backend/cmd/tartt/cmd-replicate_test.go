@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nogproject/nog/backend/cmd/tartt/driver_local"
+)
+
+func newLocalTestStore(t *testing.T, name string) *Store {
+	dir, err := ioutil.TempDir("", "tartt-replicate-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &driver_local.Driver{}
+	return &Store{Name: name, storeDir: dir, driver: d, handle: d}
+}
+
+// `writeTestArchive()` writes the files to `dir` and lists the files from
+// `manifested` in `manifest.shasums`.
+func writeTestArchive(
+	t *testing.T, dir string, files map[string]string, manifested []string,
+) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(
+			filepath.Join(dir, name), []byte(content), 0666,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lines []string
+	for _, name := range manifested {
+		sum := sha256.Sum256([]byte(files[name]))
+		lines = append(lines,
+			fmt.Sprintf("size:%d  %s", len(files[name]), name),
+			fmt.Sprintf("sha256:%x  %s", sum, name),
+		)
+	}
+	err := ioutil.WriteFile(
+		filepath.Join(dir, "manifest.shasums"),
+		[]byte(strings.Join(lines, "\n")+"\n"), 0666,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lsDir(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReplicateArchive(t *testing.T) {
+	src := newLocalTestStore(t, "src")
+	defer os.RemoveAll(src.storeDir)
+	dst := newLocalTestStore(t, "dst")
+	defer os.RemoveAll(dst.storeDir)
+
+	ar := Archive{Path: "s0/2019-01-02T030405Z", TarType: TarFull}
+	files := map[string]string{
+		"data.tar.gpg": "data",
+		"README.md":    "readme",
+		"secret.asc":   "secret",
+	}
+	writeTestArchive(
+		t, src.AbsPath("s0/2019-01-02T030405Z/full"),
+		files, []string{"data.tar.gpg", "README.md"},
+	)
+
+	if err := replicateArchive(src, dst, ar); err != nil {
+		t.Fatalf("replicateArchive() failed: %v", err)
+	}
+
+	dstDir := dst.AbsPath("s0/2019-01-02T030405Z/full")
+	expected := []string{
+		"README.md", "data.tar.gpg", "manifest.shasums", "secret.asc",
+	}
+	if got := lsDir(t, dstDir); strings.Join(got, ",") !=
+		strings.Join(expected, ",") {
+		t.Errorf("expected files %v, got %v", expected, got)
+	}
+	for name, content := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dstDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	ts := dst.AbsPath("s0/2019-01-02T030405Z")
+	if got := lsDir(t, ts); len(got) != 1 || got[0] != "full" {
+		t.Errorf("expected only `full` in %s, got %v", ts, got)
+	}
+
+	// A second replicate must not overwrite the existing archive.
+	if err := replicateArchive(src, dst, ar); err == nil {
+		t.Error("expected error for existing archive")
+	}
+}
+
+func TestReplicateArchiveChecksumMismatch(t *testing.T) {
+	src := newLocalTestStore(t, "src")
+	defer os.RemoveAll(src.storeDir)
+	dst := newLocalTestStore(t, "dst")
+	defer os.RemoveAll(dst.storeDir)
+
+	srcDir := src.AbsPath("s0/2019-01-02T030405Z/full")
+	writeTestArchive(
+		t, srcDir,
+		map[string]string{"data.tar.gpg": "data"},
+		[]string{"data.tar.gpg"},
+	)
+	// Same size, different content.
+	err := ioutil.WriteFile(
+		filepath.Join(srcDir, "data.tar.gpg"), []byte("DATA"), 0666,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar := Archive{Path: "s0/2019-01-02T030405Z", TarType: TarFull}
+	err = replicateArchive(src, dst, ar)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("expected sha256 mismatch, got %v", err)
+	}
+
+	// The partial copy must be removed, so that a retry can succeed.
+	if got := lsDir(t, dst.AbsPath("s0")); len(got) != 0 {
+		t.Errorf("expected partial copy to be removed, got %v", got)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tartt-manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manifest.shasums")
+
+	for _, c := range []struct {
+		content string
+		ok      bool
+	}{
+		{"size:4  a\nsha256:abcd  a\nsha1:ef  a\n", true},
+		{"size:4  a\n", false},
+		{"size:x  a\nsha256:abcd  a\n", false},
+		{"sha256:abcd a\n", false},
+		{"abcd  a\n", false},
+	} {
+		err := ioutil.WriteFile(path, []byte(c.content), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := parseManifest(path)
+		if c.ok != (err == nil) {
+			t.Errorf("%q: unexpected error %v", c.content, err)
+			continue
+		}
+		if !c.ok {
+			continue
+		}
+		e := ManifestEntry{Size: 4, Sha256: "abcd"}
+		if len(m) != 1 || m["a"] != e {
+			t.Errorf("%q: unexpected entries %+v", c.content, m)
+		}
+	}
+}
+
+// `cpVerify()` reads the destination back and compares it with the manifest.
+func TestCpVerifyReadsBackDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tartt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "data.tar.gpg")
+	dst := filepath.Join(dir, "copy")
+	if err := ioutil.WriteFile(src, []byte("data"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	manifest := map[string]ManifestEntry{
+		"data.tar.gpg": {
+			Size:   4,
+			Sha256: fmt.Sprintf("%x", sha256.Sum256([]byte("data"))),
+		},
+	}
+	if err := cpVerify(src, dst, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a destination whose content differs from what was written.
+	if err := ioutil.WriteFile(dst, []byte("DATA"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	n, sum, err := fileSizeSha256(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkManifestEntry(dst, manifest["data.tar.gpg"], n, sum)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("expected sha256 mismatch, got %v", err)
+	}
+}
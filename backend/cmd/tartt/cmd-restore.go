@@ -19,6 +19,7 @@ import (
 	"github.com/nogproject/nog/backend/cmd/tartt/drivers"
 	"github.com/nogproject/nog/backend/pkg/iox"
 	"github.com/nogproject/nog/backend/pkg/ratelimit"
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
 )
 
 type UntarOptions struct {
@@ -67,7 +68,15 @@ func cmdRestore(args map[string]interface{}) {
 		lg.Fatalw("--dest is not an empty dir.")
 	}
 
-	tspath := args["<tspath>"].(string)
+	tspath, _ := args["<tspath>"].(string)
+	var at time.Time
+	if arg, ok := args["--at"].(string); ok {
+		t, err := parseAtTime(arg)
+		if err != nil {
+			lg.Fatalw("Invalid --at.", "err", err)
+		}
+		at = t
+	}
 	members := args["<members>"].([]string)
 	untarOpts := NewUntarOptionsFromArgs(args)
 
@@ -77,15 +86,26 @@ func cmdRestore(args map[string]interface{}) {
 		limit = ratelimit.NewBucketWithRate(float64(v), 1024*1024)
 	}
 
+	ids := identitiesFromArgsMust(args)
+
 	repo, err := OpenRepo(".")
 	if err != nil {
 		lg.Fatalw("Failed to open repo.", "err", err)
 	}
 	defer repo.Close()
 
-	storeName, relTspath, err := SplitStoreTspath(tspath)
-	if err != nil {
-		lg.Fatalw("Invalid path.", "tspath", tspath)
+	var storeName, relTspath string
+	if at.IsZero() {
+		storeName, relTspath, err = SplitStoreTspath(tspath)
+		if err != nil {
+			lg.Fatalw("Invalid path.", "tspath", tspath)
+		}
+	} else {
+		var ok bool
+		storeName, ok = args["--store"].(string)
+		if !ok {
+			storeName = repo.DefaultStoreName()
+		}
 	}
 
 	store, err := repo.OpenStore(storeName)
@@ -120,6 +140,19 @@ func cmdRestore(args map[string]interface{}) {
 		lg.Fatalw("Failed to list tree.", "err", err)
 	}
 
+	if !at.IsZero() {
+		p, err := store.FindArchiveAt(tree, at)
+		if err != nil {
+			lg.Fatalw("Failed to find archive.", "err", err)
+		}
+		relTspath = p
+		lg.Infow(
+			"Selected archive.",
+			"at", at.Format(time.RFC3339),
+			"tspath", storePath(store, p),
+		)
+	}
+
 	archives, err := store.GatherArchives(tree, relTspath)
 	if err != nil {
 		lg.Fatalw("Failed to gather archives for tspath.", "err", err)
@@ -129,7 +162,7 @@ func cmdRestore(args map[string]interface{}) {
 	if args["--no-preload-secrets"].(bool) {
 		lg.Infow("Skipped preloading secrets.")
 	} else {
-		secrets = loadSecretsMust(store, archives)
+		secrets = loadSecretsMust(store, archives, ids)
 	}
 	if file, ok := args["--notify-preload-secrets-done"].(string); ok {
 		notifyFileMust(file, "preload-secrets-done")
@@ -138,13 +171,42 @@ func cmdRestore(args map[string]interface{}) {
 	unh := store.UntarHandler()
 	var errFirst error
 	for _, ar := range archives {
+		var ranges string
+		if len(members) > 0 {
+			sel, ok := selectCatalogMembers(
+				store.AbsPath(ar.Path),
+				secrets[ar.Path], ids,
+				unh, ar.Path,
+				members,
+			)
+			switch {
+			case !ok:
+				// Load the full archive.
+			case len(sel) == 0:
+				lg.Infow(
+					"Skipped archive without matching members.",
+					"archive", ar.Path,
+				)
+				continue
+			default:
+				ranges = tarcatalog.FormatRanges(
+					tarcatalog.Ranges(sel),
+				)
+				// Avoid exceeding the argument length limit
+				// for many scattered members.
+				if len(ranges) > maxRangesArgLen {
+					ranges = ""
+				}
+			}
+		}
+
 		lg.Infow("Started untar.", "archive", ar.Path)
 		err := untarIncremental(
 			dest, store.AbsPath(ar.Path),
 			limit,
-			secrets[ar.Path],
+			secrets[ar.Path], ids,
 			unh, ar.Path,
-			members, untarOpts,
+			members, ranges, untarOpts,
 		)
 		if err != nil {
 			lg.Warnw("Untar failed; continuing.", "err", err)
@@ -162,14 +224,16 @@ func cmdRestore(args map[string]interface{}) {
 	}
 }
 
-func loadSecretsMust(store *Store, archives []Archive) map[string]string {
+func loadSecretsMust(
+	store *Store, archives []Archive, ids *Identities,
+) map[string]string {
 	secrets := make(map[string]string)
 	for _, ar := range archives {
 		plain := filepath.Join(store.AbsPath(ar.Path), "secret")
 		crypt := plain + ".asc"
 		switch {
 		case exists(crypt):
-			sec, err := loadEncryptedSecret(crypt)
+			sec, err := ids.DecryptSecret(crypt)
 			if err != nil {
 				lg.Fatalw(
 					"Failed to preload encrypted secret.",
@@ -201,9 +265,22 @@ func loadSecretsMust(store *Store, archives []Archive) map[string]string {
 			)
 
 		default:
-			err := errors.New(
-				"found neither file `secret.asc` nor `secret`",
+			isPlain, err := isPlaintextArchive(
+				store.AbsPath(ar.Path),
 			)
+			if err == nil && isPlain {
+				lg.Infow(
+					"Skipped secret of plaintext archive.",
+					"archive", ar.Path,
+				)
+				continue
+			}
+			if err == nil {
+				err = errors.New(
+					"found neither file `secret.asc` " +
+						"nor `secret`",
+				)
+			}
 			lg.Fatalw(
 				"Failed to preload secret.",
 				"archive", ar.Path,
@@ -218,6 +295,24 @@ func loadSecretsMust(store *Store, archives []Archive) map[string]string {
 	return secrets
 }
 
+// `isPlaintextArchive()` tells whether an archive has been created with
+// `--insecure-plaintext`, that is, whether its manifest lists no encrypted
+// file.
+func isPlaintextArchive(archive string) (bool, error) {
+	manifest, err := parseManifest(
+		filepath.Join(archive, "manifest.shasums"),
+	)
+	if err != nil {
+		return false, err
+	}
+	for name := range manifest {
+		if strings.Contains(name, ".gpg") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func notifyFileMust(file, message string) {
 	fp, err := os.OpenFile(file, os.O_WRONLY, 0)
 	if err == nil {
@@ -236,6 +331,9 @@ func notifyFileMust(file, message string) {
 	}
 }
 
+// `maxRangesArgLen` limits the size of `tartt-store load --ranges`.
+const maxRangesArgLen = 64 * 1024
+
 const TarMsgNotFound = "Not found in archive"
 const TarMsgExitFailure = "Exiting with failure status due to previous errors"
 
@@ -243,9 +341,11 @@ func untarIncremental(
 	dest, archive string,
 	limit *ratelimit.Bucket,
 	secret string,
+	ids *Identities,
 	unh drivers.UntarHandler,
 	arRel string,
 	members []string,
+	ranges string,
 	untarOpts *UntarOptions,
 ) error {
 	// Use `os.Pipe()` to copy data directly between sub-processes and not
@@ -262,8 +362,11 @@ func untarIncremental(
 	// only `tartt-store`.  In the future, the command may depend on the
 	// store driver.
 	loadArgs := []string{"load"}
-	if secret != "" {
-		loadArgs = append(loadArgs, "--secret-stdin")
+	loadArgs = append(loadArgs, ids.LoadArgs(secret)...)
+	if ranges != "" {
+		loadArgs = append(loadArgs,
+			fmt.Sprintf("--ranges=%s", ranges),
+		)
 	}
 	loadArgs = append(loadArgs,
 		"data.tar",
@@ -292,10 +395,18 @@ func untarIncremental(
 	args = append(args, "--")
 	args = append(args, members...)
 	tarCmd := exec.Command(tarTool.Path, args...)
+	var tarIn io.Reader = loadTarPipe.R
+	if ranges != "" {
+		// The ranges contain only the selected members.  Append the
+		// end-of-archive marker to complete the tar stream.
+		tarIn = io.MultiReader(
+			loadTarPipe.R, bytes.NewReader(make([]byte, 1024)),
+		)
+	}
 	if limit == nil {
-		tarCmd.Stdin = loadTarPipe.R
+		tarCmd.Stdin = tarIn
 	} else {
-		tarCmd.Stdin = ratelimit.Reader(loadTarPipe.R, limit)
+		tarCmd.Stdin = ratelimit.Reader(tarIn, limit)
 	}
 	tarCmd.Stdout = os.Stdout
 	tarStderr, err := tarCmd.StderrPipe()
@@ -311,6 +422,10 @@ func untarIncremental(
 		_ = loadCmd.Wait()
 		return err
 	}
+	// Close the write end in `tartt`, so that the read end reports EOF when
+	// `loadCmd` exits.  It is required if `tartt` copies the data to `tar`,
+	// as with `--limit` or ranges.
+	_ = loadTarPipe.CloseW()
 
 	// Analyze Tar stderr to ignore 'not found in archive' errors.
 	var errScan error
@@ -364,6 +479,32 @@ func untarIncremental(
 	return nil
 }
 
+// `selectCatalogMembers()` returns the catalog entries that `members` select
+// in an archive.  It returns `ok=false` if the archive has no catalog or the
+// catalog cannot be loaded, so that the caller loads the full archive.
+func selectCatalogMembers(
+	archive string,
+	secret string,
+	ids *Identities,
+	unh drivers.UntarHandler,
+	arRel string,
+	members []string,
+) ([]tarcatalog.Entry, bool) {
+	catalog, err := loadCatalog(archive, secret, ids, unh, arRel)
+	if err != nil {
+		lg.Warnw(
+			"Failed to load catalog; loading full archive.",
+			"archive", arRel,
+			"err", err,
+		)
+		return nil, false
+	}
+	if catalog == nil {
+		return nil, false
+	}
+	return catalog.Select(members), true
+}
+
 var ErrMalformedTspath = errors.New("malformed tspath")
 
 type Archive struct {
@@ -406,6 +547,55 @@ func (s *Store) GatherArchives(
 	return nil, fmt.Errorf("missing full archive `%s`", ts)
 }
 
+// `FindArchiveAt()` returns the tspath of the latest archive whose time is at
+// or before `at`.  The archive chain that `GatherArchives()` returns for the
+// tspath restores the state as of `at`.
+func (s *Store) FindArchiveAt(t *Tree, at time.Time) (string, error) {
+	var best *TimeTree
+	var bestPath string
+	err := s.WalkTree(t, func(inf TreeInfo) error {
+		tt, ok := inf.Node.(*TimeTree)
+		if !ok {
+			return nil
+		}
+		if tt.Time.After(at) {
+			return nil
+		}
+		if best == nil || tt.Time.After(best.Time) {
+			best = tt
+			bestPath = inf.Path
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if best == nil {
+		err := fmt.Errorf(
+			"no archive at or before %s", at.Format(time.RFC3339),
+		)
+		return "", err
+	}
+	return bestPath, nil
+}
+
+// `parseAtTime()` parses a `--at` timestamp.  It accepts RFC 3339, the
+// timestamp format of tspaths, like `20181007T112102Z`, and a date, like
+// `2018-10-07`, which is interpreted as midnight UTC.
+func parseAtTime(s string) (time.Time, error) {
+	for _, f := range []string{
+		time.RFC3339,
+		timestampTimeFormat2,
+		timestampTimeFormat1,
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(f, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("malformed timestamp `%s`", s)
+}
+
 func (t *TimeTree) gatherArchives(
 	tspath []string, prefix string,
 ) ([]Archive, error) {
@@ -464,7 +654,7 @@ func loadEncryptedSecret(path string) (string, error) {
 		"--batch",
 		"--decrypt", path,
 	}
-	gpgCmd := exec.Command(gpg2Tool.Path, gpgArgs...)
+	gpgCmd := exec.Command(gpg2Tool().Path, gpgArgs...)
 	gpgCmd.Stderr = os.Stderr
 	var secret bytes.Buffer
 	gpgCmd.Stdout = &secret
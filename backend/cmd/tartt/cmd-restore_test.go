@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPlaintextArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tartt-plaintext-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		names []string
+		plain bool
+	}{
+		{[]string{"data.tar.zst.tar.000", "data.tar.catalog"}, true},
+		{[]string{"data.tar.zst.gpg.tar.000", "secret.asc"}, false},
+		{[]string{"data.tar.gpg", "data.tar.catalog.gpg"}, false},
+	} {
+		files := make(map[string]string)
+		for _, name := range c.names {
+			files[name] = name
+		}
+		ar := filepath.Join(dir, "full")
+		writeTestArchive(t, ar, files, c.names)
+		got, err := isPlaintextArchive(ar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.plain {
+			t.Errorf("%v: expected %v, got %v", c.names, c.plain, got)
+		}
+		if err := os.RemoveAll(ar); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := isPlaintextArchive(dir); err == nil {
+		t.Error("expected error without manifest")
+	}
+}
@@ -164,7 +164,7 @@ func gpgCheckGoodFrom(sig, file, text string) (bool, error) {
 		"--batch",
 		"--verify", sig, file,
 	}
-	cmd := exec.Command(gpg2Tool.Path, args...)
+	cmd := exec.Command(gpg2Tool().Path, args...)
 	cmd.Stdin = nil
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -195,7 +195,7 @@ func gpgSign(out io.Writer, path string) error {
 		"--output", "-",
 		path,
 	}
-	cmd := exec.Command(gpg2Tool.Path, args...)
+	cmd := exec.Command(gpg2Tool().Path, args...)
 	cmd.Stdin = nil
 	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
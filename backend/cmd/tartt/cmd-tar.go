@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	slashpath "path"
 	"path/filepath"
 	"strings"
 	"syscall"
@@ -34,7 +35,11 @@ const (
 
 type WithSecret func(dir string) (string, error)
 
-func cmdTar(args map[string]interface{}) {
+// `checkpointFile` is written by `tartt-store save --checkpoint` for the data
+// tar.  It is kept in an incomplete archive for `tartt tar --resume`.
+const checkpointFile = "data.tar.checkpoint"
+
+func cmdTar(args map[string]interface{}) int {
 	policy := WarningContinue
 	switch {
 	case args["--warning-fatal"].(bool):
@@ -44,6 +49,7 @@ func cmdTar(args map[string]interface{}) {
 	}
 
 	lockWait := args["--lock-wait"].(time.Duration)
+	resume := args["--resume"].(bool)
 
 	var limit *ratelimit.Bucket
 	if v, ok := args["--limit"].(uint64); ok {
@@ -72,6 +78,16 @@ func cmdTar(args map[string]interface{}) {
 			file := filepath.Join(dir, "secret.asc")
 			return newArmoredSecret(file, rs)
 		}
+	} else if args["--native-recipients"].(bool) {
+		storeExtraArgs = append(storeExtraArgs,
+			"--split-zstd-gpg-split", "--native",
+			"--cipher-algo", args["--cipher-algo"].(string),
+		)
+		storeMetadataExtraArgs = append(storeMetadataExtraArgs,
+			"--gpg", "--native",
+			"--cipher-algo", args["--cipher-algo"].(string),
+		)
+		// `withSecret` is set below after opening the repo.
 	} else if args["--plaintext-secret"].(bool) {
 		storeExtraArgs = append(storeExtraArgs,
 			"--split-zstd-gpg-split",
@@ -95,6 +111,17 @@ func cmdTar(args map[string]interface{}) {
 	} else {
 		panic("args logic error")
 	}
+	storeExtraArgs = append(storeExtraArgs, storeJobsArgs(args)...)
+
+	// When resuming, load the secret of the incomplete archive instead of
+	// creating a new one.
+	if resume {
+		encrypted := !args["--insecure-plaintext"].(bool)
+		ids := identitiesFromArgsMust(args)
+		withSecret = func(dir string) (string, error) {
+			return loadResumeSecret(dir, ids, encrypted)
+		}
+	}
 
 	repo, err := OpenRepo(".")
 	if err != nil {
@@ -102,6 +129,17 @@ func cmdTar(args map[string]interface{}) {
 	}
 	defer repo.Close()
 
+	if args["--native-recipients"].(bool) && !resume {
+		to, err := repo.NativeRecipients()
+		if err != nil {
+			lg.Fatalw("Failed to load native recipients.", "err", err)
+		}
+		withSecret = func(dir string) (string, error) {
+			file := filepath.Join(dir, "secret.asc")
+			return newNativeArmoredSecret(file, to)
+		}
+	}
+
 	storeName, ok := args["--store"].(string)
 	if !ok {
 		storeName = repo.DefaultStoreName()
@@ -127,6 +165,16 @@ func cmdTar(args map[string]interface{}) {
 
 	now := time.Now().UTC()
 	loc := func() AppendLocation {
+		if resume {
+			loc, err := store.WhereResume()
+			if err != nil {
+				lg.Fatalw(
+					"Failed to find archive to resume.",
+					"err", err,
+				)
+			}
+			return loc
+		}
 		if args["--full"].(bool) {
 			loc, err := store.WhereAppendFull(now)
 			if err != nil {
@@ -159,18 +207,30 @@ func cmdTar(args map[string]interface{}) {
 	}
 
 	var parent string
-	switch loc.TarType {
-	case TarFull:
+	switch {
+	case loc.TarType == TarFull && resume:
+		lg.Infow("Resumed full archive.", "dest", dst)
+		parent = "" // Indicates full archive.
+	case loc.TarType == TarFull:
 		lg.Infow("Started full archive.", "dest", dst)
 		parent = "" // Indicates full archive.
-	case TarPatch:
+	case loc.TarType == TarPatch && resume:
+		lg.Infow("Resumed incremental archive.", "dest", dst)
+		parent = store.AbsPath(loc.ParentTarPath())
+	case loc.TarType == TarPatch:
 		lg.Infow("Started incremental archive.", "dest", dst)
 		parent = store.AbsPath(loc.ParentTarPath())
 	default:
 		panic("invalid TarType")
 	}
+	// The archive time of the interrupted run is before its tar start.
+	var resumeTime time.Time
+	if resume {
+		resumeTime = loc.Now
+	}
 	err = archive(
 		dst, parent, repo.OriginDir(),
+		resumeTime,
 		policy,
 		limit,
 		storeExtraArgs,
@@ -186,21 +246,24 @@ func cmdTar(args map[string]interface{}) {
 	switch err {
 	case nil:
 		lg.Infow("Completed archive.", "dest", dst)
-		os.Exit(0)
+		return 0
 	case ErrTarWarning:
 		lg.Warnw("Completed archive with tar warnings.", "dest", dst)
-		os.Exit(10)
+		return 10
 	case ErrTarError:
 		lg.Errorw("Completed archive with tar errors.", "dest", dst)
-		os.Exit(11)
+		return 11
 	default:
 		// errorPolicyShouldStop() handles unknown error.
 		panic("logic error")
 	}
 }
 
+// `resumeTime` is the archive time of the interrupted run when resuming and
+// zero otherwise.
 func archive(
 	dst, parent, origin string,
+	resumeTime time.Time,
 	policy ErrorPolicy,
 	limit *ratelimit.Bucket,
 	storeExtraArgs []string,
@@ -210,22 +273,48 @@ func archive(
 	handler drivers.ArchiveHandler,
 	dstRel string,
 ) error {
-	tmp, err := mkdirArchiveInProgress(dst)
-	if err != nil {
-		return err
+	resume := !resumeTime.IsZero()
+	var tmp string
+	if resume {
+		tmp = fmt.Sprintf("%s.inprogress", dst)
+		if err := cleanResume(tmp); err != nil {
+			return err
+		}
+	} else {
+		t, err := mkdirArchiveInProgress(dst)
+		if err != nil {
+			return err
+		}
+		tmp = t
 	}
 
-	// If `tmp` still exists on return, rename it to `${dst}.error`.
+	// If the data tar has been checkpointed, keep `tmp` as is for `tartt
+	// tar --resume`.  Otherwise, if `tmp` still exists on return, rename
+	// it to `${dst}.error`.
 	//
 	// But abort the handler transaction first; see next defer below.
+	hasCheckpoint := func() bool {
+		return exists(filepath.Join(tmp, checkpointFile))
+	}
 	defer func() {
-		if exists(tmp) {
-			_ = os.Rename(tmp, fmt.Sprintf("%s.error", dst))
+		if !exists(tmp) {
+			return
+		}
+		if hasCheckpoint() {
+			lg.Warnw(
+				"Kept incomplete archive with checkpoint, "+
+					"which can be continued with "+
+					"`tartt tar --resume`.",
+				"dir", tmp,
+			)
+			return
 		}
+		_ = os.Rename(tmp, fmt.Sprintf("%s.error", dst))
 	}()
 
-	// Copy the exclude list if it exists.
-	if exists(excludePath(".")) {
+	// Copy the exclude list if it exists.  When resuming, use the copy
+	// from the interrupted run, so that tar creates the same stream.
+	if !resume && exists(excludePath(".")) {
 		err := cp(excludePath("."), excludePath(tmp))
 		if err != nil {
 			err := fmt.Errorf("failed to copy `exclude`: %v", err)
@@ -244,7 +333,7 @@ func archive(
 	}
 	// Abort the transaction before removing `tmp`; see defer above.
 	defer func() {
-		if exists(tmp) {
+		if exists(tmp) && !hasCheckpoint() {
 			_ = har.Abort()
 		}
 	}()
@@ -256,11 +345,18 @@ func archive(
 	// `readmeMore` are text blocks for `README.md`.
 	var readmeMore []string
 
+	// When resuming, restart tar with the original snar file, so that it
+	// creates the same stream as the interrupted run.
 	if parent != "" {
 		if err := cp(snarPath(parent), snarPath(tmp)); err != nil {
 			err := fmt.Errorf("failed to copy snar file: %v", err)
 			return err
 		}
+	} else if resume {
+		err := os.Remove(snarPath(tmp))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 
 	secret := ""
@@ -273,7 +369,7 @@ func archive(
 	}
 
 	errTar := tarIncremental(
-		har, tmp, origin, limit, storeExtraArgs, secret,
+		har, tmp, origin, resumeTime, limit, storeExtraArgs, secret,
 	)
 	if errorPolicyShouldStop(policy, errTar) {
 		return errTar
@@ -338,6 +434,13 @@ func archive(
 		}
 	}
 
+	// The checkpoint is no longer needed when the archive is complete.
+	if err := os.Remove(filepath.Join(tmp, checkpointFile)); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	if err := har.Commit(); err != nil {
 		return err
 	}
@@ -384,6 +487,143 @@ func mkdirArchiveInProgress(dest string) (string, error) {
 	return tmp, nil
 }
 
+// `WhereResume()` returns the location of the latest incomplete archive for
+// `tartt tar --resume`.  The archive must be newer than all complete archives,
+// so that its parent is the same as when it was started.
+func (s *Store) WhereResume() (AppendLocation, error) {
+	all, err := s.LsTreeSelect(TarTypesAll)
+	if err != nil {
+		return AppendLocation{}, err
+	}
+	var latest TreeInfo
+	if err := s.WalkTree(all, func(inf TreeInfo) error {
+		t, ok := inf.Node.(*TimeTree)
+		if !ok {
+			return nil
+		}
+		switch t.TarType {
+		case TarFullInProgress:
+		case TarPatchInProgress:
+		default:
+			return nil
+		}
+		if latest.Node == nil ||
+			t.Time.After(latest.Node.(*TimeTree).Time) {
+			latest = inf
+		}
+		return nil
+	}); err != nil {
+		return AppendLocation{}, err
+	}
+	if latest.Node == nil {
+		return AppendLocation{}, errors.New("no incomplete archive")
+	}
+	t := latest.Node.(*TimeTree)
+
+	tree, err := s.LsTree()
+	if err != nil {
+		return AppendLocation{}, err
+	}
+	if !tree.MaxTime().Before(t.Time) {
+		err := fmt.Errorf(
+			"archive `%s` is older than the latest archive",
+			latest.Path,
+		)
+		return AppendLocation{}, err
+	}
+
+	var loc AppendLocation
+	if t.TarType == TarFullInProgress {
+		loc, err = s.WhereAppendFull(t.Time)
+	} else {
+		loc, err = s.WhereAppend(t.Time, tree)
+	}
+	if err != nil {
+		return AppendLocation{}, err
+	}
+	inprogress := slashpath.Join(latest.Path, t.TarType.Path())
+	if loc.TarPath()+".inprogress" != inprogress {
+		err := fmt.Errorf(
+			"failed to determine parent of incomplete archive `%s`",
+			inprogress,
+		)
+		return AppendLocation{}, err
+	}
+	if !exists(filepath.Join(s.AbsPath(inprogress), checkpointFile)) {
+		err := fmt.Errorf(
+			"incomplete archive `%s` has no checkpoint", inprogress,
+		)
+		return AppendLocation{}, err
+	}
+	return loc, nil
+}
+
+// `storeJobsArgs()` returns the `tartt-store save` arguments for `--jobs`,
+// which does not change the archive, so that it may differ when resuming.
+func storeJobsArgs(args map[string]interface{}) []string {
+	if n, ok := args["--jobs"].(int); ok {
+		return []string{fmt.Sprintf("--jobs=%d", n)}
+	}
+	return nil
+}
+
+// `cleanResume()` removes the files of the interrupted run that are created
+// again after the data tar.  `tartt-store save --resume` cleans up the data
+// tar and the manifest.
+func cleanResume(tmp string) error {
+	logs, err := lsLogs(tmp)
+	if err != nil {
+		return err
+	}
+	metadata, err := filepath.Glob(filepath.Join(tmp, "metadata.tar*"))
+	if err != nil {
+		return err
+	}
+	files := []string{
+		filepath.Join(tmp, "README.md"),
+		resumeSnarPath(tmp),
+	}
+	files = append(files, metadata...)
+	for _, f := range logs {
+		files = append(files, filepath.Join(tmp, f))
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// `loadResumeSecret()` loads the secret of the incomplete archive in `dir`,
+// so that the resumed data is encrypted with the same secret.  `secret.asc`
+// is decrypted like during restore, natively if `ids` is set or with gpg2.
+func loadResumeSecret(
+	dir string, ids *Identities, encrypted bool,
+) (string, error) {
+	plain := filepath.Join(dir, "secret")
+	crypt := plain + ".asc"
+	var secret string
+	var err error
+	switch {
+	case exists(crypt):
+		secret, err = ids.DecryptSecret(crypt)
+	case exists(plain):
+		secret, err = loadPlaintextSecret(plain)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case encrypted && secret == "":
+		return "", errors.New("incomplete archive has no secret")
+	case !encrypted && secret != "":
+		return "", errors.New("incomplete archive is encrypted")
+	}
+	return secret, nil
+}
+
 func errorPolicyShouldStop(policy ErrorPolicy, errTar error) bool {
 	switch errTar {
 	case nil: // ok
@@ -499,6 +739,7 @@ enable `--atime-preserve=system` for scenarios where Tar is guaranteed to have
 func tarIncremental(
 	har drivers.ArchiveTx,
 	dst, origin string,
+	resumeTime time.Time,
 	limit *ratelimit.Bucket,
 	storeExtraArgs []string,
 	secret string,
@@ -537,21 +778,26 @@ func tarIncremental(
 		)
 	}
 
-	tarArgs := []string{
-		"--create",
-		"--verbose",
-		"--file=-", // pipe to `saveCmd`.
-		fmt.Sprintf("%s=%s", optListed, snarPath(dst)),
-		"--no-check-device", // See comment #TAROPTIONS.
-		// No `--atime-preserve=system`, see comment #TAROPTIONS.
-		"--sparse", // See comment #TAROPTIONS.
+	tarOpts := func(file, snar string) []string {
+		return []string{
+			"--create",
+			"--verbose",
+			fmt.Sprintf("--file=%s", file),
+			fmt.Sprintf("%s=%s", optListed, snar),
+			"--no-check-device", // See comment #TAROPTIONS.
+			// No `--atime-preserve=system`, see comment #TAROPTIONS.
+			"--sparse", // See comment #TAROPTIONS.
+		}
 	}
+	var excludeArgs []string
 	if exists(excludePath(dst)) {
-		tarArgs = append(tarArgs,
+		excludeArgs = []string{
 			"--anchored",
 			fmt.Sprintf("--exclude-from=%s", excludePath(dst)),
-		)
+		}
 	}
+	// `-` pipes to `saveCmd`.
+	tarArgs := append(tarOpts("-", snarPath(dst)), excludeArgs...)
 
 	// If origin does not exist, use a temporary placeholder directory.
 	// Using `--files-from=/dev/null`, as suggested in
@@ -559,9 +805,10 @@ func tarIncremental(
 	// not work together with `--listed-incremental`.  But we want
 	// `--listed-incremental`, so that `tartt` works as expected if origin
 	// re-appears.
-	if ok, err := tarttIsDir(origin); err != nil {
+	originIsDir, err := tarttIsDir(origin)
+	if err != nil {
 		return err
-	} else if ok {
+	} else if originIsDir {
 		tarArgs = append(tarArgs,
 			fmt.Sprintf("--directory=%s", origin),
 			".",
@@ -582,8 +829,7 @@ func tarIncremental(
 		)
 	}
 
-	tarCmd := exec.Command(tarTool.Path, tarArgs...)
-	tarCmd.Env = append(os.Environ(),
+	tarEnv := append(os.Environ(),
 		// Ensure English for awk processing below.  See
 		// <http://perlgeek.de/en/article/set-up-a-clean-utf8-environment>
 		// for relevant env variables.
@@ -598,6 +844,44 @@ func tarIncremental(
 		"LANG=C.UTF-8",
 		"LANGUAGE=C.UTF-8",
 	)
+
+	// When resuming, restart tar at a checkpointed member if possible.
+	// Otherwise, restart tar from the start.  See `planTarResume()`.
+	resume := !resumeTime.IsZero()
+	var plan *tarResume
+	if resume && originIsDir {
+		listArgs := append(
+			tarOpts("/dev/null", resumeSnarPath(dst)),
+			excludeArgs...,
+		)
+		listArgs = append(listArgs,
+			fmt.Sprintf("--directory=%s", origin),
+			".",
+		)
+		plan, err = planTarResume(
+			dst, origin, resumeTime, listArgs, tarEnv,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if plan != nil {
+		filesFrom, err := writeTarResumeFiles(plan.files)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(filesFrom) }()
+		tarArgs = append(tarOpts("-", snarPath(dst)),
+			fmt.Sprintf("--directory=%s", origin),
+			"--no-recursion",
+			"--null",
+			"--verbatim-files-from",
+			fmt.Sprintf("--files-from=%s", filesFrom),
+		)
+	}
+
+	tarCmd := exec.Command(tarTool.Path, tarArgs...)
+	tarCmd.Env = tarEnv
 	tarCmd.Stdin = nil
 	tarCmd.Stdout = tarSavePipe.W
 	tarCmd.Stderr = tarAwkPipe.W
@@ -613,7 +897,21 @@ func tarIncremental(
 			"--secret-fd=3",
 		)
 	}
+	// Checkpoint the data tar, so that an interrupted archive can be
+	// continued with `tartt tar --resume`.
+	switch {
+	case plan != nil:
+		saveArgs = append(saveArgs,
+			"--resume",
+			fmt.Sprintf("--resume-offset=%d", plan.offset),
+		)
+	case resume:
+		saveArgs = append(saveArgs, "--resume")
+	default:
+		saveArgs = append(saveArgs, "--checkpoint")
+	}
 	saveArgs = append(saveArgs,
+		"--catalog",
 		"data.tar",
 	)
 	saveCmd := exec.Command(
@@ -770,6 +1068,14 @@ func tarIncremental(
 	if errForce != nil {
 		return errForce
 	}
+	// Complete the snar file and `out.log` of a resumed run, unless tar
+	// failed, whose error is more relevant.
+	if resume {
+		err := finishTarResume(dst, plan, resumeTime)
+		if err != nil && errTar == nil {
+			return err
+		}
+	}
 	// If tar fails:
 	//
 	//  - no exit code: fatal.
@@ -928,31 +1234,14 @@ func newArmoredSecret(file string, gpgIds []string) (string, error) {
 
 	// The secret itself remains fixed.  To allow key rotation, the secret
 	// is encrypted to GPG recipients.  Any of the recipients can restore
-	// data or re-encrypt the secret to change the recipients.
-	//
-	// Always use AES256 to make paranoid users happy.  Secrets are so
-	// small that speed is irrelevant.
-	gpgArgs := []string{
-		"--batch",
-		"--encrypt", "--armor",
-		"--cipher-algo", "AES256",
-	}
-	for _, r := range gpgIds {
-		gpgArgs = append(gpgArgs,
-			"--recipient", r,
-		)
-	}
-	gpgCmd := exec.Command(gpg2Tool.Path, gpgArgs...)
-	gpgCmd.Stderr = os.Stderr
-	gpgCmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n", secret))
-
+	// data or re-encrypt the secret with `tartt rekey` to change the
+	// recipients.
 	fp, err := os.Create(file)
 	if err != nil {
 		return "", err
 	}
 	defer fp.Close()
-	gpgCmd.Stdout = fp
-	if err := gpgCmd.Run(); err != nil {
+	if err := encryptSecret(fp, secret, gpgIds); err != nil {
 		return "", err
 	}
 	if err := fp.Close(); err != nil {
@@ -962,6 +1251,27 @@ func newArmoredSecret(file string, gpgIds []string) (string, error) {
 	return secret, nil
 }
 
+// `encryptSecret()` writes the ASCII-armored secret encrypted to the GPG
+// recipients.  It always uses AES256 to make paranoid users happy.  Secrets
+// are so small that speed is irrelevant.
+func encryptSecret(w io.Writer, secret string, gpgIds []string) error {
+	gpgArgs := []string{
+		"--batch",
+		"--encrypt", "--armor",
+		"--cipher-algo", "AES256",
+	}
+	for _, r := range gpgIds {
+		gpgArgs = append(gpgArgs,
+			"--recipient", r,
+		)
+	}
+	gpgCmd := exec.Command(gpg2Tool().Path, gpgArgs...)
+	gpgCmd.Stderr = os.Stderr
+	gpgCmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n", secret))
+	gpgCmd.Stdout = w
+	return gpgCmd.Run()
+}
+
 func newPlaintextSecret(file string) (string, error) {
 	secret, err := newSecret()
 	if err != nil {
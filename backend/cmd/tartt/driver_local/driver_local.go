@@ -5,7 +5,9 @@ import (
 )
 
 type Driver struct{}
-type ArchiveTx struct{}
+type ArchiveTx struct {
+	tmp string
+}
 
 func New(name string, cfgYml []byte) (*Driver, error) {
 	return &Driver{}, nil
@@ -22,7 +24,7 @@ func (d *Driver) Close() error {
 func (d *Driver) BeginArchive(
 	dst, tmp string,
 ) (drivers.ArchiveTx, error) {
-	return &ArchiveTx{}, nil
+	return &ArchiveTx{tmp: tmp}, nil
 }
 
 func (d *Driver) RemoveAll(prefix string) error {
@@ -45,6 +47,10 @@ func (tx *ArchiveTx) SaveArgs(args []string) []string {
 	return args
 }
 
+func (tx *ArchiveTx) DataDir() string {
+	return tx.tmp
+}
+
 func (d *Driver) LoadProgram(tarttStore string) string {
 	return tarttStore
 }
@@ -52,3 +58,7 @@ func (d *Driver) LoadProgram(tarttStore string) string {
 func (d *Driver) LoadArgs(arRel string, args []string) []string {
 	return args
 }
+
+func (d *Driver) DataDir(arRel, local string) string {
+	return local
+}
@@ -91,10 +91,22 @@ func (tx *ArchiveTx) Commit() error {
 		return err
 	}
 
-	if tx.hasReadme {
-		if err := cp(
-			filepath.Join(tx.local, "README.md"), tx.inprogress,
-		); err != nil {
+	// `tartt replicate` copies `README.md` to local without `SaveArgs()`.
+	readme := filepath.Join(tx.local, "README.md")
+	if tx.hasReadme || exists(readme) {
+		if err := cp(readme, tx.inprogress); err != nil {
+			return err
+		}
+	}
+
+	// Member catalogs are stored locally for fast lookup, with a copy on
+	// tape, so that the tape archive is complete.
+	catalogs, err := localCatalogs(tx.local)
+	if err != nil {
+		return err
+	}
+	for _, c := range catalogs {
+		if err := cp(c, tx.inprogress); err != nil {
 			return err
 		}
 	}
@@ -128,6 +140,10 @@ func (tx *ArchiveTx) SaveArgs(args []string) []string {
 	return args
 }
 
+func (tx *ArchiveTx) DataDir() string {
+	return tx.inprogress
+}
+
 func (d *Driver) LoadProgram(tarttStore string) string {
 	return tarttStore
 }
@@ -143,6 +159,10 @@ func (d *Driver) LoadArgs(arRel string, args []string) []string {
 	return args
 }
 
+func (d *Driver) DataDir(arRel, local string) string {
+	return filepath.Join(d.tardir, arRel)
+}
+
 func isSaveReadme(args []string) bool {
 	if len(args) < 1 {
 		return false
@@ -161,6 +181,18 @@ func isLoadTar(args []string) bool {
 	return isSaveTar(args)
 }
 
+func localCatalogs(dir string) ([]string, error) {
+	var paths []string
+	for _, pat := range []string{"*.catalog", "*.catalog.gpg"} {
+		m, err := filepath.Glob(filepath.Join(dir, pat))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, m...)
+	}
+	return paths, nil
+}
+
 func exists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
@@ -29,6 +29,7 @@ type StoreHandle interface {
 	ArchiveHandler
 	GcHandler
 	UntarHandler
+	ReplicateHandler
 	Close() error
 }
 
@@ -84,6 +85,16 @@ type UntarHandler interface {
 	LoadArgs(arRel string, origArgs []string) []string
 }
 
+// `ReplicateHandler` contains the operations used by `tartt replicate`.
+type ReplicateHandler interface {
+	// `DataDir()` returns the directory that contains the data files of
+	// the archive `arRel`, that is the files that are listed in
+	// `manifest.shasums`, except `README.md` and the member catalogs
+	// `*.catalog` and `*.catalog.gpg`.  `local` is the archive directory
+	// in the store, which contains all other files.
+	DataDir(arRel, local string) string
+}
+
 // `ArchiveTx` represents an archive operation that has been started with
 // `ArchiveHandler.BeginArchive()` and not yet completed.
 type ArchiveTx interface {
@@ -114,4 +125,9 @@ type ArchiveTx interface {
 	//
 	SaveProgram(tarttStore string) string
 	SaveArgs(origArgs []string) []string
+
+	// `DataDir()` returns the directory to which `tartt replicate` copies
+	// the data files before calling `Commit()`; see
+	// `ReplicateHandler.DataDir()`.
+	DataDir() string
 }
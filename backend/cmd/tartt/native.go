@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nogproject/nog/backend/pkg/openpgpx"
+	"golang.org/x/crypto/openpgp"
+)
+
+// `Identities` are the private keys from `--identity-file` that decrypt
+// archive secrets natively, without gpg2.  A nil `*Identities` means gpg2.
+// `Path` is absolute, so that it can be passed to `tartt-store`, which runs
+// in the archive directory.
+type Identities struct {
+	Path string
+	Keys openpgp.EntityList
+}
+
+func identitiesFromArgsMust(args map[string]interface{}) *Identities {
+	path, ok := args["--identity-file"].(string)
+	if !ok {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		lg.Fatalw("Invalid --identity-file.", "err", err)
+	}
+	keys, err := openpgpx.ReadIdentityFile(abs)
+	if err != nil {
+		lg.Fatalw(
+			"Failed to read identity file.",
+			"path", abs,
+			"err", err,
+		)
+	}
+	return &Identities{Path: abs, Keys: keys}
+}
+
+// `LoadArgs()` returns the `tartt-store load` options for a secret that has
+// been preloaded or is empty.
+func (ids *Identities) LoadArgs(secret string) []string {
+	switch {
+	case ids == nil && secret == "":
+		return nil
+	case ids == nil:
+		return []string{"--secret-stdin"}
+	case secret == "":
+		return []string{fmt.Sprintf("--identity-file=%s", ids.Path)}
+	default:
+		return []string{"--native", "--secret-stdin"}
+	}
+}
+
+// `DecryptSecret()` decrypts `secret.asc` natively or with gpg2.
+func (ids *Identities) DecryptSecret(path string) (string, error) {
+	if ids == nil {
+		return loadEncryptedSecret(path)
+	}
+	return openpgpx.DecryptSecretFile(path, ids.Keys)
+}
+
+func newNativeArmoredSecret(
+	file string, to openpgp.EntityList,
+) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// See `newArmoredSecret()`.
+	fp, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	if err := openpgpx.EncryptSecret(fp, secret, to); err != nil {
+		return "", err
+	}
+	if err := fp.Close(); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// `nativeRecipientKeys()` is like `gpgRecipientKeys()` for config keys.
+func nativeRecipientKeys(to openpgp.EntityList) GpgRecipientKeys {
+	rs := make(GpgRecipientKeys, 0, len(to))
+	for _, e := range to {
+		var ids []string
+		for _, id := range openpgpx.EncryptionKeyIds(e) {
+			ids = append(ids, openpgpx.FormatKeyId(id))
+		}
+		rs = append(rs, ids)
+	}
+	return rs
+}
+
+func nativeSecretEncrypter(to openpgp.EntityList) SecretEncrypter {
+	return func(w io.Writer, secret string) error {
+		return openpgpx.EncryptSecret(w, secret, to)
+	}
+}
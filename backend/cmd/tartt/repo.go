@@ -18,6 +18,8 @@ import (
 	"github.com/nogproject/nog/backend/cmd/tartt/driver_localtape"
 	"github.com/nogproject/nog/backend/cmd/tartt/drivers"
 	"github.com/nogproject/nog/backend/pkg/flock"
+	"github.com/nogproject/nog/backend/pkg/openpgpx"
+	"golang.org/x/crypto/openpgp"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -26,15 +28,23 @@ var ErrFirstLevelDisabled = errors.New("first level must be enabled")
 var ErrLastLevelDisabled = errors.New("last level must be enabled")
 
 type RepoConfig struct {
-	OriginDir string        `yaml:"originDir"`
-	StoresDir string        `yaml:"storesDir"`
-	Stores    []StoreConfig `yaml:"stores"`
+	OriginDir  string           `yaml:"originDir"`
+	StoresDir  string           `yaml:"storesDir"`
+	Stores     []StoreConfig    `yaml:"stores"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+}
+
+// `EncryptionConfig.Recipients` are ASCII-armored OpenPGP public key blocks
+// for `tartt tar --native-recipients`.
+type EncryptionConfig struct {
+	Recipients []string `yaml:"recipients"`
 }
 
 type StoreConfig struct {
-	Name   string        `yaml:"name"`
-	Driver string        `yaml:"driver"`
-	Levels []LevelConfig `yaml:"levels"`
+	Name      string          `yaml:"name"`
+	Driver    string          `yaml:"driver"`
+	Levels    []LevelConfig   `yaml:"levels"`
+	Retention RetentionConfig `yaml:"retention"`
 }
 
 type LevelConfig struct {
@@ -45,10 +55,30 @@ type LevelConfig struct {
 	Disabled bool `yaml:"disabled"`
 }
 
+// `RetentionConfig` extends the level lifetimes.  `tartt gc` keeps an archive
+// if any rule applies.  See `tartt --help` for details.
+type RetentionConfig struct {
+	// `MinLifetime` is applied to all archives, regardless of the level
+	// lifetimes.
+	MinLifetime string `yaml:"minLifetime"`
+	// `KeepLastChains` keeps the latest full archives with all their
+	// incremental archives.
+	KeepLastChains int `yaml:"keepLastChains"`
+	// `KeepFulls` keeps the first full archive per interval.
+	KeepFulls []KeepFullsConfig `yaml:"keepFulls"`
+}
+
+type KeepFullsConfig struct {
+	Interval string `yaml:"interval"`
+	Lifetime string `yaml:"lifetime"`
+}
+
 type Repo struct {
 	repoDir   string
 	originDir string
 	storesDir string
+	// `recipients` are the ASCII-armored public keys from the config.
+	recipients []string
 	// `stores` are partially initialized.  Use them only through
 	// `Repo.OpenStore()`.
 	stores []*Store
@@ -56,10 +86,11 @@ type Repo struct {
 
 type Store struct {
 	// Valid when partially initialized.
-	Name     string
-	storeDir string
-	levels   []*Level
-	driver   drivers.StoreDriver
+	Name      string
+	storeDir  string
+	levels    []*Level
+	retention *Retention
+	driver    drivers.StoreDriver
 
 	// Valid when fully initialized, as returned from `Repo.OpenStore()`.
 	handle drivers.StoreHandle
@@ -100,6 +131,24 @@ func (s *Store) UntarHandler() drivers.UntarHandler {
 	return s.handle
 }
 
+func (s *Store) ReplicateHandler() drivers.ReplicateHandler {
+	return s.handle
+}
+
+// `HasSameLevels()` tells whether the stores use the same level directory
+// names, which is required to copy archives between them.
+func (s *Store) HasSameLevels(other *Store) bool {
+	if len(s.levels) != len(other.levels) {
+		return false
+	}
+	for i, lv := range s.levels {
+		if lv.Name() != other.levels[i].Name() {
+			return false
+		}
+	}
+	return true
+}
+
 func SplitStoreTspath(path string) (string, string, error) {
 	st := strings.SplitN(path, "/", 2)
 	if len(st) != 2 {
@@ -254,6 +303,7 @@ func OpenRepo(path string) (*Repo, error) {
 		return nil, fmt.Errorf("missing stores dir `%s`", storesDir)
 	}
 	r.storesDir = storesDir
+	r.recipients = cfg.Encryption.Recipients
 
 	for _, c := range cfg.Stores {
 		s, err := newStorePartialInit(storesDir, c, cfgYml)
@@ -262,10 +312,18 @@ func OpenRepo(path string) (*Repo, error) {
 		}
 		r.stores = append(r.stores, s)
 	}
-	if len(r.stores) != 1 {
-		err := errors.New("require exactly one store")
+	if len(r.stores) == 0 {
+		err := errors.New("require at least one store")
 		return nil, err
 	}
+	names := make(map[string]struct{})
+	for _, s := range r.stores {
+		if _, ok := names[s.Name]; ok {
+			err := fmt.Errorf("duplicate store `%s`", s.Name)
+			return nil, err
+		}
+		names[s.Name] = struct{}{}
+	}
 
 	return r, nil
 }
@@ -350,9 +408,26 @@ func newStorePartialInit(
 		return nil, err
 	}
 
+	retention, err := newRetention(cfg.Retention)
+	if err != nil {
+		err := fmt.Errorf("failed to parse retention: %s", err)
+		return nil, err
+	}
+	s.retention = retention
+
 	return s, nil
 }
 
+// `NativeRecipients()` parses the public keys from the config.
+func (r *Repo) NativeRecipients() (openpgp.EntityList, error) {
+	if len(r.recipients) == 0 {
+		return nil, errors.New(
+			"missing config `encryption.recipients`",
+		)
+	}
+	return openpgpx.ReadRecipients(r.recipients)
+}
+
 func (r *Repo) StoreNames() []string {
 	ns := make([]string, len(r.stores))
 	for i, s := range r.stores {
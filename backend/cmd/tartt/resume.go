@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/tarquote"
+)
+
+// `tarResume` describes how `tartt tar --resume` restarts tar at a member that
+// has been checkpointed by `tartt-store save --checkpoint`.  `offset` is the
+// start of the member in the data tar.  `files` are the unquoted names of the
+// member and the members after it.  `prefix` are the names of the members
+// before it, quoted as in `out.log`.  `info` are the messages of the listing
+// tar for `info.log`.
+type tarResume struct {
+	offset int64
+	files  []string
+	prefix []string
+	info   []string
+}
+
+// `tarResumePoint` is a member from `tartt-store resume-points`.  `name` is
+// quoted as in `out.log`.
+type tarResumePoint struct {
+	offset int64
+	size   int64
+	mtime  int64
+	typ    byte
+	name   string
+}
+
+// `resumeSnarPath()` is the snar file of the listing tar when resuming, which
+// replaces the snar file of the archive when tar has completed.
+func resumeSnarPath(dir string) string {
+	return filepath.Join(dir, "origin.snar.resume")
+}
+
+// `planTarResume()` determines the member at which tar can be restarted.  It
+// returns `nil` if tar needs to be restarted from the start.
+//
+// GNU tar creates the same stream when it is restarted with the members from
+// the resume member to the end as an explicit file list with
+// `--no-recursion`, if the list contains only files.  A listing tar with
+// `--file=/dev/null`, which does not read file data, determines the members
+// of the complete stream, whose `--listed-incremental` snar file is then used
+// as the snar file of the archive.  With `--listed-incremental`, tar stores
+// directories before files, so that the resume member usually is after the
+// last directory.
+//
+// The resume member must be an unchanged regular file, and the files after it
+// must not have hard links, since tar would store a hard link member if the
+// other link was before the resume member.  The listing tar must only report
+// directory messages for `info.log`.  Errors, like unreadable directories,
+// would not be reported by the restarted tar, so that tar is then restarted
+// from the start.
+//
+// The members before the resume member are taken from the kept chunks of the
+// interrupted run, but `out.log` and the snar file are taken from the listing.
+// Both must agree.  Adding, removing, or renaming a directory entry changes
+// the mtime and ctime of the directory.  If a directory has been changed
+// since `t`, which is the archive time of the interrupted run, tar is
+// therefore restarted from the start.  Otherwise, a file that has been moved
+// into a directory before the resume member would be listed in the snar file
+// without being in the data, so that later incremental archives would not
+// contain it either.
+func planTarResume(
+	dst, origin string, t time.Time, listArgs []string, env []string,
+) (*tarResume, error) {
+	points, err := tarttStoreResumePoints(dst)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		lg.Infow(
+			"No checkpointed member; " +
+				"restarting tar from the start.",
+		)
+		return nil, nil
+	}
+
+	snar := resumeSnarPath(dst)
+	if err := os.Remove(snar); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if exists(snarPath(dst)) {
+		if err := cp(snarPath(dst), snar); err != nil {
+			err := fmt.Errorf("failed to copy snar file: %v", err)
+			return nil, err
+		}
+	}
+	listing, stderr, err := listTarMembers(listArgs, env)
+	if err != nil {
+		_ = os.Remove(snar)
+		lg.Warnw(
+			"Failed to list tar members; "+
+				"restarting tar from the start.",
+			"err", err,
+			"stderr", string(stderr),
+		)
+		return nil, nil
+	}
+
+	info, ok := tarInfoLines(stderr)
+	if !ok {
+		_ = os.Remove(snar)
+		lg.Warnw(
+			"Tar listing reported errors; "+
+				"restarting tar from the start.",
+			"stderr", string(stderr),
+		)
+		return nil, nil
+	}
+
+	if dir := changedTarDir(origin, listing, t); dir != "" {
+		_ = os.Remove(snar)
+		lg.Infow(
+			"Directory changed since the interrupted run; "+
+				"restarting tar from the start.",
+			"dir", dir,
+		)
+		return nil, nil
+	}
+
+	i, p := selectTarResume(origin, points, listing)
+	if p == nil {
+		_ = os.Remove(snar)
+		lg.Infow(
+			"No unchanged checkpointed member; " +
+				"restarting tar from the start.",
+		)
+		return nil, nil
+	}
+
+	files := make([]string, 0, len(listing)-i)
+	for _, name := range listing[i:] {
+		f, err := tarquote.UnquoteEscape(name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	lg.Infow(
+		"Restarting tar at checkpointed member.",
+		"member", p.name,
+		"offset", p.offset,
+		"members", len(files),
+	)
+	return &tarResume{
+		offset: p.offset,
+		files:  files,
+		prefix: listing[:i],
+		info:   info,
+	}, nil
+}
+
+func tarttStoreResumePoints(dst string) ([]tarResumePoint, error) {
+	cmd := exec.Command(tarttStoreTool.Path, "resume-points", "data.tar")
+	cmd.Dir = dst
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		err := fmt.Errorf("`tartt-store resume-points` failed: %v", err)
+		return nil, err
+	}
+	return parseTarResumePoints(string(out))
+}
+
+// `parseTarResumePoints()` parses lines `<offset> <size> <mtime> <type>
+// <name>`.
+func parseTarResumePoints(out string) ([]tarResumePoint, error) {
+	var points []tarResumePoint
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		malformed := fmt.Errorf("malformed resume point `%s`", line)
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) != 5 || len(fields[3]) != 1 {
+			return nil, malformed
+		}
+		var ints [3]int64
+		for i := range ints {
+			v, err := strconv.ParseInt(fields[i], 10, 64)
+			if err != nil {
+				return nil, malformed
+			}
+			ints[i] = v
+		}
+		points = append(points, tarResumePoint{
+			offset: ints[0],
+			size:   ints[1],
+			mtime:  ints[2],
+			typ:    fields[3][0],
+			name:   fields[4],
+		})
+	}
+	return points, nil
+}
+
+// `listTarMembers()` runs tar with `--file=/dev/null` and returns the member
+// names that tar reports to stdout and the messages that it reports to stderr.
+func listTarMembers(args []string, env []string) ([]string, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tarTool.Path, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, stderr.Bytes(), err
+	}
+
+	var names []string
+	s := bufio.NewScanner(&stdout)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		names = append(names, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, stderr.Bytes(), err
+	}
+	return names, stderr.Bytes(), nil
+}
+
+// `tarInfoLines()` returns the lines of the tar messages `stderr` and whether
+// they are all directory messages, which the tar awk program writes to
+// `info.log`.
+func tarInfoLines(stderr []byte) ([]string, bool) {
+	var lines []string
+	const renamed = ": Directory has been renamed"
+	isInfo := func(l string) bool {
+		return strings.HasSuffix(l, ": Directory is new") ||
+			strings.HasSuffix(l, renamed) ||
+			strings.Contains(l, renamed+" from ")
+	}
+	for _, l := range strings.Split(string(stderr), "\n") {
+		if l == "" {
+			continue
+		}
+		if !isInfo(l) {
+			return nil, false
+		}
+		lines = append(lines, l)
+	}
+	return lines, true
+}
+
+// `selectTarResume()` returns the index in `listing` and the point of the
+// latest usable resume point, or `nil` if there is none; see
+// `planTarResume()`.  Directories are listed with a trailing slash.
+func selectTarResume(
+	origin string, points []tarResumePoint, listing []string,
+) (int, *tarResumePoint) {
+	index := make(map[string]int)
+	lastDir := -1
+	for i, name := range listing {
+		index[name] = i
+		if strings.HasSuffix(name, "/") {
+			lastDir = i
+		}
+	}
+
+	// `checked` is the start of the listing suffix whose files are known
+	// to have no hard links.
+	checked := len(listing)
+	for k := range points {
+		p := &points[k]
+		i, ok := index[p.name]
+		if !ok || i <= lastDir || p.typ != '0' {
+			continue
+		}
+		if !isUnchangedTarFile(origin, p) {
+			continue
+		}
+		for ; checked > i; checked-- {
+			if !isSingleLinkTarFile(origin, listing[checked-1]) {
+				return 0, nil
+			}
+		}
+		return i, p
+	}
+	return 0, nil
+}
+
+// `changedTarDir()` returns the first directory in `listing` whose mtime or
+// ctime is not before `t` or that cannot be inspected, or the empty string if
+// all directories are older.
+func changedTarDir(origin string, listing []string, t time.Time) string {
+	for _, name := range listing {
+		if !strings.HasSuffix(name, "/") {
+			continue
+		}
+		inf, err := lstatTarMember(origin, name)
+		if err != nil {
+			return name
+		}
+		st, ok := inf.Sys().(*syscall.Stat_t)
+		if !ok {
+			return name
+		}
+		ctime := time.Unix(st.Ctim.Sec, st.Ctim.Nsec)
+		if !inf.ModTime().Before(t) || !ctime.Before(t) {
+			return name
+		}
+	}
+	return ""
+}
+
+func lstatTarMember(origin, name string) (os.FileInfo, error) {
+	path, err := tarquote.UnquoteEscape(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(filepath.Join(origin, path))
+}
+
+func isUnchangedTarFile(origin string, p *tarResumePoint) bool {
+	inf, err := lstatTarMember(origin, p.name)
+	if err != nil {
+		return false
+	}
+	return inf.Mode().IsRegular() &&
+		inf.Size() == p.size &&
+		inf.ModTime().Unix() == p.mtime
+}
+
+func isSingleLinkTarFile(origin, name string) bool {
+	inf, err := lstatTarMember(origin, name)
+	if err != nil {
+		return false
+	}
+	if !inf.Mode().IsRegular() {
+		return true
+	}
+	st, ok := inf.Sys().(*syscall.Stat_t)
+	return ok && st.Nlink == 1
+}
+
+// `writeTarResumeFiles()` writes the file list for `tar --null
+// --files-from` to a temporary file.
+func writeTarResumeFiles(files []string) (string, error) {
+	fp, err := ioutil.TempFile("", "tartt-resume-files-")
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if _, err := fmt.Fprintf(fp, "%s\x00", f); err != nil {
+			_ = fp.Close()
+			_ = os.Remove(fp.Name())
+			return "", err
+		}
+	}
+	if err := fp.Close(); err != nil {
+		_ = os.Remove(fp.Name())
+		return "", err
+	}
+	return fp.Name(), nil
+}
+
+// `finishTarResume()` replaces the snar file of the restarted tar, which only
+// contains the restarted members, by the snar file of the listing tar, and
+// prepends the members before the resume member to `out.log` and the listing
+// messages to `info.log`.  It then sets
+// the snar time to the time of the interrupted run, so that the next
+// incremental archive contains the files that have been modified since the
+// interrupted run started.
+func finishTarResume(dst string, plan *tarResume, t time.Time) error {
+	if plan != nil {
+		err := os.Rename(resumeSnarPath(dst), snarPath(dst))
+		if err != nil {
+			return err
+		}
+		if err := prependLog(dst, "out.log", plan.prefix); err != nil {
+			return err
+		}
+		if err := prependLog(dst, "info.log", plan.info); err != nil {
+			return err
+		}
+	}
+	return setSnarTime(snarPath(dst), t)
+}
+
+func prependLog(dst, name string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	path := filepath.Join(dst, name)
+	dat, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteString("\n")
+	}
+	buf.Write(dat)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// `setSnarTime()` sets the time of a GNU tar snar file in format 2, which
+// starts with a header line followed by the seconds and nanoseconds of the
+// time when tar started, each terminated by NUL.
+func setSnarTime(path string, t time.Time) error {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	nl := bytes.IndexByte(dat, '\n')
+	if nl < 0 || !bytes.HasSuffix(dat[:nl], []byte("-2")) {
+		return errors.New("unsupported snar file format")
+	}
+	fields := bytes.SplitN(dat[nl+1:], []byte{0}, 3)
+	if len(fields) != 3 {
+		return errors.New("malformed snar file")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(dat[:nl+1])
+	fmt.Fprintf(&buf, "%d\x00%d\x00", t.Unix(), t.Nanosecond())
+	buf.Write(fields[2])
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
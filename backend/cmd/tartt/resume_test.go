@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// `writeTestOrigin()` creates files of different sizes in two directories.
+func writeTestOrigin(t *testing.T, origin string) {
+	mtime := time.Unix(1539000000, 0)
+	for i, size := range []int{100, 5500, 0, 30000, 511, 512, 7000} {
+		dir := filepath.Join(origin, fmt.Sprintf("d%d", i%2))
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("file %d", i))
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if err := ioutil.WriteFile(path, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testTarArgs(file, snar string) []string {
+	return []string{
+		"--create",
+		"--verbose",
+		fmt.Sprintf("--file=%s", file),
+		fmt.Sprintf("--listed-incremental=%s", snar),
+		"--no-check-device",
+		"--sparse",
+	}
+}
+
+func runTestTar(t *testing.T, args []string) []byte {
+	cmd := exec.Command(tarTool.Path, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return stdout.Bytes()
+}
+
+type testTarMember struct {
+	offset int64
+	hdr    *tar.Header
+	data   []byte
+}
+
+// `readTestTar()` returns the members and the end of the last member.
+func readTestTar(t *testing.T, stream []byte) ([]testTarMember, int64) {
+	r := bytes.NewReader(stream)
+	tr := tar.NewReader(r)
+	pos := func() int64 { return int64(len(stream)) - int64(r.Len()) }
+	var members []testTarMember
+	offset := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, testTarMember{offset, hdr, data})
+		offset = (pos() + 511) / 512 * 512
+	}
+	return members, offset
+}
+
+// A tar that is restarted with the listing suffix as a file list creates the
+// members of the full tar from the resume member on.
+func TestTarResumeStream(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tartt-resume-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	origin := filepath.Join(tmp, "origin")
+	writeTestOrigin(t, origin)
+	originArgs := []string{fmt.Sprintf("--directory=%s", origin), "."}
+
+	full := runTestTar(t, append(
+		testTarArgs("-", filepath.Join(tmp, "full.snar")),
+		originArgs...,
+	))
+	fullMembers, fullEnd := readTestTar(t, full)
+
+	listArgs := append(
+		testTarArgs("/dev/null", filepath.Join(tmp, "list.snar")),
+		originArgs...,
+	)
+	listing, stderr, err := listTarMembers(
+		listArgs, append(os.Environ(), "LC_ALL=C"),
+	)
+	if err != nil {
+		t.Fatalf("listing failed: %v: %s", err, stderr)
+	}
+	if len(listing) != len(fullMembers) {
+		t.Fatalf("listing %v does not match tar", listing)
+	}
+	if _, ok := tarInfoLines(stderr); !ok {
+		t.Errorf("unexpected listing messages: %s", stderr)
+	}
+
+	for i, name := range listing {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		filesFrom := filepath.Join(tmp, "files")
+		err := ioutil.WriteFile(
+			filesFrom,
+			[]byte(strings.Join(listing[i:], "\x00")+"\x00"),
+			0666,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part := runTestTar(t, append(
+			testTarArgs("-", filepath.Join(tmp, "part.snar")),
+			fmt.Sprintf("--directory=%s", origin),
+			"--no-recursion",
+			"--null",
+			"--verbatim-files-from",
+			fmt.Sprintf("--files-from=%s", filesFrom),
+		))
+		_ = os.Remove(filepath.Join(tmp, "part.snar"))
+
+		partMembers, partEnd := readTestTar(t, part)
+		rest := fullMembers[i:]
+		if len(partMembers) != len(rest) {
+			t.Fatalf("restart at %s: %d members, expected %d",
+				name, len(partMembers), len(rest))
+		}
+		base := rest[0].offset
+		for k, m := range partMembers {
+			f := rest[k]
+			if m.offset+base != f.offset ||
+				m.hdr.Name != f.hdr.Name ||
+				!bytes.Equal(m.data, f.data) {
+				t.Errorf("restart at %s: member %s differs",
+					name, f.hdr.Name)
+			}
+		}
+		if base+partEnd != fullEnd {
+			t.Errorf("restart at %s: wrong end", name)
+		}
+	}
+}
+
+func TestSelectTarResume(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tartt-resume-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	origin := filepath.Join(tmp, "origin")
+	writeTestOrigin(t, origin)
+
+	listing := []string{
+		"./", "./d0/", "./d1/",
+		"./d0/file 0", "./d0/file 2", "./d0/file 4", "./d0/file 6",
+		"./d1/file 1", "./d1/file 3", "./d1/file 5",
+	}
+	point := func(name string, size int64) tarResumePoint {
+		return tarResumePoint{
+			size: size, mtime: 1539000000, typ: '0', name: name,
+		}
+	}
+	for _, c := range []struct {
+		name     string
+		points   []tarResumePoint
+		index    int
+		modified string
+		link     string
+	}{
+		{
+			name: "latest",
+			points: []tarResumePoint{
+				point("./d1/file 3", 30000),
+				point("./d0/file 6", 7000),
+			},
+			index: 8,
+		},
+		{
+			name: "modified",
+			points: []tarResumePoint{
+				point("./d1/file 3", 30000),
+				point("./d0/file 6", 7000),
+			},
+			modified: "d1/file 3",
+			index:    6,
+		},
+		{
+			name: "size",
+			points: []tarResumePoint{
+				point("./d1/file 3", 3000),
+				point("./d0/file 2", 0),
+			},
+			index: 4,
+		},
+		{
+			name: "directory",
+			points: []tarResumePoint{
+				{typ: '5', name: "./d1/"},
+			},
+			index: -1,
+		},
+		{
+			name:   "missing",
+			points: []tarResumePoint{point("./d1/x", 0)},
+			index:  -1,
+		},
+		{
+			name: "hardlink",
+			points: []tarResumePoint{
+				point("./d1/file 3", 30000),
+			},
+			link:  "d1/file 5",
+			index: -1,
+		},
+		{
+			name: "hardlink before",
+			points: []tarResumePoint{
+				point("./d1/file 3", 30000),
+			},
+			link:  "d0/file 0",
+			index: 8,
+		},
+	} {
+		path := func(name string) string {
+			return filepath.Join(origin, name)
+		}
+		if c.modified != "" {
+			mtime := time.Unix(1539000001, 0)
+			err := os.Chtimes(path(c.modified), mtime, mtime)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.link != "" {
+			err := os.Link(path(c.link), path("link"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		i, p := selectTarResume(origin, c.points, listing)
+		switch {
+		case c.index < 0 && p != nil:
+			t.Errorf("%s: unexpected resume at %s", c.name, p.name)
+		case c.index >= 0 && p == nil:
+			t.Errorf("%s: expected resume at %d", c.name, c.index)
+		case c.index >= 0 && (i != c.index || p.name != listing[i]):
+			t.Errorf("%s: expected %d, got %d", c.name, c.index, i)
+		}
+
+		if c.modified != "" {
+			mtime := time.Unix(1539000000, 0)
+			err := os.Chtimes(path(c.modified), mtime, mtime)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.link != "" {
+			if err := os.Remove(path("link")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestParseTarResumePoints(t *testing.T) {
+	points, err := parseTarResumePoints(
+		"15360 9000 1539000000 0 ./dir/a b\n" +
+			"512 0 1539000000 5 ./dir/\n",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []tarResumePoint{
+		{15360, 9000, 1539000000, '0', "./dir/a b"},
+		{512, 0, 1539000000, '5', "./dir/"},
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, points)
+	}
+	for i := range points {
+		if points[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], points[i])
+		}
+	}
+
+	for _, s := range []string{"1 2 3 0", "1 2 x 0 a", "1 2 3 00 a"} {
+		if _, err := parseTarResumePoints(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestTarInfoLines(t *testing.T) {
+	lines, ok := tarInfoLines([]byte(
+		"tar: ./a: Directory is new\n" +
+			"tar: ./b: Directory has been renamed from './c'\n",
+	))
+	if !ok || len(lines) != 2 {
+		t.Errorf("expected 2 info lines, got %v", lines)
+	}
+	if _, ok := tarInfoLines([]byte(
+		"tar: ./a: Directory is new\n" +
+			"tar: ./d: Cannot open: Permission denied\n",
+	)); ok {
+		t.Error("expected error messages to be rejected")
+	}
+}
+
+func TestSetSnarTime(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tartt-resume-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "origin.snar")
+
+	rest := "0\x0012\x0034\x00./a\x00\x00"
+	snar := "GNU tar-1.34-2\n1539000100\x00123\x00" + rest
+	if err := ioutil.WriteFile(path, []byte(snar), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := setSnarTime(path, time.Unix(1539000000, 456)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "GNU tar-1.34-2\n1539000000\x00456\x00" + rest
+	if string(got) != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	old := "GNU tar-1.26-1\n1539000100\n"
+	if err := ioutil.WriteFile(path, []byte(old), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := setSnarTime(path, time.Unix(1539000000, 0)); err == nil {
+		t.Error("expected error for snar format 1")
+	}
+}
+
+// A file that is moved into an archived directory before resuming must not be
+// listed before the resume member, since it is not in the kept chunks.
+func TestChangedTarDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tartt-resume-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	origin := filepath.Join(tmp, "origin")
+	writeTestOrigin(t, origin)
+	outside := filepath.Join(tmp, "moved")
+	if err := ioutil.WriteFile(outside, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Unix(1539000000, 0)
+	if err := os.Chtimes(outside, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sleep longer than the coarse file system clock tick around the
+	// archive time of the interrupted run.
+	time.Sleep(50 * time.Millisecond)
+	resumeTime := time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	listing := []string{
+		"./", "./d0/", "./d1/", "./d0/file 0", "./d1/file 1",
+	}
+	if dir := changedTarDir(origin, listing, resumeTime); dir != "" {
+		t.Fatalf("unexpected changed directory %s", dir)
+	}
+	moved := filepath.Join(origin, "d1", "moved")
+	if err := os.Rename(outside, moved); err != nil {
+		t.Fatal(err)
+	}
+	if dir := changedTarDir(origin, listing, resumeTime); dir != "./d1/" {
+		t.Errorf("expected changed directory ./d1/, got %q", dir)
+	}
+	// The moved file itself looks unchanged.
+	p := tarResumePoint{
+		size: 3, mtime: old.Unix(), typ: '0', name: "./d1/moved",
+	}
+	if !isUnchangedTarFile(origin, &p) {
+		t.Error("expected moved file with old mtime")
+	}
+}
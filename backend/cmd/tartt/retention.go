@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// `Retention` is the parsed `RetentionConfig`.  `minLifetime.Unit` is
+// `DurationUnitUnspecified` if the minimum lifetime is not configured.
+type Retention struct {
+	minLifetime    LevelDuration
+	keepLastChains int
+	keepFulls      []keepFullsRule
+}
+
+type keepFullsRule struct {
+	interval LevelDuration
+	lifetime LevelDuration
+}
+
+func newRetention(cfg RetentionConfig) (*Retention, error) {
+	r := &Retention{}
+
+	if cfg.MinLifetime != "" {
+		d, err := ParseDateTimeDuration(cfg.MinLifetime)
+		if err != nil {
+			err := fmt.Errorf(
+				"failed to parse minLifetime: %v", err,
+			)
+			return nil, err
+		}
+		r.minLifetime = d
+	}
+
+	if cfg.KeepLastChains < 0 {
+		return nil, errors.New("keepLastChains must not be negative")
+	}
+	r.keepLastChains = cfg.KeepLastChains
+
+	for i, c := range cfg.KeepFulls {
+		interval, err := ParseDateTimeDuration(c.Interval)
+		if err != nil {
+			err := fmt.Errorf(
+				"failed to parse keepFulls %d interval: %v",
+				i, err,
+			)
+			return nil, err
+		}
+		if interval.Unit == DurationZero {
+			err := fmt.Errorf(
+				"keepFulls %d interval must not be 0", i,
+			)
+			return nil, err
+		}
+		lifetime, err := ParseDateTimeDuration(c.Lifetime)
+		if err != nil {
+			err := fmt.Errorf(
+				"failed to parse keepFulls %d lifetime: %v",
+				i, err,
+			)
+			return nil, err
+		}
+		r.keepFulls = append(r.keepFulls, keepFullsRule{
+			interval: interval,
+			lifetime: lifetime,
+		})
+	}
+
+	return r, nil
+}
+
+func (d LevelDuration) String() string {
+	unit := ""
+	switch d.Unit {
+	case DurationUnitUnspecified:
+		return "unspecified"
+	case DurationZero:
+		return "0"
+	case DurationMinutes:
+		unit = "minute"
+	case DurationHours:
+		unit = "hour"
+	case DurationDays:
+		unit = "day"
+	case DurationMonths:
+		unit = "month"
+	default:
+		panic("invalid LevelDuration")
+	}
+	if d.Value != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", d.Value, unit)
+}
+
+// `Period()` returns the index of the calendar period of length `d` that
+// contains `t`, counting from the Unix epoch in UTC.  Months are counted as
+// calendar months, so that `1 month` selects one archive per month.
+func (d LevelDuration) Period(t time.Time) int64 {
+	t = t.UTC()
+	v := int64(d.Value)
+	switch d.Unit {
+	case DurationMinutes:
+		return t.Unix() / 60 / v
+	case DurationHours:
+		return t.Unix() / 3600 / v
+	case DurationDays:
+		return t.Unix() / 86400 / v
+	case DurationMonths:
+		return (int64(t.Year())*12 + int64(t.Month()) - 1) / v
+	default:
+		panic("invalid LevelDuration for Period()")
+	}
+}
+
+// `retentionPlan` tells which archives `gc` must keep in addition to the
+// level lifetimes.  Paths are relative to the store, like `TreeInfo.Path`.
+type retentionPlan struct {
+	now         time.Time
+	minLifetime LevelDuration
+	holds       []Hold
+	// `chains` are the full archives that are kept with all their
+	// incremental archives.
+	chains map[string]string
+	// `fulls` are the full archives that are kept by `keepFulls` rules.
+	fulls map[string][]string
+}
+
+func (s *Store) planRetention(
+	tree *Tree, holds []Hold, now time.Time,
+) *retentionPlan {
+	r := s.retention
+	p := &retentionPlan{
+		now:         now,
+		minLifetime: r.minLifetime,
+		holds:       holds,
+		chains:      make(map[string]string),
+		fulls:       make(map[string][]string),
+	}
+	if tree.Root == nil {
+		return p
+	}
+	fulls := tree.Root.Times
+
+	if n := r.keepLastChains; n > 0 {
+		start := len(fulls) - n
+		if start < 0 {
+			start = 0
+		}
+		for _, t := range fulls[start:] {
+			p.chains[t.Name()] = fmt.Sprintf(
+				"keepLastChains %d", n,
+			)
+		}
+	}
+
+	// Select the first full archive in each period.  If it has expired,
+	// no archive is kept for the period, so that the selection does not
+	// move to a later archive when the first one is removed.
+	for _, rule := range r.keepFulls {
+		seen := make(map[int64]struct{})
+		for _, t := range fulls {
+			period := rule.interval.Period(t.Time)
+			if _, ok := seen[period]; ok {
+				continue
+			}
+			seen[period] = struct{}{}
+			expires := rule.lifetime.AddTime(t.Time)
+			if expires.Before(now) {
+				continue
+			}
+			reason := fmt.Sprintf(
+				"keepFulls every %s for %s until %s",
+				rule.interval, rule.lifetime,
+				expires.Format(time.RFC3339),
+			)
+			p.fulls[t.Name()] = append(p.fulls[t.Name()], reason)
+		}
+	}
+
+	return p
+}
+
+// `keepReasons()` returns the reasons why the node at `path` with max time
+// `tmax` must be kept, or an empty list if it may be removed.  A hold keeps
+// the archive and its ancestors, which are required to restore it.
+func (p *retentionPlan) keepReasons(path string, tmax time.Time) []string {
+	var reasons []string
+
+	if p.minLifetime.Unit != DurationUnitUnspecified {
+		expires := p.minLifetime.AddTime(tmax)
+		if !expires.Before(p.now) {
+			reasons = append(reasons, fmt.Sprintf(
+				"minLifetime %s until %s",
+				p.minLifetime, expires.Format(time.RFC3339),
+			))
+		}
+	}
+
+	for _, h := range p.holds {
+		if h.Path == path || strings.HasPrefix(h.Path, path+"/") {
+			reasons = append(reasons, fmt.Sprintf(
+				"hold %s: %s", h.Path, h.Reason,
+			))
+		}
+	}
+
+	for full, reason := range p.chains {
+		if path == full || strings.HasPrefix(path, full+"/") {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	reasons = append(reasons, p.fulls[path]...)
+
+	return reasons
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+// `newRetentionTestStore()` returns a store whose root level contains full
+// archives at `times`, named by their timestamp.
+func newRetentionTestStore(
+	t *testing.T, cfg RetentionConfig, times ...string,
+) (*Store, *Tree) {
+	r, err := newRetention(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &LevelTree{name: "."}
+	for _, s := range times {
+		ts := mustParseTime(t, s)
+		root.Times = append(root.Times, &TimeTree{
+			name:    ts.Format(timestampTimeFormat2),
+			Time:    ts,
+			TarType: TarFull,
+		})
+	}
+	return &Store{retention: r}, &Tree{Root: root}
+}
+
+func tsName(t *testing.T, s string) string {
+	return mustParseTime(t, s).Format(timestampTimeFormat2)
+}
+
+func containsPrefix(ss []string, prefix string) bool {
+	for _, s := range ss {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPlanRetentionKeepLastChains(t *testing.T) {
+	times := []string{
+		"2019-01-01T00:00:00Z",
+		"2019-01-02T00:00:00Z",
+		"2019-01-03T00:00:00Z",
+	}
+	store, tree := newRetentionTestStore(
+		t, RetentionConfig{KeepLastChains: 2}, times...,
+	)
+	now := mustParseTime(t, "2019-06-01T00:00:00Z")
+	p := store.planRetention(tree, nil, now)
+
+	first := tsName(t, times[0])
+	last := tsName(t, times[2])
+	for _, c := range []struct {
+		path string
+		keep bool
+	}{
+		{first, false},
+		{first + "/s0/20190101T010000Z", false},
+		{tsName(t, times[1]), true},
+		{last, true},
+		// Incremental archives of a kept chain are kept, too.
+		{last + "/s0/20190103T010000Z", true},
+		// But not archives whose name has the full as prefix.
+		{last + "x", false},
+	} {
+		reasons := p.keepReasons(c.path, now)
+		keep := containsPrefix(reasons, "keepLastChains 2")
+		if keep != c.keep {
+			t.Errorf(
+				"%s: expected keep %v, got reasons %v",
+				c.path, c.keep, reasons,
+			)
+		}
+	}
+}
+
+func TestPlanRetentionKeepFulls(t *testing.T) {
+	times := []string{
+		"2019-01-05T00:00:00Z",
+		"2019-01-20T00:00:00Z",
+		"2019-02-03T00:00:00Z",
+	}
+	store, tree := newRetentionTestStore(t, RetentionConfig{
+		KeepFulls: []KeepFullsConfig{
+			{Interval: "1 month", Lifetime: "1 month"},
+		},
+	}, times...)
+
+	// The first full archive per month is kept until its lifetime ends.
+	now := mustParseTime(t, "2019-02-04T00:00:00Z")
+	p := store.planRetention(tree, nil, now)
+	for _, c := range []struct {
+		time string
+		keep bool
+	}{
+		{times[0], true},
+		{times[1], false},
+		{times[2], true},
+	} {
+		reasons := p.keepReasons(tsName(t, c.time), now)
+		keep := containsPrefix(reasons, "keepFulls every 1 month")
+		if keep != c.keep {
+			t.Errorf(
+				"%s: expected keep %v, got reasons %v",
+				c.time, c.keep, reasons,
+			)
+		}
+	}
+
+	// When the first archive of January has expired, the selection does
+	// not move to the second archive of January.
+	now = mustParseTime(t, "2019-02-10T00:00:00Z")
+	p = store.planRetention(tree, nil, now)
+	for _, c := range []struct {
+		time string
+		keep bool
+	}{
+		{times[0], false},
+		{times[1], false},
+		{times[2], true},
+	} {
+		reasons := p.keepReasons(tsName(t, c.time), now)
+		if keep := len(reasons) > 0; keep != c.keep {
+			t.Errorf(
+				"%s: expected keep %v, got reasons %v",
+				c.time, c.keep, reasons,
+			)
+		}
+	}
+}
+
+func TestKeepReasonsMinLifetimeAndHolds(t *testing.T) {
+	store, tree := newRetentionTestStore(t, RetentionConfig{
+		MinLifetime: "2 days",
+	})
+	holds := []Hold{{Path: "a/s0/b", Reason: "case 1"}}
+	now := mustParseTime(t, "2019-01-10T00:00:00Z")
+	p := store.planRetention(tree, holds, now)
+
+	recent := mustParseTime(t, "2019-01-09T00:00:00Z")
+	old := mustParseTime(t, "2019-01-01T00:00:00Z")
+
+	reasons := p.keepReasons("x", recent)
+	if len(reasons) != 1 ||
+		reasons[0] != "minLifetime 2 days until 2019-01-11T00:00:00Z" {
+		t.Errorf("expected minLifetime, got %v", reasons)
+	}
+
+	for _, c := range []struct {
+		path string
+		keep bool
+	}{
+		{"a/s0/b", true},
+		// A hold keeps the ancestors that are required to restore.
+		{"a", true},
+		{"a/s0/c", false},
+		{"ab", false},
+		{"a/s0/b/s1/c", false},
+	} {
+		reasons := p.keepReasons(c.path, old)
+		keep := len(reasons) == 1 && reasons[0] == "hold a/s0/b: case 1"
+		if keep != c.keep {
+			t.Errorf(
+				"%s: expected keep %v, got reasons %v",
+				c.path, c.keep, reasons,
+			)
+		}
+	}
+}
+
+func TestNewRetentionRejectsInvalid(t *testing.T) {
+	for _, cfg := range []RetentionConfig{
+		{MinLifetime: "2 fortnights"},
+		{KeepLastChains: -1},
+		{KeepFulls: []KeepFullsConfig{
+			{Interval: "0", Lifetime: "1 month"},
+		}},
+		{KeepFulls: []KeepFullsConfig{
+			{Interval: "1 month", Lifetime: "x"},
+		}},
+	} {
+		if _, err := newRetention(cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
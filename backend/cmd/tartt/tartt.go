@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/docopt/docopt-go"
 	"github.com/nogproject/nog/backend/pkg/mulog"
+	"github.com/nogproject/nog/backend/pkg/trace"
 )
 
 // `xVersion` and `xBuild` are injected by the `Makefile`.
@@ -28,31 +30,61 @@ func qqBackticks(s string) string {
 var usage = qqBackticks(strings.TrimSpace(`
 Usage:
   tartt [-C <repo>] init [--store=<name>] --origin=<absdir> [--driver-localtape-tardir=<absdir>]
-  tartt [-C <repo>] tar (--recipient=<gpgid>...|--plaintext-secret|--insecure-plaintext) [--cipher-algo=<cipher>] [--warning-fatal|--error-continue] [--store=<name>] [--lock-wait=<duration>] [--limit=<bandwidth>] [--full] [--full-hook=<cmd>]
+  tartt [-C <repo>] tar (--recipient=<gpgid>...|--native-recipients|--plaintext-secret|--insecure-plaintext) [--cipher-algo=<cipher>] [--warning-fatal|--error-continue] [--store=<name>] [--lock-wait=<duration>] [--limit=<bandwidth>] [--jobs=<n>] [--full] [--full-hook=<cmd>] [--resume [--identity-file=<path>]]
   tartt [-C <repo>] sign [--no-skip-signed|--skip-good-from=<substring>] <tspaths>...
-  tartt [-C <repo>] ls-tar [--no-lock] [--no-preload-secrets] [--notify-preload-secrets-done=<path>] [--limit=<bandwidth>] [--unquote] [-z] <tspath>
-  tartt [-C <repo>] restore [--no-lock] [--no-preload-secrets] [--notify-preload-secrets-done=<path>] [--limit=<bandwidth>] [--no-same-owner] [--no-same-permissions] --dest=<emptydir> <tspath> [--] [<members>...]
-  tartt [-C <repo>] ls [--no-lock]
-  tartt [-C <repo>] gc [--dry-run] [--lock-wait=<duration>]
+  tartt [-C <repo>] rekey (--recipient=<gpgid>...|--native-recipients) [--identity-file=<path>] [--dry-run] [--lock-wait=<duration>] [<tspaths>...]
+  tartt [-C <repo>] ls-tar [--no-lock] [--identity-file=<path>] [--no-preload-secrets] [--notify-preload-secrets-done=<path>] [--limit=<bandwidth>] [--unquote] [-z] <tspath>
+  tartt [-C <repo>] restore [--no-lock] [--identity-file=<path>] [--no-preload-secrets] [--notify-preload-secrets-done=<path>] [--limit=<bandwidth>] [--no-same-owner] [--no-same-permissions] --dest=<emptydir> (<tspath>|--at=<timestamp> [--store=<name>]) [--] [<members>...]
+  tartt [-C <repo>] find [--no-lock] [--identity-file=<path>] [--no-preload-secrets] [--notify-preload-secrets-done=<path>] [--store=<name>] [--limit=<bandwidth>] [--unquote] <member-glob>
+  tartt [-C <repo>] ls [--no-lock] [--compare]
+  tartt [-C <repo>] replicate --from=<store> --to=<store> [--dry-run] [--lock-wait=<duration>]
+  tartt [-C <repo>] gc [--dry-run] [--explain] [--lock-wait=<duration>]
+  tartt [-C <repo>] hold add --reason=<text> [--lock-wait=<duration>] <tspaths>...
+  tartt [-C <repo>] hold rm [--lock-wait=<duration>] <tspaths>...
+  tartt [-C <repo>] hold ls
   tartt [-C <repo>] lock [--lock-wait=<duration>] [--] <cmd>...
   tartt [-C <repo>] backup (--recipient=<gpgid>...|--insecure-plaintext) [--full] [--limit=<bandwidth>] [--warning-fatal|--error-continue] [--full-hook=<cmd>]
 
 Options:
   -C <repo>          Run as if tartt was started in ''<repo>''.
   --store=<name>     Name of the store.  ''init'' by default uses the hostname.
-                     ''tar'' by default uses the first store.
+                     ''tar'', ''restore --at'', and ''find'' by default use
+                     the first store.
   --origin=<absdir>  The directory to be archived.
   --dest=<emptydir>  Empty directory for restore.
+  --at=<timestamp>   Restore the state as of the time, given as RFC 3339, as
+                     tspath timestamp like ''20181007T112102Z'', or as date
+                     ''2018-10-07'', which means midnight UTC.
+  --from=<store>     Name of the store from which ''replicate'' copies.
+  --to=<store>       Name of the store to which ''replicate'' copies.
+  --compare          List archives of all stores with per-store presence.
   --lock-wait=<duration>  [default: 5s]
                      Maximum time to wait for a lock.
   --no-lock          Do not lock the store, which is safe with concurrent
                      append-only operations, specifically ''tar''.
-  --dry-run          Print what would be removed without removing anything.
+  --dry-run          Print what would be changed without changing anything.
+  --explain          Print for each archive whether ''gc'' keeps or removes it
+                     and why.
+  --reason=<text>    Reason for a hold, like a case reference.
   --full             Force a full tar archive.
+  --resume           Continue the latest incomplete archive.  See below.
   --limit=<bandwidth>  Bandwidth limit in bytes per second on the uncompressed
                      tar stream.  ''k'', ''m'', ... can be used, which are
                      interpreted as binary SI.
+  --jobs=<n>         Number of data chunks that ''tartt-store'' compresses and
+                     encrypts in parallel.  The default depends on the number
+                     of CPUs.  The maximum is 12.  The archive does not depend
+                     on ''--jobs''.
   --recipient=<gpgid>  GPG keys to which to encrypt the archive secret.
+                     ''rekey'' uses them as the new recipients.
+  --native-recipients  Encrypt the archive secret to the public keys from the
+                     config ''encryption.recipients'' and encrypt data
+                     without gpg2.  See below.  ''rekey'' uses them as the
+                     new recipients.
+  --identity-file=<path>  Decrypt archive secrets and data without gpg2,
+                     using the unprotected OpenPGP private keys from
+                     ''<path>'', for example as exported with ''gpg2
+                     --export-secret-keys''.
   --plaintext-secret   Save archive secret as plaintext.
   --cipher-algo=<cipher>  [default: AES]
                      Passed via ''tartt-store'' to ''gpg --cipher-algo'' when
@@ -89,6 +121,31 @@ archive or an incremental archive.  A full archive can be forced with
 ''tartt-store --help'' for details, including suggestions how to read the
 low-level tar stream.
 
+''tartt tar'' also saves a member catalog ''data.tar.catalog.gpg'', or
+''data.tar.catalog'' without encryption, which lists for each tar member its
+size, mtime, mode, and byte range in the tar stream.  The catalog is stored in
+the local archive directory, also for stores whose data is on tape.
+
+''tartt tar'' saves checkpoints of the data tar while it is running.  If
+''tartt tar'' is interrupted or fails, the incomplete archive is kept in its
+''.inprogress'' directory.  ''tartt tar --resume'' continues the latest
+incomplete archive of the store, which must be newer than all complete
+archives.  Use the same encryption options as for the interrupted run.
+''--resume'' decrypts ''secret.asc'' with gpg2 or ''--identity-file'', like
+''tartt restore'', so that the remaining data is encrypted with the same
+secret.  ''tartt tar --resume'' lists the tar members with ''--file=/dev/null'',
+which does not read file data, and restarts tar at the latest checkpointed
+member that is an unchanged file after which only files follow.  If there is
+no such member, a directory has been modified since the interrupted run, or
+the listing reports errors, it restarts tar from the start.
+''tartt-store'' verifies that the members in the already saved chunks are
+unchanged and continues saving from the last verified chunk, so that the
+result is a single valid archive.  Files that have been modified since the
+interrupted run are detected by their size and mtime, like tar detects
+modified files.  The snar file uses the time of the interrupted run, so that
+the next incremental archive contains files that have been modified since
+then.  ''tartt gc'' removes incomplete archives after 5 days.
+
 If the repo root contains a file ''exclude'', it is copied to the archive and
 applied as an anchored exclude list: ''tar --anchored --exclude-from=exclude''.
 
@@ -103,12 +160,41 @@ their names to stdout, one per line, to tell ''tartt'' to include the files in
 ''metadata.tar''.  As a special case, ''README.md'' will not be added to
 ''metadata.tar'' but included as plaintext in the general ''README.md''.
 
-''tartt sign'' signs archive manifests with the default GPG key.  For example,
-to sign all manifests that you have not yet signed:
+''--native-recipients'' encrypts without running gpg2.  The public keys are
+configured in ''tarttconfig.yml'' as ASCII-armored key blocks:
+
+    encryption:
+      recipients:
+        - |
+          -----BEGIN PGP PUBLIC KEY BLOCK-----
+          ...
+          -----END PGP PUBLIC KEY BLOCK-----
+
+The archive format is the same as with ''--recipient''.  Archives can be
+restored either with gpg2 or with ''--identity-file'', independently of how
+they have been created.  The native implementation supports RSA and ElGamal
+keys but not ECDH keys, such as Curve25519.
+
+''tartt sign'' signs archive manifests with the default GPG key.  It always
+runs gpg2 to sign and to verify existing signatures; ''--identity-file'' and
+''--native-recipients'' do not apply to it.  For example, to sign all
+manifests that you have not yet signed:
 
     tartt ls | grep Z$ | cut -d $'\t' -f 2 \
     | xargs tartt sign --skip-good-from=<your-primary-email>
 
+''tartt rekey'' re-encrypts the per-archive secrets ''secret.asc'' to the
+''--recipient'' keys, which is useful to rotate access after the archive
+recipients have changed.  Data files are not modified.  ''tartt rekey'' by
+default processes all archives in all stores; ''<tspaths>'' restricts it to
+specific archives.  GnuPG must be able to decrypt the current secrets, see
+agent forwarding below, unless ''--identity-file'' is used.  Secrets that are
+already encrypted to exactly the recipients are skipped, so that an
+interrupted rekey can simply be repeated.  Each secret is written to a
+temporary file whose recipients are verified before it atomically replaces
+''secret.asc''.  Archives with plaintext secrets or without encryption are
+skipped.  Progress is logged as ''<n>/<total>''.
+
 ''tartt ls-tar'' lists archive members for the full and incremental archives
 that lead to ''<tspath>''.  The output are lines:
 
@@ -117,6 +203,10 @@ that lead to ''<tspath>''.  The output are lines:
 ''<tar-member-names>'' are quoted in style "escape" as describe in the GNU tar
 manual "Quoting Member Names".  Use ''--unquote'' for literal names.
 
+''tartt ls-tar'' and ''tartt find'' read the member catalog if an archive has
+one, without loading the archive data.  For older archives without catalog,
+they read the member list from the archive metadata.
+
 Use ''-z'' to terminate lines with NUL instead of newline.  For example, to
 create a list of paths that match a pattern:
 
@@ -138,6 +228,15 @@ are missing in some archives; ''tartt'' logs such errors and ignores them,
 because it is expected that files may be missing in incremental archives.  The
 restore may nontheless be correct.
 
+If an archive has a member catalog, ''tartt restore'' with ''<members>'' uses
+the catalog to load only the data chunks that contain the selected members,
+and it skips archives that contain none of them.  Archives without catalog are
+loaded completely.
+
+''tartt restore --at=<timestamp>'' selects the latest archive at or before the
+time in store ''--store'' and restores its archive chain, as if its tspath had
+been passed.  The selected tspath is logged.
+
 ''tartt restore'' tries to restore the owner and permissions by default, even
 if run as non-root.  Use ''--no-same-owner'' and ''--no-same-permissions'' to
 control the behavior.
@@ -147,7 +246,21 @@ agent forwarding, see <https://wiki.gnupg.org/AgentForwarding>.  ''tartt'' will
 by default decrypt all required secrets during startup and keep them in memory
 until they are needed for untar.  The GnuPG agent can then be disconnected.
 ''--no-preload-secrets'' disables preloading; the GnuPG agent is contacted
-right before each untar.
+right before each untar.  ''tartt ls-tar'' and ''tartt find'' preload secrets
+in the same way.  Archives that have been created with ''--insecure-plaintext''
+have no secret, which is not an error.
+
+''tartt find'' lists the archives that contain tar members that match
+''<member-glob>'', in order of archive time, as lines:
+
+    <time> <tspath> <colon> <space> <tar-member-name>
+
+''<member-glob>'' uses Go ''path.Match()'' syntax; ''*'' does not match ''/''.
+A leading ''./'' and a trailing ''/'' are ignored when matching.  Incremental
+archives contain only files that have changed, so that the lines list the
+versions of a file over time.  A version can be restored with:
+
+    tartt restore --dest=<emptydir> <tspath> -- <tar-member-name>
 
 ''tartt ls'' lists the archive tar time tree as lines:
 
@@ -165,13 +278,77 @@ Where:
 
 The fields may be separated by multiple spaces for alignment.
 
+''tartt ls --compare'' lists the archives of all stores as lines:
+
+    <marks> <type> <time><tab><path>
+
+Where ''<marks>'' contains ''+<store>'' or ''-<store>'' for each store in
+config order, indicating whether the archive is present in the store,
+''<time>'' is the archive time, and ''<path>'' is the archive directory path
+without the store name.
+
+''tartt replicate'' copies the full and patch archives that are missing in
+store ''--to'' from store ''--from'', for example to keep an off-site copy in a
+''localtape'' store without re-tarring origin.  Files that are listed in
+''manifest.shasums'' are verified by size and SHA-256 while copying.  Both
+stores must use the same levels.  To add a store to an existing repo, add it
+to ''stores'' in ''tarttconfig.yml'' and create the directory
+''stores/<name>''.  Replicate locks both stores.  If a copy fails, the partial
+archive is removed, so that replicate can simply be repeated.
+
 ''tartt gc'' removes expired archives and unnecessary details from frozen
 archives.
 
+An archive expires when the lifetime of its level has passed after the latest
+archive below it.  The archive that contains the latest archive is always
+kept.  A store may configure additional retention rules in
+''tarttconfig.yml'', which keep archives even if their level lifetime has
+expired:
+
+    stores:
+      - name: ...
+        levels: ...
+        retention:
+          minLifetime: "30 days"
+          keepLastChains: 3
+          keepFulls:
+            - { interval: "1 month", lifetime: "84 months" }
+
+ - ''minLifetime'' is a minimum lifetime for all archives, which ''gc'' does
+   not override, even if a level lifetime is shorter.
+ - ''keepLastChains'' keeps the latest full archives with all their
+   incremental archives, regardless of their age.
+ - ''keepFulls'' keeps for each ''interval'', counted as calendar periods in
+   UTC, the first full archive until ''lifetime'' has passed after its time.
+   The example keeps monthly full archives for 7 years.  Incremental archives
+   below a full archive still expire with their levels.
+
+''tartt hold add'' places a legal hold on archives.  ''gc'' keeps an archive
+that is on hold and the archives that lead to it, which are required to
+restore it.  ''tartt hold rm'' removes holds, and ''tartt hold ls'' lists them
+as lines:
+
+    <time> <tspath><tab><reason>
+
+Holds are stored in the file ''holds.yml'' in the store directory and modified
+while holding the store lock.
+
+''tartt gc --explain'' prints for each archive a line:
+
+    <decision> <path><tab><reasons>
+
+Where ''<decision>'' is ''keep'' or ''remove''.  ''<reasons>'' are separated by
+semicolons.  ''--explain'' can be combined with ''--dry-run''.
+
 ''tartt lock'' runs ''<cmd>...'' in the tartt repository while holding a lock
 on the repo and all its stores.  The exit code is the exit code of ''<cmd>'';
 or it is 1 if an error happens before starting ''<cmd>''.
 
+If the environment variable ''TRACEPARENT'' is set, tartt records a trace span
+for the command as a child of it, and subprocesses continue the trace.  The
+span is exported to ''NOG_TRACE_EXPORT'' if set.  Nogfsostad and nogfsorstd
+set both when they run tartt with ''--trace''.
+
 `))
 
 type Logger interface {
@@ -192,29 +369,77 @@ func main() {
 		}
 	}
 
+	// Continue the trace of the caller, like nogfsostad, which passes
+	// `TRACEPARENT` and `NOG_TRACE_EXPORT`.  Subprocesses, like
+	// tartt-store, inherit the environment with the tartt span as parent.
+	ctx := trace.FromEnviron(context.Background())
+	closeTracing, err := trace.StartExporterFromEnviron(lg, "tartt")
+	if err != nil {
+		lg.Fatalw("Failed to start trace export.", "err", err)
+	}
+	_, span := trace.Start(ctx, "tartt/"+cmdName(args), trace.KindInternal)
+	err = os.Setenv(trace.EnvTraceparent, span.Context().Traceparent())
+	if err != nil {
+		lg.Fatalw("Failed to set TRACEPARENT.", "err", err)
+	}
+
+	code := dispatch(args)
+	span.End()
+	closeTracing()
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+var cmdNames = []string{
+	"init", "backup", "tar", "sign", "rekey", "ls-tar", "restore", "find",
+	"hold", "ls", "replicate", "gc", "lock",
+}
+
+func cmdName(args map[string]interface{}) string {
+	for _, c := range cmdNames {
+		if args[c].(bool) {
+			return c
+		}
+	}
+	panic("unhandled args")
+}
+
+// `dispatch()` runs the command and returns the exit code.  Most commands exit
+// directly on error.
+func dispatch(args map[string]interface{}) int {
 	switch {
 	case args["init"].(bool):
 		cmdInit(args)
 	case args["backup"].(bool):
 		lg.Warnw("DEPRECATED command `backup`.  Use `tar` instead.")
-		cmdTar(args)
+		return cmdTar(args)
 	case args["tar"].(bool):
-		cmdTar(args)
+		return cmdTar(args)
 	case args["sign"].(bool):
 		cmdSign(args)
+	case args["rekey"].(bool):
+		cmdRekey(args)
 	case args["ls-tar"].(bool):
 		cmdLsTar(args)
 	case args["restore"].(bool):
 		cmdRestore(args)
+	case args["find"].(bool):
+		cmdFind(args)
+	case args["hold"].(bool):
+		cmdHold(args)
 	case args["ls"].(bool):
 		cmdLs(args)
+	case args["replicate"].(bool):
+		cmdReplicate(args)
 	case args["gc"].(bool):
 		cmdGc(args)
 	case args["lock"].(bool):
-		os.Exit(cmdLock(args))
+		return cmdLock(args)
 	default:
 		panic("unhandled args")
 	}
+	return 0
 }
 
 func argparse() map[string]interface{} {
@@ -253,6 +478,14 @@ func argparse() map[string]interface{} {
 		}
 	}
 
+	if arg, ok := args["--jobs"].(string); ok {
+		v, err := parseJobs(arg)
+		if err != nil {
+			lg.Fatalw("Invalid --jobs.", "err", err)
+		}
+		args["--jobs"] = v
+	}
+
 	switch args["--cipher-algo"].(string) {
 	case "AES", "AES192", "AES256":
 		break // ok
@@ -263,6 +496,21 @@ func argparse() map[string]interface{} {
 	return args
 }
 
+// `maxJobs` is the maximum of `tartt-store save --jobs`.
+const maxJobs = 12
+
+func parseJobs(s string) (int, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if v < 1 || v > maxJobs {
+		err := fmt.Errorf("must be between 1 and %d, got %d", maxJobs, v)
+		return 0, err
+	}
+	return int(v), nil
+}
+
 var siMap = map[string]uint64{
 	"k": 1 << 10,
 	"m": 1 << 20,
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docopt/docopt-go"
+)
+
+func TestParseJobs(t *testing.T) {
+	for _, c := range []struct {
+		arg  string
+		jobs int
+		ok   bool
+	}{
+		{"1", 1, true},
+		{"4", 4, true},
+		{"12", 12, true},
+		{"0", 0, false},
+		{"13", 0, false},
+		{"-1", 0, false},
+		{"x", 0, false},
+		{"", 0, false},
+	} {
+		v, err := parseJobs(c.arg)
+		if c.ok && (err != nil || v != c.jobs) {
+			t.Errorf(
+				"%q: expected %d, got %d, %v",
+				c.arg, c.jobs, v, err,
+			)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%q: expected error, got %d", c.arg, v)
+		}
+	}
+}
+
+// `tartt tar --jobs` is passed to `tartt-store save`.
+func TestTarJobsArgs(t *testing.T) {
+	for _, c := range []struct {
+		argv     []string
+		expected []string
+	}{
+		{
+			[]string{"tar", "--insecure-plaintext", "--jobs=3"},
+			[]string{"--jobs=3"},
+		},
+		{
+			[]string{
+				"tar", "--insecure-plaintext", "--resume",
+				"--jobs=2",
+			},
+			[]string{"--jobs=2"},
+		},
+		{
+			[]string{"tar", "--insecure-plaintext"},
+			nil,
+		},
+	} {
+		const help, optionsFirst, exit = true, false, false
+		args, err := docopt.Parse(
+			usage, c.argv, help, version, optionsFirst, exit,
+		)
+		if err != nil {
+			t.Fatalf("%v: %v", c.argv, err)
+		}
+		if arg, ok := args["--jobs"].(string); ok {
+			v, err := parseJobs(arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args["--jobs"] = v
+		}
+		got := storeJobsArgs(args)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf(
+				"%v: expected %v, got %v",
+				c.argv, c.expected, got,
+			)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/nogproject/nog/backend/pkg/execx"
 )
@@ -38,11 +39,21 @@ var tarttIsDirTool = execx.MustLookTool(execx.ToolSpec{
 	CheckText: "tartt-is-dir-",
 })
 
-var gpg2Tool = execx.MustLookTool(execx.ToolSpec{
-	Program:   "gpg2",
-	CheckArgs: []string{"--version"},
-	CheckText: "gpg (GnuPG) 2.",
-})
+var gpg2ToolOnce sync.Once
+var gpg2ToolFound *execx.Tool
+
+// `gpg2Tool()` looks up gpg2 on first use, so that native encryption with
+// `--native-recipients` and `--identity-file` works without gpg2.
+func gpg2Tool() *execx.Tool {
+	gpg2ToolOnce.Do(func() {
+		gpg2ToolFound = execx.MustLookTool(execx.ToolSpec{
+			Program:   "gpg2",
+			CheckArgs: []string{"--version"},
+			CheckText: "gpg (GnuPG) 2.",
+		})
+	})
+	return gpg2ToolFound
+}
 
 type TarFeatures struct {
 	ListedIncrementalMtime bool
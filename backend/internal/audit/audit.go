@@ -0,0 +1,152 @@
+// Package `audit` defines the records of the nogfso audit log and how they
+// are hash-chained.
+//
+// Each record contains the SHA-256 hash of the previous record in `Prev` and
+// its own hash in `Hash`.  The hash is computed from the canonical JSON of the
+// record with an empty `Hash`.  Modifying, inserting, or removing a record
+// breaks the chain, which `Verifier` detects.  The first record has an empty
+// `Prev`.
+//
+// Nogfsoregd stores the log; see package `nogfsoregd/auditd`.  Clients
+// receive records as canonical JSON, so that they can verify the hashes
+// without depending on the storage format.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Record struct {
+	Seq    int64     `json:"seq"`
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+
+	// `Subject` and `Unix` identify the caller from the JWT claims `sub`
+	// and `xcrd`.
+	Subject string         `json:"subject,omitempty"`
+	Unix    []UnixIdentity `json:"unix,omitempty"`
+
+	// `Actions` are the authorization checks of the call.
+	Actions []Action `json:"actions"`
+
+	// `Code` is the gRPC status code.  `Error` is the status message if
+	// the call failed.
+	Code  string `json:"code"`
+	Error string `json:"error,omitempty"`
+
+	// `Vid` is the event id that the call returned, if any.  Calls that
+	// modify several entities, like workflow begin calls, return an event
+	// id per entity, which is recorded in the corresponding `<entity>Vid`.
+	Vid              string `json:"vid,omitempty"`
+	MainVid          string `json:"mainVid,omitempty"`
+	RegistryVid      string `json:"registryVid,omitempty"`
+	RepoVid          string `json:"repoVid,omitempty"`
+	WorkflowIndexVid string `json:"workflowIndexVid,omitempty"`
+	WorkflowVid      string `json:"workflowVid,omitempty"`
+	Workflow         string `json:"workflow,omitempty"`
+
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+type UnixIdentity struct {
+	Domain     string   `json:"domain"`
+	Username   string   `json:"username"`
+	Groupnames []string `json:"groupnames,omitempty"`
+}
+
+// `Action` is an authorization check.  `Target` is the path or the name from
+// the action details.
+type Action struct {
+	Action  string `json:"action"`
+	Target  string `json:"target,omitempty"`
+	Allowed bool   `json:"allowed"`
+}
+
+// `Canonical()` returns the JSON that is hashed.  Time is encoded as UTC with
+// millisecond precision, which is the precision of MongoDB.
+func (r *Record) Canonical() ([]byte, error) {
+	c := *r
+	c.Time = NormalizeTime(r.Time)
+	return json.Marshal(&c)
+}
+
+func NormalizeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// `ComputeHash()` returns the hash of the record with an empty `Hash`.
+func (r *Record) ComputeHash() (string, error) {
+	c := *r
+	c.Hash = ""
+	buf, err := c.Canonical()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// `Chain()` sets `Seq`, `Prev`, and `Hash` to append the record after `prev`,
+// which is `nil` for the first record.
+func (r *Record) Chain(prev *Record) error {
+	if prev == nil {
+		r.Seq = 1
+		r.Prev = ""
+	} else {
+		r.Seq = prev.Seq + 1
+		r.Prev = prev.Hash
+	}
+	r.Time = NormalizeTime(r.Time)
+	h, err := r.ComputeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = h
+	return nil
+}
+
+// `Verifier` checks a sequence of records.  If the sequence does not start at
+// the first record, the first record is trusted to link to its predecessor.
+type Verifier struct {
+	prev *Record
+}
+
+func (v *Verifier) Verify(r *Record) error {
+	h, err := r.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if h != r.Hash {
+		return fmt.Errorf("record %d: hash mismatch", r.Seq)
+	}
+
+	switch {
+	case v.prev != nil:
+		if r.Seq != v.prev.Seq+1 {
+			return fmt.Errorf(
+				"record %d: expected seq %d",
+				r.Seq, v.prev.Seq+1,
+			)
+		}
+		if r.Prev != v.prev.Hash {
+			return fmt.Errorf(
+				"record %d: prev does not match hash of "+
+					"record %d",
+				r.Seq, v.prev.Seq,
+			)
+		}
+	case r.Seq == 1:
+		if r.Prev != "" {
+			return fmt.Errorf("record 1: non-empty prev")
+		}
+	}
+
+	c := *r
+	v.prev = &c
+	return nil
+}
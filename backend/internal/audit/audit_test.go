@@ -0,0 +1,77 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/audit"
+)
+
+func chain(t *testing.T, n int) []*audit.Record {
+	var rs []*audit.Record
+	var prev *audit.Record
+	for i := 0; i < n; i++ {
+		r := &audit.Record{
+			Time:   time.Now(),
+			Method: "/nogfso.Repos/InitRepo",
+			Actions: []audit.Action{
+				{Action: "fso/init-repo", Target: "/a", Allowed: true},
+			},
+			Code: "OK",
+		}
+		if err := r.Chain(prev); err != nil {
+			t.Fatalf("Chain() failed: %v", err)
+		}
+		rs = append(rs, r)
+		prev = r
+	}
+	return rs
+}
+
+func verify(rs []*audit.Record) error {
+	var v audit.Verifier
+	for _, r := range rs {
+		if err := v.Verify(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestChainVerify(t *testing.T) {
+	rs := chain(t, 3)
+	if rs[0].Seq != 1 || rs[2].Seq != 3 {
+		t.Fatalf("wrong seqs %d, %d", rs[0].Seq, rs[2].Seq)
+	}
+	if rs[1].Prev != rs[0].Hash {
+		t.Errorf("prev does not link to previous hash")
+	}
+	if err := verify(rs); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+	if err := verify(rs[1:]); err != nil {
+		t.Errorf("Verify() of suffix failed: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	rs := chain(t, 3)
+	rs[1].Code = "PermissionDenied"
+	if err := verify(rs); err == nil {
+		t.Errorf("expected error for modified record")
+	}
+
+	rs = chain(t, 3)
+	if err := verify([]*audit.Record{rs[0], rs[2]}); err == nil {
+		t.Errorf("expected error for removed record")
+	}
+
+	rs = chain(t, 3)
+	rs[1].Actions[0].Allowed = false
+	if err := rs[1].Chain(rs[0]); err != nil {
+		t.Fatalf("Chain() failed: %v", err)
+	}
+	if err := verify(rs); err == nil {
+		t.Errorf("expected error for rehashed record")
+	}
+}
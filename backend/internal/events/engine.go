@@ -160,6 +160,7 @@ func (eng *Engine) tellIdVidRetryNoVC(
 		case i == cfgRetryN:
 			return vid, &RetryNoVCError{Err: err}
 		case errorsx.IsPred(err, IsVersionConflictError):
+			versionConflictRetriesTotal.With(eng.events.ns).Inc()
 			jitter := time.Duration(
 				rand.Int63n(int64(cfgRetrySleepJitter)),
 			)
@@ -96,11 +96,14 @@ type JournalDoc struct {
 }
 
 type Journal struct {
+	ns         string
 	events     *mgo.Collection
 	refs       *mgo.Collection
 	journal    *mgo.Collection
 	notifier   *notifier
 	trimPolicy TrimPolicy
+	// `pollInterval` is zero if polling is disabled.
+	pollInterval time.Duration
 }
 
 /*
@@ -151,6 +154,7 @@ func NewJournal(conn *mgo.Session, ns string) (*Journal, error) {
 	journal := conn.DB("").C(ns + ".journal")
 
 	return &Journal{
+		ns:       ns,
 		events:   events,
 		refs:     refs,
 		journal:  journal,
@@ -166,9 +170,20 @@ func (j *Journal) SetTrimPolicy(tp TrimPolicy) {
 }
 
 func (j *Journal) Serve(ctx context.Context) error {
+	if j.pollInterval > 0 {
+		go j.poll(ctx)
+	}
 	return j.notifier.serve(ctx)
 }
 
+// `Ping()` checks that MongoDB is reachable.  It uses a copy of the journal
+// session, so that a failed ping does not affect the shared session.
+func (j *Journal) Ping() error {
+	s := j.events.Database.Session.Copy()
+	defer s.Close()
+	return s.Ping()
+}
+
 func (j *Journal) Head(historyId uuid.I) (ulid.I, error) {
 	var refs RefsDoc
 	err := j.refs.Find(bson.M{
@@ -244,6 +259,18 @@ func (j *Journal) Commit(
 		return evs, nil
 	}
 
+	start := time.Now()
+	evs, err := j.commit(historyId, evs)
+	commitSeconds.With(j.ns).ObserveSince(start)
+	if IsVersionConflictError(err) {
+		versionConflictsTotal.With(j.ns).Inc()
+	}
+	return evs, err
+}
+
+func (j *Journal) commit(
+	historyId uuid.I, evs []Event,
+) ([]Event, error) {
 	evs, err := eventsWithId(evs)
 	if err != nil {
 		return nil, &InternalError{
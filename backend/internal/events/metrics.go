@@ -0,0 +1,34 @@
+package events
+
+import (
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+// The metrics use the journal namespace as label `journal`, like
+// `evjournal.fsomain`.
+var (
+	commitSeconds = metrics.NewHistogramVec(
+		"nogfso_events_commit_seconds",
+		"Duration of event journal commits.",
+		metrics.DefBuckets,
+		"journal",
+	)
+	versionConflictsTotal = metrics.NewCounterVec(
+		"nogfso_events_version_conflicts_total",
+		"Number of event journal commits that failed "+
+			"with a version conflict.",
+		"journal",
+	)
+	versionConflictRetriesTotal = metrics.NewCounterVec(
+		"nogfso_events_version_conflict_retries_total",
+		"Number of commands that the engine retried "+
+			"after a version conflict.",
+		"journal",
+	)
+	pollErrorsTotal = metrics.NewCounterVec(
+		"nogfso_events_poll_errors_total",
+		"Number of failed polls for heads that other processes "+
+			"committed.",
+		"journal",
+	)
+)
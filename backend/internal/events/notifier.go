@@ -60,7 +60,22 @@ func (n *notifier) unsubscribe(ch chan<- uuid.I) {
 // `post(topic)` is an async non-blocking broadcast to the subscribed channels.
 // Notifications are dropped if a subscribed channel is not ready to receive.
 func (n *notifier) post(topic uuid.I) {
-	n.do <- func(context.Context) {
+	n.do <- n.postFunc(topic)
+}
+
+// `postCtx()` is like `post()` but gives up when `ctx` is cancelled, so that
+// it does not block forever after `serve()` returned.
+func (n *notifier) postCtx(ctx context.Context, topic uuid.I) bool {
+	select {
+	case n.do <- n.postFunc(topic):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (n *notifier) postFunc(topic uuid.I) func(context.Context) {
+	return func(context.Context) {
 		for ch, sel := range n.outputs {
 			if sel == WildcardTopic || sel == topic {
 				// Non-blocking.
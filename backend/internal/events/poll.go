@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// `pollOverlap` is subtracted from the start of each poll to tolerate clock
+// differences between processes and commits that take a while.
+var pollOverlap = 10 * time.Second
+
+// `EnablePolling()` configures `Serve()` to regularly poll MongoDB for new
+// heads and post notifications for them, so that subscribers notice events
+// that other processes committed.  It must be called before `Serve()`.
+//
+// Polling queries the refs for heads that are more recent than the previous
+// poll.  It relies on the time prefix of the ULID event ids.  Notifications
+// may be duplicated, which subscribers must tolerate anyway.
+// `EnablePolling()` creates an index on the refs heads, so that the poll
+// query does not scan all refs.
+func (j *Journal) EnablePolling(interval time.Duration) error {
+	if err := j.refs.EnsureIndex(mgo.Index{
+		Key: []string{KeyHead},
+	}); err != nil {
+		return fmt.Errorf("failed to create index: %s", err)
+	}
+	j.pollInterval = interval
+	return nil
+}
+
+func (j *Journal) poll(ctx context.Context) {
+	ticker := time.NewTicker(j.pollInterval)
+	defer ticker.Stop()
+
+	posted := make(map[uuid.I]ulid.I)
+	since := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		heads, err := j.findHeadsSince(since.Add(-pollOverlap))
+		if err != nil {
+			pollErrorsTotal.With(j.ns).Inc()
+			continue
+		}
+		since = start
+
+		next := make(map[uuid.I]ulid.I, len(heads))
+		for id, head := range heads {
+			next[id] = head
+			if posted[id] != head {
+				if !j.notifier.postCtx(ctx, id) {
+					return
+				}
+			}
+		}
+		// Remember only the heads of the overlap window.
+		posted = next
+	}
+}
+
+func (j *Journal) findHeadsSince(t time.Time) (map[uuid.I]ulid.I, error) {
+	heads := make(map[uuid.I]ulid.I)
+	var refs RefsDoc
+	it := j.refs.Find(bson.M{
+		KeyHead: bson.M{"$gte": ulid.MinAt(t)},
+	}).Select(bson.M{
+		KeyHead: 1,
+	}).Iter()
+	for it.Next(&refs) {
+		heads[refs.Id] = refs.Head
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
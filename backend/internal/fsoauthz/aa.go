@@ -8,8 +8,10 @@ const AABroadcastWrite = "bc/write"
 const AAFsoAdminRegistry = "fso/admin-registry"
 const AAFsoExecPingRegistry = "fso/exec-ping-registry"
 const AAFsoInitRegistry = "fso/init-registry"
+const AAFsoReadAudit = "fso/read-audit"
 const AAFsoReadMain = "fso/read-main"
 const AAFsoReadRegistry = "fso/read-registry"
+const AAFsoRevokeToken = "fso/revoke-token"
 const AAFsoSession = "fso/session"
 const AAInitUnixDomain = "uxd/init-unix-domain"
 const AAReadUnixDomain = "uxd/read-unix-domain"
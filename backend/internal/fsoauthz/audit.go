@@ -0,0 +1,30 @@
+package fsoauthz
+
+import (
+	"github.com/nogproject/nog/backend/pkg/auth"
+)
+
+// `IsAuditedAction()` tells whether calls that check the action are recorded
+// in the audit log.  Actions that only read state are not audited.  Neither
+// are sessions and actions that only modify ephemeral state, like du and ping
+// workflows, which are frequent and expire anyway.
+func IsAuditedAction(a auth.Action) bool {
+	switch a {
+	case AABroadcastRead,
+		AAFsoExecDu,
+		AAFsoExecPingRegistry,
+		AAFsoFind,
+		AAFsoReadAudit,
+		AAFsoReadMain,
+		AAFsoReadRegistry,
+		AAFsoReadRepo,
+		AAFsoReadRoot,
+		AAFsoSession,
+		AAFsoTestUdo,
+		AAFsoTestUdoAs,
+		AAReadUnixDomain:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,577 @@
+package fsoauthz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	slashpath "path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/auth"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// `PolicyVersion` is the supported version of the policy file format.
+const PolicyVersion = 1
+
+var ErrInvalidPolicy = errors.New("invalid authz policy")
+
+// `DefaultRoles` are available in every policy.  A policy may redefine them.
+var DefaultRoles = map[string][]string{
+	"root-admin": {
+		AAFsoReadRoot,
+		AAFsoAdminRoot,
+		AAFsoEnableDiscoveryPath,
+		AAFsoFind,
+		AAFsoInitRepo,
+		AAFsoReadRepo,
+		AAFsoWriteRepo,
+		AAFsoAdminRepo,
+		AAFsoConfirmRepo,
+		AAFsoRefreshRepo,
+		AAFsoFreezeRepo,
+		AAFsoUnfreezeRepo,
+		AAFsoArchiveRepo,
+		AAFsoUnarchiveRepo,
+		AAFsoInitRepoTartt,
+		AAFsoInitRepoShadowBackup,
+		AAFsoExecDu,
+	},
+	"archiver": {
+		AAFsoReadRoot,
+		AAFsoFind,
+		AAFsoReadRepo,
+		AAFsoFreezeRepo,
+		AAFsoUnfreezeRepo,
+		AAFsoArchiveRepo,
+		AAFsoUnarchiveRepo,
+	},
+	"reader": {
+		AAFsoReadRoot,
+		AAFsoFind,
+		AAFsoReadRepo,
+	},
+}
+
+// `Policy` grants roles to principals on roots, path prefixes, and names.
+// Example YAML:
+//
+//	version: 1
+//	roles:
+//	  lab-manager: [fso/read-repo, fso/write-repo, fso/freeze-repo]
+//	bindings:
+//	  - role: root-admin
+//	    subjects: [alice]
+//	    roots: [/example/data]
+//	  - role: reader
+//	    unixDomain: EXAMPLE
+//	    groups: [ag_lab]
+//	    paths: [/example/data/lab/*]
+//	  - role: lab-manager
+//	    unixDomain: EXAMPLE
+//	    users: [bob]
+//	    roots: [/example/data/lab]
+//
+// `subjects` are JWT subjects.  `users` and `groups` are Unix users and groups
+// of `unixDomain`.  A caller matches `users` if the JWT contains a Unix
+// identity of the domain with that user name.  Group membership is resolved
+// with the `GroupResolver`; see `CreatePolicyAuthz()`.
+//
+// `roots` match the root path and paths below it.  `paths` and `names` are
+// globs like in JWT scopes: `*` matches anything, and a trailing `*` matches
+// a prefix.  Role actions are access actions like `fso/read-repo`, or prefix
+// globs like `fso/*`.
+//
+// Unless `ignoreTokenScopes` is set, actions that the JWT scopes permit are
+// permitted, too, so that JWTs issued by nogapp and system JWTs continue to
+// work.
+type Policy struct {
+	Version           int                 `yaml:"version"`
+	IgnoreTokenScopes bool                `yaml:"ignoreTokenScopes"`
+	Roles             map[string][]string `yaml:"roles"`
+	Bindings          []Binding           `yaml:"bindings"`
+
+	// `Revision` identifies the policy file content.
+	Revision string `yaml:"-"`
+}
+
+type Binding struct {
+	Role       string   `yaml:"role"`
+	Subjects   []string `yaml:"subjects"`
+	UnixDomain string   `yaml:"unixDomain"`
+	Users      []string `yaml:"users"`
+	Groups     []string `yaml:"groups"`
+	Roots      []string `yaml:"roots"`
+	Paths      []string `yaml:"paths"`
+	Names      []string `yaml:"names"`
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrInvalidPolicy, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	p.Revision = hex.EncodeToString(sum[:6])
+	return &p, nil
+}
+
+var rgxPolicyAction = regexp.MustCompile(
+	`^(\*|(bc|fso|uxd)/(\*|[a-z]+(-[a-z]+)*\*?))$`,
+)
+
+func policyErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %s", ErrInvalidPolicy, fmt.Sprintf(format, a...))
+}
+
+func (p *Policy) Validate() error {
+	if p.Version != PolicyVersion {
+		return policyErrorf(
+			"unsupported version %d, expected %d",
+			p.Version, PolicyVersion,
+		)
+	}
+	for role, actions := range p.Roles {
+		if len(actions) == 0 {
+			return policyErrorf("role `%s` without actions", role)
+		}
+		for _, a := range actions {
+			if !rgxPolicyAction.MatchString(a) {
+				return policyErrorf(
+					"role `%s`: malformed action `%s`",
+					role, a,
+				)
+			}
+		}
+	}
+	for i, b := range p.Bindings {
+		if p.roleActions(b.Role) == nil {
+			return policyErrorf(
+				"binding %d: unknown role `%s`", i, b.Role,
+			)
+		}
+		if len(b.Subjects) == 0 && len(b.Users) == 0 &&
+			len(b.Groups) == 0 {
+			return policyErrorf(
+				"binding %d: requires subjects, users, "+
+					"or groups", i,
+			)
+		}
+		if (len(b.Users) > 0 || len(b.Groups) > 0) &&
+			b.UnixDomain == "" {
+			return policyErrorf(
+				"binding %d: users and groups require "+
+					"unixDomain", i,
+			)
+		}
+		if len(b.Roots) == 0 && len(b.Paths) == 0 &&
+			len(b.Names) == 0 {
+			return policyErrorf(
+				"binding %d: requires roots, paths, or names",
+				i,
+			)
+		}
+		for _, r := range b.Roots {
+			if !slashpath.IsAbs(r) || slashpath.Clean(r) != r {
+				return policyErrorf(
+					"binding %d: root `%s` is not a clean "+
+						"absolute path", i, r,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) roleActions(role string) []string {
+	if actions, ok := p.Roles[role]; ok {
+		return actions
+	}
+	return DefaultRoles[role]
+}
+
+// `GroupResolver` returns the Unix groups of a user in a Unix domain.
+// Nogfsoregd resolves groups with the registry Unix domains.
+type GroupResolver interface {
+	UserGroups(domain, user string) ([]string, error)
+}
+
+// `identityGroups` resolves groups from the Unix identities in the JWT claim
+// `xcrd`.  It is used if no `GroupResolver` is available.
+type identityGroups struct {
+	unix auth.UnixIdentities
+}
+
+func (g identityGroups) UserGroups(domain, user string) ([]string, error) {
+	id, ok := g.unix.FindDomain(domain)
+	if !ok || id.Username != user {
+		return nil, nil
+	}
+	return id.Groupnames, nil
+}
+
+// `PolicyAuthz` determines whether an action is permitted by a `Policy` or,
+// unless the policy ignores them, by the `euid` scopes.  It logs decisions
+// with info level.
+type PolicyAuthz struct {
+	lg     Logger
+	groups GroupResolver
+
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// `CreatePolicyAuthz()` uses `groups` to resolve Unix group membership.  If
+// `groups` is `nil`, the groups from the JWT are used.
+func CreatePolicyAuthz(
+	lg Logger, policy *Policy, groups GroupResolver,
+) *PolicyAuthz {
+	return &PolicyAuthz{
+		lg:     lg,
+		groups: groups,
+		policy: policy,
+	}
+}
+
+func (a *PolicyAuthz) Policy() *Policy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.policy
+}
+
+func (a *PolicyAuthz) SetPolicy(p *Policy) {
+	a.mu.Lock()
+	a.policy = p
+	a.mu.Unlock()
+}
+
+func (a *PolicyAuthz) Authorize(
+	euid auth.Identity, action auth.Action, opts auth.ActionDetails,
+) error {
+	p := a.Policy()
+	reason, err := a.decide(p, euid, action, opts, nil)
+	if err != nil {
+		a.lg.Infow(
+			"policy authz deny",
+			"err", err,
+			"euid", euid, "action", action, "opts", opts,
+			"policy", p.Revision,
+		)
+	} else {
+		a.lg.Infow(
+			"policy authz allow",
+			"reason", reason,
+			"euid", euid, "action", action, "opts", opts,
+			"policy", p.Revision,
+		)
+	}
+	return err
+}
+
+func (a *PolicyAuthz) AuthorizeAny(
+	euid auth.Identity, actions ...auth.ScopedAction,
+) error {
+	if len(actions) == 0 {
+		panic(ErrMissingScopedActions)
+	}
+
+	p := a.Policy()
+	for _, act := range actions {
+		reason, err := a.decide(p, euid, act.Action, act.Details, nil)
+		switch err {
+		case nil:
+			a.lg.Infow(
+				"policy authz allow",
+				"reason", reason,
+				"euid", euid,
+				"action", act.Action,
+				"opts", act.Details,
+				"policy", p.Revision,
+			)
+			return nil
+		case ErrDefaultDeny:
+			continue
+		default:
+			a.lg.Infow(
+				"policy authz any deny early",
+				"err", err,
+				"euid", euid,
+				"action", act.Action,
+				"opts", act.Details,
+				"policy", p.Revision,
+			)
+			return err
+		}
+	}
+
+	err := ErrDefaultDeny
+	a.lg.Infow(
+		"policy authz any deny",
+		"err", err,
+		"euid", euid,
+		"anyOfActions", actions,
+		"policy", p.Revision,
+	)
+	return err
+}
+
+// `Explanation` describes how a decision was reached, for `nogfsoctl authz
+// explain`.
+type Explanation struct {
+	Allowed  bool
+	Revision string
+	Reasons  []string
+}
+
+// `Explain()` evaluates the same rules as `Authorize()` and records each
+// step.
+func (a *PolicyAuthz) Explain(
+	euid auth.Identity, action auth.Action, opts auth.ActionDetails,
+) *Explanation {
+	p := a.Policy()
+	var reasons []string
+	reason, err := a.decide(p, euid, action, opts, &reasons)
+	x := &Explanation{
+		Allowed:  err == nil,
+		Revision: p.Revision,
+		Reasons:  reasons,
+	}
+	if err != nil {
+		x.Reasons = append(x.Reasons, fmt.Sprintf("deny: %v", err))
+	} else {
+		x.Reasons = append(x.Reasons, fmt.Sprintf("allow: %s", reason))
+	}
+	return x
+}
+
+// `decide()` returns a reason if the action is permitted.  It appends notes
+// about rules that did not apply to `trace` if it is not `nil`.
+func (a *PolicyAuthz) decide(
+	p *Policy,
+	euid auth.Identity,
+	action auth.Action,
+	opts auth.ActionDetails,
+	trace *[]string,
+) (string, error) {
+	note := func(format string, args ...interface{}) {
+		if trace != nil {
+			*trace = append(*trace, fmt.Sprintf(format, args...))
+		}
+	}
+
+	path, _ := opts["path"].(string)
+	name, _ := opts["name"].(string)
+	if path == "" && name == "" {
+		return "", ErrInsufficientDetails
+	}
+	if path != "" {
+		path = slashpath.Clean(path)
+	}
+
+	if p.IgnoreTokenScopes {
+		note("token scopes: ignored by policy")
+	} else {
+		scopes, _ := euid["scopes"].([]auth.Scope)
+		err := authorizeScopes(scopes, action, opts)
+		if err == nil {
+			return "token scopes permit the action", nil
+		}
+		note("token scopes: %v", err)
+	}
+
+	sub, _ := euid["subject"].(string)
+	unix, _ := euid["unix"].(auth.UnixIdentities)
+	groups := a.groups
+	if groups == nil {
+		groups = identityGroups{unix: unix}
+	}
+
+	for i, b := range p.Bindings {
+		if !globContains(p.roleActions(b.Role), string(action)) {
+			continue
+		}
+		target, ok := b.matchTarget(path, name)
+		if !ok {
+			note(
+				"binding %d, role `%s`: target does not match",
+				i, b.Role,
+			)
+			continue
+		}
+		who, err := b.matchPrincipal(sub, unix, groups)
+		if err != nil {
+			note(
+				"binding %d, role `%s`: failed to resolve "+
+					"groups: %v", i, b.Role, err,
+			)
+			continue
+		}
+		if who == "" {
+			note(
+				"binding %d, role `%s`: principal does not "+
+					"match", i, b.Role,
+			)
+			continue
+		}
+		return fmt.Sprintf(
+			"binding %d grants role `%s` to %s on %s",
+			i, b.Role, who, target,
+		), nil
+	}
+
+	note("no binding grants the action")
+	return "", ErrDefaultDeny
+}
+
+// `matchTarget()` requires both the path and the name to match if both are
+// given, like `scopeMatches()`.
+func (b *Binding) matchTarget(path, name string) (string, bool) {
+	var targets []string
+	if path != "" {
+		t, ok := b.matchPath(path)
+		if !ok {
+			return "", false
+		}
+		targets = append(targets, t)
+	}
+	if name != "" {
+		if !globContains(b.Names, name) {
+			return "", false
+		}
+		targets = append(targets, fmt.Sprintf("name `%s`", name))
+	}
+	return strings.Join(targets, " and "), true
+}
+
+func (b *Binding) matchPath(path string) (string, bool) {
+	for _, r := range b.Roots {
+		if r == "/" || path == r || strings.HasPrefix(path, r+"/") {
+			return fmt.Sprintf("root `%s`", r), true
+		}
+	}
+	for _, g := range b.Paths {
+		if globMatches(g, path) {
+			return fmt.Sprintf("paths `%s`", g), true
+		}
+	}
+	return "", false
+}
+
+// `matchPrincipal()` returns a description of the matching principal or an
+// empty string.
+func (b *Binding) matchPrincipal(
+	sub string, unix auth.UnixIdentities, groups GroupResolver,
+) (string, error) {
+	if sub != "" && containsString(b.Subjects, sub) {
+		return fmt.Sprintf("subject `%s`", sub), nil
+	}
+	if b.UnixDomain == "" {
+		return "", nil
+	}
+	id, ok := unix.FindDomain(b.UnixDomain)
+	if !ok {
+		return "", nil
+	}
+	if containsString(b.Users, id.Username) {
+		return fmt.Sprintf(
+			"Unix user `%s@%s`", id.Username, b.UnixDomain,
+		), nil
+	}
+	if len(b.Groups) == 0 {
+		return "", nil
+	}
+	gs, err := groups.UserGroups(b.UnixDomain, id.Username)
+	if err != nil {
+		return "", err
+	}
+	for _, g := range gs {
+		if containsString(b.Groups, g) {
+			return fmt.Sprintf(
+				"Unix group `%s@%s` of user `%s`",
+				g, b.UnixDomain, id.Username,
+			), nil
+		}
+	}
+	return "", nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// `ReloadLogger` is used by `WatchPolicyFile()`.
+type ReloadLogger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+}
+
+// `WatchPolicyFile()` reloads the policy from `path` into `a` when the file
+// modification time changes.  It keeps the current policy if the file is
+// invalid.  It returns when `ctx` is cancelled.
+func WatchPolicyFile(
+	ctx context.Context,
+	lg ReloadLogger,
+	a *PolicyAuthz,
+	path string,
+	interval time.Duration,
+) error {
+	var modTime time.Time
+	if inf, err := os.Stat(path); err == nil {
+		modTime = inf.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		inf, err := os.Stat(path)
+		if err != nil {
+			lg.Warnw("Failed to stat authz policy.", "err", err)
+			continue
+		}
+		if inf.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = inf.ModTime()
+
+		p, err := LoadPolicy(path)
+		if err != nil {
+			lg.Warnw(
+				"Failed to reload authz policy; "+
+					"keeping current policy.",
+				"err", err,
+			)
+			continue
+		}
+		a.SetPolicy(p)
+		lg.Infow("Reloaded authz policy.", "revision", p.Revision)
+	}
+}
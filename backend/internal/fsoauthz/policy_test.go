@@ -0,0 +1,147 @@
+package fsoauthz_test
+
+import (
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/fsoauthz"
+	"github.com/nogproject/nog/backend/pkg/auth"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Infow(msg string, kv ...interface{}) {}
+
+type fixedGroups map[string][]string
+
+func (g fixedGroups) UserGroups(domain, user string) ([]string, error) {
+	return g[user+"@"+domain], nil
+}
+
+const testPolicy = `
+version: 1
+roles:
+  lab-manager: [fso/read-repo, fso/write-repo]
+bindings:
+  - role: root-admin
+    subjects: [alice]
+    roots: [/example/data]
+  - role: reader
+    unixDomain: EXAMPLE
+    groups: [ag_lab]
+    paths: [/example/data/lab/*]
+  - role: lab-manager
+    unixDomain: EXAMPLE
+    users: [bob]
+    roots: [/example/data/lab]
+`
+
+func TestPolicyAuthz(t *testing.T) {
+	p, err := fsoauthz.ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicy() failed: %v", err)
+	}
+	authz := fsoauthz.CreatePolicyAuthz(nopLogger{}, p, fixedGroups{
+		"carol@EXAMPLE": {"ag_lab"},
+	})
+
+	unix := func(user string) auth.UnixIdentities {
+		return auth.UnixIdentities{{Domain: "EXAMPLE", Username: user}}
+	}
+	alice := auth.Identity{"subject": "alice"}
+	bob := auth.Identity{"subject": "bob", "unix": unix("bob")}
+	carol := auth.Identity{"subject": "carol", "unix": unix("carol")}
+	dave := auth.Identity{
+		"subject": "dave",
+		"scopes": []auth.Scope{{
+			Actions: []string{"fso/read-repo"},
+			Paths:   []string{"/other/*"},
+		}},
+	}
+
+	cases := []struct {
+		euid     auth.Identity
+		action   auth.Action
+		path     string
+		expected bool
+	}{
+		{alice, fsoauthz.AAFsoAdminRoot, "/example/data", true},
+		{alice, fsoauthz.AAFsoAdminRoot, "/example/data/x", true},
+		{alice, fsoauthz.AAFsoAdminRoot, "/example/database", false},
+		{alice, fsoauthz.AAFsoDeleteRoot, "/example/data", false},
+		{bob, fsoauthz.AAFsoWriteRepo, "/example/data/lab/r1", true},
+		{bob, fsoauthz.AAFsoFreezeRepo, "/example/data/lab/r1", false},
+		{carol, fsoauthz.AAFsoReadRepo, "/example/data/lab/r1", true},
+		{carol, fsoauthz.AAFsoWriteRepo, "/example/data/lab/r1", false},
+		{dave, fsoauthz.AAFsoReadRepo, "/other/r1", true},
+		{dave, fsoauthz.AAFsoReadRepo, "/example/data/lab/r1", false},
+	}
+	for _, c := range cases {
+		err := authz.Authorize(c.euid, c.action, auth.ActionDetails{
+			"path": c.path,
+		})
+		if (err == nil) != c.expected {
+			t.Errorf(
+				"%s %s %s: expected allowed=%v, got err %v",
+				c.euid["subject"], c.action, c.path,
+				c.expected, err,
+			)
+		}
+	}
+
+	x := authz.Explain(carol, fsoauthz.AAFsoReadRepo, auth.ActionDetails{
+		"path": "/example/data/lab/r1",
+	})
+	if !x.Allowed || x.Revision != p.Revision || len(x.Reasons) == 0 {
+		t.Errorf("unexpected explanation %+v", x)
+	}
+
+	err = authz.AuthorizeAny(
+		bob,
+		auth.ScopedAction{
+			Action:  fsoauthz.AAFsoAdminRoot,
+			Details: auth.ActionDetails{"path": "/example/data"},
+		},
+		auth.ScopedAction{
+			Action:  fsoauthz.AAFsoReadRepo,
+			Details: auth.ActionDetails{"path": "/example/data/lab"},
+		},
+	)
+	if err != nil {
+		t.Errorf("AuthorizeAny() failed: %v", err)
+	}
+}
+
+func TestPolicyIgnoreTokenScopes(t *testing.T) {
+	p, err := fsoauthz.ParsePolicy([]byte("version: 1\nignoreTokenScopes: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz := fsoauthz.CreatePolicyAuthz(nopLogger{}, p, nil)
+	euid := auth.Identity{
+		"subject": "dave",
+		"scopes":  []auth.Scope{{Actions: []string{"*"}, Paths: []string{"*"}}},
+	}
+	err = authz.Authorize(euid, fsoauthz.AAFsoReadRepo, auth.ActionDetails{
+		"path": "/example",
+	})
+	if err != fsoauthz.ErrDefaultDeny {
+		t.Errorf("expected ErrDefaultDeny, got %v", err)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for _, s := range []string{
+		"version: 2\n",
+		"version: 1\nroles: {x: [fso/Read]}\n",
+		"version: 1\nbindings: [{role: nope, subjects: [a], roots: [/a]}]\n",
+		"version: 1\nbindings: [{role: reader, roots: [/a]}]\n",
+		"version: 1\nbindings: [{role: reader, users: [a], roots: [/a]}]\n",
+		"version: 1\nbindings: [{role: reader, subjects: [a]}]\n",
+		"version: 1\nbindings: [{role: reader, subjects: [a], roots: [a/]}]\n",
+		"version: 1\nunknown: true\n",
+	} {
+		if _, err := fsoauthz.ParsePolicy([]byte(s)); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -33,6 +33,7 @@ var ErrCommandUnknown = errors.New("unknown command")
 var ErrUninitialized = errors.New("uninitialized")
 var ErrDomainNameInUse = errors.New("domain name already in used")
 var ErrMalformedDomainName = errors.New("malformed unix domain name")
+var ErrMissingJWTRevocation = errors.New("missing JWT id or subject")
 
 // `NoVC` is a sentinel value that can be passed in place of `vid` to indicate
 // that concurrency version checks are skipped.
@@ -42,9 +43,10 @@ type State struct {
 	id  uuid.I
 	vid ulid.I
 
-	name          string
-	registries    []RegistryInfo
-	domainsByName map[string]UnixDomainInfo
+	name           string
+	registries     []RegistryInfo
+	domainsByName  map[string]UnixDomainInfo
+	jwtRevocations []JWTRevocation
 }
 
 type RegistryInfo struct {
@@ -57,6 +59,14 @@ type UnixDomainInfo struct {
 	Name string
 }
 
+// `JWTRevocation` revokes the JWT with id `Jti` or all JWTs of `Subject` that
+// have been issued before the revocation, that is before the time of `Vid`.
+type JWTRevocation struct {
+	Vid     ulid.I
+	Jti     string
+	Subject string
+}
+
 type Event struct {
 	id     ulid.I
 	parent ulid.I
@@ -80,11 +90,17 @@ type CmdAddUnixDomain struct {
 	DomainName string
 }
 
+type CmdRevokeJWT struct {
+	Jti     string
+	Subject string
+}
+
 func (*State) AggregateState()                {}
 func (*CmdInitMain) AggregateCommand()        {}
 func (*CmdInitRegistry) AggregateCommand()    {}
 func (*CmdConfirmRegistry) AggregateCommand() {}
 func (*CmdAddUnixDomain) AggregateCommand()   {}
+func (*CmdRevokeJWT) AggregateCommand()       {}
 
 func (s *State) Id() uuid.I        { return s.id }
 func (s *State) Vid() ulid.I       { return s.vid }
@@ -203,6 +219,16 @@ func (a *Advancer) Advance(s events.State, ev events.Event) events.State {
 			Name: name,
 		}
 
+	case pb.Event_EV_JWT_REVOKED:
+		// Don't modify the slice of the previous state.
+		revs := make([]JWTRevocation, 0, len(st.jwtRevocations)+1)
+		revs = append(revs, st.jwtRevocations...)
+		st.jwtRevocations = append(revs, JWTRevocation{
+			Vid:     ev.Id(),
+			Jti:     evpb.JwtJti,
+			Subject: evpb.JwtSubject,
+		})
+
 	default:
 		panic("invalid event")
 	}
@@ -233,6 +259,8 @@ func (Behavior) Tell(
 		return tellConfirmRegistry(state, cmd)
 	case *CmdAddUnixDomain:
 		return tellAddUnixDomain(state, cmd)
+	case *CmdRevokeJWT:
+		return tellRevokeJWT(state, cmd)
 	default:
 		return nil, ErrCommandUnknown
 	}
@@ -336,6 +364,34 @@ func tellAddUnixDomain(
 	})
 }
 
+func tellRevokeJWT(
+	st *State, cmd *CmdRevokeJWT,
+) ([]events.Event, error) {
+	if st.name == "" {
+		return nil, ErrUninitialized
+	}
+
+	if cmd.Jti == "" && cmd.Subject == "" {
+		return nil, ErrMissingJWTRevocation
+	}
+
+	// A JTI can be revoked only once.  A subject can be revoked again to
+	// revoke JWTs that have been issued after the previous revocation.
+	if cmd.Jti != "" {
+		for _, r := range st.jwtRevocations {
+			if r.Jti == cmd.Jti && r.Subject == cmd.Subject {
+				return nil, nil
+			}
+		}
+	}
+
+	return newEvents(st.Vid(), pb.Event{
+		Event:      pb.Event_EV_JWT_REVOKED,
+		JwtJti:     cmd.Jti,
+		JwtSubject: cmd.Subject,
+	})
+}
+
 type Main struct {
 	engine *events.Engine
 }
@@ -372,6 +428,15 @@ func (r *Main) AddUnixDomain(
 	})
 }
 
+func (r *Main) RevokeJWT(
+	id uuid.I, vid ulid.I, jti, subject string,
+) (ulid.I, error) {
+	return r.engine.TellIdVid(id, vid, &CmdRevokeJWT{
+		Jti:     jti,
+		Subject: subject,
+	})
+}
+
 func (r *Main) FindId(id uuid.I) (*State, error) {
 	s, err := r.engine.FindId(id)
 	if err != nil {
@@ -394,3 +459,7 @@ func (st *State) FindUnixDomainName(name string) *UnixDomainInfo {
 		return nil
 	}
 }
+
+func (st *State) JWTRevocations() []JWTRevocation {
+	return st.jwtRevocations
+}
@@ -72,7 +72,8 @@ type rootState struct {
 	repoNamingIsPatched bool
 	repoNamingConfig    map[string]interface{}
 
-	repoInitPolicy *pb.FsoRepoInitPolicy
+	repoInitPolicy     *pb.FsoRepoInitPolicy
+	repoAutoInitPolicy *pb.FsoRepoAutoInitPolicy
 
 	splitRootConfig *SplitRootConfig
 }
@@ -171,6 +172,12 @@ type CmdSetRepoInitPolicy struct {
 
 func (*CmdSetRepoInitPolicy) AggregateCommand() {}
 
+type CmdSetRepoAutoInitPolicy struct {
+	Policy *pb.FsoRepoAutoInitPolicy
+}
+
+func (*CmdSetRepoAutoInitPolicy) AggregateCommand() {}
+
 type CmdCreateSplitRootConfig struct {
 	GlobalRoot string
 	Config     *SplitRootConfig
@@ -665,6 +672,22 @@ func (a *Advancer) Advance(s events.State, ev events.Event) events.State {
 		dup.repoInitPolicy = &x.FsoRepoInitPolicy
 		st.roots[globalRoot] = &dup
 
+	case *pbevents.EvRepoAutoInitPolicyUpdated:
+		if !a.roots {
+			st.roots = dupRoots(st.roots)
+			a.roots = true
+		}
+
+		globalRoot := x.FsoRepoAutoInitPolicy.GlobalRoot
+		rootSt := st.roots[globalRoot]
+		if rootSt == nil {
+			// There must have been an `EvRootAdded` for this root.
+			panic("inconsistent state")
+		}
+		dup := *rootSt
+		dup.repoAutoInitPolicy = &x.FsoRepoAutoInitPolicy
+		st.roots[globalRoot] = &dup
+
 	case *pbevents.EvRootArchiveRecipientsUpdated:
 		if !a.roots {
 			st.roots = dupRoots(st.roots)
@@ -1015,6 +1038,8 @@ func (b *Behavior) Tell(
 		return tellEnableDiscoveryPaths(state, cmd)
 	case *CmdSetRepoInitPolicy:
 		return tellSetRepoInitPolicy(state, cmd)
+	case *CmdSetRepoAutoInitPolicy:
+		return tellSetRepoAutoInitPolicy(state, cmd)
 	case *CmdUpdateRootArchiveRecipients:
 		return tellUpdateRootArchiveRecipients(state, cmd)
 	case *CmdDeleteRootArchiveRecipients:
@@ -1417,6 +1442,37 @@ func tellSetRepoInitPolicy(
 	)
 }
 
+func tellSetRepoAutoInitPolicy(
+	state *State, cmd *CmdSetRepoAutoInitPolicy,
+) ([]events.Event, error) {
+	if state.info == nil {
+		return nil, ErrUninitialized
+	}
+
+	policy := cmd.Policy
+	if err := pbevents.ValidateRepoAutoInitPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	rootSt, ok := state.roots[policy.GlobalRoot]
+	if !ok {
+		return nil, ErrUnknownRoot
+	}
+
+	if rootSt.repoAutoInitPolicy == nil && !policy.Enabled {
+		// Disabled is the default.
+		return nil, nil
+	}
+	if proto.Equal(rootSt.repoAutoInitPolicy, policy) {
+		// Already up-to-date.
+		return nil, nil
+	}
+
+	return newEvents(
+		state.Vid(), pbevents.NewRepoAutoInitPolicyUpdated(policy),
+	)
+}
+
 func (cmd *CmdUpdateRootArchiveRecipients) checkTell() error {
 	if len(cmd.Keys) == 0 {
 		return ErrNoGPGKeys
@@ -2647,6 +2703,16 @@ func (r *Registry) SetRepoInitPolicy(
 	})
 }
 
+// `SetRepoAutoInitPolicy()` enables or disables automatic repo init for the
+// root `policy.GlobalRoot`.
+func (r *Registry) SetRepoAutoInitPolicy(
+	id uuid.I, vid ulid.I, policy *pb.FsoRepoAutoInitPolicy,
+) (ulid.I, error) {
+	return r.engine.TellIdVid(id, vid, &CmdSetRepoAutoInitPolicy{
+		Policy: policy,
+	})
+}
+
 // `UpdateRootArchiveRecipients()` sets the archive GPG keys, enabling encryption.
 func (r *Registry) UpdateRootArchiveRecipients(
 	id uuid.I, vid ulid.I, globalRoot string, keys gpg.Fingerprints,
@@ -0,0 +1,160 @@
+package fsoregistry_test
+
+import (
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/events"
+	"github.com/nogproject/nog/backend/internal/fsoregistry"
+	"github.com/nogproject/nog/backend/internal/fsoregistry/pbevents"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/stretchr/testify/require"
+)
+
+func tell(
+	st *fsoregistry.State, cmd events.Command,
+) ([]events.Event, error) {
+	bh := fsoregistry.Behavior{}
+	return bh.Tell(st, cmd)
+}
+
+func apply(
+	t testing.TB, st *fsoregistry.State, cmd events.Command,
+) *fsoregistry.State {
+	t.Helper()
+
+	evs, err := tell(st, cmd)
+	require.NoError(t, err)
+
+	ad := fsoregistry.Advancer{}
+	for _, ev := range evs {
+		st = ad.Advance(st, ev).(*fsoregistry.State)
+	}
+	return st
+}
+
+func newRegistryWithRoot(t testing.TB) *fsoregistry.State {
+	st := &fsoregistry.State{}
+	st = apply(t, st, &fsoregistry.CmdInitRegistry{Name: "exreg"})
+	st = apply(t, st, &fsoregistry.CmdInitRoot{
+		GlobalRoot: "/example/data",
+		Host:       "files.example.com",
+		HostRoot:   "/data",
+	})
+	return st
+}
+
+func TestCmdSetRepoAutoInitPolicy(t *testing.T) {
+	enabled := &pb.FsoRepoAutoInitPolicy{
+		GlobalRoot:        "/example/data",
+		Enabled:           true,
+		AuthorName:        "A. U. Thor",
+		AuthorEmail:       "author@example.com",
+		QuarantineSeconds: 3600,
+	}
+
+	st := &fsoregistry.State{}
+	_, err := tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: enabled,
+	})
+	require.Equal(t, fsoregistry.ErrUninitialized, err)
+
+	st = newRegistryWithRoot(t)
+
+	// Disabled is the default.
+	evs, err := tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: &pb.FsoRepoAutoInitPolicy{GlobalRoot: "/example/data"},
+	})
+	require.NoError(t, err)
+	require.Len(t, evs, 0)
+
+	unknown := *enabled
+	unknown.GlobalRoot = "/example/other"
+	_, err = tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: &unknown,
+	})
+	require.Equal(t, fsoregistry.ErrUnknownRoot, err)
+
+	noAuthor := *enabled
+	noAuthor.AuthorEmail = ""
+	_, err = tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: &noAuthor,
+	})
+	require.Equal(t, pbevents.ErrMissingAuthor, err)
+
+	evs, err = tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: enabled,
+	})
+	require.NoError(t, err)
+	require.Len(t, evs, 1)
+	pbev := evs[0].(*fsoregistry.Event).PbRegistryEvent()
+	require.Equal(
+		t, pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED,
+		pbev.Event,
+	)
+
+	// Setting the same policy again is idempotent.
+	st = apply(t, st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: enabled,
+	})
+	evs, err = tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: enabled,
+	})
+	require.NoError(t, err)
+	require.Len(t, evs, 0)
+
+	// Disabling an enabled policy is an update.
+	evs, err = tell(st, &fsoregistry.CmdSetRepoAutoInitPolicy{
+		Policy: &pb.FsoRepoAutoInitPolicy{GlobalRoot: "/example/data"},
+	})
+	require.NoError(t, err)
+	require.Len(t, evs, 1)
+}
+
+func TestValidateRepoAutoInitPolicy(t *testing.T) {
+	require.Equal(
+		t, pbevents.ErrPolicyNil,
+		pbevents.ValidateRepoAutoInitPolicy(nil),
+	)
+	require.Equal(
+		t, pbevents.ErrDisabledPolicyWithDetails,
+		pbevents.ValidateRepoAutoInitPolicy(&pb.FsoRepoAutoInitPolicy{
+			AuthorName: "A. U. Thor",
+		}),
+	)
+	require.Equal(
+		t, pbevents.ErrNegativeQuarantine,
+		pbevents.ValidateRepoAutoInitPolicy(&pb.FsoRepoAutoInitPolicy{
+			Enabled:           true,
+			AuthorName:        "A. U. Thor",
+			AuthorEmail:       "author@example.com",
+			QuarantineSeconds: -1,
+		}),
+	)
+}
+
+func TestParseMaxDepth(t *testing.T) {
+	for _, c := range []struct {
+		cfg   map[string]interface{}
+		depth int
+		err   error
+	}{
+		{cfg: map[string]interface{}{}, depth: 0},
+		{cfg: map[string]interface{}{"maxDepth": 3.0}, depth: 3},
+		{
+			cfg: map[string]interface{}{"maxDepth": "3"},
+			err: pbevents.ErrMaxDepthWrongType,
+		},
+		{
+			cfg: map[string]interface{}{"maxDepth": 2.5},
+			err: pbevents.ErrMaxDepthNotInteger,
+		},
+		{
+			cfg: map[string]interface{}{"maxDepth": 9.0},
+			err: pbevents.ErrMaxDepthOutOfRange,
+		},
+	} {
+		depth, err := pbevents.ParseMaxDepth(c.cfg)
+		require.Equal(t, c.err, err)
+		require.Equal(t, c.depth, depth)
+	}
+}
@@ -27,6 +27,16 @@ var ErrPatternsWrongType = errors.New("`patterns` has wrong type")
 var ErrPolicyNil = errors.New("invalid nil policy")
 var ErrUnknownRepoNamingPolicy = errors.New("unknown repo naming policy")
 var ErrMissingGloblist = errors.New("missing globlist")
+var ErrMissingMarkers = errors.New("missing `markers`")
+var ErrMarkersWrongType = errors.New("`markers` has wrong type")
+var ErrMissingOwner = errors.New("missing `owner`")
+var ErrOwnerInvalid = errors.New("`owner` must be `user` or `group`")
+var ErrMaxDepthWrongType = errors.New("`maxDepth` has wrong type")
+var ErrMaxDepthNotInteger = errors.New("`maxDepth` is not an integer")
+var ErrMaxDepthOutOfRange = errors.New("`maxDepth` out of range")
+var ErrMissingAuthor = errors.New("missing author")
+var ErrNegativeQuarantine = errors.New("negative quarantine")
+var ErrDisabledPolicyWithDetails = errors.New("disabled policy with details")
 
 type PatternInvalidError struct {
 	Pattern string
@@ -36,6 +46,14 @@ func (err *PatternInvalidError) Error() string {
 	return fmt.Sprintf("invalid pattern `%s`", err.Pattern)
 }
 
+type MarkerInvalidError struct {
+	Marker string
+}
+
+func (err *MarkerInvalidError) Error() string {
+	return fmt.Sprintf("invalid marker file name `%s`", err.Marker)
+}
+
 type PatternInvalidActionError struct {
 	Pattern string
 }
@@ -37,6 +37,9 @@ func FromPbValidate(evpb pb.RegistryEvent) (ev RegistryEvent, err error) {
 	case pb.RegistryEvent_EV_FSO_REPO_INIT_POLICY_UPDATED:
 		return fromPbRepoInitPolicyUpdated(evpb)
 
+	case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+		return fromPbRepoAutoInitPolicyUpdated(evpb)
+
 	case pb.RegistryEvent_EV_FSO_ROOT_ARCHIVE_RECIPIENTS_UPDATED:
 		return fromPbRootArchiveRecipientsUpdated(evpb)
 
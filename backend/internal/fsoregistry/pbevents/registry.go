@@ -247,6 +247,10 @@ func ValidateRepoNaming(naming *pb.FsoRepoNaming) error {
 		return validateRepoNamingSubdirLevel(naming)
 	case "PathPatterns":
 		return validateRepoNamingPathPatterns(naming)
+	case "MarkerFiles":
+		return validateRepoNamingMarkerFiles(naming)
+	case "OwnerBoundary":
+		return validateRepoNamingOwnerBoundary(naming)
 	default:
 		return ErrMalformedRepoNamingRule
 	}
@@ -320,6 +324,10 @@ func ValidateRepoNamingPatch(naming *pb.FsoRepoNaming) error {
 		return validateRepoNamingNonNilIgnoreListOnly(naming)
 	case "PathPatterns":
 		return validateRepoNamingPatchPathPatterns(naming)
+	case "MarkerFiles":
+		return validateRepoNamingNonNilIgnoreListOnly(naming)
+	case "OwnerBoundary":
+		return validateRepoNamingNonNilIgnoreListOnly(naming)
 	default:
 		return ErrMalformedRepoNamingRule
 	}
@@ -429,6 +437,141 @@ func validateRepoNamingPathPatterns(naming *pb.FsoRepoNaming) error {
 	return nil
 }
 
+// `validateRepoNamingMarkerFiles()` accepts:
+//
+//  - `markers`: required non-empty list of file names, without slash.
+//  - `maxDepth`: optional integer `1..8`.
+//  - `ignore`: optional non-empty list of glob patterns.
+func validateRepoNamingMarkerFiles(naming *pb.FsoRepoNaming) error {
+	cfgPb := naming.Config
+	if cfgPb == nil {
+		return ErrNamingConfigNil
+	}
+
+	cfg, err := configmap.ParsePb(cfgPb)
+	if err != nil {
+		return err
+	}
+
+	nExpected := 1
+	if iface, ok := cfg["markers"]; !ok {
+		return ErrMissingMarkers
+	} else if val, ok := iface.([]string); !ok {
+		return ErrMarkersWrongType
+	} else if len(val) == 0 {
+		return ErrMissingMarkers
+	} else {
+		for _, m := range val {
+			if m == "" || m == "." || m == ".." ||
+				strings.Contains(m, "/") {
+				return &MarkerInvalidError{Marker: m}
+			}
+		}
+	}
+
+	n, err := validateMaxDepthIgnore(cfg)
+	if err != nil {
+		return err
+	}
+	nExpected += n
+
+	if len(cfg) != nExpected {
+		return ErrUnexpectedConfigField
+	}
+
+	return nil
+}
+
+// `validateRepoNamingOwnerBoundary()` accepts:
+//
+//  - `owner`: required `user` or `group`.
+//  - `maxDepth`: optional integer `1..8`.
+//  - `ignore`: optional non-empty list of glob patterns.
+func validateRepoNamingOwnerBoundary(naming *pb.FsoRepoNaming) error {
+	cfgPb := naming.Config
+	if cfgPb == nil {
+		return ErrNamingConfigNil
+	}
+
+	cfg, err := configmap.ParsePb(cfgPb)
+	if err != nil {
+		return err
+	}
+
+	nExpected := 1
+	if iface, ok := cfg["owner"]; !ok {
+		return ErrMissingOwner
+	} else if val, ok := iface.(string); !ok {
+		return ErrOwnerInvalid
+	} else if val != "user" && val != "group" {
+		return ErrOwnerInvalid
+	}
+
+	n, err := validateMaxDepthIgnore(cfg)
+	if err != nil {
+		return err
+	}
+	nExpected += n
+
+	if len(cfg) != nExpected {
+		return ErrUnexpectedConfigField
+	}
+
+	return nil
+}
+
+// `ParseMaxDepth()` returns the optional naming config field `maxDepth`,
+// which must be an integer `1..8`.  It returns 0 if `maxDepth` is unset.
+func ParseMaxDepth(cfg map[string]interface{}) (int, error) {
+	iface, ok := cfg["maxDepth"]
+	if !ok {
+		return 0, nil
+	}
+	val, ok := iface.(float64)
+	if !ok {
+		return 0, ErrMaxDepthWrongType
+	}
+	depth := int(val)
+	if float64(depth) != val {
+		return 0, ErrMaxDepthNotInteger
+	}
+	if depth < 1 || depth > 8 {
+		return 0, ErrMaxDepthOutOfRange
+	}
+	return depth, nil
+}
+
+// `validateMaxDepthIgnore()` validates the optional fields `maxDepth` and
+// `ignore`.  It returns the number of fields that are present.
+func validateMaxDepthIgnore(cfg map[string]interface{}) (int, error) {
+	n := 0
+
+	if _, ok := cfg["maxDepth"]; ok {
+		if _, err := ParseMaxDepth(cfg); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if iface, ok := cfg["ignore"]; ok {
+		val, ok := iface.([]string)
+		if !ok {
+			return 0, ErrIgnoreHasWrongType
+		}
+		if len(val) == 0 {
+			return 0, ErrIgnoreListEmpty
+		}
+		for _, pat := range val {
+			if _, err := slashpath.Match(pat, "/a/b/c"); err != nil {
+				return 0, &PatternInvalidGlobError{Pattern: pat}
+			}
+		}
+		n++
+	}
+
+	return n, nil
+}
+
 func validateRepoNamingNonNilIgnoreListOnly(naming *pb.FsoRepoNaming) error {
 	cfgPb := naming.Config
 	if cfgPb == nil {
@@ -595,6 +738,79 @@ func validateRepoInitPolicySubdirTrackingGloblist(
 	return nil
 }
 
+// `EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED` aka `EvRepoAutoInitPolicyUpdated`
+// sets the policy that controls whether Nogfsostad automatically initializes
+// repos that the repo naming rule discovers below a root.
+//
+// Fields:
+//
+//  - `fso_repo_auto_init_policy.global_root`, `GlobalRoot`: The global path
+//    of the root.
+//  - `fso_repo_auto_init_policy.enabled`, `Enabled`: Whether auto init is
+//    enabled.
+//  - `fso_repo_auto_init_policy.author_name` and `author_email`,
+//    `AuthorName` and `AuthorEmail`: The creator of auto-initialized repos.
+//  - `fso_repo_auto_init_policy.quarantine_seconds`, `QuarantineSeconds`:
+//    Candidates are only initialized if their directory tree has not been
+//    modified for at least the quarantine duration.
+//
+// See `ValidateRepoAutoInitPolicy()` for details.
+type EvRepoAutoInitPolicyUpdated struct {
+	pb.FsoRepoAutoInitPolicy
+}
+
+func (EvRepoAutoInitPolicyUpdated) RegistryEvent() {}
+
+func NewRepoAutoInitPolicyUpdated(
+	p *pb.FsoRepoAutoInitPolicy,
+) pb.RegistryEvent {
+	return pb.RegistryEvent{
+		Event:                 pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED,
+		FsoRepoAutoInitPolicy: p,
+	}
+}
+
+func fromPbRepoAutoInitPolicyUpdated(
+	evpb pb.RegistryEvent,
+) (RegistryEvent, error) {
+	if evpb.Event != pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED {
+		panic("invalid event")
+	}
+	policy := evpb.FsoRepoAutoInitPolicy
+	if err := ValidateRepoAutoInitPolicy(policy); err != nil {
+		return nil, err
+	}
+	ev := &EvRepoAutoInitPolicyUpdated{FsoRepoAutoInitPolicy: *policy}
+	return ev, nil
+}
+
+// `ValidateRepoAutoInitPolicy()` requires an author and a non-negative
+// quarantine if the policy is enabled.  A disabled policy must not contain
+// further details.
+func ValidateRepoAutoInitPolicy(policy *pb.FsoRepoAutoInitPolicy) error {
+	if policy == nil {
+		return ErrPolicyNil
+	}
+
+	if !policy.Enabled {
+		if policy.AuthorName != "" ||
+			policy.AuthorEmail != "" ||
+			policy.QuarantineSeconds != 0 {
+			return ErrDisabledPolicyWithDetails
+		}
+		return nil
+	}
+
+	if policy.AuthorName == "" || policy.AuthorEmail == "" {
+		return ErrMissingAuthor
+	}
+	if policy.QuarantineSeconds < 0 {
+		return ErrNegativeQuarantine
+	}
+
+	return nil
+}
+
 // `RegistryEvent_EV_FSO_REPO_ACCEPTED` aka `EvRepoAccepted`.
 type EvRepoAccepted struct {
 	pb.FsoRepoInfo
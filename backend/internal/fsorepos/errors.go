@@ -13,6 +13,7 @@ var ErrNoGPGKeys = errors.New("no GPG keys")
 var ErrDuplicateGPGKeys = errors.New("duplicate GPG keys")
 var ErrInitConflict = errors.New("init conflict")
 var ErrMalformedShadowBackupURL = errors.New("malformed shadow backup URL")
+var ErrInvalidShadowBackupBundle = errors.New("invalid shadow backup bundle")
 var ErrMalformedTarttURL = errors.New("malformed tartt URL")
 var ErrMalformedWorkflowId = errors.New("malformed workflow ID")
 var ErrMissingShadow = errors.New("missing shadow repo")
@@ -45,6 +45,14 @@ type State struct {
 	shadowBackupURL        string
 	shadowBackupRecipients gpg.Fingerprints
 
+	// `shadowBackupBundle`, `shadowBackupRefsHash`, and `shadowBackupTime`
+	// describe the latest successful backup.  `shadowBackupError` is the
+	// error of the latest backup attempt if it failed.
+	shadowBackupBundle   string
+	shadowBackupRefsHash string
+	shadowBackupTime     int64
+	shadowBackupError    string
+
 	gitlabHost      string
 	gitlabPath      string
 	gitlabProjectId int64
@@ -187,6 +195,14 @@ type CmdUpdateShadowBackupRecipients struct {
 
 type CmdDeleteShadowBackupRecipients struct{}
 
+type CmdPostShadowBackupCompleted struct {
+	StatusCode    int32
+	StatusMessage string
+	Bundle        string
+	RefsHash      string
+	Time          int64
+}
+
 type CmdConfirmGit struct {
 	GitlabProjectId int64
 }
@@ -277,6 +293,7 @@ func (*CmdInitShadowBackup) AggregateCommand()             {}
 func (*CmdMoveShadowBackup) AggregateCommand()             {}
 func (*CmdUpdateShadowBackupRecipients) AggregateCommand() {}
 func (*CmdDeleteShadowBackupRecipients) AggregateCommand() {}
+func (*CmdPostShadowBackupCompleted) AggregateCommand()    {}
 func (*CmdConfirmGit) AggregateCommand()                   {}
 func (*CmdEnableGitlab) AggregateCommand()                 {}
 func (*CmdBeginFreeze) AggregateCommand()                  {}
@@ -454,6 +471,16 @@ func (a *Advancer) Advance(s events.State, ev events.Event) events.State {
 		}
 		st.shadowBackupRecipients = keys
 
+	case *pbevents.EvShadowBackupCompleted:
+		if x.StatusCode == 0 {
+			st.shadowBackupBundle = x.Bundle.Name
+			st.shadowBackupRefsHash = x.Bundle.RefsHash
+			st.shadowBackupTime = x.Bundle.Time
+			st.shadowBackupError = ""
+		} else {
+			st.shadowBackupError = x.StatusMessage
+		}
+
 	// Silently ignore legacy events that were used in preliminary
 	// repo-freeze implementation.
 	case *pbevents.EvFreezeRepoStarted:
@@ -547,6 +574,8 @@ func (Behavior) Tell(
 		return tellUpdateShadowBackupRecipients(state, cmd)
 	case *CmdDeleteShadowBackupRecipients:
 		return tellDeleteShadowBackupRecipients(state, cmd)
+	case *CmdPostShadowBackupCompleted:
+		return tellPostShadowBackupCompleted(state, cmd)
 	case *CmdConfirmGit:
 		return tellConfirmGit(state, cmd)
 	case *CmdEnableGitlab:
@@ -974,6 +1003,55 @@ func tellDeleteShadowBackupRecipients(
 	)
 }
 
+// `tellPostShadowBackupCompleted()` is idempotent for the same bundle and for
+// the same error, so that a backup daemon that fails repeatedly does not
+// flood the history.
+func tellPostShadowBackupCompleted(
+	st *State, cmd *CmdPostShadowBackupCompleted,
+) ([]events.Event, error) {
+	if cmd.StatusCode == 0 {
+		if cmd.Bundle == "" || cmd.RefsHash == "" || cmd.Time <= 0 {
+			return nil, ErrInvalidShadowBackupBundle
+		}
+	} else {
+		if cmd.StatusMessage == "" {
+			return nil, ErrInvalidErrorStatusMessage
+		}
+		if len(cmd.StatusMessage) > ConfigMaxStatusMessageLength {
+			return nil, ErrStatusMessageTooLong
+		}
+	}
+
+	if st.globalPath == "" {
+		return nil, ErrNotInitialized
+	}
+	if st.shadowBackupURL == "" {
+		return nil, ErrNotInitializedShadowBackup
+	}
+
+	if cmd.StatusCode != 0 {
+		if cmd.StatusMessage == st.shadowBackupError {
+			return nil, nil // idempotent
+		}
+		return newEvents(st.Vid(),
+			pbevents.NewShadowBackupCompletedError(
+				cmd.StatusCode, cmd.StatusMessage,
+			),
+		)
+	}
+
+	if cmd.Bundle == st.shadowBackupBundle && st.shadowBackupError == "" {
+		return nil, nil // idempotent
+	}
+	return newEvents(st.Vid(),
+		pbevents.NewShadowBackupCompletedOk(&pb.FsoShadowBackupBundle{
+			Name:     cmd.Bundle,
+			RefsHash: cmd.RefsHash,
+			Time:     cmd.Time,
+		}),
+	)
+}
+
 func tellConfirmGit(
 	state *State, cmd *CmdConfirmGit,
 ) ([]events.Event, error) {
@@ -1592,6 +1670,13 @@ func (r *Repos) DeleteShadowBackupRecipients(
 	return r.engine.TellIdVid(id, vid, cmd)
 }
 
+// `PostShadowBackupCompleted()` records the result of a shadow backup.
+func (r *Repos) PostShadowBackupCompleted(
+	id uuid.I, vid ulid.I, cmd *CmdPostShadowBackupCompleted,
+) (ulid.I, error) {
+	return r.engine.TellIdVid(id, vid, cmd)
+}
+
 // `MoveShadowBackup()` changes the archive URL.
 func (r *Repos) MoveShadowBackup(
 	id uuid.I, vid ulid.I, shadowBackupURL string,
@@ -1753,6 +1838,24 @@ func (s *State) ShadowBackupRecipients() gpg.Fingerprints {
 	return s.shadowBackupRecipients
 }
 
+func (s *State) ShadowBackupBundle() string {
+	return s.shadowBackupBundle
+}
+
+func (s *State) ShadowBackupRefsHash() string {
+	return s.shadowBackupRefsHash
+}
+
+// `ShadowBackupTime()` returns the time of the latest successful shadow backup
+// in Unix seconds.
+func (s *State) ShadowBackupTime() int64 {
+	return s.shadowBackupTime
+}
+
+func (s *State) ShadowBackupError() string {
+	return s.shadowBackupError
+}
+
 func (s *State) ShadowLocation() string {
 	if s.shadowPath == "" {
 		return ""
@@ -207,6 +207,74 @@ func TestCmdInitShadowBackup(t *testing.T) {
 	}
 }
 
+func TestCmdPostShadowBackupCompleted(t *testing.T) {
+	var err error
+
+	ok1 := fsorepos.CmdPostShadowBackupCompleted{
+		Bundle:   "bundles/000001-20190101T000000Z.bundle",
+		RefsHash: "git-for-each-ref-sha256:0123",
+		Time:     1546300800,
+	}
+	fail1 := fsorepos.CmdPostShadowBackupCompleted{
+		StatusCode:    1,
+		StatusMessage: "git bundle failed",
+	}
+
+	st := &fsorepos.State{}
+	st = apply(t, st, &cmdInitRepo1)
+	_, err = tell(st, &ok1)
+	require.Equal(t, fsorepos.ErrNotInitializedShadowBackup, err)
+
+	st = apply(t, st, &fsorepos.CmdInitShadowBackup{
+		ShadowBackupURL: "nogfsobak://files.example.com/backup/1",
+	})
+
+	invalid := ok1
+	invalid.RefsHash = ""
+	_, err = tell(st, &invalid)
+	require.Equal(t, fsorepos.ErrInvalidShadowBackupBundle, err)
+	invalid = fail1
+	invalid.StatusMessage = ""
+	_, err = tell(st, &invalid)
+	require.Equal(t, fsorepos.ErrInvalidErrorStatusMessage, err)
+
+	evs, err := tell(st, &fail1)
+	require.NoError(t, err)
+	require.Len(t, evs, 1)
+	ev, pbev := remarshal(t, evs[0])
+	require.Equal(t,
+		pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED, pbev.Event,
+	)
+	require.Equal(t, fail1.StatusCode, pbev.StatusCode)
+	require.Nil(t, pbev.FsoShadowBackupBundle)
+
+	ad := fsorepos.Advancer{}
+	st = ad.Advance(st, ev).(*fsorepos.State)
+	require.Equal(t, fail1.StatusMessage, st.ShadowBackupError())
+	require.Equal(t, int64(0), st.ShadowBackupTime())
+
+	// Repeated errors are idempotent.
+	evs, err = tell(st, &fail1)
+	require.NoError(t, err)
+	require.Len(t, evs, 0)
+
+	evs, err = tell(st, &ok1)
+	require.NoError(t, err)
+	require.Len(t, evs, 1)
+	ev, pbev = remarshal(t, evs[0])
+	require.Equal(t, ok1.Bundle, pbev.FsoShadowBackupBundle.Name)
+
+	st = ad.Advance(st, ev).(*fsorepos.State)
+	require.Equal(t, ok1.Bundle, st.ShadowBackupBundle())
+	require.Equal(t, ok1.RefsHash, st.ShadowBackupRefsHash())
+	require.Equal(t, ok1.Time, st.ShadowBackupTime())
+	require.Equal(t, "", st.ShadowBackupError())
+
+	evs, err = tell(st, &ok1)
+	require.NoError(t, err)
+	require.Len(t, evs, 0)
+}
+
 func remarshal(
 	t testing.TB, ev events.Event,
 ) (*fsorepos.Event, *pb.RepoEvent) {
@@ -55,6 +55,9 @@ func FromPbValidate(evpb pb.RepoEvent) (ev RepoEvent, err error) {
 	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_RECIPIENTS_UPDATED:
 		return fromPbShadowBackupRecipientsUpdated(evpb)
 
+	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
+		return fromPbShadowBackupCompleted(evpb)
+
 	case pb.RepoEvent_EV_FSO_FREEZE_REPO_STARTED:
 		return fromPbFreezeRepoStarted(evpb)
 
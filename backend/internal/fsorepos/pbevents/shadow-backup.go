@@ -0,0 +1,63 @@
+package pbevents
+
+import (
+	"errors"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+)
+
+var ErrMissingShadowBackupBundle = errors.New("missing shadow backup bundle")
+
+// `RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED` aka `EvShadowBackupCompleted`
+// reports a backup attempt by `nogfsobakd`.  `StatusCode == 0` indicates that
+// the Git bundle `Bundle` has been written to the shadow backup directory.
+// Otherwise, `StatusMessage` describes the error, and `Bundle` is empty.
+type EvShadowBackupCompleted struct {
+	StatusCode    int32
+	StatusMessage string
+	Bundle        pb.FsoShadowBackupBundle
+}
+
+func (EvShadowBackupCompleted) RepoEvent() {}
+
+func NewShadowBackupCompletedOk(
+	bundle *pb.FsoShadowBackupBundle,
+) pb.RepoEvent {
+	if bundle.Name == "" {
+		panic("empty bundle name")
+	}
+	ev := pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED
+	return pb.RepoEvent{
+		Event:                 ev,
+		FsoShadowBackupBundle: bundle,
+	}
+}
+
+func NewShadowBackupCompletedError(code int32, msg string) pb.RepoEvent {
+	if code == 0 {
+		panic("zero code")
+	}
+	return pb.RepoEvent{
+		Event:         pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED,
+		StatusCode:    code,
+		StatusMessage: msg,
+	}
+}
+
+func fromPbShadowBackupCompleted(evpb pb.RepoEvent) (RepoEvent, error) {
+	if evpb.Event != pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED {
+		panic("invalid event")
+	}
+	ev := &EvShadowBackupCompleted{
+		StatusCode:    evpb.StatusCode,
+		StatusMessage: evpb.StatusMessage,
+	}
+	if ev.StatusCode != 0 {
+		return ev, nil
+	}
+	if evpb.FsoShadowBackupBundle == nil {
+		return nil, ErrMissingShadowBackupBundle
+	}
+	ev.Bundle = *evpb.FsoShadowBackupBundle
+	return ev, nil
+}
@@ -1,17 +1,49 @@
 package grpcjwt
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var ErrMalformedJWT = errors.New("malformed JWT")
+var ErrRefreshNotOK = errors.New("token refresh status not 200 OK")
+var ErrUnknownLifetime = errors.New("JWT without `iat` and `exp`")
 
+// `FixedJWT` implements the GRPC `credentials.PerRPCCredentials` interface
+// with a token that is usually loaded from a file with `Load()`.  The token
+// can be replaced while in use: `Reload()` reads the file again, and
+// `Refresh()` requests a new token from `RefreshURL`.  `Maintain()` calls them
+// as needed, so that daemons continue to work when the token file is updated
+// or the token is about to expire.
 type FixedJWT struct {
-	Token string
+	Token                  string
 	AllowInsecureTransport bool
+
+	// `Path` is the file from which the token has been loaded.
+	Path string
+	// `RefreshURL` is an HTTP endpoint that issues a new token.  It
+	// receives a POST with the current token as bearer and the JSON body
+	// `{"expiresIn": <seconds>}` and must respond with a token with the
+	// same claims as JSON `{"data": {"token": <jwt>}}`, like the nogapp
+	// token API.
+	RefreshURL string
+	// `RefreshExpiresIn` is the requested lifetime of refreshed tokens.
+	// If zero, the lifetime of the current token is requested.
+	RefreshExpiresIn time.Duration
+
+	mu      sync.RWMutex
+	modTime time.Time
 }
 
 func (c *FixedJWT) RequireTransportSecurity() bool {
@@ -21,22 +53,283 @@ func (c *FixedJWT) RequireTransportSecurity() bool {
 func (c *FixedJWT) GetRequestMetadata(
 	ctx context.Context, uri ...string,
 ) (map[string]string, error) {
-	return map[string]string{"authorization": c.Token}, nil
+	return map[string]string{"authorization": c.CurrentToken()}, nil
+}
+
+func (c *FixedJWT) CurrentToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Token
+}
+
+func (c *FixedJWT) setToken(token string) {
+	c.mu.Lock()
+	c.Token = token
+	c.mu.Unlock()
 }
 
 func Load(path string) (*FixedJWT, error) {
-	data, err := ioutil.ReadFile(path)
+	token, modTime, err := readToken(path)
 	if err != nil {
 		return nil, err
 	}
+	return &FixedJWT{
+		Token:   token,
+		Path:    path,
+		modTime: modTime,
+	}, nil
+}
 
-	// `jwt-go` does not support token parsing without signature
-	// validation.  So we only do a minimal syntax check here.
+func readToken(path string) (string, time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
 	token := strings.TrimSpace(string(data))
+	if err := checkSyntax(token); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, fi.ModTime(), nil
+}
+
+// `jwt-go` does not support token parsing without signature validation.  So we
+// only do a minimal syntax check here.
+func checkSyntax(token string) error {
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 {
-		return nil, ErrMalformedJWT
+		return ErrMalformedJWT
+	}
+	return nil
+}
+
+// `Reload()` reads the token from `Path` again if the file has been modified.
+// It returns whether the token changed.
+func (c *FixedJWT) Reload() (bool, error) {
+	fi, err := os.Stat(c.Path)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	isModified := !fi.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if !isModified {
+		return false, nil
+	}
+
+	token, modTime, err := readToken(c.Path)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	changed := token != c.Token
+	c.Token = token
+	c.modTime = modTime
+	c.mu.Unlock()
+	return changed, nil
+}
+
+var refreshClient = http.Client{
+	Timeout: 20 * time.Second,
+}
+
+// `Refresh()` replaces the token by a new token from `RefreshURL`.  If the
+// token has been loaded from `Path`, the new token is also written to the file,
+// so that it is used after a restart and by `Reload()`.  The file is replaced
+// atomically.  If writing fails, the new token nonetheless remains in use.
+func (c *FixedJWT) Refresh(ctx context.Context) error {
+	expiresIn := c.RefreshExpiresIn
+	if expiresIn == 0 {
+		iat, exp := c.lifetime()
+		if iat.IsZero() || exp.IsZero() {
+			return ErrUnknownLifetime
+		}
+		expiresIn = exp.Sub(iat)
+	}
+	body, err := json.Marshal(struct {
+		ExpiresIn int64 `json:"expiresIn"` // seconds
+	}{
+		ExpiresIn: int64(expiresIn / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.RefreshURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", "Bearer "+c.CurrentToken())
+	res, err := refreshClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("%s: %s", ErrRefreshNotOK, res.Status)
+	}
+
+	var resBody struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
+		return err
+	}
+	token := resBody.Data.Token
+	if err := checkSyntax(token); err != nil {
+		return err
+	}
+
+	if c.Path == "" {
+		c.setToken(token)
+		return nil
+	}
+	modTime, err := writeToken(c.Path, token)
+	c.mu.Lock()
+	c.Token = token
+	if err == nil {
+		c.modTime = modTime
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed token: %v", err)
+	}
+	return nil
+}
+
+// `writeToken()` atomically replaces the file `path` with `token`, keeping the
+// file mode, and returns the new modification time.
+func writeToken(path, token string) (time.Time, error) {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(
+		filepath.Dir(path), filepath.Base(path)+".tmp.",
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() {
+		if tmp != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := tmp.Chmod(mode); err != nil {
+		return time.Time{}, err
+	}
+	if _, err := tmp.WriteString(token + "\n"); err != nil {
+		return time.Time{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return time.Time{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return time.Time{}, err
+	}
+	tmp = nil
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// `lifetime()` returns the claims `iat` and `exp` of the current token without
+// validating the signature.  Times are zero if unknown.
+func (c *FixedJWT) lifetime() (iat, exp time.Time) {
+	parts := strings.Split(c.CurrentToken(), ".")
+	if len(parts) != 3 {
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(parts[1], "="),
+	)
+	if err != nil {
+		return
+	}
+	var claims struct {
+		Iat int64 `json:"iat"`
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return
+	}
+	if claims.Iat > 0 {
+		iat = time.Unix(claims.Iat, 0)
 	}
+	if claims.Exp > 0 {
+		exp = time.Unix(claims.Exp, 0)
+	}
+	return
+}
 
-	return &FixedJWT{Token: token}, nil
+// `needsRefresh()` tells whether less than a third of the token lifetime
+// remains.
+func (c *FixedJWT) needsRefresh(now time.Time) bool {
+	iat, exp := c.lifetime()
+	if exp.IsZero() {
+		return false
+	}
+	if iat.IsZero() || !iat.Before(exp) {
+		return now.After(exp)
+	}
+	return now.After(exp.Add(-exp.Sub(iat) / 3))
+}
+
+// `Maintain()` checks every `interval` whether the token file has been
+// modified and reloads it, and whether the token is about to expire and
+// refreshes it if `RefreshURL` is set.  It runs until `ctx` is cancelled.
+// Errors are logged, and the current token remains in use.
+func (c *FixedJWT) Maintain(
+	ctx context.Context, lg Logger, interval time.Duration,
+) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if c.Path != "" {
+			changed, err := c.Reload()
+			switch {
+			case err != nil:
+				lg.Warnw(
+					"Failed to reload JWT.",
+					"path", c.Path,
+					"err", err,
+				)
+			case changed:
+				lg.Infow("Reloaded JWT.", "path", c.Path)
+			}
+		}
+
+		if c.RefreshURL != "" && c.needsRefresh(time.Now()) {
+			if err := c.Refresh(ctx); err != nil {
+				lg.Warnw(
+					"Failed to refresh JWT.",
+					"url", c.RefreshURL,
+					"err", err,
+				)
+			} else {
+				lg.Infow("Refreshed JWT.", "url", c.RefreshURL)
+			}
+		}
+	}
 }
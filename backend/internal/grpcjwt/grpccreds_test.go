@@ -0,0 +1,90 @@
+package grpcjwt_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/grpcjwt"
+)
+
+func fakeJWT(iat, exp int64) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	payload := fmt.Sprintf(`{"iat":%d,"exp":%d}`, iat, exp)
+	header := enc([]byte(`{"alg":"none"}`))
+	return header + "." + enc([]byte(payload)) + ".sig"
+}
+
+func TestRefreshSavesToken(t *testing.T) {
+	oldToken := fakeJWT(1000, 2000)
+	newToken := fakeJWT(1500, 2500)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+oldToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"token":%q}}`, newToken)
+		},
+	))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "grpcjwt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sys.jwt")
+	err = ioutil.WriteFile(path, []byte(oldToken+"\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := grpcjwt.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RefreshURL = srv.URL
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if c.CurrentToken() != newToken {
+		t.Error("expected new token in use")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(data)) != newToken {
+		t.Errorf("expected new token in file, got %q", data)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %v", fi.Mode().Perm())
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp.*"))
+	if len(matches) != 0 {
+		t.Errorf("unexpected temporary files %v", matches)
+	}
+
+	// The saved token is not reported as a change by `Reload()`.
+	changed, err := c.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("expected Reload() to report no change")
+	}
+}
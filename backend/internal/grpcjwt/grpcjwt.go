@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/nogproject/nog/backend/pkg/auth"
@@ -63,9 +65,10 @@ var (
 )
 
 type HMACAuthn struct {
-	secret   []byte
-	issuer   string
-	audience string
+	secret      []byte
+	issuer      string
+	audience    string
+	revocations *RevocationList
 }
 
 func NewHMACAuthn(secret string) *HMACAuthn {
@@ -77,10 +80,11 @@ func NewHMACAuthn(secret string) *HMACAuthn {
 }
 
 type RSAAuthn struct {
-	ca       *x509.CertPool
-	ou       string
-	issuer   string
-	audience string
+	ca          *x509.CertPool
+	ou          string
+	issuer      string
+	audience    string
+	revocations *RevocationList
 }
 
 func NewRSAAuthn(ca *x509.CertPool, ou string) *RSAAuthn {
@@ -92,6 +96,18 @@ func NewRSAAuthn(ca *x509.CertPool, ou string) *RSAAuthn {
 	}
 }
 
+// `SetRevocationList()` enables checking JWTs against a revocation list.  It
+// must be called before the first `Authenticate()`.
+func (a *HMACAuthn) SetRevocationList(l *RevocationList) {
+	a.revocations = l
+}
+
+// `SetRevocationList()` enables checking JWTs against a revocation list.  It
+// must be called before the first `Authenticate()`.
+func (a *RSAAuthn) SetRevocationList(l *RevocationList) {
+	a.revocations = l
+}
+
 type fsoClaims struct {
 	jwt.MapClaims
 }
@@ -120,6 +136,35 @@ func (c *fsoClaims) Subject() (string, error) {
 	return sub, nil
 }
 
+// `Jti()` returns the JWT id or the empty string.
+func (c *fsoClaims) Jti() string {
+	jti, _ := c.MapClaims["jti"].(string)
+	return jti
+}
+
+// `IssuedAt()` returns the time of claim `iat` or the zero time.
+func (c *fsoClaims) IssuedAt() time.Time {
+	switch iat := c.MapClaims["iat"].(type) {
+	case float64:
+		return time.Unix(int64(iat), 0)
+	case json.Number:
+		v, _ := iat.Int64()
+		return time.Unix(v, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+func (c *fsoClaims) checkRevoked(l *RevocationList, sub string) error {
+	if l == nil {
+		return nil
+	}
+	if l.IsRevoked(c.Jti(), sub, c.IssuedAt()) {
+		return ErrRevoked
+	}
+	return nil
+}
+
 func (c *fsoClaims) Xcrd() (auth.UnixIdentities, error) {
 	xcrd, ok := c.MapClaims["xcrd"]
 	if !ok {
@@ -297,6 +342,10 @@ func (a *HMACAuthn) Authenticate(ctx context.Context) (auth.Identity, error) {
 		return nil, err
 	}
 
+	if err := claims.checkRevoked(a.revocations, sub); err != nil {
+		return nil, err
+	}
+
 	var xcrd auth.UnixIdentities
 	xcrd, err = claims.Xcrd()
 	if err != nil {
@@ -371,6 +420,10 @@ func (a *RSAAuthn) Authenticate(ctx context.Context) (auth.Identity, error) {
 		return nil, err
 	}
 
+	if err := claims.checkRevoked(a.revocations, sub); err != nil {
+		return nil, err
+	}
+
 	var xcrd auth.UnixIdentities
 	xcrd, err = claims.Xcrd()
 	if err != nil {
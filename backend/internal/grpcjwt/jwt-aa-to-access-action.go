@@ -27,11 +27,13 @@ var jwtAAToAccessAction = map[string]string{
 	"fir":   "fso/init-repo",
 	"fit":   "fso/init-root",
 	"fn":    "fso/find",
+	"fra":   "fso/read-audit",
 	"frg":   "fso/read-registry",
 	"frm":   "fso/read-main",
 	"frr":   "fso/read-repo",
 	"frt":   "fso/read-root",
 	"fs":    "fso/session",
+	"ftr":   "fso/revoke-token",
 	"fts":   "fso/issue-sys-token",
 	"ftta":  "fso/test-udo-as",
 	"fttu":  "fso/test-udo",
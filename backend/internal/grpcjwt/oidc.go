@@ -0,0 +1,441 @@
+package grpcjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/oidc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	ErrMissingExpiry = status.Error(
+		codes.Unauthenticated, "missing token expiry",
+	)
+	ErrUnknownOIDCKey = status.Error(
+		codes.Unauthenticated, "unknown OIDC signing key",
+	)
+)
+
+var ErrUnknownMappedAction = errors.New(
+	"claim mapping contains unknown access action",
+)
+
+// `ClaimMapping` describes how the claims of an OIDC token are mapped to a
+// nogfso identity.  Example YAML:
+//
+//	subjectClaim: sub
+//	subjectPrefix: "oidc:"
+//	xcrd:
+//	  domain: EXAMPLE
+//	  usernameClaim: preferred_username
+//	  groupsClaim: groups
+//	scopes:
+//	  - claim: groups
+//	    value: nogfso-admins
+//	    grant:
+//	      - actions: ["fso/*", "bc/*", "uxd/*"]
+//	        paths: ["/*"]
+//	        names: ["*"]
+//	  - claim: scope
+//	    value: fso.read
+//	    grant:
+//	      - actions: ["fso/read-*"]
+//	        paths: ["/example/*"]
+//
+// A scope rule grants its scopes if the claim contains the value.  The claim
+// is either a list of strings, like `groups`, or a space-separated string,
+// like `scope`.  Actions must be existing access actions, like
+// `fso/read-repo`, or prefix globs, like `fso/*`.  Without `xcrd`, the
+// identity has no Unix identity.
+type ClaimMapping struct {
+	SubjectClaim  string      `yaml:"subjectClaim"`
+	SubjectPrefix string      `yaml:"subjectPrefix"`
+	Xcrd          *XcrdMap    `yaml:"xcrd"`
+	Scopes        []ScopeRule `yaml:"scopes"`
+}
+
+type XcrdMap struct {
+	Domain        string `yaml:"domain"`
+	UsernameClaim string `yaml:"usernameClaim"`
+	GroupsClaim   string `yaml:"groupsClaim"`
+}
+
+type ScopeRule struct {
+	Claim string       `yaml:"claim"`
+	Value string       `yaml:"value"`
+	Grant []ScopeGrant `yaml:"grant"`
+}
+
+type ScopeGrant struct {
+	Actions []string `yaml:"actions"`
+	Paths   []string `yaml:"paths"`
+	Names   []string `yaml:"names"`
+}
+
+func LoadClaimMapping(path string) (*ClaimMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m ClaimMapping
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *ClaimMapping) Validate() error {
+	if m.Xcrd != nil {
+		if m.Xcrd.Domain == "" || m.Xcrd.UsernameClaim == "" {
+			return errors.New(
+				"claim mapping `xcrd` requires `domain` and " +
+					"`usernameClaim`",
+			)
+		}
+	}
+	for _, r := range m.Scopes {
+		if r.Claim == "" || r.Value == "" {
+			return errors.New(
+				"claim mapping scope requires `claim` and `value`",
+			)
+		}
+		for _, g := range r.Grant {
+			if len(g.Paths) == 0 && len(g.Names) == 0 {
+				return errors.New(
+					"claim mapping grant requires `paths` " +
+						"or `names`",
+				)
+			}
+			for _, a := range g.Actions {
+				if !isKnownAction(a) {
+					return fmt.Errorf(
+						"%s: %s", ErrUnknownMappedAction, a,
+					)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isKnownAction(a string) bool {
+	if a == "*" {
+		return true
+	}
+	isGlob := strings.HasSuffix(a, "*")
+	prefix := strings.TrimSuffix(a, "*")
+	for _, known := range jwtAAToAccessAction {
+		if strings.HasSuffix(known, "*") {
+			continue
+		}
+		if known == a || (isGlob && strings.HasPrefix(known, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ClaimMapping) subjectClaim() string {
+	if m.SubjectClaim == "" {
+		return "sub"
+	}
+	return m.SubjectClaim
+}
+
+// `claimValues()` returns a list claim or the words of a string claim.
+func claimValues(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		strs, _ := asStringList(v)
+		return strs
+	default:
+		return nil
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ClaimMapping) identity(claims jwt.MapClaims) (auth.Identity, error) {
+	sub, _ := claims[m.subjectClaim()].(string)
+	if sub == "" {
+		return nil, ErrMissingSubject
+	}
+	euid := auth.Identity{
+		"subject": m.SubjectPrefix + sub,
+	}
+
+	if x := m.Xcrd; x != nil {
+		if user, _ := claims[x.UsernameClaim].(string); user != "" {
+			var groups []string
+			if x.GroupsClaim != "" {
+				groups = claimValues(claims, x.GroupsClaim)
+			}
+			euid["unix"] = auth.UnixIdentities{{
+				Domain:     x.Domain,
+				Username:   user,
+				Groupnames: groups,
+			}}
+		}
+	}
+
+	var scopes []auth.Scope
+	for _, r := range m.Scopes {
+		if !containsString(claimValues(claims, r.Claim), r.Value) {
+			continue
+		}
+		for _, g := range r.Grant {
+			scopes = append(scopes, auth.Scope{
+				Actions: g.Actions,
+				Paths:   g.Paths,
+				Names:   g.Names,
+			})
+		}
+	}
+	if len(scopes) > 0 {
+		euid["scopes"] = scopes
+	}
+
+	return euid, nil
+}
+
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+	Mapping  *ClaimMapping
+	// `HTTPClient` is used for discovery and JWKS.  Default: a client with
+	// a timeout of 20 seconds.
+	HTTPClient *http.Client
+}
+
+// `OIDCAuthn` authenticates JWTs from an OpenID Connect issuer.  It verifies
+// the signature with the issuer's JWKS, the issuer, the audience, and the
+// expiry, and maps the claims to an identity with a `ClaimMapping`.
+type OIDCAuthn struct {
+	issuer      string
+	audience    string
+	mapping     *ClaimMapping
+	keys        *oidc.KeySet
+	revocations *RevocationList
+}
+
+var oidcKeyTimeout = 10 * time.Second
+
+// `NewOIDCAuthn()` discovers the issuer's JWKS URI.
+func NewOIDCAuthn(ctx context.Context, cfg *OIDCConfig) (*OIDCAuthn, error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 20 * time.Second}
+	}
+	p, err := oidc.Discover(ctx, client, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCAuthn{
+		issuer:   p.Issuer,
+		audience: cfg.Audience,
+		mapping:  cfg.Mapping,
+		keys:     oidc.NewKeySet(client, p.JWKSURI),
+	}, nil
+}
+
+func (a *OIDCAuthn) Issuer() string {
+	return a.issuer
+}
+
+func (a *OIDCAuthn) SetRevocationList(l *RevocationList) {
+	a.revocations = l
+}
+
+func (a *OIDCAuthn) Authenticate(ctx context.Context) (auth.Identity, error) {
+	tok, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims fsoClaims
+	_, err = jwt.ParseWithClaims(tok, &claims.MapClaims, a.keyfunc())
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok {
+			if ve.Inner == ErrUnknownOIDCKey {
+				return nil, ErrUnknownOIDCKey
+			}
+		}
+		return nil, status.Errorf(
+			codes.Unauthenticated, "invalid token: %s", err,
+		)
+	}
+
+	if !claims.VerifyIssuer(a.issuer) {
+		return nil, ErrInvalidIssuer
+	}
+	if !claims.MapClaims.VerifyAudience(a.audience, true) &&
+		!claims.VerifyAudience(a.audience) {
+		return nil, ErrInvalidAudience
+	}
+	if _, ok := claims.MapClaims["exp"]; !ok {
+		return nil, ErrMissingExpiry
+	}
+
+	euid, err := a.mapping.identity(claims.MapClaims)
+	if err != nil {
+		return nil, err
+	}
+	sub := euid["subject"].(string)
+	if err := claims.checkRevoked(a.revocations, sub); err != nil {
+		return nil, err
+	}
+	return euid, nil
+}
+
+func (a *OIDCAuthn) keyfunc() jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA:
+		case *jwt.SigningMethodECDSA:
+		default:
+			return nil, ErrWrongSigningMethod
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		ctx, cancel := context.WithTimeout(
+			context.Background(), oidcKeyTimeout,
+		)
+		defer cancel()
+		k, err := a.keys.Key(ctx, kid)
+		if err != nil {
+			return nil, ErrUnknownOIDCKey
+		}
+
+		switch k.(type) {
+		case *rsa.PublicKey:
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, ErrWrongSigningMethod
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, ErrWrongSigningMethod
+			}
+		}
+		return k, nil
+	}
+}
+
+func tokenFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ErrMissingMetadata
+	}
+	au, ok := md["authorization"]
+	if !ok || len(au) < 1 {
+		return "", ErrMissingAuthMeta
+	}
+	return au[0], nil
+}
+
+// `IssuerAuthn` selects an authenticator by the unverified claim `iss`, so
+// that daemons accept JWTs from nogapp and from an OIDC issuer.  Tokens from
+// other issuers are passed to the default authenticator, which verifies them
+// as usual.
+type IssuerAuthn struct {
+	dflt     auth.Authenticator
+	byIssuer map[string]auth.Authenticator
+}
+
+func NewIssuerAuthn(dflt auth.Authenticator) *IssuerAuthn {
+	return &IssuerAuthn{
+		dflt:     dflt,
+		byIssuer: make(map[string]auth.Authenticator),
+	}
+}
+
+// `Add()` must be called before the first `Authenticate()`.
+func (a *IssuerAuthn) Add(issuer string, authn auth.Authenticator) {
+	a.byIssuer[issuer] = authn
+}
+
+func (a *IssuerAuthn) Authenticate(ctx context.Context) (auth.Identity, error) {
+	tok, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var claims jwt.MapClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(tok, &claims); err == nil {
+		iss, _ := claims["iss"].(string)
+		if authn, ok := a.byIssuer[iss]; ok {
+			return authn.Authenticate(ctx)
+		}
+	}
+	return a.dflt.Authenticate(ctx)
+}
+
+// `OIDCOptions` are the values of the daemon options `--oidc-issuer`,
+// `--oidc-audience`, and `--oidc-claims`.
+type OIDCOptions struct {
+	Issuer     string
+	Audience   string
+	ClaimsPath string
+}
+
+var ErrMissingOIDCClaims = errors.New("--oidc-issuer requires --oidc-claims")
+
+// `NewOIDCIssuerAuthn()` returns `dflt` unless `opts.Issuer` is set.
+// Otherwise, it returns an authenticator that accepts JWTs from the OIDC
+// issuer in addition to `dflt`.  Revocations apply to OIDC JWTs, too.
+func NewOIDCIssuerAuthn(
+	ctx context.Context,
+	lg Logger,
+	opts *OIDCOptions,
+	dflt auth.Authenticator,
+	revocations *RevocationList,
+) (auth.Authenticator, error) {
+	if opts.Issuer == "" {
+		return dflt, nil
+	}
+	if opts.ClaimsPath == "" {
+		return nil, ErrMissingOIDCClaims
+	}
+	mapping, err := LoadClaimMapping(opts.ClaimsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --oidc-claims: %v", err)
+	}
+
+	oidc, err := NewOIDCAuthn(ctx, &OIDCConfig{
+		Issuer:   opts.Issuer,
+		Audience: opts.Audience,
+		Mapping:  mapping,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	oidc.SetRevocationList(revocations)
+	lg.Infow("Enabled OIDC authentication.", "issuer", oidc.Issuer())
+
+	authn := NewIssuerAuthn(dflt)
+	authn.Add(oidc.Issuer(), oidc)
+	return authn, nil
+}
@@ -0,0 +1,164 @@
+package grpcjwt_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/nogproject/nog/backend/internal/grpcjwt"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/oidc/oidctest"
+	"google.golang.org/grpc/metadata"
+)
+
+func withToken(tok string) context.Context {
+	return metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs("authorization", tok),
+	)
+}
+
+func TestOIDCAuthn(t *testing.T) {
+	iss, err := oidctest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iss.Close()
+
+	mapping := &grpcjwt.ClaimMapping{
+		SubjectPrefix: "oidc:",
+		Xcrd: &grpcjwt.XcrdMap{
+			Domain:        "EXAMPLE",
+			UsernameClaim: "preferred_username",
+			GroupsClaim:   "groups",
+		},
+		Scopes: []grpcjwt.ScopeRule{{
+			Claim: "groups",
+			Value: "ag_alice",
+			Grant: []grpcjwt.ScopeGrant{{
+				Actions: []string{"fso/read-*"},
+				Paths:   []string{"/example/*"},
+			}},
+		}},
+	}
+	if err := mapping.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	authn, err := grpcjwt.NewOIDCAuthn(context.Background(), &grpcjwt.OIDCConfig{
+		Issuer:   iss.URL(),
+		Audience: "nogfso",
+		Mapping:  mapping,
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCAuthn() failed: %v", err)
+	}
+
+	now := time.Now()
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                iss.URL(),
+			"aud":                []interface{}{"account", "nogfso"},
+			"sub":                "1234",
+			"iat":                now.Unix(),
+			"exp":                now.Add(time.Hour).Unix(),
+			"preferred_username": "alice",
+			"groups":             []interface{}{"ag_alice", "other"},
+		}
+	}
+
+	tok, err := iss.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	euid, err := authn.Authenticate(withToken(tok))
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if euid["subject"] != "oidc:1234" {
+		t.Errorf("wrong subject %v", euid["subject"])
+	}
+	expectedUnix := auth.UnixIdentities{{
+		Domain:     "EXAMPLE",
+		Username:   "alice",
+		Groupnames: []string{"ag_alice", "other"},
+	}}
+	if !reflect.DeepEqual(euid["unix"], expectedUnix) {
+		t.Errorf("wrong unix %v", euid["unix"])
+	}
+	expectedScopes := []auth.Scope{{
+		Actions: []string{"fso/read-*"},
+		Paths:   []string{"/example/*"},
+	}}
+	if !reflect.DeepEqual(euid["scopes"], expectedScopes) {
+		t.Errorf("wrong scopes %v", euid["scopes"])
+	}
+
+	bad := map[string]func(c jwt.MapClaims){
+		"wrong aud":   func(c jwt.MapClaims) { c["aud"] = "other" },
+		"wrong iss":   func(c jwt.MapClaims) { c["iss"] = "https://evil" },
+		"missing exp": func(c jwt.MapClaims) { delete(c, "exp") },
+		"expired": func(c jwt.MapClaims) {
+			c["exp"] = now.Add(-time.Hour).Unix()
+		},
+	}
+	for name, modify := range bad {
+		c := claims()
+		modify(c)
+		tok, err := iss.Sign(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := authn.Authenticate(withToken(tok)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestClaimMappingRejectsUnknownAction(t *testing.T) {
+	m := &grpcjwt.ClaimMapping{
+		Scopes: []grpcjwt.ScopeRule{{
+			Claim: "scope",
+			Value: "nog",
+			Grant: []grpcjwt.ScopeGrant{{
+				Actions: []string{"fso/no-such-action"},
+				Paths:   []string{"/*"},
+			}},
+		}},
+	}
+	if err := m.Validate(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{}) {}
+func (nullLogger) Warnw(msg string, kv ...interface{}) {}
+
+func TestNewOIDCIssuerAuthnOptions(t *testing.T) {
+	dflt := grpcjwt.NewIssuerAuthn(nil)
+	revs := grpcjwt.NewRevocationList()
+
+	authn, err := grpcjwt.NewOIDCIssuerAuthn(
+		context.Background(), nullLogger{}, &grpcjwt.OIDCOptions{},
+		dflt, revs,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if authn != dflt {
+		t.Error("expected default authenticator without issuer")
+	}
+
+	_, err = grpcjwt.NewOIDCIssuerAuthn(
+		context.Background(), nullLogger{}, &grpcjwt.OIDCOptions{
+			Issuer: "https://issuer.example.com",
+		},
+		dflt, revs,
+	)
+	if err != grpcjwt.ErrMissingOIDCClaims {
+		t.Errorf("expected ErrMissingOIDCClaims, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package grpcjwt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+}
+
+var ErrRevoked = status.Error(
+	codes.Unauthenticated, "token has been revoked",
+)
+
+// `Revocation` revokes the JWT with id `Jti` or, if `Jti` is empty, all JWTs
+// of `Subject` that have been issued at or before `Revoked`.  Nogapp backdates
+// `iat` by a few seconds.  JWTs that are issued right after a subject
+// revocation may, therefore, be rejected, too.
+type Revocation struct {
+	Jti     string
+	Subject string
+	Revoked time.Time
+}
+
+// `RevocationList` is the set of revocations that `RSAAuthn` and `HMACAuthn`
+// check if configured with `SetRevocationList()`.  The list is usually
+// updated by `PollRevocations()` or by nogfsoregd from the main entity.
+type RevocationList struct {
+	mu       sync.RWMutex
+	jtis     map[string]struct{}
+	subjects map[string]time.Time
+	vid      ulid.I
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{}
+}
+
+// `Set()` replaces the revocations.  `vid` identifies the version of the
+// revocations.  It is used to log only changes.
+func (l *RevocationList) Set(vid ulid.I, revs []Revocation) {
+	jtis := make(map[string]struct{})
+	subjects := make(map[string]time.Time)
+	for _, r := range revs {
+		if r.Jti != "" {
+			jtis[r.Jti] = struct{}{}
+			continue
+		}
+		if t, ok := subjects[r.Subject]; !ok || r.Revoked.After(t) {
+			subjects[r.Subject] = r.Revoked
+		}
+	}
+
+	l.mu.Lock()
+	l.jtis = jtis
+	l.subjects = subjects
+	l.vid = vid
+	l.mu.Unlock()
+}
+
+func (l *RevocationList) Vid() ulid.I {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.vid
+}
+
+// `IsRevoked()` tells whether a JWT has been revoked.  `iat` is the zero time
+// if the JWT has no claim `iat`, which is then considered as issued before
+// any revocation.
+func (l *RevocationList) IsRevoked(jti, sub string, iat time.Time) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if jti != "" {
+		if _, ok := l.jtis[jti]; ok {
+			return true
+		}
+	}
+	if t, ok := l.subjects[sub]; ok {
+		return !iat.After(t)
+	}
+	return false
+}
+
+// `PollRevocations()` fetches the revocations from the nogfsoregd main entity
+// every `interval` and updates `list` until `ctx` is cancelled.  Errors are
+// logged, and the previous revocations remain in effect.
+func PollRevocations(
+	ctx context.Context,
+	lg Logger,
+	conn *grpc.ClientConn,
+	creds credentials.PerRPCCredentials,
+	list *RevocationList,
+	interval time.Duration,
+) error {
+	c := pb.NewMainClient(conn)
+	poll := func() {
+		ctx, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+		o, err := c.GetJWTRevocations(
+			ctx, &pb.GetJWTRevocationsI{}, grpc.PerRPCCredentials(creds),
+		)
+		if err != nil {
+			lg.Warnw("Failed to get JWT revocations.", "err", err)
+			return
+		}
+		vid, err := ulid.ParseBytes(o.Vid)
+		if err != nil {
+			lg.Warnw("Malformed JWT revocations vid.", "err", err)
+			return
+		}
+		if vid == list.Vid() {
+			return
+		}
+		revs := make([]Revocation, 0, len(o.Revocations))
+		for _, r := range o.Revocations {
+			revs = append(revs, Revocation{
+				Jti:     r.Jti,
+				Subject: r.Subject,
+				Revoked: time.Unix(r.Revoked, 0),
+			})
+		}
+		list.Set(vid, revs)
+		lg.Infow(
+			"Updated JWT revocations.",
+			"vid", vid.String(),
+			"n", len(revs),
+		)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		poll()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
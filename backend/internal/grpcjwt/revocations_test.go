@@ -0,0 +1,51 @@
+package grpcjwt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/grpcjwt"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+)
+
+func TestRevocationList(t *testing.T) {
+	revoked := time.Unix(1500000000, 0)
+	l := grpcjwt.NewRevocationList()
+	if l.IsRevoked("jti1", "alice", revoked) {
+		t.Fatal("empty list revoked JWT")
+	}
+
+	vid, err := ulid.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Set(vid, []grpcjwt.Revocation{
+		{Jti: "jti1", Revoked: revoked},
+		{Subject: "bob", Revoked: revoked},
+	})
+	if l.Vid() != vid {
+		t.Error("wrong vid")
+	}
+
+	cases := []struct {
+		jti, sub string
+		iat      time.Time
+		expected bool
+	}{
+		{"jti1", "alice", revoked.Add(time.Hour), true},
+		{"jti2", "alice", revoked.Add(-time.Hour), false},
+		{"jti2", "bob", revoked.Add(-time.Hour), true},
+		{"jti2", "bob", revoked, true},
+		{"jti2", "bob", time.Time{}, true},
+		{"jti2", "bob", revoked.Add(time.Second), false},
+	}
+	for _, c := range cases {
+		got := l.IsRevoked(c.jti, c.sub, c.iat)
+		if got != c.expected {
+			t.Errorf(
+				"IsRevoked(%q, %q, %v): expected %v, got %v",
+				c.jti, c.sub, c.iat, c.expected, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package `nogfsobakd` implements the `nogfsoschd` processor that backs up
+// shadow repos to their shadow backup location using package `shadowbak`.
+package nogfsobakd
+
+import (
+	"context"
+	"fmt"
+	slashpath "path"
+	"strings"
+
+	"github.com/nogproject/nog/backend/internal/nogfsobakd/shadowbak"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsoschd/execute"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// `maxStatusMessageLength` is the limit that the registry accepts for error
+// messages; see `fsorepos`.
+const maxStatusMessageLength = 150
+
+const urlScheme = "nogfsobak://"
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+type Config struct {
+	Conn     *grpc.ClientConn
+	RPCCreds credentials.PerRPCCredentials
+	Tools    *shadowbak.Tools
+	Hosts    []string
+	// `ShadowBackupRoot`, if non-empty, is used to initialize the shadow
+	// backup URL of repos that have none as
+	// `nogfsobak://<host>/<ShadowBackupRoot>/<repoId>`.
+	ShadowBackupRoot string
+	// `InsecurePlaintext` enables plaintext backups of repos without
+	// shadow backup recipients.  Otherwise, such repos are reported as
+	// backup errors.
+	InsecurePlaintext bool
+}
+
+type Processor struct {
+	lg Logger
+	// `ctxSlow` gives backups more time during graceful shutdown, like in
+	// `execute.Processor`.
+	ctxSlow  context.Context
+	conn     *grpc.ClientConn
+	rpcCreds grpc.CallOption
+	tools    *shadowbak.Tools
+	hosts    map[string]struct{}
+	root     string
+	// `insecurePlaintext`, see `Config.InsecurePlaintext`.
+	insecurePlaintext bool
+	// Processor uses a semaphore with combined weight 1 to serialize
+	// backups, like `execute.Processor`.
+	lock *semaphore.Weighted
+}
+
+func NewProcessor(
+	ctxSlow context.Context, lg Logger, cfg *Config,
+) *Processor {
+	hosts := make(map[string]struct{})
+	for _, h := range cfg.Hosts {
+		hosts[h] = struct{}{}
+	}
+	root := ""
+	if cfg.ShadowBackupRoot != "" {
+		root = slashpath.Clean(cfg.ShadowBackupRoot)
+	}
+	return &Processor{
+		lg:       lg,
+		ctxSlow:  ctxSlow,
+		conn:     cfg.Conn,
+		rpcCreds: grpc.PerRPCCredentials(cfg.RPCCreds),
+		tools:    cfg.Tools,
+		hosts:    hosts,
+		root:     root,
+		lock:     semaphore.NewWeighted(1),
+
+		insecurePlaintext: cfg.InsecurePlaintext,
+	}
+}
+
+// `ProcessRepo()` handles backup errors by reporting them to the registry.  It
+// returns an error only during shutdown or if the registry is unavailable.
+func (p *Processor) ProcessRepo(ctx context.Context, repo *execute.Repo) error {
+	if err := p.lock.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer p.lock.Release(1)
+
+	if repo.Shadow == "" {
+		p.lg.Infow(
+			"Ignored repo without shadow.",
+			"repoId", repo.Id.String(),
+		)
+		return nil
+	}
+	host, shadow, err := p.splitHostPath(repo.Shadow)
+	if err != nil {
+		p.lg.Warnw(
+			"Ignored shadow.",
+			"repoId", repo.Id.String(),
+			"shadow", repo.Shadow,
+			"err", err,
+		)
+		return nil
+	}
+
+	bakURL := repo.ShadowBackup
+	recipients := repo.ShadowBackupRecipients
+	if bakURL == "" {
+		if p.root == "" {
+			p.lg.Infow(
+				"Ignored repo without shadow backup URL.",
+				"repoId", repo.Id.String(),
+			)
+			return nil
+		}
+		bakURL = fmt.Sprintf(
+			"%s%s%s/%s", urlScheme, host, p.root, repo.Id.String(),
+		)
+		recipients, err = p.initShadowBackup(ctx, repo, bakURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	hostPath, err := ParseShadowBackupURL(bakURL)
+	if err != nil {
+		return p.postError(ctx, repo, err)
+	}
+	_, dir, err := p.splitHostPath(hostPath)
+	if err != nil {
+		return p.postError(ctx, repo, err)
+	}
+
+	var bundle *shadowbak.Bundle
+	switch {
+	case len(recipients) > 0:
+		bundle, err = p.tools.Backup(p.ctxSlow, shadow, dir, recipients)
+	case p.insecurePlaintext:
+		bundle, err = p.tools.BackupInsecurePlaintext(
+			p.ctxSlow, shadow, dir,
+		)
+	default:
+		return p.postError(ctx, repo, shadowbak.ErrNoRecipients)
+	}
+	if err != nil {
+		if p.ctxSlow.Err() != nil {
+			return p.ctxSlow.Err()
+		}
+		return p.postError(p.ctxSlow, repo, err)
+	}
+	if bundle == nil {
+		p.lg.Infow(
+			"Shadow backup is up to date.",
+			"repoId", repo.Id.String(),
+			"shadowBackup", bakURL,
+		)
+		return nil
+	}
+
+	p.lg.Infow(
+		"Created shadow backup bundle.",
+		"repoId", repo.Id.String(),
+		"shadowBackup", bakURL,
+		"bundle", bundle.Name,
+	)
+	c := pb.NewReposClient(p.conn)
+	i := &pb.PostShadowBackupCompletedI{
+		Repo: repo.Id[:],
+		Bundle: &pb.FsoShadowBackupBundle{
+			Name:     bundle.Name,
+			RefsHash: bundle.RefsHash,
+			Time:     bundle.Time.Unix(),
+		},
+	}
+	_, err = c.PostShadowBackupCompleted(p.ctxSlow, i, p.rpcCreds)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// `splitHostPath()` splits `<host>:<path>` and verifies that the host is
+// handled by this daemon.
+func (p *Processor) splitHostPath(hostPath string) (string, string, error) {
+	parts := strings.SplitN(hostPath, ":", 2)
+	if len(parts) != 2 || !slashpath.IsAbs(parts[1]) {
+		return "", "", fmt.Errorf("malformed location `%s`", hostPath)
+	}
+	host, path := parts[0], parts[1]
+	if _, ok := p.hosts[host]; !ok {
+		err := fmt.Errorf("location `%s` on other host", hostPath)
+		return "", "", err
+	}
+	return host, path, nil
+}
+
+// `ParseShadowBackupURL()` converts `nogfsobak://<host>/<path>` to
+// `<host>:/<path>`.
+func ParseShadowBackupURL(url string) (string, error) {
+	malformed := fmt.Errorf("malformed shadow backup URL `%s`", url)
+	if !strings.HasPrefix(url, urlScheme) {
+		return "", malformed
+	}
+	hostPath := strings.SplitN(strings.TrimPrefix(url, urlScheme), "/", 2)
+	if len(hostPath) != 2 || hostPath[0] == "" || hostPath[1] == "" {
+		return "", malformed
+	}
+	return fmt.Sprintf("%s:/%s", hostPath[0], hostPath[1]), nil
+}
+
+// `initShadowBackup()` sets the shadow backup URL and returns the recipients,
+// which the registry may have initialized from the repo naming config.
+func (p *Processor) initShadowBackup(
+	ctx context.Context, repo *execute.Repo, url string,
+) ([]string, error) {
+	c := pb.NewReposClient(p.conn)
+	_, err := c.InitShadowBackup(ctx, &pb.InitShadowBackupI{
+		Repo:            repo.Id[:],
+		ShadowBackupUrl: url,
+	}, p.rpcCreds)
+	if err != nil {
+		return nil, err
+	}
+	p.lg.Infow(
+		"Initialized shadow backup.",
+		"repoId", repo.Id.String(),
+		"shadowBackup", url,
+	)
+
+	o, err := c.GetRepo(ctx, &pb.GetRepoI{Repo: repo.Id[:]}, p.rpcCreds)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, len(o.ShadowBackupRecipients))
+	for _, r := range o.ShadowBackupRecipients {
+		recipients = append(recipients, fmt.Sprintf("%X", r))
+	}
+	return recipients, nil
+}
+
+// `postError()` reports a backup error to the registry.  It returns an error
+// only if the registry call fails.
+func (p *Processor) postError(
+	ctx context.Context, repo *execute.Repo, err error,
+) error {
+	p.lg.Errorw(
+		"Shadow backup failed.",
+		"repoId", repo.Id.String(),
+		"err", err,
+	)
+
+	msg := err.Error()
+	if len(msg) > maxStatusMessageLength {
+		msg = msg[:maxStatusMessageLength-3] + "..."
+	}
+	c := pb.NewReposClient(p.conn)
+	i := &pb.PostShadowBackupCompletedI{
+		Repo:          repo.Id[:],
+		StatusCode:    1,
+		StatusMessage: msg,
+	}
+	_, err = c.PostShadowBackupCompleted(ctx, i, p.rpcCreds)
+	return err
+}
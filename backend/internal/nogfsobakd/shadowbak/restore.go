@@ -0,0 +1,257 @@
+package shadowbak
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// `gitFsoIndexes` are the secondary index files that `git-fso` maintains for
+// the branches `master-<name>`.
+var gitFsoIndexes = []string{"stat", "sha", "content", "archive"}
+
+type RestoreResult struct {
+	NumBundles int
+	Latest     string
+}
+
+// `Restore()` rebuilds a shadow repo at `dest` from the bundles in the backup
+// directory `dir`.  `dest` must not exist.  The repo is first assembled in a
+// temporary sibling directory and then renamed to `dest`.
+func (ts *Tools) Restore(
+	ctx context.Context, dir, dest string,
+) (*RestoreResult, error) {
+	if _, err := os.Lstat(dest); err == nil {
+		return nil, fmt.Errorf("destination `%s` already exists", dest)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	names, err := BundleNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, ErrNoBundles
+	}
+
+	tmp := fmt.Sprintf(
+		"%s.restore-%s", strings.TrimSuffix(dest, "/"),
+		time.Now().UTC().Format("20060102T150405Z"),
+	)
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = os.RemoveAll(tmp)
+		}
+	}()
+
+	if _, err := ts.gitOutput(ctx, tmp, "init", "-q"); err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(tmp, ".git")
+
+	bundles := filepath.Join(dir, BundlesDir)
+	for _, name := range names {
+		path, cleanup, err := ts.plaintext(
+			ctx, gitDir, filepath.Join(bundles, name),
+		)
+		if err != nil {
+			return nil, err
+		}
+		// The refs are set exactly from the gitdir tar below.
+		_, err = ts.gitOutput(
+			ctx, tmp, "fetch", "-q", "--update-head-ok",
+			path, "+refs/*:refs/*",
+		)
+		cleanup()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	latest := names[len(names)-1]
+	tarPath, cleanup, err := ts.plaintext(
+		ctx, gitDir, filepath.Join(bundles, gitdirTarName(latest)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = extractTar(gitDir, tarPath)
+	cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.applyRefs(ctx, tmp, gitDir); err != nil {
+		return nil, err
+	}
+
+	for _, idx := range gitFsoIndexes {
+		branch := "refs/heads/master-" + idx
+		if _, err := ts.gitOutput(
+			ctx, tmp, "rev-parse", "-q", "--verify", branch,
+		); err != nil {
+			continue
+		}
+		err := ts.readTree(ctx, tmp, "index-"+idx, branch)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := ts.gitOutput(
+		ctx, tmp, "reset", "-q", "--hard",
+	); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return nil, err
+	}
+	ok = true
+
+	return &RestoreResult{
+		NumBundles: len(names),
+		Latest:     BundlesDir + "/" + latest,
+	}, nil
+}
+
+// `applyRefs()` sets the refs to the `git for-each-ref` output that has been
+// extracted from the gitdir tar, deleting refs that are not listed.
+func (ts *Tools) applyRefs(ctx context.Context, dir, gitDir string) error {
+	path := filepath.Join(gitDir, gitdirTarRefs)
+	txt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	want, err := ParseRefs(txt)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	haveTxt, err := ts.gitOutput(ctx, dir, "for-each-ref")
+	if err != nil {
+		return err
+	}
+	have, err := ParseRefs(haveTxt)
+	if err != nil {
+		return err
+	}
+
+	var cmds bytes.Buffer
+	wantNames := make(map[string]struct{})
+	for _, r := range want {
+		wantNames[r.Name] = struct{}{}
+		fmt.Fprintf(&cmds, "update %s %s\n", r.Name, r.Oid)
+	}
+	for _, r := range have {
+		if _, ok := wantNames[r.Name]; !ok {
+			fmt.Fprintf(&cmds, "delete %s\n", r.Name)
+		}
+	}
+	_, err = ts.gitOutputStdin(
+		ctx, dir, gitEnv(), &cmds, "update-ref", "--stdin",
+	)
+	return err
+}
+
+func (ts *Tools) readTree(
+	ctx context.Context, dir, index, branch string,
+) error {
+	env := append(gitEnv(), "GIT_INDEX_FILE=.git/"+index)
+	_, err := ts.gitOutputEnv(ctx, dir, env, "read-tree", branch)
+	return err
+}
+
+// `plaintext()` returns the path of a plaintext copy of `path`, decrypting it
+// to a temporary file in `tmpDir` if necessary.  The caller must call
+// `cleanup()` when done.
+func (ts *Tools) plaintext(
+	ctx context.Context, tmpDir, path string,
+) (string, func(), error) {
+	nop := func() {}
+	if !strings.HasSuffix(path, ".gpg") {
+		return path, nop, nil
+	}
+	dst := filepath.Join(
+		tmpDir, strings.TrimSuffix(filepath.Base(path), ".gpg"),
+	)
+	if err := ts.decrypt(ctx, dst, path); err != nil {
+		return "", nop, err
+	}
+	return dst, func() { _ = os.Remove(dst) }, nil
+}
+
+func extractTar(dst, path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fp.Close() }()
+
+	tr := tar.NewReader(fp)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return fmt.Errorf("invalid tar member `%s`", hdr.Name)
+		}
+		p := filepath.Join(dst, name)
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			_ = os.Remove(p)
+			if err := os.Symlink(hdr.Linkname, p); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeTarFile(p, mode, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeTarFile(path string, mode os.FileMode, r io.Reader) error {
+	fp, err := os.OpenFile(
+		path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fp, r); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	// Apply mode explicitly, since `OpenFile()` does not change the mode
+	// of existing files, like `config` from `git init`.
+	return os.Chmod(path, mode)
+}
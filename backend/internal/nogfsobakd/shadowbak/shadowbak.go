@@ -0,0 +1,538 @@
+// Package `shadowbak` implements backups of shadow repos as incremental Git
+// bundles.
+//
+// A backup directory contains a sequence of bundles `bundles/<seq>-<ts>.bundle`
+// together with a tar of the Git metadata that is not covered by refs,
+// `bundles/<seq>-<ts>.gitdir.tar`.  The first bundle contains the full
+// history.  Later bundles contain only the objects that have been added since
+// the previous bundle, but always all refs, so that fetching the bundles in
+// order reconstructs the refs.  The files are encrypted with GPG and have an
+// additional suffix `.gpg`, unless plaintext has been explicitly requested.
+//
+// The file `refs` contains the `git for-each-ref` output of the latest bundle.
+// It is used to detect whether a new bundle is needed and to determine the
+// objects that the next bundle can omit.
+package shadowbak
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/execx"
+)
+
+const (
+	BundlesDir = "bundles"
+	refsFile   = "refs"
+	tmpDir     = "tmp"
+)
+
+var ErrNoBundles = errors.New("no bundles")
+
+// `ErrNoRecipients` is returned by `Backup()` without recipients.  Use
+// `BackupInsecurePlaintext()` for plaintext backups.
+var ErrNoRecipients = errors.New("no shadow backup recipients")
+
+var rgxBundleName = regexp.MustCompile(
+	`^([0-9]{6})-([0-9]{8}T[0-9]{6}Z)\.bundle(\.gpg)?$`,
+)
+
+// `Tools` contains the external programs.  `gpg2` is only required for
+// encrypted backups.
+type Tools struct {
+	git  *execx.Tool
+	gpg2 *execx.Tool
+}
+
+func LookTools() (*Tools, error) {
+	ts := Tools{}
+
+	var err error
+	ts.git, err = execx.LookTool(execx.ToolSpec{
+		Program:   "git",
+		CheckArgs: []string{"--version"},
+		CheckText: "git version 2",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ignore errors.  `Backup()` and `Restore()` report missing `gpg2`
+	// only if encryption is used.
+	ts.gpg2, _ = execx.LookTool(execx.ToolSpec{
+		Program:   "gpg2",
+		CheckArgs: []string{"--version"},
+		CheckText: "gpg (GnuPG) 2.",
+	})
+
+	return &ts, nil
+}
+
+type Bundle struct {
+	// `Name` is relative to the backup directory.
+	Name     string
+	RefsHash string
+	Time     time.Time
+}
+
+// `Ref` is a line of `git for-each-ref` output.
+type Ref struct {
+	Oid  string
+	Type string
+	Name string
+}
+
+// `ParseRefs()` parses the default `git for-each-ref` output format.
+func ParseRefs(txt []byte) ([]Ref, error) {
+	var refs []Ref
+	for _, line := range strings.Split(string(txt), "\n") {
+		if line == "" {
+			continue
+		}
+		tab := strings.SplitN(line, "\t", 2)
+		if len(tab) != 2 {
+			return nil, fmt.Errorf("malformed ref line `%s`", line)
+		}
+		oidType := strings.Fields(tab[0])
+		if len(oidType) != 2 {
+			return nil, fmt.Errorf("malformed ref line `%s`", line)
+		}
+		refs = append(refs, Ref{
+			Oid:  oidType[0],
+			Type: oidType[1],
+			Name: tab[1],
+		})
+	}
+	return refs, nil
+}
+
+func RefsHash(txt []byte) string {
+	h := sha256.Sum256(txt)
+	return "git-for-each-ref-sha256:" + hex.EncodeToString(h[:])
+}
+
+// `BundleNames()` returns the bundles in the backup directory `dir` in the
+// order in which they must be applied.
+func BundleNames(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(dir, BundlesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, inf := range infos {
+		if rgxBundleName.MatchString(inf.Name()) {
+			names = append(names, inf.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func nextSeq(names []string) int {
+	if len(names) == 0 {
+		return 1
+	}
+	m := rgxBundleName.FindStringSubmatch(names[len(names)-1])
+	seq, _ := strconv.Atoi(m[1])
+	return seq + 1
+}
+
+// `gitdirTarName()` returns the name of the metadata tar that belongs to
+// bundle `name`.
+func gitdirTarName(name string) string {
+	m := rgxBundleName.FindStringSubmatch(name)
+	return fmt.Sprintf("%s-%s.gitdir.tar%s", m[1], m[2], m[3])
+}
+
+// `Backup()` writes a new bundle of the shadow repo `shadow` to the backup
+// directory `dir`, encrypted to the GPG keys `recipients`.  It returns `nil,
+// nil` if the refs are unchanged since the previous bundle.
+func (ts *Tools) Backup(
+	ctx context.Context, shadow, dir string, recipients []string,
+) (*Bundle, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return ts.backup(ctx, shadow, dir, recipients)
+}
+
+// `BackupInsecurePlaintext()` is like `Backup()` but without encryption.
+func (ts *Tools) BackupInsecurePlaintext(
+	ctx context.Context, shadow, dir string,
+) (*Bundle, error) {
+	return ts.backup(ctx, shadow, dir, nil)
+}
+
+func (ts *Tools) backup(
+	ctx context.Context, shadow, dir string, recipients []string,
+) (*Bundle, error) {
+	if len(recipients) > 0 && ts.gpg2 == nil {
+		return nil, errors.New("missing gpg2")
+	}
+
+	refsTxt, err := ts.gitOutput(ctx, shadow, "for-each-ref")
+	if err != nil {
+		return nil, err
+	}
+	refs, err := ParseRefs(refsTxt)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("shadow repo has no refs")
+	}
+
+	prevTxt, err := ioutil.ReadFile(filepath.Join(dir, refsFile))
+	switch {
+	case os.IsNotExist(err):
+		prevTxt = nil
+	case err != nil:
+		return nil, err
+	}
+	if prevTxt != nil && string(prevTxt) == string(refsTxt) {
+		return nil, nil
+	}
+	prevRefs, err := ParseRefs(prevTxt)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := BundleNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Without bundles, the next bundle must be complete, even if a refs
+	// file exists from an earlier incomplete backup.
+	if len(names) == 0 {
+		prevRefs = nil
+	}
+
+	now := time.Now().UTC()
+	base := fmt.Sprintf(
+		"%06d-%s", nextSeq(names), now.Format("20060102T150405Z"),
+	)
+	bundleName := base + ".bundle"
+	tarName := base + ".gitdir.tar"
+	if len(recipients) > 0 {
+		bundleName += ".gpg"
+		tarName += ".gpg"
+	}
+
+	tmp := filepath.Join(dir, tmpDir)
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0700); err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	bundles := filepath.Join(dir, BundlesDir)
+	if err := os.MkdirAll(bundles, 0755); err != nil {
+		return nil, err
+	}
+
+	tmpBundle := filepath.Join(tmp, base+".bundle")
+	if err := ts.createBundle(
+		ctx, shadow, tmpBundle, refs, prevRefs,
+	); err != nil {
+		return nil, err
+	}
+
+	gitDir, err := ts.gitDir(ctx, shadow)
+	if err != nil {
+		return nil, err
+	}
+	tmpTar := filepath.Join(tmp, base+".gitdir.tar")
+	if err := writeGitdirTar(tmpTar, gitDir, refsTxt); err != nil {
+		return nil, err
+	}
+
+	if len(recipients) > 0 {
+		for _, p := range []string{tmpBundle, tmpTar} {
+			if err := ts.encrypt(ctx, p, recipients); err != nil {
+				return nil, err
+			}
+		}
+		tmpBundle += ".gpg"
+		tmpTar += ".gpg"
+	}
+
+	// Rename the tar before the bundle, so that a bundle is only visible
+	// if its metadata is complete.
+	if err := os.Rename(
+		tmpTar, filepath.Join(bundles, tarName),
+	); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(
+		tmpBundle, filepath.Join(bundles, bundleName),
+	); err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(
+		filepath.Join(dir, refsFile), refsTxt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &Bundle{
+		Name:     BundlesDir + "/" + bundleName,
+		RefsHash: RefsHash(refsTxt),
+		Time:     now,
+	}, nil
+}
+
+// `createBundle()` creates an incremental bundle that excludes the objects
+// that are reachable from `prevRefs`.  It falls back to a complete bundle if
+// the incremental bundle would be empty, which happens, for example, if a
+// branch has been reset to an older commit, or if some of `prevRefs` are no
+// longer available.
+func (ts *Tools) createBundle(
+	ctx context.Context, shadow, path string, refs, prevRefs []Ref,
+) error {
+	args := []string{"bundle", "create", path}
+	for _, r := range refs {
+		args = append(args, r.Name)
+	}
+
+	if len(prevRefs) > 0 {
+		argsInc := append([]string{}, args...)
+		argsInc = append(argsInc, "--not")
+		for _, r := range prevRefs {
+			argsInc = append(argsInc, r.Oid)
+		}
+		_, err := ts.gitOutput(ctx, shadow, argsInc...)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_ = os.Remove(path)
+	}
+
+	_, err := ts.gitOutput(ctx, shadow, args...)
+	return err
+}
+
+func (ts *Tools) gitDir(ctx context.Context, shadow string) (string, error) {
+	out, err := ts.gitOutput(ctx, shadow, "rev-parse", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	d := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(d) {
+		d = filepath.Join(shadow, d)
+	}
+	return d, nil
+}
+
+// `gitOutput()` runs git in `dir`.  It declares the directory as safe, so
+// that a backup daemon can read shadow repos that are owned by other users.
+func (ts *Tools) gitOutput(
+	ctx context.Context, dir string, args ...string,
+) ([]byte, error) {
+	return ts.gitOutputEnv(ctx, dir, gitEnv(), args...)
+}
+
+func (ts *Tools) gitOutputEnv(
+	ctx context.Context, dir string, env []string, args ...string,
+) ([]byte, error) {
+	return ts.gitOutputStdin(ctx, dir, env, nil, args...)
+}
+
+func (ts *Tools) gitOutputStdin(
+	ctx context.Context, dir string, env []string, stdin io.Reader,
+	args ...string,
+) ([]byte, error) {
+	cmd := exec.CommandContext(
+		ctx, ts.git.Path,
+		append([]string{"-c", "safe.directory=*"}, args...)...,
+	)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = stdin
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exit, ok := err.(*exec.ExitError); ok {
+			stderr = exit.Stderr
+		}
+		err := fmt.Errorf(
+			"git %s failed: %s; output: %s", args[0], err, stderr,
+		)
+		return nil, err
+	}
+	return out, nil
+}
+
+func gitEnv() []string {
+	return append(
+		os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"LC_ALL=C",
+	)
+}
+
+// `encrypt()` encrypts `path` to `path.gpg` and removes `path`.
+func (ts *Tools) encrypt(
+	ctx context.Context, path string, recipients []string,
+) error {
+	args := []string{
+		"--batch", "--encrypt",
+		"--cipher-algo", "AES256",
+		"--output", path + ".gpg",
+	}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+	args = append(args, path)
+	cmd := exec.CommandContext(ctx, ts.gpg2.Path, args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		err := fmt.Errorf(
+			"gpg2 --encrypt failed: %s; output: %s", err, out,
+		)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// `decrypt()` decrypts `src` to `dst`.
+func (ts *Tools) decrypt(ctx context.Context, dst, src string) error {
+	if ts.gpg2 == nil {
+		return errors.New("missing gpg2")
+	}
+	cmd := exec.CommandContext(
+		ctx, ts.gpg2.Path,
+		"--batch", "--decrypt", "--output", dst, src,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		err := fmt.Errorf(
+			"gpg2 --decrypt failed: %s; output: %s", err, out,
+		)
+		return err
+	}
+	return nil
+}
+
+// `gitdirTarMembers` are the paths relative to the Git dir that are not
+// covered by bundles but required to restore a shadow repo.
+var gitdirTarMembers = []string{"HEAD", "config", "description", "fso"}
+
+// `gitdirTarRefs` is the tar member that contains the `git for-each-ref`
+// output.  Restore uses it to set the refs exactly, because incremental
+// bundles omit refs whose commits are already in a previous bundle.
+const gitdirTarRefs = "nogfsobak-refs"
+
+func writeGitdirTar(path, gitDir string, refsTxt []byte) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fp.Close() }()
+
+	tw := tar.NewWriter(fp)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     gitdirTarRefs,
+		Mode:     0644,
+		Size:     int64(len(refsTxt)),
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(refsTxt); err != nil {
+		return err
+	}
+	for _, m := range gitdirTarMembers {
+		root := filepath.Join(gitDir, m)
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(root, func(
+			p string, inf os.FileInfo, err error,
+		) error {
+			if err != nil {
+				return err
+			}
+			return addTarMember(tw, gitDir, p, inf)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return fp.Close()
+}
+
+func addTarMember(tw *tar.Writer, base, p string, inf os.FileInfo) error {
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if inf.Mode()&os.ModeSymlink != 0 {
+		link, err = os.Readlink(p)
+		if err != nil {
+			return err
+		}
+	} else if !inf.Mode().IsRegular() && !inf.IsDir() {
+		// Ignore sockets, fifos, and devices.
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(inf, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if inf.IsDir() {
+		hdr.Name += "/"
+	}
+	// Ownership is not restored.
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !inf.Mode().IsRegular() {
+		return nil
+	}
+
+	fp, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fp.Close() }()
+	_, err = io.Copy(tw, fp)
+	return err
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,156 @@
+package shadowbak
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRefs(t *testing.T) {
+	oid1 := "1111111111111111111111111111111111111111"
+	oid2 := "2222222222222222222222222222222222222222"
+	txt := []byte(
+		oid1 + " commit\trefs/heads/master-stat\n" +
+			oid2 + " tag\trefs/tags/v 1\n",
+	)
+	refs, err := ParseRefs(txt)
+	require.NoError(t, err)
+	require.Equal(t, []Ref{
+		{
+			Oid:  oid1,
+			Type: "commit",
+			Name: "refs/heads/master-stat",
+		},
+		{
+			Oid:  oid2,
+			Type: "tag",
+			Name: "refs/tags/v 1",
+		},
+	}, refs)
+
+	_, err = ParseRefs([]byte("malformed\n"))
+	require.Error(t, err)
+}
+
+func TestBundleNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadowbak-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	names, err := BundleNames(dir)
+	require.NoError(t, err)
+	require.Len(t, names, 0)
+	require.Equal(t, 1, nextSeq(names))
+
+	bundles := filepath.Join(dir, BundlesDir)
+	require.NoError(t, os.Mkdir(bundles, 0755))
+	for _, n := range []string{
+		"000002-20190102T000000Z.bundle.gpg",
+		"000002-20190102T000000Z.gitdir.tar.gpg",
+		"000001-20190101T000000Z.bundle",
+		"000001-20190101T000000Z.gitdir.tar",
+		"unrelated",
+	} {
+		p := filepath.Join(bundles, n)
+		require.NoError(t, ioutil.WriteFile(p, nil, 0644))
+	}
+
+	names, err = BundleNames(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"000001-20190101T000000Z.bundle",
+		"000002-20190102T000000Z.bundle.gpg",
+	}, names)
+	require.Equal(t, 3, nextSeq(names))
+	require.Equal(t,
+		"000002-20190102T000000Z.gitdir.tar.gpg",
+		gitdirTarName(names[1]),
+	)
+}
+
+// `TestBackupRestore()` uses Git to create a repo with a structure similar to
+// a shadow repo, backs it up twice, and restores it.
+func TestBackupRestore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("missing git")
+	}
+	ts, err := LookTools()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "shadowbak-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(tmp) }()
+	shadow := filepath.Join(tmp, "shadow")
+	backup := filepath.Join(tmp, "backup")
+	dest := filepath.Join(tmp, "restored")
+
+	git := func(args ...string) string {
+		t.Helper()
+		args = append([]string{
+			"-c", "user.name=A. U. Thor",
+			"-c", "user.email=author@example.com",
+		}, args...)
+		out, err := ts.gitOutput(ctx, shadow, args...)
+		require.NoError(t, err)
+		return string(out)
+	}
+	commit := func(branch, msg string) {
+		t.Helper()
+		git("checkout", "-q", branch)
+		git("commit", "-q", "--allow-empty", "-m", msg)
+	}
+
+	require.NoError(t, os.Mkdir(shadow, 0755))
+	git("init", "-q")
+	git("checkout", "-q", "-b", "master-stub")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+	git("branch", "master-stat")
+	require.NoError(t, os.MkdirAll(
+		filepath.Join(shadow, ".git", "fso"), 0755,
+	))
+	uuidPath := filepath.Join(shadow, ".git", "fso", "uuid")
+	require.NoError(t, ioutil.WriteFile(uuidPath, []byte("1\n"), 0644))
+
+	_, err = ts.Backup(ctx, shadow, backup, nil)
+	require.Equal(t, ErrNoRecipients, err)
+	_, err = os.Stat(filepath.Join(backup, BundlesDir))
+	require.True(t, os.IsNotExist(err))
+
+	b1, err := ts.BackupInsecurePlaintext(ctx, shadow, backup)
+	require.NoError(t, err)
+	require.Regexp(t, `^bundles/000001-.*\.bundle$`, b1.Name)
+
+	b, err := ts.BackupInsecurePlaintext(ctx, shadow, backup)
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	commit("master-stat", "stat")
+	git("checkout", "-q", "master-stub")
+	b2, err := ts.BackupInsecurePlaintext(ctx, shadow, backup)
+	require.NoError(t, err)
+	require.Regexp(t, `^bundles/000002-.*\.bundle$`, b2.Name)
+	require.NotEqual(t, b1.RefsHash, b2.RefsHash)
+
+	res, err := ts.Restore(ctx, backup, dest)
+	require.NoError(t, err)
+	require.Equal(t, 2, res.NumBundles)
+	require.Equal(t, b2.Name, res.Latest)
+
+	out, err := ts.gitOutput(ctx, dest, "for-each-ref")
+	require.NoError(t, err)
+	require.Equal(t, git("for-each-ref"), string(out))
+	uuid, err := ioutil.ReadFile(filepath.Join(dest, ".git", "fso", "uuid"))
+	require.NoError(t, err)
+	require.Equal(t, "1\n", string(uuid))
+	_, err = os.Stat(filepath.Join(dest, ".git", "index-stat"))
+	require.NoError(t, err)
+
+	_, err = ts.Restore(ctx, backup, dest)
+	require.Error(t, err)
+}
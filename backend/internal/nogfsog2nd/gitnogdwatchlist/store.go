@@ -107,6 +107,7 @@ func (s *store) applyEvent(r *repo, ev *pb.RepoEvent) error {
 	case pb.RepoEvent_EV_FSO_GIT_TO_NOG_CLONED:
 	case pb.RepoEvent_EV_FSO_ARCHIVE_RECIPIENTS_UPDATED:
 	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_RECIPIENTS_UPDATED:
+	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
 
 	default:
 		s.lg.Warnw(
@@ -262,6 +262,7 @@ func (v *RegistryView) addRepo(
 		case pb.RepoEvent_EV_FSO_GIT_TO_NOG_CLONED:
 		case pb.RepoEvent_EV_FSO_ARCHIVE_RECIPIENTS_UPDATED:
 		case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_RECIPIENTS_UPDATED:
+		case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
 
 		default: // Ignore unknown.
 			v.lg.Warnw(
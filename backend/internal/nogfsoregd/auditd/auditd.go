@@ -0,0 +1,344 @@
+// Package `auditd` records mutating gRPCs of nogfsoregd in a hash-chained
+// audit log and implements GRPC service `nogfso.Audit` to export it.
+//
+// The `Auditor` interceptor creates a call state for each gRPC.  The
+// authenticator and authorizer wrappers record the caller identity and the
+// authorization checks in the call state.  Since `auth.Authorizer` receives
+// no context, the wrappers associate the identity map with the call.  After
+// the handler returned, the interceptor appends a record if the call checked
+// at least one audited action; see `fsoauthz.IsAuditedAction()`.  Calls that
+// do not pass through an interceptor, like the nogfsostad session calls, are
+// not recorded.
+//
+// An error while appending a record is logged, but it does not fail the call,
+// since the operation has already been executed.
+package auditd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/audit"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type Logger interface {
+	Errorw(msg string, kv ...interface{})
+}
+
+type Authorizer interface {
+	auth.Authorizer
+	auth.AnyAuthorizer
+}
+
+type Config struct {
+	Store *Store
+	// `IsAudited` tells whether calls that check an action are recorded.
+	IsAudited func(auth.Action) bool
+}
+
+type Auditor struct {
+	lg        Logger
+	store     *Store
+	isAudited func(auth.Action) bool
+
+	mu    sync.Mutex
+	calls map[uintptr]*call
+}
+
+type call struct {
+	mu      sync.Mutex
+	euids   []auth.Identity
+	subject string
+	unix    auth.UnixIdentities
+	actions []audit.Action
+	audited bool
+}
+
+type ctxKey int
+
+const callKey ctxKey = 0
+
+func New(lg Logger, cfg *Config) *Auditor {
+	return &Auditor{
+		lg:        lg,
+		store:     cfg.Store,
+		isAudited: cfg.IsAudited,
+		calls:     make(map[uintptr]*call),
+	}
+}
+
+func identityKey(euid auth.Identity) uintptr {
+	return reflect.ValueOf(euid).Pointer()
+}
+
+// `bind()` associates `euid` with the call in `ctx`.  The call keeps a
+// reference to `euid`, so that the map address is not reused while bound.
+func (a *Auditor) bind(ctx context.Context, euid auth.Identity) {
+	c, ok := ctx.Value(callKey).(*call)
+	if !ok || euid == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.euids = append(c.euids, euid)
+	if s, ok := euid["subject"].(string); ok {
+		c.subject = s
+	}
+	if u, ok := euid["unix"].(auth.UnixIdentities); ok {
+		c.unix = u
+	}
+	c.mu.Unlock()
+
+	a.mu.Lock()
+	a.calls[identityKey(euid)] = c
+	a.mu.Unlock()
+}
+
+func (a *Auditor) unbind(c *call) {
+	a.mu.Lock()
+	for _, euid := range c.euids {
+		delete(a.calls, identityKey(euid))
+	}
+	a.mu.Unlock()
+}
+
+func (a *Auditor) lookup(euid auth.Identity) *call {
+	if euid == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls[identityKey(euid)]
+}
+
+func (a *Auditor) addAction(
+	euid auth.Identity,
+	action auth.Action,
+	details auth.ActionDetails,
+	allowed bool,
+) {
+	c := a.lookup(euid)
+	if c == nil {
+		return
+	}
+
+	target, _ := details["path"].(string)
+	if target == "" {
+		target, _ = details["name"].(string)
+	}
+	c.mu.Lock()
+	c.actions = append(c.actions, audit.Action{
+		Action:  string(action),
+		Target:  target,
+		Allowed: allowed,
+	})
+	if a.isAudited(action) {
+		c.audited = true
+	}
+	c.mu.Unlock()
+}
+
+func (a *Auditor) Authenticator(inner auth.Authenticator) auth.Authenticator {
+	return &authn{a: a, inner: inner}
+}
+
+type authn struct {
+	a     *Auditor
+	inner auth.Authenticator
+}
+
+func (an *authn) Authenticate(ctx context.Context) (auth.Identity, error) {
+	euid, err := an.inner.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	an.a.bind(ctx, euid)
+	return euid, nil
+}
+
+func (a *Auditor) Authorizer(inner Authorizer) Authorizer {
+	return &authz{a: a, inner: inner}
+}
+
+type authz struct {
+	a     *Auditor
+	inner Authorizer
+}
+
+func (az *authz) Authorize(
+	euid auth.Identity, action auth.Action, details auth.ActionDetails,
+) error {
+	err := az.inner.Authorize(euid, action, details)
+	az.a.addAction(euid, action, details, err == nil)
+	return err
+}
+
+// `AuthorizeAny()` records all actions with the combined result, since the
+// inner authorizer does not tell which action was allowed.
+func (az *authz) AuthorizeAny(
+	euid auth.Identity, actions ...auth.ScopedAction,
+) error {
+	err := az.inner.AuthorizeAny(euid, actions...)
+	for _, act := range actions {
+		az.a.addAction(euid, act.Action, act.Details, err == nil)
+	}
+	return err
+}
+
+func (a *Auditor) Server() grpcchain.Server {
+	return grpcchain.Server{
+		Unary:  a.unaryServerInterceptor,
+		Stream: a.streamServerInterceptor,
+	}
+}
+
+func (a *Auditor) unaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	c := &call{}
+	res, err := handler(context.WithValue(ctx, callKey, c), req)
+	a.finish(c, info.FullMethod, req, res, err)
+	return res, err
+}
+
+func (a *Auditor) streamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	c := &call{}
+	err := handler(srv, &serverStream{
+		ServerStream: ss,
+		ctx:          context.WithValue(ss.Context(), callKey, c),
+	})
+	a.finish(c, info.FullMethod, nil, nil, err)
+	return err
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (a *Auditor) finish(
+	c *call, method string, req, res interface{}, err error,
+) {
+	a.unbind(c)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.audited {
+		return
+	}
+
+	st := status.Convert(err)
+	r := &audit.Record{
+		Time:    time.Now(),
+		Method:  method,
+		Subject: c.subject,
+		Actions: c.actions,
+		Code:    st.Code().String(),
+	}
+	if err != nil {
+		r.Error = st.Message()
+	}
+	for _, u := range c.unix {
+		r.Unix = append(r.Unix, audit.UnixIdentity{
+			Domain:     u.Domain,
+			Username:   u.Username,
+			Groupnames: u.Groupnames,
+		})
+	}
+	setVids(r, res)
+	if r.Workflow = getWorkflow(req); r.Workflow == "" {
+		r.Workflow = getWorkflow(res)
+	}
+
+	if err := a.store.Append(r); err != nil {
+		recordsTotal.With("error").Inc()
+		a.lg.Errorw(
+			"Failed to append audit record.",
+			"err", err,
+			"method", method,
+			"subject", c.subject,
+		)
+		return
+	}
+	recordsTotal.With("ok").Inc()
+}
+
+// Getters of generated protobuf messages.
+type (
+	vidGetter              interface{ GetVid() []byte }
+	mainVidGetter          interface{ GetMainVid() []byte }
+	registryVidGetter      interface{ GetRegistryVid() []byte }
+	repoVidGetter          interface{ GetRepoVid() []byte }
+	workflowIndexVidGetter interface{ GetWorkflowIndexVid() []byte }
+	workflowVidGetter      interface{ GetWorkflowVid() []byte }
+	workflowGetter         interface{ GetWorkflow() []byte }
+)
+
+// `setVids()` records the event ids of the response `m`.  Most responses
+// contain a single `vid`.  Others, like `RevokeJWTO` or the workflow begin
+// responses, contain event ids per entity.
+func setVids(r *audit.Record, m interface{}) {
+	if g, ok := m.(vidGetter); ok {
+		r.Vid = vidString(g.GetVid())
+	}
+	if g, ok := m.(mainVidGetter); ok {
+		r.MainVid = vidString(g.GetMainVid())
+	}
+	if g, ok := m.(registryVidGetter); ok {
+		r.RegistryVid = vidString(g.GetRegistryVid())
+	}
+	if g, ok := m.(repoVidGetter); ok {
+		r.RepoVid = vidString(g.GetRepoVid())
+	}
+	if g, ok := m.(workflowIndexVidGetter); ok {
+		r.WorkflowIndexVid = vidString(g.GetWorkflowIndexVid())
+	}
+	if g, ok := m.(workflowVidGetter); ok {
+		r.WorkflowVid = vidString(g.GetWorkflowVid())
+	}
+}
+
+// `vidString()` returns the empty string for unset fields, which
+// `ulid.ParseBytes()` would parse as `ulid.Nil`.
+func vidString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	id, err := ulid.ParseBytes(b)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+func getWorkflow(m interface{}) string {
+	g, ok := m.(workflowGetter)
+	if !ok {
+		return ""
+	}
+	id, err := uuid.FromBytes(g.GetWorkflow())
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,55 @@
+package auditd
+
+import (
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/audit"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+)
+
+func newTestVid(t *testing.T) ulid.I {
+	id, err := ulid.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSetVidsPerEntity(t *testing.T) {
+	registryVid := newTestVid(t)
+	repoVid := newTestVid(t)
+	workflowVid := newTestVid(t)
+	var r audit.Record
+	setVids(&r, &pb.BeginFreezeRepoO{
+		RegistryVid: registryVid[:],
+		RepoVid:     repoVid[:],
+		WorkflowVid: workflowVid[:],
+	})
+	if r.Vid != "" || r.MainVid != "" || r.WorkflowIndexVid != "" {
+		t.Errorf("unexpected vids %+v", r)
+	}
+	if r.RegistryVid != registryVid.String() ||
+		r.RepoVid != repoVid.String() ||
+		r.WorkflowVid != workflowVid.String() {
+		t.Errorf("wrong vids %+v", r)
+	}
+
+	mainVid := newTestVid(t)
+	r = audit.Record{}
+	setVids(&r, &pb.RevokeJWTO{MainVid: mainVid[:]})
+	if r.MainVid != mainVid.String() {
+		t.Errorf("expected main vid %s, got %q", mainVid, r.MainVid)
+	}
+}
+
+func TestSetVidsNil(t *testing.T) {
+	var r audit.Record
+	setVids(&r, (*pb.RevokeJWTO)(nil))
+	setVids(&r, nil)
+	if r.Vid != "" || r.MainVid != "" || r.RegistryVid != "" ||
+		r.RepoVid != "" || r.WorkflowIndexVid != "" ||
+		r.WorkflowVid != "" {
+		t.Errorf("unexpected vids %+v", r)
+	}
+}
@@ -0,0 +1,13 @@
+package auditd
+
+import (
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+var (
+	recordsTotal = metrics.NewCounterVec(
+		"nogfsoregd_audit_records_total",
+		"Number of audit records by result `ok` or `error`.",
+		"result",
+	)
+)
@@ -0,0 +1,73 @@
+package auditd
+
+import (
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// `ExportBatchSize` is the maximum number of records per response message.
+const ExportBatchSize = 100
+
+// `Server` implements GRPC service `nogfso.Audit`.
+type Server struct {
+	authn    auth.Authenticator
+	authz    auth.Authorizer
+	store    *Store
+	mainName string
+}
+
+func NewServer(
+	authn auth.Authenticator,
+	authz auth.Authorizer,
+	store *Store,
+	mainName string,
+) *Server {
+	return &Server{
+		authn:    authn,
+		authz:    authz,
+		store:    store,
+		mainName: mainName,
+	}
+}
+
+func (srv *Server) ExportAudit(
+	req *pb.ExportAuditI, stream pb.Audit_ExportAuditServer,
+) error {
+	ctx := stream.Context()
+	if err := srv.authName(ctx, AAFsoReadAudit, srv.mainName); err != nil {
+		return err
+	}
+
+	from := req.FromSeq
+	if from < 1 {
+		from = 1
+	}
+
+	rsp := &pb.ExportAuditO{}
+	send := func() error {
+		if len(rsp.Records) == 0 {
+			return nil
+		}
+		if err := stream.Send(rsp); err != nil {
+			return err
+		}
+		rsp = &pb.ExportAuditO{}
+		return nil
+	}
+	err := srv.store.Find(from, func(j []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rsp.Records = append(rsp.Records, j)
+		if len(rsp.Records) >= ExportBatchSize {
+			return send()
+		}
+		return nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Unknown, "audit error: %v", err)
+	}
+	return send()
+}
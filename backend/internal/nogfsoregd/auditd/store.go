@@ -0,0 +1,123 @@
+package auditd
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/nogproject/nog/backend/internal/audit"
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+const (
+	KeyId   = "_id"
+	KeyHash = "hash"
+	KeyJSON = "json"
+)
+
+// `RecordDoc` stores the canonical JSON, so that the hash can be verified
+// without re-encoding.  `Id` is the record `Seq`.
+type RecordDoc struct {
+	Id   int64  `bson:"_id"`
+	Hash string `bson:"hash"`
+	JSON string `bson:"json"`
+}
+
+var ErrAppendConflict = errors.New("too many concurrent audit appends")
+
+// `maxAppendRetries` limits the retries if another nogfsoregd instance
+// appended a record concurrently.
+const maxAppendRetries = 10
+
+// `Store` is the audit log in a MongoDB collection.  `Append()` caches the
+// last record.  If another instance appended in the meantime, the insert
+// fails with a duplicate key, and `Append()` reloads the last record and
+// retries.
+type Store struct {
+	c *mgo.Collection
+
+	mu         sync.Mutex
+	head       *audit.Record
+	headLoaded bool
+}
+
+func NewStore(conn *mgo.Session, collection string) *Store {
+	return &Store{
+		c: conn.DB("").C(collection),
+	}
+}
+
+func (s *Store) Append(r *audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < maxAppendRetries; i++ {
+		if !s.headLoaded {
+			head, err := s.loadHead()
+			if err != nil {
+				return err
+			}
+			s.head = head
+			s.headLoaded = true
+		}
+
+		if err := r.Chain(s.head); err != nil {
+			return err
+		}
+		j, err := r.Canonical()
+		if err != nil {
+			return err
+		}
+		err = s.c.Insert(&RecordDoc{
+			Id:   r.Seq,
+			Hash: r.Hash,
+			JSON: string(j),
+		})
+		switch {
+		case mgo.IsDup(err):
+			s.headLoaded = false
+			continue
+		case err != nil:
+			return err
+		}
+
+		head := *r
+		s.head = &head
+		return nil
+	}
+
+	return ErrAppendConflict
+}
+
+func (s *Store) loadHead() (*audit.Record, error) {
+	var doc RecordDoc
+	err := s.c.Find(nil).Sort("-" + KeyId).One(&doc)
+	switch {
+	case err == mgo.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	var r audit.Record
+	if err := json.Unmarshal([]byte(doc.JSON), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// `Find()` calls `fn` with the canonical JSON of the records starting at
+// `fromSeq` in order.
+func (s *Store) Find(fromSeq int64, fn func(json []byte) error) error {
+	iter := s.c.Find(bson.M{
+		KeyId: bson.M{"$gte": fromSeq},
+	}).Sort(KeyId).Iter()
+	var doc RecordDoc
+	for iter.Next(&doc) {
+		if err := fn([]byte(doc.JSON)); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,94 @@
+// Package `authzd` implements the GRPC service `nogfso.Authz`, which explains
+// authorization decisions, and resolves Unix group membership for
+// `fsoauthz.PolicyAuthz` from the registry Unix domains.
+package authzd
+
+import (
+	"context"
+
+	"github.com/nogproject/nog/backend/internal/fsoauthz"
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const AAFsoReadMain = fsoauthz.AAFsoReadMain
+
+var ErrMalformedRequest = status.Error(
+	codes.InvalidArgument, "malformed request",
+)
+
+// `Server` implements GRPC service `nogfso.Authz`.
+type Server struct {
+	authn     auth.Authenticator
+	authz     auth.Authorizer
+	explainer *fsoauthz.PolicyAuthz
+	mainName  string
+}
+
+// `explainer` must evaluate the same policy as `authz`.  Without policy, use
+// a `PolicyAuthz` with an empty policy, which explains scope decisions.
+func NewServer(
+	authn auth.Authenticator,
+	authz auth.Authorizer,
+	explainer *fsoauthz.PolicyAuthz,
+	mainName string,
+) *Server {
+	return &Server{
+		authn:     authn,
+		authz:     authz,
+		explainer: explainer,
+		mainName:  mainName,
+	}
+}
+
+func (srv *Server) ExplainAuthz(
+	ctx context.Context, i *pb.ExplainAuthzI,
+) (*pb.ExplainAuthzO, error) {
+	if i.Action == "" || (i.Path == "" && i.Name == "") {
+		return nil, ErrMalformedRequest
+	}
+	if (i.UnixDomain == "") != (i.UnixUser == "") {
+		return nil, ErrMalformedRequest
+	}
+
+	euid, err := srv.authn.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Explaining decisions for other users reveals the policy.  Require
+	// the same permission as reading the main entity.
+	if i.UnixUser != "" {
+		err := srv.authz.Authorize(euid, AAFsoReadMain, auth.ActionDetails{
+			"name": srv.mainName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The subject of the Unix user is unknown.  It is left empty,
+		// so that only Unix user and group bindings match, and
+		// subject bindings of an unrelated JWT identity cannot.
+		euid = auth.Identity{
+			"unix": auth.UnixIdentities{{
+				Domain:   i.UnixDomain,
+				Username: i.UnixUser,
+			}},
+		}
+	}
+
+	details := auth.ActionDetails{}
+	if i.Path != "" {
+		details["path"] = i.Path
+	}
+	if i.Name != "" {
+		details["name"] = i.Name
+	}
+	x := srv.explainer.Explain(euid, auth.Action(i.Action), details)
+	return &pb.ExplainAuthzO{
+		Allowed:        x.Allowed,
+		PolicyRevision: x.Revision,
+		Reasons:        x.Reasons,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package authzd
+
+import (
+	"github.com/nogproject/nog/backend/internal/fsomain"
+	"github.com/nogproject/nog/backend/internal/unixdomains"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+// `UnixDomainGroups` implements `fsoauthz.GroupResolver` with the Unix
+// domains of the registry main.  Users that are not in the domain have no
+// groups.
+type UnixDomainGroups struct {
+	main    *fsomain.Main
+	mainId  uuid.I
+	domains *unixdomains.UnixDomains
+}
+
+func NewUnixDomainGroups(
+	main *fsomain.Main, mainId uuid.I, domains *unixdomains.UnixDomains,
+) *UnixDomainGroups {
+	return &UnixDomainGroups{
+		main:    main,
+		mainId:  mainId,
+		domains: domains,
+	}
+}
+
+func (g *UnixDomainGroups) UserGroups(domain, user string) ([]string, error) {
+	m, err := g.main.FindId(g.mainId)
+	if err != nil {
+		return nil, err
+	}
+	inf := m.FindUnixDomainName(domain)
+	if inf == nil {
+		return nil, nil
+	}
+	d, err := g.domains.FindId(inf.Id)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := d.FindUser(user)
+	if !ok {
+		return nil, nil
+	}
+	groups := make([]string, 0, len(u.Gids))
+	for _, gid := range u.Gids {
+		if grp, ok := d.FindGid(gid); ok {
+			groups = append(groups, grp.Group)
+		}
+	}
+	return groups, nil
+}
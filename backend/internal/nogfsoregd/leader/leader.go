@@ -0,0 +1,289 @@
+// Package `leader` implements leader election for background processors of
+// several `nogfsoregd` instances that use the same MongoDB.
+//
+// Each processor has a name, like `repoinit` or `workflowproc/exreg`.  The
+// instance that holds the lease for the name runs the processor.  A lease is
+// a MongoDB document with the holder and an expiry time.  The holder renews
+// the lease every third of the lease duration.  It stops the processor if it
+// cannot renew the lease before two thirds of the lease duration have passed,
+// so that the processor is stopped before another instance may take over.  The
+// instance waits until the processor has returned before it campaigns again.
+// Leases are released during a graceful stop, so that another instance takes
+// over quickly.  If an instance dies, another instance takes over after the
+// lease expired.
+//
+// Lease expiry is based on the local clocks, which must be synchronized, for
+// example with NTP, to a precision that is small compared to the lease
+// duration.
+package leader
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+}
+
+const (
+	KeyId      = "_id"
+	KeyHolder  = "holder"
+	KeyExpires = "expires"
+)
+
+type LeaseDoc struct {
+	Id      string    `bson:"_id"`
+	Holder  string    `bson:"holder"`
+	Expires time.Time `bson:"expires"`
+}
+
+type Config struct {
+	// `Collection` is the MongoDB collection that stores the leases.
+	Collection string
+	// `Instance` identifies this instance.  It must be unique among all
+	// instances.
+	Instance string
+	// `LeaseDuration` is the time after which a lease of a dead instance
+	// expires.
+	LeaseDuration time.Duration
+}
+
+type Elector struct {
+	lg       Logger
+	leases   LeaseStore
+	instance string
+	ttl      time.Duration
+	renew    time.Duration
+}
+
+var ErrProcessorQuit = errors.New("processor quit unexpectedly")
+
+func New(lg Logger, conn *mgo.Session, cfg *Config) *Elector {
+	return NewWithStore(lg, NewLeases(conn, cfg.Collection), cfg)
+}
+
+// `NewWithStore()` is like `New()` but uses `leases` instead of
+// `cfg.Collection`.
+func NewWithStore(lg Logger, leases LeaseStore, cfg *Config) *Elector {
+	return &Elector{
+		lg:       lg,
+		leases:   leases,
+		instance: cfg.Instance,
+		ttl:      cfg.LeaseDuration,
+		renew:    cfg.LeaseDuration / 3,
+	}
+}
+
+func (e *Elector) Instance() string {
+	return e.instance
+}
+
+// `Run()` campaigns for the lease `name` until `ctx` is cancelled and runs
+// `fn` while holding the lease.  The context of `fn` is cancelled when the
+// lease is lost, and `Run()` campaigns again after `fn` returned.  `Run()`
+// returns the error if `fn` fails while holding the lease.
+func (e *Elector) Run(
+	ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	for {
+		ok, err := e.acquire(name)
+		if err != nil {
+			e.lg.Warnw(
+				"Failed to acquire lease.",
+				"module", "leader",
+				"name", name,
+				"err", err,
+			)
+		}
+		if ok {
+			err := e.lead(ctx, name, fn)
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err == errLost:
+			case err == nil:
+				return ErrProcessorQuit
+			default:
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.renew):
+		}
+	}
+}
+
+// `TryDo()` runs `fn` if the lease `name` is available and returns whether
+// it did.  It is intended for periodic tasks, like garbage collection, that
+// only one instance should run at a time.
+func (e *Elector) TryDo(
+	ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error,
+) (bool, error) {
+	ok, err := e.acquire(name)
+	if !ok {
+		return false, err
+	}
+	err = e.lead(ctx, name, fn)
+	if err == errLost {
+		err = context.Canceled
+	}
+	return true, err
+}
+
+var errLost = errors.New("lost lease")
+
+// `lead()` runs `fn` while renewing the lease.  It returns `errLost` if the
+// lease was lost and otherwise the error from `fn`.  The context of `fn` is
+// cancelled when the lease has not been renewed for two thirds of the lease
+// duration, independent of whether renew attempts are still in progress.
+// `lead()` always waits for `fn` to return, so that the caller neither
+// releases the lease nor campaigns again while `fn` is still running.
+func (e *Elector) lead(
+	ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	e.lg.Infow(
+		"Became leader.",
+		"module", "leader",
+		"name", name,
+		"instance", e.instance,
+	)
+	leaderGauge.With(name).Set(1)
+	defer leaderGauge.With(name).Set(0)
+
+	ctx2, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx2)
+	}()
+
+	// The lease was acquired just before `lead()`.  `deadline` fires when
+	// the lease has not been renewed for two thirds of the duration.
+	maxHold := 2 * e.ttl / 3
+	deadline := time.NewTimer(maxHold)
+	defer deadline.Stop()
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+
+	// `renewed` receives the results of renew attempts, which run in a
+	// goroutine, so that a slow MongoDB does not delay the deadline.
+	renewed := make(chan renewResult, 1)
+	renewing := false
+
+	lose := func(err error) {
+		leaderLostTotal.With(name).Inc()
+		e.lg.Warnw(
+			"Lost leadership.",
+			"module", "leader",
+			"name", name,
+			"instance", e.instance,
+			"err", err,
+		)
+		cancel()
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if renewing {
+				// Wait for the renew, so that it cannot extend
+				// the lease after the release.
+				<-renewed
+			}
+			e.release(name)
+			return err
+
+		case <-ticker.C:
+			if renewing {
+				continue
+			}
+			renewing = true
+			start := time.Now()
+			go func() {
+				ok, err := e.acquire(name)
+				renewed <- renewResult{ok: ok, err: err, start: start}
+			}()
+
+		case r := <-renewed:
+			renewing = false
+			switch {
+			case r.ok:
+				// The new lease expires `ttl` after the
+				// start of the attempt.
+				d := maxHold - time.Since(r.start)
+				if !deadline.Stop() {
+					<-deadline.C
+				}
+				deadline.Reset(d)
+			case r.err != nil:
+				e.lg.Warnw(
+					"Failed to renew lease; will retry.",
+					"module", "leader",
+					"name", name,
+					"err", r.err,
+				)
+			default:
+				lose(errors.New("lease held by another instance"))
+				return e.waitLost(name, done, renewing, renewed)
+			}
+
+		case <-deadline.C:
+			lose(errors.New("renew deadline exceeded"))
+			return e.waitLost(name, done, renewing, renewed)
+		}
+	}
+}
+
+type renewResult struct {
+	ok    bool
+	err   error
+	start time.Time
+}
+
+// `waitLost()` waits for `fn` and an in-progress renew after the lease was
+// lost.  It then releases the lease in case the renew succeeded late, so that
+// another instance can take over without waiting for the lease to expire.
+func (e *Elector) waitLost(
+	name string,
+	done <-chan error,
+	renewing bool,
+	renewed <-chan renewResult,
+) error {
+	<-done
+	if renewing {
+		<-renewed
+	}
+	e.release(name)
+	return errLost
+}
+
+// `acquire()` takes or renews the lease.
+func (e *Elector) acquire(name string) (bool, error) {
+	return e.leases.Acquire(name, e.instance, e.ttl)
+}
+
+func (e *Elector) release(name string) {
+	err := e.leases.Release(name, e.instance)
+	if err != nil {
+		e.lg.Warnw(
+			"Failed to release lease.",
+			"module", "leader",
+			"name", name,
+			"err", err,
+		)
+	}
+}
@@ -0,0 +1,183 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/leader"
+)
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{}) {}
+func (nullLogger) Warnw(msg string, kv ...interface{}) {}
+
+// `fakeLeases` grants leases as long as `acquire` returns true.  `acquire`
+// may block to simulate a stuck MongoDB.
+type fakeLeases struct {
+	mu       sync.Mutex
+	acquire  func(n int) (bool, error)
+	acquires int
+	released []string
+}
+
+func (f *fakeLeases) Acquire(
+	name, holder string, ttl time.Duration,
+) (bool, error) {
+	f.mu.Lock()
+	f.acquires++
+	n := f.acquires
+	acquire := f.acquire
+	f.mu.Unlock()
+	return acquire(n)
+}
+
+func (f *fakeLeases) Release(name, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, name)
+	return nil
+}
+
+func (f *fakeLeases) nReleased() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.released)
+}
+
+func newElector(leases leader.LeaseStore) *leader.Elector {
+	return leader.NewWithStore(nullLogger{}, leases, &leader.Config{
+		Instance:      "test",
+		LeaseDuration: 300 * time.Millisecond,
+	})
+}
+
+func TestRunReleasesOnCancel(t *testing.T) {
+	leases := &fakeLeases{
+		acquire: func(int) (bool, error) { return true, nil },
+	}
+	e := newElector(leases)
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- e.Run(ctx, "p", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("expected Canceled, got %v", err)
+	}
+	if leases.nReleased() != 1 {
+		t.Errorf("expected lease to be released")
+	}
+}
+
+func TestRunProcessorQuit(t *testing.T) {
+	leases := &fakeLeases{
+		acquire: func(int) (bool, error) { return true, nil },
+	}
+	e := newElector(leases)
+	err := e.Run(
+		context.Background(), "p",
+		func(ctx context.Context) error { return nil },
+	)
+	if err != leader.ErrProcessorQuit {
+		t.Errorf("expected ErrProcessorQuit, got %v", err)
+	}
+	fail := errors.New("fail")
+	err = e.Run(
+		context.Background(), "p",
+		func(ctx context.Context) error { return fail },
+	)
+	if err != fail {
+		t.Errorf("expected processor error, got %v", err)
+	}
+}
+
+// A stuck renew must not delay stopping the processor beyond two thirds of
+// the lease duration.
+func TestLeadDeadlineWithStuckRenew(t *testing.T) {
+	unblock := make(chan struct{})
+	leases := &fakeLeases{
+		acquire: func(n int) (bool, error) {
+			if n == 1 {
+				return true, nil
+			}
+			<-unblock
+			return true, nil
+		},
+	}
+	e := newElector(leases)
+
+	start := time.Now()
+	var stopped time.Duration
+	ok, err := e.TryDo(
+		context.Background(), "p",
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped = time.Since(start)
+			close(unblock)
+			return ctx.Err()
+		},
+	)
+	if !ok {
+		t.Fatal("expected TryDo to run fn")
+	}
+	if err != context.Canceled {
+		t.Errorf("expected Canceled after lost lease, got %v", err)
+	}
+	if stopped > 250*time.Millisecond {
+		t.Errorf("processor stopped too late: %s", stopped)
+	}
+}
+
+// After losing the lease, `TryDo()` and `Run()` return only after the
+// processor has returned.
+func TestLeadWaitsForProcessor(t *testing.T) {
+	leases := &fakeLeases{
+		acquire: func(n int) (bool, error) { return n == 1, nil },
+	}
+	e := newElector(leases)
+
+	returned := make(chan struct{})
+	_, _ = e.TryDo(
+		context.Background(), "p",
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			// Ignore the cancel for a while.
+			time.Sleep(200 * time.Millisecond)
+			close(returned)
+			return nil
+		},
+	)
+	select {
+	case <-returned:
+	default:
+		t.Fatal("TryDo() returned before the processor")
+	}
+}
+
+func TestTryDoLeaseUnavailable(t *testing.T) {
+	leases := &fakeLeases{
+		acquire: func(int) (bool, error) { return false, nil },
+	}
+	e := newElector(leases)
+	ok, err := e.TryDo(
+		context.Background(), "p",
+		func(ctx context.Context) error {
+			t.Error("unexpected call")
+			return nil
+		},
+	)
+	if ok || err != nil {
+		t.Errorf("expected not ok without error, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,68 @@
+package leader
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	bson "gopkg.in/mgo.v2/bson"
+)
+
+// `LeaseStore` is the interface of `Leases`.  Tests may use an in-memory
+// implementation.
+type LeaseStore interface {
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+	Release(name, holder string) error
+}
+
+// `Leases` stores leases as MongoDB documents `LeaseDoc`.  It is used by
+// `Elector` and by other users of leases, like the repo locks of `statdsd`.
+type Leases struct {
+	c *mgo.Collection
+}
+
+func NewLeases(conn *mgo.Session, collection string) *Leases {
+	return &Leases{c: conn.DB("").C(collection)}
+}
+
+// `Acquire()` takes or renews the lease `name` for `holder` until `ttl` from
+// now.  It returns false if another holder has an unexpired lease.  If so,
+// the upsert tries to insert a duplicate id, which fails.
+func (l *Leases) Acquire(
+	name, holder string, ttl time.Duration,
+) (bool, error) {
+	now := time.Now()
+	_, err := l.c.Upsert(
+		bson.M{
+			KeyId: name,
+			"$or": []bson.M{
+				{KeyHolder: holder},
+				{KeyExpires: bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			KeyHolder:  holder,
+			KeyExpires: now.Add(ttl),
+		}},
+	)
+	switch {
+	case err == nil:
+		return true, nil
+	case mgo.IsDup(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// `Release()` removes the lease `name` if `holder` holds it.  It is not an
+// error if the lease does not exist.
+func (l *Leases) Release(name, holder string) error {
+	err := l.c.Remove(bson.M{
+		KeyId:     name,
+		KeyHolder: holder,
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
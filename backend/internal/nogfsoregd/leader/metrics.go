@@ -0,0 +1,18 @@
+package leader
+
+import (
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+var (
+	leaderGauge = metrics.NewGaugeVec(
+		"nogfsoregd_leader",
+		"Whether this instance holds the lease of a processor.",
+		"name",
+	)
+	leaderLostTotal = metrics.NewCounterVec(
+		"nogfsoregd_leader_lost_total",
+		"Number of times this instance lost the lease of a processor.",
+		"name",
+	)
+)
@@ -8,6 +8,7 @@ import (
 )
 
 const AAFsoReadMain = fsoauthz.AAFsoReadMain
+const AAFsoRevokeToken = fsoauthz.AAFsoRevokeToken
 
 func (srv *Server) authName(
 	ctx context.Context, action auth.Action, name string,
@@ -8,6 +8,7 @@ import (
 	"github.com/nogproject/nog/backend/internal/fsomain"
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
 	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -65,3 +66,71 @@ func (srv *Server) GetRegistries(
 	}
 	return &rsp, nil
 }
+
+func (srv *Server) RevokeJWT(
+	ctx context.Context, req *pb.RevokeJWTI,
+) (*pb.RevokeJWTO, error) {
+	err := srv.authName(ctx, AAFsoRevokeToken, srv.mainName)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Jti == "" && req.Subject == "" {
+		err := status.Error(
+			codes.InvalidArgument, "require jti or subject",
+		)
+		return nil, err
+	}
+
+	vid := fsomain.NoVC
+	if req.MainVid != nil {
+		vid, err = ulid.ParseBytes(req.MainVid)
+		if err != nil {
+			err := status.Errorf(
+				codes.InvalidArgument, "malformed vid: %s", err,
+			)
+			return nil, err
+		}
+	}
+
+	newVid, err := srv.main.RevokeJWT(
+		srv.mainId, vid, req.Jti, req.Subject,
+	)
+	if err != nil {
+		err = status.Errorf(codes.Unknown, "main error: %v", err)
+		return nil, err
+	}
+
+	return &pb.RevokeJWTO{MainVid: newVid[:]}, nil
+}
+
+// `GetJWTRevocations()` requires only a valid JWT.  Revocations are not
+// confidential, and daemons must be able to fetch them with their system JWTs
+// without additional scopes.
+func (srv *Server) GetJWTRevocations(
+	ctx context.Context, req *pb.GetJWTRevocationsI,
+) (*pb.GetJWTRevocationsO, error) {
+	if _, err := srv.authn.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	s, err := srv.main.FindId(srv.mainId)
+	if err != nil {
+		err = status.Errorf(codes.Unknown, "main error: %v", err)
+		return nil, err
+	}
+
+	vid := s.Vid()
+	rsp := pb.GetJWTRevocationsO{
+		Main: srv.mainName,
+		Vid:  vid[:],
+	}
+	for _, r := range s.JWTRevocations() {
+		rsp.Revocations = append(rsp.Revocations, &pb.JWTRevocation{
+			Jti:     r.Jti,
+			Subject: r.Subject,
+			Revoked: ulid.Time(r.Vid).Unix(),
+		})
+	}
+	return &rsp, nil
+}
@@ -1224,6 +1224,36 @@ func (srv *Server) UpdateRepoInitPolicy(
 	return &pb.UpdateRepoInitPolicyO{Vid: newVid[:]}, nil
 }
 
+func (srv *Server) UpdateRepoAutoInitPolicy(
+	ctx context.Context, i *pb.UpdateRepoAutoInitPolicyI,
+) (*pb.UpdateRepoAutoInitPolicyO, error) {
+	policy := i.Policy
+	if policy == nil {
+		err := status.Error(codes.InvalidArgument, "missing policy")
+		return nil, err
+	}
+	root := slashpath.Clean(policy.GlobalRoot)
+	if err := srv.authPath(ctx, AAFsoInitRoot, root); err != nil {
+		return nil, err
+	}
+	policy.GlobalRoot = root
+
+	id, err := srv.parseRegistryName(i.Registry)
+	if err != nil {
+		return nil, err
+	}
+	vid, err := parseRegistryVid(i.Vid)
+	if err != nil {
+		return nil, err
+	}
+	newVid, err := srv.registry.SetRepoAutoInitPolicy(id, vid, policy)
+	if err != nil {
+		return nil, asRegistryGrpcError(err)
+	}
+
+	return &pb.UpdateRepoAutoInitPolicyO{Vid: newVid[:]}, nil
+}
+
 func (srv *Server) EnableGitlabRepo(
 	ctx context.Context, i *pb.EnableGitlabRepoI,
 ) (*pb.EnableGitlabRepoO, error) {
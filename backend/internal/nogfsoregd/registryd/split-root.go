@@ -441,8 +441,9 @@ func (srv *Server) AppendSplitRootDu(
 	dus := make([]splitrootwf.PathUsage, 0, len(i.Paths))
 	for _, p := range i.Paths {
 		dus = append(dus, splitrootwf.PathUsage{
-			Path:  p.Path,
-			Usage: p.Usage,
+			Path:           p.Path,
+			Usage:          p.Usage,
+			NamingBoundary: p.NamingBoundary,
 		})
 	}
 	v, err := srv.splitRootWorkflows.AppendDus(wfId, wfVid, dus)
@@ -961,8 +962,9 @@ func (srv *Server) GetSplitRoot(
 	var du []*pb.PathDiskUsage
 	for _, p := range wf.Du() {
 		du = append(du, &pb.PathDiskUsage{
-			Path:  p.Path,
-			Usage: p.Usage,
+			Path:           p.Path,
+			Usage:          p.Usage,
+			NamingBoundary: p.NamingBoundary,
 		})
 	}
 	o.Du = du
@@ -383,6 +383,9 @@ func (p *Processor) pollMain(op Op, ctx context.Context) error {
 		case mainpb.Event_EV_FSO_REGISTRY_ACCEPTED:
 			// Not interested in accept.  Wait for confirmed.
 
+		case mainpb.Event_EV_JWT_REVOKED:
+			// Not interested in JWT revocations.
+
 		case mainpb.Event_EV_FSO_REGISTRY_CONFIRMED:
 			name := mainEv.FsoRegistryName
 			regId := p.names.UUID(NsFsoRegistry, name)
@@ -635,6 +638,8 @@ func (p *Processor) applyRegistryEvent(
 		return nil
 	case pb.RegistryEvent_EV_FSO_PATH_FLAG_UNSET:
 		return nil
+	case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+		return nil
 	default:
 		// continue with next switch.
 	}
@@ -782,6 +787,8 @@ func (repo *repoView) applyEvent(
 		return nil
 	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_RECIPIENTS_UPDATED:
 		return nil
+	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
+		return nil
 	default:
 		// continue with next switch.
 	}
@@ -1074,6 +1081,8 @@ func (p *Processor) applyRepoEvent(
 		return nil
 	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_RECIPIENTS_UPDATED:
 		return nil
+	case pb.RepoEvent_EV_FSO_SHADOW_BACKUP_COMPLETED:
+		return nil
 
 	default:
 		// continue with next switch.
@@ -402,6 +402,8 @@ func (st *registryState) applyEvent(
 		return nil
 	case pb.RegistryEvent_EV_FSO_PATH_FLAG_UNSET:
 		return nil
+	case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+		return nil
 
 	// Ignore freezerepowf.
 	case pb.RegistryEvent_EV_FSO_FREEZE_REPO_STARTED_2:
@@ -651,6 +653,8 @@ func (p *Processor) applyRegistryEvent(
 		return nil
 	case pb.RegistryEvent_EV_FSO_PATH_FLAG_UNSET:
 		return nil
+	case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+		return nil
 
 	default: // Ignore unknown.
 		p.lg.Errorw(
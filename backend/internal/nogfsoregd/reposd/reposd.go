@@ -95,6 +95,9 @@ func (srv *Server) GetRepo(
 		ArchiveRecipients:      s.ArchiveRecipients().Bytes(),
 		ShadowBackup:           s.ShadowBackupURL(),
 		ShadowBackupRecipients: s.ShadowBackupRecipients().Bytes(),
+		ShadowBackupBundle:     s.ShadowBackupBundle(),
+		ShadowBackupTime:       s.ShadowBackupTime(),
+		ShadowBackupError:      s.ShadowBackupError(),
 		StorageTier:            pbStorageTier(s.StorageTier()),
 		Gitlab:                 s.GitlabLocation(),
 		GitlabProjectId:        s.GitlabProjectId(),
@@ -489,6 +492,38 @@ func (srv *Server) DeleteShadowBackupRecipients(
 	}, nil
 }
 
+// `PostShadowBackupCompleted()` uses `AAFsoInitRepoShadowBackup`, which the
+// backup daemon already needs to initialize the shadow backup URL.
+func (srv *Server) PostShadowBackupCompleted(
+	ctx context.Context, i *pb.PostShadowBackupCompletedI,
+) (*pb.PostShadowBackupCompletedO, error) {
+	id, err := srv.authRepoId(ctx, AAFsoInitRepoShadowBackup, i.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	vid, err := parseVid(i.Vid)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &fsorepos.CmdPostShadowBackupCompleted{
+		StatusCode:    i.StatusCode,
+		StatusMessage: i.StatusMessage,
+	}
+	if b := i.Bundle; b != nil {
+		cmd.Bundle = b.Name
+		cmd.RefsHash = b.RefsHash
+		cmd.Time = b.Time
+	}
+	newVid, err := srv.repos.PostShadowBackupCompleted(id, vid, cmd)
+	if err != nil {
+		return nil, asReposGrpcError(err)
+	}
+
+	return &pb.PostShadowBackupCompletedO{Vid: newVid[:]}, nil
+}
+
 func (srv *Server) ConfirmGit(
 	ctx context.Context, i *pb.ConfirmGitI,
 ) (*pb.ConfirmGitO, error) {
@@ -2,6 +2,7 @@ package nogfsoregd
 
 import (
 	"github.com/nogproject/nog/backend/internal/fsorepos"
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/leader"
 	"github.com/nogproject/nog/backend/internal/nogfsoregd/statdsd"
 	"github.com/nogproject/nog/backend/pkg/auth"
 	"google.golang.org/grpc/credentials"
@@ -14,6 +15,9 @@ func NewStatdsServer(
 	authn auth.Authenticator,
 	authz auth.Authorizer,
 	repos *fsorepos.Repos,
+	repoLocks leader.LeaseStore,
 ) *statdsd.Server {
-	return statdsd.New(lg, advertiseAddr, tls, authn, authz, repos)
+	return statdsd.New(
+		lg, advertiseAddr, tls, authn, authz, repos, repoLocks,
+	)
 }
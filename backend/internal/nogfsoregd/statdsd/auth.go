@@ -16,6 +16,7 @@ import (
 
 const AAFsoFind = fsoauthz.AAFsoFind
 const AAFsoReadRepo = fsoauthz.AAFsoReadRepo
+const AAFsoReadRoot = fsoauthz.AAFsoReadRoot
 const AAFsoInitRepo = fsoauthz.AAFsoInitRepo
 const AAFsoRefreshRepo = fsoauthz.AAFsoRefreshRepo
 const AAFsoSession = fsoauthz.AAFsoSession
@@ -51,6 +52,23 @@ func (srv *Server) authNameLocal(
 	return nil
 }
 
+func (srv *Server) authPathLocal(
+	ctx context.Context, action auth.Action, path string,
+) error {
+	euid, err := srv.authn.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = srv.authz.Authorize(euid, action, map[string]interface{}{
+		"path": path,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (srv *Server) authName(
 	ctx context.Context, action auth.Action, name string,
 ) error {
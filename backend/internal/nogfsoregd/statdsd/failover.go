@@ -0,0 +1,93 @@
+package statdsd
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// `checkSessionHealth()` queries the overall status of the gRPC health
+// service of a Nogfsostad.  Nogfsostads that do not implement the health
+// service are considered healthy as long as they answer pings.
+func (srv *Server) checkSessionHealth(hc healthpb.HealthClient) bool {
+	ctx, cancel := context.WithTimeout(srv.ctx, 2*time.Second)
+	defer cancel()
+	o, err := hc.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return status.Code(err) == codes.Unimplemented
+	}
+	return o.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+func (srv *Server) setSessionHealthy(se *session, healthy bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if se.healthy == healthy {
+		return
+	}
+	wasSelected := srv.selectedPrefixesLocked(se)
+	se.healthy = healthy
+	srv.lg.Infow(
+		"Nogfsostad session health changed.",
+		"module", "statdsd",
+		"slot", se.slot,
+		"healthy", healthy,
+	)
+	srv.logFailoverLocked(se, wasSelected)
+}
+
+// `selectedPrefixesLocked()` returns the prefixes for which `se` is the
+// preferred session.
+func (srv *Server) selectedPrefixesLocked(se *session) []string {
+	var selected []string
+	for _, pfx := range se.prefixes {
+		if srv.findSessionByPathLocked(pfx) == se {
+			selected = append(selected, pfx)
+		}
+	}
+	return selected
+}
+
+// `logFailoverLocked()` reports the sessions that replace `se` for the
+// prefixes for which `se` was the preferred session.
+func (srv *Server) logFailoverLocked(se *session, wasSelected []string) {
+	for _, pfx := range wasSelected {
+		next := srv.findSessionByPathLocked(pfx)
+		switch {
+		case next == se:
+			continue
+		case next == nil:
+			srv.lg.Warnw(
+				"No nogfsostad session left for prefix.",
+				"module", "statdsd",
+				"prefix", pfx,
+				"fromSlot", se.slot,
+			)
+		default:
+			failoversTotal.With(pfx).Inc()
+			srv.lg.Infow(
+				"Failed over nogfsostad session.",
+				"module", "statdsd",
+				"prefix", pfx,
+				"fromSlot", se.slot,
+				"toSlot", next.slot,
+				"toRole", next.role.String(),
+			)
+		}
+	}
+}
+
+func (srv *Server) isSelectedLocked(se *session) bool {
+	return len(srv.selectedPrefixesLocked(se)) > 0
+}
+
+func roleOrActive(r pb.StatdsRole) pb.StatdsRole {
+	if r == pb.StatdsRole_SR_UNSPECIFIED {
+		return pb.StatdsRole_SR_ACTIVE
+	}
+	return r
+}
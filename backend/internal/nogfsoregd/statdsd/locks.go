@@ -0,0 +1,191 @@
+package statdsd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// `RepoLockLeaseDuration` is the time after which a repo lock expires if it is
+// not renewed.  Sessions renew their locks with each ping, see `runSession()`,
+// so the duration must be a multiple of the ping interval.
+var RepoLockLeaseDuration = 1 * time.Minute
+
+// `repoLockRetryInterval` is the wait between attempts to take a lock that
+// is held by another owner.
+var repoLockRetryInterval = 500 * time.Millisecond
+
+// `LockRepo()` and `UnlockRepo()` coordinate repo locks between Nogfsostads
+// that serve the same prefixes.  A lock is a lease in the MongoDB that all
+// Nogfsoregd instances share, so that the locks are effective even if
+// Nogfsostads use different instances.  The lease holder is the Nogfsostad
+// lock owner, which the Nogfsostad keeps across sessions.  A lock remains
+// held when a session ends, because the Nogfsostad may still be processing.
+// The lock is renewed if the Nogfsostad locks the key again in a new session.
+// Otherwise, it expires after `RepoLockLeaseDuration`, so that a standby
+// Nogfsostad can take over the repos of a failed Nogfsostad.
+func (srv *Server) LockRepo(
+	ctx context.Context, i *pb.StatdsLockRepoI,
+) (*pb.StatdsLockRepoO, error) {
+	se, err := srv.authSessionToken(ctx, i.Slot, i.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	key := string(i.Key)
+	holder := repoLockHolder(se, i.Owner)
+	for {
+		if !srv.isSessionActive(se) {
+			return nil, status.Error(codes.Unavailable, "session ended")
+		}
+
+		ok, err := srv.repoLocks.Acquire(
+			key, holder, RepoLockLeaseDuration,
+		)
+		if err != nil {
+			return nil, status.Errorf(
+				codes.Unavailable, "failed to acquire lease: %v",
+				err,
+			)
+		}
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			err := ctx.Err()
+			if err == context.DeadlineExceeded {
+				return nil, status.Error(
+					codes.DeadlineExceeded, err.Error(),
+				)
+			}
+			return nil, status.Error(codes.Canceled, err.Error())
+		case <-srv.ctx.Done():
+			return nil, status.Error(codes.Unavailable, "shutdown")
+		case <-time.After(repoLockRetryInterval):
+		}
+	}
+
+	srv.mu.Lock()
+	if srv.sessions[se.slot] != se {
+		// The session ended while waiting for the lock.  The lease
+		// expires unless the Nogfsostad locks again in a new session.
+		srv.mu.Unlock()
+		return nil, status.Error(codes.Unavailable, "session ended")
+	}
+	se.locks[key] = holder
+	srv.mu.Unlock()
+
+	return &pb.StatdsLockRepoO{}, nil
+}
+
+// `UnlockRepo()` releases the lease if `owner` holds it, including leases that
+// were locked in a previous session.
+func (srv *Server) UnlockRepo(
+	ctx context.Context, i *pb.StatdsUnlockRepoI,
+) (*pb.StatdsUnlockRepoO, error) {
+	se, err := srv.authSessionToken(ctx, i.Slot, i.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	key := string(i.Key)
+	holder := repoLockHolder(se, i.Owner)
+	srv.mu.Lock()
+	if se.locks != nil {
+		delete(se.locks, key)
+	}
+	srv.mu.Unlock()
+
+	if err := srv.repoLocks.Release(key, holder); err != nil {
+		return nil, status.Errorf(
+			codes.Unavailable, "failed to release lease: %v", err,
+		)
+	}
+
+	return &pb.StatdsUnlockRepoO{}, nil
+}
+
+// `repoLockHolder()` returns the lease holder.  Nogfsostads that do not send
+// an owner hold locks only for the duration of the session.
+func repoLockHolder(se *session, owner []byte) string {
+	if len(owner) == 0 {
+		return se.peerName + "/session/" + hex.EncodeToString(se.peerToken)
+	}
+	return se.peerName + "/owner/" + hex.EncodeToString(owner)
+}
+
+func (srv *Server) isSessionActive(se *session) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.sessions[se.slot] == se
+}
+
+// `renewSessionLocks()` renews the leases of the locks of `se`.  It forgets
+// locks whose lease has been taken by another holder, which can only happen
+// if the lease expired, for example because MongoDB was unavailable.
+func (srv *Server) renewSessionLocks(se *session) {
+	srv.mu.Lock()
+	locks := make(map[string]string, len(se.locks))
+	for key, holder := range se.locks {
+		locks[key] = holder
+	}
+	srv.mu.Unlock()
+
+	for key, holder := range locks {
+		ok, err := srv.repoLocks.Acquire(
+			key, holder, RepoLockLeaseDuration,
+		)
+		switch {
+		case err != nil:
+			srv.lg.Warnw(
+				"Failed to renew repo lock.",
+				"module", "statdsd",
+				"slot", se.slot,
+				"key", hex.EncodeToString([]byte(key)),
+				"err", err,
+			)
+		case !ok:
+			srv.lg.Errorw(
+				"Lost repo lock.",
+				"module", "statdsd",
+				"slot", se.slot,
+				"key", hex.EncodeToString([]byte(key)),
+			)
+			srv.mu.Lock()
+			if se.locks != nil && se.locks[key] == holder {
+				delete(se.locks, key)
+			}
+			srv.mu.Unlock()
+		}
+	}
+}
+
+func (srv *Server) authSessionToken(
+	ctx context.Context, slot uint64, token []byte,
+) (*session, error) {
+	srv.mu.Lock()
+	se, ok := srv.sessions[slot]
+	srv.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown session")
+	}
+
+	if err := srv.authNameLocal(ctx, AAFsoSession, se.peerName); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(token, se.peerToken) {
+		return nil, status.Errorf(
+			codes.PermissionDenied, "invalid session token",
+		)
+	}
+
+	return se, nil
+}
@@ -0,0 +1,34 @@
+package statdsd
+
+import (
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+const (
+	sessionStateConnecting = "connecting"
+	sessionStateActive     = "active"
+)
+
+var (
+	sessionsGauge = metrics.NewGaugeVec(
+		"nogfsoregd_statds_sessions",
+		"Number of Nogfsostad callback sessions by state.",
+		"state",
+	)
+	prefixSessionsGauge = metrics.NewGaugeVec(
+		"nogfsoregd_statds_prefix_sessions",
+		"Number of active Nogfsostad callback sessions per prefix.",
+		"prefix",
+	)
+	sessionFailuresTotal = metrics.NewCounterVec(
+		"nogfsoregd_statds_session_failures_total",
+		"Number of Nogfsostad callback sessions that failed.",
+		"reason",
+	)
+)
+
+var failoversTotal = metrics.NewCounterVec(
+	"nogfsoregd_statds_failovers_total",
+	"Number of times requests for a prefix moved to another session.",
+	"prefix",
+)
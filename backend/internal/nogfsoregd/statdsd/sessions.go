@@ -0,0 +1,57 @@
+package statdsd
+
+import (
+	"context"
+	slashpath "path"
+	"sort"
+	"strings"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+)
+
+// `ListSessions()` is answered locally by `nogfsoregd` without contacting
+// `nogfsostad`.  It reports only active sessions, that is sessions that
+// completed the initial ping.
+func (srv *Server) ListSessions(
+	ctx context.Context, i *pb.ListStatdsSessionsI,
+) (*pb.ListStatdsSessionsO, error) {
+	path := slashpath.Clean(i.GlobalPath)
+	if err := srv.authPathLocal(ctx, AAFsoReadRoot, path); err != nil {
+		return nil, err
+	}
+
+	path = ensureTrailingSlash(path)
+	isOverlapping := func(pfx string) bool {
+		return strings.HasPrefix(path, pfx) ||
+			strings.HasPrefix(pfx, path)
+	}
+
+	o := &pb.ListStatdsSessionsO{}
+	srv.mu.Lock()
+	for _, se := range srv.sessions {
+		var prefixes []string
+		for _, pfx := range se.prefixes {
+			if isOverlapping(pfx) {
+				prefixes = append(prefixes, pfx)
+			}
+		}
+		if len(prefixes) == 0 {
+			continue
+		}
+		o.Sessions = append(o.Sessions, &pb.StatdsSession{
+			Slot:        se.slot,
+			Name:        se.peerName,
+			Prefixes:    prefixes,
+			ActiveSince: se.activeSince.Unix(),
+			Role:        se.role,
+			Healthy:     se.healthy,
+			Selected:    srv.isSelectedLocked(se),
+		})
+	}
+	srv.mu.Unlock()
+
+	sort.Slice(o.Sessions, func(i, j int) bool {
+		return o.Sessions[i].Slot < o.Sessions[j].Slot
+	})
+	return o, nil
+}
@@ -0,0 +1,20 @@
+package statdsd
+
+import (
+	"context"
+	slashpath "path"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+)
+
+func (srv *Server) ListJobs(
+	ctx context.Context, i *pb.ListJobsI,
+) (*pb.ListJobsO, error) {
+	path := slashpath.Clean(i.GlobalPath)
+	se, err := srv.authPathSession(ctx, AAFsoReadRoot, path)
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewStadJobsClient(se.conn)
+	return c.ListJobs(copyMetadata(ctx), i)
+}
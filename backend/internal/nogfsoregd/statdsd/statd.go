@@ -38,6 +38,37 @@ func (srv *Server) StatStatus(
 	}
 }
 
+func (srv *Server) WatchProgress(
+	i *pb.WatchProgressI, ostream pb.Stat_WatchProgressServer,
+) error {
+	ctx := ostream.Context()
+	se, err := srv.authRepoIdSession(ctx, AAFsoRefreshRepo, i.Repo)
+	if err != nil {
+		return err
+	}
+
+	c := pb.NewStatClient(se.conn)
+	ctx2, cancel2 := context.WithCancel(copyMetadata(ctx))
+	defer cancel2()
+	istream, err := c.WatchProgress(ctx2, i)
+	if err != nil {
+		return err
+	}
+
+	for {
+		o, err := istream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ostream.Send(o); err != nil {
+			return err
+		}
+	}
+}
+
 func (srv *Server) Stat(
 	ctx context.Context, i *pb.StatI,
 ) (*pb.StatO, error) {
@@ -15,10 +15,15 @@ import (
 
 	"github.com/nogproject/nog/backend/internal/fsorepos"
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsoregd/leader"
 	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcmetrics"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
@@ -41,6 +46,9 @@ type Server struct {
 	connSlots map[uint64]chan<- net.Conn
 	sessions  map[uint64]*session
 
+	// `repoLocks` stores the repo locks as leases; see `LockRepo()`.
+	repoLocks leader.LeaseStore
+
 	repos *fsorepos.Repos
 }
 
@@ -57,6 +65,7 @@ func New(
 	authn auth.Authenticator,
 	authz auth.Authorizer,
 	repos *fsorepos.Repos,
+	repoLocks leader.LeaseStore,
 ) *Server {
 	return &Server{
 		lg:            lg,
@@ -66,6 +75,7 @@ func New(
 		authz:         authz,
 		connSlots:     make(map[uint64]chan<- net.Conn),
 		sessions:      make(map[uint64]*session),
+		repoLocks:     repoLocks,
 		repos:         repos,
 	}
 }
@@ -214,6 +224,40 @@ type session struct {
 	peerName  string
 	peerToken []byte
 	prefixes  []string
+	role      pb.StatdsRole
+
+	// `activeSince` is set when the session is added to `sessions`.  The
+	// other fields below are protected by `Server.mu`.
+	activeSince time.Time
+	healthy     bool
+	// `locks` maps the repo lock keys that were locked via the session
+	// to the lease holders.  The session renews the leases.
+	locks map[string]string
+}
+
+// `isPreferredOver()` defines the order in which sessions are selected for a
+// path: healthy before unhealthy, active before standby, and older before
+// newer, so that the selection remains stable while sessions come and go.
+func (a *session) isPreferredOver(b *session) bool {
+	if a.healthy != b.healthy {
+		return a.healthy
+	}
+	if a.role != b.role {
+		return a.role == pb.StatdsRole_SR_ACTIVE
+	}
+	if !a.activeSince.Equal(b.activeSince) {
+		return a.activeSince.Before(b.activeSince)
+	}
+	return a.slot < b.slot
+}
+
+func (a *session) hasPrefixOf(path string) bool {
+	for _, pfx := range a.prefixes {
+		if strings.HasPrefix(path, pfx) {
+			return true
+		}
+	}
+	return false
 }
 
 func (srv *Server) Hello(
@@ -252,6 +296,7 @@ func (srv *Server) Hello(
 		peerName:  i.Name,
 		peerToken: i.SessionToken,
 		prefixes:  i.Prefixes,
+		role:      roleOrActive(i.Role),
 	}
 	srv.wg.Add(1)
 	go func() {
@@ -267,10 +312,24 @@ func (srv *Server) Hello(
 }
 
 func (srv *Server) runSession(se *session, connSlot <-chan net.Conn) {
+	state := sessionStateConnecting
+	sessionsGauge.With(state).Inc()
 	cleanupSession := func() {
+		sessionsGauge.With(state).Dec()
+		if state == sessionStateActive {
+			for _, pfx := range se.prefixes {
+				prefixSessionsGauge.With(pfx).Dec()
+			}
+		}
 		srv.mu.Lock()
+		wasSelected := srv.selectedPrefixesLocked(se)
 		delete(srv.connSlots, se.slot)
 		delete(srv.sessions, se.slot)
+		// The repo lock leases are not released.  The Nogfsostad
+		// may still be processing.  It either locks the keys again
+		// in a new session, or the leases expire.
+		se.locks = nil
+		srv.logFailoverLocked(se, wasSelected)
 		srv.mu.Unlock()
 		if se.conn != nil {
 			se.conn.Close()
@@ -295,13 +354,17 @@ func (srv *Server) runSession(se *session, connSlot <-chan net.Conn) {
 		}
 	}
 
-	conn, err := grpc.DialContext(
-		ctx,
-		se.peerName,
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(srv.tls),
 		grpc.WithDialer(dialer),
-	)
+	}
+	dialOpts = append(dialOpts, grpcchain.DialOptions(
+		grpctrace.Client,
+		grpcmetrics.Client,
+	)...)
+	conn, err := grpc.DialContext(ctx, se.peerName, dialOpts...)
 	if err != nil {
+		sessionFailuresTotal.With("dial").Inc()
 		srv.lg.Warnw(
 			"Failed to dial session.",
 			"err", err,
@@ -318,6 +381,7 @@ func (srv *Server) runSession(se *session, connSlot <-chan net.Conn) {
 		SessionToken: se.peerToken,
 	})
 	if err != nil {
+		sessionFailuresTotal.With("initial-ping").Inc()
 		srv.lg.Warnw(
 			"Initial session ping failed.",
 			"err", err,
@@ -328,6 +392,7 @@ func (srv *Server) runSession(se *session, connSlot <-chan net.Conn) {
 		return
 	}
 	if !bytes.Equal(o.SessionToken, se.ourToken) {
+		sessionFailuresTotal.With("initial-token").Inc()
 		srv.lg.Errorw(
 			"Invalid initial session token.",
 			"module", "statdsd",
@@ -340,15 +405,27 @@ func (srv *Server) runSession(se *session, connSlot <-chan net.Conn) {
 	cancel() // Release init timeout.
 
 	srv.mu.Lock()
+	se.activeSince = time.Now()
+	se.healthy = true
+	se.locks = make(map[string]string)
 	srv.sessions[se.slot] = se
 	srv.mu.Unlock()
+	sessionsGauge.With(state).Dec()
+	state = sessionStateActive
+	sessionsGauge.With(state).Inc()
+	for _, pfx := range se.prefixes {
+		prefixSessionsGauge.With(pfx).Inc()
+	}
 	srv.lg.Infow(
 		"New nogfsostad session.",
 		"module", "statdsd",
 		"slot", se.slot,
 		"prefixes", se.prefixes,
+		"role", se.role.String(),
 	)
 
+	hc := healthpb.NewHealthClient(conn)
+
 	tick := time.NewTicker(10 * time.Second)
 	defer tick.Stop()
 Loop:
@@ -363,6 +440,7 @@ Loop:
 			})
 			cancel() // Release timeout.
 			if err != nil {
+				sessionFailuresTotal.With("ping").Inc()
 				srv.lg.Warnw(
 					"Session ping failed.",
 					"err", err,
@@ -371,6 +449,7 @@ Loop:
 				break Loop
 			}
 			if !bytes.Equal(o.SessionToken, se.ourToken) {
+				sessionFailuresTotal.With("token").Inc()
 				srv.lg.Errorw(
 					"Invalid session token.",
 					"err", err,
@@ -378,6 +457,8 @@ Loop:
 				)
 				break Loop
 			}
+			srv.setSessionHealthy(se, srv.checkSessionHealth(hc))
+			srv.renewSessionLocks(se)
 		case <-srv.ctx.Done():
 			break Loop
 		}
@@ -401,26 +482,37 @@ func newToken() ([]byte, error) {
 	return b, nil
 }
 
+// `findSessionByPath()` selects the preferred session among the sessions
+// whose prefixes contain the path; see `session.isPreferredOver()`.
 func (srv *Server) findSessionByPath(globalPath string) *session {
 	path := ensureTrailingSlash(globalPath)
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
+	return srv.findSessionByPathLocked(path)
+}
+
+func (srv *Server) findSessionByPathLocked(path string) *session {
+	var best *session
 	for _, s := range srv.sessions {
-		for _, pfx := range s.prefixes {
-			if strings.HasPrefix(path, pfx) {
-				return s
-			}
+		if !s.hasPrefixOf(path) {
+			continue
+		}
+		if best == nil || s.isPreferredOver(best) {
+			best = s
 		}
 	}
-	return nil
+	return best
 }
 
+// `copyMetadata()` forwards the incoming metadata, which contains the auth
+// token, to nogfsostad.  The trace context is replaced, so that the
+// nogfsostad span becomes a child of the current span.
 func copyMetadata(ctx context.Context) context.Context {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return ctx
+		return grpctrace.Inject(ctx)
 	}
-	return metadata.NewOutgoingContext(ctx, md)
+	return grpctrace.Inject(metadata.NewOutgoingContext(ctx, md))
 }
 
 func ensureTrailingSlash(s string) string {
@@ -0,0 +1,261 @@
+package statdsd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{})  {}
+func (nullLogger) Warnw(msg string, kv ...interface{})  {}
+func (nullLogger) Errorw(msg string, kv ...interface{}) {}
+
+type allowAll struct{}
+
+func (allowAll) Authenticate(ctx context.Context) (auth.Identity, error) {
+	return auth.Identity{}, nil
+}
+
+func (allowAll) Authorize(
+	euid auth.Identity, action auth.Action, details auth.ActionDetails,
+) error {
+	return nil
+}
+
+// `memLeases` is an in-memory `leader.LeaseStore`.
+type memLeases struct {
+	mu     sync.Mutex
+	leases map[string]memLease
+}
+
+type memLease struct {
+	holder  string
+	expires time.Time
+}
+
+func newMemLeases() *memLeases {
+	return &memLeases{leases: make(map[string]memLease)}
+}
+
+func (m *memLeases) Acquire(
+	name, holder string, ttl time.Duration,
+) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	l, ok := m.leases[name]
+	if ok && l.holder != holder && l.expires.After(now) {
+		return false, nil
+	}
+	m.leases[name] = memLease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *memLeases) Release(name, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leases[name]; ok && l.holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
+
+func (m *memLeases) holder(name string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leases[name].holder
+}
+
+func newTestServer(leases *memLeases) *Server {
+	srv := New(nullLogger{}, "", nil, allowAll{}, allowAll{}, nil, leases)
+	srv.ctx = context.Background()
+	return srv
+}
+
+func (srv *Server) addTestSession(
+	slot uint64, prefixes []string, role pb.StatdsRole,
+	activeSince time.Time,
+) *session {
+	se := &session{
+		slot:        slot,
+		peerName:    "stad",
+		peerToken:   []byte{byte(slot)},
+		prefixes:    prefixes,
+		role:        role,
+		activeSince: activeSince,
+		healthy:     true,
+		locks:       make(map[string]string),
+	}
+	srv.sessions[slot] = se
+	return se
+}
+
+func TestIsPreferredOver(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := t0.Add(time.Second)
+	newSe := func(
+		slot uint64, healthy bool, role pb.StatdsRole, since time.Time,
+	) *session {
+		return &session{
+			slot: slot, healthy: healthy, role: role,
+			activeSince: since,
+		}
+	}
+	active := pb.StatdsRole_SR_ACTIVE
+	standby := pb.StatdsRole_SR_STANDBY
+
+	for _, c := range []struct {
+		name string
+		a, b *session
+	}{
+		{
+			"healthy before unhealthy",
+			newSe(2, true, standby, t1), newSe(1, false, active, t0),
+		},
+		{
+			"active before standby",
+			newSe(2, true, active, t1), newSe(1, true, standby, t0),
+		},
+		{
+			"older before newer",
+			newSe(2, true, active, t0), newSe(1, true, active, t1),
+		},
+		{
+			"lower slot if same age",
+			newSe(1, true, active, t0), newSe(2, true, active, t0),
+		},
+	} {
+		if !c.a.isPreferredOver(c.b) {
+			t.Errorf("%s: expected a preferred over b", c.name)
+		}
+		if c.b.isPreferredOver(c.a) {
+			t.Errorf("%s: expected b not preferred over a", c.name)
+		}
+	}
+}
+
+func TestFindSessionByPathLocked(t *testing.T) {
+	srv := newTestServer(newMemLeases())
+	t0 := time.Unix(1000, 0)
+	active := pb.StatdsRole_SR_ACTIVE
+	standby := pb.StatdsRole_SR_STANDBY
+	a := srv.addTestSession(1, []string{"/a/"}, standby, t0)
+	b := srv.addTestSession(2, []string{"/a/", "/b/"}, active, t0)
+
+	if se := srv.findSessionByPathLocked("/a/x/"); se != b {
+		t.Errorf("expected active session for /a/, got %v", se)
+	}
+	if se := srv.findSessionByPathLocked("/c/"); se != nil {
+		t.Errorf("expected no session for /c/, got %v", se)
+	}
+
+	b.healthy = false
+	if se := srv.findSessionByPathLocked("/a/x/"); se != a {
+		t.Errorf("expected healthy standby after failover, got %v", se)
+	}
+	if se := srv.findSessionByPathLocked("/b/"); se != b {
+		t.Errorf("expected unhealthy session as only candidate")
+	}
+}
+
+func TestLockUnlockRepo(t *testing.T) {
+	leases := newMemLeases()
+	srv := newTestServer(leases)
+	t0 := time.Unix(1000, 0)
+	active := pb.StatdsRole_SR_ACTIVE
+	a := srv.addTestSession(1, []string{"/a/"}, active, t0)
+	b := srv.addTestSession(2, []string{"/a/"}, active, t0)
+	ctx := context.Background()
+
+	lock := func(
+		ctx context.Context, se *session, owner string,
+	) error {
+		_, err := srv.LockRepo(ctx, &pb.StatdsLockRepoI{
+			Slot:         se.slot,
+			SessionToken: se.peerToken,
+			Key:          []byte("k"),
+			Owner:        []byte(owner),
+		})
+		return err
+	}
+	unlock := func(se *session, owner string) error {
+		_, err := srv.UnlockRepo(ctx, &pb.StatdsUnlockRepoI{
+			Slot:         se.slot,
+			SessionToken: se.peerToken,
+			Key:          []byte("k"),
+			Owner:        []byte(owner),
+		})
+		return err
+	}
+
+	if err := lock(ctx, a, "oa"); err != nil {
+		t.Fatalf("lock a failed: %v", err)
+	}
+	if a.locks["k"] == "" {
+		t.Error("expected session a to record the lock")
+	}
+
+	// b waits until a unlocks.
+	ctxB, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	err := lock(ctxB, b, "ob")
+	cancel()
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// The same owner can lock again in a new session.
+	a2 := srv.addTestSession(3, []string{"/a/"}, active, t0)
+	delete(srv.sessions, a.slot)
+	if err := lock(ctx, a2, "oa"); err != nil {
+		t.Fatalf("relock in new session failed: %v", err)
+	}
+
+	lockedB := make(chan error, 1)
+	go func() {
+		lockedB <- lock(ctx, b, "ob")
+	}()
+	if err := unlock(a2, "oa"); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if err := <-lockedB; err != nil {
+		t.Fatalf("lock b after unlock failed: %v", err)
+	}
+	if h := leases.holder("k"); h != repoLockHolder(b, []byte("ob")) {
+		t.Errorf("unexpected lease holder %q", h)
+	}
+	if _, ok := a2.locks["k"]; ok {
+		t.Error("expected unlock to remove the lock from the session")
+	}
+
+	// Unlocking a lock of another owner does not release it.
+	if err := unlock(a2, "oa"); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if h := leases.holder("k"); h != repoLockHolder(b, []byte("ob")) {
+		t.Errorf("expected lease to remain held by b, got %q", h)
+	}
+}
+
+func TestLockRepoSessionEnded(t *testing.T) {
+	srv := newTestServer(newMemLeases())
+	se := srv.addTestSession(
+		1, []string{"/a/"}, pb.StatdsRole_SR_ACTIVE, time.Unix(1000, 0),
+	)
+	delete(srv.sessions, se.slot)
+	_, err := srv.LockRepo(context.Background(), &pb.StatdsLockRepoI{
+		Slot:         se.slot,
+		SessionToken: se.peerToken,
+		Key:          []byte("k"),
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for unknown session, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package statdsd
 
 import (
 	"context"
+	"io"
 
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
 )
@@ -38,3 +39,34 @@ func (srv *Server) GetTarttconfig(
 	c := pb.NewTarttClient(se.conn)
 	return c.GetTarttconfig(copyMetadata(ctx), i)
 }
+
+func (srv *Server) RestoreStream(
+	i *pb.RestoreStreamI, ostream pb.Tartt_RestoreStreamServer,
+) error {
+	ctx := ostream.Context()
+	se, err := srv.authRepoIdSession(ctx, AAFsoReadRepo, i.Repo)
+	if err != nil {
+		return err
+	}
+
+	c := pb.NewTarttClient(se.conn)
+	ctx2, cancel2 := context.WithCancel(copyMetadata(ctx))
+	defer cancel2()
+	istream, err := c.RestoreStream(ctx2, i)
+	if err != nil {
+		return err
+	}
+
+	for {
+		o, err := istream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ostream.Send(o); err != nil {
+			return err
+		}
+	}
+}
@@ -38,6 +38,9 @@ type splitRootWorkflowView struct {
 	statusCode    int32
 	statusMessage string
 	du            duTree
+	// `namingBoundaries` are the du paths that the repo naming rule
+	// reports as repos.
+	namingBoundaries pathSet
 }
 
 func (a *splitRootWorkflowActivity) ProcessRegistryWorkflowEvents(
@@ -51,6 +54,8 @@ func (a *splitRootWorkflowActivity) ProcessRegistryWorkflowEvents(
 		view := splitRootWorkflowView{
 			workflowId: workflowId,
 			du:         make(map[string]int64),
+
+			namingBoundaries: make(pathSet),
 		}
 		if err := wfstreams.LoadRegistryWorkflowEventsNoBlock(
 			stream, &view,
@@ -93,6 +98,9 @@ func (view *splitRootWorkflowView) LoadWorkflowEvent(
 	case *wfevents.EvSplitRootDuAppended:
 		view.scode = splitrootwf.StateDuAppending
 		view.du[x.Path] = x.Usage
+		if x.NamingBoundary {
+			view.namingBoundaries[x.Path] = struct{}{}
+		}
 		return nil
 
 	case *wfevents.EvSplitRootDuCompleted:
@@ -171,6 +179,7 @@ func (a *splitRootWorkflowActivity) processView(
 			ctx, view.workflowId, view.vid,
 			view.root,
 			view.du,
+			view.namingBoundaries,
 			&analysisConfig{
 				MinDiskUsage: view.minDiskUsage,
 				MaxDiskUsage: view.maxDiskUsage,
@@ -259,6 +268,7 @@ func (a *splitRootWorkflowActivity) doAnalyzeAndContinue(
 	vid ulid.I,
 	root string,
 	du duTree,
+	namingBoundaries pathSet,
 	cfg *analysisConfig,
 ) (bool, error) {
 	known, err := a.listRepos(ctx, root)
@@ -276,6 +286,8 @@ func (a *splitRootWorkflowActivity) doAnalyzeAndContinue(
 		du:        du,
 		known:     known,
 		dontSplit: dontSplit,
+
+		namingBoundaries: namingBoundaries,
 	}
 	suggestions := ana.Analyze(".", 0)
 
@@ -333,6 +345,8 @@ type analyzer struct {
 	du        duTree
 	known     pathSet
 	dontSplit pathSet
+
+	namingBoundaries pathSet
 }
 
 type analysisConfig struct {
@@ -411,7 +425,10 @@ func (ana *analyzer) Analyze(
 	// tars for the levels close to the root.  An unknown toplevel is
 	// always a candidate, indepently of its size, to ensure that every
 	// root will have at least one repo.  But if the toplevel is small, do
-	// not recurse.
+	// not recurse.  An unknown path that the repo naming rule reports as a
+	// repo is always a candidate, independently of its size, and the
+	// analysis stops there, because discovery would not report repos
+	// below it either.
 	//
 	// If the repo is too small to split, decide and return.  Use
 	// `SMALL_REPO` only if the repo could be split, i.e. if it has
@@ -422,7 +439,10 @@ func (ana *analyzer) Analyze(
 	//
 	// For larger repos, record the repo and recurse.
 	if !ana.known.Has(path) {
-		if size >= ana.cfg.MinDiskUsage {
+		if ana.namingBoundaries.Has(path) {
+			appendSug(pb.FsoSplitRootSuggestion_S_REPO_CANDIDATE)
+			return sugs
+		} else if size >= ana.cfg.MinDiskUsage {
 			appendSug(pb.FsoSplitRootSuggestion_S_REPO_CANDIDATE)
 		} else if level == 0 {
 			appendSug(pb.FsoSplitRootSuggestion_S_REPO_CANDIDATE)
@@ -0,0 +1,64 @@
+package workflowproc
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+)
+
+func analyzeSuggestions(ana *analyzer) map[string]string {
+	sugs := make(map[string]string)
+	for _, s := range ana.Analyze(".", 0) {
+		sugs[s.Path] = s.Suggestion.String()
+	}
+	return sugs
+}
+
+// A naming boundary is a repo candidate independently of its size, and the
+// analysis does not suggest candidates below it.
+func TestAnalyzeStopsAtNamingBoundary(t *testing.T) {
+	cand := pb.FsoSplitRootSuggestion_S_REPO_CANDIDATE.String()
+	small := pb.FsoSplitRootSuggestion_S_SMALL_DIR.String()
+
+	ana := &analyzer{
+		cfg: &analysisConfig{
+			MinDiskUsage: 100,
+			MaxDiskUsage: 1000,
+		},
+		du: duTree{
+			".":          10000,
+			"marked":     5000,
+			"marked/big": 4000,
+			"plain":      4000,
+			"plain/big":  3000,
+			"tiny":       1,
+			"tinymark":   1,
+		},
+		known: pathSet{},
+		namingBoundaries: pathSet{
+			"marked":   struct{}{},
+			"tinymark": struct{}{},
+		},
+	}
+
+	expected := map[string]string{
+		".":         cand,
+		"marked":    cand,
+		"plain":     cand,
+		"plain/big": cand,
+		"tiny":      small,
+		"tinymark":  cand,
+	}
+	if got := analyzeSuggestions(ana); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected suggestions %v, got %v", expected, got)
+	}
+
+	// Without boundaries, the analysis recurses into large dirs.
+	ana.namingBoundaries = nil
+	expected["marked/big"] = cand
+	expected["tinymark"] = small
+	if got := analyzeSuggestions(ana); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected suggestions %v, got %v", expected, got)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	wfstreams "github.com/nogproject/nog/backend/internal/workflows/eventstreams"
 	"github.com/nogproject/nog/backend/internal/workflows/unarchiverepowf"
 	"github.com/nogproject/nog/backend/pkg/execx"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc"
@@ -166,6 +167,11 @@ func (a *unarchiveRepoWorkflowActivity) processView(
 	ctx context.Context,
 	view unarchiveRepoWorkflowView,
 ) (bool, error) {
+	ctx, span := trace.StartWorkflow(
+		ctx, "unarchive-repo", view.workflowId, view.vid,
+	)
+	defer span.End()
+
 	switch view.scode {
 	case unarchiverepowf.StateUninitialized:
 		return a.doContinue()
@@ -285,9 +291,10 @@ func (a *unarchiveRepoWorkflowActivity) tarttRestore(
 		fmt.Sprintf("--dest=%s", restore),
 		tsPath,
 	)
+	cmd.Env = append(os.Environ(), trace.Environ(ctx)...)
 	if a.capPath != "" {
 		path := fmt.Sprintf("PATH=%s:%s", a.capPath, os.Getenv("PATH"))
-		cmd.Env = append(os.Environ(), path)
+		cmd.Env = append(cmd.Env, path)
 	}
 	cmd.Stdout = logFp
 	cmd.Stderr = logFp
@@ -0,0 +1,249 @@
+package discoveryd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc/status"
+)
+
+// `autoInitMaxWalk` limits the number of directory entries that the
+// quarantine check inspects per candidate.  Larger candidates are not
+// initialized automatically.  They would usually be refused by the init
+// limits anyway.
+const autoInitMaxWalk = 100000
+
+var errAutoInitWalkLimit = errors.New("walk limit exceeded")
+var errAutoInitModified = errors.New("recently modified")
+
+// `autoInitState` tracks auto init failures, so that a failure is reported to
+// the audit log only once until the reason changes.  Key: global path.
+type autoInitState struct {
+	mu       sync.Mutex
+	failures map[string]string
+}
+
+// `AutoInitRecord` is the JSON record that is appended to the audit log for
+// each auto init attempt that reached the registry.
+type AutoInitRecord struct {
+	Time       string `json:"time"`
+	Registry   string `json:"registry"`
+	GlobalRoot string `json:"globalRoot"`
+	GlobalPath string `json:"globalPath"`
+	RepoId     string `json:"repoId,omitempty"`
+	Result     string `json:"result"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+const (
+	AutoInitResultInitialized = "initialized"
+	AutoInitResultFailed      = "failed"
+)
+
+// `AutoInitAll()` initializes repos for the untracked candidates of all roots
+// for which auto init is enabled.  A candidate is only initialized if its
+// directory tree has not been modified during the quarantine duration.  Repos
+// are initialized via the registry `InitRepo()`, using the Nogfsostad system
+// JWT, so that init limits are checked as usual.
+func (srv *Server) AutoInitAll(ctx context.Context) error {
+	for _, root := range srv.registryView.autoInitRoots() {
+		if err := srv.autoInitRoot(ctx, root); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			srv.lg.Errorw(
+				"Auto init root failed.",
+				"module", "discoveryd",
+				"root", root.globalRoot,
+				"err", err,
+			)
+		}
+	}
+	return ctx.Err()
+}
+
+func (srv *Server) autoInitRoot(
+	ctx context.Context, root *namingConfig,
+) error {
+	finder, err := srv.newFinder(root.rule, root.ruleConfig)
+	if err != nil {
+		return err
+	}
+	known := srv.registryView.knownReposForRoot(root.globalRoot)
+
+	var candidates []string
+	if err := finder.Find(root.hostRoot, known, rules.FindHandlerFuncs{
+		CandidateFn: func(relpath string) error {
+			candidates = append(candidates, relpath)
+			return nil
+		},
+		IgnoreFn: func(relpath string) error {
+			return nil
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to find candidates: %v", err)
+	}
+
+	quarantine := time.Duration(root.autoInit.QuarantineSeconds) *
+		time.Second
+	for _, relpath := range candidates {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		hostPath := filepath.Join(root.hostRoot, relpath)
+		cutoff := time.Now().Add(-quarantine)
+		switch err := checkUnmodifiedSince(hostPath, cutoff); {
+		case err == errAutoInitModified:
+			srv.lg.Infow(
+				"Postponed auto init of recently modified candidate.",
+				"module", "discoveryd",
+				"hostPath", hostPath,
+				"quarantine", quarantine,
+			)
+			continue
+		case err != nil:
+			srv.lg.Warnw(
+				"Skipped auto init candidate.",
+				"module", "discoveryd",
+				"hostPath", hostPath,
+				"err", err,
+			)
+			continue
+		}
+
+		srv.autoInitRepo(ctx, root, relpath)
+	}
+
+	return nil
+}
+
+func (srv *Server) autoInitRepo(
+	ctx context.Context, root *namingConfig, relpath string,
+) {
+	globalPath := strings.TrimRight(root.globalRoot, "/") + "/" + relpath
+	rec := AutoInitRecord{
+		Registry:   root.registry,
+		GlobalRoot: strings.TrimRight(root.globalRoot, "/"),
+		GlobalPath: globalPath,
+	}
+
+	v := srv.registryView
+	o, err := v.origin.InitRepo(ctx, &pb.InitRepoI{
+		Registry:     root.registry,
+		GlobalPath:   globalPath,
+		CreatorName:  root.autoInit.AuthorName,
+		CreatorEmail: root.autoInit.AuthorEmail,
+	}, v.sysRPCCreds)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		reason := status.Convert(err).Message()
+		if !srv.autoInit.setFailure(globalPath, reason) {
+			return
+		}
+		srv.lg.Warnw(
+			"Auto init repo failed.",
+			"module", "discoveryd",
+			"repo", globalPath,
+			"err", err,
+		)
+		rec.Result = AutoInitResultFailed
+		rec.Reason = reason
+		srv.appendAutoInitAudit(rec)
+		return
+	}
+
+	srv.autoInit.clearFailure(globalPath)
+	rec.Result = AutoInitResultInitialized
+	if repoId, err := uuid.FromBytes(o.Repo); err == nil {
+		rec.RepoId = repoId.String()
+	}
+	srv.lg.Infow(
+		"Auto-initialized repo.",
+		"module", "discoveryd",
+		"repo", globalPath,
+		"repoId", rec.RepoId,
+	)
+	srv.appendAutoInitAudit(rec)
+}
+
+// `setFailure()` returns `true` if the failure reason for `path` changed.
+func (st *autoInitState) setFailure(path, reason string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.failures[path] == reason {
+		return false
+	}
+	st.failures[path] = reason
+	return true
+}
+
+func (st *autoInitState) clearFailure(path string) {
+	st.mu.Lock()
+	delete(st.failures, path)
+	st.mu.Unlock()
+}
+
+func (srv *Server) appendAutoInitAudit(rec AutoInitRecord) {
+	if srv.autoInitAudit == nil {
+		return
+	}
+	rec.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		panic(err)
+	}
+	line = append(line, '\n')
+
+	srv.autoInitAuditMu.Lock()
+	_, err = srv.autoInitAudit.Write(line)
+	srv.autoInitAuditMu.Unlock()
+	if err != nil {
+		srv.lg.Errorw(
+			"Failed to write auto init audit log.",
+			"module", "discoveryd",
+			"err", err,
+		)
+	}
+}
+
+// `checkUnmodifiedSince()` walks the directory tree `path` and returns
+// `errAutoInitModified` if the mtime or ctime of any entry is after `cutoff`.
+func checkUnmodifiedSince(path string, cutoff time.Time) error {
+	n := 0
+	err := filepath.Walk(path, func(
+		p string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			return err
+		}
+		n++
+		if n > autoInitMaxWalk {
+			return errAutoInitWalkLimit
+		}
+		if info.ModTime().After(cutoff) {
+			return errAutoInitModified
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			ctime := time.Unix(st.Ctim.Sec, st.Ctim.Nsec)
+			if ctime.After(cutoff) {
+				return errAutoInitModified
+			}
+		}
+		return nil
+	})
+	return err
+}
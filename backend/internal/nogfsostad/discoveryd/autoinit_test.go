@@ -0,0 +1,61 @@
+package discoveryd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckUnmodifiedSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoinit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(sub, "data")
+	if err := ioutil.WriteFile(file, []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything is older than a future cutoff.
+	future := time.Now().Add(time.Hour)
+	if err := checkUnmodifiedSince(dir, future); err != nil {
+		t.Errorf("expected unmodified, got %v", err)
+	}
+
+	// Entries that are newer than the cutoff postpone the candidate.
+	past := time.Now().Add(-time.Hour)
+	if err := checkUnmodifiedSince(dir, past); err != errAutoInitModified {
+		t.Errorf("expected errAutoInitModified, got %v", err)
+	}
+
+	if err := checkUnmodifiedSince(
+		filepath.Join(dir, "missing"), future,
+	); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestAutoInitStateReportsFailureOnce(t *testing.T) {
+	st := autoInitState{failures: make(map[string]string)}
+	if !st.setFailure("/a", "limit") {
+		t.Error("expected first failure to be reported")
+	}
+	if st.setFailure("/a", "limit") {
+		t.Error("expected repeated failure to be suppressed")
+	}
+	if !st.setFailure("/a", "other") {
+		t.Error("expected changed failure to be reported")
+	}
+	st.clearFailure("/a")
+	if !st.setFailure("/a", "other") {
+		t.Error("expected failure after clear to be reported")
+	}
+}
@@ -2,7 +2,9 @@ package discoveryd
 
 import (
 	"context"
+	"io"
 	slashpath "path"
+	"sync"
 
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
@@ -21,6 +23,9 @@ type Config struct {
 	Authenticator        auth.Authenticator
 	Authorizer           auth.Authorizer
 	SysRPCCreds          credentials.PerRPCCredentials
+	// `AutoInitAuditLog`, if non-nil, receives a JSON line for each auto
+	// init attempt; see `AutoInitAll()`.
+	AutoInitAuditLog io.Writer
 }
 
 type Server struct {
@@ -29,6 +34,10 @@ type Server struct {
 	authz                auth.Authorizer
 	registryView         *registryView
 	stdtoolsProjectsRoot string
+
+	autoInit        *autoInitState
+	autoInitAuditMu sync.Mutex
+	autoInitAudit   io.Writer
 }
 
 type Logger interface {
@@ -45,6 +54,10 @@ func New(lg Logger, conn *grpc.ClientConn, cfg *Config) *Server {
 		authz:                cfg.Authorizer,
 		registryView:         newRegistryView(lg, conn, cfg),
 		stdtoolsProjectsRoot: cfg.StdtoolsProjectsRoot,
+		autoInit: &autoInitState{
+			failures: make(map[string]string),
+		},
+		autoInitAudit: cfg.AutoInitAuditLog,
 	}
 }
 
@@ -52,6 +65,48 @@ func (srv *Server) Watch(ctx context.Context) error {
 	return srv.registryView.watch(ctx)
 }
 
+// `FindNamingBoundaries()` returns the known repos and the untracked repo
+// candidates below `globalRoot` as relative paths if the naming rule of the
+// root identifies repos by marker files or owner boundaries.  It returns `nil`
+// for other rules, since they do not indicate useful split-root boundaries.
+func (srv *Server) FindNamingBoundaries(
+	ctx context.Context, globalRoot string,
+) (map[string]bool, error) {
+	globalRoot = slashpath.Clean(globalRoot)
+	cfg, err := srv.registryView.getNamingConfig(globalRoot)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.rule {
+	case "MarkerFiles":
+	case "OwnerBoundary":
+	default:
+		return nil, nil
+	}
+
+	finder, err := srv.newFinder(cfg.rule, cfg.ruleConfig)
+	if err != nil {
+		return nil, err
+	}
+	known := srv.registryView.knownReposForRoot(globalRoot)
+
+	boundaries := make(map[string]bool)
+	add := func(relpath string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		boundaries[relpath] = true
+		return nil
+	}
+	if err := finder.Find(cfg.hostRoot, known, rules.FindHandlerFuncs{
+		CandidateFn: add,
+		KnownFn:     add,
+	}); err != nil {
+		return nil, err
+	}
+	return boundaries, nil
+}
+
 func (srv *Server) FindUntracked(
 	i *pb.FindUntrackedI, ostream pb.Discovery_FindUntrackedServer,
 ) error {
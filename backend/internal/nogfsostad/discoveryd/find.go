@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 
+	registryev "github.com/nogproject/nog/backend/internal/fsoregistry/pbevents"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulesdefault"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulesmarker"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulesowner"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulespatterns"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulesstdtools"
 	"google.golang.org/grpc/codes"
@@ -51,6 +54,54 @@ func (srv *Server) newFinder(
 			EnabledPaths: enabledPaths,
 		})
 
+	case "MarkerFiles":
+		markers, err := getStringList(cfg, "markers")
+		if err != nil {
+			return nil, err
+		}
+		if len(markers) == 0 {
+			err := errors.New("missing `markers`")
+			return nil, err
+		}
+		maxDepth, err := registryev.ParseMaxDepth(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ignorePatterns, err := getStringList(cfg, "ignore")
+		if err != nil {
+			return nil, err
+		}
+		return &rulesmarker.MarkerFilesFinder{
+			Markers:        markers,
+			MaxDepth:       maxDepth,
+			IgnorePatterns: ignorePatterns,
+		}, nil
+
+	case "OwnerBoundary":
+		var owner rulesowner.Owner
+		switch cfg["owner"] {
+		case "user":
+			owner = rulesowner.OwnerUser
+		case "group":
+			owner = rulesowner.OwnerGroup
+		default:
+			err := errors.New("invalid `owner`")
+			return nil, err
+		}
+		maxDepth, err := registryev.ParseMaxDepth(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ignorePatterns, err := getStringList(cfg, "ignore")
+		if err != nil {
+			return nil, err
+		}
+		return &rulesowner.OwnerBoundaryFinder{
+			Owner:          owner,
+			MaxDepth:       maxDepth,
+			IgnorePatterns: ignorePatterns,
+		}, nil
+
 	case "Stdtools2017":
 		ignorePatterns, err := getStringList(cfg, "ignore")
 		if err != nil {
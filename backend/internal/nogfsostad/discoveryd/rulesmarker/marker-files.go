@@ -0,0 +1,148 @@
+// Package `rulesmarker` implements the repo naming rule `MarkerFiles`, which
+// identifies repo candidates by the presence of marker files.
+package rulesmarker
+
+import (
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
+)
+
+// `DefaultMaxDepth` is used if the config does not specify `maxDepth`.
+const DefaultMaxDepth = 4
+
+// `MarkerFilesFinder` reports a directory as a repo candidate if it contains
+// one of the files `Markers`, like `.nogrepo` or `DATASET.md`.  It does not
+// enter candidates, known repos, hidden directories, directories that match
+// `IgnorePatterns`, or directories deeper than `MaxDepth` below the root.
+// The root itself is never a candidate.  Directories that cannot be read due
+// to missing permissions are reported as ignored, so that they do not abort
+// the walk.
+type MarkerFilesFinder struct {
+	Markers        []string
+	MaxDepth       int
+	IgnorePatterns []string
+}
+
+func (f *MarkerFilesFinder) Find(
+	root string, known map[string]bool, fns rules.FindHandlerFuncs,
+) error {
+	handleCandidate := func(p string) error {
+		if fns.CandidateFn != nil {
+			if err := fns.CandidateFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	handleIgnore := func(p string) error {
+		if fns.IgnoreFn != nil {
+			if err := fns.IgnoreFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	handleKnown := func(p string) error {
+		if fns.KnownFn != nil {
+			if err := fns.KnownFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	maxDepth := f.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	root = ensureTrailingSlash(root)
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		relpath := strings.TrimPrefix(path, root)
+		if err != nil {
+			if relpath != "" && os.IsPermission(err) {
+				// `nil` continues with the next entry.
+				if err := handleIgnore(relpath); err != nil &&
+					err != filepath.SkipDir {
+					return err
+				}
+				return nil
+			}
+			return err
+		}
+
+		// Always enter the root.  `SkipDir` would end the walk.
+		if relpath == "" {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if known[relpath] {
+			return handleKnown(relpath)
+		}
+
+		// Ignore hidden by Unix convention.
+		_, basename := filepath.Split(relpath)
+		if basename[0] == '.' {
+			return handleIgnore(relpath)
+		}
+		if f.ignorePath(relpath) {
+			return handleIgnore(relpath)
+		}
+
+		if f.hasMarker(path) {
+			return handleCandidate(relpath)
+		}
+
+		if reldirDepth(relpath) >= maxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	return filepath.Walk(root, walkFn)
+}
+
+func (f *MarkerFilesFinder) hasMarker(dir string) bool {
+	for _, m := range f.Markers {
+		st, err := os.Lstat(filepath.Join(dir, m))
+		if err == nil && !st.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *MarkerFilesFinder) ignorePath(path string) bool {
+	for _, pat := range f.IgnorePatterns {
+		matched, err := slashpath.Match(pat, path)
+		if err != nil {
+			continue // Silently ignore invalid patterns.
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func reldirDepth(relpath string) int {
+	return strings.Count(strings.TrimRight(relpath, "/"), "/") + 1
+}
+
+func ensureTrailingSlash(s string) string {
+	if s == "" {
+		return "/"
+	}
+	if s[len(s)-1] == '/' {
+		return s
+	}
+	return s + "/"
+}
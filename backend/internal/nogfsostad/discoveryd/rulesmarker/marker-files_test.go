@@ -0,0 +1,137 @@
+package rulesmarker_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rulesmarker"
+)
+
+type findResult struct {
+	candidates []string
+	ignored    []string
+	known      []string
+}
+
+func find(
+	t *testing.T, root string, known map[string]bool,
+) findResult {
+	t.Helper()
+
+	var res findResult
+	appendTo := func(lst *[]string) func(string) error {
+		return func(p string) error {
+			*lst = append(*lst, p)
+			return nil
+		}
+	}
+	f := &rulesmarker.MarkerFilesFinder{
+		Markers:        []string{".nogrepo"},
+		MaxDepth:       2,
+		IgnorePatterns: []string{"tmp*"},
+	}
+	if err := f.Find(root, known, rules.FindHandlerFuncs{
+		CandidateFn: appendTo(&res.candidates),
+		IgnoreFn:    appendTo(&res.ignored),
+		KnownFn:     appendTo(&res.known),
+	}); err != nil {
+		t.Fatalf("Find() failed: %v", err)
+	}
+	sort.Strings(res.candidates)
+	sort.Strings(res.ignored)
+	sort.Strings(res.known)
+	return res
+}
+
+func mkTree(t *testing.T, paths ...string) string {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "rulesmarker-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range paths {
+		p = filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func requireStrings(t *testing.T, what string, expected, got []string) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %s %q, got %q", what, expected, got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := mkTree(t,
+		"a/.nogrepo",
+		"a/sub/.nogrepo",
+		"b/c/.nogrepo",
+		"b/d/e/.nogrepo",
+		"k/.nogrepo",
+		".hidden/.nogrepo",
+		"tmp1/.nogrepo",
+		"x/file",
+	)
+	defer os.RemoveAll(root)
+
+	res := find(t, root, map[string]bool{"k": true})
+	// `b/d/e` is below `MaxDepth`.  `a/sub` is inside a candidate.
+	requireStrings(t, "candidates", []string{"a", "b/c"}, res.candidates)
+	requireStrings(t, "ignored", []string{".hidden", "tmp1"}, res.ignored)
+	requireStrings(t, "known", []string{"k"}, res.known)
+}
+
+// The root is never a candidate, and a marker in the root must not end the
+// walk.
+func TestFindRootWithMarker(t *testing.T) {
+	root := mkTree(t,
+		".nogrepo",
+		"a/.nogrepo",
+	)
+	defer os.RemoveAll(root)
+
+	res := find(t, root, nil)
+	requireStrings(t, "candidates", []string{"a"}, res.candidates)
+
+	// A known root must not end the walk either.
+	res = find(t, root, map[string]bool{".": true})
+	requireStrings(t, "candidates", []string{"a"}, res.candidates)
+	requireStrings(t, "known", nil, res.known)
+}
+
+// A directory that cannot be read is reported as ignored, and the walk
+// continues.
+func TestFindPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	root := mkTree(t,
+		"a/.nogrepo",
+		"locked/b/.nogrepo",
+		"z/.nogrepo",
+	)
+	defer os.RemoveAll(root)
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0777)
+
+	res := find(t, root, nil)
+	requireStrings(t, "candidates", []string{"a", "z"}, res.candidates)
+	requireStrings(t, "ignored", []string{"locked"}, res.ignored)
+}
@@ -0,0 +1,175 @@
+// Package `rulesowner` implements the repo naming rule `OwnerBoundary`, which
+// identifies repo candidates where the owning Unix user or group changes.
+package rulesowner
+
+import (
+	"errors"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/discoveryd/rules"
+)
+
+// `DefaultMaxDepth` is used if the config does not specify `maxDepth`.
+const DefaultMaxDepth = 4
+
+var ErrNoStat = errors.New("missing Unix stat info")
+
+type Owner int
+
+const (
+	OwnerUnspecified Owner = iota
+	OwnerUser
+	OwnerGroup
+)
+
+// `OwnerBoundaryFinder` reports a directory as a repo candidate if its owner,
+// the Unix user or group depending on `Owner`, differs from the owner of its
+// parent directory.  It does not enter candidates, known repos, hidden
+// directories, directories that match `IgnorePatterns`, or directories deeper
+// than `MaxDepth` below the root.  The root itself is never a candidate.
+// Directories that cannot be read due to missing permissions are reported as
+// ignored, so that they do not abort the walk.
+type OwnerBoundaryFinder struct {
+	Owner          Owner
+	MaxDepth       int
+	IgnorePatterns []string
+}
+
+func (f *OwnerBoundaryFinder) Find(
+	root string, known map[string]bool, fns rules.FindHandlerFuncs,
+) error {
+	handleCandidate := func(p string) error {
+		if fns.CandidateFn != nil {
+			if err := fns.CandidateFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	handleIgnore := func(p string) error {
+		if fns.IgnoreFn != nil {
+			if err := fns.IgnoreFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	handleKnown := func(p string) error {
+		if fns.KnownFn != nil {
+			if err := fns.KnownFn(p); err != nil {
+				return err
+			}
+		}
+		return filepath.SkipDir
+	}
+
+	maxDepth := f.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	// `owners` contains the owner of the visited directories.  Walk visits
+	// parents before children.  Key: relpath.
+	owners := make(map[string]uint32)
+
+	root = ensureTrailingSlash(root)
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		relpath := strings.TrimPrefix(path, root)
+		if err != nil {
+			if relpath != "" && os.IsPermission(err) {
+				// `nil` continues with the next entry.
+				if err := handleIgnore(relpath); err != nil &&
+					err != filepath.SkipDir {
+					return err
+				}
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		owner, err := f.owner(info)
+		if err != nil {
+			return err
+		}
+
+		if relpath == "" {
+			owners["."] = owner
+			return nil
+		}
+		if known[relpath] {
+			return handleKnown(relpath)
+		}
+
+		// Ignore hidden by Unix convention.
+		parent, basename := slashpath.Split(relpath)
+		if basename[0] == '.' {
+			return handleIgnore(relpath)
+		}
+		if f.ignorePath(relpath) {
+			return handleIgnore(relpath)
+		}
+
+		parent = strings.TrimRight(parent, "/")
+		if parent == "" {
+			parent = "."
+		}
+		if owner != owners[parent] {
+			return handleCandidate(relpath)
+		}
+
+		if reldirDepth(relpath) >= maxDepth {
+			return filepath.SkipDir
+		}
+		owners[relpath] = owner
+		return nil
+	}
+
+	return filepath.Walk(root, walkFn)
+}
+
+func (f *OwnerBoundaryFinder) owner(info os.FileInfo) (uint32, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, ErrNoStat
+	}
+	if f.Owner == OwnerUser {
+		return st.Uid, nil
+	}
+	return st.Gid, nil
+}
+
+func (f *OwnerBoundaryFinder) ignorePath(path string) bool {
+	for _, pat := range f.IgnorePatterns {
+		matched, err := slashpath.Match(pat, path)
+		if err != nil {
+			continue // Silently ignore invalid patterns.
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func reldirDepth(relpath string) int {
+	return strings.Count(strings.TrimRight(relpath, "/"), "/") + 1
+}
+
+func ensureTrailingSlash(s string) string {
+	if s == "" {
+		return "/"
+	}
+	if s[len(s)-1] == '/' {
+		return s
+	}
+	return s + "/"
+}
@@ -65,10 +65,13 @@ type registryView struct {
 }
 
 type namingConfig struct {
+	registry   string
 	globalRoot string
 	hostRoot   string
 	rule       string
 	ruleConfig map[string]interface{}
+	// `autoInit` is nil if auto init has never been configured.
+	autoInit *pb.FsoRepoAutoInitPolicy
 }
 
 func newRegistryView(
@@ -137,6 +140,42 @@ func (v *registryView) setRootNamingRule(
 	return nil
 }
 
+func (v *registryView) setRootAutoInitPolicy(
+	globalRoot string, policy *pb.FsoRepoAutoInitPolicy,
+) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	r, ok := v.roots[globalRoot]
+	if !ok {
+		return ErrForeignRoot
+	}
+
+	dup := *r
+	dup.autoInit = policy
+	v.roots[globalRoot] = &dup
+
+	return nil
+}
+
+// `autoInitRoots()` returns the roots for which auto init is enabled.
+func (v *registryView) autoInitRoots() []*namingConfig {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.initHasCompleted {
+		return nil
+	}
+
+	var roots []*namingConfig
+	for _, r := range v.roots {
+		if r.autoInit != nil && r.autoInit.Enabled {
+			roots = append(roots, r)
+		}
+	}
+	return roots
+}
+
 func (v *registryView) patchRootNamingConfig(
 	globalRoot string, configPatch map[string]interface{},
 ) (err error) {
@@ -365,7 +404,7 @@ func (v *registryView) initRegistry(
 			return tail, err
 		}
 		for _, ev := range rsp.Events {
-			if err := v.processEvent(OpInit, ev); err != nil {
+			if err := v.processEvent(OpInit, regName, ev); err != nil {
 				return tail, err
 			}
 			tail = ev.Id
@@ -419,7 +458,7 @@ func (v *registryView) watchRegistry(
 			return tail, err
 		}
 		for _, ev := range rsp.Events {
-			if err := v.processEvent(OpWatch, ev); err != nil {
+			if err := v.processEvent(OpWatch, registry, ev); err != nil {
 				return tail, err
 			}
 			tail = ev.Id
@@ -427,7 +466,9 @@ func (v *registryView) watchRegistry(
 	}
 }
 
-func (v *registryView) processEvent(op Op, ev *pb.RegistryEvent) error {
+func (v *registryView) processEvent(
+	op Op, registry string, ev *pb.RegistryEvent,
+) error {
 	switch ev.Event {
 	case pb.RegistryEvent_EV_FSO_ROOT_ADDED:
 		inf := ev.FsoRootInfo
@@ -450,6 +491,7 @@ func (v *registryView) processEvent(op Op, ev *pb.RegistryEvent) error {
 		}
 
 		v.addRoot(namingConfig{
+			registry:   registry,
 			globalRoot: globalRoot,
 			hostRoot:   inf.HostRoot,
 		})
@@ -520,6 +562,31 @@ func (v *registryView) processEvent(op Op, ev *pb.RegistryEvent) error {
 		v.processEventNamingConfigUpdated(ev)
 		return nil
 
+	case pb.RegistryEvent_EV_FSO_REPO_AUTO_INIT_POLICY_UPDATED:
+		policy := ev.FsoRepoAutoInitPolicy
+		globalRoot := ensureTrailingSlash(policy.GlobalRoot)
+		err := v.setRootAutoInitPolicy(globalRoot, policy)
+		switch {
+		case err == ErrForeignRoot:
+			v.lg.Infow(
+				"Ignored foreign root auto init policy.",
+				"root", globalRoot,
+				"module", "discoveryd",
+			)
+			return nil
+		case err != nil:
+			panic("unexpected error")
+		}
+		if op == OpWatch {
+			v.lg.Infow(
+				"Set auto init policy.",
+				"root", globalRoot,
+				"enabled", policy.Enabled,
+				"module", "discoveryd",
+			)
+		}
+		return nil
+
 	case pb.RegistryEvent_EV_FSO_REPO_ADDED:
 		repoId, err := uuid.FromBytes(ev.FsoRepoInfo.Id)
 		if err != nil {
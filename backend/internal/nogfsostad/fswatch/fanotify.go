@@ -0,0 +1,195 @@
+package fswatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// fanotify constants from `<linux/fanotify.h>`, which the `syscall` package
+// does not provide.
+const (
+	fanCloexec    = 0x00000001
+	fanNonblock   = 0x00000002
+	fanClassNotif = 0x00000000
+
+	fanMarkAdd   = 0x00000001
+	fanMarkMount = 0x00000010
+
+	fanCloseWrite = 0x00000008
+	fanQOverflow  = 0x00004000
+
+	fanotifyMetadataVersion = 3
+	fanNoFd                 = -1
+
+	atFdcwd = -0x64
+)
+
+// `fanotifyEventMetadata` is `struct fanotify_event_metadata`.
+type fanotifyEventMetadata struct {
+	EventLen    uint32
+	Vers        uint8
+	Reserved    uint8
+	MetadataLen uint16
+	Mask        uint64
+	Fd          int32
+	Pid         int32
+}
+
+var sizeofFanotifyEventMetadata = int(
+	unsafe.Sizeof(fanotifyEventMetadata{}),
+)
+
+// `fanotifyBackend` marks the mounts that contain the roots.  Events are
+// reported for the entire mount; the `Watcher` ignores paths outside of the
+// repos.  A mount is marked only once.
+type fanotifyBackend struct {
+	fd   int
+	file *os.File
+
+	closeOnce sync.Once
+	closeErr  error
+
+	mu     sync.Mutex
+	mounts map[uint64]bool // key: st_dev
+}
+
+func newFanotifyBackend() (*fanotifyBackend, error) {
+	r, _, errno := syscall.Syscall(
+		syscall.SYS_FANOTIFY_INIT,
+		fanClassNotif|fanCloexec|fanNonblock,
+		uintptr(syscall.O_RDONLY|syscall.O_LARGEFILE|syscall.O_CLOEXEC),
+		0,
+	)
+	if errno != 0 {
+		return nil, os.NewSyscallError("fanotify_init", errno)
+	}
+	fd := int(r)
+	return &fanotifyBackend{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "fanotify"),
+		mounts: make(map[uint64]bool),
+	}, nil
+}
+
+func (be *fanotifyBackend) method() Method {
+	return MethodFanotify
+}
+
+func (be *fanotifyBackend) addRoot(hostPath string) error {
+	hostPath = filepath.Clean(hostPath)
+	var st syscall.Stat_t
+	if err := syscall.Stat(hostPath, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: hostPath, Err: err}
+	}
+
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	if be.mounts[uint64(st.Dev)] {
+		return nil
+	}
+
+	dirFd := atFdcwd
+	path, err := syscall.BytePtrFromString(hostPath)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_FANOTIFY_MARK,
+		uintptr(be.fd),
+		fanMarkAdd|fanMarkMount,
+		fanCloseWrite,
+		uintptr(dirFd),
+		uintptr(unsafe.Pointer(path)),
+		0,
+	)
+	if errno != 0 {
+		return &os.PathError{
+			Op: "fanotify_mark", Path: hostPath, Err: errno,
+		}
+	}
+	be.mounts[uint64(st.Dev)] = true
+	return nil
+}
+
+// `removeRoot()` keeps the mount mark, since other repos may be on the same
+// mount.  The `Watcher` ignores events outside of the repos.
+func (be *fanotifyBackend) removeRoot(hostPath string) {}
+
+func (be *fanotifyBackend) run(
+	ctx context.Context, changes chan<- string,
+) error {
+	go func() {
+		<-ctx.Done()
+		_ = be.close()
+	}()
+
+	buf := make([]byte, 256*sizeofFanotifyEventMetadata)
+	for {
+		n, err := be.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for off := 0; off+sizeofFanotifyEventMetadata <= n; {
+			ev := *(*fanotifyEventMetadata)(
+				unsafe.Pointer(&buf[off]),
+			)
+			if ev.Vers != fanotifyMetadataVersion {
+				return fmt.Errorf(
+					"unsupported fanotify metadata version %d",
+					ev.Vers,
+				)
+			}
+			if ev.EventLen < uint32(sizeofFanotifyEventMetadata) {
+				return fmt.Errorf("malformed fanotify event")
+			}
+			off += int(ev.EventLen)
+
+			path, ok := fanotifyEventPath(ev)
+			if !ok {
+				continue
+			}
+			select {
+			case changes <- path:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// `fanotifyEventPath()` resolves the event fd to a path and closes it.
+func fanotifyEventPath(ev fanotifyEventMetadata) (string, bool) {
+	if ev.Mask&fanQOverflow != 0 {
+		return "", true
+	}
+	if ev.Fd == fanNoFd {
+		return "", false
+	}
+	defer syscall.Close(int(ev.Fd))
+	path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", ev.Fd))
+	if err != nil {
+		return "", false
+	}
+	// Deleted files cannot be attributed reliably.
+	if strings.HasSuffix(path, " (deleted)") {
+		return "", false
+	}
+	return path, true
+}
+
+func (be *fanotifyBackend) close() error {
+	be.closeOnce.Do(func() {
+		be.closeErr = be.file.Close()
+	})
+	return be.closeErr
+}
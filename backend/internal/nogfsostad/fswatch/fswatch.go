@@ -0,0 +1,390 @@
+// Package `fswatch` detects changes below repo host paths with inotify or
+// fanotify, so that Nogfsostad can run `git-fso stat` for repos that changed
+// without waiting for the next periodic stat scan.
+//
+// Changes are debounced per repo: the `ChangeFunc` is called after the repo
+// has been quiet for `Debounce`, or after `MaxDelay` if changes continue.  If
+// the kernel event queue overflows, all repos are considered changed.  Repos
+// that cannot be watched, for example because the inotify watch limit has been
+// reached, are logged and left to the periodic stat scans.
+package fswatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+type Method int
+
+const (
+	MethodUnspecified Method = iota
+	// `MethodAuto` tries fanotify and falls back to inotify.
+	MethodAuto
+	// `MethodFanotify` places marks on the mounts of the repos.  It
+	// requires `CAP_SYS_ADMIN`.  It reports files that have been written
+	// but not renames or deletes, which are left to the periodic stat
+	// scans.
+	MethodFanotify
+	// `MethodInotify` places a watch on every directory below the repos.
+	// It is limited by `fs.inotify.max_user_watches`.
+	MethodInotify
+)
+
+func ParseMethod(s string) (Method, error) {
+	switch s {
+	case "auto":
+		return MethodAuto, nil
+	case "fanotify":
+		return MethodFanotify, nil
+	case "inotify":
+		return MethodInotify, nil
+	default:
+		return MethodUnspecified, fmt.Errorf("unknown method `%s`", s)
+	}
+}
+
+func (m Method) String() string {
+	switch m {
+	case MethodAuto:
+		return "auto"
+	case MethodFanotify:
+		return "fanotify"
+	case MethodInotify:
+		return "inotify"
+	default:
+		return "unspecified"
+	}
+}
+
+const (
+	DefaultDebounce = 10 * time.Second
+	// `DefaultMaxDelayFactor` determines the default `MaxDelay` as a
+	// multiple of `Debounce`.
+	DefaultMaxDelayFactor = 30
+)
+
+var ErrClosed = errors.New("watcher closed")
+
+type Config struct {
+	Method   Method
+	Debounce time.Duration
+	MaxDelay time.Duration
+}
+
+// `ChangeFunc` is called for each repo that changed.  Calls are sequential.
+type ChangeFunc func(ctx context.Context, repoId uuid.I)
+
+// `backend` reports changed host paths on `changes`.  It reports the empty
+// string if events have been lost.
+type backend interface {
+	method() Method
+	addRoot(hostPath string) error
+	removeRoot(hostPath string)
+	run(ctx context.Context, changes chan<- string) error
+	close() error
+}
+
+type Watcher struct {
+	lg       Logger
+	be       backend
+	debounce time.Duration
+	maxDelay time.Duration
+
+	mu      sync.Mutex
+	repos   map[uuid.I]string // host path with trailing slash
+	pending map[uuid.I]*pendingChange
+	// `adds` are repos whose watches have not yet been added.  `Run()`
+	// adds them in the background, since adding inotify watches walks the
+	// entire tree.  `addsSignal` has capacity 1.
+	adds       []uuid.I
+	addsSignal chan struct{}
+}
+
+type pendingChange struct {
+	first time.Time
+	last  time.Time
+}
+
+func New(lg Logger, cfg *Config) (*Watcher, error) {
+	debounce := cfg.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	maxDelay := cfg.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelayFactor * debounce
+	}
+
+	var be backend
+	var err error
+	switch cfg.Method {
+	case MethodAuto:
+		be, err = newFanotifyBackend()
+		if err != nil {
+			lg.Infow(
+				"fanotify unavailable; trying inotify.",
+				"err", err,
+			)
+			be, err = newInotifyBackend()
+		}
+	case MethodFanotify:
+		be, err = newFanotifyBackend()
+	case MethodInotify:
+		be, err = newInotifyBackend()
+	default:
+		err = fmt.Errorf("invalid method %d", cfg.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		lg:       lg,
+		be:       be,
+		debounce: debounce,
+		maxDelay: maxDelay,
+		repos:    make(map[uuid.I]string),
+		pending:  make(map[uuid.I]*pendingChange),
+
+		addsSignal: make(chan struct{}, 1),
+	}, nil
+}
+
+func (w *Watcher) Method() Method {
+	return w.be.method()
+}
+
+// `WatchRepo()` schedules watching `hostPath`.  The watch is added in the
+// background by `Run()`.
+func (w *Watcher) WatchRepo(repoId uuid.I, hostPath string) {
+	hostPath = ensureTrailingSlash(hostPath)
+
+	w.mu.Lock()
+	old, ok := w.repos[repoId]
+	if ok && old == hostPath {
+		w.mu.Unlock()
+		return
+	}
+	w.repos[repoId] = hostPath
+	w.adds = append(w.adds, repoId)
+	w.mu.Unlock()
+
+	if ok {
+		w.be.removeRoot(old)
+	}
+	select {
+	case w.addsSignal <- struct{}{}:
+	default:
+	}
+}
+
+// `addWatches()` adds the scheduled watches.  Errors are logged, since the
+// periodic stat scans still cover the repos.
+func (w *Watcher) addWatches(ctx context.Context) {
+	for ctx.Err() == nil {
+		w.mu.Lock()
+		if len(w.adds) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		repoId := w.adds[0]
+		w.adds = w.adds[1:]
+		hostPath, ok := w.repos[repoId]
+		w.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		if err := w.be.addRoot(hostPath); err != nil {
+			w.lg.Warnw(
+				"Failed to watch repo; "+
+					"relying on periodic stat scans.",
+				"module", "fswatch",
+				"repoId", repoId.String(),
+				"hostPath", hostPath,
+				"err", err,
+			)
+			continue
+		}
+
+		// Undo if the repo has been unwatched or moved meanwhile.
+		w.mu.Lock()
+		current := w.repos[repoId]
+		w.mu.Unlock()
+		if current != hostPath {
+			w.be.removeRoot(hostPath)
+		}
+	}
+}
+
+func (w *Watcher) UnwatchRepo(repoId uuid.I) {
+	w.mu.Lock()
+	hostPath, ok := w.repos[repoId]
+	delete(w.repos, repoId)
+	delete(w.pending, repoId)
+	w.mu.Unlock()
+	if ok {
+		w.be.removeRoot(hostPath)
+	}
+}
+
+// `Run()` processes events until `ctx` is cancelled.  It closes the watcher
+// before it returns.
+func (w *Watcher) Run(ctx context.Context, fn ChangeFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan string, 1024)
+	beDone := make(chan error, 1)
+	go func() {
+		beDone <- w.be.run(ctx, changes)
+	}()
+
+	ready := make(chan uuid.I, 1024)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			w.addWatches(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.addsSignal:
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case id := <-ready:
+				fn(ctx, id)
+			}
+		}
+	}()
+
+	tick := time.NewTicker(w.debounce / 4)
+	defer tick.Stop()
+
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		case err = <-beDone:
+			if err == nil {
+				err = ErrClosed
+			}
+			break loop
+		case path := <-changes:
+			w.addChange(path, time.Now())
+		case now := <-tick.C:
+			for _, id := range w.takeReady(now) {
+				select {
+				case ready <- id:
+				default:
+					// The queue is full.  Retry later.
+					w.markRepo(id, now)
+				}
+			}
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	if cerr := w.be.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// `addChange()` marks the repo that contains `path` as changed.  The empty
+// path marks all repos.
+func (w *Watcher) addChange(path string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if path == "" {
+		for id := range w.repos {
+			w.markRepoLocked(id, now)
+		}
+		return
+	}
+
+	if id, ok := w.resolveLocked(path); ok {
+		w.markRepoLocked(id, now)
+	}
+}
+
+func (w *Watcher) markRepo(repoId uuid.I, now time.Time) {
+	w.mu.Lock()
+	w.markRepoLocked(repoId, now)
+	w.mu.Unlock()
+}
+
+func (w *Watcher) markRepoLocked(repoId uuid.I, now time.Time) {
+	if _, ok := w.repos[repoId]; !ok {
+		return
+	}
+	if p, ok := w.pending[repoId]; ok {
+		p.last = now
+	} else {
+		w.pending[repoId] = &pendingChange{first: now, last: now}
+	}
+}
+
+// `resolveLocked()` returns the repo whose host path is the longest prefix of
+// `path`.
+func (w *Watcher) resolveLocked(path string) (uuid.I, bool) {
+	path = ensureTrailingSlash(path)
+	var repoId uuid.I
+	l := 0
+	for id, hostPath := range w.repos {
+		if len(hostPath) <= l || !strings.HasPrefix(path, hostPath) {
+			continue
+		}
+		repoId = id
+		l = len(hostPath)
+	}
+	return repoId, l > 0
+}
+
+func (w *Watcher) takeReady(now time.Time) []uuid.I {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ids []uuid.I
+	for id, p := range w.pending {
+		if now.Sub(p.last) >= w.debounce ||
+			now.Sub(p.first) >= w.maxDelay {
+			ids = append(ids, id)
+			delete(w.pending, id)
+		}
+	}
+	return ids
+}
+
+func ensureTrailingSlash(s string) string {
+	if strings.HasSuffix(s, "/") {
+		return s
+	}
+	return s + "/"
+}
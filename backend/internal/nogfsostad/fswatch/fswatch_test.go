@@ -0,0 +1,112 @@
+package fswatch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/fswatch"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (lg testLogger) Infow(msg string, kv ...interface{}) {
+	lg.t.Log(append([]interface{}{msg}, kv...)...)
+}
+
+func (lg testLogger) Warnw(msg string, kv ...interface{}) {
+	lg.t.Log(append([]interface{}{msg}, kv...)...)
+}
+
+func (lg testLogger) Errorw(msg string, kv ...interface{}) {
+	lg.t.Log(append([]interface{}{msg}, kv...)...)
+}
+
+func TestInotifyDebouncedChanges(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fswatch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	repoA := uuid.Must(uuid.NewRandom())
+	repoB := uuid.Must(uuid.NewRandom())
+	dirA := filepath.Join(tmp, "a")
+	dirB := filepath.Join(tmp, "b")
+	for _, d := range []string{dirA, dirB} {
+		if err := os.Mkdir(d, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := fswatch.New(testLogger{t}, &fswatch.Config{
+		Method:   fswatch.MethodInotify,
+		Debounce: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Skipf("inotify unavailable: %v", err)
+	}
+	w.WatchRepo(repoA, dirA)
+	w.WatchRepo(repoB, dirB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan uuid.I, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx, func(ctx context.Context, id uuid.I) {
+			changed <- id
+		})
+	}()
+
+	// Wait until the watches have been added in the background.
+	time.Sleep(100 * time.Millisecond)
+
+	// Several changes in a new subdir are reported once.
+	sub := filepath.Join(dirA, "sub")
+	if err := os.Mkdir(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(sub, "file")
+		if err := ioutil.WriteFile(path, []byte{byte(i)}, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case id := <-changed:
+		if id != repoA {
+			t.Fatalf("expected repo A; got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case id := <-changed:
+		t.Fatalf("unexpected change of %s", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Unwatched repos are not reported.
+	w.UnwatchRepo(repoA)
+	path := filepath.Join(dirA, "other")
+	if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-changed:
+		t.Fatalf("unexpected change of %s", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled; got %v", err)
+	}
+}
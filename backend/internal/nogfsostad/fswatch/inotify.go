@@ -0,0 +1,199 @@
+package fswatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE |
+	syscall.IN_DELETE |
+	syscall.IN_MODIFY |
+	syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF |
+	syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR |
+	syscall.IN_DONT_FOLLOW
+
+// `inotifyBackend` watches every directory below the roots.  New directories
+// are added when they are created or moved into a watched directory.
+type inotifyBackend struct {
+	fd   int
+	file *os.File
+
+	closeOnce sync.Once
+	closeErr  error
+
+	mu    sync.Mutex
+	paths map[int32]string // wd -> dir path
+	wds   map[string]int32 // dir path -> wd
+}
+
+func newInotifyBackend() (*inotifyBackend, error) {
+	fd, err := syscall.InotifyInit1(
+		syscall.IN_CLOEXEC | syscall.IN_NONBLOCK,
+	)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &inotifyBackend{
+		fd: fd,
+		// The fd is non-blocking, so that `Read()` uses the Go poller
+		// and `Close()` interrupts it.
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		paths: make(map[int32]string),
+		wds:   make(map[string]int32),
+	}, nil
+}
+
+func (be *inotifyBackend) method() Method {
+	return MethodInotify
+}
+
+func (be *inotifyBackend) addRoot(hostPath string) error {
+	hostPath = filepath.Clean(hostPath)
+	if err := be.addTree(hostPath); err != nil {
+		be.removeRoot(hostPath)
+		return err
+	}
+	return nil
+}
+
+func (be *inotifyBackend) addTree(dir string) error {
+	return filepath.Walk(dir, func(
+		path string, info os.FileInfo, err error,
+	) error {
+		if err != nil {
+			// Ignore entries that disappeared during the walk.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return be.addDir(path)
+	})
+}
+
+func (be *inotifyBackend) addDir(dir string) error {
+	wd, err := syscall.InotifyAddWatch(be.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	be.mu.Lock()
+	be.paths[int32(wd)] = dir
+	be.wds[dir] = int32(wd)
+	be.mu.Unlock()
+	return nil
+}
+
+func (be *inotifyBackend) removeRoot(hostPath string) {
+	root := filepath.Clean(hostPath)
+	prefix := root + "/"
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	for dir, wd := range be.wds {
+		if dir != root && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		// Ignore errors.  The kernel may have already removed the
+		// watch, for example because the dir has been deleted.
+		_, _ = syscall.InotifyRmWatch(be.fd, uint32(wd))
+		delete(be.wds, dir)
+		delete(be.paths, wd)
+	}
+}
+
+func (be *inotifyBackend) run(
+	ctx context.Context, changes chan<- string,
+) error {
+	go func() {
+		<-ctx.Done()
+		_ = be.close()
+	}()
+
+	var buf [64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)]byte
+	for {
+		n, err := be.file.Read(buf[:])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+
+				syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+			name := strings.TrimRight(string(nameBytes), "\x00")
+
+			path, ok := be.handleEvent(ev, name)
+			if !ok {
+				continue
+			}
+			select {
+			case changes <- path:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// `handleEvent()` maintains the watches and returns the changed path.
+func (be *inotifyBackend) handleEvent(
+	ev *syscall.InotifyEvent, name string,
+) (string, bool) {
+	if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		return "", true
+	}
+
+	be.mu.Lock()
+	dir, ok := be.paths[ev.Wd]
+	if ok && ev.Mask&syscall.IN_IGNORED != 0 {
+		delete(be.paths, ev.Wd)
+		if be.wds[dir] == ev.Wd {
+			delete(be.wds, dir)
+		}
+	}
+	be.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	if ev.Mask&syscall.IN_IGNORED != 0 {
+		return "", false
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+
+	isNewDir := ev.Mask&syscall.IN_ISDIR != 0 &&
+		ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0
+	if isNewDir {
+		// Errors are not fatal.  The change is reported anyway, so
+		// that the next stat picks up the new dir.
+		_ = be.addTree(path)
+	}
+
+	return path, true
+}
+
+func (be *inotifyBackend) close() error {
+	be.closeOnce.Do(func() {
+		be.closeErr = be.file.Close()
+	})
+	return be.closeErr
+}
@@ -0,0 +1,46 @@
+package nogfsostad
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+// `beginJob()` waits until the scheduler permits an I/O-heavy operation on a
+// repo.  Callers must `p.sched.Release()` the returned id when done.  Call
+// `beginJob()` before taking repo locks, so that queued jobs do not block
+// other jobs on the same repo.
+func (p *Processor) beginJob(
+	ctx context.Context,
+	class jobsched.Class,
+	operation string,
+	repoId uuid.I,
+) (uint64, error) {
+	p.mu.Lock()
+	inf := p.repos[repoId]
+	p.mu.Unlock()
+
+	return p.sched.Acquire(ctx, jobsched.Spec{
+		Class:      class,
+		Operation:  operation,
+		Repo:       repoId,
+		GlobalPath: inf.globalPath,
+		Filesystem: filesystemId(inf.hostPath),
+	})
+}
+
+// `filesystemId()` identifies the filesystem by its device number, so that
+// repos on the same filesystem share the per-filesystem job limit.
+func filesystemId(path string) string {
+	if path == "" {
+		return "unknown"
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("dev-%d", st.Dev)
+}
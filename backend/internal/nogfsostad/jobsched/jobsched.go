@@ -0,0 +1,291 @@
+// Package `jobsched` schedules I/O-heavy work in Nogfsostad, like stat, sha,
+// git gc, and archive, to control how many jobs run concurrently.
+//
+// Jobs are assigned to a priority class.  Each class has a concurrency limit.
+// A separate limit applies to all jobs on the same filesystem.  When a slot
+// becomes available, classes are considered in priority order, so that
+// interactive jobs are preferred over workflow jobs, which are preferred over
+// background jobs.  Within a class, jobs of repos that currently run fewer
+// jobs and that have least recently started a job are preferred, so that a
+// single repo with many requests cannot starve the others.
+package jobsched
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+type Class int
+
+const (
+	ClassUnspecified Class = iota
+	ClassInteractive
+	ClassWorkflow
+	ClassBackground
+)
+
+// `classes` is the priority order.
+var classes = []Class{
+	ClassInteractive,
+	ClassWorkflow,
+	ClassBackground,
+}
+
+func (c Class) String() string {
+	switch c {
+	case ClassInteractive:
+		return "interactive"
+	case ClassWorkflow:
+		return "workflow"
+	case ClassBackground:
+		return "background"
+	default:
+		return "unspecified"
+	}
+}
+
+type State int
+
+const (
+	StateUnspecified State = iota
+	StateWaiting
+	StateRunning
+)
+
+func (s State) String() string {
+	switch s {
+	case StateWaiting:
+		return "waiting"
+	case StateRunning:
+		return "running"
+	default:
+		return "unspecified"
+	}
+}
+
+type Config struct {
+	// `ClassLimits` limits the number of concurrent jobs per class.  The
+	// limit of classes that are not in the map is 1.
+	ClassLimits map[Class]int
+	// `FilesystemLimit` limits the number of concurrent jobs per
+	// filesystem.  0 disables the limit.
+	FilesystemLimit int
+}
+
+// `Spec` describes a job.  `Filesystem` is an opaque id; jobs with the same
+// `Filesystem` share the per-filesystem limit.
+type Spec struct {
+	Class      Class
+	Operation  string
+	Repo       uuid.I
+	GlobalPath string
+	Filesystem string
+}
+
+type Job struct {
+	Spec
+	Id      uint64
+	State   State
+	Queued  time.Time
+	Started time.Time
+}
+
+type Scheduler struct {
+	classLimits map[Class]int
+	fsLimit     int
+
+	mu        sync.Mutex
+	seq       uint64
+	waiting   []*entry
+	running   map[uint64]*entry
+	nClass    map[Class]int
+	nFs       map[string]int
+	nRepo     map[uuid.I]int
+	nStarted  uint64
+	lastStart map[uuid.I]uint64
+}
+
+type entry struct {
+	job   Job
+	ready chan struct{}
+}
+
+func New(cfg *Config) *Scheduler {
+	limits := make(map[Class]int)
+	for _, c := range classes {
+		limits[c] = 1
+		if n, ok := cfg.ClassLimits[c]; ok && n > 0 {
+			limits[c] = n
+		}
+	}
+	return &Scheduler{
+		classLimits: limits,
+		fsLimit:     cfg.FilesystemLimit,
+		running:     make(map[uint64]*entry),
+		nClass:      make(map[Class]int),
+		nFs:         make(map[string]int),
+		nRepo:       make(map[uuid.I]int),
+		lastStart:   make(map[uuid.I]uint64),
+	}
+}
+
+type startedFuncKey struct{}
+
+// `WithStartedFunc()` returns a context that tells `Acquire()` to call `fn`
+// when the job has been granted a slot, so that callers can distinguish
+// queued from running jobs without changing the signatures of the functions
+// that call `Acquire()`.
+func WithStartedFunc(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, startedFuncKey{}, fn)
+}
+
+// `Acquire()` blocks until the job may run.  It returns a job id that must be
+// passed to `Release()` when the job has completed.  If `ctx` has been
+// created with `WithStartedFunc()`, the function is called before `Acquire()`
+// returns successfully.
+func (s *Scheduler) Acquire(ctx context.Context, spec Spec) (uint64, error) {
+	if _, ok := s.classLimits[spec.Class]; !ok {
+		spec.Class = ClassBackground
+	}
+
+	s.mu.Lock()
+	s.seq++
+	e := &entry{
+		job: Job{
+			Spec:   spec,
+			Id:     s.seq,
+			State:  StateWaiting,
+			Queued: time.Now(),
+		},
+		ready: make(chan struct{}),
+	}
+	s.waiting = append(s.waiting, e)
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		if fn, ok := ctx.Value(startedFuncKey{}).(func()); ok {
+			fn()
+		}
+		return e.job.Id, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		// The job may have been started concurrently.
+		if e.job.State == StateRunning {
+			s.releaseLocked(e)
+		} else {
+			s.removeWaitingLocked(e)
+		}
+		s.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+func (s *Scheduler) Release(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.running[id]
+	if !ok {
+		panic("release of unknown job")
+	}
+	s.releaseLocked(e)
+}
+
+// `List()` returns a snapshot of the running and waiting jobs.  Running jobs
+// are listed first.  Jobs are ordered by id within each group.
+func (s *Scheduler) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.running)+len(s.waiting))
+	for _, e := range s.running {
+		jobs = append(jobs, e.job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Id < jobs[j].Id
+	})
+	for _, e := range s.waiting {
+		jobs = append(jobs, e.job)
+	}
+	return jobs
+}
+
+func (s *Scheduler) releaseLocked(e *entry) {
+	delete(s.running, e.job.Id)
+	s.nClass[e.job.Class]--
+	s.nFs[e.job.Filesystem]--
+	if s.nFs[e.job.Filesystem] == 0 {
+		delete(s.nFs, e.job.Filesystem)
+	}
+	s.nRepo[e.job.Repo]--
+	if s.nRepo[e.job.Repo] == 0 {
+		delete(s.nRepo, e.job.Repo)
+	}
+	s.dispatchLocked()
+}
+
+func (s *Scheduler) removeWaitingLocked(e *entry) {
+	for i, w := range s.waiting {
+		if w == e {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Scheduler) dispatchLocked() {
+	for _, c := range classes {
+		for s.nClass[c] < s.classLimits[c] {
+			e := s.pickLocked(c)
+			if e == nil {
+				break
+			}
+			s.startLocked(e)
+		}
+	}
+}
+
+// `pickLocked()` selects the next waiting job of class `c` whose filesystem
+// has a free slot.  `s.waiting` is in FIFO order, so that the strict
+// comparison keeps older jobs if repos are otherwise equal.
+func (s *Scheduler) pickLocked(c Class) *entry {
+	var best *entry
+	for _, e := range s.waiting {
+		if e.job.Class != c {
+			continue
+		}
+		if s.fsLimit > 0 && s.nFs[e.job.Filesystem] >= s.fsLimit {
+			continue
+		}
+		if best == nil || s.isFairerLocked(e, best) {
+			best = e
+		}
+	}
+	return best
+}
+
+func (s *Scheduler) isFairerLocked(a, b *entry) bool {
+	na, nb := s.nRepo[a.job.Repo], s.nRepo[b.job.Repo]
+	if na != nb {
+		return na < nb
+	}
+	return s.lastStart[a.job.Repo] < s.lastStart[b.job.Repo]
+}
+
+func (s *Scheduler) startLocked(e *entry) {
+	s.removeWaitingLocked(e)
+	e.job.State = StateRunning
+	e.job.Started = time.Now()
+	s.running[e.job.Id] = e
+	s.nClass[e.job.Class]++
+	s.nFs[e.job.Filesystem]++
+	s.nRepo[e.job.Repo]++
+	s.nStarted++
+	s.lastStart[e.job.Repo] = s.nStarted
+	close(e.ready)
+}
@@ -0,0 +1,186 @@
+package jobsched_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+var repoA = uuid.Must(uuid.NewRandom())
+var repoB = uuid.Must(uuid.NewRandom())
+
+func spec(c jobsched.Class, repo uuid.I, fs string) jobsched.Spec {
+	return jobsched.Spec{
+		Class:      c,
+		Operation:  "test",
+		Repo:       repo,
+		Filesystem: fs,
+	}
+}
+
+// `acquireAsync()` starts `Acquire()` and waits until the job is queued, so
+// that jobs are queued in a deterministic order.
+func acquireAsync(
+	s *jobsched.Scheduler, sp jobsched.Spec,
+) <-chan uint64 {
+	n := len(s.List())
+	ch := make(chan uint64, 1)
+	go func() {
+		id, err := s.Acquire(context.Background(), sp)
+		if err != nil {
+			panic(err)
+		}
+		ch <- id
+	}()
+	for len(s.List()) == n {
+		time.Sleep(time.Millisecond)
+	}
+	return ch
+}
+
+func recv(t *testing.T, ch <-chan uint64) uint64 {
+	select {
+	case id := <-ch:
+		return id
+	case <-time.After(time.Second):
+		t.Fatal("job did not start")
+		return 0
+	}
+}
+
+func TestPriority(t *testing.T) {
+	s := jobsched.New(&jobsched.Config{
+		FilesystemLimit: 1,
+	})
+	ctx := context.Background()
+
+	id, err := s.Acquire(ctx, spec(jobsched.ClassBackground, repoA, "fs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bg := acquireAsync(s, spec(jobsched.ClassBackground, repoA, "fs"))
+	ia := acquireAsync(s, spec(jobsched.ClassInteractive, repoA, "fs"))
+
+	s.Release(id)
+	id = recv(t, ia)
+	select {
+	case <-bg:
+		t.Fatal("background job started before interactive job")
+	default:
+	}
+	s.Release(id)
+	s.Release(recv(t, bg))
+}
+
+func TestFairness(t *testing.T) {
+	s := jobsched.New(&jobsched.Config{})
+	ctx := context.Background()
+
+	id, err := s.Acquire(ctx, spec(jobsched.ClassInteractive, repoA, "fs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := acquireAsync(s, spec(jobsched.ClassInteractive, repoA, "fs"))
+	b := acquireAsync(s, spec(jobsched.ClassInteractive, repoB, "fs"))
+
+	s.Release(id)
+	id = recv(t, b)
+	select {
+	case <-a:
+		t.Fatal("repo A started again before repo B")
+	default:
+	}
+	s.Release(id)
+	s.Release(recv(t, a))
+}
+
+func TestCancel(t *testing.T) {
+	s := jobsched.New(&jobsched.Config{})
+
+	id, err := s.Acquire(
+		context.Background(),
+		spec(jobsched.ClassWorkflow, repoA, "fs"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond,
+	)
+	defer cancel()
+	_, err = s.Acquire(ctx, spec(jobsched.ClassWorkflow, repoB, "fs"))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if n := len(s.List()); n != 1 {
+		t.Fatalf("expected 1 job, got %d", n)
+	}
+	s.Release(id)
+}
+
+// The started func is called when the job gets a slot, not when it is queued.
+func TestStartedFunc(t *testing.T) {
+	s := jobsched.New(&jobsched.Config{})
+
+	id, err := s.Acquire(
+		context.Background(),
+		spec(jobsched.ClassInteractive, repoA, "fs"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	ctx := jobsched.WithStartedFunc(context.Background(), func() {
+		close(started)
+	})
+	ch := make(chan uint64, 1)
+	go func() {
+		id, err := s.Acquire(
+			ctx, spec(jobsched.ClassInteractive, repoB, "fs"),
+		)
+		if err != nil {
+			panic(err)
+		}
+		ch <- id
+	}()
+	for len(s.List()) == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-started:
+		t.Fatal("started func called for queued job")
+	default:
+	}
+
+	s.Release(id)
+	id = recv(t, ch)
+	select {
+	case <-started:
+	default:
+		t.Fatal("started func not called before Acquire() returned")
+	}
+	s.Release(id)
+
+	// A cancelled job is never started.
+	called := false
+	cctx, cancel := context.WithCancel(
+		jobsched.WithStartedFunc(context.Background(), func() {
+			called = true
+		}),
+	)
+	id, _ = s.Acquire(
+		context.Background(),
+		spec(jobsched.ClassInteractive, repoA, "fs"),
+	)
+	cancel()
+	_, err = s.Acquire(cctx, spec(jobsched.ClassInteractive, repoB, "fs"))
+	if err != context.Canceled || called {
+		t.Errorf("expected canceled without start, got %v", err)
+	}
+	s.Release(id)
+}
@@ -0,0 +1,23 @@
+package jobsd
+
+import (
+	"context"
+
+	"github.com/nogproject/nog/backend/internal/fsoauthz"
+	"github.com/nogproject/nog/backend/pkg/auth"
+)
+
+const AAFsoReadRoot = fsoauthz.AAFsoReadRoot
+
+func (srv *Server) authGlobalPath(
+	ctx context.Context, action auth.Action, globalPath string,
+) error {
+	euid, err := srv.authn.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return srv.authz.Authorize(euid, action, map[string]interface{}{
+		"path": globalPath,
+	})
+}
@@ -0,0 +1,110 @@
+// Package `jobsd` implements the gRPC service `StadJobs`, which reports the
+// state of the `jobsched` scheduler.
+package jobsd
+
+import (
+	"context"
+	slashpath "path"
+	"strings"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	authn auth.Authenticator
+	authz auth.Authorizer
+	sched Scheduler
+}
+
+type Scheduler interface {
+	List() []jobsched.Job
+}
+
+func New(
+	authn auth.Authenticator,
+	authz auth.Authorizer,
+	sched Scheduler,
+) *Server {
+	return &Server{
+		authn: authn,
+		authz: authz,
+		sched: sched,
+	}
+}
+
+func (srv *Server) ListJobs(
+	ctx context.Context, i *pb.ListJobsI,
+) (*pb.ListJobsO, error) {
+	if !slashpath.IsAbs(i.GlobalPath) {
+		err := status.Error(
+			codes.InvalidArgument, "global path must be absolute",
+		)
+		return nil, err
+	}
+	prefix := slashpath.Clean(i.GlobalPath)
+	if err := srv.authGlobalPath(ctx, AAFsoReadRoot, prefix); err != nil {
+		return nil, err
+	}
+
+	o := &pb.ListJobsO{}
+	for _, j := range srv.sched.List() {
+		if !isBelowPrefix(j.GlobalPath, prefix) {
+			continue
+		}
+		o.Jobs = append(o.Jobs, pbJob(j))
+	}
+	return o, nil
+}
+
+func isBelowPrefix(path, prefix string) bool {
+	if prefix == "/" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
+
+func pbJob(j jobsched.Job) *pb.StadJob {
+	repo := j.Repo
+	pj := &pb.StadJob{
+		Id:         j.Id,
+		Class:      pbClass(j.Class),
+		State:      pbState(j.State),
+		Operation:  j.Operation,
+		Repo:       repo[:],
+		GlobalPath: j.GlobalPath,
+		Filesystem: j.Filesystem,
+		Queued:     j.Queued.Unix(),
+	}
+	if !j.Started.IsZero() {
+		pj.Started = j.Started.Unix()
+	}
+	return pj
+}
+
+func pbClass(c jobsched.Class) pb.StadJob_Class {
+	switch c {
+	case jobsched.ClassInteractive:
+		return pb.StadJob_C_INTERACTIVE
+	case jobsched.ClassWorkflow:
+		return pb.StadJob_C_WORKFLOW
+	case jobsched.ClassBackground:
+		return pb.StadJob_C_BACKGROUND
+	default:
+		return pb.StadJob_C_UNSPECIFIED
+	}
+}
+
+func pbState(s jobsched.State) pb.StadJob_State {
+	switch s {
+	case jobsched.StateWaiting:
+		return pb.StadJob_S_WAITING
+	case jobsched.StateRunning:
+		return pb.StadJob_S_RUNNING
+	default:
+		return pb.StadJob_S_UNSPECIFIED
+	}
+}
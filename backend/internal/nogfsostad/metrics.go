@@ -0,0 +1,34 @@
+package nogfsostad
+
+import (
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+var (
+	repoOpSeconds = metrics.NewHistogramVec(
+		"nogfsostad_repo_op_seconds",
+		"Duration of repo operations, like stat and sha, "+
+			"excluding the wait for a job slot.",
+		metrics.LongBuckets,
+		"op", "result",
+	)
+	sessionUpGauge = metrics.NewGaugeVec(
+		"nogfsostad_statds_session_up",
+		"Whether the callback session to Nogfsoregd is active.",
+	)
+	sessionRetriesTotal = metrics.NewCounterVec(
+		"nogfsostad_statds_session_retries_total",
+		"Number of times the callback session to Nogfsoregd "+
+			"has been restarted.",
+	)
+)
+
+func observeRepoOp(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	repoOpSeconds.With(op, result).ObserveSince(start)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/daemons"
 	pb "github.com/nogproject/nog/backend/internal/udopb"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"github.com/nogproject/nog/backend/pkg/netx"
 	"google.golang.org/grpc"
 )
@@ -65,6 +66,8 @@ func dial(
 		grpc.WithBlock(),
 		grpc.FailOnNonTempDialError(true),
 		grpc.WithDisableRetry(),
+		grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(grpctrace.StreamClientInterceptor),
 		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
 			select {
 			case <-first:
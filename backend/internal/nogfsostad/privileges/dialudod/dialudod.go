@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/daemons"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"github.com/nogproject/nog/backend/pkg/grpc/ucred"
 	"github.com/nogproject/nog/backend/pkg/pwd"
 	"google.golang.org/grpc"
@@ -69,6 +70,8 @@ func dial(
 		sockPath,
 		grpc.WithDialer(unixDialer),
 		grpc.WithTransportCredentials(creds),
+		grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(grpctrace.StreamClientInterceptor),
 	)
 	if err != nil {
 		return nil, err
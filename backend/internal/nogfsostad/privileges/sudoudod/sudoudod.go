@@ -12,6 +12,7 @@ import (
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/daemons"
 	pb "github.com/nogproject/nog/backend/internal/udopb"
 	"github.com/nogproject/nog/backend/pkg/execx"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpctrace"
 	"github.com/nogproject/nog/backend/pkg/netx"
 	"google.golang.org/grpc"
 )
@@ -123,6 +124,8 @@ func sudoStart(
 		grpc.WithBlock(),
 		grpc.FailOnNonTempDialError(true),
 		grpc.WithDisableRetry(),
+		grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(grpctrace.StreamClientInterceptor),
 		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
 			select {
 			case <-first:
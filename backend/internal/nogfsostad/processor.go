@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/privileges/privileges"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/shadows"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/statd"
@@ -49,12 +51,56 @@ type Processor struct {
 
 	gitNogWritePolicy GitNogWritePolicy
 	initLimits        *InitLimits
+	sched             *jobsched.Scheduler
+	watcher           RepoWatcher
 
 	mu         sync.Mutex
 	repos      map[uuid.I]repoInfo
 	waitEnable map[uuid.I]chan struct{}
 
-	repoLocks lockmap.L
+	repoLocks repoLockMap
+}
+
+// `RepoLocker` coordinates repo locks with other Nogfsostads that serve the
+// same prefixes.  See `SessionRepoLocker`.
+type RepoLocker interface {
+	LockRepo(ctx context.Context, key string) error
+	UnlockRepo(key string)
+}
+
+// `repoLockMap` takes the local lock first and then the coordinated lock, so
+// that each Nogfsostad requests a key at most once at a time.
+type repoLockMap struct {
+	local  lockmap.L
+	remote RepoLocker
+}
+
+func (l *repoLockMap) Lock(ctx context.Context, key string) error {
+	if err := l.local.Lock(ctx, key); err != nil {
+		return err
+	}
+	if l.remote == nil {
+		return nil
+	}
+	if err := l.remote.LockRepo(ctx, key); err != nil {
+		l.local.Unlock(key)
+		return err
+	}
+	return nil
+}
+
+func (l *repoLockMap) Unlock(key string) {
+	if l.remote != nil {
+		l.remote.UnlockRepo(key)
+	}
+	l.local.Unlock(key)
+}
+
+// `RepoWatcher` is notified when repos are enabled and disabled, so that it
+// can watch the repo host paths for changes.  See package `fswatch`.
+type RepoWatcher interface {
+	WatchRepo(repoId uuid.I, hostPath string)
+	UnwatchRepo(repoId uuid.I)
 }
 
 type Privileges interface {
@@ -76,10 +122,13 @@ type repoInfo struct {
 func NewProcessor(
 	lg Logger,
 	initLimits *InitLimits,
+	sched *jobsched.Scheduler,
 	shadow *shadows.Filesystem,
 	broadcaster *Broadcaster,
 	privs Privileges,
 	useUdo UseUdo,
+	watcher RepoWatcher,
+	locker RepoLocker,
 ) *Processor {
 	return &Processor{
 		lg:          lg,
@@ -92,9 +141,13 @@ func NewProcessor(
 		// NOE-13.
 		gitNogWritePolicy: GitNogWriteAlways,
 		initLimits:        initLimits,
+		sched:             sched,
+		watcher:           watcher,
 
 		repos:      make(map[uuid.I]repoInfo),
 		waitEnable: make(map[uuid.I]chan struct{}),
+
+		repoLocks: repoLockMap{remote: locker},
 	}
 }
 
@@ -134,6 +187,10 @@ func (p *Processor) EnableRepo4(
 	}
 	p.mu.Unlock()
 
+	if p.watcher != nil {
+		p.watcher.WatchRepo(inf.Id, inf.HostPath)
+	}
+
 	p.lg.Infow(
 		"Enabled repo",
 		"repoId", inf.Id.String(),
@@ -206,6 +263,9 @@ func (p *Processor) DisableRepo4(
 	if !ok {
 		return nil
 	}
+	if p.watcher != nil {
+		p.watcher.UnwatchRepo(repoId)
+	}
 	p.lg.Infow(
 		"Disabled repo",
 		"repoId", repoId.String(),
@@ -282,6 +342,16 @@ func (p *Processor) StatRepo(
 	author statd.User,
 	opts shadows.StatOptions,
 ) error {
+	return p.statRepo(ctx, jobsched.ClassInteractive, repoId, author, opts)
+}
+
+func (p *Processor) statRepo(
+	ctx context.Context,
+	class jobsched.Class,
+	repoId uuid.I,
+	author statd.User,
+	opts shadows.StatOptions,
+) (err error) {
 	p.mu.Lock()
 	inf, ok := p.repos[repoId]
 	p.mu.Unlock()
@@ -290,6 +360,12 @@ func (p *Processor) StatRepo(
 		return err
 	}
 
+	job, err := p.beginJob(ctx, class, "stat", repoId)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
+
 	key := string(repoId[:])
 	if err := p.repoLocks.Lock(ctx, key); err != nil {
 		return err
@@ -297,6 +373,10 @@ func (p *Processor) StatRepo(
 	defer p.repoLocks.Unlock(key)
 
 	p.lg.Infow("Begin stat.", "shadow", inf.shadowPath)
+	start := time.Now()
+	defer func() {
+		observeRepoOp("stat", start, err)
+	}()
 
 	const ref = "refs/heads/master-stat"
 	oldHead, err := p.shadow.Ref(inf.shadowPath, ref)
@@ -349,7 +429,9 @@ func (p *Processor) StatMtimeRangeOnlyAllRepos(
 		MtimeRangeOnly: true,
 	}
 	for _, id := range p.getAllRepoIds() {
-		err2 := p.StatRepo(ctx, id, author, statOpts)
+		err2 := p.statRepo(
+			ctx, jobsched.ClassBackground, id, author, statOpts,
+		)
 		if err2 != nil {
 			if err == nil {
 				err = err2
@@ -372,9 +454,25 @@ func (p *Processor) StatMtimeRangeOnlyAllRepos(
 	return err
 }
 
-func (p *Processor) ShaRepo(
-	ctx context.Context, repoId uuid.I, author statd.User,
+// `StatChangedRepo()` runs a background stat for a repo whose host path has
+// changed, as reported by the `RepoWatcher`.
+func (p *Processor) StatChangedRepo(
+	ctx context.Context,
+	repoId uuid.I,
+	author statd.User,
 ) error {
+	return p.statRepo(
+		ctx, jobsched.ClassBackground, repoId, author,
+		shadows.StatOptions{},
+	)
+}
+
+func (p *Processor) ShaRepo(
+	ctx context.Context,
+	repoId uuid.I,
+	author statd.User,
+	opts shadows.ShaOptions,
+) (err error) {
 	p.mu.Lock()
 	inf, ok := p.repos[repoId]
 	p.mu.Unlock()
@@ -383,6 +481,12 @@ func (p *Processor) ShaRepo(
 		return err
 	}
 
+	job, err := p.beginJob(ctx, jobsched.ClassInteractive, "sha", repoId)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
+
 	// Take only the sha lock during the potentially slow SHA computation.
 	key := string(repoId[:])
 	keySha := key + ".sha"
@@ -392,6 +496,10 @@ func (p *Processor) ShaRepo(
 	defer p.repoLocks.Unlock(keySha)
 
 	p.lg.Infow("Begin sha.", "shadow", inf.shadowPath)
+	start := time.Now()
+	defer func() {
+		observeRepoOp("sha", start, err)
+	}()
 
 	const ref = "refs/heads/master-sha"
 	oldHead, err := p.shadow.Ref(inf.shadowPath, ref)
@@ -400,7 +508,7 @@ func (p *Processor) ShaRepo(
 	}
 
 	// XXX Should have ctx.
-	err = p.shadow.Sha(inf.shadowPath, shadows.User(author))
+	err = p.shadow.Sha(inf.shadowPath, shadows.User(author), opts)
 	if err != nil {
 		return asStrongError(err)
 	}
@@ -442,7 +550,10 @@ func (p *Processor) ShaRepo(
 }
 
 func (p *Processor) RefreshContent(
-	ctx context.Context, repoId uuid.I, author statd.User,
+	ctx context.Context,
+	repoId uuid.I,
+	author statd.User,
+	opts shadows.RefreshContentOptions,
 ) error {
 	p.mu.Lock()
 	inf, ok := p.repos[repoId]
@@ -452,6 +563,14 @@ func (p *Processor) RefreshContent(
 		return err
 	}
 
+	job, err := p.beginJob(
+		ctx, jobsched.ClassInteractive, "refresh-content", repoId,
+	)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
+
 	key := string(repoId[:])
 	if err := p.repoLocks.Lock(ctx, key); err != nil {
 		return err
@@ -465,7 +584,9 @@ func (p *Processor) RefreshContent(
 	_ = err // oldHead may be null.
 
 	// XXX Should have ctx.
-	err = p.shadow.RefreshContent(inf.shadowPath, shadows.User(author))
+	err = p.shadow.RefreshContent(
+		inf.shadowPath, shadows.User(author), opts,
+	)
 	if err != nil {
 		return asStrongError(err)
 	}
@@ -510,8 +631,9 @@ func (p *Processor) FreezeRepo(
 	}
 
 	statOpts := shadows.StatOptions{}
-	if err := p.StatRepo(
-		ctx, repoId, statd.User(author), statOpts,
+	if err := p.statRepo(
+		ctx, jobsched.ClassWorkflow,
+		repoId, statd.User(author), statOpts,
 	); err != nil {
 		return err
 	}
@@ -556,8 +678,9 @@ func (p *Processor) UnfreezeRepo(
 	}
 
 	statOpts := shadows.StatOptions{}
-	if err := p.StatRepo(
-		ctx, repoId, statd.User(author), statOpts,
+	if err := p.statRepo(
+		ctx, jobsched.ClassWorkflow,
+		repoId, statd.User(author), statOpts,
 	); err != nil {
 		return err
 	}
@@ -951,6 +1074,12 @@ func (p *Processor) ArchiveRepo(
 		return ErrNoSudo
 	}
 
+	job, err := p.beginJob(ctx, jobsched.ClassWorkflow, "archive", repoId)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
+
 	key := string(repoId[:])
 	if err := p.repoLocks.Lock(ctx, key); err != nil {
 		return err
@@ -1054,6 +1183,12 @@ func (p *Processor) UnarchiveRepo(
 		return ErrNoSudo
 	}
 
+	job, err := p.beginJob(ctx, jobsched.ClassWorkflow, "unarchive", repoId)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
+
 	key := string(repoId[:])
 	if err := p.repoLocks.Lock(ctx, key); err != nil {
 		return err
@@ -1191,6 +1326,12 @@ func (p *Processor) gitGc(ctx context.Context, repoId uuid.I) error {
 	if err != nil {
 		return err
 	}
+
+	job, err := p.beginJob(ctx, jobsched.ClassBackground, "git-gc", repoId)
+	if err != nil {
+		return err
+	}
+	defer p.sched.Release(job)
 	return p.shadow.GitGc(ctx, shadowPath)
 }
 
@@ -0,0 +1,201 @@
+package nogfsostad
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// `SessionRepoLocker` coordinates repo locks with other Nogfsostads that
+// serve the same prefixes via `nogfsoregd`.  It implements `RepoLocker` for
+// the `Processor`.  `Session` tells it the current session, so that locks are
+// requested via the session.
+//
+// Nogfsoregd stores the locks as leases with a random owner id that the
+// locker keeps for its lifetime.  The leases are renewed while the session is
+// alive.  When the session changes, the locker locks the keys that it holds
+// again in the new session, so that the leases are renewed in the new
+// session.  Locking blocks while there is no active session.  If the locker
+// has no session for longer than the lease duration, which is
+// `statdsd.RepoLockLeaseDuration`, another Nogfsostad may take over the repos
+// while this Nogfsostad is still processing.
+type SessionRepoLocker struct {
+	lg    Logger
+	owner []byte
+
+	mu sync.Mutex
+	// `current` is `nil` while there is no session.  `changed` is closed
+	// and replaced when `current` changes.
+	current *lockSession
+	changed chan struct{}
+	// `held` contains the keys that this locker holds.
+	held map[string]struct{}
+}
+
+type lockSession struct {
+	client pb.StatdsClient
+	slot   uint64
+	token  []byte
+	creds  grpc.CallOption
+}
+
+// `lockRetryInterval` is the wait before retrying a lock request that failed,
+// for example because nogfsoregd has not yet activated the session.
+var lockRetryInterval = 1 * time.Second
+
+// `relockTimeout` limits locking held keys again in a new session.
+var relockTimeout = 30 * time.Second
+
+func NewSessionRepoLocker(lg Logger) (*SessionRepoLocker, error) {
+	owner, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	return &SessionRepoLocker{
+		lg:      lg,
+		owner:   owner,
+		changed: make(chan struct{}),
+		held:    make(map[string]struct{}),
+	}, nil
+}
+
+func (l *SessionRepoLocker) setSession(s *lockSession) {
+	l.mu.Lock()
+	l.current = s
+	close(l.changed)
+	l.changed = make(chan struct{})
+	keys := make([]string, 0, len(l.held))
+	for key := range l.held {
+		keys = append(keys, key)
+	}
+	l.mu.Unlock()
+
+	if s != nil && len(keys) > 0 {
+		go l.relock(s, keys)
+	}
+}
+
+// `relock()` locks held keys again in a new session.  A key that is unlocked
+// while `relock()` runs is unlocked again, because the unlock may have
+// happened before the lock.
+func (l *SessionRepoLocker) relock(s *lockSession, keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), relockTimeout)
+	defer cancel()
+	for _, key := range keys {
+		err := l.lockRPC(ctx, s, key)
+		if err != nil {
+			l.lg.Errorw(
+				"Failed to renew repo lock in new session.",
+				"module", "nogfsostad",
+				"err", err,
+			)
+			continue
+		}
+		if !l.isHeld(key) {
+			l.unlockRPC(s, key)
+		}
+	}
+}
+
+func (l *SessionRepoLocker) isHeld(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.held[key]
+	return ok
+}
+
+func (l *SessionRepoLocker) get() (*lockSession, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current, l.changed
+}
+
+func (l *SessionRepoLocker) LockRepo(ctx context.Context, key string) error {
+	for {
+		s, changed := l.get()
+		if s == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		err := l.lockRPC(ctx, s, key)
+		switch status.Code(err) {
+		case codes.OK:
+			l.mu.Lock()
+			l.held[key] = struct{}{}
+			l.mu.Unlock()
+			return nil
+		case codes.NotFound, codes.Unavailable:
+			// Session not yet active or lost.  Retry.
+		default:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func (l *SessionRepoLocker) lockRPC(
+	ctx context.Context, s *lockSession, key string,
+) error {
+	_, err := s.client.LockRepo(ctx, &pb.StatdsLockRepoI{
+		Slot:         s.slot,
+		SessionToken: s.token,
+		Key:          []byte(key),
+		Owner:        l.owner,
+	}, s.creds)
+	return err
+}
+
+// `UnlockRepo()` only logs errors.  If the lock cannot be released, it expires
+// in Nogfsoregd after the lease duration.
+func (l *SessionRepoLocker) UnlockRepo(key string) {
+	l.mu.Lock()
+	delete(l.held, key)
+	s := l.current
+	l.mu.Unlock()
+	if s == nil {
+		l.lg.Warnw(
+			"No session to unlock repo in nogfsoregd; "+
+				"the lock will expire.",
+			"module", "nogfsostad",
+		)
+		return
+	}
+	l.unlockRPC(s, key)
+}
+
+func (l *SessionRepoLocker) unlockRPC(s *lockSession, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.client.UnlockRepo(ctx, &pb.StatdsUnlockRepoI{
+		Slot:         s.slot,
+		SessionToken: s.token,
+		Key:          []byte(key),
+		Owner:        l.owner,
+	}, s.creds)
+	if err != nil {
+		l.lg.Warnw(
+			"Failed to unlock repo in nogfsoregd.",
+			"module", "nogfsostad",
+			"err", err,
+		)
+	}
+}
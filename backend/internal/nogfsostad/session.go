@@ -11,6 +11,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nogproject/nog/backend/internal/fsoauthz"
@@ -19,6 +20,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 )
 
@@ -32,9 +34,23 @@ type SessionConfig struct {
 	Authenticator        auth.Authenticator
 	Authorizer           auth.Authorizer
 	SysRPCCreds          credentials.PerRPCCredentials
+	// `ServerOptions` are used for the callback gRPC server in addition to
+	// the transport credentials, for example to add interceptors.
+	ServerOptions []grpc.ServerOption
+	// `HealthServer`, if set, is registered with the callback gRPC server.
+	HealthServer healthpb.HealthServer
+	// `Role` tells nogfsoregd whether the session is active or standby for
+	// its prefixes.
+	Role pb.StatdsRole
+	// `RepoLocker`, if set, is told the current session, so that it can
+	// coordinate repo locks via nogfsoregd.
+	RepoLocker *SessionRepoLocker
 }
 
 type Session struct {
+	// Atomic.  1 while the callback server is running.
+	up int32
+
 	lg          Logger
 	prefixes    []string
 	hosts       map[string]bool
@@ -47,6 +63,8 @@ type Session struct {
 
 	testUdoD pb.TestUdoServer
 
+	jobsd pb.StadJobsServer
+
 	// IsInitRepoAllowed() limits.
 	initLimits *InitLimits
 
@@ -55,6 +73,11 @@ type Session struct {
 	authn       auth.Authenticator
 	authz       auth.Authorizer
 	sysRPCCreds grpc.CallOption
+
+	serverOptions []grpc.ServerOption
+	healthServer  healthpb.HealthServer
+	role          pb.StatdsRole
+	repoLocker    *SessionRepoLocker
 }
 
 func NewSession(
@@ -65,6 +88,7 @@ func NewSession(
 	discoveryd pb.DiscoveryServer,
 	tarttd pb.TarttServer,
 	testUdoD pb.TestUdoServer,
+	jobsd pb.StadJobsServer,
 	cfg *SessionConfig,
 ) *Session {
 	var prefixes []string
@@ -92,6 +116,8 @@ func NewSession(
 
 		testUdoD: testUdoD,
 
+		jobsd: jobsd,
+
 		initLimits: cfg.InitLimits,
 
 		tlsName:     cfg.SessionName,
@@ -99,7 +125,21 @@ func NewSession(
 		authn:       cfg.Authenticator,
 		authz:       cfg.Authorizer,
 		sysRPCCreds: grpc.PerRPCCredentials(cfg.SysRPCCreds),
+
+		serverOptions: cfg.ServerOptions,
+		healthServer:  cfg.HealthServer,
+		role:          cfg.Role,
+		repoLocker:    cfg.RepoLocker,
+	}
+}
+
+// `CheckSession()` is a health check that fails while there is no active
+// `statdsd` session.
+func (se *Session) CheckSession(ctx context.Context) error {
+	if atomic.LoadInt32(&se.up) == 0 {
+		return errors.New("no active statds session")
 	}
+	return nil
 }
 
 func (se *Session) Process(
@@ -120,6 +160,7 @@ func (se *Session) Process(
 				Name:         se.tlsName,
 				SessionToken: token,
 				Prefixes:     se.prefixes,
+				Role:         se.role,
 			},
 			se.sysRPCCreds,
 		)
@@ -135,7 +176,9 @@ func (se *Session) Process(
 		//
 		// `keepalive.PermitWithoutStream` might do the trick, maybe
 		// together with an initial ping.
-		gsrv := grpc.NewServer(grpc.Creds(se.tls))
+		srvOpts := []grpc.ServerOption{grpc.Creds(se.tls)}
+		srvOpts = append(srvOpts, se.serverOptions...)
+		gsrv := grpc.NewServer(srvOpts...)
 		cbd := &callbackServer{
 			se:        se,
 			ourToken:  token,
@@ -153,6 +196,10 @@ func (se *Session) Process(
 		if se.testUdoD != nil {
 			pb.RegisterTestUdoServer(gsrv, se.testUdoD)
 		}
+		pb.RegisterStadJobsServer(gsrv, se.jobsd)
+		if se.healthServer != nil {
+			healthpb.RegisterHealthServer(gsrv, se.healthServer)
+		}
 		lis, err := callbackListen(ctx, o.CallbackAddr, o.CallbackSlot)
 		if err != nil {
 			return err
@@ -169,6 +216,21 @@ func (se *Session) Process(
 			"callbackAddr", o.CallbackAddr,
 			"slot", o.CallbackSlot,
 		)
+		sessionUpGauge.With().Set(1)
+		atomic.StoreInt32(&se.up, 1)
+		defer func() {
+			atomic.StoreInt32(&se.up, 0)
+			sessionUpGauge.With().Set(0)
+		}()
+		if se.repoLocker != nil {
+			se.repoLocker.setSession(&lockSession{
+				client: c,
+				slot:   o.CallbackSlot,
+				token:  token,
+				creds:  se.sysRPCCreds,
+			})
+			defer se.repoLocker.setSession(nil)
+		}
 
 		for {
 			timeout := time.NewTimer(20 * time.Second)
@@ -197,6 +259,7 @@ func (se *Session) Process(
 				return
 			}
 
+			sessionRetriesTotal.With().Inc()
 			wait := 20 * time.Second
 			se.lg.Errorw(
 				"Will retry session2.",
@@ -91,7 +91,7 @@ func (fs *Filesystem) ListMetaTree(
 				fallthrough
 			default:
 				err = fmt.Errorf(
-					"unexpected git object type `%s`",
+					"unexpected git object type `%v`",
 					ent.Type,
 				)
 				setWalkErr(fullPath, err)
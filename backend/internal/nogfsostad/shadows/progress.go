@@ -0,0 +1,105 @@
+package shadows
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// `Progress` describes how far a `git-fso` command has proceeded.  `Files` and
+// `Bytes` are totals since the command started.  `Path` is the most recently
+// processed path relative to the realdir.
+type Progress struct {
+	Files int64
+	Bytes int64
+	Path  string
+}
+
+// `ProgressFunc` is called whenever `git-fso` reports progress.  It must not
+// block.
+type ProgressFunc func(Progress)
+
+// `runGitFsoProgress()` runs `cmd` like `cmd.CombinedOutput()`.  If `fn` is
+// not nil, it enables `git-fso` progress reporting and calls `fn` for each
+// progress line that `git-fso` writes to stderr.  Progress lines are not
+// included in the returned output.
+func runGitFsoProgress(cmd *exec.Cmd, fn ProgressFunc) ([]byte, error) {
+	if fn == nil {
+		return cmd.CombinedOutput()
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "GIT_FSO_PROGRESS=1")
+	var mu sync.Mutex
+	var out bytes.Buffer
+	cmd.Stdout = &lockedWriter{mu: &mu, w: &out}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	scan := bufio.NewScanner(stderr)
+	for scan.Scan() {
+		line := scan.Text()
+		if p, ok := parseProgressLine(line); ok {
+			fn(p)
+			continue
+		}
+		mu.Lock()
+		out.WriteString(line)
+		out.WriteByte('\n')
+		mu.Unlock()
+	}
+	// Ignore scan errors.  `Wait()` reports the relevant error.
+
+	err = cmd.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return out.Bytes(), err
+}
+
+// `parseProgressLine()` parses `progress: <files> <bytes> <path>`.
+func parseProgressLine(line string) (Progress, bool) {
+	const prefix = "progress: "
+	if !strings.HasPrefix(line, prefix) {
+		return Progress{}, false
+	}
+	fields := strings.SplitN(line[len(prefix):], " ", 3)
+	if len(fields) != 3 {
+		return Progress{}, false
+	}
+	files, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Progress{}, false
+	}
+	nBytes, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Progress{}, false
+	}
+	return Progress{
+		Files: files,
+		Bytes: nBytes,
+		Path:  fields[2],
+	}, true
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
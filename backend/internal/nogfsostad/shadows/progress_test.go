@@ -0,0 +1,84 @@
+package shadows
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		p    Progress
+		ok   bool
+	}{
+		{
+			line: "progress: 64 1073 a/b c.txt",
+			p: Progress{
+				Files: 64, Bytes: 1073, Path: "a/b c.txt",
+			},
+			ok: true,
+		},
+		{line: "progress: 1 2", ok: false},
+		{line: "progress: x 2 a", ok: false},
+		{line: "progress: 1 y a", ok: false},
+		{line: "fatal: progress: 1 2 a", ok: false},
+	} {
+		p, ok := parseProgressLine(c.line)
+		if ok != c.ok {
+			t.Errorf("%q: expected ok %v, got %v", c.line, c.ok, ok)
+			continue
+		}
+		if p != c.p {
+			t.Errorf("%q: expected %+v, got %+v", c.line, c.p, p)
+		}
+	}
+}
+
+func TestRunGitFsoProgress(t *testing.T) {
+	script := strings.Join([]string{
+		`test "${GIT_FSO_PROGRESS}" = 1 || exit 1`,
+		`echo out`,
+		`echo >&2 'progress: 1 10 a'`,
+		`echo >&2 'warning: foo'`,
+		`echo >&2 'progress: 2 30 b'`,
+	}, "\n")
+
+	var ps []Progress
+	out, err := runGitFsoProgress(
+		exec.Command("sh", "-c", script),
+		func(p Progress) { ps = append(ps, p) },
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v; output: %s", err, out)
+	}
+	expected := []Progress{
+		{Files: 1, Bytes: 10, Path: "a"},
+		{Files: 2, Bytes: 30, Path: "b"},
+	}
+	if !reflect.DeepEqual(ps, expected) {
+		t.Errorf("expected progress %+v, got %+v", expected, ps)
+	}
+	for _, s := range []string{"out\n", "warning: foo\n"} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected output %q to contain %q", out, s)
+		}
+	}
+	if strings.Contains(string(out), "progress:") {
+		t.Errorf("unexpected progress lines in output %q", out)
+	}
+}
+
+func TestRunGitFsoProgressNil(t *testing.T) {
+	out, err := runGitFsoProgress(
+		exec.Command("sh", "-c", `echo "x${GIT_FSO_PROGRESS:-}"`),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != "x\n" {
+		t.Errorf("expected progress to be disabled, got output %q", out)
+	}
+}
@@ -283,6 +283,8 @@ func (fs *Filesystem) Ref(shadowPath, ref string) (Oid, error) {
 
 type StatOptions struct {
 	MtimeRangeOnly bool
+	// `Progress`, if not nil, receives progress reports.
+	Progress ProgressFunc
 }
 
 func (fs *Filesystem) Stat(
@@ -302,7 +304,7 @@ func (fs *Filesystem) Stat(
 	cmd := exec.CommandContext(ctx, fs.tools.gitFso.Path, args...)
 	cmd.Dir = shadowPath
 	cmd.Env = fs.gitEnvAuthor(author)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := runGitFsoProgress(cmd, opts.Progress); err != nil {
 		err := fmt.Errorf(
 			"git-fso stat failed: %s; output: %s", err, out,
 		)
@@ -318,7 +320,14 @@ func (fs *Filesystem) Stat(
 	return nil
 }
 
-func (fs *Filesystem) Sha(shadowPath string, author User) error {
+type ShaOptions struct {
+	// `Progress`, if not nil, receives progress reports.
+	Progress ProgressFunc
+}
+
+func (fs *Filesystem) Sha(
+	shadowPath string, author User, opts ShaOptions,
+) error {
 	if err := fs.checkShadowPath(shadowPath); err != nil {
 		return err
 	}
@@ -332,7 +341,7 @@ func (fs *Filesystem) Sha(shadowPath string, author User) error {
 	)
 	cmd.Dir = shadowPath
 	cmd.Env = fs.gitEnvAuthor(author)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := runGitFsoProgress(cmd, opts.Progress); err != nil {
 		err := fmt.Errorf(
 			"git-fso sha failed: %s; output: %s", err, out,
 		)
@@ -348,7 +357,14 @@ func (fs *Filesystem) Sha(shadowPath string, author User) error {
 	return nil
 }
 
-func (fs *Filesystem) RefreshContent(shadowPath string, author User) error {
+type RefreshContentOptions struct {
+	// `Progress`, if not nil, receives progress reports.
+	Progress ProgressFunc
+}
+
+func (fs *Filesystem) RefreshContent(
+	shadowPath string, author User, opts RefreshContentOptions,
+) error {
 	if err := fs.checkShadowPath(shadowPath); err != nil {
 		return err
 	}
@@ -362,7 +378,7 @@ func (fs *Filesystem) RefreshContent(shadowPath string, author User) error {
 	)
 	cmd.Dir = shadowPath
 	cmd.Env = fs.gitEnvAuthor(author)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := runGitFsoProgress(cmd, opts.Progress); err != nil {
 		err := fmt.Errorf(
 			"git-fso content failed: %s; output: %s", err, out,
 		)
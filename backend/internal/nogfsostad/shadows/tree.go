@@ -173,7 +173,7 @@ func (fs *Filesystem) ListStatTree(
 		default:
 			// `git.FilemodeTree` has been handled above switch.
 			err = fmt.Errorf(
-				"unhandled git object type `%s`", ent.Type,
+				"unhandled git object type `%v`", ent.Type,
 			)
 			setWalkErr(fullPath, err)
 			return WalkStop
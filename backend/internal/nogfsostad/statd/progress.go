@@ -0,0 +1,196 @@
+package statd
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/shadows"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Completed jobs are kept for a while, so that clients that start watching
+// late still see the final state.
+const jobRetention = 10 * time.Minute
+
+// `WatchProgress()` sends at most one update per interval, except for the
+// final state.
+const watchProgressInterval = 1 * time.Second
+
+// `jobs` tracks the progress of background operations, so that clients can
+// watch them with `WatchProgress()`.  Jobs are identified by ULIDs, so that
+// ids are not reused after a restart.
+type jobs struct {
+	mu   sync.Mutex
+	jobs map[ulid.I]*job
+}
+
+type job struct {
+	repo      uuid.I
+	operation pb.WatchProgressO_Operation
+	state     pb.WatchProgressO_State
+	files     int64
+	bytes     int64
+	path      string
+	errMsg    string
+	doneAt    time.Time
+	// `changed` is closed and replaced on each update.
+	changed chan struct{}
+}
+
+func newJobs() *jobs {
+	return &jobs{
+		jobs: make(map[ulid.I]*job),
+	}
+}
+
+func (js *jobs) add(repo uuid.I, op pb.WatchProgressO_Operation) ulid.I {
+	id, err := ulid.New()
+	if err != nil {
+		panic(err) // ulid.New() should never fail.
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.expireLocked(time.Now())
+	js.jobs[id] = &job{
+		repo:      repo,
+		operation: op,
+		state:     pb.WatchProgressO_S_QUEUED,
+		changed:   make(chan struct{}),
+	}
+	return id
+}
+
+func (js *jobs) remove(id ulid.I) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if j, ok := js.jobs[id]; ok {
+		close(j.changed)
+		delete(js.jobs, id)
+	}
+}
+
+func (js *jobs) expireLocked(now time.Time) {
+	for id, j := range js.jobs {
+		if !j.doneAt.IsZero() && now.Sub(j.doneAt) > jobRetention {
+			delete(js.jobs, id)
+		}
+	}
+}
+
+func (js *jobs) update(id ulid.I, fn func(j *job)) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok {
+		return
+	}
+	fn(j)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (js *jobs) running(id ulid.I) {
+	js.update(id, func(j *job) {
+		j.state = pb.WatchProgressO_S_RUNNING
+	})
+}
+
+func (js *jobs) progress(id ulid.I, p shadows.Progress) {
+	js.update(id, func(j *job) {
+		j.files = p.Files
+		j.bytes = p.Bytes
+		j.path = p.Path
+	})
+}
+
+func (js *jobs) done(id ulid.I, err error) {
+	js.update(id, func(j *job) {
+		if err != nil {
+			j.state = pb.WatchProgressO_S_FAILED
+			j.errMsg = truncateErrorMessage(err.Error())
+		} else {
+			j.state = pb.WatchProgressO_S_SUCCEEDED
+		}
+		j.doneAt = time.Now()
+	})
+}
+
+// `get()` returns a snapshot of the job and a channel that is closed when the
+// job changes.
+func (js *jobs) get(
+	repo uuid.I, id ulid.I,
+) (*pb.WatchProgressO, <-chan struct{}, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	j, ok := js.jobs[id]
+	if !ok || j.repo != repo {
+		return nil, nil, false
+	}
+	return &pb.WatchProgressO{
+		Job:          id[:],
+		Operation:    j.operation,
+		State:        j.state,
+		Files:        j.files,
+		Bytes:        j.bytes,
+		Path:         j.path,
+		ErrorMessage: j.errMsg,
+	}, j.changed, true
+}
+
+func isFinalJobState(s pb.WatchProgressO_State) bool {
+	switch s {
+	case pb.WatchProgressO_S_SUCCEEDED:
+		return true
+	case pb.WatchProgressO_S_FAILED:
+		return true
+	default:
+		return false
+	}
+}
+
+func (srv *Server) WatchProgress(
+	i *pb.WatchProgressI, ostream pb.Stat_WatchProgressServer,
+) error {
+	ctx := ostream.Context()
+
+	repoId, err := srv.authRepoId(ctx, AAFsoRefreshRepo, i.Repo)
+	if err != nil {
+		return err
+	}
+
+	jobId, err := ulid.ParseBytes(i.Job)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "malformed job")
+	}
+
+	for {
+		o, changed, ok := srv.jobs.get(repoId, jobId)
+		if !ok {
+			return status.Error(codes.NotFound, "unknown job")
+		}
+		if err := ostream.Send(o); err != nil {
+			return err
+		}
+		if isFinalJobState(o.State) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+
+		// Throttle, so that fast progress does not flood the client.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(watchProgressInterval):
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package statd
+
+import (
+	"errors"
+	"testing"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/shadows"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+func TestJobsLifecycle(t *testing.T) {
+	js := newJobs()
+	repo := uuid.Must(uuid.NewRandom())
+	other := uuid.Must(uuid.NewRandom())
+
+	id := js.add(repo, pb.WatchProgressO_OP_STAT)
+	id2 := js.add(repo, pb.WatchProgressO_OP_SHA)
+	if id == id2 {
+		t.Fatal("expected distinct job ids")
+	}
+
+	o, changed, ok := js.get(repo, id)
+	if !ok {
+		t.Fatal("missing job")
+	}
+	if o.State != pb.WatchProgressO_S_QUEUED {
+		t.Errorf("expected queued, got %v", o.State)
+	}
+	if _, _, ok := js.get(other, id); ok {
+		t.Error("expected job to be hidden from other repo")
+	}
+
+	js.running(id)
+	js.progress(id, shadows.Progress{Files: 3, Bytes: 42, Path: "a"})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected change notification")
+	}
+
+	o, _, _ = js.get(repo, id)
+	if o.State != pb.WatchProgressO_S_RUNNING ||
+		o.Files != 3 || o.Bytes != 42 || o.Path != "a" {
+		t.Errorf("unexpected job %+v", o)
+	}
+	if string(o.Job) != string(id[:]) {
+		t.Errorf("expected job id %s, got %x", id, o.Job)
+	}
+
+	js.done(id, nil)
+	o, _, _ = js.get(repo, id)
+	if !isFinalJobState(o.State) ||
+		o.State != pb.WatchProgressO_S_SUCCEEDED {
+		t.Errorf("expected succeeded, got %v", o.State)
+	}
+
+	js.done(id2, errors.New("boom"))
+	o, _, _ = js.get(repo, id2)
+	if o.State != pb.WatchProgressO_S_FAILED || o.ErrorMessage != "boom" {
+		t.Errorf("expected failed with message, got %+v", o)
+	}
+
+	js.remove(id2)
+	if _, _, ok := js.get(repo, id2); ok {
+		t.Error("expected removed job to be unknown")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/internal/nogfsostad/jobsched"
 	"github.com/nogproject/nog/backend/internal/nogfsostad/shadows"
 	"github.com/nogproject/nog/backend/pkg/auth"
 	"github.com/nogproject/nog/backend/pkg/rate"
@@ -48,6 +49,7 @@ type Server struct {
 	nConcurrentSha int
 
 	limiter *rate.Limiter
+	jobs    *jobs
 }
 
 type Logger interface {
@@ -73,8 +75,18 @@ type Processor interface {
 		author User,
 		opts shadows.StatOptions,
 	) error
-	ShaRepo(ctx context.Context, repo uuid.I, author User) error
-	RefreshContent(ctx context.Context, repo uuid.I, author User) error
+	ShaRepo(
+		ctx context.Context,
+		repo uuid.I,
+		author User,
+		opts shadows.ShaOptions,
+	) error
+	RefreshContent(
+		ctx context.Context,
+		repo uuid.I,
+		author User,
+		opts shadows.RefreshContentOptions,
+	) error
 	ReinitSubdirTracking(
 		ctx context.Context,
 		repo uuid.I,
@@ -111,6 +123,7 @@ func New(
 			Burst:   10,
 			Tau:     5 * time.Second,
 		}),
+		jobs: newJobs(),
 	}
 }
 
@@ -226,6 +239,10 @@ func (srv *Server) Stat(
 	if req.Flags&uint32(pb.StatI_F_MTIME_RANGE_ONLY) != 0 {
 		statOpts.MtimeRangeOnly = true
 	}
+	job := srv.jobs.add(repo, pb.WatchProgressO_OP_STAT)
+	statOpts.Progress = func(p shadows.Progress) {
+		srv.jobs.progress(job, p)
+	}
 
 	// Record rate-limit feedback independent of context.
 	timeout := time.AfterFunc(maxStatSoftTimeout, func() {
@@ -247,7 +264,12 @@ func (srv *Server) Stat(
 			Name:  req.AuthorName,
 			Email: req.AuthorEmail,
 		}
-		err := srv.proc.StatRepo(doCtx, repo, author, statOpts)
+		// The job is queued until the scheduler grants a slot.
+		jobCtx := jobsched.WithStartedFunc(doCtx, func() {
+			srv.jobs.running(job)
+		})
+		err := srv.proc.StatRepo(jobCtx, repo, author, statOpts)
+		srv.jobs.done(job, err)
 		// ok -> record rate limit success if quick enough.
 		if err == nil && timeout.Stop() {
 			srv.limiter.Success()
@@ -286,6 +308,7 @@ func (srv *Server) Stat(
 		)
 		srv.limiter.Excess()
 		timeout.Stop()
+		srv.jobs.remove(job)
 		return nil, err
 	}
 
@@ -299,7 +322,7 @@ func (srv *Server) Stat(
 			}
 		}
 	}
-	return &pb.StatO{}, nil
+	return &pb.StatO{Job: job[:]}, nil
 }
 
 func (srv *Server) Sha(
@@ -322,6 +345,13 @@ func (srv *Server) Sha(
 		srv.limiter.Excess()
 	})
 
+	job := srv.jobs.add(repo, pb.WatchProgressO_OP_SHA)
+	shaOpts := shadows.ShaOptions{
+		Progress: func(p shadows.Progress) {
+			srv.jobs.progress(job, p)
+		},
+	}
+
 	isBlocking := (req.JobControl == pb.JobControl_JC_WAIT)
 	var retC chan error
 	if isBlocking {
@@ -337,7 +367,12 @@ func (srv *Server) Sha(
 			Name:  req.AuthorName,
 			Email: req.AuthorEmail,
 		}
-		err := srv.proc.ShaRepo(doCtx, repo, author)
+		// The job is queued until the scheduler grants a slot.
+		jobCtx := jobsched.WithStartedFunc(doCtx, func() {
+			srv.jobs.running(job)
+		})
+		err := srv.proc.ShaRepo(jobCtx, repo, author, shaOpts)
+		srv.jobs.done(job, err)
 		// ok -> record rate limit success if quick enough.
 		if err == nil && timeout.Stop() {
 			srv.limiter.Success()
@@ -376,6 +411,7 @@ func (srv *Server) Sha(
 		)
 		srv.limiter.Excess()
 		timeout.Stop()
+		srv.jobs.remove(job)
 		return nil, err
 	}
 
@@ -389,7 +425,7 @@ func (srv *Server) Sha(
 			}
 		}
 	}
-	return &pb.ShaO{}, nil
+	return &pb.ShaO{Job: job[:]}, nil
 }
 
 func (srv *Server) RefreshContent(
@@ -412,6 +448,13 @@ func (srv *Server) RefreshContent(
 		srv.limiter.Excess()
 	})
 
+	job := srv.jobs.add(repo, pb.WatchProgressO_OP_REFRESH_CONTENT)
+	contentOpts := shadows.RefreshContentOptions{
+		Progress: func(p shadows.Progress) {
+			srv.jobs.progress(job, p)
+		},
+	}
+
 	isBlocking := (req.JobControl == pb.JobControl_JC_WAIT)
 	var retC chan error
 	if isBlocking {
@@ -427,7 +470,14 @@ func (srv *Server) RefreshContent(
 			Name:  req.AuthorName,
 			Email: req.AuthorEmail,
 		}
-		err := srv.proc.RefreshContent(doCtx, repo, author)
+		// The job is queued until the scheduler grants a slot.
+		jobCtx := jobsched.WithStartedFunc(doCtx, func() {
+			srv.jobs.running(job)
+		})
+		err := srv.proc.RefreshContent(
+			jobCtx, repo, author, contentOpts,
+		)
+		srv.jobs.done(job, err)
 		// ok -> record rate limit success if quick enough.
 		if err == nil && timeout.Stop() {
 			srv.limiter.Success()
@@ -469,6 +519,7 @@ func (srv *Server) RefreshContent(
 		)
 		srv.limiter.Excess()
 		timeout.Stop()
+		srv.jobs.remove(job)
 		return nil, err
 	}
 
@@ -482,7 +533,7 @@ func (srv *Server) RefreshContent(
 			}
 		}
 	}
-	return &pb.RefreshContentO{}, nil
+	return &pb.RefreshContentO{Job: job[:]}, nil
 }
 
 func (srv *Server) ReinitSubdirTracking(
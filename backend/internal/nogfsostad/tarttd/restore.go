@@ -0,0 +1,376 @@
+package tarttd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/execx"
+	"github.com/nogproject/nog/backend/pkg/ratelimit"
+	"github.com/nogproject/nog/backend/pkg/regexpx"
+	"github.com/nogproject/nog/backend/pkg/trace"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var ErrNoArchive = errors.New("repo has no tartt archive")
+var ErrWrongHost = errors.New("tartt archive on wrong host")
+var ErrTooManyRestores = errors.New("too many concurrent tartt restores")
+var ErrSpoolFull = errors.New("tartt restore spool is full")
+
+// `rgxTspath` accepts tartt archive paths like `<store>/<ts>` or
+// `<store>/<ts>/s0/<ts>`.  It rejects `..` and absolute paths.
+var rgxTspath = regexp.MustCompile(regexpx.Verbose(`
+	^
+	[a-zA-Z0-9][a-zA-Z0-9_-]*
+	/( [0-9]{4}-[0-9]{2}-[0-9]{2} | [0-9]{8} ) T [0-9]{6} Z
+	(
+		/s[0-9]+
+		/( [0-9]{4}-[0-9]{2}-[0-9]{2} | [0-9]{8} ) T [0-9]{6} Z
+	)*
+	$
+`))
+
+// `restoreChunkSize` is the size of the `RestoreStreamO.data` chunks.
+const restoreChunkSize = 64 * 1024
+
+// `spoolCheckInterval` is the interval at which the free space of the spool
+// is checked while restoring.
+var spoolCheckInterval = 5 * time.Second
+
+type RestorerConfig struct {
+	Conn        *grpc.ClientConn
+	SysRPCCreds credentials.PerRPCCredentials
+	// `Hosts` are the hosts whose tartt archives may be restored.
+	Hosts []string
+	// `Spool` is the directory below which the restores are staged.
+	Spool string
+	// `IdentityFile` is passed to `tartt restore --identity-file` if
+	// set, so that native OpenPGP archives can be decrypted.
+	IdentityFile string
+	// `Limit` is the bandwidth in bytes per second that is shared by all
+	// restore streams.
+	Limit uint64
+	// `MaxRestores` is the maximum number of concurrent restores.
+	// Further restores are rejected with `ErrTooManyRestores`.
+	MaxRestores int
+	// `SpoolMinFree` is the free space in bytes that must remain on the
+	// spool filesystem.  Restores are rejected or stopped with
+	// `ErrSpoolFull` if less space is available.
+	SpoolMinFree uint64
+}
+
+// `Restorer` runs `tartt restore` into a temporary spool directory and
+// returns the restored files as a tar stream.  It cannot stream directly from
+// the archive, because restoring an incremental archive applies the patches
+// of the archive chain in order.  The spool is therefore protected by
+// limiting the number of concurrent restores and by watching its free space.
+type Restorer struct {
+	lg           Logger
+	conn         *grpc.ClientConn
+	sysRPCCreds  grpc.CallOption
+	hosts        map[string]struct{}
+	spool        string
+	identityFile string
+	bucket       *ratelimit.Bucket
+	tartt        *execx.Tool
+	tar          *execx.Tool
+	sem          *semaphore.Weighted
+	minFree      uint64
+	// `freeSpace` is `statfsFree()` except in tests.
+	freeSpace func(path string) (uint64, error)
+}
+
+func NewRestorer(lg Logger, cfg *RestorerConfig) (*Restorer, error) {
+	if cfg.Limit == 0 {
+		return nil, errors.New("zero bandwidth limit")
+	}
+	if cfg.MaxRestores < 1 {
+		return nil, errors.New("invalid max restores")
+	}
+
+	tartt, err := execx.LookTool(execx.ToolSpec{
+		Program:   "tartt",
+		CheckArgs: []string{"--version"},
+		CheckText: "tartt-",
+	})
+	if err != nil {
+		return nil, err
+	}
+	tar, err := execx.LookTool(execx.ToolSpec{
+		Program:   "tar",
+		CheckArgs: []string{"--version"},
+		CheckText: "tar (GNU tar)",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]struct{})
+	for _, h := range cfg.Hosts {
+		hosts[h] = struct{}{}
+	}
+
+	// Allow bursts of 1 second.
+	limit := float64(cfg.Limit)
+	bucket := ratelimit.NewBucketWithRate(limit, int64(cfg.Limit))
+
+	return &Restorer{
+		lg:           lg,
+		conn:         cfg.Conn,
+		sysRPCCreds:  grpc.PerRPCCredentials(cfg.SysRPCCreds),
+		hosts:        hosts,
+		spool:        cfg.Spool,
+		identityFile: cfg.IdentityFile,
+		bucket:       bucket,
+		tartt:        tartt,
+		tar:          tar,
+		sem:          semaphore.NewWeighted(int64(cfg.MaxRestores)),
+		minFree:      cfg.SpoolMinFree,
+		freeSpace:    statfsFree,
+	}, nil
+}
+
+// `tarttRepoPath()` returns the local path of the tartt repo from the repo
+// archive URL, which has the form `tartt://<host>/<path>?driver=...`.
+func (r *Restorer) tarttRepoPath(
+	ctx context.Context, repoId uuid.I,
+) (string, error) {
+	c := pb.NewReposClient(r.conn)
+	o, err := c.GetRepo(
+		ctx,
+		&pb.GetRepoI{
+			Repo: repoId[:],
+		},
+		r.sysRPCCreds,
+	)
+	if err != nil {
+		return "", err
+	}
+	if o.Archive == "" {
+		return "", ErrNoArchive
+	}
+
+	repo, err := url.Parse(o.Archive)
+	if err != nil {
+		return "", err
+	}
+	if repo.Scheme != "tartt" {
+		return "", fmt.Errorf("invalid archive URL `%s`", o.Archive)
+	}
+	if _, ok := r.hosts[repo.Host]; !ok {
+		return "", ErrWrongHost
+	}
+	return repo.Path, nil
+}
+
+// `Restore()` restores `members` of `tspath` and writes them as a tar stream
+// to `w`.  The files are first restored to a temporary directory below the
+// spool directory, which is removed when `Restore()` returns.  `w` receives
+// data only after the restore has completed.
+//
+// `Restore()` fails with `ErrTooManyRestores` if the maximum number of
+// restores is already running, and with `ErrSpoolFull` if the free space of
+// the spool is below the minimum before or while restoring.
+func (r *Restorer) Restore(
+	ctx context.Context,
+	repoId uuid.I,
+	tspath string,
+	members []string,
+	w io.Writer,
+) error {
+	if !r.sem.TryAcquire(1) {
+		return ErrTooManyRestores
+	}
+	defer r.sem.Release(1)
+	if err := r.checkSpool(); err != nil {
+		return err
+	}
+
+	repoPath, err := r.tarttRepoPath(ctx, repoId)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(r.spool, "restore-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			r.lg.Warnw(
+				"Failed to remove restore dir.",
+				"err", err,
+				"dir", tmp,
+			)
+		}
+	}()
+
+	// `nogfsostad` usually does not run as root.  The tar stream is
+	// created with numeric owners of the restored files.
+	args := []string{
+		"-C", repoPath,
+		"restore",
+		"--no-same-owner",
+		"--no-same-permissions",
+	}
+	if r.identityFile != "" {
+		args = append(args, "--identity-file="+r.identityFile)
+	}
+	args = append(args, fmt.Sprintf("--dest=%s", tmp), tspath)
+	if len(members) > 0 {
+		args = append(args, "--")
+		args = append(args, members...)
+	}
+	// Stop the restore if the spool fills up.
+	ctxRestore, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var spoolFull int32
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		r.watchSpool(ctxRestore, cancel, &spoolFull)
+	}()
+
+	var stderr bytes.Buffer
+	restore := exec.CommandContext(ctxRestore, r.tartt.Path, args...)
+	restore.Env = append(os.Environ(), trace.Environ(ctx)...)
+	restore.Stderr = &stderr
+	errRestore := restore.Run()
+	cancel()
+	<-watchDone
+	if atomic.LoadInt32(&spoolFull) != 0 {
+		return ErrSpoolFull
+	}
+	if err := errRestore; err != nil {
+		return fmt.Errorf(
+			"tartt restore failed: %v; stderr: %s",
+			err, lastLine(stderr.String()),
+		)
+	}
+
+	stderr.Reset()
+	create := exec.CommandContext(
+		ctx,
+		r.tar.Path,
+		"--create",
+		"--file=-",
+		"--numeric-owner",
+		"-C", tmp,
+		".",
+	)
+	create.Stderr = &stderr
+	stdout, err := create.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := create.Start(); err != nil {
+		return err
+	}
+
+	_, errCopy := io.CopyBuffer(
+		w, ratelimit.Reader(stdout, r.bucket),
+		make([]byte, restoreChunkSize),
+	)
+	if errCopy != nil {
+		// Drain, so that tar can exit.
+		_, _ = io.Copy(ioutil.Discard, stdout)
+	}
+	errWait := create.Wait()
+	switch {
+	case errCopy != nil:
+		return errCopy
+	case errWait != nil:
+		return fmt.Errorf(
+			"tar failed: %v; stderr: %s",
+			errWait, lastLine(stderr.String()),
+		)
+	}
+	return nil
+}
+
+// `checkSpool()` returns `ErrSpoolFull` if less than the minimum free space is
+// available on the spool filesystem.
+func (r *Restorer) checkSpool() error {
+	free, err := r.freeSpace(r.spool)
+	if err != nil {
+		return err
+	}
+	if free < r.minFree {
+		r.lg.Warnw(
+			"Tartt restore spool is full.",
+			"spool", r.spool,
+			"free", free,
+			"minFree", r.minFree,
+		)
+		return ErrSpoolFull
+	}
+	return nil
+}
+
+// `watchSpool()` checks the spool until `ctx` is cancelled.  If the spool is
+// full, it sets `full` and calls `cancel()`.
+func (r *Restorer) watchSpool(
+	ctx context.Context, cancel context.CancelFunc, full *int32,
+) {
+	ticker := time.NewTicker(spoolCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.checkSpool(); err == ErrSpoolFull {
+			atomic.StoreInt32(full, 1)
+			cancel()
+			return
+		}
+	}
+}
+
+// `statfsFree()` returns the bytes that are available to unprivileged users
+// on the filesystem of `path`.
+func statfsFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// `restoreStreamWriter` sends each write as a separate `RestoreStreamO`.
+type restoreStreamWriter struct {
+	ostream pb.Tartt_RestoreStreamServer
+}
+
+func (w *restoreStreamWriter) Write(p []byte) (int, error) {
+	if err := w.ostream.Send(&pb.RestoreStreamO{
+		Data: p,
+	}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
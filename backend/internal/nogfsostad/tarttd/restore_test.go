@@ -0,0 +1,275 @@
+package tarttd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{}) {}
+func (nullLogger) Warnw(msg string, kv ...interface{}) {}
+
+type testAuth struct {
+	deny bool
+}
+
+func (a testAuth) Authenticate(ctx context.Context) (auth.Identity, error) {
+	return auth.Identity{}, nil
+}
+
+func (a testAuth) Authorize(
+	euid auth.Identity, action auth.Action, details auth.ActionDetails,
+) error {
+	if a.deny {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+	return nil
+}
+
+// `testProc` knows a single repo.  Other `Processor` methods are not used.
+type testProc struct {
+	Processor
+	repoId uuid.I
+}
+
+func (p testProc) GlobalRepoPath(repoId uuid.I) (string, bool) {
+	if repoId != p.repoId {
+		return "", false
+	}
+	return "/example/repo", true
+}
+
+type testRestoreStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs []*pb.RestoreStreamO
+}
+
+func (s *testRestoreStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testRestoreStream) Send(o *pb.RestoreStreamO) error {
+	s.msgs = append(s.msgs, o)
+	return nil
+}
+
+func TestRgxTspath(t *testing.T) {
+	for _, c := range []struct {
+		tspath string
+		ok     bool
+	}{
+		{"s0/2019-01-02T030405Z", true},
+		{"s0/20190102T030405Z", true},
+		{"s0/2019-01-02T030405Z/s1/2019-01-03T030405Z", true},
+		{"", false},
+		{"s0", false},
+		{"/s0/2019-01-02T030405Z", false},
+		{"../2019-01-02T030405Z", false},
+		{"s0/2019-01-02T030405Z/..", false},
+		{"s0/2019-01-02T030405Z/s1", false},
+		{"s0/2019-01-02T030405Z/", false},
+	} {
+		if got := rgxTspath.MatchString(c.tspath); got != c.ok {
+			t.Errorf("%q: expected %v, got %v", c.tspath, c.ok, got)
+		}
+	}
+}
+
+func TestRestoreStreamRejects(t *testing.T) {
+	repoId := uuid.Must(uuid.NewRandom())
+	otherId := uuid.Must(uuid.NewRandom())
+	proc := testProc{repoId: repoId}
+	tspath := "s0/2019-01-02T030405Z"
+
+	for _, c := range []struct {
+		name     string
+		authz    testAuth
+		restorer *Restorer
+		i        *pb.RestoreStreamI
+		code     codes.Code
+	}{
+		{
+			name:     "invalid repo id",
+			restorer: &Restorer{},
+			i:        &pb.RestoreStreamI{Repo: []byte("x")},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "unknown repo",
+			restorer: &Restorer{},
+			i:        &pb.RestoreStreamI{Repo: otherId[:]},
+			code:     codes.NotFound,
+		},
+		{
+			name:     "denied",
+			authz:    testAuth{deny: true},
+			restorer: &Restorer{},
+			i: &pb.RestoreStreamI{
+				Repo: repoId[:], Tspath: tspath,
+			},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "disabled",
+			i: &pb.RestoreStreamI{
+				Repo: repoId[:], Tspath: tspath,
+			},
+			code: codes.Unimplemented,
+		},
+		{
+			name:     "malformed tspath",
+			restorer: &Restorer{},
+			i: &pb.RestoreStreamI{
+				Repo: repoId[:], Tspath: "s0/../etc",
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name:     "empty member",
+			restorer: &Restorer{},
+			i: &pb.RestoreStreamI{
+				Repo:    repoId[:],
+				Tspath:  tspath,
+				Members: []string{"a", ""},
+			},
+			code: codes.InvalidArgument,
+		},
+	} {
+		srv := New(nullLogger{}, testAuth{}, c.authz, proc, c.restorer)
+		stream := &testRestoreStream{ctx: context.Background()}
+		err := srv.RestoreStream(c.i, stream)
+		if status.Code(err) != c.code {
+			t.Errorf(
+				"%s: expected code %v, got %v",
+				c.name, c.code, err,
+			)
+		}
+		if len(stream.msgs) != 0 {
+			t.Errorf("%s: unexpected messages", c.name)
+		}
+	}
+}
+
+func TestRestoreStreamWriter(t *testing.T) {
+	stream := &testRestoreStream{ctx: context.Background()}
+	w := &restoreStreamWriter{ostream: stream}
+	for _, s := range []string{"foo", "bar"} {
+		n, err := io.WriteString(w, s)
+		if err != nil || n != len(s) {
+			t.Fatalf("unexpected write result %d, %v", n, err)
+		}
+	}
+	if len(stream.msgs) != 2 ||
+		string(stream.msgs[0].Data) != "foo" ||
+		string(stream.msgs[1].Data) != "bar" {
+		t.Errorf("expected one message per write, got %v", stream.msgs)
+	}
+}
+
+func fixedFree(n uint64) func(string) (uint64, error) {
+	return func(string) (uint64, error) { return n, nil }
+}
+
+// Restores are rejected before contacting the registry if the spool is full
+// or too many restores are running.
+func TestRestoreRejectsResourceExhausted(t *testing.T) {
+	full := semaphore.NewWeighted(1)
+	full.Acquire(context.Background(), 1)
+
+	for _, c := range []struct {
+		name     string
+		restorer *Restorer
+		err      error
+	}{
+		{
+			name: "too many restores",
+			restorer: &Restorer{
+				lg:        nullLogger{},
+				sem:       full,
+				freeSpace: fixedFree(1 << 30),
+			},
+			err: ErrTooManyRestores,
+		},
+		{
+			name: "spool full",
+			restorer: &Restorer{
+				lg:        nullLogger{},
+				sem:       semaphore.NewWeighted(1),
+				minFree:   1 << 30,
+				freeSpace: fixedFree(1 << 20),
+			},
+			err: ErrSpoolFull,
+		},
+	} {
+		err := c.restorer.Restore(
+			context.Background(), uuid.Nil, "", nil, ioutil.Discard,
+		)
+		if err != c.err {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+
+		repoId := uuid.Must(uuid.NewRandom())
+		srv := New(
+			nullLogger{}, testAuth{}, testAuth{},
+			testProc{repoId: repoId}, c.restorer,
+		)
+		stream := &testRestoreStream{ctx: context.Background()}
+		err = srv.RestoreStream(&pb.RestoreStreamI{
+			Repo: repoId[:], Tspath: "s0/2019-01-02T030405Z",
+		}, stream)
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf(
+				"%s: expected ResourceExhausted, got %v",
+				c.name, err,
+			)
+		}
+	}
+
+	// A rejected restore does not hold a slot.
+	r := &Restorer{
+		lg:        nullLogger{},
+		sem:       semaphore.NewWeighted(1),
+		minFree:   1 << 30,
+		freeSpace: fixedFree(0),
+	}
+	r.Restore(context.Background(), uuid.Nil, "", nil, ioutil.Discard)
+	if !r.sem.TryAcquire(1) {
+		t.Error("restore slot not released")
+	}
+}
+
+func TestWatchSpoolCancels(t *testing.T) {
+	defer func(d time.Duration) { spoolCheckInterval = d }(
+		spoolCheckInterval,
+	)
+	spoolCheckInterval = time.Millisecond
+
+	r := &Restorer{
+		lg:        nullLogger{},
+		minFree:   1 << 30,
+		freeSpace: fixedFree(0),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var full int32
+	r.watchSpool(ctx, cancel, &full)
+	if full == 0 {
+		t.Error("expected full")
+	}
+	if ctx.Err() == nil {
+		t.Error("expected cancelled context")
+	}
+}
@@ -18,9 +18,13 @@ type Server struct {
 	proc  Processor
 	authn auth.Authenticator
 	authz auth.Authorizer
+	// `restorer` is `nil` if `RestoreStream()` is disabled.
+	restorer *Restorer
 }
 
 type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
 }
 
 type Processor interface {
@@ -44,12 +48,14 @@ func New(
 	authn auth.Authenticator,
 	authz auth.Authorizer,
 	proc Processor,
+	restorer *Restorer,
 ) *Server {
 	return &Server{
-		lg:    lg,
-		proc:  proc,
-		authn: authn,
-		authz: authz,
+		lg:       lg,
+		proc:     proc,
+		authn:    authn,
+		authz:    authz,
+		restorer: restorer,
 	}
 }
 
@@ -157,6 +163,65 @@ func (srv *Server) GetTarttconfig(
 	return o, nil
 }
 
+func (srv *Server) RestoreStream(
+	i *pb.RestoreStreamI, ostream pb.Tartt_RestoreStreamServer,
+) error {
+	ctx := ostream.Context()
+	repoId, err := srv.authRepoId(ctx, AAFsoReadRepo, i.Repo)
+	if err != nil {
+		return err
+	}
+
+	if srv.restorer == nil {
+		return status.Error(
+			codes.Unimplemented, "tartt restore is disabled",
+		)
+	}
+	if !rgxTspath.MatchString(i.Tspath) {
+		return status.Error(codes.InvalidArgument, "malformed tspath")
+	}
+	for _, m := range i.Members {
+		if m == "" {
+			return status.Error(
+				codes.InvalidArgument, "empty member",
+			)
+		}
+	}
+
+	srv.lg.Infow(
+		"Started tartt restore stream.",
+		"repoId", repoId.String(),
+		"tspath", i.Tspath,
+		"nMembers", len(i.Members),
+	)
+	if err := srv.restorer.Restore(
+		ctx, repoId, i.Tspath, i.Members,
+		&restoreStreamWriter{ostream: ostream},
+	); err != nil {
+		srv.lg.Warnw(
+			"tartt restore stream failed.",
+			"repoId", repoId.String(),
+			"tspath", i.Tspath,
+			"err", err,
+		)
+		switch err {
+		case ErrNoArchive, ErrWrongHost:
+			return status.Error(
+				codes.FailedPrecondition, err.Error(),
+			)
+		case ErrTooManyRestores, ErrSpoolFull:
+			return status.Error(
+				codes.ResourceExhausted, err.Error(),
+			)
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Unknown, "restore failed: %s", err)
+	}
+	return nil
+}
+
 func checkGitCommitBytes(b []byte) error {
 	if b == nil {
 		err := status.Error(
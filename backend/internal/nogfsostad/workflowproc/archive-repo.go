@@ -15,6 +15,7 @@ import (
 	wfevents "github.com/nogproject/nog/backend/internal/workflows/events"
 	wfstreams "github.com/nogproject/nog/backend/internal/workflows/eventstreams"
 	"github.com/nogproject/nog/backend/pkg/timex"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc"
@@ -184,6 +185,11 @@ func (a *archiveRepoWorkflowActivity) processView(
 	ctx context.Context,
 	view archiveRepoWorkflowView,
 ) (bool, error) {
+	ctx, span := trace.StartWorkflow(
+		ctx, "archive-repo", view.workflowId, view.vid,
+	)
+	defer span.End()
+
 	switch view.scode {
 	case archiverepowf.StateUninitialized:
 		return a.doContinue()
@@ -8,6 +8,7 @@ import (
 	wfevents "github.com/nogproject/nog/backend/internal/workflows/events"
 	wfstreams "github.com/nogproject/nog/backend/internal/workflows/eventstreams"
 	"github.com/nogproject/nog/backend/internal/workflows/freezerepowf"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc"
@@ -148,6 +149,11 @@ func (a *freezeRepoWorkflowActivity) processView(
 	ctx context.Context,
 	view freezeRepoWorkflowView,
 ) (bool, error) {
+	ctx, span := trace.StartWorkflow(
+		ctx, "freeze-repo", view.workflowId, view.vid,
+	)
+	defer span.End()
+
 	switch view.scode {
 	case freezerepowf.StateUninitialized:
 		return a.doContinue()
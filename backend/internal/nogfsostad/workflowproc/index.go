@@ -25,6 +25,7 @@ type indexActivity struct {
 	privs              Privileges
 	archiveRepoSpool   string
 	unarchiveRepoSpool string
+	namingBoundaries   NamingBoundaryFinder
 }
 
 type indexView struct {
@@ -417,10 +418,11 @@ func (a *indexActivity) runSplitRootWorkflow(
 	if err := a.workflowEngine.StartRegistryWorkflowActivity(
 		a.registry, workflowId,
 		&splitRootWorkflowActivity{
-			lg:          a.lg,
-			conn:        a.conn,
-			sysRPCCreds: a.sysRPCCreds,
-			done:        done,
+			lg:               a.lg,
+			conn:             a.conn,
+			sysRPCCreds:      a.sysRPCCreds,
+			namingBoundaries: a.namingBoundaries,
+			done:             done,
 		},
 	); err != nil {
 		return err
@@ -19,17 +19,19 @@ import (
 )
 
 type splitRootWorkflowActivity struct {
-	lg          Logger
-	conn        *grpc.ClientConn
-	sysRPCCreds grpc.CallOption
-	done        chan<- struct{}
-	view        splitRootWorkflowView
+	lg               Logger
+	conn             *grpc.ClientConn
+	sysRPCCreds      grpc.CallOption
+	namingBoundaries NamingBoundaryFinder
+	done             chan<- struct{}
+	view             splitRootWorkflowView
 }
 
 type splitRootWorkflowView struct {
 	workflowId   uuid.I
 	vid          ulid.I
 	scode        splitrootwf.StateCode
+	globalRoot   string
 	root         string
 	maxDepth     int32
 	minDiskUsage int64
@@ -79,6 +81,7 @@ func (view *splitRootWorkflowView) LoadWorkflowEvent(
 	switch x := ev.(type) {
 	case *wfevents.EvSplitRootStarted:
 		view.scode = splitrootwf.StateInitialized
+		view.globalRoot = x.GlobalRoot
 		view.root = x.HostRoot
 		view.maxDepth = x.MaxDepth
 		view.minDiskUsage = x.MinDiskUsage
@@ -116,7 +119,8 @@ func (a *splitRootWorkflowActivity) processView(
 	case splitrootwf.StateInitialized:
 		return a.doRunDuQuit(
 			ctx, view.workflowId, view.vid,
-			view.root, view.maxDepth, view.minDiskUsage,
+			view.globalRoot, view.root,
+			view.maxDepth, view.minDiskUsage,
 		)
 
 	case splitrootwf.StateDuAppending:
@@ -152,6 +156,7 @@ func (a *splitRootWorkflowActivity) doRunDuQuit(
 	ctx context.Context,
 	workflowId uuid.I,
 	vid ulid.I,
+	globalRoot string,
 	root string,
 	maxDepth int32,
 	minDiskUsage int64,
@@ -170,6 +175,8 @@ func (a *splitRootWorkflowActivity) doRunDuQuit(
 		return a.doAbortDuAndQuit(ctx, workflowId, vid, msg)
 	}
 
+	boundaries := a.findNamingBoundaries(ctx, globalRoot)
+
 	duCmd := du0Command(
 		ctx,
 		root,
@@ -207,8 +214,9 @@ func (a *splitRootWorkflowActivity) doRunDuQuit(
 			Workflow:    workflowId[:],
 			WorkflowVid: vid[:],
 			Paths: []*pb.PathDiskUsage{{
-				Path:  path,
-				Usage: usage,
+				Path:           path,
+				Usage:          usage,
+				NamingBoundary: boundaries[path],
 			}},
 		}
 		o, err := c.AppendSplitRootDu(ctx, i, a.sysRPCCreds)
@@ -279,6 +287,28 @@ func (a *splitRootWorkflowActivity) doRunDuQuit(
 	return a.doCommitQuit(ctx, workflowId, vid)
 }
 
+// `findNamingBoundaries()` returns `nil` if the naming boundaries are
+// unavailable, so that split-root continues with disk usage only.
+func (a *splitRootWorkflowActivity) findNamingBoundaries(
+	ctx context.Context, globalRoot string,
+) map[string]bool {
+	if a.namingBoundaries == nil {
+		return nil
+	}
+	boundaries, err := a.namingBoundaries.FindNamingBoundaries(
+		ctx, globalRoot,
+	)
+	if err != nil {
+		a.lg.Warnw(
+			"Ignored failed split-root naming boundaries.",
+			"root", globalRoot,
+			"err", err,
+		)
+		return nil
+	}
+	return boundaries
+}
+
 func (a *splitRootWorkflowActivity) doCommitQuit(
 	ctx context.Context,
 	workflowId uuid.I,
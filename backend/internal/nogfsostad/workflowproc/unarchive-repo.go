@@ -14,6 +14,7 @@ import (
 	wfstreams "github.com/nogproject/nog/backend/internal/workflows/eventstreams"
 	"github.com/nogproject/nog/backend/internal/workflows/unarchiverepowf"
 	"github.com/nogproject/nog/backend/pkg/timex"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc"
@@ -187,6 +188,11 @@ func (a *unarchiveRepoWorkflowActivity) processView(
 	ctx context.Context,
 	view unarchiveRepoWorkflowView,
 ) (bool, error) {
+	ctx, span := trace.StartWorkflow(
+		ctx, "unarchive-repo", view.workflowId, view.vid,
+	)
+	defer span.End()
+
 	switch view.scode {
 	case unarchiverepowf.StateUninitialized:
 		return a.doContinue()
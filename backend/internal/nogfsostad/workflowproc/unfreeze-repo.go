@@ -8,6 +8,7 @@ import (
 	wfevents "github.com/nogproject/nog/backend/internal/workflows/events"
 	wfstreams "github.com/nogproject/nog/backend/internal/workflows/eventstreams"
 	"github.com/nogproject/nog/backend/internal/workflows/unfreezerepowf"
+	"github.com/nogproject/nog/backend/pkg/trace"
 	"github.com/nogproject/nog/backend/pkg/ulid"
 	"github.com/nogproject/nog/backend/pkg/uuid"
 	"google.golang.org/grpc"
@@ -148,6 +149,11 @@ func (a *unfreezeRepoWorkflowActivity) processView(
 	ctx context.Context,
 	view unfreezeRepoWorkflowView,
 ) (bool, error) {
+	ctx, span := trace.StartWorkflow(
+		ctx, "unfreeze-repo", view.workflowId, view.vid,
+	)
+	defer span.End()
+
 	switch view.scode {
 	case unfreezerepowf.StateUninitialized:
 		return a.doContinue()
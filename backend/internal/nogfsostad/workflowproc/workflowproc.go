@@ -46,6 +46,15 @@ type RepoProcessor interface {
 	) error
 }
 
+// `NamingBoundaryFinder` returns the paths relative to `globalRoot` that the
+// repo naming rule of the root reports as repos.  It returns `nil` if the rule
+// does not define boundaries that are useful for split-root.
+type NamingBoundaryFinder interface {
+	FindNamingBoundaries(
+		ctx context.Context, globalRoot string,
+	) (map[string]bool, error)
+}
+
 type AclPropagator interface {
 	PropagateAcls(ctx context.Context, src, dst string) error
 }
@@ -72,6 +81,9 @@ type Config struct {
 	AclPropagator      AclPropagator
 	ArchiveRepoSpool   string
 	UnarchiveRepoSpool string
+	// `NamingBoundaries` is optional.  If set, split-root du results
+	// indicate the paths that the repo naming rule reports as repos.
+	NamingBoundaries NamingBoundaryFinder
 }
 
 type Processor struct {
@@ -111,6 +123,7 @@ func New(lg Logger, cfg *Config) *Processor {
 			aclPropagator:      cfg.AclPropagator,
 			archiveRepoSpool:   cfg.ArchiveRepoSpool,
 			unarchiveRepoSpool: cfg.UnarchiveRepoSpool,
+			namingBoundaries:   cfg.NamingBoundaries,
 		})
 	}
 
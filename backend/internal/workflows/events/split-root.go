@@ -152,8 +152,9 @@ func fromPbSplitRootStarted(evpb *pb.WorkflowEvent) (WorkflowEvent, error) {
 // `WorkflowEvent_EV_FSO_SPLIT_ROOT_DU_APPENDED` aka `EvSplitRootDuAppended`.
 // See split-root workflow aka splitrootwf.
 type EvSplitRootDuAppended struct {
-	Path  string
-	Usage int64
+	Path           string
+	Usage          int64
+	NamingBoundary bool
 }
 
 func (EvSplitRootDuAppended) WorkflowEvent() {}
@@ -162,16 +163,18 @@ func NewPbSplitRootDuAppended(ev *EvSplitRootDuAppended) pb.WorkflowEvent {
 	return pb.WorkflowEvent{
 		Event: pb.WorkflowEvent_EV_FSO_SPLIT_ROOT_DU_APPENDED,
 		PathDiskUsage: &pb.PathDiskUsage{
-			Path:  ev.Path,
-			Usage: ev.Usage,
+			Path:           ev.Path,
+			Usage:          ev.Usage,
+			NamingBoundary: ev.NamingBoundary,
 		},
 	}
 }
 
 func fromPbSplitRootDuAppended(evpb *pb.WorkflowEvent) (WorkflowEvent, error) {
 	ev := &EvSplitRootDuAppended{
-		Path:  evpb.PathDiskUsage.Path,
-		Usage: evpb.PathDiskUsage.Usage,
+		Path:           evpb.PathDiskUsage.Path,
+		Usage:          evpb.PathDiskUsage.Usage,
+		NamingBoundary: evpb.PathDiskUsage.NamingBoundary,
 	}
 	return ev, nil
 }
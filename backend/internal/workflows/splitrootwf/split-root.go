@@ -63,8 +63,9 @@ type State struct {
 }
 
 type PathUsage struct {
-	Path  string
-	Usage int64
+	Path           string
+	Usage          int64
+	NamingBoundary bool
 }
 
 type Suggestion struct {
@@ -224,8 +225,9 @@ func (a *Advancer) Advance(s events.State, ev events.Event) events.State {
 	case *wfev.EvSplitRootDuAppended:
 		st.scode = StateDuAppending
 		st.du = append(st.du, PathUsage{
-			Path:  x.Path,
-			Usage: x.Usage,
+			Path:           x.Path,
+			Usage:          x.Usage,
+			NamingBoundary: x.NamingBoundary,
 		})
 		return st
 
@@ -392,8 +394,9 @@ func tellAppendDus(st *State, cmd *CmdAppendDus) ([]events.Event, error) {
 	evs := make([]pb.WorkflowEvent, 0, len(cmd.Paths))
 	for _, p := range cmd.Paths {
 		ev := &wfev.EvSplitRootDuAppended{
-			Path:  p.Path,
-			Usage: p.Usage,
+			Path:           p.Path,
+			Usage:          p.Usage,
+			NamingBoundary: p.NamingBoundary,
 		}
 		evs = append(evs, wfev.NewPbSplitRootDuAppended(ev))
 	}
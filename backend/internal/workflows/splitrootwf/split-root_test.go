@@ -0,0 +1,52 @@
+package splitrootwf_test
+
+import (
+	"testing"
+
+	"github.com/nogproject/nog/backend/internal/events"
+	"github.com/nogproject/nog/backend/internal/workflows/splitrootwf"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func apply(
+	t testing.TB, st *splitrootwf.State, cmd events.Command,
+) *splitrootwf.State {
+	t.Helper()
+
+	bh := splitrootwf.Behavior{}
+	evs, err := bh.Tell(st, cmd)
+	require.NoError(t, err)
+
+	ad := splitrootwf.Advancer{}
+	for _, ev := range evs {
+		st = ad.Advance(st, ev).(*splitrootwf.State)
+	}
+	return st
+}
+
+func TestAppendDusKeepsNamingBoundary(t *testing.T) {
+	st := &splitrootwf.State{}
+	st = apply(t, st, &splitrootwf.CmdInit{
+		RegistryId:   uuid.Must(uuid.NewRandom()),
+		GlobalRoot:   "/example/data",
+		Host:         "files.example.com",
+		HostRoot:     "/data",
+		MaxDepth:     3,
+		MinDiskUsage: 100,
+		MaxDiskUsage: 1000,
+	})
+	st = apply(t, st, &splitrootwf.CmdAppendDus{
+		Paths: []splitrootwf.PathUsage{
+			{Path: ".", Usage: 300},
+			{Path: "marked", Usage: 200, NamingBoundary: true},
+			{Path: "plain", Usage: 100},
+		},
+	})
+
+	require.Equal(t, []splitrootwf.PathUsage{
+		{Path: ".", Usage: 300},
+		{Path: "marked", Usage: 200, NamingBoundary: true},
+		{Path: "plain", Usage: 100},
+	}, st.Du())
+}
@@ -0,0 +1,93 @@
+package wfindexes
+
+import (
+	pb "github.com/nogproject/nog/backend/internal/nogfsopb"
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+var workflowsTotal = metrics.NewCounterVec(
+	"nogfso_workflows_total",
+	"Number of workflow state transitions recorded in workflow indexes.",
+	"workflow", "state",
+)
+
+type workflowState struct {
+	workflow string
+	state    string
+}
+
+// `indexedWorkflowStates` maps the index events to labels for
+// `workflowsTotal`.
+var indexedWorkflowStates = map[pb.WorkflowEvent_Type]workflowState{
+	pb.WorkflowEvent_EV_FSO_DU_ROOT_STARTED: {
+		"du-root", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_DU_ROOT_COMPLETED: {
+		"du-root", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_DU_ROOT_DELETED: {
+		"du-root", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_PING_REGISTRY_STARTED: {
+		"ping-registry", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_PING_REGISTRY_COMPLETED: {
+		"ping-registry", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_PING_REGISTRY_DELETED: {
+		"ping-registry", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_SPLIT_ROOT_STARTED: {
+		"split-root", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_SPLIT_ROOT_COMPLETED: {
+		"split-root", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_SPLIT_ROOT_DELETED: {
+		"split-root", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_FREEZE_REPO_STARTED_2: {
+		"freeze-repo", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_FREEZE_REPO_COMPLETED_2: {
+		"freeze-repo", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_FREEZE_REPO_DELETED: {
+		"freeze-repo", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_UNFREEZE_REPO_STARTED_2: {
+		"unfreeze-repo", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_UNFREEZE_REPO_COMPLETED_2: {
+		"unfreeze-repo", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_UNFREEZE_REPO_DELETED: {
+		"unfreeze-repo", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_ARCHIVE_REPO_STARTED: {
+		"archive-repo", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_ARCHIVE_REPO_COMPLETED: {
+		"archive-repo", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_ARCHIVE_REPO_DELETED: {
+		"archive-repo", "deleted",
+	},
+	pb.WorkflowEvent_EV_FSO_UNARCHIVE_REPO_STARTED: {
+		"unarchive-repo", "started",
+	},
+	pb.WorkflowEvent_EV_FSO_UNARCHIVE_REPO_COMPLETED: {
+		"unarchive-repo", "completed",
+	},
+	pb.WorkflowEvent_EV_FSO_UNARCHIVE_REPO_DELETED: {
+		"unarchive-repo", "deleted",
+	},
+}
+
+// `countWorkflowEvent()` must only be called for new events from `Tell()`,
+// not for events that are loaded from the journal.
+func countWorkflowEvent(evpb *pb.WorkflowEvent) {
+	if st, ok := indexedWorkflowStates[evpb.Event]; ok {
+		workflowsTotal.With(st.workflow, st.state).Inc()
+	}
+}
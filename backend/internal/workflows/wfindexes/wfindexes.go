@@ -271,6 +271,7 @@ func (a *Advancer) Advance(s events.State, ev events.Event) events.State {
 		evpb = x.PbWorkflowEvent()
 	case *wfev.Event: // Event from `Tell()`
 		evpb = x.PbWorkflowEvent()
+		countWorkflowEvent(evpb)
 	default:
 		panic("invalid event")
 	}
@@ -0,0 +1,172 @@
+// Package `grpcchain` combines gRPC interceptors, since a server or client
+// accepts only a single unary and a single stream interceptor.
+//
+// Packages that provide interceptors export them as a `Server` and a
+// `Client`, which are combined with `ServerOptions()` and `DialOptions()`.
+// The first interceptor is the outermost.  Example:
+//
+//	srvOpts = append(srvOpts, grpcchain.ServerOptions(
+//		grpctrace.Server,
+//		grpcmetrics.Server,
+//	)...)
+package grpcchain
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type Server struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+type Client struct {
+	Unary  grpc.UnaryClientInterceptor
+	Stream grpc.StreamClientInterceptor
+}
+
+func ServerOptions(ss ...Server) []grpc.ServerOption {
+	var us []grpc.UnaryServerInterceptor
+	var sts []grpc.StreamServerInterceptor
+	for _, s := range ss {
+		if s.Unary != nil {
+			us = append(us, s.Unary)
+		}
+		if s.Stream != nil {
+			sts = append(sts, s.Stream)
+		}
+	}
+	var opts []grpc.ServerOption
+	if len(us) > 0 {
+		opts = append(opts, grpc.UnaryInterceptor(UnaryServer(us...)))
+	}
+	if len(sts) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(StreamServer(sts...)))
+	}
+	return opts
+}
+
+func DialOptions(cs ...Client) []grpc.DialOption {
+	var us []grpc.UnaryClientInterceptor
+	var sts []grpc.StreamClientInterceptor
+	for _, c := range cs {
+		if c.Unary != nil {
+			us = append(us, c.Unary)
+		}
+		if c.Stream != nil {
+			sts = append(sts, c.Stream)
+		}
+	}
+	var opts []grpc.DialOption
+	if len(us) > 0 {
+		opts = append(opts, grpc.WithUnaryInterceptor(
+			UnaryClient(us...),
+		))
+	}
+	if len(sts) > 0 {
+		opts = append(opts, grpc.WithStreamInterceptor(
+			StreamClient(sts...),
+		))
+	}
+	return opts
+}
+
+func UnaryServer(
+	is ...grpc.UnaryServerInterceptor,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		h := handler
+		for k := len(is) - 1; k >= 0; k-- {
+			i, next := is[k], h
+			h = func(ctx context.Context, req interface{}) (
+				interface{}, error,
+			) {
+				return i(ctx, req, info, next)
+			}
+		}
+		return h(ctx, req)
+	}
+}
+
+func StreamServer(
+	is ...grpc.StreamServerInterceptor,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		h := handler
+		for k := len(is) - 1; k >= 0; k-- {
+			i, next := is[k], h
+			h = func(srv interface{}, ss grpc.ServerStream) error {
+				return i(srv, ss, info, next)
+			}
+		}
+		return h(srv, ss)
+	}
+}
+
+func UnaryClient(
+	is ...grpc.UnaryClientInterceptor,
+) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		inv := invoker
+		for k := len(is) - 1; k >= 0; k-- {
+			i, next := is[k], inv
+			inv = func(
+				ctx context.Context,
+				method string,
+				req, reply interface{},
+				cc *grpc.ClientConn,
+				opts ...grpc.CallOption,
+			) error {
+				return i(ctx, method, req, reply, cc, next, opts...)
+			}
+		}
+		return inv(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func StreamClient(
+	is ...grpc.StreamClientInterceptor,
+) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		st := streamer
+		for k := len(is) - 1; k >= 0; k-- {
+			i, next := is[k], st
+			st = func(
+				ctx context.Context,
+				desc *grpc.StreamDesc,
+				cc *grpc.ClientConn,
+				method string,
+				opts ...grpc.CallOption,
+			) (grpc.ClientStream, error) {
+				return i(ctx, desc, cc, method, next, opts...)
+			}
+		}
+		return st(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,48 @@
+package grpcchain_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"google.golang.org/grpc"
+)
+
+func TestUnaryServerOrder(t *testing.T) {
+	var calls []string
+	mk := func(name string) grpc.UnaryServerInterceptor {
+		return func(
+			ctx context.Context,
+			req interface{},
+			info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler,
+		) (interface{}, error) {
+			calls = append(calls, name+">")
+			res, err := handler(ctx, req)
+			calls = append(calls, "<"+name)
+			return res, err
+		}
+	}
+	chain := grpcchain.UnaryServer(mk("a"), mk("b"))
+	res, err := chain(
+		context.Background(), "req", &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls = append(calls, "handler")
+			return req, nil
+		},
+	)
+	if err != nil || res != "req" {
+		t.Fatalf("unexpected result %v, %v", res, err)
+	}
+	want := []string{"a>", "b>", "handler", "<b", "<a"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+}
+
+func TestServerOptionsSkipsMissing(t *testing.T) {
+	if opts := grpcchain.ServerOptions(grpcchain.Server{}); len(opts) != 0 {
+		t.Errorf("expected no options, got %d", len(opts))
+	}
+}
@@ -0,0 +1,209 @@
+// Package `grpchealth` maintains the status of the standard gRPC health
+// service from periodic checks.
+//
+// A service is `SERVING` if all its checks succeed.  The overall status,
+// which is reported for the empty service name, is `SERVING` if all services
+// are serving.  Typical checks are journal connectivity and whether
+// long-running processors are alive; see `Liveness`.
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+}
+
+// `CheckFunc` returns an error if the service is not healthy.
+type CheckFunc func(ctx context.Context) error
+
+// `CheckTimeout` limits the duration of each individual check.
+var CheckTimeout = 5 * time.Second
+
+type Checker struct {
+	lg  Logger
+	srv *health.Server
+
+	mu     sync.Mutex
+	checks map[string][]CheckFunc
+	status map[string]healthpb.HealthCheckResponse_ServingStatus
+}
+
+func New(lg Logger) *Checker {
+	srv := health.NewServer()
+	srv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return &Checker{
+		lg:     lg,
+		srv:    srv,
+		checks: make(map[string][]CheckFunc),
+		status: make(map[string]healthpb.HealthCheckResponse_ServingStatus),
+	}
+}
+
+// `Server()` returns the health server, which can be registered with several
+// gRPC servers.
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.srv
+}
+
+func (c *Checker) Register(gsrv *grpc.Server) {
+	healthpb.RegisterHealthServer(gsrv, c.srv)
+}
+
+// `AddCheck()` adds a check for `service`, which is usually a full gRPC
+// service name, like `nogfso.Registry`.  The service is `NOT_SERVING` until
+// the next `Check()`.
+func (c *Checker) AddCheck(service string, fn CheckFunc) {
+	if service == "" {
+		panic("empty service name")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[service] = append(c.checks[service], fn)
+	if _, ok := c.status[service]; !ok {
+		c.status[service] = healthpb.HealthCheckResponse_NOT_SERVING
+		c.srv.SetServingStatus(
+			service, healthpb.HealthCheckResponse_NOT_SERVING,
+		)
+	}
+}
+
+// `Check()` runs all checks once and updates the health server.
+func (c *Checker) Check(ctx context.Context) {
+	c.mu.Lock()
+	services := make([]string, 0, len(c.checks))
+	checks := make(map[string][]CheckFunc, len(c.checks))
+	for s, fns := range c.checks {
+		services = append(services, s)
+		checks[s] = append([]CheckFunc(nil), fns...)
+	}
+	c.mu.Unlock()
+	sort.Strings(services)
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	for _, s := range services {
+		st := healthpb.HealthCheckResponse_SERVING
+		err := runChecks(ctx, checks[s])
+		if err != nil {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+			overall = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		c.setStatus(s, st, err)
+	}
+	c.setStatus("", overall, nil)
+}
+
+func runChecks(ctx context.Context, fns []CheckFunc) error {
+	for _, fn := range fns {
+		ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+		err := fn(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checker) setStatus(
+	service string,
+	st healthpb.HealthCheckResponse_ServingStatus,
+	err error,
+) {
+	c.mu.Lock()
+	old, ok := c.status[service]
+	c.status[service] = st
+	c.mu.Unlock()
+
+	c.srv.SetServingStatus(service, st)
+	if ok && old == st {
+		return
+	}
+	if st == healthpb.HealthCheckResponse_SERVING {
+		c.lg.Infow(
+			"Health status changed.",
+			"module", "grpchealth",
+			"service", service,
+			"status", st.String(),
+		)
+	} else {
+		kv := []interface{}{
+			"module", "grpchealth",
+			"service", service,
+			"status", st.String(),
+		}
+		if err != nil {
+			kv = append(kv, "err", err)
+		}
+		c.lg.Warnw("Health status changed.", kv...)
+	}
+}
+
+// `Run()` checks at regular intervals until `ctx` is cancelled.  It then
+// marks all services as `NOT_SERVING`, so that clients stop using the
+// server during graceful shutdown.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) error {
+	c.Check(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.srv.Shutdown()
+			return ctx.Err()
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// `Liveness` tracks whether a long-running function, like a processor loop,
+// is running.
+type Liveness struct {
+	running int32 // atomic
+	name    string
+}
+
+func NewLiveness(name string) *Liveness {
+	return &Liveness{name: name}
+}
+
+// `Run()` calls `fn` and reports the liveness as running until `fn` returns.
+func (l *Liveness) Run(fn func() error) error {
+	atomic.StoreInt32(&l.running, 1)
+	defer atomic.StoreInt32(&l.running, 0)
+	return fn()
+}
+
+// `Check()` is a `CheckFunc`.
+func (l *Liveness) Check(ctx context.Context) error {
+	if atomic.LoadInt32(&l.running) == 0 {
+		return fmt.Errorf("%s is not running", l.name)
+	}
+	return nil
+}
+
+// `ConnCheck()` returns a `CheckFunc` that fails if `conn` is in transient
+// failure or shut down.
+func ConnCheck(name string, conn *grpc.ClientConn) CheckFunc {
+	return func(ctx context.Context) error {
+		switch st := conn.GetState(); st {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("%s connection %s", name, st)
+		default:
+			return nil
+		}
+	}
+}
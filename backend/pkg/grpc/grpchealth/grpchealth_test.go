@@ -0,0 +1,118 @@
+package grpchealth_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/grpc/grpchealth"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{}) {}
+func (nullLogger) Warnw(msg string, kv ...interface{}) {}
+
+func getStatus(
+	t *testing.T, c *grpchealth.Checker, service string,
+) healthpb.HealthCheckResponse_ServingStatus {
+	o, err := c.Server().Check(
+		context.Background(),
+		&healthpb.HealthCheckRequest{Service: service},
+	)
+	if err != nil {
+		t.Fatalf("Check(%q) failed: %v", service, err)
+	}
+	return o.Status
+}
+
+func TestChecker(t *testing.T) {
+	const serving = healthpb.HealthCheckResponse_SERVING
+	const notServing = healthpb.HealthCheckResponse_NOT_SERVING
+
+	c := grpchealth.New(nullLogger{})
+	var failB error
+	c.AddCheck("a", func(ctx context.Context) error { return nil })
+	c.AddCheck("b", func(ctx context.Context) error { return failB })
+
+	if s := getStatus(t, c, ""); s != notServing {
+		t.Errorf("expected overall NOT_SERVING before check, got %s", s)
+	}
+	if s := getStatus(t, c, "a"); s != notServing {
+		t.Errorf("expected a NOT_SERVING before check, got %s", s)
+	}
+
+	c.Check(context.Background())
+	for _, svc := range []string{"", "a", "b"} {
+		if s := getStatus(t, c, svc); s != serving {
+			t.Errorf("expected %q SERVING, got %s", svc, s)
+		}
+	}
+
+	failB = errors.New("b failed")
+	c.Check(context.Background())
+	if s := getStatus(t, c, "a"); s != serving {
+		t.Errorf("expected a SERVING, got %s", s)
+	}
+	if s := getStatus(t, c, "b"); s != notServing {
+		t.Errorf("expected b NOT_SERVING, got %s", s)
+	}
+	if s := getStatus(t, c, ""); s != notServing {
+		t.Errorf("expected overall NOT_SERVING, got %s", s)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	l := grpchealth.NewLiveness("proc")
+	if err := l.Check(context.Background()); err == nil {
+		t.Error("expected error before run")
+	}
+	_ = l.Run(func() error {
+		if err := l.Check(context.Background()); err != nil {
+			t.Errorf("unexpected error while running: %v", err)
+		}
+		return nil
+	})
+	if err := l.Check(context.Background()); err == nil {
+		t.Error("expected error after run")
+	}
+}
+
+func TestServe(t *testing.T) {
+	c := grpchealth.New(nullLogger{})
+	c.AddCheck("a", func(ctx context.Context) error { return nil })
+	c.Check(context.Background())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- grpchealth.Serve(ctx, lis, c)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	o, err := healthpb.NewHealthClient(conn).Check(
+		context.Background(), &healthpb.HealthCheckRequest{Service: "a"},
+	)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	if o.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %s", o.Status)
+	}
+
+	cancel()
+	if err := <-served; err != context.Canceled {
+		t.Errorf("expected Serve() to return Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package grpchealth
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// `ServerShutdownTimeout` limits the graceful stop in `Serve()`.
+var ServerShutdownTimeout = 5 * time.Second
+
+// `Serve()` serves only the health service of `c` on `lis` until `ctx` is
+// cancelled.  It is for daemons that do not serve other gRPCs.
+func Serve(
+	ctx context.Context,
+	lis net.Listener,
+	c *Checker,
+	opts ...grpc.ServerOption,
+) error {
+	gsrv := grpc.NewServer(opts...)
+	c.Register(gsrv)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopped := make(chan struct{})
+			go func() {
+				gsrv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(ServerShutdownTimeout):
+				gsrv.Stop()
+			}
+		case <-done:
+		}
+	}()
+
+	err := gsrv.Serve(lis)
+	close(done)
+	if err == nil || err == grpc.ErrServerStopped {
+		return ctx.Err()
+	}
+	return err
+}
+
+// `StartServer()` listens on `addr` and then runs `Serve()` in a goroutine
+// that is tracked by `wg`.  It returns listen errors, so that daemons can fail
+// during startup.  Later server errors are only logged.
+func StartServer(
+	ctx context.Context,
+	lg Logger,
+	wg *sync.WaitGroup,
+	addr string,
+	c *Checker,
+	opts ...grpc.ServerOption,
+) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	lg.Infow("Health listening.", "addr", addr)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := Serve(ctx, lis, c, opts...)
+		if err != context.Canceled {
+			lg.Warnw("Health server failed.", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package `grpcmetrics` provides gRPC interceptors that count calls and
+// observe latencies per method and status code with package `metrics`.
+package grpcmetrics
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	serverHandled = metrics.NewCounterVec(
+		"nogfso_grpc_server_handled_total",
+		"Number of gRPCs completed by the server.",
+		"method", "code",
+	)
+	serverSeconds = metrics.NewHistogramVec(
+		"nogfso_grpc_server_handling_seconds",
+		"Duration of gRPCs handled by the server.",
+		metrics.DefBuckets,
+		"method",
+	)
+	clientHandled = metrics.NewCounterVec(
+		"nogfso_grpc_client_handled_total",
+		"Number of gRPCs completed by the client.",
+		"method", "code",
+	)
+	clientSeconds = metrics.NewHistogramVec(
+		"nogfso_grpc_client_handling_seconds",
+		"Duration of gRPCs as seen by the client.",
+		metrics.DefBuckets,
+		"method",
+	)
+)
+
+// `Server` instruments a gRPC server; see `grpcchain.ServerOptions()`.
+var Server = grpcchain.Server{
+	Unary:  UnaryServerInterceptor,
+	Stream: StreamServerInterceptor,
+}
+
+// `Client` instruments a gRPC client; see `grpcchain.DialOptions()`.
+var Client = grpcchain.Client{
+	Unary:  UnaryClientInterceptor,
+	Stream: StreamClientInterceptor,
+}
+
+func observeServer(method string, start time.Time, err error) {
+	serverSeconds.With(method).ObserveSince(start)
+	serverHandled.With(method, status.Code(err).String()).Inc()
+}
+
+func observeClient(method string, start time.Time, err error) {
+	clientSeconds.With(method).ObserveSince(start)
+	clientHandled.With(method, status.Code(err).String()).Inc()
+}
+
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	observeServer(info.FullMethod, start, err)
+	return res, err
+}
+
+// `StreamServerInterceptor()` observes the duration of the entire stream.
+func StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeServer(info.FullMethod, start, err)
+	return err
+}
+
+func UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	observeClient(method, start, err)
+	return err
+}
+
+// `StreamClientInterceptor()` observes the stream when `RecvMsg()` returns
+// an error, which is `io.EOF` at the regular end of the stream.
+func StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	start := time.Now()
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		observeClient(method, start, err)
+		return nil, err
+	}
+	return &clientStream{
+		ClientStream: cs,
+		method:       method,
+		start:        start,
+	}, nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	method string
+	start  time.Time
+	done   sync.Once
+}
+
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err != nil {
+		cs.done.Do(func() {
+			if err == io.EOF {
+				observeClient(cs.method, cs.start, nil)
+			} else {
+				observeClient(cs.method, cs.start, err)
+			}
+		})
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package grpcratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"google.golang.org/grpc"
+)
+
+var (
+	// `MaxRetries` limits how often the client retries a call.
+	MaxRetries = 5
+	// `MaxRetryDelay` limits the delay between retries, in case the
+	// server sends unreasonable hints.
+	MaxRetryDelay = 1 * time.Minute
+	// `DefaultRetryDelay` is used if the server sends no retry hint.
+	DefaultRetryDelay = 1 * time.Second
+)
+
+// `Client` retries calls that the server rejected with `ResourceExhausted`
+// after the server's retry hint.  Server-streaming calls are retried if the
+// server rejects them before sending the first message.
+var Client = grpcchain.Client{
+	Unary:  UnaryClientInterceptor,
+	Stream: StreamClientInterceptor,
+}
+
+// `backoff()` waits before retry `attempt` and reports whether to retry.
+func backoff(ctx context.Context, attempt int, err error) bool {
+	if attempt >= MaxRetries {
+		return false
+	}
+	delay, ok := RetryDelay(err)
+	if !ok {
+		return false
+	}
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	if dl, ok := ctx.Deadline(); ok && time.Until(dl) < delay {
+		return false
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	for attempt := 0; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || !backoff(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+func StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	// Only server-streaming calls send a single request, which can be
+	// replayed.
+	if desc.ClientStreams || !desc.ServerStreams {
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &clientStream{
+		ClientStream: cs,
+		ctx:          ctx,
+		newStream: func() (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, opts...)
+		},
+	}, nil
+}
+
+// `clientStream` remembers the request, so that it can restart the call if
+// the first `RecvMsg()` fails with `ResourceExhausted`.
+type clientStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	newStream func() (grpc.ClientStream, error)
+	req       interface{}
+	closed    bool
+	received  bool
+	attempt   int
+}
+
+func (cs *clientStream) SendMsg(m interface{}) error {
+	cs.req = m
+	return cs.ClientStream.SendMsg(m)
+}
+
+func (cs *clientStream) CloseSend() error {
+	cs.closed = true
+	return cs.ClientStream.CloseSend()
+}
+
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	for {
+		err := cs.ClientStream.RecvMsg(m)
+		if err == nil {
+			cs.received = true
+			return nil
+		}
+		if cs.received || cs.req == nil {
+			return err
+		}
+		if !backoff(cs.ctx, cs.attempt, err) {
+			return err
+		}
+		cs.attempt++
+		if rerr := cs.restart(); rerr != nil {
+			return rerr
+		}
+	}
+}
+
+func (cs *clientStream) restart() error {
+	s, err := cs.newStream()
+	if err != nil {
+		return err
+	}
+	if err := s.SendMsg(cs.req); err != nil {
+		return err
+	}
+	if cs.closed {
+		if err := s.CloseSend(); err != nil {
+			return err
+		}
+	}
+	cs.ClientStream = s
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package `grpcratelimit` provides a gRPC server interceptor that limits the
+// request rate and the number of concurrent streams per identity and method,
+// and a client interceptor that backs off when the server rejects a call.
+//
+// The server rejects calls with `ResourceExhausted` and a
+// `google.rpc.RetryInfo` detail that tells the client when to retry.  The
+// client interceptor waits for the retry delay and retries a few times; see
+// `Client`.
+//
+// Limits are keyed on the JWT subject of the authenticated `auth.Identity`
+// and the full method name.  The interceptor authenticates the call itself,
+// since it runs before the handler.  Calls that fail to authenticate are
+// keyed on the peer address; the handler rejects them later.
+package grpcratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/metrics"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var rejected = metrics.NewCounterVec(
+	"nogfso_grpc_server_ratelimited_total",
+	"Number of gRPCs that the server rejected due to rate limits.",
+	"method", "limit",
+)
+
+var ErrInvalidConfig = errors.New("invalid rate limit config")
+
+// `StreamRetryDelay` is the retry hint if the concurrent stream limit is
+// exceeded.
+var StreamRetryDelay = 1 * time.Second
+
+// `IdleTimeout` is the time after which unused limiter state is removed.
+var IdleTimeout = 10 * time.Minute
+
+// `Config` is a list of rules.  The first rule whose `methods` and `subjects`
+// match a call applies.  Calls that match no rule are not limited.  Example
+// YAML:
+//
+//	rules:
+//	  - subjects: [nogfsostad-*, nogappd]
+//	  - methods: [/nogfso.Registry/GetRepos, /nogfso.Registry/InitRepo]
+//	    rate: 2
+//	    burst: 10
+//	  - methods: [/nogfso.*/Events]
+//	    streams: 5
+//	  - rate: 20
+//	    burst: 50
+//	    streams: 20
+//
+// `methods` and `subjects` are globs: `*` matches anything, and a trailing
+// `*` matches a prefix; a `*` inside a method matches a service name.  Empty
+// lists match any method or subject.  `rate` is the number of calls per
+// second, and `burst` the number of calls that may exceed it at once,
+// default `rate` rounded up.  `streams` is the number of concurrent streams.
+// Zero means unlimited; the first rule in the example exempts system users.
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type Rule struct {
+	Methods  []string `yaml:"methods"`
+	Subjects []string `yaml:"subjects"`
+	Rate     float64  `yaml:"rate"`
+	Burst    int      `yaml:"burst"`
+	Streams  int      `yaml:"streams"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", ErrInvalidConfig, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) Validate() error {
+	for i, r := range cfg.Rules {
+		if r.Rate < 0 || r.Burst < 0 || r.Streams < 0 {
+			return fmt.Errorf(
+				"%s: rule %d: negative limit", ErrInvalidConfig, i,
+			)
+		}
+		if r.Burst > 0 && r.Rate == 0 {
+			return fmt.Errorf(
+				"%s: rule %d: burst requires rate",
+				ErrInvalidConfig, i,
+			)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	b := int(r.Rate)
+	if float64(b) < r.Rate {
+		b++
+	}
+	return b
+}
+
+func (cfg *Config) match(method, subject string) *Rule {
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if len(r.Methods) > 0 && !globsMatch(r.Methods, method) {
+			continue
+		}
+		if len(r.Subjects) > 0 && !globsMatch(r.Subjects, subject) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func globsMatch(globs []string, s string) bool {
+	for _, g := range globs {
+		if globMatches(g, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// `globMatches()` supports `*` as the last character, like scope globs, and
+// a single `*` before a slash, like `/nogfso.*/Events`.
+func globMatches(g, s string) bool {
+	if k := strings.Index(g, "*/"); k >= 0 {
+		if !strings.HasPrefix(s, g[:k]) {
+			return false
+		}
+		rest := s[k:]
+		slash := strings.Index(rest, "/")
+		if slash < 0 {
+			return false
+		}
+		return globMatches(g[k+1:], rest[slash:])
+	}
+	switch {
+	case g == "*":
+		return true
+	case strings.HasSuffix(g, "*"):
+		return strings.HasPrefix(s, g[:len(g)-1])
+	default:
+		return s == g
+	}
+}
+
+type entry struct {
+	limiter  *rate.Limiter
+	streams  int
+	lastUsed time.Time
+}
+
+// `Limiter` holds the per-identity and per-method state.
+type Limiter struct {
+	authn auth.Authenticator
+
+	mu        sync.Mutex
+	cfg       *Config
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+func New(authn auth.Authenticator, cfg *Config) *Limiter {
+	return &Limiter{
+		authn:     authn,
+		cfg:       cfg,
+		entries:   make(map[string]*entry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *Limiter) Server() grpcchain.Server {
+	return grpcchain.Server{
+		Unary:  l.unaryServerInterceptor,
+		Stream: l.streamServerInterceptor,
+	}
+}
+
+func (l *Limiter) subject(ctx context.Context) (subject, key string) {
+	if euid, err := l.authn.Authenticate(ctx); err == nil {
+		if sub, ok := euid["subject"].(string); ok && sub != "" {
+			return sub, "sub:" + sub
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "", "peer:" + host
+	}
+	return "", "anonymous"
+}
+
+// `acquire()` returns a release function that must be called when a stream
+// ends, or an error with retry hint.
+func (l *Limiter) acquire(
+	ctx context.Context, method string, isStream bool,
+) (func(), error) {
+	subject, key := l.subject(ctx)
+	key = key + "\x00" + method
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.cfg.match(method, subject)
+	if r == nil {
+		return func() {}, nil
+	}
+
+	l.sweep(now)
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{}
+		if r.Rate > 0 {
+			e.limiter = rate.NewLimiter(rate.Limit(r.Rate), r.burst())
+		}
+		l.entries[key] = e
+	}
+	e.lastUsed = now
+
+	if isStream && r.Streams > 0 && e.streams >= r.Streams {
+		rejected.With(method, "streams").Inc()
+		return nil, exhausted(
+			StreamRetryDelay,
+			"too many concurrent streams for %s, max %d",
+			method, r.Streams,
+		)
+	}
+
+	if e.limiter != nil {
+		res := e.limiter.ReserveN(now, 1)
+		if d := res.DelayFrom(now); d > 0 {
+			res.CancelAt(now)
+			rejected.With(method, "rate").Inc()
+			return nil, exhausted(
+				d, "rate limit exceeded for %s", method,
+			)
+		}
+	}
+
+	if !isStream || r.Streams == 0 {
+		return func() {}, nil
+	}
+	e.streams++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			e.streams--
+			e.lastUsed = time.Now()
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// `sweep()` removes idle entries at most once per `IdleTimeout`.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < IdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for k, e := range l.entries {
+		if e.streams == 0 && now.Sub(e.lastUsed) > IdleTimeout {
+			delete(l.entries, k)
+		}
+	}
+}
+
+func exhausted(
+	retry time.Duration, format string, args ...interface{},
+) error {
+	msg := fmt.Sprintf(format, args...)
+	msg = fmt.Sprintf("%s; retry after %s", msg, retry.Round(time.Millisecond))
+	st := status.New(codes.ResourceExhausted, msg)
+	withRetry, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(retry),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withRetry.Err()
+}
+
+// `RetryDelay()` returns the retry hint of a `ResourceExhausted` error.
+func RetryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.RetryInfo)
+		if !ok || info.RetryDelay == nil {
+			continue
+		}
+		delay, err := ptypes.Duration(info.RetryDelay)
+		if err != nil {
+			continue
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func (l *Limiter) unaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	release, err := l.acquire(ctx, info.FullMethod, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+func (l *Limiter) streamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	release, err := l.acquire(ss.Context(), info.FullMethod, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
@@ -0,0 +1,115 @@
+package grpcratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/auth"
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type subjectKey struct{}
+
+type ctxAuthn struct{}
+
+func (ctxAuthn) Authenticate(ctx context.Context) (auth.Identity, error) {
+	sub, _ := ctx.Value(subjectKey{}).(string)
+	return auth.Identity{"subject": sub}, nil
+}
+
+func withSubject(sub string) context.Context {
+	return context.WithValue(context.Background(), subjectKey{}, sub)
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func TestUnaryRateLimit(t *testing.T) {
+	lim := grpcratelimit.New(ctxAuthn{}, &grpcratelimit.Config{
+		Rules: []grpcratelimit.Rule{
+			{Subjects: []string{"sys-*"}},
+			{Methods: []string{"/nogfso.Registry/*"}, Rate: 1, Burst: 2},
+		},
+	})
+	unary := lim.Server().Unary
+	info := &grpc.UnaryServerInfo{FullMethod: "/nogfso.Registry/GetRepos"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(sub string) error {
+		_, err := unary(withSubject(sub), nil, info, handler)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("alice"); err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+	}
+	err := call("alice")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	d, ok := grpcratelimit.RetryDelay(err)
+	if !ok || d <= 0 || d > time.Second {
+		t.Errorf("unexpected retry delay %v, %v", d, ok)
+	}
+
+	if err := call("bob"); err != nil {
+		t.Errorf("other subject limited: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := call("sys-stad"); err != nil {
+			t.Fatalf("exempt subject limited: %v", err)
+		}
+	}
+}
+
+func TestStreamLimit(t *testing.T) {
+	lim := grpcratelimit.New(ctxAuthn{}, &grpcratelimit.Config{
+		Rules: []grpcratelimit.Rule{
+			{Methods: []string{"/nogfso.*/Events"}, Streams: 1},
+		},
+	})
+	stream := lim.Server().Stream
+	info := &grpc.StreamServerInfo{FullMethod: "/nogfso.Repos/Events"}
+	ss := &fakeStream{ctx: withSubject("alice")}
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		_ = stream(nil, ss, info, func(interface{}, grpc.ServerStream) error {
+			close(started)
+			<-done
+			return nil
+		})
+	}()
+	<-started
+
+	nop := func(interface{}, grpc.ServerStream) error { return nil }
+	err := stream(nil, ss, info, nop)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+
+	close(done)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = stream(nil, ss, info, nop)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("stream still limited after release: %v", err)
+	}
+}
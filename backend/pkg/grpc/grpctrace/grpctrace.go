@@ -0,0 +1,214 @@
+// Package `grpctrace` provides gRPC interceptors that propagate the trace
+// context of package `trace` in the metadata `traceparent` and record a span
+// for each call.
+//
+// Server spans are tagged with nogfso ids from the request and the response,
+// specifically workflow, repo, and event ids, so that spans can be found by
+// the ids that appear in logs.
+package grpctrace
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/nogproject/nog/backend/pkg/grpc/grpcchain"
+	"github.com/nogproject/nog/backend/pkg/trace"
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const MetadataKey = "traceparent"
+
+var Server = grpcchain.Server{
+	Unary:  UnaryServerInterceptor,
+	Stream: StreamServerInterceptor,
+}
+
+var Client = grpcchain.Client{
+	Unary:  UnaryClientInterceptor,
+	Stream: StreamClientInterceptor,
+}
+
+// `Extract()` returns a context that continues the trace from the incoming
+// metadata.
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	vs := md.Get(MetadataKey)
+	if len(vs) == 0 {
+		return ctx
+	}
+	sc, err := trace.ParseTraceparent(vs[0])
+	if err != nil {
+		return ctx
+	}
+	return trace.WithRemote(ctx, sc)
+}
+
+// `Inject()` sets the outgoing metadata `traceparent` to the current span,
+// replacing a previous value, for example one that has been copied from the
+// incoming metadata.
+func Inject(ctx context.Context) context.Context {
+	sc, ok := trace.SpanContextFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	md.Set(MetadataKey, sc.Traceparent())
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, span := trace.Start(Extract(ctx), info.FullMethod, trace.KindServer)
+	setIdAttrs(span, req)
+	res, err := handler(ctx, req)
+	setIdAttrs(span, res)
+	span.SetError(err)
+	span.End()
+	return res, err
+}
+
+func StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, span := trace.Start(
+		Extract(ss.Context()), info.FullMethod, trace.KindServer,
+	)
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	span.SetError(err)
+	span.End()
+	return err
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) RecvMsg(m interface{}) error {
+	err := ss.ServerStream.RecvMsg(m)
+	if err == nil {
+		setIdAttrs(trace.FromContext(ss.ctx), m)
+	}
+	return err
+}
+
+func UnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ctx, span := trace.Start(ctx, method, trace.KindClient)
+	err := invoker(Inject(ctx), method, req, reply, cc, opts...)
+	span.SetError(err)
+	span.End()
+	return err
+}
+
+// `StreamClientInterceptor()` ends the span when `RecvMsg()` returns an
+// error, which is `io.EOF` at the regular end of the stream.
+func StreamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	ctx, span := trace.Start(ctx, method, trace.KindClient)
+	cs, err := streamer(Inject(ctx), desc, cc, method, opts...)
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return nil, err
+	}
+	return &clientStream{ClientStream: cs, span: span}, nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	span *trace.Span
+	done sync.Once
+}
+
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err != nil {
+		cs.done.Do(func() {
+			if err != io.EOF {
+				cs.span.SetError(err)
+			}
+			cs.span.End()
+		})
+	}
+	return err
+}
+
+// Getters of generated protobuf messages.
+type (
+	workflowGetter    interface{ GetWorkflow() []byte }
+	repoGetter        interface{ GetRepo() []byte }
+	vidGetter         interface{ GetVid() []byte }
+	workflowVidGetter interface{ GetWorkflowVid() []byte }
+)
+
+func setIdAttrs(span *trace.Span, m interface{}) {
+	if span == nil || m == nil {
+		return
+	}
+	if g, ok := m.(workflowGetter); ok {
+		setUUIDAttr(span, "nogfso.workflow", g.GetWorkflow())
+	}
+	if g, ok := m.(repoGetter); ok {
+		setUUIDAttr(span, "nogfso.repo", g.GetRepo())
+	}
+	if g, ok := m.(vidGetter); ok {
+		setULIDAttr(span, "nogfso.vid", g.GetVid())
+	}
+	if g, ok := m.(workflowVidGetter); ok {
+		setULIDAttr(span, "nogfso.workflow_vid", g.GetWorkflowVid())
+	}
+}
+
+func setUUIDAttr(span *trace.Span, k string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if id, err := uuid.FromBytes(b); err == nil {
+		span.SetAttr(k, id.String())
+	}
+}
+
+func setULIDAttr(span *trace.Span, k string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if id, err := ulid.ParseBytes(b); err == nil {
+		span.SetAttr(k, id.String())
+	}
+}
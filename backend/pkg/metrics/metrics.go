@@ -0,0 +1,201 @@
+// Package `metrics` implements counters, gauges, and histograms that are
+// exposed in the Prometheus text format.
+//
+// Metrics are usually declared as package variables, which register with
+// `DefaultRegistry`:
+//
+//     var opsTotal = metrics.NewCounterVec(
+//         "nogfso_ops_total", "Number of operations.", "op", "result",
+//     )
+//
+//     opsTotal.With("stat", "ok").Inc()
+//
+// `Handler()` serves `DefaultRegistry` via HTTP.  The package avoids the
+// dependency on the Prometheus client library, since the daemons only need
+// the basic metric types.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// `DefBuckets` are the default histogram buckets in seconds, suitable for
+// RPC latencies.
+var DefBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// `LongBuckets` are histogram buckets in seconds for operations that may take
+// minutes, like `git-fso stat`.
+var LongBuckets = []float64{
+	0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600,
+}
+
+type collector interface {
+	metricName() string
+	writeTo(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// `register()` panics if the name is already registered, like the usual
+// registration of package variables during init.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := c.metricName()
+	if _, ok := r.collectors[name]; ok {
+		panic(fmt.Sprintf("duplicate metric `%s`", name))
+	}
+	r.collectors[name] = c
+}
+
+// `WriteText()` writes all metrics sorted by name in the Prometheus text
+// format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	cs := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		cs = append(cs, r.collectors[name])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.writeTo(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(
+			"Content-Type", "text/plain; version=0.0.4; charset=utf-8",
+		)
+		_ = r.WriteText(w)
+	})
+}
+
+// `Handler()` serves `DefaultRegistry`.
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// `desc` contains the common parts of all metric vectors.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) metricName() string {
+	return d.name
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+func (d *desc) checkValues(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf(
+			"metric `%s` expects %d label values, got %d",
+			d.name, len(d.labels), len(values),
+		))
+	}
+}
+
+// `key()` joins label values with a separator that cannot appear in UTF-8.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	sep := ""
+	for i, n := range names {
+		b.WriteString(sep)
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+		sep = ","
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		b.WriteString(sep)
+		b.WriteString(extra[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(extra[i+1]))
+		b.WriteByte('"')
+		sep = ","
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(
+	`\`, `\\`, `"`, `\"`, "\n", `\n`,
+)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// `sortedKeys()` returns the keys of `m` in a stable order for output.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+	ops := r.NewCounterVec("test_ops_total", "Ops.", "op")
+	lat := r.NewHistogramVec(
+		"test_seconds", "Latency.", []float64{0.1, 1}, "op",
+	)
+	up := r.NewGaugeVec("test_up", "Up.")
+
+	ops.With("b").Inc()
+	ops.With(`a"x`).Add(2)
+	lat.With("a").Observe(0.05)
+	lat.With("a").Observe(0.5)
+	lat.With("a").Observe(5)
+	up.With().Set(1)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_ops_total Ops.
+# TYPE test_ops_total counter
+test_ops_total{op="a\"x"} 2
+test_ops_total{op="b"} 1
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="a",le="0.1"} 1
+test_seconds_bucket{op="a",le="1"} 2
+test_seconds_bucket{op="a",le="+Inf"} 3
+test_seconds_sum{op="a"} 5.55
+test_seconds_count{op="a"} 3
+# HELP test_up Up.
+# TYPE test_up gauge
+test_up 1
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestDuplicateNamePanics(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewCounterVec("test_total", "Test.")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	r.NewGaugeVec("test_total", "Test.")
+}
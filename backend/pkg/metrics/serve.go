@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+var startTime = time.Now()
+
+var _ = NewGaugeFunc(
+	"process_start_time_seconds",
+	"Start time of the process since the Unix epoch in seconds.",
+	func() float64 {
+		return float64(startTime.UnixNano()) / 1e9
+	},
+)
+
+var _ = NewGaugeFunc(
+	"go_goroutines",
+	"Number of goroutines that currently exist.",
+	func() float64 {
+		return float64(runtime.NumGoroutine())
+	},
+)
+
+// `Serve()` serves `DefaultRegistry` at `/metrics` on `lis` until `ctx` is
+// cancelled.
+func Serve(ctx context.Context, lis net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Handler: mux}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			ctx2, cancel := context.WithTimeout(
+				context.Background(), 5*time.Second,
+			)
+			_ = srv.Shutdown(ctx2)
+			cancel()
+		case <-done:
+		}
+	}()
+
+	err := srv.Serve(lis)
+	close(done)
+	if err == http.ErrServerClosed {
+		return ctx.Err()
+	}
+	return err
+}
+
+// `StartServer()` listens on `addr` and then runs `Serve()` in a goroutine
+// that is tracked by `wg`.  It returns listen errors, so that daemons can fail
+// during startup.  Later server errors are only logged.
+func StartServer(
+	ctx context.Context, lg Logger, wg *sync.WaitGroup, addr string,
+) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	lg.Infow("Metrics listening.", "addr", addr)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := Serve(ctx, lis)
+		if err != context.Canceled {
+			lg.Errorw("Metrics server failed.", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,329 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// `atomicFloat` is a float64 that is updated with compare-and-swap.
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		nu := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, nu) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// `vec` manages the children of a metric vector by label values.
+type vec struct {
+	desc
+	mu       sync.Mutex
+	values   map[string][]string
+	children map[string]interface{}
+	newChild func() interface{}
+}
+
+func (v *vec) with(values []string) interface{} {
+	v.checkValues(values)
+	k := key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[k]
+	if !ok {
+		c = v.newChild()
+		v.children[k] = c
+		v.values[k] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *vec) delete(values []string) {
+	v.checkValues(values)
+	k := key(values)
+	v.mu.Lock()
+	delete(v.children, k)
+	delete(v.values, k)
+	v.mu.Unlock()
+}
+
+// `each()` calls `fn` for the children in a stable order.
+func (v *vec) each(fn func(values []string, child interface{})) {
+	v.mu.Lock()
+	keys := sortedKeys(v.values)
+	values := make([][]string, len(keys))
+	children := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = v.values[k]
+		children[i] = v.children[k]
+	}
+	v.mu.Unlock()
+	for i := range keys {
+		fn(values[i], children[i])
+	}
+}
+
+func newVec(
+	name, help, typ string, labels []string, newChild func() interface{},
+) vec {
+	return vec{
+		desc: desc{
+			name:   name,
+			help:   help,
+			typ:    typ,
+			labels: labels,
+		},
+		values:   make(map[string][]string),
+		children: make(map[string]interface{}),
+		newChild: newChild,
+	}
+}
+
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// `Add()` panics if `v` is negative, since counters only increase.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+	c.v.add(v)
+}
+
+type CounterVec struct {
+	vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+func (r *Registry) NewCounterVec(
+	name, help string, labels ...string,
+) *CounterVec {
+	cv := &CounterVec{
+		vec: newVec(name, help, "counter", labels, func() interface{} {
+			return &Counter{}
+		}),
+	}
+	r.register(cv)
+	return cv
+}
+
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values).(*Counter)
+}
+
+func (cv *CounterVec) writeTo(w *bufio.Writer) {
+	cv.writeHeader(w)
+	cv.each(func(values []string, child interface{}) {
+		fmt.Fprintf(
+			w, "%s%s %s\n",
+			cv.name, formatLabels(cv.labels, values),
+			formatFloat(child.(*Counter).v.get()),
+		)
+	})
+}
+
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.v.add(v)
+}
+
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labels...)
+}
+
+func (r *Registry) NewGaugeVec(
+	name, help string, labels ...string,
+) *GaugeVec {
+	gv := &GaugeVec{
+		vec: newVec(name, help, "gauge", labels, func() interface{} {
+			return &Gauge{}
+		}),
+	}
+	r.register(gv)
+	return gv
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.with(values).(*Gauge)
+}
+
+// `Delete()` removes the gauge for the label values, so that it is no longer
+// reported.
+func (gv *GaugeVec) Delete(values ...string) {
+	gv.delete(values)
+}
+
+func (gv *GaugeVec) writeTo(w *bufio.Writer) {
+	gv.writeHeader(w)
+	gv.each(func(values []string, child interface{}) {
+		fmt.Fprintf(
+			w, "%s%s %s\n",
+			gv.name, formatLabels(gv.labels, values),
+			formatFloat(child.(*Gauge).v.get()),
+		)
+	})
+}
+
+// `GaugeFunc` reports the value of a function at collection time.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return DefaultRegistry.NewGaugeFunc(name, help, fn)
+}
+
+func (r *Registry) NewGaugeFunc(
+	name, help string, fn func() float64,
+) *GaugeFunc {
+	gf := &GaugeFunc{
+		desc: desc{name: name, help: help, typ: "gauge"},
+		fn:   fn,
+	}
+	r.register(gf)
+	return gf
+}
+
+func (gf *GaugeFunc) writeTo(w *bufio.Writer) {
+	gf.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", gf.name, formatFloat(gf.fn()))
+}
+
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// `ObserveSince()` observes the duration since `start` in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func NewHistogramVec(
+	name, help string, buckets []float64, labels ...string,
+) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+func (r *Registry) NewHistogramVec(
+	name, help string, buckets []float64, labels ...string,
+) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("histogram buckets must be sorted")
+	}
+	hv := &HistogramVec{buckets: buckets}
+	hv.vec = newVec(name, help, "histogram", labels, func() interface{} {
+		return &Histogram{
+			buckets: hv.buckets,
+			counts:  make([]uint64, len(hv.buckets)),
+		}
+	})
+	r.register(hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values).(*Histogram)
+}
+
+func (hv *HistogramVec) writeTo(w *bufio.Writer) {
+	hv.writeHeader(w)
+	hv.each(func(values []string, child interface{}) {
+		h := child.(*Histogram)
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		count := h.count
+		sum := h.sum
+		h.mu.Unlock()
+
+		var cum uint64
+		for i, le := range hv.buckets {
+			cum += counts[i]
+			fmt.Fprintf(
+				w, "%s_bucket%s %d\n", hv.name,
+				formatLabels(hv.labels, values,
+					"le", formatFloat(le),
+				),
+				cum,
+			)
+		}
+		fmt.Fprintf(
+			w, "%s_bucket%s %d\n", hv.name,
+			formatLabels(hv.labels, values, "le", "+Inf"),
+			count,
+		)
+		fmt.Fprintf(
+			w, "%s_sum%s %s\n", hv.name,
+			formatLabels(hv.labels, values), formatFloat(sum),
+		)
+		fmt.Fprintf(
+			w, "%s_count%s %d\n", hv.name,
+			formatLabels(hv.labels, values), count,
+		)
+	})
+}
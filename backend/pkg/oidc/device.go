@@ -0,0 +1,165 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrNoDeviceEndpoint = errors.New(
+	"provider has no device authorization endpoint",
+)
+
+// `DeviceAuthorization` is the response of the device authorization endpoint.
+// The user must visit `VerificationURI` and enter `UserCode`, or visit
+// `VerificationURIComplete` if present.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+}
+
+// `TokenError` is an OAuth 2.0 error response, RFC 6749 section 5.2.
+type TokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *TokenError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// `DefaultPollInterval` is used if the provider does not specify one.
+const DefaultPollInterval = 5 * time.Second
+
+func StartDeviceAuthorization(
+	ctx context.Context,
+	client *http.Client,
+	p *Provider,
+	clientId string,
+	scopes []string,
+) (*DeviceAuthorization, error) {
+	if p.DeviceAuthorizationEndpoint == "" {
+		return nil, ErrNoDeviceEndpoint
+	}
+	form := url.Values{
+		"client_id": {clientId},
+	}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	var da DeviceAuthorization
+	err := postForm(ctx, client, p.DeviceAuthorizationEndpoint, form, &da)
+	if err != nil {
+		return nil, err
+	}
+	return &da, nil
+}
+
+// `PollDeviceToken()` polls the token endpoint until the user completed the
+// authorization, the device code expired, or `ctx` is cancelled.
+func PollDeviceToken(
+	ctx context.Context,
+	client *http.Client,
+	p *Provider,
+	clientId string,
+	da *DeviceAuthorization,
+) (*Token, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	if da.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(
+			ctx, time.Duration(da.ExpiresIn)*time.Second,
+		)
+		defer cancel()
+	}
+
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {da.DeviceCode},
+		"client_id":   {clientId},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var tok Token
+		err := postForm(ctx, client, p.TokenEndpoint, form, &tok)
+		if err == nil {
+			return &tok, nil
+		}
+		tokErr, ok := err.(*TokenError)
+		if !ok {
+			return nil, err
+		}
+		switch tokErr.Code {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, err
+		}
+	}
+}
+
+// `postForm()` decodes a 200 response into `v` and an error response into a
+// `*TokenError`.
+func postForm(
+	ctx context.Context,
+	client *http.Client,
+	endpoint string,
+	form url.Values,
+	v interface{},
+) error {
+	req, err := http.NewRequest(
+		"POST", endpoint, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return json.NewDecoder(res.Body).Decode(v)
+	}
+	var tokErr TokenError
+	if err := json.NewDecoder(res.Body).Decode(&tokErr); err != nil ||
+		tokErr.Code == "" {
+		return fmt.Errorf("POST %s: %s", endpoint, res.Status)
+	}
+	return &tokErr
+}
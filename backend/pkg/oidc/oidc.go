@@ -0,0 +1,232 @@
+// Package `oidc` implements the parts of OpenID Connect that nogfso uses:
+// provider discovery, JSON Web Key Sets to verify token signatures, and the
+// OAuth 2.0 device authorization grant, RFC 8628, to obtain tokens on the
+// command line.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrIssuerMismatch = errors.New("discovery issuer mismatch")
+var ErrUnknownKey = errors.New("unknown JWKS key id")
+
+// `Provider` contains the endpoints from the discovery document
+// `<issuer>/.well-known/openid-configuration`.
+type Provider struct {
+	Issuer                      string `json:"issuer"`
+	JWKSURI                     string `json:"jwks_uri"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// `Discover()` fetches the discovery document of `issuer`.  The document must
+// confirm the issuer.
+func Discover(
+	ctx context.Context, client *http.Client, issuer string,
+) (*Provider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	url := issuer + "/.well-known/openid-configuration"
+	var p Provider
+	if err := getJSON(ctx, client, url, &p); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf(
+			"%s: expected %s, got %s", ErrIssuerMismatch, issuer,
+			p.Issuer,
+		)
+	}
+	return &p, nil
+}
+
+func getJSON(
+	ctx context.Context, client *http.Client, url string, v interface{},
+) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// `KeySet` caches the public keys of a JWKS URI.  It fetches the keys again
+// if it is asked for an unknown key id, but at most every
+// `MinRefreshInterval`, so that tokens with random key ids cannot be used to
+// flood the provider.
+type KeySet struct {
+	MinRefreshInterval time.Duration
+
+	client *http.Client
+	uri    string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func NewKeySet(client *http.Client, uri string) *KeySet {
+	return &KeySet{
+		MinRefreshInterval: 1 * time.Minute,
+		client:             client,
+		uri:                uri,
+	}
+}
+
+// `Key()` returns the key with id `kid`.  If `kid` is empty, the key set must
+// contain exactly one key.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	}
+	if !ks.fetched.IsZero() && time.Since(ks.fetched) < ks.MinRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	keys, err := fetchKeys(ctx, ks.client, ks.uri)
+	ks.fetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = keys
+
+	if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(ks.keys) != 1 {
+			return nil, false
+		}
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// `JWK` is a JSON Web Key, RFC 7517, restricted to the RSA and EC members.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// `fetchKeys()` ignores keys that are not for signatures and keys of
+// unsupported types.
+func fetchKeys(
+	ctx context.Context, client *http.Client, uri string,
+) (map[string]crypto.PublicKey, error) {
+	var jwks JWKS
+	if err := getJSON(ctx, client, uri, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty JWK integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,83 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/oidc"
+	"github.com/nogproject/nog/backend/pkg/oidc/oidctest"
+)
+
+func TestDiscoverKeySet(t *testing.T) {
+	iss, err := oidctest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iss.Close()
+
+	ctx := context.Background()
+	p, err := oidc.Discover(ctx, http.DefaultClient, iss.URL()+"/")
+	if err != nil {
+		t.Fatalf("Discover() failed: %v", err)
+	}
+	if p.JWKSURI != iss.URL()+"/jwks" {
+		t.Errorf("wrong jwks_uri %s", p.JWKSURI)
+	}
+
+	ks := oidc.NewKeySet(http.DefaultClient, p.JWKSURI)
+	k, err := ks.Key(ctx, oidctest.KeyId)
+	if err != nil {
+		t.Fatalf("Key() failed: %v", err)
+	}
+	pub, ok := k.(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected RSA key, got %T", k)
+	}
+	if pub.N.Cmp(iss.Key.PublicKey.N) != 0 {
+		t.Errorf("wrong key")
+	}
+
+	if _, err := ks.Key(ctx, "unknown"); err != oidc.ErrUnknownKey {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	iss, err := oidctest.NewIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iss.Close()
+	iss.PendingPolls = 1
+	iss.DeviceClaims = map[string]interface{}{"sub": "alice"}
+
+	ctx := context.Background()
+	p, err := oidc.Discover(ctx, http.DefaultClient, iss.URL())
+	if err != nil {
+		t.Fatalf("Discover() failed: %v", err)
+	}
+	da, err := oidc.StartDeviceAuthorization(
+		ctx, http.DefaultClient, p, "nogfsoctl", []string{"openid"},
+	)
+	if err != nil {
+		t.Fatalf("StartDeviceAuthorization() failed: %v", err)
+	}
+	if da.UserCode != oidctest.UserCode {
+		t.Errorf("wrong user code %s", da.UserCode)
+	}
+
+	tok, err := oidc.PollDeviceToken(
+		ctx, http.DefaultClient, p, "nogfsoctl", da,
+	)
+	if err != nil {
+		t.Fatalf("PollDeviceToken() failed: %v", err)
+	}
+	if tok.AccessToken == "" {
+		t.Errorf("missing access token")
+	}
+	if n := iss.Polls(); n != 2 {
+		t.Errorf("expected 2 polls, got %d", n)
+	}
+}
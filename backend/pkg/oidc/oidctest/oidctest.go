@@ -0,0 +1,153 @@
+// Package `oidctest` provides a local stand-in OpenID Connect issuer for
+// tests.  It serves discovery, a JWKS with a single RSA key, and a device
+// authorization grant that completes after a configurable number of polls.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	KeyId      = "test-key"
+	DeviceCode = "test-device-code"
+	UserCode   = "TEST-CODE"
+)
+
+type Issuer struct {
+	Server *httptest.Server
+	Key    *rsa.PrivateKey
+
+	// `PendingPolls` is the number of token polls that return
+	// `authorization_pending` before the device grant succeeds.
+	PendingPolls int
+	// `DeviceClaims` are the claims of the access token that the device
+	// grant returns.
+	DeviceClaims jwt.MapClaims
+
+	mu    sync.Mutex
+	polls int
+}
+
+func NewIssuer() (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	iss := &Issuer{Key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.serveDiscovery)
+	mux.HandleFunc("/jwks", iss.serveJWKS)
+	mux.HandleFunc("/device", iss.serveDevice)
+	mux.HandleFunc("/token", iss.serveToken)
+	iss.Server = httptest.NewServer(mux)
+	return iss, nil
+}
+
+func (iss *Issuer) Close() {
+	iss.Server.Close()
+}
+
+func (iss *Issuer) URL() string {
+	return iss.Server.URL
+}
+
+// `Sign()` returns a RS256 JWT with the test key id.
+func (iss *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = KeyId
+	return tok.SignedString(iss.Key)
+}
+
+func (iss *Issuer) Polls() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.polls
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (iss *Issuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	u := iss.URL()
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                        u,
+		"jwks_uri":                      u + "/jwks",
+		"token_endpoint":                u + "/token",
+		"device_authorization_endpoint": u + "/device",
+	})
+}
+
+func (iss *Issuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := &iss.Key.PublicKey
+	enc := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyId,
+			"use": "sig",
+			"n":   enc(pub.N.Bytes()),
+			"e":   enc(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (iss *Issuer) serveDevice(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      DeviceCode,
+		"user_code":        UserCode,
+		"verification_uri": iss.URL() + "/verify",
+		"expires_in":       60,
+		"interval":         1,
+	})
+}
+
+func (iss *Issuer) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_request",
+		})
+		return
+	}
+	if r.PostForm.Get("device_code") != DeviceCode {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_grant",
+		})
+		return
+	}
+
+	iss.mu.Lock()
+	iss.polls++
+	pending := iss.polls <= iss.PendingPolls
+	iss.mu.Unlock()
+	if pending {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "authorization_pending",
+		})
+		return
+	}
+
+	tok, err := iss.Sign(iss.DeviceClaims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "server_error",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": tok,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
@@ -0,0 +1,317 @@
+// Package `openpgpx` supplements `golang.org/x/crypto/openpgp` with the
+// operations that tartt uses to encrypt archives without running gpg2.
+//
+// The messages are compatible with GnuPG in both directions: gpg can decrypt
+// messages that are created with this package, and this package can decrypt
+// the messages that tartt has created with gpg.  Specifically:
+//
+//   - Archive secrets are ASCII-armored messages that are encrypted to
+//     recipient public keys, see `EncryptSecret()` and `DecryptSecret()`.
+//   - Data is symmetrically encrypted with a passphrase, like `gpg
+//     --symmetric`, see `SymmetricEncrypt()` and `SymmetricDecrypt()`.
+//
+// `golang.org/x/crypto/openpgp` supports RSA and ElGamal encryption keys but
+// not ECDH keys, like GnuPG's Curve25519 default since 2.3.
+package openpgpx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	// `openpgp.Encrypt()` requires the hash functions that the key
+	// preferences may select, although the messages are not signed.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+var ErrNoEncryptionKey = errors.New("no valid encryption key")
+var ErrEncryptedIdentity = errors.New(
+	"passphrase-protected private keys are not supported",
+)
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+var ErrUnknownCipher = errors.New("unknown cipher")
+
+// `ReadKeyRing()` reads ASCII-armored or binary keys.
+func ReadKeyRing(data []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+func ReadKeyRingFile(path string) (openpgp.EntityList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadKeyRing(data)
+}
+
+// `ReadIdentityFile()` reads private keys to decrypt secrets.
+func ReadIdentityFile(path string) (openpgp.EntityList, error) {
+	ids, err := ReadKeyRingFile(path)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, e := range ids {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			return nil, ErrEncryptedIdentity
+		}
+		for _, sub := range e.Subkeys {
+			if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+				return nil, ErrEncryptedIdentity
+			}
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no private key in `%s`", path)
+	}
+	return ids, nil
+}
+
+// `ReadRecipients()` parses a list of ASCII-armored public key blocks.  Each
+// block must contain at least one key that can encrypt.
+func ReadRecipients(armored []string) (openpgp.EntityList, error) {
+	var rs openpgp.EntityList
+	for i, a := range armored {
+		es, err := openpgp.ReadArmoredKeyRing(strings.NewReader(a))
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d: %v", i, err)
+		}
+		for _, e := range es {
+			if len(EncryptionKeyIds(e)) == 0 {
+				return nil, fmt.Errorf(
+					"recipient %d: %v", i, ErrNoEncryptionKey,
+				)
+			}
+		}
+		rs = append(rs, es...)
+	}
+	if len(rs) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	return rs, nil
+}
+
+// `EncryptionKeyIds()` returns the ids of the primary key and subkeys that
+// are valid for encryption.
+func EncryptionKeyIds(e *openpgp.Entity) []uint64 {
+	now := time.Now()
+	var ids []uint64
+
+	// Like `openpgp.Entity.encryptionKey()`.
+	for _, sub := range e.Subkeys {
+		sig := sub.Sig
+		if !sig.FlagsValid ||
+			!(sig.FlagEncryptCommunications || sig.FlagEncryptStorage) ||
+			!sub.PublicKey.PubKeyAlgo.CanEncrypt() ||
+			sig.KeyExpired(now) ||
+			isRevoked(sub) {
+			continue
+		}
+		ids = append(ids, sub.PublicKey.KeyId)
+	}
+	if len(ids) > 0 {
+		return ids
+	}
+
+	for _, ident := range e.Identities {
+		sig := ident.SelfSignature
+		if sig == nil || !sig.FlagsValid {
+			continue
+		}
+		if (sig.FlagEncryptCommunications || sig.FlagEncryptStorage) &&
+			e.PrimaryKey.PubKeyAlgo.CanEncrypt() &&
+			!sig.KeyExpired(now) {
+			return []uint64{e.PrimaryKey.KeyId}
+		}
+	}
+	return nil
+}
+
+func isRevoked(sub openpgp.Subkey) bool {
+	return sub.Sig.SigType == packet.SigTypeSubkeyRevocation
+}
+
+// `EncryptSecret()` writes an ASCII-armored message with the secret followed
+// by newline, like `tartt tar` with gpg, encrypted with AES256 if all
+// recipients support it.
+func EncryptSecret(w io.Writer, secret string, to openpgp.EntityList) error {
+	aw, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return err
+	}
+	cfg := &packet.Config{DefaultCipher: packet.CipherAES256}
+	hints := &openpgp.FileHints{IsBinary: true}
+	pw, err := openpgp.Encrypt(aw, to, nil, hints, cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(pw, secret+"\n"); err != nil {
+		return err
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// `DecryptSecret()` decrypts an ASCII-armored secret with one of the
+// identities.
+func DecryptSecret(r io.Reader, ids openpgp.EntityList) (string, error) {
+	block, err := armor.Decode(r)
+	if err != nil {
+		return "", err
+	}
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		return nil, ErrEncryptedIdentity
+	}
+	md, err := openpgp.ReadMessage(block.Body, ids, prompt, nil)
+	if err != nil {
+		return "", err
+	}
+	secret, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+func DecryptSecretFile(path string, ids openpgp.EntityList) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	return DecryptSecret(fp, ids)
+}
+
+// `EncryptedKeyIds()` lists the key ids to which an ASCII-armored message is
+// encrypted without decrypting it, like `gpg --list-only --list-packets`.
+func EncryptedKeyIds(r io.Reader) ([]uint64, error) {
+	block, err := armor.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	pr := packet.NewReader(block.Body)
+	for {
+		p, err := pr.Next()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch p := p.(type) {
+		case *packet.EncryptedKey:
+			ids = append(ids, p.KeyId)
+		default:
+			// Encrypted keys precede the encrypted data.
+			return ids, nil
+		}
+	}
+}
+
+func EncryptedKeyIdsFile(path string) ([]uint64, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return EncryptedKeyIds(fp)
+}
+
+// `ParseCipher()` accepts the gpg names that tartt supports.
+func ParseCipher(name string) (packet.CipherFunction, error) {
+	switch name {
+	case "AES":
+		return packet.CipherAES128, nil
+	case "AES192":
+		return packet.CipherAES192, nil
+	case "AES256":
+		return packet.CipherAES256, nil
+	default:
+		return 0, ErrUnknownCipher
+	}
+}
+
+// `SymmetricEncrypt()` returns a writer that encrypts to `w`, like `gpg
+// --symmetric --cipher-algo <cipher> --compress-algo <ZLIB|Uncompressed>`.
+// The caller must close the writer to complete the message.
+func SymmetricEncrypt(
+	w io.Writer, passphrase string, cipher string, compress bool,
+) (io.WriteCloser, error) {
+	cf, err := ParseCipher(cipher)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &packet.Config{
+		DefaultCipher:          cf,
+		DefaultCompressionAlgo: packet.CompressionNone,
+	}
+	if compress {
+		cfg.DefaultCompressionAlgo = packet.CompressionZLIB
+	}
+	hints := &openpgp.FileHints{IsBinary: true}
+	return openpgp.SymmetricallyEncrypt(w, []byte(passphrase), hints, cfg)
+}
+
+// `SymmetricDecrypt()` returns a reader with the plaintext of a message that
+// has been encrypted with `SymmetricEncrypt()` or `gpg --symmetric`.  The
+// reader returns an error at EOF if the integrity check fails.
+func SymmetricDecrypt(r io.Reader, passphrase string) (io.Reader, error) {
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if !symmetric || tried {
+			return nil, ErrWrongPassphrase
+		}
+		tried = true
+		return []byte(passphrase), nil
+	}
+	md, err := openpgp.ReadMessage(r, nil, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &eofReader{r: md.UnverifiedBody}, nil
+}
+
+// `eofReader` returns `io.EOF` after the first EOF without reading again.
+// `openpgp.MessageDetails.UnverifiedBody` reports a hash mismatch if it is read
+// after EOF, which some readers do, like `zstd.NewReader()`.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// `FormatKeyId()` formats a key id like gpg's long key ids.
+func FormatKeyId(id uint64) string {
+	return fmt.Sprintf("%016X", id)
+}
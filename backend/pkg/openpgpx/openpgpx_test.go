@@ -0,0 +1,194 @@
+package openpgpx_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/openpgpx"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newEntity(t *testing.T, name string) *openpgp.Entity {
+	cfg := &packet.Config{RSABits: 1024}
+	e, err := openpgp.NewEntity(name, "", name+"@example.org", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// `SerializePrivate()` signs the identities and subkeys.
+	if err := e.SerializePrivate(ioutil.Discard, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// `armoredPublic()` round-trips the public key like a config key block.
+func armoredPublic(t *testing.T, e *openpgp.Entity) string {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	alice := newEntity(t, "alice")
+	bob := newEntity(t, "bob")
+	eve := newEntity(t, "eve")
+
+	to, err := openpgpx.ReadRecipients([]string{
+		armoredPublic(t, alice), armoredPublic(t, bob),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg bytes.Buffer
+	if err := openpgpx.EncryptSecret(&msg, "S1234", to); err != nil {
+		t.Fatal(err)
+	}
+
+	keyIds, err := openpgpx.EncryptedKeyIds(bytes.NewReader(msg.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]bool{
+		openpgpx.EncryptionKeyIds(alice)[0]: true,
+		openpgpx.EncryptionKeyIds(bob)[0]:   true,
+	}
+	if len(keyIds) != 2 || !want[keyIds[0]] || !want[keyIds[1]] {
+		t.Errorf("unexpected key ids %x", keyIds)
+	}
+
+	for _, e := range []*openpgp.Entity{alice, bob} {
+		secret, err := openpgpx.DecryptSecret(
+			bytes.NewReader(msg.Bytes()), openpgp.EntityList{e},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "S1234" {
+			t.Errorf("wrong secret %q", secret)
+		}
+	}
+
+	_, err = openpgpx.DecryptSecret(
+		bytes.NewReader(msg.Bytes()), openpgp.EntityList{eve},
+	)
+	if err == nil {
+		t.Error("expected error when decrypting with wrong key")
+	}
+}
+
+func TestReadRecipientsInvalid(t *testing.T) {
+	if _, err := openpgpx.ReadRecipients(nil); err == nil {
+		t.Error("expected error for no recipients")
+	}
+	if _, err := openpgpx.ReadRecipients([]string{"foo"}); err == nil {
+		t.Error("expected error for invalid key block")
+	}
+}
+
+func TestSymmetricRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	for _, cipher := range []string{"AES", "AES192", "AES256"} {
+		for _, compress := range []bool{false, true} {
+			var buf bytes.Buffer
+			w, err := openpgpx.SymmetricEncrypt(
+				&buf, "secret", cipher, compress,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := openpgpx.SymmetricDecrypt(&buf, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf(
+					"%s compress=%v: data mismatch",
+					cipher, compress,
+				)
+			}
+		}
+	}
+}
+
+func TestSymmetricReadAfterEOF(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := openpgpx.SymmetricEncrypt(&buf, "secret", "AES", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openpgpx.SymmetricDecrypt(&buf, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if n, err := r.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+			t.Errorf("read after EOF: got %d, %v", n, err)
+		}
+	}
+}
+
+func TestSymmetricWrongPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := openpgpx.SymmetricEncrypt(&buf, "secret", "AES", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openpgpx.SymmetricDecrypt(&buf, "wrong")
+	if err == nil {
+		_, err = ioutil.ReadAll(r)
+	}
+	if err == nil {
+		t.Error("expected error with wrong passphrase")
+	}
+}
+
+func TestSymmetricUnknownCipher(t *testing.T) {
+	_, err := openpgpx.SymmetricEncrypt(
+		ioutil.Discard, "secret", "CAST5", false,
+	)
+	if err != openpgpx.ErrUnknownCipher {
+		t.Errorf("expected ErrUnknownCipher, got %v", err)
+	}
+}
@@ -0,0 +1,309 @@
+/*
+Package `tarcatalog` builds and reads member catalogs of tar streams.
+
+A catalog lists for each tar member its byte range in the tar stream, so that
+individual members can be extracted by reading only the range, for example
+from a tar stream that has been stored as a sequence of separately compressed
+and encrypted chunks of fixed size.
+
+The catalog is a text file.  It starts with a header line:
+
+	# tartt-catalog v1 chunk-size=<bytes>
+
+followed by one line per member with tab-separated fields:
+
+	<offset> <end> <size> <mtime> <mode> <type> <name>
+
+`<offset>` is the start of the first header block of the member, including
+GNU long name headers.  `<end>` is the start of the next member.  `<size>` is
+the file size.  `<mtime>` is in Unix seconds.  `<mode>` is octal.  `<type>` is
+the tar type flag.  `<name>` is quoted in GNU tar quoting style "escape".
+*/
+package tarcatalog
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/tarquote"
+)
+
+const blockSize = 512
+
+const headerPrefix = "# tartt-catalog v1 chunk-size="
+
+var ErrMalformed = errors.New("malformed catalog")
+
+type Entry struct {
+	Offset int64
+	End    int64
+	Size   int64
+	Mtime  time.Time
+	Mode   int64
+	Type   byte
+	Name   string
+}
+
+type Catalog struct {
+	// `ChunkSize` is the size of the plaintext chunks in which the tar
+	// stream has been stored, or 0 if unknown.
+	ChunkSize int64
+	Entries   []Entry
+}
+
+// `Range` is a byte range `[Start, End)` in the tar stream.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// `Build()` reads the tar stream `r` and writes its catalog to `w`.  `r` is
+// read until EOF, also after the tar end-of-archive marker.
+func Build(w io.Writer, r io.Reader, chunkSize int64) error {
+	bw := bufio.NewWriter(w)
+	if err := WriteHeader(bw, chunkSize); err != nil {
+		return err
+	}
+	if err := BuildEntries(bw, r, 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// `WriteHeader()` writes the catalog header line.
+func WriteHeader(w io.Writer, chunkSize int64) error {
+	_, err := fmt.Fprintf(w, "%s%d\n", headerPrefix, chunkSize)
+	return err
+}
+
+// `BuildEntries()` is like `Build()` without the header.  The tar stream `r`
+// starts at `offset` in the original stream, which must be the start of a
+// member.  Each entry is written with a single `Write()`, so that an
+// unbuffered `w` contains only complete entries if the build is interrupted.
+func BuildEntries(w io.Writer, r io.Reader, offset int64) error {
+	base := offset
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Read the data instead of relying on `hdr.Size` to handle
+		// sparse files, whose stored size is smaller.
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return err
+		}
+		end := base + roundUpBlock(cr.n)
+		if err := writeEntry(w, &Entry{
+			Offset: offset,
+			End:    end,
+			Size:   hdr.Size,
+			Mtime:  hdr.ModTime,
+			Mode:   hdr.Mode,
+			Type:   hdr.Typeflag,
+			Name:   hdr.Name,
+		}); err != nil {
+			return err
+		}
+		offset = end
+	}
+	_, err := io.Copy(ioutil.Discard, cr)
+	return err
+}
+
+func roundUpBlock(n int64) int64 {
+	return (n + blockSize - 1) / blockSize * blockSize
+}
+
+func writeEntry(w io.Writer, e *Entry) error {
+	typ := e.Type
+	if typ == 0 {
+		typ = tar.TypeReg
+	}
+	_, err := fmt.Fprintf(
+		w, "%d\t%d\t%d\t%d\t%o\t%c\t%s\n",
+		e.Offset, e.End, e.Size, e.Mtime.Unix(), e.Mode, typ,
+		tarquote.QuoteEscape(e.Name),
+	)
+	return err
+}
+
+func Read(r io.Reader) (*Catalog, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrMalformed
+	}
+	head := s.Text()
+	if !strings.HasPrefix(head, headerPrefix) {
+		return nil, ErrMalformed
+	}
+	chunkSize, err := strconv.ParseInt(
+		strings.TrimPrefix(head, headerPrefix), 10, 64,
+	)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	c := &Catalog{ChunkSize: chunkSize}
+	for s.Scan() {
+		e, err := ParseEntry(s.Text())
+		if err != nil {
+			return nil, err
+		}
+		c.Entries = append(c.Entries, *e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// `ParseEntry()` parses a catalog line without the newline.
+func ParseEntry(line string) (*Entry, error) {
+	fields := strings.SplitN(line, "\t", 7)
+	if len(fields) != 7 || len(fields[5]) != 1 {
+		return nil, ErrMalformed
+	}
+	var ints [5]int64
+	for i, base := range []int{10, 10, 10, 10, 8} {
+		v, err := strconv.ParseInt(fields[i], base, 64)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		ints[i] = v
+	}
+	name, err := tarquote.UnquoteEscape(fields[6])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return &Entry{
+		Offset: ints[0],
+		End:    ints[1],
+		Size:   ints[2],
+		Mtime:  time.Unix(ints[3], 0).UTC(),
+		Mode:   ints[4],
+		Type:   fields[5][0],
+		Name:   name,
+	}, nil
+}
+
+// `Select()` returns the entries that GNU tar may extract for `members`,
+// which are literal names.  A member selects an entry with the same name and,
+// if it is a directory, all entries below it.  A leading `./` and trailing
+// `/` are ignored, so that the selection may be larger than what tar
+// extracts, but never smaller.
+func (c *Catalog) Select(members []string) []Entry {
+	norm := make([]string, 0, len(members))
+	for _, m := range members {
+		norm = append(norm, trimName(m))
+	}
+
+	var sel []Entry
+	for _, e := range c.Entries {
+		name := trimName(e.Name)
+		for _, m := range norm {
+			if m == "" || name == m ||
+				strings.HasPrefix(name, m+"/") {
+				sel = append(sel, e)
+				break
+			}
+		}
+	}
+	return sel
+}
+
+func trimName(s string) string {
+	s = strings.TrimPrefix(s, "./")
+	s = strings.TrimPrefix(s, "/")
+	return strings.TrimSuffix(s, "/")
+}
+
+// `Ranges()` returns the sorted byte ranges of `entries`, merging adjacent
+// ranges.
+func Ranges(entries []Entry) []Range {
+	rgs := make([]Range, 0, len(entries))
+	for _, e := range entries {
+		rgs = append(rgs, Range{Start: e.Offset, End: e.End})
+	}
+	sort.Slice(rgs, func(i, j int) bool {
+		return rgs[i].Start < rgs[j].Start
+	})
+
+	merged := rgs[:0]
+	for _, r := range rgs {
+		n := len(merged)
+		if n > 0 && r.Start <= merged[n-1].End {
+			if r.End > merged[n-1].End {
+				merged[n-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// `FormatRanges()` formats ranges as `<start>-<end>,...`, which
+// `ParseRanges()` accepts.
+func FormatRanges(rgs []Range) string {
+	parts := make([]string, 0, len(rgs))
+	for _, r := range rgs {
+		parts = append(parts, fmt.Sprintf("%d-%d", r.Start, r.End))
+	}
+	return strings.Join(parts, ",")
+}
+
+// `ParseRanges()` parses `<start>-<end>,...`.  The ranges must be sorted and
+// must not overlap.
+func ParseRanges(s string) ([]Range, error) {
+	var rgs []Range
+	var prevEnd int64
+	for _, part := range strings.Split(s, ",") {
+		se := strings.SplitN(part, "-", 2)
+		if len(se) != 2 {
+			return nil, fmt.Errorf("malformed range `%s`", part)
+		}
+		start, err := strconv.ParseInt(se[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed range `%s`", part)
+		}
+		end, err := strconv.ParseInt(se[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed range `%s`", part)
+		}
+		if start < prevEnd || end <= start {
+			return nil, fmt.Errorf("invalid range `%s`", part)
+		}
+		rgs = append(rgs, Range{Start: start, End: end})
+		prevEnd = end
+	}
+	return rgs, nil
+}
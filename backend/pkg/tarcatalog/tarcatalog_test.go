@@ -0,0 +1,154 @@
+package tarcatalog_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/tarcatalog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRead(t *testing.T) {
+	mtime := time.Unix(1539000000, 0).UTC()
+	longName := "./dir/" + strings.Repeat("x", 150)
+	members := []struct {
+		name string
+		typ  byte
+		data string
+	}{
+		{"./", tar.TypeDir, ""},
+		{"./dir/", tar.TypeDir, ""},
+		{"./dir/a\tb", tar.TypeReg, "a"},
+		{longName, tar.TypeReg, strings.Repeat("y", 1000)},
+		{"./other", tar.TypeReg, "other"},
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     m.name,
+			Typeflag: m.typ,
+			Mode:     0644,
+			Size:     int64(len(m.data)),
+			ModTime:  mtime,
+			Format:   tar.FormatGNU,
+		}))
+		_, err := io.WriteString(tw, m.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	stream := buf.Bytes()
+
+	var catBuf bytes.Buffer
+	require.NoError(t, tarcatalog.Build(
+		&catBuf, bytes.NewReader(stream), 1024,
+	))
+	cat, err := tarcatalog.Read(&catBuf)
+	require.NoError(t, err)
+	require.Equal(t, int64(1024), cat.ChunkSize)
+	require.Len(t, cat.Entries, len(members))
+
+	for i, e := range cat.Entries {
+		m := members[i]
+		require.Equal(t, m.name, e.Name)
+		require.Equal(t, int64(len(m.data)), e.Size)
+		require.Equal(t, mtime, e.Mtime)
+		require.Equal(t, int64(0644), e.Mode)
+		require.Equal(t, m.typ, e.Type)
+
+		// The range with an end-of-archive marker is a tar stream
+		// that contains only the member.
+		part := append(
+			append([]byte{}, stream[e.Offset:e.End]...),
+			make([]byte, 1024)...,
+		)
+		tr := tar.NewReader(bytes.NewReader(part))
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		require.Equal(t, m.name, hdr.Name)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		require.Equal(t, m.data, string(data))
+		_, err = tr.Next()
+		require.Equal(t, io.EOF, err)
+	}
+
+	sel := cat.Select([]string{"dir"})
+	require.Len(t, sel, 3)
+	rgs := tarcatalog.Ranges(sel)
+	require.Equal(t, []tarcatalog.Range{
+		{Start: cat.Entries[1].Offset, End: cat.Entries[3].End},
+	}, rgs)
+
+	sel = cat.Select([]string{"./other", "./dir/a\tb"})
+	require.Len(t, sel, 2)
+	require.Len(t, tarcatalog.Ranges(sel), 2)
+	require.Len(t, cat.Select([]string{"./missing"}), 0)
+}
+
+func TestRanges(t *testing.T) {
+	rgs := []tarcatalog.Range{
+		{Start: 0, End: 512},
+		{Start: 1024, End: 2048},
+	}
+	s := tarcatalog.FormatRanges(rgs)
+	require.Equal(t, "0-512,1024-2048", s)
+	parsed, err := tarcatalog.ParseRanges(s)
+	require.NoError(t, err)
+	require.Equal(t, rgs, parsed)
+
+	for _, bad := range []string{"", "1", "2-1", "0-512,256-1024", "a-b"} {
+		_, err := tarcatalog.ParseRanges(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestBuildEntriesOffset(t *testing.T) {
+	mtime := time.Unix(1539000000, 0).UTC()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"./a", "./b", "./c"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     600,
+			ModTime:  mtime,
+			Format:   tar.FormatGNU,
+		}))
+		_, err := tw.Write(make([]byte, 600))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	stream := buf.Bytes()
+
+	var full bytes.Buffer
+	require.NoError(t, tarcatalog.Build(
+		&full, bytes.NewReader(stream), 0,
+	))
+	cat, err := tarcatalog.Read(bytes.NewReader(full.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, cat.Entries, 3)
+
+	// Entries built from the stream that starts at the second member
+	// are the same as the corresponding lines of the full catalog.
+	off := cat.Entries[1].Offset
+	var tail bytes.Buffer
+	require.NoError(t, tarcatalog.BuildEntries(
+		&tail, bytes.NewReader(stream[off:]), off,
+	))
+	lines := strings.SplitAfter(full.String(), "\n")
+	require.Equal(t, strings.Join(lines[2:], ""), tail.String())
+
+	e, err := tarcatalog.ParseEntry(strings.TrimSuffix(lines[2], "\n"))
+	require.NoError(t, err)
+	require.Equal(t, cat.Entries[1], *e)
+	_, err = tarcatalog.ParseEntry("0\t512\t")
+	require.Equal(t, tarcatalog.ErrMalformed, err)
+}
@@ -1,6 +1,7 @@
 /*
 
-Package `tarquote` converts quoted tar member names to UTF-8 strings.
+Package `tarquote` converts between quoted tar member names and UTF-8
+strings.
 
 The package only supports the default quoting style "escape".  See GNU tar
 manual section "Quoting Member Names",
@@ -11,7 +12,10 @@ package tarquote
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var ErrSyntax = errors.New("invalid quoted string")
@@ -103,3 +107,39 @@ func UnquoteEscapeChar(s string) (head byte, tail string, err error) {
 	tail = s
 	return
 }
+
+// `QuoteEscape()` quotes `s` in GNU tar quoting style "escape" as GNU tar does
+// in a UTF-8 locale: printable UTF-8 is kept, control characters use C
+// escapes, and other bytes, like invalid UTF-8, use octal escapes.
+func QuoteEscape(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\a':
+			b.WriteString(`\a`)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\v':
+			b.WriteString(`\v`)
+		case r == utf8.RuneError && size == 1, !unicode.IsPrint(r):
+			for i := 0; i < size; i++ {
+				fmt.Fprintf(&b, "\\%03o", s[i])
+			}
+		default:
+			b.WriteString(s[:size])
+		}
+		s = s[size:]
+	}
+	return b.String()
+}
@@ -94,3 +94,37 @@ func TestUnquote(t *testing.T) {
 		}
 	}
 }
+
+func TestQuote(t *testing.T) {
+	for _, spec := range []struct {
+		s string
+		q string
+	}{
+		{"abc", "abc"},
+		{"./a b/", "./a b/"},
+		{"a\tb", "a\\tb"},
+		{"a\nb", "a\\nb"},
+		{"a\\b", "a\\\\b"},
+		{"c\001x", "c\\001x"},
+		// Printable UTF-8 is kept; invalid UTF-8 uses octal.
+		{"äbc", "äbc"},
+		{"d\377y", "d\\377y"},
+	} {
+		q := tarquote.QuoteEscape(spec.s)
+		if q != spec.q {
+			t.Errorf(
+				"Case '%s': wrong quoted string: "+
+					"expected '%s', got '%s'.",
+				spec.s, spec.q, q,
+			)
+		}
+		un, err := tarquote.UnquoteEscape(q)
+		if err != nil || un != spec.s {
+			t.Errorf(
+				"Case '%s': quote does not round-trip: "+
+					"got '%s', err '%v'.",
+				spec.s, un, err,
+			)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// `SpanData` is a finished span in the Zipkin v2 JSON format.  Timestamps and
+// durations are in microseconds.
+type SpanData struct {
+	TraceId       string            `json:"traceId"`
+	Id            string            `json:"id"`
+	ParentId      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          Kind              `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint *Endpoint         `json:"localEndpoint,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+
+	start time.Time
+}
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type Exporter interface {
+	ExportSpan(s *SpanData)
+}
+
+// `ExportCloser` is an exporter that must be closed during shutdown to flush
+// buffered spans.
+type ExportCloser interface {
+	Exporter
+	Close() error
+}
+
+var exporter atomic.Value
+
+type exporterBox struct {
+	Exporter
+}
+
+// `SetExporter()` configures the process-wide exporter.  Use `nil` to disable
+// recording.
+func SetExporter(e Exporter) {
+	exporter.Store(exporterBox{e})
+}
+
+func getExporter() Exporter {
+	b, _ := exporter.Load().(exporterBox)
+	return b.Exporter
+}
+
+// `Open()` creates an exporter from a URL: `file:///<path>` appends JSON lines
+// to a local file; `http://...` or `https://...` posts batches of spans to a
+// Zipkin-compatible collector, like `http://localhost:9411/api/v2/spans`.
+// Spans are tagged with `service`.
+func Open(spec string, service string) (ExportCloser, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return NewFileExporter(u.Path, service)
+	case "http", "https":
+		return NewZipkinExporter(spec, service), nil
+	default:
+		return nil, fmt.Errorf("unsupported trace URL scheme `%s`", u.Scheme)
+	}
+}
+
+type Logger interface {
+	Infow(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+// `StartExporter()` opens the exporter `spec`, see `Open()`, and configures
+// it as the process-wide exporter.  It returns a function that disables
+// recording and closes the exporter during shutdown.  If `spec` is empty,
+// export remains disabled, and the returned function does nothing.
+func StartExporter(lg Logger, spec string, service string) (func(), error) {
+	if spec == "" {
+		return func() {}, nil
+	}
+	e, err := Open(spec, service)
+	if err != nil {
+		return nil, err
+	}
+	SetExporter(e)
+	exportSpec.Store(spec)
+	lg.Infow("Enabled trace export.", "url", spec)
+	return func() {
+		SetExporter(nil)
+		exportSpec.Store("")
+		if err := e.Close(); err != nil {
+			lg.Errorw("Failed to close trace exporter.", "err", err)
+		}
+	}, nil
+}
+
+// `StartExporterFromEnviron()` is like `StartExporter()` with the spec from
+// the environment variable `NOG_TRACE_EXPORT`, which `Environ()` passes to
+// subprocesses.
+func StartExporterFromEnviron(lg Logger, service string) (func(), error) {
+	return StartExporter(lg, os.Getenv(EnvTraceExport), service)
+}
+
+var exportSpec atomic.Value
+
+func getExportSpec() string {
+	s, _ := exportSpec.Load().(string)
+	return s
+}
+
+// `FileExporter` appends spans as JSON lines to a file.
+type FileExporter struct {
+	endpoint *Endpoint
+	mu       sync.Mutex
+	fp       *os.File
+	enc      *json.Encoder
+}
+
+func NewFileExporter(path string, service string) (*FileExporter, error) {
+	fp, err := os.OpenFile(
+		path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{
+		endpoint: &Endpoint{ServiceName: service},
+		fp:       fp,
+		enc:      json.NewEncoder(fp),
+	}, nil
+}
+
+// `ExportSpan()` ignores write errors, since tracing must not affect the
+// traced operations.
+func (e *FileExporter) ExportSpan(s *SpanData) {
+	s.LocalEndpoint = e.endpoint
+	e.mu.Lock()
+	_ = e.enc.Encode(s)
+	e.mu.Unlock()
+}
+
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.fp.Close()
+}
+
+// `ZipkinExporter` posts spans in batches.  Spans are dropped if the queue is
+// full or the collector is unavailable.
+type ZipkinExporter struct {
+	url      string
+	endpoint *Endpoint
+	client   *http.Client
+	queue    chan *SpanData
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var (
+	ZipkinQueueSize     = 1000
+	ZipkinBatchSize     = 100
+	ZipkinFlushInterval = 1 * time.Second
+	ZipkinPostTimeout   = 10 * time.Second
+)
+
+func NewZipkinExporter(url string, service string) *ZipkinExporter {
+	e := &ZipkinExporter{
+		url:      url,
+		endpoint: &Endpoint{ServiceName: service},
+		client:   &http.Client{Timeout: ZipkinPostTimeout},
+		queue:    make(chan *SpanData, ZipkinQueueSize),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *ZipkinExporter) ExportSpan(s *SpanData) {
+	s.LocalEndpoint = e.endpoint
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+// `Close()` posts the queued spans.
+func (e *ZipkinExporter) Close() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.queue)
+	e.mu.Unlock()
+	<-e.done
+	return nil
+}
+
+func (e *ZipkinExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(ZipkinFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, ZipkinBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		_ = e.post(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= ZipkinBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *ZipkinExporter) post(batch []*SpanData) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(), ZipkinPostTimeout,
+	)
+	defer cancel()
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("zipkin collector status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Package `trace` implements minimal distributed tracing.
+//
+// Spans are identified by W3C Trace Context ids, which are propagated between
+// processes as a `traceparent` string, see
+// <https://www.w3.org/TR/trace-context/>.  Package `grpctrace` propagates it
+// in gRPC metadata.  Subprocesses receive it in the environment variable
+// `TRACEPARENT` together with the exporter spec in `NOG_TRACE_EXPORT`; see
+// `Environ()` and `FromEnviron()`.
+//
+// Spans are recorded only if an exporter has been configured with
+// `SetExporter()`.  Without exporter, spans are nonetheless created, so that
+// the trace context is propagated to other processes, which may export them.
+// Exporters write spans in the Zipkin v2 JSON format, which common tracing
+// collectors accept.
+package trace
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nogproject/nog/backend/pkg/ulid"
+	"github.com/nogproject/nog/backend/pkg/uuid"
+)
+
+type TraceId [16]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type SpanId [8]byte
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// `SpanContext` is the part of a span that is propagated to other processes.
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceId != TraceId{} && sc.SpanId != SpanId{}
+}
+
+var ErrMalformedTraceparent = errors.New("malformed traceparent")
+
+// `ParseTraceparent()` parses a version 00 `traceparent`, like
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return sc, ErrMalformedTraceparent
+	}
+	if err := decodeHex(sc.TraceId[:], parts[1]); err != nil {
+		return sc, err
+	}
+	if err := decodeHex(sc.SpanId[:], parts[2]); err != nil {
+		return sc, err
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, err
+	}
+	sc.Sampled = flags[0]&0x01 != 0
+	if !sc.IsValid() {
+		return sc, ErrMalformedTraceparent
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) {
+		return ErrMalformedTraceparent
+	}
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return ErrMalformedTraceparent
+	}
+	return nil
+}
+
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceId, sc.SpanId, flags)
+}
+
+type Kind string
+
+const (
+	KindInternal Kind = ""
+	KindServer   Kind = "SERVER"
+	KindClient   Kind = "CLIENT"
+)
+
+type Span struct {
+	exporter Exporter
+	sc       SpanContext
+
+	mu   sync.Mutex
+	data SpanData
+	done bool
+}
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+	remoteKey
+)
+
+// `WithRemote()` returns a context whose spans continue the trace of the
+// remote span `sc`.
+func WithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// `FromContext()` returns the current span or `nil`.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// `SpanContextFromContext()` returns the span context of the current span or
+// of the remote parent.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s := FromContext(ctx); s != nil {
+		return s.sc, true
+	}
+	sc, ok := ctx.Value(remoteKey).(SpanContext)
+	return sc, ok
+}
+
+// `Start()` starts a span that is a child of the current span or the remote
+// parent in `ctx`, or the root of a new trace.  The caller must call
+// `End()`.
+func Start(ctx context.Context, name string, kind Kind) (
+	context.Context, *Span,
+) {
+	exporter := getExporter()
+	s := &Span{exporter: exporter}
+	parent, hasParent := SpanContextFromContext(ctx)
+	if hasParent {
+		s.sc.TraceId = parent.TraceId
+		s.sc.Sampled = parent.Sampled
+		s.data.ParentId = parent.SpanId.String()
+	} else {
+		_, _ = crand.Read(s.sc.TraceId[:])
+		s.sc.Sampled = exporter != nil
+	}
+	_, _ = crand.Read(s.sc.SpanId[:])
+
+	if exporter != nil {
+		now := time.Now()
+		s.data.TraceId = s.sc.TraceId.String()
+		s.data.Id = s.sc.SpanId.String()
+		s.data.Name = name
+		s.data.Kind = kind
+		s.data.Timestamp = now.UnixNano() / 1000
+		s.data.start = now
+	}
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// `StartWorkflow()` starts a span for processing a workflow view, tagged with
+// the workflow id and the event id of the view, so that it can be correlated
+// with the gRPC spans of the workflow.  The caller must call `End()`.
+func StartWorkflow(
+	ctx context.Context, name string, workflowId uuid.I, vid ulid.I,
+) (context.Context, *Span) {
+	ctx, span := Start(ctx, "workflow/"+name, KindInternal)
+	span.SetAttr("nogfso.workflow", workflowId.String())
+	span.SetAttr("nogfso.vid", vid.String())
+	return ctx, span
+}
+
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+func (s *Span) isRecording() bool {
+	return s.exporter != nil
+}
+
+func (s *Span) SetAttr(k, v string) {
+	if !s.isRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.data.Tags == nil {
+		s.data.Tags = make(map[string]string)
+	}
+	s.data.Tags[k] = v
+	s.mu.Unlock()
+}
+
+// `SetError()` marks the span as failed if `err` is not `nil`.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetAttr("error", err.Error())
+}
+
+// `End()` exports the span.  Further calls are ignored.
+func (s *Span) End() {
+	if !s.isRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.data.Duration = int64(time.Since(s.data.start) / time.Microsecond)
+	data := s.data
+	s.mu.Unlock()
+	s.exporter.ExportSpan(&data)
+}
+
+// `SetAttr()` sets an attribute on the current span if there is one.
+func SetAttr(ctx context.Context, k, v string) {
+	if s := FromContext(ctx); s != nil {
+		s.SetAttr(k, v)
+	}
+}
+
+// `EnvTraceparent` is the environment variable that passes the trace context
+// to subprocesses.
+const EnvTraceparent = "TRACEPARENT"
+
+// `EnvTraceExport` is the environment variable that passes the exporter spec
+// of `StartExporter()` to subprocesses, so that they can export their spans,
+// too; see `StartExporterFromEnviron()`.
+const EnvTraceExport = "NOG_TRACE_EXPORT"
+
+// `Environ()` returns the environment entries that pass the trace context of
+// `ctx` and the exporter spec to a subprocess, like `cmd.Env =
+// append(os.Environ(), trace.Environ(ctx)...)`.
+func Environ(ctx context.Context) []string {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	env := []string{EnvTraceparent + "=" + sc.Traceparent()}
+	if spec := getExportSpec(); spec != "" {
+		env = append(env, EnvTraceExport+"="+spec)
+	}
+	return env
+}
+
+// `FromEnviron()` returns a context that continues the trace from the
+// environment variable `TRACEPARENT` if it is set.
+func FromEnviron(ctx context.Context) context.Context {
+	sc, err := ParseTraceparent(os.Getenv(EnvTraceparent))
+	if err != nil {
+		return ctx
+	}
+	return WithRemote(ctx, sc)
+}
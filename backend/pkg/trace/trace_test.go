@@ -0,0 +1,155 @@
+package trace_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nogproject/nog/backend/pkg/trace"
+)
+
+func TestTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := trace.ParseTraceparent(tp)
+	if err != nil {
+		t.Fatalf("ParseTraceparent() failed: %v", err)
+	}
+	if sc.TraceId.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("wrong trace id %s", sc.TraceId)
+	}
+	if sc.SpanId.String() != "00f067aa0ba902b7" {
+		t.Errorf("wrong span id %s", sc.SpanId)
+	}
+	if !sc.Sampled {
+		t.Errorf("expected sampled")
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("expected %s, got %s", tp, got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01",
+	} {
+		if _, err := trace.ParseTraceparent(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+type memExporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *memExporter) ExportSpan(s *trace.SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	e.mu.Unlock()
+}
+
+func TestSpans(t *testing.T) {
+	exporter := &memExporter{}
+	trace.SetExporter(exporter)
+	defer trace.SetExporter(nil)
+
+	remote, _ := trace.ParseTraceparent(
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	)
+	ctx := trace.WithRemote(context.Background(), remote)
+	ctx, parent := trace.Start(ctx, "parent", trace.KindServer)
+	_, child := trace.Start(ctx, "child", trace.KindClient)
+	child.SetAttr("k", "v")
+	child.End()
+	parent.End()
+	parent.End()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exporter.spans))
+	}
+	c, p := exporter.spans[0], exporter.spans[1]
+	if p.TraceId != remote.TraceId.String() ||
+		c.TraceId != remote.TraceId.String() {
+		t.Errorf("spans do not continue the remote trace")
+	}
+	if p.ParentId != remote.SpanId.String() {
+		t.Errorf("wrong parent of parent span: %s", p.ParentId)
+	}
+	if c.ParentId != p.Id {
+		t.Errorf("wrong parent of child span: %s", c.ParentId)
+	}
+	if c.Tags["k"] != "v" {
+		t.Errorf("missing attribute")
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	ctx, span := trace.Start(context.Background(), "x", trace.KindInternal)
+	env := trace.Environ(ctx)
+	want := "TRACEPARENT=" + span.Context().Traceparent()
+	if len(env) != 1 || env[0] != want {
+		t.Errorf("expected [%s], got %v", want, env)
+	}
+	if env := trace.Environ(context.Background()); env != nil {
+		t.Errorf("expected no environ without span, got %v", env)
+	}
+}
+
+type nullLogger struct{}
+
+func (nullLogger) Infow(msg string, kv ...interface{})  {}
+func (nullLogger) Errorw(msg string, kv ...interface{}) {}
+
+func TestFromEnviron(t *testing.T) {
+	_, span := trace.Start(context.Background(), "x", trace.KindInternal)
+	tp := span.Context().Traceparent()
+	os.Setenv(trace.EnvTraceparent, tp)
+	defer os.Unsetenv(trace.EnvTraceparent)
+
+	ctx := trace.FromEnviron(context.Background())
+	sc, ok := trace.SpanContextFromContext(ctx)
+	if !ok || sc != span.Context() {
+		t.Errorf("expected remote parent %s, got %v", tp, sc)
+	}
+}
+
+func TestStartExporterEnviron(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := "file://" + filepath.Join(dir, "spans.jsonl")
+	closeTracing, err := trace.StartExporter(nullLogger{}, spec, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, span := trace.Start(context.Background(), "x", trace.KindInternal)
+	env := trace.Environ(ctx)
+	want := trace.EnvTraceExport + "=" + spec
+	if len(env) != 2 || env[1] != want {
+		t.Errorf("expected %s in %v", want, env)
+	}
+	span.End()
+	closeTracing()
+
+	if env := trace.Environ(ctx); len(env) != 1 {
+		t.Errorf("expected no export spec after close, got %v", env)
+	}
+	dat, err := ioutil.ReadFile(filepath.Join(dir, "spans.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dat), `"name":"x"`) {
+		t.Errorf("expected exported span, got %s", dat)
+	}
+}
@@ -47,3 +47,12 @@ const RFC3339Milli = "2006-01-02T15:04:05.000Z07:00"
 func TimeString(id I) string {
 	return Time(id).Format(RFC3339Milli)
 }
+
+// `MinAt(t)` returns the smallest id with time `t`, which can be used as the
+// lower bound in range queries.
+func MinAt(t time.Time) I {
+	var id I
+	// `SetTime()` fails only for times beyond year 10889.
+	_ = id.SetTime(ulid.Timestamp(t))
+	return id
+}
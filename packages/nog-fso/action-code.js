@@ -41,12 +41,14 @@ const ActionCode = {
   'fso/list-repos': null,
   'fso/list-repos-recursive': null,
   'fso/preview': null,
+  'fso/read-audit': 'fra',
   'fso/read-main': 'frm',
   'fso/read-registry': 'frg',
   'fso/read-repo': 'frr',
   'fso/read-repo-tree': null,
   'fso/read-root': 'frt',
   'fso/refresh-repo': 'ffr',
+  'fso/revoke-token': 'ftr',
   'fso/session': 'fs',
   'fso/test-udo': 'fttu',
   'fso/test-udo-as': 'ftta',
@@ -43,12 +43,14 @@ const AllFsoActions = [
   'fso/list-repos',
   'fso/list-repos-recursive',
   'fso/preview',
+  'fso/read-audit',
   'fso/read-main',
   'fso/read-registry',
   'fso/read-repo',
   'fso/read-repo-tree',
   'fso/read-root',
   'fso/refresh-repo',
+  'fso/revoke-token',
   'fso/session',
   'fso/test-udo',
   'fso/test-udo-as',